@@ -0,0 +1,159 @@
+// Command backup creates and restores portable journal backup archives.
+//
+// Usage (run from go-core so migrations resolve, like the API server):
+//
+//	go run ./cmd/backup create -user 1 -out journal.zip
+//	go run ./cmd/backup restore -user 1 -in journal.zip -mode merge
+//
+// The database defaults to DB_PATH, falling back to ../db.sqlite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/secrets"
+	"go-core/internal/services/backup"
+	"go-core/internal/utils"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	utils.InitLogger()
+
+	var err error
+	switch os.Args[1] {
+	case "create":
+		err = create(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backup create -user ID [-out FILE] [-db PATH]")
+	fmt.Fprintln(os.Stderr, "       backup restore -user ID -in FILE [-mode merge|replace] [-db PATH]")
+}
+
+// create writes a backup archive for a user
+func create(args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	userID := flags.Int("user", 0, "user ID to back up")
+	out := flags.String("out", "", "archive path (default: journal-backup-<user>-<timestamp>.zip)")
+	dbPath := flags.String("db", defaultDBPath(), "SQLite database path")
+	flags.Parse(args)
+
+	if *userID <= 0 {
+		return fmt.Errorf("-user is required")
+	}
+	if *out == "" {
+		*out = backup.FileName(*userID, time.Now())
+	}
+
+	db, keyring, err := openDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *out, err)
+	}
+
+	manifest, err := backup.NewService(db.GetConnection(), keyring).Backup(file, *userID)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Printf("wrote %s (schema v%d): %v\n", *out, manifest.SchemaVersion, manifest.Counts)
+	return nil
+}
+
+// restore loads a backup archive into an existing user
+func restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	userID := flags.Int("user", 0, "user ID to restore into")
+	in := flags.String("in", "", "archive path")
+	modeName := flags.String("mode", string(backup.RestoreModeMerge), "merge or replace")
+	dbPath := flags.String("db", defaultDBPath(), "SQLite database path")
+	flags.Parse(args)
+
+	if *userID <= 0 || *in == "" {
+		return fmt.Errorf("-user and -in are required")
+	}
+	mode, err := backup.ParseRestoreMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *in, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	db, keyring, err := openDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := backup.NewService(db.GetConnection(), keyring).Restore(file, info.Size(), *userID, mode)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %s (%s): created %v, skipped %v, deleted %v\n", *in, result.Mode, result.Created, result.Skipped, result.Deleted)
+	return nil
+}
+
+// openDB opens the database and loads the master key beside it, as the API server does
+func openDB(path string) (*data.DB, *secrets.Keyring, error) {
+	keyring, err := secrets.Load(filepath.Join(filepath.Dir(path), "master.key"))
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := data.NewDB(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, keyring, nil
+}
+
+// defaultDBPath mirrors the API server's database location
+func defaultDBPath() string {
+	if path := os.Getenv("DB_PATH"); path != "" {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return filepath.Join("..", "db.sqlite")
+	}
+	return filepath.Join(wd, "..", "db.sqlite")
+}
@@ -0,0 +1,48 @@
+// Command brokersim runs a fake Dhan and Kite Connect server for trying sync flows offline.
+//
+// Usage:
+//
+//	go run ./cmd/brokersim -addr :9090 -fixtures default
+//
+// Then start the API server pointed at it:
+//
+//	DHAN_PROD_API=http://localhost:9090/dhan/v2 DHAN_AUTH_URL=http://localhost:9090/dhan/auth \
+//	KITE_API_URL=http://localhost:9090/kite KITE_AUTH_URL=http://localhost:9090/kite/auth go run ./cmd
+//
+// -fixtures takes a JSON file or the name of a built-in fixture set. The built-in "default"
+// set accepts the app credentials and access tokens it declares, so a user can be configured
+// with them directly instead of going through the browser login.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go-core/internal/brokersim"
+	"go-core/internal/utils"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	fixtures := flag.String("fixtures", "default", "fixture file, or the name of a built-in fixture set")
+	flag.Parse()
+
+	utils.InitLogger()
+
+	loaded, err := brokersim.LoadFixtures(*fixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	utils.LogInfo("Broker simulator listening", map[string]interface{}{
+		"addr":     *addr,
+		"fixtures": *fixtures,
+	})
+	if err := http.ListenAndServe(*addr, brokersim.New(loaded)); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,174 @@
+// Command candles imports OHLCV bars from local CSV files into the candle store.
+//
+// Usage (run from go-core so migrations resolve, like the API server):
+//
+//	go run ./cmd/candles import -timeframe 1m data/INFY.csv data/TCS.csv
+//	go run ./cmd/candles import -timeframe 1d -symbol NIFTY nifty-daily.csv
+//	go run ./cmd/candles import -timeframe 1m data/
+//	go run ./cmd/candles series
+//
+// Files without a symbol column take -symbol, or else their name up to the first '_' or '.';
+// directories import every .csv file in them. The database defaults to DB_PATH, falling
+// back to ../db.sqlite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/candles"
+	"go-core/internal/utils"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	utils.InitLogger()
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = importFiles(os.Args[2:])
+	case "series":
+		err = series(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: candles import -timeframe TF [-symbol SYMBOL] [-db PATH] FILE|DIR...")
+	fmt.Fprintln(os.Stderr, "       candles series [-symbol SYMBOL] [-db PATH]")
+}
+
+// importFiles loads each CSV file into the store
+func importFiles(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	timeframeName := flags.String("timeframe", "", "timeframe of the bars: 1m, 5m, 15m, 30m, 1h, 4h, 1d or 1w")
+	symbol := flags.String("symbol", "", "symbol for files without a symbol column (default: from the file name)")
+	dbPath := flags.String("db", defaultDBPath(), "SQLite database path")
+	flags.Parse(args)
+
+	timeframe, err := candles.ParseTimeframe(*timeframeName)
+	if err != nil {
+		return err
+	}
+	paths, err := csvFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no CSV files given")
+	}
+
+	db, err := data.NewDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service := candles.NewService(db.GetConnection())
+	for _, path := range paths {
+		fileSymbol := *symbol
+		if fileSymbol == "" {
+			fileSymbol = symbolFromFileName(path)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		result, err := service.Import(file, fileSymbol, timeframe)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		fmt.Printf("%s: %d %s bars of %s, %d resampled, %d skipped\n",
+			path, result.Imported, timeframe, strings.Join(result.Symbols, ", "), result.Resampled, result.Skipped)
+		for _, rowErr := range result.Errors {
+			fmt.Printf("  %s\n", rowErr)
+		}
+	}
+	return nil
+}
+
+// series prints the stored symbols and timeframes
+func series(args []string) error {
+	flags := flag.NewFlagSet("series", flag.ExitOnError)
+	symbol := flags.String("symbol", "", "only this symbol")
+	dbPath := flags.String("db", defaultDBPath(), "SQLite database path")
+	flags.Parse(args)
+
+	db, err := data.NewDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stored, err := repos.NewCandleRepository(db.GetConnection()).GetSeries(strings.ToUpper(*symbol))
+	if err != nil {
+		return err
+	}
+	for _, s := range stored {
+		fmt.Printf("%-20s %-4s %8d bars  %s to %s\n", s.Symbol, s.Timeframe, s.Count,
+			s.From.In(utils.IST).Format("2006-01-02 15:04"), s.To.In(utils.IST).Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// csvFiles expands directories into the .csv files directly inside them
+func csvFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.csv"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// symbolFromFileName takes INFY from INFY.csv or INFY_1m.csv; '-' is kept as in BAJAJ-AUTO
+func symbolFromFileName(path string) string {
+	name := filepath.Base(path)
+	if end := strings.IndexAny(name, "_."); end > 0 {
+		name = name[:end]
+	}
+	return strings.ToUpper(name)
+}
+
+// defaultDBPath mirrors the API server's database location
+func defaultDBPath() string {
+	if path := os.Getenv("DB_PATH"); path != "" {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return filepath.Join("..", "db.sqlite")
+	}
+	return filepath.Join(wd, "..", "db.sqlite")
+}
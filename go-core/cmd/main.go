@@ -17,13 +17,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	_ "go-core/docs" // Import docs for swagger
 	"go-core/internal/api"
 	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/algoscheduler"
+	"go-core/internal/services/syncjobs"
+	"go-core/internal/services/tokens"
 	"go-core/internal/utils"
 )
 
@@ -44,6 +52,14 @@ func main() {
 		dbPath = filepath.Join(wd, "..", "db.sqlite")
 	}
 
+	// Load the master key broker credentials are encrypted with
+	keyring, err := secrets.Load(filepath.Join(filepath.Dir(dbPath), "master.key"))
+	if err != nil {
+		utils.LogFatal("Failed to load master key", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	utils.LogInfo("Initializing database", map[string]interface{}{
 		"path": dbPath,
 	})
@@ -57,6 +73,7 @@ func main() {
 		})
 	}
 	defer db.Close()
+	db.SetKeyring(keyring)
 
 	// Set global database instance
 	data.SetDB(db)
@@ -79,13 +96,43 @@ func main() {
 
 	utils.LogInfo("Database test passed")
 
+	// Encrypt plaintext broker credentials and re-encrypt legacy ones and those under retired master keys
+	reencrypted, err := repos.NewUserRepository(db.GetConnection(), keyring).ReencryptBrokerCredentials()
+	if err != nil {
+		utils.LogFatal("Failed to encrypt broker credentials", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	utils.LogInfo("Broker credentials encrypted", map[string]interface{}{
+		"master_key_id": keyring.ActiveKeyID(),
+		"users_updated": reencrypted,
+	})
+
+	// Start background token renewal
+	tokenManager := tokens.NewManager(db.GetConnection(), keyring)
+	tokenManager.Start()
+	defer tokenManager.Stop()
+
+	// Start background broker sync runner
+	jobs := syncjobs.NewRunner(db.GetConnection(), keyring)
+	jobs.Start()
+	defer jobs.Stop()
+
+	// Start running enabled live algorithms as their bars close
+	scheduler := algoscheduler.NewScheduler(db.GetConnection())
+	scheduler.Start()
+	defer scheduler.Stop()
+
 	// Start API server
 	utils.LogInfo("Starting API server")
-	server := api.NewServer(db)
+	server := api.NewServer(db, jobs)
+
+	// Serve until interrupted, then let requests in flight finish before the deferred stops run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Start the server
 	utils.LogInfo("API server ready to accept requests")
-	if err := server.Run(":8080"); err != nil {
+	if err := server.Run(ctx, ":8080"); err != nil {
 		utils.LogFatal("Failed to start API server", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -0,0 +1,158 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// crossoverAlgorithm is written the way the web editor's template is: annotations, f-strings,
+// sum() and state kept in context['state'] across runs
+const crossoverAlgorithm = `def algorithm(data: list, context: dict) -> dict:
+    if not data:
+        return {'signal': 'HOLD', 'reason': 'No data available'}
+
+    state = context['state']
+    state['runs'] = state.get('runs', 0) + 1
+
+    closes = [candle['close'] for candle in data]
+    fast = sum(closes[-5:]) / 5
+    slow = sum(closes[-20:]) / 20
+    prev_fast = state.get('prev_fast')
+    state['prev_fast'] = fast
+    state['prev_slow'] = slow
+    if prev_fast is None:
+        return {'signal': 'HOLD', 'reason': 'Warming up'}
+
+    price = data[-1]['close']
+    if fast > slow:
+        return {
+            'signal': 'buy',
+            'quantity': context['config'].get('quantity', 1),
+            'price': price,
+            'stop_loss': price * 0.98,
+            'target': price * 1.05,
+            'reason': f'Fast SMA ({fast:.2f}) above slow SMA ({slow:.2f}) on run {state["runs"]}',
+        }
+    return {'signal': 'HOLD'}
+`
+
+// rising returns n one-minute candles whose closes climb from 100
+func rising(n int) []map[string]interface{} {
+	start := time.Date(2030, 1, 1, 9, 15, 0, 0, time.UTC)
+	candles := make([]map[string]interface{}, n)
+	for i := range candles {
+		price := 100 + float64(i)
+		candles[i] = map[string]interface{}{
+			"timestamp": start.Add(time.Duration(i) * time.Minute),
+			"open":      price - 0.5,
+			"high":      price + 1,
+			"low":       price - 1,
+			"close":     price,
+			"volume":    1000,
+		}
+	}
+	return candles
+}
+
+// createAlgorithm stores an algorithm for the test user and returns its ID
+func createAlgorithm(e *env, code string, config map[string]interface{}) string {
+	e.t.Helper()
+
+	var algo struct {
+		ID string `json:"id"`
+	}
+	e.mustDo(http.MethodPost, "/api/v1/algorithms", map[string]interface{}{
+		"user_id":        e.userID,
+		"name":           "Crossover",
+		"code":           code,
+		"status":         "draft",
+		"symbol":         "INFY",
+		"timeframe":      "1m",
+		"execution_mode": "paper_trading",
+		"config":         config,
+	}, http.StatusCreated, &algo)
+	return algo.ID
+}
+
+func TestAlgorithmEvaluationPersistsSignalAndState(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	id := createAlgorithm(e, crossoverAlgorithm, map[string]interface{}{"quantity": 25})
+	evaluate := fmt.Sprintf("/api/v1/algorithms/%s/evaluate?user_id=%d", id, e.userID)
+
+	type result struct {
+		Signal struct {
+			Signal   string   `json:"signal"`
+			Quantity int      `json:"quantity"`
+			StopLoss *float64 `json:"stop_loss"`
+			Reason   string   `json:"reason"`
+		} `json:"signal"`
+		State map[string]interface{} `json:"state"`
+	}
+
+	var first result
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(30)}, http.StatusOK, &first)
+	if first.Signal.Signal != "HOLD" || first.Signal.Reason != "Warming up" {
+		t.Fatalf("first run signal %+v, want HOLD while warming up", first.Signal)
+	}
+
+	// The second run sees the state the first one left
+	var second result
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(31)}, http.StatusOK, &second)
+	if second.Signal.Signal != "BUY" || second.Signal.Quantity != 25 || second.Signal.StopLoss == nil {
+		t.Fatalf("second run signal %+v, want BUY 25 with a stop loss", second.Signal)
+	}
+	if want := "Fast SMA (128.00) above slow SMA (120.50) on run 2"; second.Signal.Reason != want {
+		t.Fatalf("reason %q, want %q", second.Signal.Reason, want)
+	}
+
+	var algo struct {
+		LastRunAt  *string                `json:"last_run_at"`
+		LastSignal *string                `json:"last_signal"`
+		State      map[string]interface{} `json:"state"`
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s?user_id=%d", id, e.userID), nil, http.StatusOK, &algo)
+	if algo.LastRunAt == nil || algo.LastSignal == nil || *algo.LastSignal != "BUY" {
+		t.Fatalf("algorithm last run %v, last signal %v, want a run with BUY", algo.LastRunAt, algo.LastSignal)
+	}
+	if algo.State["runs"] != float64(2) {
+		t.Fatalf("persisted state %v, want runs = 2", algo.State)
+	}
+}
+
+type validation struct {
+	Valid       bool `json:"valid"`
+	Diagnostics []struct {
+		Message string `json:"message"`
+	} `json:"diagnostics"`
+	Samples []struct {
+		Bar    int `json:"bar"`
+		Signal struct {
+			Signal string `json:"signal"`
+		} `json:"signal"`
+	} `json:"samples"`
+	Signals map[string]int         `json:"signals"`
+	State   map[string]interface{} `json:"state"`
+}
+
+func validate(e *env, body map[string]interface{}) validation {
+	e.t.Helper()
+	var got validation
+	e.mustDo(http.MethodPost, "/api/v1/algorithms/validate", body, http.StatusOK, &got)
+	return got
+}
+
+func TestAlgorithmValidationDryRuns(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	// Valid code gets a signal for every synthetic bar
+	got := validate(e, map[string]interface{}{"code": crossoverAlgorithm, "bars": 40})
+	if !got.Valid || len(got.Diagnostics) != 0 || len(got.Samples) != 40 ||
+		got.Signals["HOLD"]+got.Signals["BUY"]+got.Signals["SELL"] != 40 || got.Signals["BUY"] == 0 || got.State["runs"] != 40.0 {
+		t.Fatalf("crossover validation %+v", got)
+	}
+	if again := validate(e, map[string]interface{}{"code": crossoverAlgorithm, "bars": 40}); again.Signals["BUY"] != got.Signals["BUY"] {
+		t.Fatalf("dry runs differ: %v then %v", got.Signals, again.Signals)
+	}
+}
@@ -0,0 +1,112 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// scriptedAlgorithm buys 10 shares on the third bar and sells on the sixth, counting bars in its state
+const scriptedAlgorithm = `def algorithm(data, context):
+    state = context['state']
+    state['bar'] = state.get('bar', 0) + 1
+    if state['bar'] == context['config'].get('fail_at'):
+        fail('boom')
+    if state['bar'] == 3:
+        return {'signal': 'BUY', 'quantity': 10, 'target': context['config'].get('target')}
+    if state['bar'] == 6:
+        return {'signal': 'SELL', 'reason': 'sixth bar'}
+    return {'signal': 'HOLD'}
+`
+
+type backtestResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Bars   int    `json:"bar_count"`
+	Trades []struct {
+		Direction  string  `json:"direction"`
+		Quantity   int     `json:"quantity"`
+		EntryPrice float64 `json:"entry_price"`
+		ExitPrice  float64 `json:"exit_price"`
+		Charges    float64 `json:"charges"`
+		PnL        float64 `json:"pnl"`
+		ExitReason string  `json:"exit_reason"`
+	} `json:"trades"`
+	EquityCurve []struct {
+		Equity float64 `json:"equity"`
+	} `json:"equity_curve"`
+	Metrics struct {
+		FinalEquity float64 `json:"final_equity"`
+		TotalTrades int     `json:"total_trades"`
+		WinRate     float64 `json:"win_rate"`
+		TotalPnL    float64 `json:"total_pnl"`
+	} `json:"metrics"`
+}
+
+func TestBacktestSimulatesFillsAndPersistsRuns(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	// Ten one-minute bars closing 100 to 109, each opening half a rupee below its close
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 10)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+
+	id := createAlgorithm(e, scriptedAlgorithm, nil)
+	path := fmt.Sprintf("/api/v1/algorithms/%s/backtests?user_id=%d", id, e.userID)
+
+	// Filled at the next bar's open: bought at 102.5 and sold at 105.5, paying 10 a fill
+	var nextOpen backtestResult
+	e.mustDo(http.MethodPost, path, map[string]interface{}{
+		"initial_capital": 10000,
+		"charges":         map[string]interface{}{"model": "flat", "per_order": 10},
+	}, http.StatusCreated, &nextOpen)
+	if nextOpen.Status != "completed" || nextOpen.Bars != 10 || len(nextOpen.EquityCurve) != 10 {
+		t.Fatalf("backtest %+v, want 10 completed bars", nextOpen)
+	}
+	if len(nextOpen.Trades) != 1 {
+		t.Fatalf("got trades %+v, want one round trip", nextOpen.Trades)
+	}
+	trade := nextOpen.Trades[0]
+	if trade.Direction != "long" || trade.Quantity != 10 || trade.EntryPrice != 102.5 || trade.ExitPrice != 105.5 ||
+		trade.Charges != 20 || trade.PnL != 10 || trade.ExitReason != "sixth bar" {
+		t.Fatalf("trade %+v, want 10 long from 102.5 to 105.5 netting 10", trade)
+	}
+	if nextOpen.Metrics.FinalEquity != 10010 || nextOpen.Metrics.TotalTrades != 1 || nextOpen.Metrics.WinRate != 1 {
+		t.Fatalf("metrics %+v", nextOpen.Metrics)
+	}
+
+	// Filled at the signal bar's close, a target of 104 is reached on the fourth bar
+	targeted := createAlgorithm(e, scriptedAlgorithm, map[string]interface{}{"target": 104})
+	var atClose backtestResult
+	e.mustDo(http.MethodPost, fmt.Sprintf("/api/v1/algorithms/%s/backtests?user_id=%d", targeted, e.userID), map[string]interface{}{
+		"fill": "close",
+		"from": "2030-01-07",
+	}, http.StatusCreated, &atClose)
+	if len(atClose.Trades) != 1 || atClose.Trades[0].EntryPrice != 102 || atClose.Trades[0].ExitPrice != 104 ||
+		atClose.Trades[0].ExitReason != "target" || atClose.Metrics.TotalPnL != 20 {
+		t.Fatalf("close-fill backtest trades %+v, metrics %+v", atClose.Trades, atClose.Metrics)
+	}
+
+	// A backtest never touches the algorithm's own state
+	var algo struct {
+		State map[string]interface{} `json:"state"`
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s?user_id=%d", id, e.userID), nil, http.StatusOK, &algo)
+	if len(algo.State) != 0 {
+		t.Fatalf("algorithm state %v, want it untouched", algo.State)
+	}
+
+	e.mustDo(http.MethodPost, path, map[string]interface{}{"fill": "close"}, http.StatusCreated, nil)
+	var listed []backtestResult
+	e.mustDo(http.MethodGet, path, nil, http.StatusOK, &listed)
+	if len(listed) != 2 || listed[0].Trades != nil || listed[1].ID != nextOpen.ID {
+		t.Fatalf("listed backtests %+v, want two summaries, newest first", listed)
+	}
+
+	var stored backtestResult
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s/backtests/%s?user_id=%d", id, nextOpen.ID, e.userID), nil, http.StatusOK, &stored)
+	if len(stored.Trades) != 1 || len(stored.EquityCurve) != 10 || stored.Metrics != nextOpen.Metrics {
+		t.Fatalf("stored backtest %+v, want the run as returned", stored)
+	}
+}
@@ -0,0 +1,120 @@
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// importCandles uploads a candle CSV and returns the status and raw body
+func importCandles(e *env, symbol, timeframe, csv string) (int, []byte) {
+	e.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("symbol", symbol)
+	form.WriteField("timeframe", timeframe)
+	part, _ := form.CreateFormFile("file", symbol+".csv")
+	io.WriteString(part, csv)
+	form.Close()
+
+	resp, err := http.Post(e.api.URL+"/api/v1/candles/import", form.FormDataContentType(), &body)
+	if err != nil {
+		e.t.Fatalf("import %s candles: %v", symbol, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, raw
+}
+
+// minuteBars returns a CSV of one-minute bars from 09:15 IST on date, closing 100, 101, ...
+// with a volume of 10 each
+func minuteBars(date string, n int) string {
+	var csv strings.Builder
+	csv.WriteString("date,time,open,high,low,close,volume\n")
+	for i := 0; i < n; i++ {
+		minute := 9*60 + 15 + i
+		price := 100 + float64(i)
+		fmt.Fprintf(&csv, "%s,%02d:%02d,%.2f,%.2f,%.2f,%.2f,10\n", date, minute/60, minute%60, price-0.5, price+1, price-1, price)
+	}
+	return csv.String()
+}
+
+type storedCandle struct {
+	Timestamp string  `json:"timestamp"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    int64   `json:"volume"`
+}
+
+func TestCandleImportResamplesHigherTimeframes(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	// A CSV without a symbol column needs one
+	if status, body := importCandles(e, "", "1m", minuteBars("2030-01-07", 5)); status != http.StatusBadRequest {
+		t.Fatalf("import without symbol: status %d, want 400: %s", status, body)
+	}
+
+	// Two hours of Monday, then the rest of the first hour again with a bad row
+	status, body := importCandles(e, "infy", "1m", minuteBars("2030-01-07", 120))
+	if status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	rerun := minuteBars("2030-01-07", 60) + "2030-01-07,10:30,100,99,101,100,10\n"
+	status, body = importCandles(e, "INFY", "1m", rerun)
+	if status != http.StatusOK || !strings.Contains(string(body), `"skipped_count":1`) {
+		t.Fatalf("re-import candles: status %d, want one skipped row: %s", status, body)
+	}
+
+	var hourly []storedCandle
+	e.mustDo(http.MethodGet, "/api/v1/candles?symbol=INFY&timeframe=1h&from=2030-01-07", nil, http.StatusOK, &hourly)
+	if len(hourly) != 2 {
+		t.Fatalf("got %d hourly bars, want 2: %+v", len(hourly), hourly)
+	}
+	// Hourly bars start at the 09:15 IST session open
+	first := hourly[0]
+	if first.Timestamp != "2030-01-07T03:45:00Z" || first.Open != 99.5 || first.High != 160 || first.Low != 99 || first.Close != 159 || first.Volume != 600 {
+		t.Fatalf("first hourly bar %+v", first)
+	}
+
+	var fives []storedCandle
+	e.mustDo(http.MethodGet, "/api/v1/candles?symbol=INFY&timeframe=5m&limit=3", nil, http.StatusOK, &fives)
+	if len(fives) != 3 || fives[2].Timestamp != "2030-01-07T05:40:00Z" || fives[2].Close != 219 {
+		t.Fatalf("latest 5m bars %+v, want the last three ending 11:10 IST at 219", fives)
+	}
+
+	var daily []storedCandle
+	e.mustDo(http.MethodGet, "/api/v1/candles?symbol=INFY&timeframe=1d", nil, http.StatusOK, &daily)
+	if len(daily) != 1 || daily[0].Timestamp != "2030-01-06T18:30:00Z" || daily[0].Volume != 1200 || daily[0].Close != 219 {
+		t.Fatalf("daily bars %+v, want one from midnight IST with the day's volume", daily)
+	}
+
+	var series []struct {
+		Timeframe string `json:"timeframe"`
+		Count     int    `json:"count"`
+	}
+	e.mustDo(http.MethodGet, "/api/v1/candles/series?symbol=INFY", nil, http.StatusOK, &series)
+	if len(series) != 8 {
+		t.Fatalf("got %d series, want every timeframe: %+v", len(series), series)
+	}
+
+	// An algorithm without posted candles reads the latest stored bars of its timeframe
+	id := createAlgorithm(e, `def algorithm(data, context):
+    return {'signal': 'HOLD', 'reason': f'{len(data)} bars, last close {data[-1]["close"]}'}
+`, nil)
+	var result struct {
+		Signal struct {
+			Reason string `json:"reason"`
+		} `json:"signal"`
+	}
+	e.mustDo(http.MethodPost, fmt.Sprintf("/api/v1/algorithms/%s/evaluate?user_id=%d", id, e.userID), map[string]interface{}{}, http.StatusOK, &result)
+	if result.Signal.Reason != "120 bars, last close 219.0" {
+		t.Fatalf("algorithm saw %q, want the 120 stored 1m bars", result.Signal.Reason)
+	}
+}
@@ -0,0 +1,190 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-core/internal/brokersim"
+	"go-core/internal/data"
+)
+
+// loginDhan saves the fixture's app credentials and completes the consent flow
+func loginDhan(e *env) {
+	e.t.Helper()
+
+	fixture := e.sim.Fixtures().Dhan
+	e.mustDo(http.MethodPost, e.userPath("/dhan/save-credentials"), map[string]string{
+		"api_key":        fixture.AppID,
+		"api_secret":     fixture.AppSecret,
+		"dhan_client_id": fixture.ClientID,
+	}, http.StatusOK, nil)
+
+	var consent struct {
+		LoginURL string `json:"login_url"`
+	}
+	e.mustDo(http.MethodPost, e.userPath("/dhan/generate-consent"), map[string]string{
+		"dhan_client_id": fixture.ClientID,
+	}, http.StatusOK, &consent)
+
+	// The simulator signs the user in at once and hands back the tokenId
+	resp, err := http.Get(consent.LoginURL)
+	if err != nil {
+		e.t.Fatalf("open Dhan login: %v", err)
+	}
+	defer resp.Body.Close()
+	var login struct {
+		TokenID string `json:"tokenId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil || login.TokenID == "" {
+		e.t.Fatalf("Dhan login: status %d, tokenId %q, err %v", resp.StatusCode, login.TokenID, err)
+	}
+
+	var consumed struct {
+		DhanClientID string `json:"dhan_client_id"`
+	}
+	e.mustDo(http.MethodPost, e.userPath("/dhan/consume-consent"), map[string]string{
+		"token_id": login.TokenID,
+	}, http.StatusOK, &consumed)
+	if consumed.DhanClientID != fixture.ClientID {
+		e.t.Fatalf("consumed consent for client %q, want %q", consumed.DhanClientID, fixture.ClientID)
+	}
+}
+
+// dhanTradesPage returns the simulator path of a page of a first Dhan sync, which starts in 1999
+func dhanTradesPage(page int) string {
+	return fmt.Sprintf("/dhan/v2/trades/1999-01-01/%s/%d", time.Now().UTC().Format("2006-01-02"), page)
+}
+
+// withScalpTrades adds pairs of WIPRO buys and sells three days ago to the Dhan fixture
+func withScalpTrades(pairs int) func(e *env, fixtures *brokersim.Fixtures) {
+	return func(e *env, fixtures *brokersim.Fixtures) {
+		date := time.Now().UTC().AddDate(0, 0, -3).Format("2006-01-02")
+		for i := 0; i < pairs; i++ {
+			for side, price := range map[string]float64{"BUY": 500, "SELL": 501} {
+				minute := 2 * i
+				if side == "SELL" {
+					minute++
+				}
+				trade, _ := json.Marshal(map[string]interface{}{
+					"orderId":         fmt.Sprintf("W-%s-%d", side, i),
+					"exchangeOrderId": fmt.Sprintf("E-%s-%d", side, i),
+					"exchangeTradeId": fmt.Sprintf("T-%s-%d", side, i),
+					"transactionType": side,
+					"exchangeSegment": "NSE_EQ",
+					"productType":     "INTRADAY",
+					"orderType":       "MARKET",
+					"customSymbol":    "WIPRO",
+					"tradedQuantity":  1,
+					"tradedPrice":     price,
+					"exchangeTime":    fmt.Sprintf("%s %02d:%02d:00", date, 9+minute/60, minute%60),
+				})
+				fixtures.Dhan.Trades = append(fixtures.Dhan.Trades, trade)
+			}
+		}
+	}
+}
+
+func TestDhanConsentSyncPaginationAndDedupe(t *testing.T) {
+	e := newEnv(t, "default", withScalpTrades(75))
+	loginDhan(e)
+
+	var first syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, &first)
+	if first.Fetched != 153 || first.Recorded != 153 {
+		t.Fatalf("first sync fetched %d and recorded %d fills, want 153", first.Fetched, first.Recorded)
+	}
+	if e.sim.Hits(dhanTradesPage(0)) != 1 || e.sim.Hits(dhanTradesPage(1)) != 1 {
+		t.Fatalf("expected one request per page, got %d and %d", e.sim.Hits(dhanTradesPage(0)), e.sim.Hits(dhanTradesPage(1)))
+	}
+	if len(first.Warnings) > 0 {
+		t.Fatalf("unexpected warnings: %v", first.Warnings)
+	}
+	if first.Snapshot == nil || first.Snapshot.Positions != 1 || first.Snapshot.Holdings != 1 {
+		t.Fatalf("snapshot not refreshed: %+v", first.Snapshot)
+	}
+
+	var infy, wipro, tcs int
+	for _, trade := range e.trades() {
+		switch trade.Symbol {
+		case "INFY":
+			infy++
+			if trade.Quantity != 10 || trade.EntryPrice != 1500 || trade.ExitPrice == nil || *trade.ExitPrice != 1520 {
+				t.Errorf("INFY round trip matched as %+v", trade)
+			}
+		case "WIPRO":
+			wipro++
+			if trade.ExitPrice == nil {
+				t.Errorf("WIPRO trade left open: %+v", trade)
+			}
+		case "TCS":
+			tcs++
+			if trade.ExitPrice != nil {
+				t.Errorf("TCS buy should still be open: %+v", trade)
+			}
+		}
+	}
+	if infy != 1 || wipro != 75 || tcs != 1 {
+		t.Fatalf("journal has %d INFY, %d WIPRO and %d TCS trades, want 1, 75 and 1", infy, wipro, tcs)
+	}
+
+	// The next sync starts on the latest trade's day and skips the fills it already has
+	var second syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, &second)
+	if second.Fetched == 0 || second.Skipped != second.Fetched || second.Saved != 0 || second.Recorded != 0 {
+		t.Fatalf("second sync should only skip fills: %+v", second)
+	}
+	if got := len(e.trades()); got != 77 {
+		t.Fatalf("journal has %d trades after the second sync, want 77", got)
+	}
+}
+
+func TestDhanRenewsRejectedToken(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	loginDhan(e)
+	before := e.sim.AccessToken(data.TradingBrokerDhan)
+
+	e.sim.FailNext(dhanTradesPage(0), http.StatusUnauthorized, 1)
+
+	var result syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, &result)
+	if result.Fetched != 3 {
+		t.Fatalf("sync after renewal fetched %d fills, want 3", result.Fetched)
+	}
+	if e.sim.Hits("/dhan/v2/RenewToken") != 1 {
+		t.Fatalf("token renewed %d times, want once", e.sim.Hits("/dhan/v2/RenewToken"))
+	}
+	if e.sim.AccessToken(data.TradingBrokerDhan) == before {
+		t.Fatal("simulator still holds the old token")
+	}
+	if state := e.tokenState(data.TradingBrokerDhan); state != "valid" {
+		t.Fatalf("token state %q after renewal, want valid", state)
+	}
+
+	// The renewed token was saved: the next sync uses it without renewing again
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, &result)
+	if e.sim.Hits("/dhan/v2/RenewToken") != 1 {
+		t.Fatal("renewed token was not saved")
+	}
+}
+
+func TestDhanRevokedTokenNeedsLogin(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	loginDhan(e)
+
+	e.sim.Revoke(data.TradingBrokerDhan)
+
+	status, body := e.do(http.MethodPost, e.userPath("/trades/sync-dhan"), nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("sync with a revoked token: status %d, want 401: %s", status, body)
+	}
+	if state := e.tokenState(data.TradingBrokerDhan); state != "revoked" {
+		t.Fatalf("token state %q, want revoked", state)
+	}
+
+	// Logging in again restores syncing
+	loginDhan(e)
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, nil)
+}
@@ -0,0 +1,146 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closes are one-minute candles with the given closes
+func closes(values ...float64) []map[string]interface{} {
+	start := time.Date(2030, 1, 1, 9, 15, 0, 0, time.UTC)
+	candles := make([]map[string]interface{}, len(values))
+	for i, price := range values {
+		candles[i] = map[string]interface{}{
+			"timestamp": start.Add(time.Duration(i) * time.Minute),
+			"open":      price,
+			"high":      price + 1,
+			"low":       price - 1,
+			"close":     price,
+			"volume":    1000,
+		}
+	}
+	return candles
+}
+
+func graphNode(id, nodeType string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": nodeType, "position": map[string]interface{}{"x": 0, "y": 0}, "data": data}
+}
+
+// graphEdge wires source to target; handles may be empty
+func graphEdge(source, sourceHandle, target, targetHandle string) map[string]interface{} {
+	return map[string]interface{}{
+		"id": source + "-" + target, "source": source, "target": target,
+		"sourceHandle": sourceHandle, "targetHandle": targetHandle,
+	}
+}
+
+// smaCrossGraph buys when the close crosses above its SMA and sells when it crosses below
+func smaCrossGraph(period int) map[string]interface{} {
+	return map[string]interface{}{
+		"nodes": []interface{}{
+			graphNode("price", "marketData", map[string]interface{}{"label": "Price"}),
+			graphNode("sma", "indicator", map[string]interface{}{"label": "SMA Indicator", "period": period}),
+			graphNode("up", "condition", map[string]interface{}{"label": "close above SMA", "operator": "crosses_above"}),
+			graphNode("down", "condition", map[string]interface{}{"label": "close below SMA", "operator": "crosses_below"}),
+			graphNode("risk", "riskManagement", map[string]interface{}{"quantity": 5, "stop_loss_pct": 2, "target_pct": "4"}),
+			graphNode("dhan", "broker", map[string]interface{}{"broker": "Dhan"}),
+		},
+		"edges": []interface{}{
+			graphEdge("price", "", "sma", ""),
+			graphEdge("price", "close", "up", "a"),
+			graphEdge("sma", "", "up", "b"),
+			graphEdge("price", "", "down", ""),
+			graphEdge("sma", "value", "down", ""),
+			graphEdge("up", "", "dhan", "buy"),
+			graphEdge("down", "", "dhan", "sell"),
+			graphEdge("risk", "", "dhan", ""),
+		},
+	}
+}
+
+func TestAlgorithmGraphCompilesAndRuns(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	var created struct {
+		ID    string                 `json:"id"`
+		Code  string                 `json:"code"`
+		Graph map[string]interface{} `json:"graph"`
+	}
+	e.mustDo(http.MethodPost, "/api/v1/algorithms", map[string]interface{}{
+		"user_id": e.userID, "name": "SMA cross", "status": "draft", "symbol": "INFY", "timeframe": "1m",
+		"execution_mode": "paper_trading", "graph": smaCrossGraph(3),
+	}, http.StatusCreated, &created)
+	if !strings.Contains(created.Code, "def algorithm(data, context):") || created.Graph == nil {
+		t.Fatalf("created %+v", created)
+	}
+	base := fmt.Sprintf("/api/v1/algorithms/%s", created.ID)
+	query := fmt.Sprintf("?user_id=%d", e.userID)
+
+	type signal struct {
+		Signal   string   `json:"signal"`
+		Quantity int      `json:"quantity"`
+		StopLoss *float64 `json:"stop_loss"`
+		Target   *float64 `json:"target"`
+		Reason   string   `json:"reason"`
+	}
+	evaluate := func(values ...float64) signal {
+		t.Helper()
+		var got struct {
+			Signal signal `json:"signal"`
+		}
+		e.mustDo(http.MethodPost, base+"/evaluate"+query, map[string]interface{}{"candles": closes(values...)}, http.StatusOK, &got)
+		return got.Signal
+	}
+
+	// SMA(3) goes from 9 to 9.67 while the close jumps from 8 to 12
+	if got := evaluate(10, 10, 10, 9, 8, 12); got.Signal != "BUY" || got.Quantity != 5 || got.Reason != "buy condition met: close above SMA" ||
+		got.StopLoss == nil || fmt.Sprintf("%.2f", *got.StopLoss) != "11.76" || got.Target == nil || fmt.Sprintf("%.2f", *got.Target) != "12.48" {
+		t.Fatalf("crossing above: %+v", got)
+	}
+
+	// A new graph recompiles the code and is versioned with it
+	var updated struct {
+		Code    string `json:"code"`
+		Version int    `json:"version"`
+	}
+	e.mustDo(http.MethodPut, base+query, map[string]interface{}{"graph": smaCrossGraph(2)}, http.StatusOK, &updated)
+	if updated.Version != 2 || updated.Code == created.Code || !strings.Contains(updated.Code, "_sma([bar['close'] for bar in bars], 2)") {
+		t.Fatalf("updated %+v", updated)
+	}
+	var version struct {
+		Graph struct {
+			Nodes []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"nodes"`
+		} `json:"graph"`
+	}
+	e.mustDo(http.MethodGet, base+"/versions/1"+query, nil, http.StatusOK, &version)
+	if len(version.Graph.Nodes) != 6 || version.Graph.Nodes[1].Data["period"] != 3.0 {
+		t.Fatalf("version 1 graph %+v", version.Graph)
+	}
+	if status, body := e.do(http.MethodPut, base+query, map[string]interface{}{"graph": map[string]interface{}{"nodes": []interface{}{graphNode("dhan", "broker", nil)}}}); status != http.StatusBadRequest {
+		t.Fatalf("update with an invalid graph: status %d: %s", status, body)
+	}
+
+	// Hand-written code replaces the graph; rolling back brings it back
+	var algo struct {
+		Graph map[string]interface{} `json:"graph"`
+	}
+	e.mustDo(http.MethodPut, base+query, map[string]interface{}{"code": scriptedAlgorithm}, http.StatusOK, &algo)
+	if algo.Graph != nil {
+		t.Fatalf("graph kept after a code edit: %+v", algo.Graph)
+	}
+	var rolledBack struct {
+		Algorithm struct {
+			Code  string                 `json:"code"`
+			Graph map[string]interface{} `json:"graph"`
+		} `json:"algorithm"`
+	}
+	e.mustDo(http.MethodPost, base+"/versions/1/rollback"+query, nil, http.StatusOK, &rolledBack)
+	if rolledBack.Algorithm.Graph == nil || rolledBack.Algorithm.Code != created.Code {
+		t.Fatalf("rollback %+v", rolledBack)
+	}
+}
@@ -0,0 +1,218 @@
+// Package e2e runs the API server against the broker simulator, covering login, sync,
+// dedupe, matching, token handling and algorithm evaluation end to end.
+//
+// Tests share the broker transports, which are package globals, so they must not run in parallel.
+package e2e
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go-core/internal/api"
+	"go-core/internal/brokersim"
+	"go-core/internal/data"
+	"go-core/internal/secrets"
+	"go-core/internal/services/syncjobs"
+	"go-core/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	masterKey := make([]byte, secrets.KeySize)
+	rand.Read(masterKey)
+	keyring, err := secrets.NewKeyring(masterKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create keyring:", err)
+		os.Exit(1)
+	}
+	testKeyring = keyring
+
+	os.Exit(m.Run())
+}
+
+// testKeyring encrypts broker credentials in every test database
+var testKeyring *secrets.Keyring
+
+// env is an API server and a broker simulator wired together, with one user
+type env struct {
+	t      *testing.T
+	db     *data.DB
+	api    *httptest.Server
+	sim    *brokersim.Simulator
+	simURL string
+	userID int
+}
+
+// newEnv starts the API server on a fresh database and the simulator serving fixtures
+// configure may adjust the fixtures once the server URLs are known, for example to set redirect URLs.
+func newEnv(t *testing.T, fixtureName string, configure func(e *env, fixtures *brokersim.Fixtures)) *env {
+	t.Helper()
+
+	fixtures, err := brokersim.LoadFixtures(fixtureName)
+	if err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+
+	db := testutil.NewDB(t)
+	db.SetKeyring(testKeyring)
+	jobs := syncjobs.NewRunner(db.GetConnection(), testKeyring)
+	apiServer := httptest.NewServer(api.NewServer(db, jobs).GetRouter())
+
+	e := &env{t: t, db: db, api: apiServer}
+
+	// The simulator is created after configure, but its URL is needed before: serve through a
+	// handler that is filled in once the fixtures are final
+	var handler http.Handler
+	simServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	e.simURL = simServer.URL
+	if configure != nil {
+		configure(e, &fixtures)
+	}
+	e.sim = brokersim.New(fixtures)
+	handler = e.sim
+	brokersim.Use(simServer.URL)
+
+	t.Cleanup(func() {
+		simServer.Close()
+		apiServer.Close()
+		jobs.Stop()
+	})
+
+	var user struct {
+		ID int `json:"id"`
+	}
+	e.mustDo(http.MethodPost, "/api/v1/users", map[string]string{
+		"username": "tester",
+		"email":    "tester@example.com",
+		"password": "password123",
+	}, http.StatusCreated, &user)
+	e.userID = user.ID
+
+	return e
+}
+
+// userPath returns an API path under the test user
+func (e *env) userPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/api/v1/users/%d", e.userID) + fmt.Sprintf(format, args...)
+}
+
+// do calls the API and returns the status and raw body
+func (e *env) do(method, path string, body interface{}) (int, []byte) {
+	e.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatalf("encode request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, e.api.URL+path, reader)
+	if err != nil {
+		e.t.Fatalf("create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatalf("read response: %v", err)
+	}
+	return resp.StatusCode, raw
+}
+
+// mustDo calls the API, checks the status and decodes the data field of a success response into out
+func (e *env) mustDo(method, path string, body interface{}, wantStatus int, out interface{}) {
+	e.t.Helper()
+
+	status, raw := e.do(method, path, body)
+	if status != wantStatus {
+		e.t.Fatalf("%s %s: status %d, want %d: %s", method, path, status, wantStatus, raw)
+	}
+	if out == nil {
+		return
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		e.t.Fatalf("%s %s: decode response: %v: %s", method, path, err, raw)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		e.t.Fatalf("%s %s: decode data: %v: %s", method, path, err, raw)
+	}
+}
+
+// syncResult is the part of a sync response the tests check
+type syncResult struct {
+	Fetched  int      `json:"total_fetched"`
+	Saved    int      `json:"saved_count"`
+	Updated  int      `json:"updated_count"`
+	Skipped  int      `json:"skipped_count"`
+	Recorded int      `json:"recorded_count"`
+	Warnings []string `json:"warnings"`
+	Orders   *struct {
+		Fetched int `json:"total_fetched"`
+		Created int `json:"created_count"`
+		Events  int `json:"events_count"`
+	} `json:"orders"`
+	Snapshot *struct {
+		Positions int `json:"positions_count"`
+		Holdings  int `json:"holdings_count"`
+	} `json:"snapshot"`
+}
+
+// journalTrade is the part of a journal trade the tests check
+type journalTrade struct {
+	ID         string   `json:"id"`
+	Symbol     string   `json:"symbol"`
+	Quantity   int      `json:"quantity"`
+	EntryPrice float64  `json:"entry_price"`
+	ExitPrice  *float64 `json:"exit_price"`
+}
+
+// trades returns the test user's journal trades
+func (e *env) trades() []journalTrade {
+	e.t.Helper()
+
+	var page struct {
+		Trades []journalTrade `json:"trades"`
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/trades/user/%d?limit=100", e.userID), nil, http.StatusOK, &page)
+	return page.Trades
+}
+
+// tokenState returns the credential health state of a broker for the test user
+func (e *env) tokenState(broker data.TradingBroker) string {
+	e.t.Helper()
+
+	var health struct {
+		State string `json:"state"`
+	}
+	e.mustDo(http.MethodGet, e.userPath("/brokers/%s/status", broker), nil, http.StatusOK, &health)
+	return health.State
+}
+
+// noRedirects is a client that returns redirects instead of following them
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
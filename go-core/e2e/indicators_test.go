@@ -0,0 +1,120 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type indicatorBars struct {
+	Indicators []struct {
+		Type string `json:"type"`
+		Key  string `json:"key"`
+	} `json:"indicators"`
+	Bars []struct {
+		Close  float64                `json:"close"`
+		Values map[string]interface{} `json:"values"`
+	} `json:"bars"`
+}
+
+func TestCandleIndicatorsOverStoredBars(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	// Thirty one-minute bars closing 100 to 129, each a rupee either side of its close
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 30)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+
+	// The latest five bars; the bars before them warm the indicators up
+	var latest indicatorBars
+	e.mustDo(http.MethodGet, "/api/v1/candles/indicators?symbol=infy&timeframe=1m&limit=5&indicators=sma:5,rsi:14,vwap,macd", nil, http.StatusOK, &latest)
+	if len(latest.Indicators) != 4 || latest.Indicators[3].Key != "macd_12_26_9" {
+		t.Fatalf("indicators %+v, want four with default keys", latest.Indicators)
+	}
+	if len(latest.Bars) != 5 || latest.Bars[0].Close != 125 {
+		t.Fatalf("got bars %+v, want the five closing 125 to 129", latest.Bars)
+	}
+	last := latest.Bars[4].Values
+	if last["sma_5"] != float64(127) || last["rsi_14"] != float64(100) || last["vwap"] != 114.5 {
+		t.Fatalf("values at the last bar %v, want sma_5 127, rsi_14 100 and vwap 114.5", last)
+	}
+	macd, ok := last["macd_12_26_9"].(map[string]interface{})
+	if !ok || macd["value"] == nil || macd["signal"] != nil {
+		t.Fatalf("macd %v, want a MACD line without a signal yet", last["macd_12_26_9"])
+	}
+
+	// Nothing precedes the first stored bar, so the average needs five bars of the range
+	var first indicatorBars
+	e.mustDo(http.MethodGet, "/api/v1/candles/indicators?symbol=INFY&timeframe=1m&from=2030-01-07&limit=5&indicators=sma:5", nil, http.StatusOK, &first)
+	if len(first.Bars) != 5 || first.Bars[3].Values["sma_5"] != nil || first.Bars[4].Values["sma_5"] != float64(102) {
+		t.Fatalf("got bars %+v, want sma_5 from the fifth bar", first.Bars)
+	}
+}
+
+// indicatorAlgorithm reports the indicators its config declares
+const indicatorAlgorithm = `def algorithm(data, context):
+    indicators = context['indicators']
+    return {'signal': 'HOLD', 'reason': '%s %s' % (indicators['sma_5'], indicators['fast_rsi'])}
+`
+
+// trendAlgorithm buys once its average is available and sells when the average reaches 106
+const trendAlgorithm = `def algorithm(data, context):
+    average = context['indicators']['sma_5']
+    if average == None:
+        return {'signal': 'HOLD'}
+    state = context['state']
+    if not state.get('bought'):
+        state['bought'] = True
+        return {'signal': 'BUY', 'quantity': 10}
+    if average >= 106:
+        return {'signal': 'SELL', 'reason': 'sma %s' % average}
+    return {'signal': 'HOLD'}
+`
+
+func TestAlgorithmsReadDeclaredIndicators(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	config := map[string]interface{}{"indicators": []interface{}{
+		"sma:5",
+		map[string]interface{}{"type": "rsi", "period": 3, "key": "fast_rsi", "history": 2},
+	}}
+	id := createAlgorithm(e, indicatorAlgorithm, config)
+	evaluate := fmt.Sprintf("/api/v1/algorithms/%s/evaluate?user_id=%d", id, e.userID)
+
+	type result struct {
+		Signal struct {
+			Reason string `json:"reason"`
+		} `json:"signal"`
+	}
+	var run result
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(10)}, http.StatusOK, &run)
+	if want := "107 [100, 100]"; run.Signal.Reason != want {
+		t.Fatalf("reason %q, want %q", run.Signal.Reason, want)
+	}
+
+	// Indicators posted with the candles take precedence
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{
+		"candles":    rising(10),
+		"indicators": map[string]interface{}{"sma_5": 42},
+	}, http.StatusOK, &run)
+	if want := "42 [100, 100]"; run.Signal.Reason != want {
+		t.Fatalf("reason %q, want %q", run.Signal.Reason, want)
+	}
+
+	// A backtest computes the indicators over the whole range, not just each run's lookback
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 10)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	trend := createAlgorithm(e, trendAlgorithm, map[string]interface{}{"indicators": []interface{}{"sma:5"}})
+	var backtest backtestResult
+	e.mustDo(http.MethodPost, fmt.Sprintf("/api/v1/algorithms/%s/backtests?user_id=%d", trend, e.userID), map[string]interface{}{
+		"lookback": 1,
+	}, http.StatusCreated, &backtest)
+	if backtest.Status != "completed" || len(backtest.Trades) != 1 {
+		t.Fatalf("backtest %+v, want one completed round trip", backtest)
+	}
+	// Bought on the fifth bar at the sixth's open and sold on the ninth at the tenth's
+	if trade := backtest.Trades[0]; trade.EntryPrice != 104.5 || trade.ExitPrice != 108.5 || trade.ExitReason != "sma 106" {
+		t.Fatalf("trade %+v, want 104.5 to 108.5 on sma 106", trade)
+	}
+}
@@ -0,0 +1,127 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-core/internal/brokersim"
+)
+
+// dhanScripMaster is a slice of Dhan's compact scrip master; the NCDEX row is not supported
+const dhanScripMaster = `SEM_EXM_EXCH_ID,SEM_SEGMENT,SEM_SMST_SECURITY_ID,SEM_INSTRUMENT_NAME,SEM_EXPIRY_CODE,SEM_TRADING_SYMBOL,SEM_LOT_UNITS,SEM_CUSTOM_SYMBOL,SEM_EXPIRY_DATE,SEM_STRIKE_PRICE,SEM_OPTION_TYPE,SEM_TICK_SIZE,SEM_EXPIRY_FLAG,SEM_EXCH_INSTRUMENT_TYPE,SEM_SERIES,SM_SYMBOL_NAME
+NSE,E,1333,EQUITY,,HDFCBANK,1.0,HDFC Bank,,-0.01,XX,5.0000,NA,ES,EQ,HDFC BANK LTD
+NSE,D,35001,FUTIDX,0,NIFTY-Jan2030-FUT,50.0,NIFTY JAN FUT,2030-01-31 14:30:00,-0.01,XX,10.0000,M,FUTIDX,NA,NIFTY
+NSE,D,35002,OPTIDX,0,NIFTY-Jan2030-25000-CE,50.0,NIFTY 31 JAN 25000 CALL,2030-01-31 14:30:00,25000.00000,CE,5.0000,M,OPTIDX,NA,NIFTY
+NCDEX,M,9001,FUTCOM,0,GUARSEED-Jan2030-FUT,5.0,GUARSEED JAN FUT,2030-01-20 17:00:00,-0.01,XX,100.0000,M,FUTCOM,NA,GUARSEED
+`
+
+// kiteInstruments is a slice of Kite's instrument dump
+const kiteInstruments = `instrument_token,exchange_token,tradingsymbol,name,last_price,expiry,strike,tick_size,lot_size,instrument_type,segment,exchange
+341249,1333,HDFCBANK,HDFC BANK,0,,0,0.05,1,EQ,NSE,NSE
+13368066,52219,NIFTY30JANFUT,NIFTY,0,2030-01-31,0,0.1,50,FUT,NFO-FUT,NFO
+13368322,52220,NIFTY30JAN25000CE,NIFTY,0,2030-01-31,25000,0.05,50,CE,NFO-OPT,NFO
+`
+
+// importInstruments uploads an instrument dump and returns the status and raw body
+func importInstruments(e *env, broker, dump string) (int, []byte) {
+	e.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", broker+".csv")
+	io.WriteString(part, dump)
+	form.Close()
+
+	resp, err := http.Post(e.api.URL+"/api/v1/instruments/"+broker+"/import", form.FormDataContentType(), &body)
+	if err != nil {
+		e.t.Fatalf("import %s instruments: %v", broker, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, raw
+}
+
+// withSecurityIDTrades adds Dhan round trips yesterday that identify their instruments only by
+// security ID: HDFCBANK with no custom symbol and a NIFTY option with Dhan's display name
+func withSecurityIDTrades(e *env, fixtures *brokersim.Fixtures) {
+	date := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	legs := []struct {
+		id, side, segment, customSymbol, securityID string
+		quantity                                    int
+		price                                       float64
+		minute                                      int
+	}{
+		{"H1", "BUY", "NSE_EQ", "", "1333", 20, 1600, 0},
+		{"H2", "SELL", "NSE_EQ", "", "1333", 20, 1610, 5},
+		{"N1", "BUY", "NSE_FNO", "NIFTY 31 JAN 25000 CALL", "35002", 50, 120, 10},
+		{"N2", "SELL", "NSE_FNO", "NIFTY 31 JAN 25000 CALL", "35002", 50, 135, 15},
+	}
+	for _, leg := range legs {
+		trade, _ := json.Marshal(map[string]interface{}{
+			"orderId":         "S-" + leg.id,
+			"exchangeOrderId": "E-S-" + leg.id,
+			"exchangeTradeId": "T-S-" + leg.id,
+			"transactionType": leg.side,
+			"exchangeSegment": leg.segment,
+			"productType":     "INTRADAY",
+			"orderType":       "MARKET",
+			"customSymbol":    leg.customSymbol,
+			"securityId":      leg.securityID,
+			"tradedQuantity":  leg.quantity,
+			"tradedPrice":     leg.price,
+			"exchangeTime":    fmt.Sprintf("%s 10:%02d:00", date, leg.minute),
+		})
+		fixtures.Dhan.Trades = append(fixtures.Dhan.Trades, trade)
+	}
+}
+
+func TestDhanSecurityIDsResolveThroughInstrumentMaster(t *testing.T) {
+	e := newEnv(t, "default", withSecurityIDTrades)
+	loginDhan(e)
+
+	// A dump for the wrong broker is rejected and nothing is loaded
+	if status, body := importInstruments(e, "dhan", kiteInstruments); status != http.StatusBadRequest {
+		t.Fatalf("importing Kite's dump as Dhan's: status %d, want 400: %s", status, body)
+	}
+
+	for broker, dump := range map[string]string{"dhan": dhanScripMaster, "zerodha": kiteInstruments} {
+		status, body := importInstruments(e, broker, dump)
+		if status != http.StatusOK {
+			t.Fatalf("import %s instruments: status %d: %s", broker, status, body)
+		}
+	}
+
+	// Dhan's option resolves to the same contract in Kite's dump, which is preferred
+	var resolved struct {
+		TradingSymbol string  `json:"trading_symbol"`
+		LotSize       int     `json:"lot_size"`
+		TickSize      float64 `json:"tick_size"`
+	}
+	e.mustDo(http.MethodGet, "/api/v1/instruments/resolve?broker=dhan&security_id=35002", nil, http.StatusOK, &resolved)
+	if resolved.TradingSymbol != "NIFTY30JAN25000CE" || resolved.LotSize != 50 || resolved.TickSize != 0.05 {
+		t.Fatalf("Dhan security 35002 resolved to %+v", resolved)
+	}
+
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-dhan"), nil, http.StatusOK, nil)
+
+	symbols := make(map[string]int)
+	for _, trade := range e.trades() {
+		symbols[trade.Symbol]++
+	}
+	if symbols["HDFCBANK"] != 1 || symbols["NIFTY30JAN25000CE"] != 1 {
+		t.Fatalf("journal symbols %v, want one HDFCBANK and one NIFTY30JAN25000CE trade", symbols)
+	}
+	if symbols["1333"] != 0 || symbols["NIFTY 31 JAN 25000 CALL"] != 0 {
+		t.Fatalf("trades journaled under broker identifiers: %v", symbols)
+	}
+	// Instruments missing from the master keep the broker's symbol
+	if symbols["INFY"] != 1 || symbols["TCS"] != 1 {
+		t.Fatalf("journal symbols %v, want INFY and TCS unchanged", symbols)
+	}
+}
@@ -0,0 +1,119 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type paperAdvance struct {
+	Bars   int    `json:"bars"`
+	Error  string `json:"error"`
+	Trades []struct {
+		EntryPrice float64 `json:"entry_price"`
+		ExitPrice  float64 `json:"exit_price"`
+		PnL        float64 `json:"pnl"`
+	} `json:"trades"`
+	Account paperAccount `json:"account"`
+}
+
+type paperAccount struct {
+	Cash        float64                `json:"cash"`
+	Equity      float64                `json:"equity"`
+	RealizedPnL float64                `json:"realized_pnl"`
+	Positions   map[string]interface{} `json:"positions"`
+	OpenTrades  map[string]string      `json:"open_trades"`
+	TotalTrades int                    `json:"total_trades"`
+	WinRate     float64                `json:"win_rate"`
+	LastBarAt   string                 `json:"last_bar_at"`
+	Settings    struct {
+		InitialCapital float64 `json:"initial_capital"`
+	} `json:"settings"`
+}
+
+func TestPaperTradingAdvancesOverNewBarsAndJournals(t *testing.T) {
+	e := newEnv(t, "default", nil)
+
+	id := createAlgorithm(e, scriptedAlgorithm, nil)
+	path := fmt.Sprintf("/api/v1/algorithms/%s/paper", id)
+	query := fmt.Sprintf("?user_id=%d", e.userID)
+
+	if status, body := e.do(http.MethodGet, path+query, nil); status != http.StatusNotFound {
+		t.Fatalf("account before the first advance: status %d, want 404: %s", status, body)
+	}
+
+	// The first advance trades only the latest stored bar
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 3)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	var first paperAdvance
+	e.mustDo(http.MethodPost, path+"/advance"+query, nil, http.StatusOK, &first)
+	if first.Bars != 1 || first.Account.Cash != 100000 || first.Account.LastBarAt == "" {
+		t.Fatalf("first advance %+v, want one bar on a default account", first)
+	}
+
+	// Seven more bars: the third run buys at the next open, 104.5, and the sixth sells at 107.5
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 10)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	var second paperAdvance
+	e.mustDo(http.MethodPost, path+"/advance"+query, nil, http.StatusOK, &second)
+	if second.Bars != 7 || second.Error != "" {
+		t.Fatalf("second advance %+v, want seven bars", second)
+	}
+	if len(second.Trades) != 1 || second.Trades[0].EntryPrice != 104.5 || second.Trades[0].ExitPrice != 107.5 || second.Trades[0].PnL != 30 {
+		t.Fatalf("trades %+v, want 10 shares from 104.5 to 107.5", second.Trades)
+	}
+	if second.Account.Cash != 100030 || second.Account.RealizedPnL != 30 || len(second.Account.Positions) != 0 ||
+		len(second.Account.OpenTrades) != 0 || second.Account.TotalTrades != 1 || second.Account.WinRate != 1 {
+		t.Fatalf("account %+v, want 30 realized and nothing open", second.Account)
+	}
+
+	var idle paperAdvance
+	e.mustDo(http.MethodPost, path+"/advance"+query, nil, http.StatusOK, &idle)
+	if idle.Bars != 0 || idle.Account.Cash != 100030 {
+		t.Fatalf("advance without new bars %+v, want nothing processed", idle)
+	}
+
+	// The algorithm carries the state, last signal and performance of every bar
+	var algo struct {
+		State       map[string]interface{} `json:"state"`
+		LastSignal  string                 `json:"last_signal"`
+		TotalTrades int                    `json:"total_trades"`
+		WinRate     float64                `json:"win_rate"`
+		TotalPnL    float64                `json:"total_pnl"`
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s%s", id, query), nil, http.StatusOK, &algo)
+	if algo.State["bar"] != float64(8) || algo.LastSignal != "HOLD" || algo.TotalTrades != 1 || algo.WinRate != 1 || algo.TotalPnL != 30 {
+		t.Fatalf("algorithm %+v, want eight bars, one winning trade and 30 P&L", algo)
+	}
+
+	// The round trip is journaled as a closed trade tagged with the algorithm
+	var page struct {
+		Trades []struct {
+			journalTrade
+			AlgorithmID string `json:"algorithm_id"`
+			Strategy    string `json:"strategy"`
+			Outcome     string `json:"outcome_summary"`
+		} `json:"trades"`
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/trades/user/%d?algorithm_id=%s", e.userID, id), nil, http.StatusOK, &page)
+	if len(page.Trades) != 1 {
+		t.Fatalf("journal trades %+v, want one", page.Trades)
+	}
+	journaled := page.Trades[0]
+	if journaled.AlgorithmID != id || journaled.Quantity != 10 || journaled.EntryPrice != 104.5 || journaled.ExitPrice == nil ||
+		*journaled.ExitPrice != 107.5 || journaled.Outcome != "profitable" || journaled.Strategy != "Crossover" {
+		t.Fatalf("journal trade %+v, want the closed round trip", journaled)
+	}
+
+	var reset paperAccount
+	e.mustDo(http.MethodPut, path+query, map[string]interface{}{"initial_capital": 5000}, http.StatusOK, &reset)
+	if reset.Cash != 5000 || reset.Settings.InitialCapital != 5000 || reset.TotalTrades != 0 || reset.LastBarAt != "" {
+		t.Fatalf("reset account %+v, want a fresh 5000 account", reset)
+	}
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s%s", id, query), nil, http.StatusOK, &algo)
+	if algo.TotalTrades != 0 || algo.TotalPnL != 0 {
+		t.Fatalf("algorithm %+v, want its performance reset", algo)
+	}
+}
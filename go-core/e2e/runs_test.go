@@ -0,0 +1,196 @@
+package e2e
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const loggingAlgorithm = `def algorithm(data, context):
+    state = context['state']
+    state['bar'] = state.get('bar', 0) + 1
+    print('bar', state['bar'])
+    if state['bar'] == 3:
+        fail('boom')
+    if state['bar'] == 2:
+        return {'signal': 'BUY', 'quantity': 5, 'reason': 'second bar'}
+    return {'signal': 'HOLD'}
+`
+
+type algorithmRun struct {
+	ID        string     `json:"id"`
+	Source    string     `json:"source"`
+	Status    string     `json:"status"`
+	Symbol    string     `json:"symbol"`
+	BarAt     *time.Time `json:"bar_at"`
+	Bars      int        `json:"bars"`
+	Signal    string     `json:"signal"`
+	Quantity  int        `json:"quantity"`
+	Reason    string     `json:"reason"`
+	StateDiff *struct {
+		Added   map[string]interface{} `json:"added"`
+		Changed map[string]struct {
+			From interface{} `json:"from"`
+			To   interface{} `json:"to"`
+		} `json:"changed"`
+	} `json:"state_diff"`
+	Logs  []string `json:"logs"`
+	Error string   `json:"error"`
+}
+
+type algorithmRuns struct {
+	Runs       []algorithmRun `json:"runs"`
+	Pagination struct {
+		Total int `json:"total"`
+		Count int `json:"count"`
+	} `json:"pagination"`
+}
+
+func getRuns(e *env, id, filters string) algorithmRuns {
+	e.t.Helper()
+	var got algorithmRuns
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s/runs?user_id=%d%s", id, e.userID, filters), nil, http.StatusOK, &got)
+	return got
+}
+
+func TestAlgorithmRunsRecordEveryEvaluation(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	id := createAlgorithm(e, loggingAlgorithm, nil)
+	evaluate := fmt.Sprintf("/api/v1/algorithms/%s/evaluate?user_id=%d", id, e.userID)
+
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(5)}, http.StatusOK, nil)
+	e.mustDo(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(6)}, http.StatusOK, nil)
+	if status, body := e.do(http.MethodPost, evaluate, map[string]interface{}{"candles": rising(7)}); status != http.StatusUnprocessableEntity {
+		t.Fatalf("third evaluation: status %d, want 422: %s", status, body)
+	}
+
+	all := getRuns(e, id, "")
+	if all.Pagination.Total != 3 || len(all.Runs) != 3 {
+		t.Fatalf("runs %+v, want all three evaluations", all)
+	}
+
+	// Newest first; a failed run keeps its output and error but leaves the state alone
+	failed := all.Runs[0]
+	if failed.Status != "failed" || failed.Source != "evaluate" || !strings.Contains(failed.Error, "boom") ||
+		failed.Signal != "" || failed.StateDiff != nil || len(failed.Logs) != 1 || failed.Logs[0] != "bar 3" {
+		t.Fatalf("failed run %+v", failed)
+	}
+
+	buy := all.Runs[1]
+	if buy.Status != "succeeded" || buy.Signal != "BUY" || buy.Quantity != 5 || buy.Reason != "second bar" ||
+		buy.Symbol != "INFY" || buy.Bars != 6 || buy.BarAt == nil ||
+		!buy.BarAt.Equal(time.Date(2030, 1, 1, 9, 20, 0, 0, time.UTC)) {
+		t.Fatalf("buy run %+v", buy)
+	}
+	if change, ok := buy.StateDiff.Changed["bar"]; !ok || change.From != 1.0 || change.To != 2.0 || len(buy.StateDiff.Added) != 0 {
+		t.Fatalf("buy run state diff %+v, want bar changed from 1 to 2", buy.StateDiff)
+	}
+	if first := all.Runs[2]; first.Signal != "HOLD" || first.StateDiff.Added["bar"] != 1.0 {
+		t.Fatalf("first run %+v, want bar added", first)
+	}
+
+	// Filters and pagination
+	if got := getRuns(e, id, "&status=failed"); got.Pagination.Total != 1 || got.Runs[0].ID != failed.ID {
+		t.Fatalf("failed runs %+v", got)
+	}
+	if got := getRuns(e, id, "&signal=buy&source=evaluate"); got.Pagination.Total != 1 || got.Runs[0].ID != buy.ID {
+		t.Fatalf("buy runs %+v", got)
+	}
+	if got := getRuns(e, id, "&source=paper"); got.Pagination.Total != 0 || len(got.Runs) != 0 {
+		t.Fatalf("paper runs %+v, want none", got)
+	}
+	if got := getRuns(e, id, "&from=2999-01-01"); got.Pagination.Total != 0 {
+		t.Fatalf("future runs %+v, want none", got)
+	}
+	if got := getRuns(e, id, "&limit=1&offset=1"); got.Pagination.Total != 3 || got.Pagination.Count != 1 || got.Runs[0].ID != buy.ID {
+		t.Fatalf("second page %+v", got)
+	}
+
+	var one algorithmRun
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s/runs/%s?user_id=%d", id, buy.ID, e.userID), nil, http.StatusOK, &one)
+	if one.ID != buy.ID || one.Signal != "BUY" || len(one.Logs) != 1 || one.Logs[0] != "bar 2" {
+		t.Fatalf("run %+v", one)
+	}
+
+	// Each paper trading bar is a run too
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 3)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	paper := createAlgorithm(e, scriptedAlgorithm, nil)
+	e.mustDo(http.MethodPost, fmt.Sprintf("/api/v1/algorithms/%s/paper/advance?user_id=%d", paper, e.userID), nil, http.StatusOK, nil)
+	if got := getRuns(e, paper, "&source=paper"); got.Pagination.Total != 1 || got.Runs[0].Signal != "HOLD" || got.Runs[0].Bars != 3 {
+		t.Fatalf("paper runs %+v, want one for the latest bar", got)
+	}
+}
+
+func TestAlgorithmRunStreamTailsNewRuns(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	id := createAlgorithm(e, loggingAlgorithm, nil)
+
+	if status, _ := e.do(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s/runs/stream?user_id=%d", id, e.userID+1), nil); status != http.StatusNotFound {
+		t.Fatalf("another user's stream: status %d, want 404", status)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/algorithms/%s/runs/stream?user_id=%d", e.api.URL, id, e.userID))
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Events are read in the background so a stalled stream fails the test instead of hanging it
+	type event struct{ name, data string }
+	events := make(chan event)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var current event
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				current.name = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				current.data = strings.TrimPrefix(line, "data:")
+			case line == "":
+				events <- current
+				current = event{}
+			}
+		}
+	}()
+	next := func() event {
+		t.Helper()
+		select {
+		case got, ok := <-events:
+			if !ok {
+				t.Fatal("stream closed")
+			}
+			return got
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event within 5s")
+		}
+		return event{}
+	}
+
+	if got := next(); got.name != "ready" {
+		t.Fatalf("first event %+v, want ready", got)
+	}
+
+	e.mustDo(http.MethodPost, fmt.Sprintf("/api/v1/algorithms/%s/evaluate?user_id=%d", id, e.userID),
+		map[string]interface{}{"candles": rising(5)}, http.StatusOK, nil)
+
+	got := next()
+	var run algorithmRun
+	if err := json.Unmarshal([]byte(got.data), &run); got.name != "run" || err != nil {
+		t.Fatalf("event %+v (%v), want a run", got, err)
+	}
+	if run.Signal != "HOLD" || run.Source != "evaluate" || len(run.Logs) != 1 || run.Logs[0] != "bar 1" {
+		t.Fatalf("streamed run %+v", run)
+	}
+}
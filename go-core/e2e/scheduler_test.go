@@ -0,0 +1,138 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-core/internal/services/algoscheduler"
+	"go-core/internal/utils"
+)
+
+type algorithmSchedule struct {
+	Scheduled   bool       `json:"scheduled"`
+	NextCloseAt *time.Time `json:"next_close_at"`
+	LastRun     *struct {
+		BarClose time.Time `json:"bar_close"`
+		Status   string    `json:"status"`
+		Signal   string    `json:"signal"`
+		Bars     int       `json:"bars"`
+		Error    string    `json:"error"`
+	} `json:"last_run"`
+}
+
+// schedule enables an algorithm with status live
+func schedule(e *env, id string) {
+	e.t.Helper()
+	e.mustDo(http.MethodPut, fmt.Sprintf("/api/v1/algorithms/%s?user_id=%d", id, e.userID), map[string]interface{}{
+		"status":  "live",
+		"enabled": true,
+	}, http.StatusOK, nil)
+}
+
+func getSchedule(e *env, id string) algorithmSchedule {
+	e.t.Helper()
+	var got algorithmSchedule
+	e.mustDo(http.MethodGet, fmt.Sprintf("/api/v1/algorithms/%s/schedule?user_id=%d", id, e.userID), nil, http.StatusOK, &got)
+	return got
+}
+
+func TestSchedulerRunsLiveAlgorithmsOncePerBarClose(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	t.Setenv("CANDLES_HOLIDAYS", "2030-01-08")
+
+	// Monday 2030-01-07, 09:15 to 09:24 IST
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 10)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+
+	paper := createAlgorithm(e, scriptedAlgorithm, nil)
+	schedule(e, paper)
+	draft := createAlgorithm(e, scriptedAlgorithm, nil)
+
+	var live struct {
+		ID string `json:"id"`
+	}
+	e.mustDo(http.MethodPost, "/api/v1/algorithms", map[string]interface{}{
+		"user_id":        e.userID,
+		"name":           "Failing",
+		"code":           scriptedAlgorithm,
+		"status":         "live",
+		"symbol":         "INFY",
+		"timeframe":      "5m",
+		"execution_mode": "live_trading",
+		"enabled":        true,
+		"config":         map[string]interface{}{"fail_at": 1},
+	}, http.StatusCreated, &live)
+
+	scheduler := algoscheduler.NewScheduler(e.db.GetConnection())
+	defer scheduler.Stop()
+
+	at := time.Date(2030, 1, 7, 9, 25, 30, 0, utils.IST)
+	if started := scheduler.RunDue(at); started != 2 {
+		t.Fatalf("started %d runs, want the two live algorithms", started)
+	}
+	scheduler.Wait()
+
+	got := getSchedule(e, paper)
+	if !got.Scheduled || got.NextCloseAt == nil || got.LastRun == nil {
+		t.Fatalf("paper schedule %+v, want a run", got)
+	}
+	if !got.LastRun.BarClose.Equal(time.Date(2030, 1, 7, 9, 25, 0, 0, utils.IST)) || got.LastRun.Status != "succeeded" ||
+		got.LastRun.Bars != 1 || got.LastRun.Signal != "HOLD" {
+		t.Fatalf("paper run %+v, want one bar at the 09:25 close", got.LastRun)
+	}
+
+	// One failing algorithm does not stop the others
+	failed := getSchedule(e, live.ID)
+	if failed.LastRun == nil || failed.LastRun.Status != "failed" || failed.LastRun.Error == "" ||
+		!failed.LastRun.BarClose.Equal(time.Date(2030, 1, 7, 9, 25, 0, 0, utils.IST)) {
+		t.Fatalf("live schedule %+v, want a failed run at the 09:25 close", failed)
+	}
+
+	if drafted := getSchedule(e, draft); drafted.Scheduled || drafted.LastRun != nil {
+		t.Fatalf("draft schedule %+v, want it unscheduled", drafted)
+	}
+
+	// The same bar close never runs twice, even after a restart
+	if started := scheduler.RunDue(at.Add(20 * time.Second)); started != 0 {
+		t.Fatalf("started %d runs again for the same bar close", started)
+	}
+	restarted := algoscheduler.NewScheduler(e.db.GetConnection())
+	defer restarted.Stop()
+	if started := restarted.RunDue(at); started != 0 {
+		t.Fatalf("started %d runs again after a restart", started)
+	}
+
+	// 09:26 closes a one-minute bar but not a five-minute one; the 09:25 bar is stored by then
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 11)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	if started := restarted.RunDue(at.Add(time.Minute)); started != 1 {
+		t.Fatalf("started %d runs at 09:26, want the one-minute algorithm", started)
+	}
+	restarted.Wait()
+
+	// Tuesday is a holiday: the rest of Monday's bars are caught up with one run for Monday's
+	// last close, and nothing closes on the holiday itself
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 375)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	holiday := time.Date(2030, 1, 8, 11, 0, 0, 0, utils.IST)
+	if started := restarted.RunDue(holiday); started != 2 {
+		t.Fatalf("started %d runs on the holiday, want a catch-up run each", started)
+	}
+	restarted.Wait()
+	if got := getSchedule(e, paper); !got.LastRun.BarClose.Equal(time.Date(2030, 1, 7, 15, 30, 0, 0, utils.IST)) {
+		t.Fatalf("catch-up run %+v, want Monday's session close", got.LastRun)
+	}
+	if started := restarted.RunDue(holiday.Add(2 * time.Hour)); started != 0 {
+		t.Fatalf("started %d runs later on the holiday", started)
+	}
+
+	// Wednesday is missing from CANDLES_HOLIDAYS, but with no new bar stored nothing runs
+	if started := restarted.RunDue(time.Date(2030, 1, 9, 11, 0, 0, 0, utils.IST)); started != 0 {
+		t.Fatalf("started %d runs on a day without bars", started)
+	}
+}
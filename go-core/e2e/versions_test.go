@@ -0,0 +1,138 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type algorithmVersion struct {
+	Version  int                    `json:"version"`
+	Code     string                 `json:"code"`
+	Config   map[string]interface{} `json:"config"`
+	AuthorID int                    `json:"author_id"`
+	Message  string                 `json:"message"`
+}
+
+func TestAlgorithmVersionHistoryDiffAndRollback(t *testing.T) {
+	e := newEnv(t, "default", nil)
+	id := createAlgorithm(e, scriptedAlgorithm, nil)
+	base := fmt.Sprintf("/api/v1/algorithms/%s", id)
+	query := fmt.Sprintf("?user_id=%d", e.userID)
+
+	versions := func() []algorithmVersion {
+		t.Helper()
+		var got struct {
+			Versions   []algorithmVersion `json:"versions"`
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		}
+		e.mustDo(http.MethodGet, base+"/versions"+query, nil, http.StatusOK, &got)
+		if got.Pagination.Total != len(got.Versions) {
+			t.Fatalf("versions total %d, listed %d", got.Pagination.Total, len(got.Versions))
+		}
+		return got.Versions
+	}
+
+	if got := versions(); len(got) != 1 || got[0].Version != 1 || got[0].Code != scriptedAlgorithm ||
+		got[0].AuthorID != e.userID || got[0].Message != "Created" {
+		t.Fatalf("versions after create %+v, want version 1", got)
+	}
+
+	// Changes to anything but code and config are not versioned
+	e.mustDo(http.MethodPut, base+query, map[string]interface{}{"name": "Renamed"}, http.StatusOK, nil)
+	if got := versions(); len(got) != 1 {
+		t.Fatalf("versions after rename %+v, want still one", got)
+	}
+
+	changed := strings.Replace(scriptedAlgorithm, "'sixth bar'", "'exit'", 1)
+	var updated struct {
+		Version int `json:"version"`
+	}
+	e.mustDo(http.MethodPut, base+query, map[string]interface{}{"code": changed, "version_message": "Shorter reason"}, http.StatusOK, &updated)
+	if updated.Version != 2 {
+		t.Fatalf("version after code change %d, want 2", updated.Version)
+	}
+	e.mustDo(http.MethodPut, base+query, map[string]interface{}{"config": map[string]interface{}{"target": 110}}, http.StatusOK, &updated)
+	if updated.Version != 3 {
+		t.Fatalf("version after config change %d, want 3", updated.Version)
+	}
+
+	got := versions()
+	if len(got) != 3 || got[0].Version != 3 || got[0].Message != "Updated config" || got[1].Message != "Shorter reason" {
+		t.Fatalf("versions %+v, want 3, 2, 1 with their messages", got)
+	}
+
+	var second algorithmVersion
+	e.mustDo(http.MethodGet, base+"/versions/2"+query, nil, http.StatusOK, &second)
+	if second.Code != changed || len(second.Config) != 0 {
+		t.Fatalf("version 2 %+v", second)
+	}
+	if status, _ := e.do(http.MethodGet, base+"/versions/9"+query, nil); status != http.StatusNotFound {
+		t.Fatalf("missing version: status %d, want 404", status)
+	}
+
+	var diff struct {
+		Code         string `json:"code"`
+		LinesAdded   int    `json:"lines_added"`
+		LinesRemoved int    `json:"lines_removed"`
+		Config       struct {
+			Added map[string]interface{} `json:"added"`
+		} `json:"config"`
+	}
+	e.mustDo(http.MethodGet, base+"/versions/diff"+query+"&from=1&to=3", nil, http.StatusOK, &diff)
+	if diff.LinesAdded != 1 || diff.LinesRemoved != 1 || diff.Config.Added["target"] != 110.0 ||
+		!strings.Contains(diff.Code, "-        return {'signal': 'SELL', 'reason': 'sixth bar'}\n") ||
+		!strings.Contains(diff.Code, "+        return {'signal': 'SELL', 'reason': 'exit'}\n") ||
+		!strings.Contains(diff.Code, "@@ -6,5 +6,5 @@\n") {
+		t.Fatalf("diff %+v", diff)
+	}
+
+	// Rolling back stores the old code and config as a new version
+	var rolledBack struct {
+		Algorithm struct {
+			Code    string                 `json:"code"`
+			Config  map[string]interface{} `json:"config"`
+			Version int                    `json:"version"`
+		} `json:"algorithm"`
+		Version *algorithmVersion `json:"version"`
+	}
+	e.mustDo(http.MethodPost, base+"/versions/1/rollback"+query, nil, http.StatusOK, &rolledBack)
+	if rolledBack.Algorithm.Version != 4 || rolledBack.Algorithm.Code != scriptedAlgorithm || len(rolledBack.Algorithm.Config) != 0 ||
+		rolledBack.Version == nil || rolledBack.Version.Version != 4 || rolledBack.Version.Message != "Rolled back to version 1" {
+		t.Fatalf("rollback %+v", rolledBack)
+	}
+	rolledBack.Version = nil
+	e.mustDo(http.MethodPost, base+"/versions/4/rollback"+query, map[string]interface{}{"message": "again"}, http.StatusOK, &rolledBack)
+	if rolledBack.Version != nil || rolledBack.Algorithm.Version != 4 {
+		t.Fatalf("rollback to the current version %+v, want no new version", rolledBack)
+	}
+	if status, _ := e.do(http.MethodPost, base+"/versions/9/rollback"+query, nil); status != http.StatusNotFound {
+		t.Fatalf("rollback to a missing version: status %d, want 404", status)
+	}
+
+	// Runs and backtests record the version they used
+	e.mustDo(http.MethodPost, base+"/evaluate"+query, map[string]interface{}{"candles": rising(5)}, http.StatusOK, nil)
+	var runs struct {
+		Runs []struct {
+			AlgorithmVersion int `json:"algorithm_version"`
+		} `json:"runs"`
+	}
+	e.mustDo(http.MethodGet, base+"/runs"+query, nil, http.StatusOK, &runs)
+	if len(runs.Runs) != 1 || runs.Runs[0].AlgorithmVersion != 4 {
+		t.Fatalf("runs %+v, want one on version 4", runs)
+	}
+
+	if status, body := importCandles(e, "INFY", "1m", minuteBars("2030-01-07", 10)); status != http.StatusOK {
+		t.Fatalf("import candles: status %d: %s", status, body)
+	}
+	var backtest struct {
+		AlgorithmVersion int `json:"algorithm_version"`
+	}
+	e.mustDo(http.MethodPost, base+"/backtests"+query, map[string]interface{}{}, http.StatusCreated, &backtest)
+	if backtest.AlgorithmVersion != 4 {
+		t.Fatalf("backtest on version %d, want 4", backtest.AlgorithmVersion)
+	}
+}
@@ -0,0 +1,205 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go-core/internal/brokersim"
+	"go-core/internal/data"
+)
+
+// withKiteRedirect sends Kite logins back to the API server's callback
+func withKiteRedirect(e *env, fixtures *brokersim.Fixtures) {
+	fixtures.Zerodha.RedirectURL = e.api.URL + "/api/v1/zerodha/callback"
+}
+
+// kiteCallbackURL saves the fixture's app credentials, signs in to Kite and returns the callback
+// URL Kite redirected to, without following it
+func kiteCallbackURL(e *env) string {
+	e.t.Helper()
+
+	fixture := e.sim.Fixtures().Zerodha
+	e.mustDo(http.MethodPost, e.userPath("/zerodha/save-credentials"), map[string]string{
+		"api_key":    fixture.APIKey,
+		"api_secret": fixture.APISecret,
+	}, http.StatusOK, nil)
+
+	var login struct {
+		LoginURL string `json:"login_url"`
+	}
+	e.mustDo(http.MethodGet, e.userPath("/zerodha/login-url"), nil, http.StatusOK, &login)
+
+	// The simulator signs the user in at once and redirects to the callback with the
+	// request_token and the userId and state passed through redirect_params
+	resp, err := noRedirects.Get(login.LoginURL)
+	if err != nil {
+		e.t.Fatalf("open Kite login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		e.t.Fatalf("Kite login: status %d, want a redirect", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// getStatus requests a URL and returns the response status
+func getStatus(t *testing.T, rawURL string) int {
+	t.Helper()
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", rawURL, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// loginZerodha saves the fixture's app credentials and logs in through the Kite redirect
+func loginZerodha(e *env) {
+	e.t.Helper()
+
+	fixture := e.sim.Fixtures().Zerodha
+	if status := getStatus(e.t, kiteCallbackURL(e)); status != http.StatusOK {
+		e.t.Fatalf("Kite callback: status %d", status)
+	}
+
+	var config struct {
+		Configured    bool   `json:"configured"`
+		ZerodhaUserID string `json:"zerodha_user_id"`
+	}
+	e.mustDo(http.MethodGet, e.userPath("/zerodha/config"), nil, http.StatusOK, &config)
+	if !config.Configured || config.ZerodhaUserID != fixture.UserID {
+		e.t.Fatalf("Zerodha not configured after login: %+v", config)
+	}
+}
+
+func TestZerodhaLoginSyncAndOrderTimeline(t *testing.T) {
+	e := newEnv(t, "default", withKiteRedirect)
+	loginZerodha(e)
+
+	var first syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-zerodha"), nil, http.StatusOK, &first)
+	if first.Fetched != 2 || first.Saved != 1 || len(first.Warnings) > 0 {
+		t.Fatalf("first sync: %+v", first)
+	}
+	if first.Orders == nil || first.Orders.Fetched != 2 || first.Orders.Created != 2 {
+		t.Fatalf("order book not recorded: %+v", first.Orders)
+	}
+	if first.Snapshot == nil || first.Snapshot.Holdings != 1 {
+		t.Fatalf("snapshot not refreshed: %+v", first.Snapshot)
+	}
+
+	trades := e.trades()
+	if len(trades) != 1 {
+		t.Fatalf("journal has %d trades, want the SBIN round trip", len(trades))
+	}
+	sbin := trades[0]
+	if sbin.Symbol != "SBIN" || sbin.Quantity != 50 || sbin.EntryPrice != 800 || sbin.ExitPrice == nil || *sbin.ExitPrice != 808 {
+		t.Fatalf("SBIN round trip matched as %+v", sbin)
+	}
+
+	var timeline struct {
+		Orders []struct {
+			OrderID string `json:"order_id"`
+		} `json:"orders"`
+		Modifications int `json:"modifications"`
+	}
+	e.mustDo(http.MethodGet, e.userPath("/trades/%s/orders", sbin.ID), nil, http.StatusOK, &timeline)
+	if len(timeline.Orders) != 2 || timeline.Modifications != 1 {
+		t.Fatalf("timeline has %d orders and %d modifications, want 2 and 1", len(timeline.Orders), timeline.Modifications)
+	}
+
+	// Syncing again fetches the same fills and skips them
+	var second syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-zerodha"), nil, http.StatusOK, &second)
+	if second.Fetched != 2 || second.Skipped != 2 || second.Saved != 0 {
+		t.Fatalf("second sync should only skip fills: %+v", second)
+	}
+	if got := len(e.trades()); got != 1 {
+		t.Fatalf("journal has %d trades after the second sync, want 1", got)
+	}
+}
+
+func TestZerodhaCallbackRejectsWrongState(t *testing.T) {
+	e := newEnv(t, "default", withKiteRedirect)
+	callback, err := url.Parse(kiteCallbackURL(e))
+	if err != nil {
+		t.Fatalf("parse callback URL: %v", err)
+	}
+	withState := func(state string) string {
+		changed := *callback
+		query := changed.Query()
+		if state == "" {
+			query.Del("state")
+		} else {
+			query.Set("state", state)
+		}
+		changed.RawQuery = query.Encode()
+		return changed.String()
+	}
+	if callback.Query().Get("state") == "" {
+		t.Fatalf("callback %s carries no state", callback)
+	}
+
+	for name, rawURL := range map[string]string{"wrong state": withState("forged"), "missing state": withState("")} {
+		if status := getStatus(t, rawURL); status != http.StatusBadRequest {
+			t.Errorf("%s: callback status %d, want 400", name, status)
+		}
+	}
+	var config struct {
+		Configured bool `json:"configured"`
+	}
+	e.mustDo(http.MethodGet, e.userPath("/zerodha/config"), nil, http.StatusOK, &config)
+	if config.Configured {
+		t.Fatalf("Zerodha configured from a callback with a wrong state")
+	}
+	if hits := e.sim.Hits("/kite/session/token"); hits != 0 {
+		t.Fatalf("rejected callbacks exchanged the request_token %d times", hits)
+	}
+
+	// The state Kite echoed back completes the login once
+	if status := getStatus(t, callback.String()); status != http.StatusOK {
+		t.Fatalf("callback with the login state: status %d, want 200", status)
+	}
+	if status := getStatus(t, callback.String()); status != http.StatusBadRequest {
+		t.Errorf("replayed callback: status %d, want 400", status)
+	}
+}
+
+func TestZerodhaRevokedSessionNeedsLogin(t *testing.T) {
+	e := newEnv(t, "default", withKiteRedirect)
+	loginZerodha(e)
+
+	e.sim.Revoke(data.TradingBrokerZerodha)
+
+	status, body := e.do(http.MethodPost, e.userPath("/trades/sync-zerodha"), nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("sync with a revoked session: status %d, want 401: %s", status, body)
+	}
+	if state := e.tokenState(data.TradingBrokerZerodha); state != "revoked" {
+		t.Fatalf("token state %q, want revoked", state)
+	}
+	if hits := e.sim.Hits("/kite/trades"); hits != 1 {
+		t.Fatalf("a rejected token was retried: %d requests", hits)
+	}
+
+	loginZerodha(e)
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-zerodha"), nil, http.StatusOK, nil)
+	if state := e.tokenState(data.TradingBrokerZerodha); state != "valid" {
+		t.Fatalf("token state %q after a new login, want valid", state)
+	}
+}
+
+func TestZerodhaOrderBookFailureIsAWarning(t *testing.T) {
+	e := newEnv(t, "default", withKiteRedirect)
+	loginZerodha(e)
+
+	// A failed order history fails the order book, which must not fail the trade sync
+	e.sim.FailNext("/kite/orders/K-2001", http.StatusBadRequest, 1)
+
+	var result syncResult
+	e.mustDo(http.MethodPost, e.userPath("/trades/sync-zerodha"), nil, http.StatusOK, &result)
+	if result.Saved != 1 || len(result.Warnings) != 1 {
+		t.Fatalf("sync with a failed order book: %+v", result)
+	}
+}
@@ -1,7 +1,10 @@
 package dto
 
 import (
+	"time"
+
 	"go-core/internal/data"
+	"go-core/internal/services/algograph"
 )
 
 // CreateAlgorithmRequest represents the request to create a new algorithm
@@ -9,7 +12,8 @@ type CreateAlgorithmRequest struct {
 	UserID      int                    `json:"user_id" validate:"required"`
 	Name        string                 `json:"name" validate:"required,min=1,max=100"`
 	Description *string                `json:"description,omitempty" validate:"omitempty,max=500"`
-	Code        string                 `json:"code" validate:"required,min=1"`
+	Code        string                 `json:"code" validate:"required_without=Graph"`
+	Graph       *data.AlgorithmGraph   `json:"graph,omitempty"` // canvas graph to compile into the code, instead of code
 	Status      data.AlgorithmStatus   `json:"status" validate:"required,oneof=draft live paused archived"`
 	Symbol      string                 `json:"symbol" validate:"required,min=1"`
 	Timeframe   data.Timeframe         `json:"timeframe" validate:"required,oneof=1m 5m 15m 30m 1h 4h 1d 1w"`
@@ -18,6 +22,7 @@ type CreateAlgorithmRequest struct {
 	Enabled     bool                  `json:"enabled"`
 	Config      map[string]interface{} `json:"config,omitempty"`
 	Tags        []string              `json:"tags,omitempty"`
+	VersionMessage *string            `json:"version_message,omitempty" validate:"omitempty,max=500"` // describes the first version
 }
 
 // UpdateAlgorithmRequest represents the request to update an algorithm
@@ -25,6 +30,7 @@ type UpdateAlgorithmRequest struct {
 	Name        *string                `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
 	Description *string                `json:"description,omitempty" validate:"omitempty,max=500"`
 	Code        *string                `json:"code,omitempty" validate:"omitempty,min=1"`
+	Graph       *data.AlgorithmGraph   `json:"graph,omitempty"` // recompiles the code; new code without a graph drops the graph
 	Status      *data.AlgorithmStatus  `json:"status,omitempty" validate:"omitempty,oneof=draft live paused archived"`
 	Symbol      *string                `json:"symbol,omitempty" validate:"omitempty,min=1"`
 	Timeframe   *data.Timeframe        `json:"timeframe,omitempty" validate:"omitempty,oneof=1m 5m 15m 30m 1h 4h 1d 1w"`
@@ -33,6 +39,7 @@ type UpdateAlgorithmRequest struct {
 	Enabled     *bool                  `json:"enabled,omitempty"`
 	Config      map[string]interface{} `json:"config,omitempty"`
 	Tags        []string               `json:"tags,omitempty"`
+	VersionMessage *string             `json:"version_message,omitempty" validate:"omitempty,max=500"` // describes the version a code or config change creates
 }
 
 // AlgorithmResponse represents the response for algorithm operations
@@ -42,6 +49,7 @@ type AlgorithmResponse struct {
 	Name         string                 `json:"name"`
 	Description  *string                `json:"description,omitempty"`
 	Code         string                 `json:"code"`
+	Graph        *data.AlgorithmGraph   `json:"graph,omitempty"`
 	Status       data.AlgorithmStatus  `json:"status"`
 	Symbol       string                 `json:"symbol"`
 	Timeframe    data.Timeframe         `json:"timeframe"`
@@ -67,3 +75,52 @@ type GetAlgorithmsResponse struct {
 	Pagination PaginationResponse  `json:"pagination"`
 }
 
+// AlgorithmScheduleResponse describes when the scheduler runs an algorithm
+type AlgorithmScheduleResponse struct {
+	Scheduled   bool                    `json:"scheduled"`               // enabled with status live
+	NextCloseAt *time.Time              `json:"next_close_at,omitempty"` // the next bar close it runs at, when scheduled
+	LastRun     *data.AlgorithmSchedule `json:"last_run,omitempty"`
+}
+
+// AlgorithmRunsResponse is a page of an algorithm's run log
+type AlgorithmRunsResponse struct {
+	Runs       []*data.AlgorithmRun `json:"runs"`
+	Pagination PaginationResponse   `json:"pagination"`
+}
+
+// RollbackAlgorithmRequest is the optional body of a rollback
+type RollbackAlgorithmRequest struct {
+	Message *string `json:"message,omitempty" validate:"omitempty,max=500"` // defaults to "Rolled back to version N"
+}
+
+// AlgorithmVersionsResponse is a page of an algorithm's version history
+type AlgorithmVersionsResponse struct {
+	Versions   []*data.AlgorithmVersion `json:"versions"`
+	Pagination PaginationResponse       `json:"pagination"`
+}
+
+// RollbackAlgorithmResponse is an algorithm after a rollback and the version it created
+type RollbackAlgorithmResponse struct {
+	Algorithm AlgorithmResponse      `json:"algorithm"`
+	Version   *data.AlgorithmVersion `json:"version,omitempty"` // nil when the algorithm already had that code and config
+}
+
+// ValidateAlgorithmRequest is code to check and dry-run without saving it
+type ValidateAlgorithmRequest struct {
+	Code   string                 `json:"code" validate:"required,min=1"`
+	Config map[string]interface{} `json:"config,omitempty"`
+	Symbol string                 `json:"symbol,omitempty"`                                  // of the synthetic bars, default SYNTHETIC
+	Bars   int                    `json:"bars,omitempty" validate:"omitempty,min=1,max=200"` // synthetic bars to dry-run over, default 50
+}
+
+// CompileGraphRequest is a canvas graph to check and compile without saving it
+type CompileGraphRequest struct {
+	Graph *data.AlgorithmGraph `json:"graph" validate:"required"`
+}
+
+// CompileGraphResponse is the code a canvas graph compiles to, or why it does not
+type CompileGraphResponse struct {
+	Valid  bool              `json:"valid"`
+	Issues []algograph.Issue `json:"issues"`
+	Code   string            `json:"code,omitempty"`
+}
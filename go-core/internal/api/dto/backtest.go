@@ -0,0 +1,14 @@
+package dto
+
+import (
+	"go-core/internal/data"
+)
+
+// RunBacktestRequest represents the request to backtest an algorithm
+// Omitted settings take their defaults: 100000 capital, no slippage or charges, signal sizing
+// with a fallback of one share, fills at the next bar's open and a 500-bar lookback.
+type RunBacktestRequest struct {
+	From string `json:"from,omitempty"` // RFC 3339 or YYYY-MM-DD in IST, default: the first stored bar
+	To   string `json:"to,omitempty"`   // exclusive, default: after the last stored bar
+	data.SimulationSettings
+}
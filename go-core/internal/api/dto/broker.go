@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+)
+
+// BrokerAuthCompleteRequest carries the parameters a broker redirected back with after login
+// e.g. {"tokenId": "..."} for Dhan or {"request_token": "..."} for Zerodha
+type BrokerAuthCompleteRequest struct {
+	Params map[string]string `json:"params" validate:"required,min=1"`
+}
+
+// BrokerAuthStartResponse represents the first step of a broker login
+type BrokerAuthStartResponse struct {
+	Broker   string `json:"broker"`
+	LoginURL string `json:"login_url"`
+}
+
+// BrokerTokenResponse represents a broker's token state after login or refresh
+type BrokerTokenResponse struct {
+	Broker     string     `json:"broker"`
+	ExpiryTime *time.Time `json:"expiry_time,omitempty"`
+}
+
+// BrokerSyncScheduleRequest represents a user's background sync schedule for a broker
+type BrokerSyncScheduleRequest struct {
+	RunAt    string `json:"run_at" validate:"required"` // HH:MM in IST, e.g. 15:45 after market close
+	Weekdays []int  `json:"weekdays,omitempty"`         // Sunday = 0 (default: Monday to Friday)
+	Method   string `json:"method,omitempty"`           // fifo, lifo or average (default: fifo)
+	Enabled  *bool  `json:"enabled,omitempty"`          // default: true
+}
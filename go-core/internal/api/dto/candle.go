@@ -0,0 +1,24 @@
+package dto
+
+import (
+	"time"
+
+	"go-core/internal/services/indicators"
+)
+
+// CandleIndicatorsResponse represents indicators computed over a range of bars
+type CandleIndicatorsResponse struct {
+	Symbol     string               `json:"symbol"`
+	Timeframe  string               `json:"timeframe"`
+	Indicators []indicators.Spec    `json:"indicators"` // with their defaults and keys filled in
+	Bars       []CandleIndicatorBar `json:"bars"`
+}
+
+// CandleIndicatorBar represents the indicator values at one bar
+// Values are keyed by indicator key: a number for a single output, an object keyed by output
+// otherwise, and null before an indicator has enough history.
+type CandleIndicatorBar struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Close     float64                `json:"close"`
+	Values    map[string]interface{} `json:"values"`
+}
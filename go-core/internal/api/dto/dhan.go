@@ -9,7 +9,7 @@ type DhanRenewTokenRequest struct {
 // DhanRenewTokenResponse represents the response for renewing token
 type DhanRenewTokenResponse struct {
 	Status      string `json:"status"`
-	AccessToken string `json:"access_token"`
+	AccessToken string `json:"access_token"` // Redacted to the last four characters
 	ExpiryTime  string `json:"expiry_time"`
 }
 
@@ -38,17 +38,19 @@ type DhanConsumeConsentResponse struct {
 	DhanClientName       string `json:"dhan_client_name"`
 	DhanClientUcc        string `json:"dhan_client_ucc"`
 	GivenPowerOfAttorney bool   `json:"given_power_of_attorney"`
-	AccessToken          string `json:"access_token"`
+	AccessToken          string `json:"access_token"` // Redacted to the last four characters
 	ExpiryTime           string `json:"expiry_time"`
 }
 
 // DhanBrokerConfigResponse represents the broker configuration for a user
 type DhanBrokerConfigResponse struct {
-	Configured     bool   `json:"configured"`
-	HasCredentials bool   `json:"has_credentials"` // Whether API key/secret are configured
-	DhanClientID   string `json:"dhan_client_id,omitempty"`
-	DhanClientName string `json:"dhan_client_name,omitempty"`
-	ExpiryTime     string `json:"expiry_time,omitempty"`
+	Configured         bool   `json:"configured"`
+	HasCredentials     bool   `json:"has_credentials"` // Whether API key/secret are configured
+	DhanClientID       string `json:"dhan_client_id,omitempty"`
+	DhanClientName     string `json:"dhan_client_name,omitempty"`
+	ExpiryTime         string `json:"expiry_time,omitempty"`
+	TokenStatus        string `json:"token_status"` // not_configured, valid, expiring, expired or revoked
+	TokenStatusMessage string `json:"token_status_message"`
 }
 
 // DhanSaveTokenRequest represents the request to save access token directly
@@ -16,6 +16,7 @@ type CreateTradeRequest struct {
 	Quantity       int                      `json:"quantity" validate:"required,gt=0"`
 	TotalAmount    float64                  `json:"total_amount" validate:"required,gt=0"`
 	ExitPrice      *float64                 `json:"exit_price,omitempty"`
+	ExitDate       *string                  `json:"exit_date,omitempty"` // YYYY-MM-DD
 	Direction      data.TradeDirection      `json:"direction" validate:"required"`
 	StopLoss       *float64                 `json:"stop_loss,omitempty"`
 	Target         *float64                 `json:"target,omitempty"`
@@ -45,6 +46,7 @@ type UpdateTradeRequest struct {
 	Quantity       int                      `json:"quantity" validate:"required,gt=0"`
 	TotalAmount    float64                  `json:"total_amount" validate:"required,gt=0"`
 	ExitPrice      *float64                 `json:"exit_price,omitempty"`
+	ExitDate       *string                  `json:"exit_date,omitempty"` // YYYY-MM-DD
 	Direction      data.TradeDirection      `json:"direction" validate:"required"`
 	StopLoss       *float64                 `json:"stop_loss,omitempty"`
 	Target         *float64                 `json:"target,omitempty"`
@@ -92,6 +94,7 @@ type TradeResponse struct {
 	Quantity       int                 `json:"quantity"`
 	TotalAmount    float64             `json:"total_amount"`
 	ExitPrice      *float64            `json:"exit_price,omitempty"`
+	ExitDate       *time.Time          `json:"exit_date,omitempty"`
 	Direction      data.TradeDirection `json:"direction"`
 	StopLoss       *float64            `json:"stop_loss,omitempty"`
 	Target         *float64            `json:"target,omitempty"`
@@ -108,6 +111,7 @@ type TradeResponse struct {
 	OrderID         *string             `json:"order_id,omitempty"`
 	ProductType     *data.ProductType   `json:"product_type,omitempty"`
 	TransactionType *string             `json:"transaction_type,omitempty"` // buy | sell
+	AlgorithmID     *string             `json:"algorithm_id,omitempty"`     // set on trades made by paper trading
 	CreatedAt       time.Time           `json:"created_at"`
 	UpdatedAt       time.Time           `json:"updated_at"`
 }
@@ -0,0 +1,36 @@
+package dto
+
+// ZerodhaSaveCredentialsRequest represents the request to save Kite Connect API key and secret
+type ZerodhaSaveCredentialsRequest struct {
+	APIKey    string `json:"api_key" validate:"required"`
+	APISecret string `json:"api_secret" validate:"required"`
+}
+
+// ZerodhaLoginURLResponse represents the response for starting a Kite Connect login
+type ZerodhaLoginURLResponse struct {
+	LoginURL    string `json:"login_url"`
+	CallbackURL string `json:"callback_url"` // Redirect URL to register on the Kite Connect app
+}
+
+// ZerodhaCreateSessionRequest represents the request to exchange a request_token for a session
+type ZerodhaCreateSessionRequest struct {
+	RequestToken string `json:"request_token" validate:"required"`
+}
+
+// ZerodhaSessionResponse represents the response for creating a Kite Connect session
+type ZerodhaSessionResponse struct {
+	ZerodhaUserID   string `json:"zerodha_user_id"`
+	ZerodhaUserName string `json:"zerodha_user_name"`
+	ExpiryTime      string `json:"expiry_time"`
+}
+
+// ZerodhaBrokerConfigResponse represents the Zerodha broker configuration for a user
+type ZerodhaBrokerConfigResponse struct {
+	Configured         bool   `json:"configured"`
+	HasCredentials     bool   `json:"has_credentials"` // Whether API key/secret are configured
+	ZerodhaUserID      string `json:"zerodha_user_id,omitempty"`
+	ZerodhaUserName    string `json:"zerodha_user_name,omitempty"`
+	ExpiryTime         string `json:"expiry_time,omitempty"`
+	TokenStatus        string `json:"token_status"` // not_configured, valid, expiring, expired or revoked
+	TokenStatusMessage string `json:"token_status_message"`
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,6 +9,11 @@ import (
 	"go-core/internal/api/dto"
 	"go-core/internal/data"
 	"go-core/internal/data/repos"
+	"go-core/internal/services/algograph"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/algoversions"
+	"go-core/internal/services/candles"
+	"go-core/internal/services/indicators"
 	"go-core/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -40,6 +46,36 @@ func CreateAlgorithm(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
+		// A visual algorithm's code is compiled from its graph
+		if req.Graph != nil {
+			if req.Code != "" {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Validation Error",
+					Message: "Send either code or a graph, not both",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			code, err := algograph.Compile(req.Graph)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Validation Error",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			req.Code = code
+		}
+		if _, err := indicators.ParseSpecs(req.Config); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
 		// Create algorithm
 		algo := &data.Algorithm{
 			ID:            utils.GenerateID(),
@@ -47,6 +83,7 @@ func CreateAlgorithm(db *data.DB) gin.HandlerFunc {
 			Name:          req.Name,
 			Description:   req.Description,
 			Code:          req.Code,
+			Graph:         req.Graph,
 			Status:        req.Status,
 			Symbol:        req.Symbol,
 			Timeframe:     req.Timeframe,
@@ -71,8 +108,11 @@ func CreateAlgorithm(db *data.DB) gin.HandlerFunc {
 			algo.Tags = []string{}
 		}
 
-		repo := repos.NewAlgorithmRepository(db.GetConnection())
-		if err := repo.CreateAlgorithm(algo); err != nil {
+		var message string
+		if req.VersionMessage != nil {
+			message = *req.VersionMessage
+		}
+		if _, err := algoversions.NewService(db.GetConnection()).Create(algo, req.UserID, message); err != nil {
 			utils.LogError(err, "Failed to create algorithm")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 				Error:   "Database Error",
@@ -278,9 +318,31 @@ func UpdateAlgorithm(db *data.DB) gin.HandlerFunc {
 		if req.Description != nil {
 			existing.Description = req.Description
 		}
+		if req.Code != nil && req.Graph != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: "Send either code or a graph, not both",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
 		if req.Code != nil {
+			// Hand-written code replaces the graph it was compiled from
 			existing.Code = *req.Code
-			existing.Version++ // Increment version on code change
+			existing.Graph = nil
+		}
+		if req.Graph != nil {
+			code, err := algograph.Compile(req.Graph)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Validation Error",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			existing.Code = code
+			existing.Graph = req.Graph
 		}
 		if req.Status != nil {
 			existing.Status = *req.Status
@@ -301,6 +363,14 @@ func UpdateAlgorithm(db *data.DB) gin.HandlerFunc {
 			existing.Enabled = *req.Enabled
 		}
 		if req.Config != nil {
+			if _, err := indicators.ParseSpecs(req.Config); err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Validation Error",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
 			existing.Config = req.Config
 		}
 		if req.Tags != nil {
@@ -309,7 +379,12 @@ func UpdateAlgorithm(db *data.DB) gin.HandlerFunc {
 
 		existing.UpdatedAt = time.Now()
 
-		if err := repo.UpdateAlgorithm(existing); err != nil {
+		// A code or config change stores a new version
+		var message string
+		if req.VersionMessage != nil {
+			message = *req.VersionMessage
+		}
+		if _, err := algoversions.NewService(db.GetConnection()).Update(existing, userID, message); err != nil {
 			utils.LogError(err, "Failed to update algorithm")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 				Error:   "Database Error",
@@ -378,6 +453,243 @@ func DeleteAlgorithm(db *data.DB) gin.HandlerFunc {
 	}
 }
 
+// EvaluateAlgorithm runs an algorithm's code once against the candles in the request
+// @Summary Evaluate algorithm
+// @Description Calls the algorithm's algorithm(data, context) function once in the sandboxed runtime with the posted candles, portfolio and indicators and the algorithm's config and persisted state, and validates the returned signal. Without posted candles, the latest 500 stored bars of the algorithm's symbol and timeframe are used. On success the algorithm's last_run_at, last_signal and state are updated. Every run, failed or not, is added to the algorithm's run log. Runs are limited by ALGORITHM_TIMEOUT, ALGORITHM_MAX_STEPS, ALGORITHM_MAX_ALLOC_MB and ALGORITHM_MAX_HEAP_MB.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param request body algoruntime.Input true "Candles (oldest first, default: from the candle store), portfolio and indicators; symbol defaults to the algorithm's"
+// @Success 200 {object} dto.SuccessResponse{data=algoruntime.Result} "Signal, new state, print output and resource use"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Failure 422 {object} dto.ErrorResponse "The code failed to compile or run, hit a limit, or returned an invalid signal"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/evaluate [post]
+func EvaluateAlgorithm(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var input algoruntime.Input
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		repo := repos.NewAlgorithmRepository(db.GetConnection())
+		algo, err := repo.GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		result, err := algoruntime.NewService(db.GetConnection()).Evaluate(c.Request.Context(), algo, data.AlgorithmRunSourceEvaluate, input)
+		if err != nil {
+			var codeErr *algoruntime.Error
+			if errors.As(err, &codeErr) {
+				c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+					Error:   "Algorithm Error",
+					Message: codeErr.Error(),
+					Code:    http.StatusUnprocessableEntity,
+				})
+				return
+			}
+			utils.LogError(err, "Failed to evaluate algorithm", map[string]interface{}{
+				"algorithm_id": algo.ID,
+			})
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to evaluate algorithm",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm evaluated successfully",
+			Data:    result,
+		})
+	}
+}
+
+// ValidateAlgorithm checks algorithm code and dry-runs it without saving anything
+// @Summary Validate algorithm code
+// @Description Compiles the code, checks that it defines algorithm(data, context) and returns a signal, and flags constructs that fail or misbehave when run (load statements, extra required parameters, top-level code). Code that passes is dry-run over synthetic one-minute candles, once per bar with the bars up to it, the posted config and state carried from bar to bar, under the usual run limits. Returns diagnostics with line numbers, the signal of every bar, the final state and the print() output. Invalid code still gets a 200 with valid set to false.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param request body dto.ValidateAlgorithmRequest true "Code to validate"
+// @Success 200 {object} dto.SuccessResponse{data=algoruntime.Validation} "Diagnostics and sample signals"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request"
+// @Router /api/v1/algorithms/validate [post]
+func ValidateAlgorithm() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.ValidateAlgorithmRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		if req.Config == nil {
+			req.Config = make(map[string]interface{})
+		}
+		if req.Symbol == "" {
+			req.Symbol = "SYNTHETIC"
+		}
+		if req.Bars == 0 {
+			req.Bars = algoruntime.DefaultDryRunBars
+		}
+
+		validation := algoruntime.Validate(c.Request.Context(), req.Code, req.Config, req.Symbol, req.Bars, algoruntime.DefaultLimits())
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm validated",
+			Data:    validation,
+		})
+	}
+}
+
+// CompileAlgorithmGraph checks a canvas graph and compiles it without saving anything
+// @Summary Compile algorithm graph
+// @Description Checks a canvas node graph for unknown nodes and settings, wires between mismatched ports, unconnected required inputs and cycles, and compiles it into the algorithm code saving it would store. Nodes are marketData (outputs close, open, high, low, volume), indicator (SMA, EMA, RSI or MACD of its source input), condition (>, <, >=, <=, ==, !=, crosses_above or crosses_below of inputs a and b or a constant value; and, or, not of booleans), codeBlock (a function body given bars, context and inputs a, b, c), riskManagement (quantity, stop_loss_pct, target_pct) and one broker, whose buy and sell inputs decide the signal. An invalid graph still gets a 200 with valid set to false and its issues.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param request body dto.CompileGraphRequest true "Graph to compile"
+// @Success 200 {object} dto.SuccessResponse{data=dto.CompileGraphResponse} "Issues and compiled code"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request"
+// @Router /api/v1/algorithms/graph/compile [post]
+func CompileAlgorithmGraph() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.CompileGraphRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		response := dto.CompileGraphResponse{Issues: []algograph.Issue{}}
+		code, err := algograph.Compile(req.Graph)
+		var invalid *algograph.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			response.Issues = invalid.Issues
+		case err != nil:
+			response.Issues = append(response.Issues, algograph.Issue{Message: err.Error()})
+		default:
+			response.Valid = true
+			response.Code = code
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm graph compiled",
+			Data:    response,
+		})
+	}
+}
+
+// GetAlgorithmSchedule returns when the scheduler runs an algorithm and how its last run went
+// @Summary Get algorithm schedule
+// @Description Enabled algorithms with status live run once per bar close of their timeframe, following the session hours (CANDLES_SESSION_OPEN, CANDLES_SESSION_CLOSE) and holidays (CANDLES_HOLIDAYS): paper trading algorithms advance their paper accounts and live trading ones are evaluated against the latest stored bars. Returns whether the algorithm is scheduled, the next bar close it runs at and the bar close, status, signal, error and duration of its latest scheduled run.
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlgorithmScheduleResponse} "Schedule"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/schedule [get]
+func GetAlgorithmSchedule(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		lastRun, err := repos.NewAlgorithmScheduleRepository(db.GetConnection()).GetSchedule(algo.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Database Error",
+				Message: "Failed to retrieve algorithm schedule",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		response := dto.AlgorithmScheduleResponse{
+			Scheduled: algo.Enabled && algo.Status == data.AlgorithmStatusLive,
+			LastRun:   lastRun,
+		}
+		if response.Scheduled {
+			if next, ok := candles.NextClose(algo.Timeframe, time.Now()); ok {
+				response.NextCloseAt = &next
+			}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm schedule retrieved successfully",
+			Data:    response,
+		})
+	}
+}
+
 // convertAlgorithmToResponse converts a data.Algorithm to dto.AlgorithmResponse
 func convertAlgorithmToResponse(algo *data.Algorithm) dto.AlgorithmResponse {
 	response := dto.AlgorithmResponse{
@@ -386,6 +698,7 @@ func convertAlgorithmToResponse(algo *data.Algorithm) dto.AlgorithmResponse {
 		Name:          algo.Name,
 		Description:   algo.Description,
 		Code:          algo.Code,
+		Graph:         algo.Graph,
 		Status:        algo.Status,
 		Symbol:        algo.Symbol,
 		Timeframe:     algo.Timeframe,
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runStreamHeartbeat is how often an idle run stream sends a heartbeat, keeping proxies from
+// closing it
+const runStreamHeartbeat = 15 * time.Second
+
+// GetAlgorithmRuns lists an algorithm's run log
+// @Summary List algorithm runs
+// @Description Returns an algorithm's runs newest first: every evaluation, scheduled run and paper trading bar, with the time of the latest input bar, the returned signal, quantity, price, stop loss, target and reason, how the run changed the algorithm's state, its print() output, steps, duration and error
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param source query string false "Run source" Enums(evaluate, scheduled, paper)
+// @Param status query string false "Run status" Enums(succeeded, failed)
+// @Param signal query string false "Returned signal" Enums(BUY, SELL, HOLD)
+// @Param from query string false "Runs at or after this time (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param to query string false "Runs before this time (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param limit query int false "Maximum runs (default 20, max 100)"
+// @Param offset query int false "Runs to skip"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlgorithmRunsResponse} "Runs"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID or filter"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/runs [get]
+func GetAlgorithmRuns(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		filter, err := parseAlgorithmRunFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		repo := repos.NewAlgorithmRunRepository(db.GetConnection())
+		runs, err := repo.GetRuns(c.Param("id"), userID, filter, limit, offset)
+		if err == nil {
+			var total int
+			total, err = repo.CountRuns(c.Param("id"), userID, filter)
+			if err == nil {
+				c.JSON(http.StatusOK, dto.SuccessResponse{
+					Message: "Algorithm runs retrieved successfully",
+					Data: dto.AlgorithmRunsResponse{
+						Runs: runs,
+						Pagination: dto.PaginationResponse{
+							Total:  total,
+							Limit:  limit,
+							Offset: offset,
+							Count:  len(runs),
+						},
+					},
+				})
+				return
+			}
+		}
+
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Database Error",
+			Message: "Failed to retrieve algorithm runs",
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// GetAlgorithmRun returns one entry of an algorithm's run log
+// @Summary Get algorithm run
+// @Description Returns one run of an algorithm with its signal, state diff, print() output and error
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param run_id path string true "Run ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=data.AlgorithmRun} "Run"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "Run not found"
+// @Router /api/v1/algorithms/{id}/runs/{run_id} [get]
+func GetAlgorithmRun(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		run, err := repos.NewAlgorithmRunRepository(db.GetConnection()).GetRunByID(c.Param("run_id"), c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm run not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm run retrieved successfully",
+			Data:    run,
+		})
+	}
+}
+
+// StreamAlgorithmRuns tails an algorithm's run log as server-sent events
+// @Summary Stream algorithm runs
+// @Description Streams an algorithm's runs as server-sent events as they are recorded, for live tailing in the editor. The stream opens with a ready event, sends each run as a run event with the same fields as the run log, and sends a heartbeat event every 15 seconds while idle. Runs recorded while the client is too slow to read them are skipped; the run log has them all.
+// @Tags algorithms
+// @Produce text/event-stream
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} data.AlgorithmRun "Stream of run events"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Router /api/v1/algorithms/{id}/runs/stream [get]
+func StreamAlgorithmRuns(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		runs, cancel := algoruntime.Subscribe(algo.ID)
+		defer cancel()
+		heartbeat := time.NewTicker(runStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.SSEvent("ready", gin.H{"algorithm_id": algo.ID})
+		c.Writer.Flush()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case run := <-runs:
+				c.SSEvent("run", run)
+			case at := <-heartbeat.C:
+				c.SSEvent("heartbeat", gin.H{"at": at.UTC()})
+			}
+			return true
+		})
+	}
+}
+
+// parseAlgorithmRunFilter reads the run log filters from the query string
+func parseAlgorithmRunFilter(c *gin.Context) (repos.AlgorithmRunFilter, error) {
+	var filter repos.AlgorithmRunFilter
+
+	if value := c.Query("source"); value != "" {
+		source := data.AlgorithmRunSource(value)
+		switch source {
+		case data.AlgorithmRunSourceEvaluate, data.AlgorithmRunSourceScheduled, data.AlgorithmRunSourcePaper:
+		default:
+			return filter, fmt.Errorf("invalid source %q: must be evaluate, scheduled or paper", value)
+		}
+		filter.Source = &source
+	}
+	if value := c.Query("status"); value != "" {
+		status := data.AlgorithmRunStatus(value)
+		switch status {
+		case data.AlgorithmRunStatusSucceeded, data.AlgorithmRunStatusFailed:
+		default:
+			return filter, fmt.Errorf("invalid status %q: must be succeeded or failed", value)
+		}
+		filter.Status = &status
+	}
+	if value := c.Query("signal"); value != "" {
+		signal := strings.ToUpper(value)
+		switch signal {
+		case algoruntime.SignalBuy, algoruntime.SignalSell, algoruntime.SignalHold:
+		default:
+			return filter, fmt.Errorf("invalid signal %q: must be BUY, SELL or HOLD", value)
+		}
+		filter.Signal = &signal
+	}
+
+	from, err := parseCandleTime(c.Query("from"))
+	if err != nil {
+		return filter, err
+	}
+	if !from.IsZero() {
+		filter.From = &from
+	}
+	to, err := parseCandleTime(c.Query("to"))
+	if err != nil {
+		return filter, err
+	}
+	if !to.IsZero() {
+		filter.To = &to
+	}
+
+	return filter, nil
+}
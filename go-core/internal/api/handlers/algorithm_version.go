@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoversions"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAlgorithmVersions lists an algorithm's version history
+// @Summary List algorithm versions
+// @Description Returns an algorithm's versions newest first. A version is stored when the algorithm is created and whenever its code or config changes, with the code, config, author, message and time.
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param limit query int false "Maximum versions (default 20, max 100)"
+// @Param offset query int false "Versions to skip"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlgorithmVersionsResponse} "Versions"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/versions [get]
+func GetAlgorithmVersions(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		repo := repos.NewAlgorithmVersionRepository(db.GetConnection())
+		versions, err := repo.GetVersions(c.Param("id"), userID, limit, offset)
+		if err == nil {
+			var total int
+			total, err = repo.CountVersions(c.Param("id"), userID)
+			if err == nil {
+				c.JSON(http.StatusOK, dto.SuccessResponse{
+					Message: "Algorithm versions retrieved successfully",
+					Data: dto.AlgorithmVersionsResponse{
+						Versions: versions,
+						Pagination: dto.PaginationResponse{
+							Total:  total,
+							Limit:  limit,
+							Offset: offset,
+							Count:  len(versions),
+						},
+					},
+				})
+				return
+			}
+		}
+
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Database Error",
+			Message: "Failed to retrieve algorithm versions",
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// GetAlgorithmVersion returns one version of an algorithm
+// @Summary Get algorithm version
+// @Description Returns the code, config, author and message of one version of an algorithm
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param version path int true "Version number"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=data.AlgorithmVersion} "Version"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID or version"
+// @Failure 404 {object} dto.ErrorResponse "Version not found"
+// @Router /api/v1/algorithms/{id}/versions/{version} [get]
+func GetAlgorithmVersion(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid version",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		found, err := algoversions.NewService(db.GetConnection()).Get(c.Param("id"), userID, version)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm version not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm version retrieved successfully",
+			Data:    found,
+		})
+	}
+}
+
+// DiffAlgorithmVersions compares two versions of an algorithm
+// @Summary Diff algorithm versions
+// @Description Returns a unified diff of the code of two versions of an algorithm, with the lines added and removed, and the config keys added, changed and removed
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param from query int true "Version to compare from"
+// @Param to query int true "Version to compare to"
+// @Success 200 {object} dto.SuccessResponse{data=algoversions.Diff} "Diff"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID or versions"
+// @Failure 404 {object} dto.ErrorResponse "Version not found"
+// @Router /api/v1/algorithms/{id}/versions/diff [get]
+func DiffAlgorithmVersions(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		from, fromErr := strconv.Atoi(c.Query("from"))
+		to, toErr := strconv.Atoi(c.Query("to"))
+		if fromErr != nil || toErr != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "from and to must be version numbers",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		diff, err := algoversions.NewService(db.GetConnection()).Diff(c.Param("id"), userID, from, to)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: err.Error(),
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm versions compared successfully",
+			Data:    diff,
+		})
+	}
+}
+
+// RollbackAlgorithm restores an earlier version of an algorithm
+// @Summary Roll back algorithm
+// @Description Restores the code and config of one of an algorithm's versions. History is never rewritten: the restored code and config are stored as a new version, unless the algorithm already has them. State, settings and performance are left alone.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param version path int true "Version to restore"
+// @Param user_id query int true "User ID"
+// @Param request body dto.RollbackAlgorithmRequest false "Version message"
+// @Success 200 {object} dto.SuccessResponse{data=dto.RollbackAlgorithmResponse} "Algorithm and the version created"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID, version or request"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm or version not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/versions/{version}/rollback [post]
+func RollbackAlgorithm(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid version",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var req dto.RollbackAlgorithmRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: "Invalid JSON data",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+		}
+		var message string
+		if req.Message != nil {
+			message = *req.Message
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		created, err := algoversions.NewService(db.GetConnection()).Rollback(algo, version, userID, message)
+		if err != nil {
+			if errors.Is(err, algoversions.ErrVersionNotFound) {
+				c.JSON(http.StatusNotFound, dto.ErrorResponse{
+					Error:   "Not Found",
+					Message: "Algorithm version not found",
+					Code:    http.StatusNotFound,
+				})
+				return
+			}
+			utils.LogError(err, "Failed to roll back algorithm", map[string]interface{}{
+				"algorithm_id": algo.ID,
+				"version":      version,
+			})
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to roll back algorithm",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Algorithm rolled back successfully",
+			Data: dto.RollbackAlgorithmResponse{
+				Algorithm: convertAlgorithmToResponse(algo),
+				Version:   created,
+			},
+		})
+	}
+}
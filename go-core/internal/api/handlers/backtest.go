@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/backtest"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunBacktest backtests an algorithm over stored candles
+// @Summary Run backtest
+// @Description Replays the algorithm's symbol's stored candles of its timeframe through its code, one run per bar with up to lookback bars of history and a simulated account's portfolio, and acts on the signals: BUY covers a short or opens a long, SELL exits a long or, with allow_short, opens a short. Signals with a price are limit orders; others fill at the next bar's open or the signal bar's close. Stop losses and targets exit on the bars that reach them. Fills pay slippage and the charges model (none, flat, percent, equity_intraday or equity_delivery), entries are sized by signal quantity, a fixed quantity or a percentage of equity, and positions open at the end are closed at the last close. The run, its trades, equity curve and metrics are stored; code that fails on a bar stores a failed run. BACKTEST_MAX_BARS caps the bars in the range, and a backtest running longer than BACKTEST_TIMEOUT is stopped and stored as failed.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param request body dto.RunBacktestRequest true "Range and simulation settings"
+// @Success 201 {object} dto.SuccessResponse{data=data.Backtest} "Completed or failed backtest"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request or settings, or no candles in the range"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Failure 422 {object} dto.ErrorResponse "The code does not compile"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/backtests [post]
+func RunBacktest(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var req dto.RunBacktestRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		settings := data.BacktestSettings{SimulationSettings: req.SimulationSettings}
+		from, err := parseCandleTime(req.From)
+		var to time.Time
+		if err == nil {
+			to, err = parseCandleTime(req.To)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if !from.IsZero() {
+			settings.From = &from
+		}
+		if !to.IsZero() {
+			settings.To = &to
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		result, err := backtest.NewService(db.GetConnection()).Run(c.Request.Context(), algo, settings)
+		if err != nil {
+			var codeErr *algoruntime.Error
+			switch {
+			case errors.As(err, &codeErr):
+				c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+					Error:   "Algorithm Error",
+					Message: codeErr.Error(),
+					Code:    http.StatusUnprocessableEntity,
+				})
+			case errors.Is(err, backtest.ErrInvalidSettings):
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+			default:
+				utils.LogError(err, "Failed to run backtest", map[string]interface{}{
+					"algorithm_id": algo.ID,
+				})
+				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+					Error:   "Internal Server Error",
+					Message: "Failed to run backtest",
+					Code:    http.StatusInternalServerError,
+				})
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, dto.SuccessResponse{
+			Message: "Backtest finished",
+			Data:    result,
+		})
+	}
+}
+
+// GetBacktests lists an algorithm's backtests
+// @Summary List backtests
+// @Description Returns an algorithm's backtests newest first, with their settings and metrics but without trades and equity curves
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param limit query int false "Maximum backtests (default 20, max 100)"
+// @Param offset query int false "Backtests to skip"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.Backtest} "Backtests"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/backtests [get]
+func GetBacktests(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		backtests, err := repos.NewBacktestRepository(db.GetConnection()).GetBacktestsByAlgorithm(c.Param("id"), userID, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Database Error",
+				Message: "Failed to retrieve backtests",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Backtests retrieved successfully",
+			Data:    backtests,
+		})
+	}
+}
+
+// GetBacktest returns one backtest with its trades and equity curve
+// @Summary Get backtest
+// @Description Returns a stored backtest with its settings, metrics, trade list and equity curve
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param backtest_id path string true "Backtest ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=data.Backtest} "Backtest"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "Backtest not found"
+// @Router /api/v1/algorithms/{id}/backtests/{backtest_id} [get]
+func GetBacktest(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		result, err := repos.NewBacktestRepository(db.GetConnection()).GetBacktestByID(c.Param("backtest_id"), c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Backtest not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Backtest retrieved successfully",
+			Data:    result,
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/backup"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupJournal streams a portable backup archive of a user's journal
+// @Summary Back up journal
+// @Description Streams a versioned zip archive containing the user's profile, trades, strategies, rules, mistakes, algorithms with their version history, runs, backtests and paper trading accounts, broker fills, orders and position snapshots, and inline screenshots. The manifest's excluded list names what is left out: broker credentials, sync schedules and algorithm schedules.
+// @Tags backup
+// @Produce application/zip
+// @Param id path int true "User ID"
+// @Success 200 {file} file "Backup archive"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Router /api/v1/users/{id}/backup [get]
+func BackupJournal(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		if _, err := userRepo.GetUserByID(userIDStr); err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "User not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backup.FileName(userID, time.Now())))
+		c.Status(http.StatusOK)
+
+		// Headers are already sent once streaming starts, so failures can only be logged
+		manifest, err := backup.NewService(db.GetConnection(), db.Keyring()).Backup(c.Writer, userID)
+		if err != nil {
+			utils.LogError(err, "Failed to back up journal", map[string]interface{}{
+				"user_id": userID,
+			})
+			return
+		}
+
+		utils.LogInfo("Journal backed up successfully", map[string]interface{}{
+			"user_id": userID,
+			"counts":  manifest.Counts,
+		})
+	}
+}
+
+// RestoreJournal loads a backup archive into an existing user's journal
+// @Summary Restore journal
+// @Description Validates an uploaded backup archive and restores it into the user's journal with fresh IDs. Trades, versions, runs, backtests and paper accounts of a restored algorithm are linked to its new ID. Merge mode skips records the user already has; replace mode deletes the user's trades, strategies, rules, mistakes and algorithms first, and their broker fills, orders and positions when the archive holds them. The restore is all-or-nothing.
+// @Tags backup
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "User ID"
+// @Param mode query string false "Restore mode: merge or replace (default: merge)"
+// @Param archive formData file true "Backup archive (.zip)"
+// @Success 200 {object} dto.SuccessResponse{data=backup.RestoreResult} "Journal restored"
+// @Failure 400 {object} dto.ErrorResponse "Invalid archive or parameters"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/restore [post]
+func RestoreJournal(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		mode, err := backup.ParseRestoreMode(c.DefaultQuery("mode", string(backup.RestoreModeMerge)))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		if _, err := userRepo.GetUserByID(userIDStr); err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "User not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		header, err := c.FormFile("archive")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Backup archive is required in the 'archive' form field",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Failed to read uploaded archive",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		defer file.Close()
+
+		result, err := backup.NewService(db.GetConnection(), db.Keyring()).Restore(file, header.Size, userID, mode)
+		if err != nil {
+			utils.LogError(err, "Failed to restore journal", map[string]interface{}{
+				"user_id": userID,
+				"mode":    mode,
+			})
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Restore Failed",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Journal restored successfully",
+			Data:    result,
+		})
+	}
+}
@@ -0,0 +1,821 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/brokersync"
+	"go-core/internal/services/matching"
+	"go-core/internal/services/tokens"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ListBrokers lists the supported brokers and their capabilities
+// @Summary List brokers
+// @Description Lists supported brokers with their auth flow and whether they support token refresh, trade history, positions, holdings and funds
+// @Tags brokers
+// @Produce json
+// @Success 200 {object} dto.SuccessResponse{data=[]brokers.Capabilities} "Supported brokers"
+// @Router /api/v1/brokers [get]
+func ListBrokers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		capabilities := make([]brokers.Capabilities, 0)
+		for _, connector := range brokers.Connectors() {
+			capabilities = append(capabilities, connector.Capabilities())
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Brokers retrieved successfully",
+			Data:    capabilities,
+		})
+	}
+}
+
+// SyncBrokerTrades syncs trades from any supported broker for a user
+// @Summary Sync broker trades
+// @Description Fetches new executions from the broker, records them in the fill ledger (deduplicated by exchange trade ID), matches them into round-trip trades (closing open positions carried from earlier syncs) and saves them. Brokers without trade history only return today's executions.
+// @Tags brokers
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param method query string false "Lot matching method: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.SyncResult} "Trades synced successfully"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync [post]
+func SyncBrokerTrades(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		syncBrokerTrades(c, db, broker)
+	}
+}
+
+// syncBrokerTrades runs a sync for the broker and writes the response
+func syncBrokerTrades(c *gin.Context, db *data.DB, broker data.TradingBroker) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Invalid user ID",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	method, err := matching.ParseMethod(c.Query("method"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	result, err := brokersync.NewService(db.GetConnection(), db.Keyring()).Sync(c.Request.Context(), brokersync.SyncOptions{
+		UserID: userID,
+		Broker: broker,
+		Method: method,
+	})
+	if err != nil {
+		respondBrokerError(c, broker, err, "Failed to sync trades")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: fmt.Sprintf("Sync completed. Saved %d new trades, updated %d open trades, skipped %d already imported fills", result.Saved, result.Updated, result.Skipped),
+		Data:    result,
+	})
+}
+
+// ReconcileBrokerTrades re-syncs a date window from a broker and diffs it against the fill ledger
+// @Summary Reconcile broker trades
+// @Description Fetches executions for an arbitrary date window and compares them with stored fills by exchange trade ID, reporting added, changed and missing fills. With apply=true the ledger is updated and added fills are booked into the journal; journal trades affected by changed or missing fills are listed for review, not rewritten. Brokers without trade history (Zerodha) only return today's trades, so a window starting before today is rejected.
+// @Tags brokers
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param from_date query string true "First day of the window (YYYY-MM-DD)"
+// @Param to_date query string false "Last day of the window (YYYY-MM-DD, default: today)"
+// @Param apply query bool false "Apply the changes (default: false, report only)"
+// @Param method query string false "Lot matching method for added fills: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=ledger.Report} "Reconciliation report"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/reconcile [post]
+func ReconcileBrokerTrades(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		reconcileBrokerTrades(c, db, broker)
+	}
+}
+
+// reconcileBrokerTrades runs a reconciliation for the broker and writes the response
+func reconcileBrokerTrades(c *gin.Context, db *data.DB, broker data.TradingBroker) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Invalid user ID",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	fromDate, err := time.Parse("2006-01-02", c.Query("from_date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "from_date is required and must be in YYYY-MM-DD format",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	toDate := time.Now().UTC().Truncate(24 * time.Hour)
+	if toDateStr := c.Query("to_date"); toDateStr != "" {
+		if toDate, err = time.Parse("2006-01-02", toDateStr); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "to_date must be in YYYY-MM-DD format",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+	if toDate.Before(fromDate) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "to_date must not be before from_date",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	apply, err := strconv.ParseBool(c.DefaultQuery("apply", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "apply must be true or false",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	method, err := matching.ParseMethod(c.Query("method"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	report, err := brokersync.NewService(db.GetConnection(), db.Keyring()).Reconcile(c.Request.Context(), brokersync.ReconcileOptions{
+		UserID: userID,
+		Broker: broker,
+		From:   fromDate,
+		To:     toDate,
+		Method: method,
+		Apply:  apply,
+	})
+	if err != nil {
+		respondBrokerError(c, broker, err, "Failed to reconcile trades")
+		return
+	}
+
+	message := "Reconciliation report generated"
+	if apply {
+		message = "Reconciliation applied"
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: message,
+		Data:    report,
+	})
+}
+
+// GetBrokerPositions fetches the user's open positions live from the broker
+// @Summary Broker positions
+// @Description Fetches open positions (quantity, average price, last price, day and overall P&L) live from the broker
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=[]brokers.Position} "Open positions"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/positions [get]
+func GetBrokerPositions(db *data.DB) gin.HandlerFunc {
+	return brokerAccountHandler(db, "Positions", func(ctx context.Context, connector brokers.Connector, config *data.BrokerConfig) (interface{}, error) {
+		return connector.FetchPositions(ctx, config)
+	})
+}
+
+// GetBrokerHoldings fetches the user's demat holdings live from the broker
+// @Summary Broker holdings
+// @Description Fetches demat holdings (quantity, average price, last price, day and overall P&L) live from the broker
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=[]brokers.Holding} "Holdings"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/holdings [get]
+func GetBrokerHoldings(db *data.DB) gin.HandlerFunc {
+	return brokerAccountHandler(db, "Holdings", func(ctx context.Context, connector brokers.Connector, config *data.BrokerConfig) (interface{}, error) {
+		return connector.FetchHoldings(ctx, config)
+	})
+}
+
+// GetBrokerFunds fetches the user's account balance live from the broker
+// @Summary Broker funds
+// @Description Fetches available, utilised, collateral and withdrawable balances live from the broker
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=brokers.Funds} "Funds"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/funds [get]
+func GetBrokerFunds(db *data.DB) gin.HandlerFunc {
+	return brokerAccountHandler(db, "Funds", func(ctx context.Context, connector brokers.Connector, config *data.BrokerConfig) (interface{}, error) {
+		return connector.FetchFunds(ctx, config)
+	})
+}
+
+// brokerAccountHandler loads the user's broker config and responds with one live account fetch
+func brokerAccountHandler(
+	db *data.DB,
+	what string,
+	fetch func(context.Context, brokers.Connector, *data.BrokerConfig) (interface{}, error),
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		connector, _ := brokers.GetConnector(broker)
+		_, config, err := brokersync.NewService(db.GetConnection(), db.Keyring()).LoadConfig(userID, broker)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to fetch "+what)
+			return
+		}
+
+		result, err := fetch(c.Request.Context(), connector, config)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to fetch "+what)
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: what + " retrieved successfully",
+			Data:    result,
+		})
+	}
+}
+
+// SyncBrokerPortfolio refreshes the stored positions and holdings snapshot from the broker
+// @Summary Sync broker positions and holdings
+// @Description Replaces the stored snapshot of open positions and demat holdings with the broker's current one. Trade syncs refresh it too.
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.SnapshotResult} "Snapshot synced"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/portfolio/sync [post]
+func SyncBrokerPortfolio(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		result, err := brokersync.NewService(db.GetConnection(), db.Keyring()).SyncSnapshot(c.Request.Context(), userID, broker)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to sync positions and holdings")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: fmt.Sprintf("Snapshot synced. %d positions, %d holdings", result.Positions, result.Holdings),
+			Data:    result,
+		})
+	}
+}
+
+// GetBrokerPortfolio returns the stored positions and holdings snapshot with journal discrepancies
+// @Summary Broker portfolio snapshot
+// @Description Returns the positions and holdings captured at the last sync as open trades, and flags symbols whose net quantity at the broker differs from the open journal trades (not journaled, not at broker, or quantity mismatch)
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.Portfolio} "Portfolio snapshot"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/portfolio [get]
+func GetBrokerPortfolio(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		portfolio, err := brokersync.NewService(db.GetConnection(), db.Keyring()).GetPortfolio(userID, broker)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to get portfolio")
+			return
+		}
+
+		message := "Portfolio retrieved successfully"
+		if len(portfolio.Discrepancies) > 0 {
+			message = fmt.Sprintf("Portfolio retrieved. %d symbols differ from the journal", len(portfolio.Discrepancies))
+		}
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: message,
+			Data:    portfolio,
+		})
+	}
+}
+
+// SyncBrokerOrders records the day's order book from the broker
+// @Summary Sync broker orders
+// @Description Fetches the day's order book, including rejected, cancelled and modified orders, and records new orders and status transitions. Zerodha provides each order's full history; Dhan only its latest state, so its transitions are those seen across syncs. Trade syncs record the order book too.
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.OrderSyncResult} "Orders synced"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/orders/sync [post]
+func SyncBrokerOrders(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		result, err := brokersync.NewService(db.GetConnection(), db.Keyring()).SyncOrders(c.Request.Context(), userID, broker)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to sync orders")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: fmt.Sprintf("Orders synced. %d new orders, %d updated, %d new events", result.Created, result.Updated, result.Events),
+			Data:    result,
+		})
+	}
+}
+
+// ListBrokerOrders lists recorded broker orders with their status transitions
+// @Summary List broker orders
+// @Description Lists recorded orders from the broker's order book with every recorded status transition and modification
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param from_date query string false "First day orders were placed (YYYY-MM-DD)"
+// @Param to_date query string false "Last day orders were placed (YYYY-MM-DD)"
+// @Param symbol query string false "Filter by symbol"
+// @Param status query string false "Filter by status (pending, open, trigger_pending, modified, partially_filled, filled, cancelled, rejected, expired)"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.BrokerOrder} "Orders"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/orders [get]
+func ListBrokerOrders(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		filter := repos.BrokerOrderFilter{TradingBroker: &broker}
+		if fromDateStr := c.Query("from_date"); fromDateStr != "" {
+			fromDate, err := time.Parse("2006-01-02", fromDateStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: "from_date must be in YYYY-MM-DD format",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			filter.From = &fromDate
+		}
+		if toDateStr := c.Query("to_date"); toDateStr != "" {
+			toDate, err := time.Parse("2006-01-02", toDateStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: "to_date must be in YYYY-MM-DD format",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			toDate = toDate.AddDate(0, 0, 1)
+			filter.To = &toDate
+		}
+		if symbol := c.Query("symbol"); symbol != "" {
+			filter.Symbol = &symbol
+		}
+		if status := c.Query("status"); status != "" {
+			filter.Status = &status
+		}
+
+		orders, err := brokersync.NewService(db.GetConnection(), db.Keyring()).ListOrders(userID, filter)
+		if err != nil {
+			respondBrokerError(c, broker, err, "Failed to get orders")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Orders retrieved successfully",
+			Data:    orders,
+		})
+	}
+}
+
+// StartBrokerAuth starts a broker login
+// @Summary Start broker login
+// @Description Starts the broker's login flow from the stored API credentials and returns the URL the user must open
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=dto.BrokerAuthStartResponse} "Login started"
+// @Failure 400 {object} dto.ErrorResponse "Credentials missing"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/auth/start [post]
+func StartBrokerAuth(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := userRepo.GetUserByID(c.Param("id"))
+		if err != nil {
+			respondBrokerError(c, broker, brokersync.ErrUserNotFound, "")
+			return
+		}
+
+		config, exists := user.ConfiguredBrokers[string(broker)]
+		if !exists {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "API credentials not configured. Please save credentials first.",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		connector, _ := brokers.GetConnector(broker)
+		start, err := connector.BeginAuth(c.Request.Context(), &config)
+		if err != nil {
+			utils.LogError(err, "Failed to start broker login", map[string]interface{}{
+				"user_id":        user.ID,
+				"trading_broker": broker,
+			})
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "Failed to start login: " + err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Login started",
+			Data: dto.BrokerAuthStartResponse{
+				Broker:   string(broker),
+				LoginURL: start.LoginURL,
+			},
+		})
+	}
+}
+
+// CompleteBrokerAuth completes a broker login and stores the access token
+// @Summary Complete broker login
+// @Description Completes the broker's login with the parameters it redirected back with (tokenId for Dhan, request_token for Zerodha) and stores the access token
+// @Tags brokers
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param request body dto.BrokerAuthCompleteRequest true "Redirect parameters"
+// @Success 200 {object} dto.SuccessResponse{data=dto.BrokerTokenResponse} "Login completed"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/auth/complete [post]
+func CompleteBrokerAuth(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+
+		var req dto.BrokerAuthCompleteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		validate := validator.New()
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := userRepo.GetUserByID(c.Param("id"))
+		if err != nil {
+			respondBrokerError(c, broker, brokersync.ErrUserNotFound, "")
+			return
+		}
+
+		config, exists := user.ConfiguredBrokers[string(broker)]
+		if !exists {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "API credentials not configured. Please save credentials first.",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		connector, _ := brokers.GetConnector(broker)
+		if err := connector.CompleteAuth(c.Request.Context(), &config, req.Params); err != nil {
+			respondBrokerError(c, broker, err, "Failed to complete login")
+			return
+		}
+		if err := userRepo.UpdateUserBrokerConfig(user.ID, string(broker), config); err != nil {
+			utils.LogError(err, "Failed to update user broker config")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to update broker configuration",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Login completed",
+			Data: dto.BrokerTokenResponse{
+				Broker:     string(broker),
+				ExpiryTime: config.ExpiryTime,
+			},
+		})
+	}
+}
+
+// RefreshBrokerToken renews the stored access token without a new login
+// @Summary Refresh broker token
+// @Description Renews the stored access token for brokers that support it
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=dto.BrokerTokenResponse} "Token renewed"
+// @Failure 400 {object} dto.ErrorResponse "Not configured or not supported"
+// @Failure 401 {object} dto.ErrorResponse "Broker token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/refresh-token [post]
+func RefreshBrokerToken(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := userRepo.GetUserByID(c.Param("id"))
+		if err != nil {
+			respondBrokerError(c, broker, brokersync.ErrUserNotFound, "")
+			return
+		}
+		config, exists := user.ConfiguredBrokers[string(broker)]
+		if !exists || config.AccessToken == "" {
+			respondBrokerError(c, broker, brokersync.ErrNotConfigured, "")
+			return
+		}
+
+		connector, _ := brokers.GetConnector(broker)
+		if err := tokens.Renew(c.Request.Context(), db.GetConnection(), db.Keyring(), user.ID, connector, &config); err != nil {
+			respondBrokerError(c, broker, err, "Failed to renew token")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Token renewed successfully",
+			Data: dto.BrokerTokenResponse{
+				Broker:     string(broker),
+				ExpiryTime: config.ExpiryTime,
+			},
+		})
+	}
+}
+
+// GetBrokerStatus reports the health of a user's broker credentials
+// @Summary Broker credential health
+// @Description Reports whether the broker's access token is valid, expiring, expired or revoked, when it expires, whether it is renewed in the background, and the last renewal failure
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=tokens.Health} "Credential health"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Router /api/v1/users/{id}/brokers/{broker}/status [get]
+func GetBrokerStatus(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+
+		user, err := repos.NewUserRepository(db.GetConnection(), db.Keyring()).GetUserByID(c.Param("id"))
+		if err != nil {
+			respondBrokerError(c, broker, brokersync.ErrUserNotFound, "")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Broker status retrieved successfully",
+			Data:    tokens.CheckUser(user, broker, time.Now()),
+		})
+	}
+}
+
+// parseBrokerParam reads the :broker path parameter, writing a 400 response for unknown brokers
+func parseBrokerParam(c *gin.Context) (data.TradingBroker, bool) {
+	broker := data.TradingBroker(c.Param("broker"))
+	if _, err := brokers.GetConnector(broker); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return "", false
+	}
+	return broker, true
+}
+
+// respondBrokerError maps broker connector and sync errors to error responses
+// fallback is the message used for unexpected errors
+func respondBrokerError(c *gin.Context, broker data.TradingBroker, err error, fallback string) {
+	name := brokerDisplayName(broker)
+	switch {
+	case errors.Is(err, brokersync.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: "User not found",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, brokersync.ErrTradeNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: "Trade not found",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, brokersync.ErrNotConfigured):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: fmt.Sprintf("%s broker not configured or access token missing. Please configure %s first.", name, name),
+			Code:    http.StatusBadRequest,
+		})
+	case errors.Is(err, brokersync.ErrTokenExpired):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: fmt.Sprintf("%s access token has expired. Please renew the token from the Accounts page.", name),
+			Code:    http.StatusBadRequest,
+		})
+	case errors.Is(err, brokers.ErrInvalidToken):
+		utils.LogError(err, fallback, map[string]interface{}{"trading_broker": broker})
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error:   "Unauthorized",
+			Message: fmt.Sprintf("%s access token is invalid or expired. Please renew the token from the Accounts page.", name),
+			Code:    http.StatusUnauthorized,
+		})
+	case errors.Is(err, brokers.ErrNotSupported):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: fmt.Sprintf("%s: %s", fallback, err.Error()),
+			Code:    http.StatusBadRequest,
+		})
+	default:
+		utils.LogError(err, fallback, map[string]interface{}{"trading_broker": broker})
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: fmt.Sprintf("%s: %s", fallback, err.Error()),
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// brokerDisplayName returns the broker's name as shown to users
+func brokerDisplayName(broker data.TradingBroker) string {
+	switch broker {
+	case data.TradingBrokerDhan:
+		return "Dhan"
+	case data.TradingBrokerZerodha:
+		return "Zerodha"
+	default:
+		return string(broker)
+	}
+}
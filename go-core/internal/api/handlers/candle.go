@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/candles"
+	"go-core/internal/services/indicators"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportCandles loads OHLCV bars from an uploaded CSV into the candle store
+// @Summary Import candles
+// @Description Stores the bars of a CSV with a header row at the given timeframe and rebuilds every longer timeframe they cover, e.g. 5m to 1w bars from 1m bars. The header needs date or timestamp (optionally with a separate time column), open, high, low and close columns, and may have volume and symbol. Timestamps without an offset are read as IST; RFC 3339 and Unix epoch timestamps are also accepted. Bars replace stored bars with the same timestamp.
+// @Tags candles
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Candle CSV"
+// @Param symbol formData string false "Symbol of the bars, required when the CSV has no symbol column"
+// @Param timeframe formData string true "Timeframe of the bars (1m, 5m, 15m, 30m, 1h, 4h, 1d or 1w)"
+// @Success 200 {object} dto.SuccessResponse{data=candles.ImportResult} "Candles imported"
+// @Failure 400 {object} dto.ErrorResponse "Invalid timeframe or CSV"
+// @Router /api/v1/candles/import [post]
+func ImportCandles(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeframe, err := candles.ParseTimeframe(c.PostForm("timeframe"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "A CSV file is required in the 'file' field",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Failed to read uploaded file",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		defer file.Close()
+
+		symbol := strings.TrimSpace(c.PostForm("symbol"))
+		result, err := candles.NewService(db.GetConnection()).Import(file, symbol, timeframe)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Import Failed",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Candles imported successfully",
+			Data:    result,
+		})
+	}
+}
+
+// GetCandles returns a range of stored bars
+// @Summary Get candles
+// @Description Returns a symbol's bars at one timeframe, oldest first. With from, bars starting in [from, to) are returned; without it, the latest bars before to (or now).
+// @Tags candles
+// @Produce json
+// @Param symbol query string true "Symbol"
+// @Param timeframe query string true "Timeframe (1m, 5m, 15m, 30m, 1h, 4h, 1d or 1w)"
+// @Param from query string false "Start of the range (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param to query string false "End of the range, exclusive (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param limit query int false "Number of bars to return (default: 500, max: 10000)"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.Candle} "Candles"
+// @Failure 400 {object} dto.ErrorResponse "Invalid parameters"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/candles [get]
+func GetCandles(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		symbol := strings.ToUpper(strings.TrimSpace(c.Query("symbol")))
+		timeframe, err := candles.ParseTimeframe(c.Query("timeframe"))
+		if err == nil && symbol == "" {
+			err = errors.New("symbol is required")
+		}
+		var from, to time.Time
+		if err == nil {
+			from, err = parseCandleTime(c.Query("from"))
+		}
+		if err == nil {
+			to, err = parseCandleTime(c.Query("to"))
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+		if err != nil || limit < 1 || limit > 10000 {
+			limit = 500
+		}
+
+		repo := repos.NewCandleRepository(db.GetConnection())
+		var found []*data.Candle
+		if from.IsZero() {
+			found, err = repo.GetLatestCandles(symbol, timeframe, to, limit)
+		} else {
+			found, err = repo.GetCandles(symbol, timeframe, from, to, limit)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get candles",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		if found == nil {
+			found = []*data.Candle{}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Candles retrieved successfully",
+			Data:    found,
+		})
+	}
+}
+
+// maxIndicatorWarmup caps the bars read before a range for its indicators to settle
+const maxIndicatorWarmup = 2000
+
+// GetCandleIndicators computes technical indicators over a range of stored bars
+// @Summary Get candle indicators
+// @Description Computes indicators over a symbol's bars at one timeframe and returns their values at each bar of the range, oldest first. The range is chosen as in GET /candles. Bars before the range are read so that smoothed indicators such as EMA and RSI have settled by its first bar; values an indicator does not have enough history for are null. Indicators are given in their compact form, the type followed by its parameters separated by colons: sma:20, ema:50, rsi:14, macd:12:26:9, bollinger:20:2, atr:14, vwap, supertrend:10:3, stochastic:14:3 or adx:14.
+// @Tags candles
+// @Produce json
+// @Param symbol query string true "Symbol"
+// @Param timeframe query string true "Timeframe (1m, 5m, 15m, 30m, 1h, 4h, 1d or 1w)"
+// @Param indicators query string true "Comma-separated indicators, e.g. sma:20,rsi:14,macd:12:26:9"
+// @Param from query string false "Start of the range (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param to query string false "End of the range, exclusive (RFC 3339 or YYYY-MM-DD in IST)"
+// @Param limit query int false "Number of bars to return (default: 500, max: 10000)"
+// @Success 200 {object} dto.SuccessResponse{data=dto.CandleIndicatorsResponse} "Indicator values"
+// @Failure 400 {object} dto.ErrorResponse "Invalid parameters"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/candles/indicators [get]
+func GetCandleIndicators(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		symbol := strings.ToUpper(strings.TrimSpace(c.Query("symbol")))
+		timeframe, err := candles.ParseTimeframe(c.Query("timeframe"))
+		if err == nil && symbol == "" {
+			err = errors.New("symbol is required")
+		}
+		var specs []indicators.Spec
+		if err == nil {
+			specs, err = parseIndicators(c.Query("indicators"))
+		}
+		var from, to time.Time
+		if err == nil {
+			from, err = parseCandleTime(c.Query("from"))
+		}
+		if err == nil {
+			to, err = parseCandleTime(c.Query("to"))
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+		if err != nil || limit < 1 || limit > 10000 {
+			limit = 500
+		}
+
+		repo := repos.NewCandleRepository(db.GetConnection())
+		var found []*data.Candle
+		if from.IsZero() {
+			found, err = repo.GetLatestCandles(symbol, timeframe, to, limit)
+		} else {
+			found, err = repo.GetCandles(symbol, timeframe, from, to, limit)
+		}
+		var warmup []*data.Candle
+		if err == nil && len(found) > 0 {
+			bars := 0
+			for _, spec := range specs {
+				bars = max(bars, spec.Warmup())
+			}
+			warmup, err = repo.GetLatestCandles(symbol, timeframe, found[0].Timestamp, min(bars, maxIndicatorWarmup))
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get candles",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		series := indicators.Compute(specs, append(warmup, found...))
+		response := dto.CandleIndicatorsResponse{
+			Symbol:     symbol,
+			Timeframe:  string(timeframe),
+			Indicators: specs,
+			Bars:       make([]dto.CandleIndicatorBar, len(found)),
+		}
+		for i, candle := range found {
+			bar := len(warmup) + i
+			values := make(map[string]interface{}, len(specs))
+			for j, spec := range specs {
+				values[spec.Key] = series.Value(j, bar)
+			}
+			response.Bars[i] = dto.CandleIndicatorBar{Timestamp: candle.Timestamp, Close: candle.Close, Values: values}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Indicators computed successfully",
+			Data:    response,
+		})
+	}
+}
+
+// GetCandleSeries lists the stored symbols and timeframes
+// @Summary List candle series
+// @Description Returns each stored symbol and timeframe with its number of bars and the first and last bar times.
+// @Tags candles
+// @Produce json
+// @Param symbol query string false "Only this symbol"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.CandleSeries} "Stored series"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/candles/series [get]
+func GetCandleSeries(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo := repos.NewCandleRepository(db.GetConnection())
+		series, err := repo.GetSeries(strings.ToUpper(strings.TrimSpace(c.Query("symbol"))))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get candle series",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		if series == nil {
+			series = []*data.CandleSeries{}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Candle series retrieved successfully",
+			Data:    series,
+		})
+	}
+}
+
+// parseCandleTime reads an optional RFC 3339 time or an IST date
+func parseCandleTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, utils.IST); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("invalid time " + strconv.Quote(value) + " (expected RFC 3339 or YYYY-MM-DD)")
+}
+
+// parseIndicators reads a comma-separated list of indicators in their compact form
+func parseIndicators(value string) ([]indicators.Spec, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, errors.New("indicators is required, e.g. sma:20,rsi:14")
+	}
+	var specs []indicators.Spec
+	keys := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		spec, err := indicators.ParseSpec(part)
+		if err != nil {
+			return nil, err
+		}
+		if keys[spec.Key] {
+			return nil, errors.New("indicator " + strconv.Quote(strings.TrimSpace(part)) + " is listed twice")
+		}
+		keys[spec.Key] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
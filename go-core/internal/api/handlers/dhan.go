@@ -10,7 +10,9 @@ import (
 	"go-core/internal/api/dto"
 	"go-core/internal/data"
 	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
 	"go-core/internal/services/brokers"
+	"go-core/internal/services/tokens"
 	"go-core/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -66,7 +68,7 @@ func RenewDhanToken(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Get user's broker config to get stored access token and client ID
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(strconv.Itoa(userID))
 		if err != nil {
 			utils.LogError(err, "Failed to get user")
@@ -106,7 +108,7 @@ func RenewDhanToken(db *data.DB) gin.HandlerFunc {
 
 		// Call Dhan service to renew token
 		dhanService := brokers.NewDhanService()
-		response, err := dhanService.RenewToken(accessToken, clientID)
+		response, err := dhanService.RenewToken(c.Request.Context(), accessToken, clientID)
 		if err != nil {
 			utils.LogError(err, "Failed to renew Dhan token")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -131,10 +133,9 @@ func RenewDhanToken(db *data.DB) gin.HandlerFunc {
 		if config.DhanClientID == nil {
 			config.DhanClientID = &clientID
 		}
-		user.ConfiguredBrokers["dhan"] = config
 
-		// Save updated user
-		if err := repo.UpdateUser(user); err != nil {
+		// Save the Dhan config
+		if err := repo.UpdateUserBrokerConfig(user.ID, "dhan", config); err != nil {
 			utils.LogError(err, "Failed to update user broker config")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 				Error:   "Internal Server Error",
@@ -148,7 +149,7 @@ func RenewDhanToken(db *data.DB) gin.HandlerFunc {
 			Message: "Token renewed successfully",
 			Data: dto.DhanRenewTokenResponse{
 				Status:      response.Status,
-				AccessToken: response.AccessToken,
+				AccessToken: secrets.Redact(response.AccessToken),
 				ExpiryTime:  response.ExpiryTime,
 			},
 		})
@@ -180,7 +181,7 @@ func GenerateDhanConsent(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Get user's API credentials from broker config
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(userIDStr)
 		if err != nil {
 			utils.LogError(err, "Failed to get user")
@@ -221,7 +222,7 @@ func GenerateDhanConsent(db *data.DB) gin.HandlerFunc {
 
 		// Call Dhan service to generate consent
 		dhanService := brokers.NewDhanService()
-		response, err := dhanService.GenerateConsent(clientID, appID, appSecret)
+		response, err := dhanService.GenerateConsent(c.Request.Context(), clientID, appID, appSecret)
 		if err != nil {
 			utils.LogError(err, "Failed to generate Dhan consent", map[string]interface{}{
 				"error":          err.Error(),
@@ -258,7 +259,7 @@ func GenerateDhanConsent(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Build login URL
-		loginURL := "https://auth.dhan.co/login/consentApp-login?consentAppId=" + response.ConsentAppID
+		loginURL := dhanService.ConsentLoginURL(response.ConsentAppID)
 
 		// Build callback URL for Dhan redirect configuration
 		scheme := "http"
@@ -333,7 +334,7 @@ func ConsumeDhanConsent(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Get user's API credentials from broker config
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(c.Param("id"))
 		if err != nil {
 			utils.LogError(err, "Failed to get user")
@@ -360,7 +361,7 @@ func ConsumeDhanConsent(db *data.DB) gin.HandlerFunc {
 
 		// Call Dhan service to consume consent
 		dhanService := brokers.NewDhanService()
-		response, err := dhanService.ConsumeConsent(req.TokenID, appID, appSecret)
+		response, err := dhanService.ConsumeConsent(c.Request.Context(), req.TokenID, appID, appSecret)
 		if err != nil {
 			utils.LogError(err, "Failed to consume Dhan consent")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -404,7 +405,7 @@ func ConsumeDhanConsent(db *data.DB) gin.HandlerFunc {
 				DhanClientName:       response.DhanClientName,
 				DhanClientUcc:        response.DhanClientUcc,
 				GivenPowerOfAttorney: response.GivenPowerOfAttorney,
-				AccessToken:          response.AccessToken,
+				AccessToken:          secrets.Redact(response.AccessToken),
 				ExpiryTime:           response.ExpiryTime,
 			},
 		})
@@ -525,7 +526,7 @@ func ConsumeDhanConsentCallback(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Get user's API credentials from broker config
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(userIDStr)
 		if err != nil {
 			utils.LogError(err, "Failed to get user in consent callback")
@@ -544,7 +545,7 @@ func ConsumeDhanConsentCallback(db *data.DB) gin.HandlerFunc {
 
 		// Call Dhan service to consume consent
 		dhanService := brokers.NewDhanService()
-		response, err := dhanService.ConsumeConsent(tokenID, appID, appSecret)
+		response, err := dhanService.ConsumeConsent(c.Request.Context(), tokenID, appID, appSecret)
 		if err != nil {
 			utils.LogError(err, "Failed to consume Dhan consent in callback")
 			renderError(http.StatusInternalServerError, "Failed to consume consent: "+err.Error())
@@ -729,7 +730,7 @@ func SaveDhanCredentials(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Update user's broker config
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(userIDStr)
 		if err != nil {
 			utils.LogError(err, "Failed to get user")
@@ -752,10 +753,9 @@ func SaveDhanCredentials(db *data.DB) gin.HandlerFunc {
 		config.APISecret = &req.APISecret
 		config.DhanClientID = &req.DhanClientID
 		config.ConfiguredAt = time.Now()
-		user.ConfiguredBrokers["dhan"] = config
 
-		// Save updated user
-		if err := repo.UpdateUser(user); err != nil {
+		// Save the Dhan config
+		if err := repo.UpdateUserBrokerConfig(user.ID, "dhan", config); err != nil {
 			utils.LogError(err, "Failed to update user broker config")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 				Error:   "Internal Server Error",
@@ -823,7 +823,7 @@ func SaveDhanToken(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Update user's broker config
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		config := data.BrokerConfig{
 			AccessToken:  req.AccessToken,
 			DhanClientID: &req.DhanClientID,
@@ -860,7 +860,7 @@ func SaveDhanToken(db *data.DB) gin.HandlerFunc {
 
 // GetDhanBrokerConfig gets the Dhan broker configuration for a user
 // @Summary Get Dhan broker configuration
-// @Description Gets the Dhan broker configuration for a user
+// @Description Gets the Dhan broker configuration for a user, including the access token's health (not_configured, valid, expiring, expired or revoked)
 // @Tags dhan
 // @Accept json
 // @Produce json
@@ -883,7 +883,7 @@ func GetDhanBrokerConfig(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Get user
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(userIDStr)
 		if err != nil {
 			utils.LogError(err, "Failed to get user")
@@ -897,11 +897,14 @@ func GetDhanBrokerConfig(db *data.DB) gin.HandlerFunc {
 
 		// Get Dhan config
 		config, exists := user.ConfiguredBrokers["dhan"]
+		health := tokens.CheckUser(user, data.TradingBrokerDhan, time.Now())
 		if !exists || config.AccessToken == "" {
 			c.JSON(http.StatusOK, dto.SuccessResponse{
 				Message: "Broker configuration retrieved successfully",
 				Data: dto.DhanBrokerConfigResponse{
-					Configured: false,
+					Configured:         false,
+					TokenStatus:        string(health.State),
+					TokenStatusMessage: health.Message,
 				},
 			})
 			return
@@ -915,10 +918,12 @@ func GetDhanBrokerConfig(db *data.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, dto.SuccessResponse{
 			Message: "Broker configuration retrieved successfully",
 			Data: dto.DhanBrokerConfigResponse{
-				Configured:     true,
-				DhanClientID:   getStringValue(config.DhanClientID),
-				DhanClientName: getStringValue(config.DhanClientName),
-				ExpiryTime:     expiryTimeStr,
+				Configured:         true,
+				DhanClientID:       getStringValue(config.DhanClientID),
+				DhanClientName:     getStringValue(config.DhanClientName),
+				ExpiryTime:         expiryTimeStr,
+				TokenStatus:        string(health.State),
+				TokenStatusMessage: health.Message,
 			},
 		})
 	}
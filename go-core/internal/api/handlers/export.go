@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/export"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportJournal streams a user's journal as CSV, JSON or XLSX
+// @Summary Export journal
+// @Description Streams a user's trades (with psychology, rules, mistakes, broker fields and computed P&L), strategies, rules, mistakes and algorithms. CSV exports a single entity per file; JSON and XLSX can contain several. Trades accept the same filters as trade listing. CSV text cells starting with =, +, -, @, a tab or a carriage return are prefixed with a single quote so spreadsheets do not read them as formulas.
+// @Tags export
+// @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param id path int true "User ID"
+// @Param format query string false "Export format: csv, json or xlsx (default: json)"
+// @Param entities query string false "Comma separated entities: trades, strategies, rules, mistakes, algorithms (default: all, or trades for csv)"
+// @Param symbol query string false "Filter trades by symbol"
+// @Param market_type query string false "Filter trades by market type"
+// @Param direction query string false "Filter trades by direction (long, short)"
+// @Param outcome_summary query string false "Filter trades by outcome summary"
+// @Param strategy query string false "Filter trades by strategy"
+// @Param trading_broker query string false "Filter trades by broker (dhan, zerodha)"
+// @Param product_type query string false "Filter trades by product type (CNC, MIS, NRML, INTRADAY, OTC)"
+// @Param from_date query string false "Only trades entered on or after this date (YYYY-MM-DD)"
+// @Param to_date query string false "Only trades entered on or before this date (YYYY-MM-DD)"
+// @Success 200 {file} file "Export file"
+// @Failure 400 {object} dto.ErrorResponse "Invalid query parameters"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Router /api/v1/users/{id}/export [get]
+func ExportJournal(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		format, err := export.ParseFormat(c.DefaultQuery("format", string(export.FormatJSON)))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		entitiesParam := c.Query("entities")
+		if entitiesParam == "" && format == export.FormatCSV {
+			entitiesParam = string(export.EntityTrades)
+		}
+		entities, err := export.ParseEntities(entitiesParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		filter, err := parseTradeFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		opts := export.Options{
+			UserID:      userID,
+			Format:      format,
+			Entities:    entities,
+			TradeFilter: filter,
+		}
+		if err := opts.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		if _, err := userRepo.GetUserByID(userIDStr); err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "User not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.Header("Content-Type", format.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", opts.FileName(time.Now())))
+		c.Status(http.StatusOK)
+
+		// Headers are already sent once streaming starts, so failures can only be logged
+		exporter := export.NewExporter(db.GetConnection())
+		if err := exporter.Export(c.Writer, opts); err != nil {
+			utils.LogError(err, "Failed to export journal", map[string]interface{}{
+				"user_id": userID,
+				"format":  format,
+			})
+			return
+		}
+
+		utils.LogInfo("Journal exported successfully", map[string]interface{}{
+			"user_id":  userID,
+			"format":   format,
+			"entities": entities,
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/instruments"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportInstruments loads a broker's instrument dump into the instrument master
+// @Summary Import instrument dump
+// @Description Replaces the broker's instruments with those in its instrument dump: Kite's /instruments CSV or Dhan's compact or detailed scrip master. Upload the CSV in the 'file' form field, or send no file to download the dump from the broker (INSTRUMENTS_DHAN_URL / INSTRUMENTS_ZERODHA_URL override the source). Later syncs journal trades, orders and positions under the instruments' canonical trading symbols.
+// @Tags instruments
+// @Accept multipart/form-data
+// @Produce json
+// @Param broker path string true "Broker whose dump this is (dhan or zerodha)"
+// @Param file formData file false "Instrument dump CSV; downloaded from the broker when omitted"
+// @Success 200 {object} dto.SuccessResponse{data=instruments.ImportResult} "Instruments imported"
+// @Failure 400 {object} dto.ErrorResponse "Invalid broker or dump"
+// @Failure 502 {object} dto.ErrorResponse "Dump download failed"
+// @Router /api/v1/instruments/{broker}/import [post]
+func ImportInstruments(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, ok := parseBrokerParam(c)
+		if !ok {
+			return
+		}
+
+		service := instruments.NewService(db.GetConnection())
+		var result *instruments.ImportResult
+		header, err := c.FormFile("file")
+		if err == nil {
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: "Failed to read uploaded file",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			defer file.Close()
+
+			result, err = service.Import(broker, file)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Import Failed",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+		} else {
+			result, err = service.Download(c.Request.Context(), broker)
+			if err != nil {
+				utils.LogError(err, "Failed to download instrument dump", map[string]interface{}{
+					"trading_broker": broker,
+				})
+				c.JSON(http.StatusBadGateway, dto.ErrorResponse{
+					Error:   "Import Failed",
+					Message: err.Error(),
+					Code:    http.StatusBadGateway,
+				})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Instruments imported successfully",
+			Data:    result,
+		})
+	}
+}
+
+// SearchInstruments finds instruments by trading symbol, name or ISIN
+// @Summary Search instruments
+// @Description Returns instruments whose trading symbol or name starts with q, or whose ISIN is q. Equities come first, then indices, then derivatives, shortest symbols first.
+// @Tags instruments
+// @Produce json
+// @Param q query string true "Symbol or name prefix, or ISIN"
+// @Param exchange query string false "NSE, BSE or MCX"
+// @Param limit query int false "Number of instruments to return (default: 20, max: 100)"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.Instrument} "Matching instruments"
+// @Failure 400 {object} dto.ErrorResponse "Missing query"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/instruments [get]
+func SearchInstruments(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "q is required",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		repo := repos.NewInstrumentRepository(db.GetConnection())
+		found, err := repo.Search(q, strings.ToUpper(c.Query("exchange")), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to search instruments",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		if found == nil {
+			found = []*data.Instrument{}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Instruments retrieved successfully",
+			Data:    found,
+		})
+	}
+}
+
+// ResolveInstrument shows which instrument and symbol a broker reference is journaled under
+// @Summary Resolve instrument
+// @Description Looks a broker's instrument reference up in the instrument master by security ID, then ISIN, then symbol, and returns its canonical listing: the preferred listing of the same ISIN for equities or of the same contract for derivatives, preferring Kite symbols and NSE over BSE. This is the symbol syncs journal the instrument under.
+// @Tags instruments
+// @Produce json
+// @Param broker query string true "Broker the reference comes from (dhan or zerodha)"
+// @Param security_id query string false "Dhan security ID or Kite instrument_token"
+// @Param isin query string false "ISIN"
+// @Param exchange query string false "Exchange or segment as the broker names it, e.g. NSE_EQ or NFO"
+// @Param symbol query string false "Broker's symbol"
+// @Success 200 {object} dto.SuccessResponse{data=data.Instrument} "Canonical instrument"
+// @Failure 400 {object} dto.ErrorResponse "Invalid broker or empty reference"
+// @Failure 404 {object} dto.ErrorResponse "Instrument not in the master"
+// @Router /api/v1/instruments/resolve [get]
+func ResolveInstrument(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker := data.TradingBroker(c.Query("broker"))
+		if _, err := brokers.GetConnector(broker); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		ref := instruments.Ref{
+			Exchange:   c.Query("exchange"),
+			SecurityID: c.Query("security_id"),
+			ISIN:       c.Query("isin"),
+			Symbol:     c.Query("symbol"),
+		}
+		if ref.SecurityID == "" && ref.ISIN == "" && ref.Symbol == "" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "One of security_id, isin or symbol is required",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		instrument := instruments.NewResolver(db.GetConnection()).Resolve(broker, ref)
+		if instrument == nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Instrument not found; import the broker's instrument dump first",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Instrument resolved successfully",
+			Data:    instrument,
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/papertrade"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPaperAccount returns an algorithm's paper trading account
+// @Summary Get paper account
+// @Description Returns the simulated account an algorithm in paper trading mode trades with: settings, cash, equity, realized and unrealized P&L, charges, open positions, pending orders, the journal trades of open positions and the closed round trip count and win rate
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=papertrade.Summary} "Paper account"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm or paper account not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/paper [get]
+func GetPaperAccount(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		account, err := papertrade.NewService(db.GetConnection()).Get(algo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Database Error",
+				Message: "Failed to retrieve paper account",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		if account == nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Paper account not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Paper account retrieved successfully",
+			Data:    account,
+		})
+	}
+}
+
+// ConfigurePaperAccount gives an algorithm a new paper trading account
+// @Summary Configure paper account
+// @Description Replaces an algorithm's paper account with a new one holding the initial capital of the settings, which also set slippage, the charges model, position sizing, the fill rule, shorting and lookback as for backtests. Positions of the old account are closed at their last prices and journaled, and the algorithm's total_trades, win_rate and total_pnl start again from zero.
+// @Tags algorithms
+// @Accept json
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Param request body data.SimulationSettings true "Simulation settings"
+// @Success 200 {object} dto.SuccessResponse{data=papertrade.Summary} "New paper account"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request or settings"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/paper [put]
+func ConfigurePaperAccount(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var settings data.SimulationSettings
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		account, err := papertrade.NewService(db.GetConnection()).Configure(algo, settings)
+		if err != nil {
+			if errors.Is(err, papertrade.ErrInvalidSettings) {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			utils.LogError(err, "Failed to configure paper account", map[string]interface{}{
+				"algorithm_id": algo.ID,
+			})
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to configure paper account",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Paper account configured successfully",
+			Data:    account,
+		})
+	}
+}
+
+// AdvancePaperTrading runs a paper trading algorithm over the bars stored since it last ran
+// @Summary Advance paper trading
+// @Description Runs an algorithm in paper_trading execution mode over the bars of its symbol and timeframe stored since its last advance; the first advance trades only the latest stored bar. Each bar fills the account's pending orders and stop loss or target exits, runs the code with the account's portfolio and acts on the signal as a backtest does. Positions opened and closed are journaled as trades carrying the algorithm_id, and the algorithm's state, last_signal, total_trades, win_rate and realized total_pnl are saved after every bar. Code that fails on a bar stops the advance there and the error is returned with the result. An algorithm without a paper account gets one with the default settings. PAPER_MAX_BARS caps the bars of one advance. Advances of the same algorithm, from this endpoint or the scheduler, run one at a time; one that waited continues from where the one before it stopped.
+// @Tags algorithms
+// @Produce json
+// @Param id path string true "Algorithm ID"
+// @Param user_id query int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=papertrade.Advance} "Bars processed, fills, closed round trips and the account"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID, or the algorithm is not in paper trading mode"
+// @Failure 404 {object} dto.ErrorResponse "Algorithm not found"
+// @Failure 422 {object} dto.ErrorResponse "The code does not compile"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/algorithms/{id}/paper/advance [post]
+func AdvancePaperTrading(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		algo, err := repos.NewAlgorithmRepository(db.GetConnection()).GetAlgorithmByID(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Algorithm not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		result, err := papertrade.NewService(db.GetConnection()).Advance(c.Request.Context(), algo)
+		if err != nil {
+			var codeErr *algoruntime.Error
+			switch {
+			case errors.As(err, &codeErr):
+				c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+					Error:   "Algorithm Error",
+					Message: codeErr.Error(),
+					Code:    http.StatusUnprocessableEntity,
+				})
+			case errors.Is(err, papertrade.ErrNotPaperTrading):
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+			default:
+				utils.LogError(err, "Failed to advance paper trading", map[string]interface{}{
+					"algorithm_id": algo.ID,
+				})
+				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+					Error:   "Internal Server Error",
+					Message: "Failed to advance paper trading",
+					Code:    http.StatusInternalServerError,
+				})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Paper trading advanced",
+			Data:    result,
+		})
+	}
+}
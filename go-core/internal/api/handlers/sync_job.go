@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/matching"
+	"go-core/internal/services/syncjobs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// QueueBrokerSync queues a background sync of a broker
+// @Summary Queue a background broker sync
+// @Description Queues the same sync as POST /sync to run in the background and returns the run at once. Poll the run for progress. If a sync of this broker is already queued or running, that run is returned instead.
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param method query string false "Lot matching method: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=data.BrokerSyncRun} "Sync already in progress"
+// @Success 202 {object} dto.SuccessResponse{data=data.BrokerSyncRun} "Sync queued"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-runs [post]
+func QueueBrokerSync(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		method, err := matching.ParseMethod(c.Query("method"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		run, queued, err := jobs.Enqueue(userID, broker, method, data.BrokerSyncTriggerManual)
+		if err != nil {
+			respondSyncJobError(c, broker, err, "Failed to queue sync")
+			return
+		}
+
+		if !queued {
+			c.JSON(http.StatusOK, dto.SuccessResponse{
+				Message: "A sync of this broker is already in progress",
+				Data:    run,
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, dto.SuccessResponse{
+			Message: "Sync queued",
+			Data:    run,
+		})
+	}
+}
+
+// ListBrokerSyncRuns lists a user's background syncs of a broker
+// @Summary List background broker syncs
+// @Description Lists background sync runs with status, counts, errors and duration, newest first
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param status query string false "Filter by status (queued, running, succeeded, failed)"
+// @Param limit query int false "Maximum number of runs (default: 50)"
+// @Success 200 {object} dto.SuccessResponse{data=[]data.BrokerSyncRun} "Sync runs"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-runs [get]
+func ListBrokerSyncRuns(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		filter := repos.BrokerSyncRunFilter{TradingBroker: &broker, Limit: 50}
+		if status := c.Query("status"); status != "" {
+			syncStatus := data.BrokerSyncStatus(status)
+			filter.Status = &syncStatus
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			limit, err := strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Request",
+					Message: "limit must be a positive integer",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			filter.Limit = limit
+		}
+
+		runs, err := jobs.ListRuns(userID, filter)
+		if err != nil {
+			respondSyncJobError(c, broker, err, "Failed to get sync runs")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Sync runs retrieved successfully",
+			Data:    runs,
+		})
+	}
+}
+
+// GetBrokerSyncRun returns a background sync with its progress
+// @Summary Get background broker sync progress
+// @Description Returns a sync run's status and, while it is running, the step it has reached (fetching_fills, importing_fills, syncing_orders, syncing_snapshot)
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param run_id path string true "Sync run ID"
+// @Success 200 {object} dto.SuccessResponse{data=data.BrokerSyncRun} "Sync run"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "Sync run not found"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-runs/{run_id} [get]
+func GetBrokerSyncRun(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		run, err := jobs.GetRun(userID, c.Param("run_id"))
+		if err == nil && run.TradingBroker != broker {
+			err = syncjobs.ErrRunNotFound
+		}
+		if err != nil {
+			respondSyncJobError(c, broker, err, "Failed to get sync run")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Sync run retrieved successfully",
+			Data:    run,
+		})
+	}
+}
+
+// GetBrokerSyncSchedule returns a user's background sync schedule for a broker
+// @Summary Get background sync schedule
+// @Description Returns when the broker is synced in the background and when the next run is due
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse{data=data.BrokerSyncSchedule} "Schedule"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "No schedule"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-schedule [get]
+func GetBrokerSyncSchedule(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		schedule, err := jobs.GetSchedule(userID, broker)
+		if err != nil {
+			respondSyncJobError(c, broker, err, "Failed to get sync schedule")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Sync schedule retrieved successfully",
+			Data:    schedule,
+		})
+	}
+}
+
+// SaveBrokerSyncSchedule creates or replaces a user's background sync schedule for a broker
+// @Summary Save background sync schedule
+// @Description Syncs the broker in the background at a time of day in IST on the chosen weekdays, for example at 15:45 after market close
+// @Tags brokers
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Param request body dto.BrokerSyncScheduleRequest true "Schedule"
+// @Success 200 {object} dto.SuccessResponse{data=data.BrokerSyncSchedule} "Schedule saved"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-schedule [put]
+func SaveBrokerSyncSchedule(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		var req dto.BrokerSyncScheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		method, err := matching.ParseMethod(req.Method)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		enabled := true
+		if req.Enabled != nil {
+			enabled = *req.Enabled
+		}
+
+		schedule, err := jobs.SaveSchedule(userID, broker, syncjobs.ScheduleOptions{
+			RunAt:    req.RunAt,
+			Weekdays: req.Weekdays,
+			Method:   method,
+			Enabled:  enabled,
+		})
+		if err != nil {
+			respondSyncJobError(c, broker, err, "Failed to save sync schedule")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Sync schedule saved successfully",
+			Data:    schedule,
+		})
+	}
+}
+
+// DeleteBrokerSyncSchedule stops background syncs of a broker
+// @Summary Delete background sync schedule
+// @Description Stops scheduled background syncs of the broker; runs already queued still execute
+// @Tags brokers
+// @Produce json
+// @Param id path int true "User ID"
+// @Param broker path string true "Broker (dhan, zerodha)"
+// @Success 200 {object} dto.SuccessResponse "Schedule deleted"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 404 {object} dto.ErrorResponse "No schedule"
+// @Router /api/v1/users/{id}/brokers/{broker}/sync-schedule [delete]
+func DeleteBrokerSyncSchedule(jobs *syncjobs.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		broker, userID, ok := parseSyncJobParams(c)
+		if !ok {
+			return
+		}
+
+		if err := jobs.DeleteSchedule(userID, broker); err != nil {
+			respondSyncJobError(c, broker, err, "Failed to delete sync schedule")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Sync schedule deleted successfully",
+		})
+	}
+}
+
+// parseSyncJobParams reads the broker and user ID path parameters, responding with 400 if either is invalid
+func parseSyncJobParams(c *gin.Context) (data.TradingBroker, int, bool) {
+	broker, ok := parseBrokerParam(c)
+	if !ok {
+		return "", 0, false
+	}
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Invalid user ID",
+			Code:    http.StatusBadRequest,
+		})
+		return "", 0, false
+	}
+	return broker, userID, true
+}
+
+// respondSyncJobError maps background sync errors to error responses, deferring to respondBrokerError
+func respondSyncJobError(c *gin.Context, broker data.TradingBroker, err error, fallback string) {
+	switch {
+	case errors.Is(err, syncjobs.ErrRunNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: "Sync run not found",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, syncjobs.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: "No sync schedule for this broker",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, syncjobs.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Validation Error",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+	default:
+		respondBrokerError(c, broker, err, fallback)
+	}
+}
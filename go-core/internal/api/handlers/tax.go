@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/tax"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTaxReport generates an Indian income tax report for a financial year
+// @Summary Tax report
+// @Description Classifies closed trades for an Indian financial year: delivery equity as short/long term capital gains (FIFO lots, 12 month holding period, 31 Jan 2018 grandfathering), intraday equity as speculative income, and futures/options as non-speculative business income with turnover. Figures are gross of charges. CSV returns one schedule per request.
+// @Tags tax
+// @Produce json
+// @Produce text/csv
+// @Param id path int true "User ID"
+// @Param fy query string true "Financial year, e.g. 2024-25"
+// @Param format query string false "json or csv (default: json)"
+// @Param schedule query string false "CSV schedule: capital_gains, speculative or business (default: capital_gains)"
+// @Param fmv query string false "31 Jan 2018 fair market values for grandfathered holdings, e.g. INFY:1150.5,TCS:3050"
+// @Success 200 {object} dto.SuccessResponse{data=tax.Report} "Tax report"
+// @Failure 400 {object} dto.ErrorResponse "Invalid query parameters"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/tax-report [get]
+func GetTaxReport(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		year, err := tax.ParseFinancialYear(c.Query("fy"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		format := strings.ToLower(c.DefaultQuery("format", "json"))
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "format must be json or csv",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		schedule, err := tax.ParseSchedule(c.DefaultQuery("schedule", string(tax.HeadCapitalGains)))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		fmv, err := parseFMV(c.Query("fmv"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		userRepo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		if _, err := userRepo.GetUserByID(userIDStr); err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "User not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		report, err := tax.NewGenerator(db.GetConnection()).Generate(tax.Options{
+			UserID: userID,
+			Year:   year,
+			FMV:    fmv,
+		})
+		if err != nil {
+			utils.LogError(err, "Failed to generate tax report", map[string]interface{}{
+				"user_id":        userID,
+				"financial_year": year.String(),
+			})
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to generate tax report",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		if format == "csv" {
+			c.Header("Content-Type", "text/csv")
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("tax-%s-%s.csv", year, schedule)))
+			c.Status(http.StatusOK)
+			if err := tax.WriteCSV(c.Writer, report, schedule); err != nil {
+				utils.LogError(err, "Failed to write tax schedule", map[string]interface{}{
+					"user_id":  userID,
+					"schedule": schedule,
+				})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Tax report generated successfully",
+			Data:    report,
+		})
+	}
+}
+
+// parseFMV parses "SYMBOL:price,SYMBOL:price" into a map keyed by upper-case symbol
+func parseFMV(value string) (map[string]float64, error) {
+	fmv := make(map[string]float64)
+	if strings.TrimSpace(value) == "" {
+		return fmv, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		symbol, priceStr, found := strings.Cut(pair, ":")
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+		if !found || strings.TrimSpace(symbol) == "" || err != nil || price <= 0 {
+			return nil, fmt.Errorf("invalid fmv entry %q (expected SYMBOL:price)", pair)
+		}
+		fmv[strings.ToUpper(strings.TrimSpace(symbol))] = price
+	}
+	return fmv, nil
+}
@@ -1,16 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"go-core/internal/api/dto"
 	"go-core/internal/data"
 	"go-core/internal/data/repos"
-	"go-core/internal/services/brokers"
+	"go-core/internal/services/brokersync"
 	"go-core/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -65,6 +65,22 @@ func CreateTrade(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Parse optional exit date
+		var exitDate *time.Time
+		if req.ExitDate != nil && *req.ExitDate != "" {
+			parsed, err := time.Parse("2006-01-02", *req.ExitDate)
+			if err != nil {
+				utils.LogError(err, "Failed to parse exit date")
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Date",
+					Message: "Exit date must be in YYYY-MM-DD format",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			exitDate = &parsed
+		}
+
 		// Convert DTO to model
 		trade := &data.Trade{
 			ID:             utils.GenerateID(),
@@ -76,6 +92,7 @@ func CreateTrade(db *data.DB) gin.HandlerFunc {
 			Quantity:       req.Quantity,
 			TotalAmount:    req.TotalAmount,
 			ExitPrice:      req.ExitPrice,
+			ExitDate:       exitDate,
 			Direction:      req.Direction,
 			StopLoss:       req.StopLoss,
 			Target:         req.Target,
@@ -237,6 +254,22 @@ func UpdateTrade(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Parse optional exit date
+		var exitDate *time.Time
+		if req.ExitDate != nil && *req.ExitDate != "" {
+			parsed, err := time.Parse("2006-01-02", *req.ExitDate)
+			if err != nil {
+				utils.LogError(err, "Failed to parse exit date")
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Invalid Date",
+					Message: "Exit date must be in YYYY-MM-DD format",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			exitDate = &parsed
+		}
+
 		// Convert DTO to model
 		trade := &data.Trade{
 			ID:             tradeID,
@@ -248,6 +281,7 @@ func UpdateTrade(db *data.DB) gin.HandlerFunc {
 			Quantity:       req.Quantity,
 			TotalAmount:    req.TotalAmount,
 			ExitPrice:      req.ExitPrice,
+			ExitDate:       exitDate,
 			Direction:      req.Direction,
 			StopLoss:       req.StopLoss,
 			Target:         req.Target,
@@ -412,6 +446,16 @@ func DeleteTrade(db *data.DB) gin.HandlerFunc {
 // @Produce json
 // @Param limit query int false "Number of trades to return (default: 10, max: 100)"
 // @Param offset query int false "Number of trades to skip (default: 0)"
+// @Param symbol query string false "Filter by symbol"
+// @Param market_type query string false "Filter by market type"
+// @Param direction query string false "Filter by direction (long, short)"
+// @Param outcome_summary query string false "Filter by outcome summary"
+// @Param strategy query string false "Filter by strategy"
+// @Param trading_broker query string false "Filter by broker (dhan, zerodha)"
+// @Param product_type query string false "Filter by product type (CNC, MIS, NRML, INTRADAY, OTC)"
+// @Param algorithm_id query string false "Filter by the paper trading algorithm that made the trade"
+// @Param from_date query string false "Only trades entered on or after this date (YYYY-MM-DD)"
+// @Param to_date query string false "Only trades entered on or before this date (YYYY-MM-DD)"
 // @Success 200 {object} dto.SuccessResponse{data=dto.GetTradesResponse} "Trades retrieved successfully"
 // @Failure 400 {object} dto.ErrorResponse "Invalid query parameters"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
@@ -432,8 +476,18 @@ func ListTrades(db *data.DB) gin.HandlerFunc {
 			offset = 0
 		}
 
+		filter, err := parseTradeFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
 		repo := repos.NewTradeRepository(db.GetConnection())
-		trades, err := repo.GetTradesByUser(0, limit, offset) // 0 means get all users' trades
+		trades, err := repo.GetTradesByUserFiltered(0, filter, limit, offset) // 0 means get all users' trades
 		if err != nil {
 			utils.LogError(err, "Failed to list trades")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -479,6 +533,16 @@ func ListTrades(db *data.DB) gin.HandlerFunc {
 // @Param user_id path int true "User ID"
 // @Param limit query int false "Number of trades to return (default: 10, max: 100)"
 // @Param offset query int false "Number of trades to skip (default: 0)"
+// @Param symbol query string false "Filter by symbol"
+// @Param market_type query string false "Filter by market type"
+// @Param direction query string false "Filter by direction (long, short)"
+// @Param outcome_summary query string false "Filter by outcome summary"
+// @Param strategy query string false "Filter by strategy"
+// @Param trading_broker query string false "Filter by broker (dhan, zerodha)"
+// @Param product_type query string false "Filter by product type (CNC, MIS, NRML, INTRADAY, OTC)"
+// @Param algorithm_id query string false "Filter by the paper trading algorithm that made the trade"
+// @Param from_date query string false "Only trades entered on or after this date (YYYY-MM-DD)"
+// @Param to_date query string false "Only trades entered on or before this date (YYYY-MM-DD)"
 // @Success 200 {object} dto.SuccessResponse{data=dto.GetTradesResponse} "User trades retrieved successfully"
 // @Failure 400 {object} dto.ErrorResponse "Invalid user ID or query parameters"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
@@ -510,8 +574,18 @@ func GetTradesByUser(db *data.DB) gin.HandlerFunc {
 			offset = 0
 		}
 
+		filter, err := parseTradeFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
 		repo := repos.NewTradeRepository(db.GetConnection())
-		trades, err := repo.GetTradesByUser(userID, limit, offset)
+		trades, err := repo.GetTradesByUserFiltered(userID, filter, limit, offset)
 		if err != nil {
 			utils.LogError(err, "Failed to get user trades", map[string]interface{}{
 				"user_id": userID,
@@ -550,6 +624,57 @@ func GetTradesByUser(db *data.DB) gin.HandlerFunc {
 	}
 }
 
+// parseTradeFilter reads the optional trade listing filters from the query string
+func parseTradeFilter(c *gin.Context) (repos.TradeFilter, error) {
+	var filter repos.TradeFilter
+
+	if symbol := c.Query("symbol"); symbol != "" {
+		filter.Symbol = &symbol
+	}
+	if marketType := c.Query("market_type"); marketType != "" {
+		value := data.MarketType(marketType)
+		filter.MarketType = &value
+	}
+	if direction := c.Query("direction"); direction != "" {
+		value := data.TradeDirection(direction)
+		filter.Direction = &value
+	}
+	if outcome := c.Query("outcome_summary"); outcome != "" {
+		value := data.OutcomeSummary(outcome)
+		filter.OutcomeSummary = &value
+	}
+	if strategy := c.Query("strategy"); strategy != "" {
+		filter.Strategy = &strategy
+	}
+	if broker := c.Query("trading_broker"); broker != "" {
+		value := data.TradingBroker(broker)
+		filter.TradingBroker = &value
+	}
+	if productType := c.Query("product_type"); productType != "" {
+		value := data.ProductType(productType)
+		filter.ProductType = &value
+	}
+	if algorithmID := c.Query("algorithm_id"); algorithmID != "" {
+		filter.AlgorithmID = &algorithmID
+	}
+	if fromDate := c.Query("from_date"); fromDate != "" {
+		parsed, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return filter, fmt.Errorf("from_date must be in YYYY-MM-DD format")
+		}
+		filter.FromDate = &parsed
+	}
+	if toDate := c.Query("to_date"); toDate != "" {
+		parsed, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return filter, fmt.Errorf("to_date must be in YYYY-MM-DD format")
+		}
+		filter.ToDate = &parsed
+	}
+
+	return filter, nil
+}
+
 // convertTradeToResponse converts a data.Trade to dto.TradeResponse
 func convertTradeToResponse(trade *data.Trade) dto.TradeResponse {
 	response := dto.TradeResponse{
@@ -562,6 +687,7 @@ func convertTradeToResponse(trade *data.Trade) dto.TradeResponse {
 		Quantity:       trade.Quantity,
 		TotalAmount:    trade.TotalAmount,
 		ExitPrice:      trade.ExitPrice,
+		ExitDate:       trade.ExitDate,
 		Direction:      trade.Direction,
 		StopLoss:       trade.StopLoss,
 		Target:         trade.Target,
@@ -579,6 +705,7 @@ func convertTradeToResponse(trade *data.Trade) dto.TradeResponse {
 		OrderID:         trade.OrderID,
 		ProductType:     trade.ProductType,
 		TransactionType: trade.TransactionType,
+		AlgorithmID:     trade.AlgorithmID,
 	}
 
 	// Add psychology if present
@@ -597,19 +724,81 @@ func convertTradeToResponse(trade *data.Trade) dto.TradeResponse {
 
 // SyncDhanTrades syncs trades from Dhan broker for a user
 // @Summary Sync Dhan trades
-// @Description Fetches all trades from Dhan API since Jan 2022 and saves new trades to the database
+// @Description Fetches new executions from Dhan, records them in the fill ledger (deduplicated by exchange trade ID), matches them into round-trip trades (closing open positions carried from earlier syncs) and saves them to the database
 // @Tags trades
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} dto.SuccessResponse "Trades synced successfully"
+// @Param method query string false "Lot matching method: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.SyncResult} "Trades synced successfully"
 // @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Dhan token invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /api/v1/users/{id}/trades/sync-dhan [post]
 func SyncDhanTrades(db *data.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userIDStr := c.Param("id")
-		userID, err := strconv.Atoi(userIDStr)
+		syncBrokerTrades(c, db, data.TradingBrokerDhan)
+	}
+}
+
+// ReconcileDhanTrades re-syncs a date window from Dhan and diffs it against the fill ledger
+// @Summary Reconcile Dhan trades
+// @Description Fetches Dhan executions for an arbitrary date window and compares them with stored fills by exchange trade ID, reporting added, changed and missing fills. With apply=true the ledger is updated and added fills are booked into the journal; journal trades affected by changed or missing fills are listed for review, not rewritten.
+// @Tags trades
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param from_date query string true "First day of the window (YYYY-MM-DD)"
+// @Param to_date query string false "Last day of the window (YYYY-MM-DD, default: today)"
+// @Param apply query bool false "Apply the changes (default: false, report only)"
+// @Param method query string false "Lot matching method for added fills: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=ledger.Report} "Reconciliation report"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Dhan token invalid"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/trades/reconcile-dhan [post]
+func ReconcileDhanTrades(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reconcileBrokerTrades(c, db, data.TradingBrokerDhan)
+	}
+}
+
+// SyncZerodhaTrades syncs today's trades from Zerodha for a user
+// @Summary Sync Zerodha trades
+// @Description Fetches today's executions from Kite Connect (Kite does not serve trade history), records them in the fill ledger (deduplicated by exchange trade ID), matches them into round-trip trades (closing open positions carried from earlier syncs) and saves them to the database
+// @Tags trades
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param method query string false "Lot matching method: fifo, lifo or average (default: fifo)"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.SyncResult} "Trades synced successfully"
+// @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 401 {object} dto.ErrorResponse "Zerodha session invalid"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/trades/sync-zerodha [post]
+func SyncZerodhaTrades(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		syncBrokerTrades(c, db, data.TradingBrokerZerodha)
+	}
+}
+
+// GetTradeOrderTimeline returns the broker orders behind a trade as a timeline
+// @Summary Trade order timeline
+// @Description Lists the entry order, the exit order and other orders on the symbol while the trade was open (such as stop losses), with every placement, modification, status change and fill in time order, plus modification, cancellation and rejection counts
+// @Tags trades
+// @Produce json
+// @Param id path int true "User ID"
+// @Param trade_id path string true "Trade ID"
+// @Success 200 {object} dto.SuccessResponse{data=brokersync.Timeline} "Order timeline"
+// @Failure 400 {object} dto.ErrorResponse "Trade was not imported from a broker"
+// @Failure 404 {object} dto.ErrorResponse "Trade not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/trades/{trade_id}/orders [get]
+func GetTradeOrderTimeline(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 				Error:   "Invalid Request",
@@ -619,233 +808,30 @@ func SyncDhanTrades(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Get user's Dhan broker configuration
-		userRepo := repos.NewUserRepository(db.GetConnection())
-		user, err := userRepo.GetUserByID(userIDStr)
-		if err != nil {
-			utils.LogError(err, "Failed to get user for sync")
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-				Error:   "Internal Server Error",
-				Message: "Failed to get user",
-				Code:    http.StatusInternalServerError,
-			})
-			return
-		}
-
-		config, exists := user.ConfiguredBrokers["dhan"]
-		if !exists || config.AccessToken == "" {
-			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-				Error:   "Bad Request",
-				Message: "Dhan broker not configured or access token missing. Please configure Dhan first.",
-				Code:    http.StatusBadRequest,
+		timeline, err := brokersync.NewService(db.GetConnection(), db.Keyring()).TradeTimeline(userID, c.Param("trade_id"))
+		if errors.Is(err, brokersync.ErrTradeNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: "Trade not found",
+				Code:    http.StatusNotFound,
 			})
 			return
 		}
-
-		// Get the latest trade date for this user from Dhan broker
-		tradeRepo := repos.NewTradeRepository(db.GetConnection())
-		latestTradeDate, err := tradeRepo.GetLatestTradeDateByBroker(userID, data.TradingBrokerDhan)
 		if err != nil {
-			utils.LogError(err, "Failed to get latest trade date")
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-				Error:   "Internal Server Error",
-				Message: "Failed to get latest trade date",
-				Code:    http.StatusInternalServerError,
-			})
-			return
-		}
-
-		// Determine start date: use latest trade date if exists, otherwise start from Jan 1, 1999
-		var fromDate time.Time
-		if latestTradeDate != nil {
-			// Start from the day after the latest trade date to avoid duplicates
-			fromDate = latestTradeDate.AddDate(0, 0, 1)
-		} else {
-			// First sync: start from Jan 1, 1999 to get all historical trades
-			fromDate = time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC)
-		}
-
-		// End date: current date
-		toDate := time.Now().UTC()
-
-		// Format dates for API
-		fromDateStr := brokers.FormatDateForAPI(fromDate)
-		toDateStr := brokers.FormatDateForAPI(toDate)
-
-		// Check if token is expired
-		if config.ExpiryTime != nil && config.ExpiryTime.Before(time.Now()) {
-			utils.LogError(nil, "Dhan access token expired", map[string]interface{}{
-				"user_id":     userID,
-				"expiry_time": config.ExpiryTime,
+			utils.LogError(err, "Failed to build trade order timeline", map[string]interface{}{
+				"trade_id": c.Param("trade_id"),
 			})
 			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 				Error:   "Bad Request",
-				Message: "Dhan access token has expired. Please renew the token from the Accounts page.",
+				Message: err.Error(),
 				Code:    http.StatusBadRequest,
 			})
 			return
 		}
 
-		utils.LogInfo("Starting Dhan trade sync", map[string]interface{}{
-			"user_id":           userID,
-			"from_date":         fromDateStr,
-			"to_date":           toDateStr,
-			"from_date_iso":     fromDate.Format(time.RFC3339),
-			"to_date_iso":       toDate.Format(time.RFC3339),
-			"has_token":         config.AccessToken != "",
-			"token_length":      len(config.AccessToken),
-			"expiry_time":       config.ExpiryTime,
-			"latest_trade_date": latestTradeDate,
-		})
-
-		// Fetch trades from Dhan API
-		dhanService := brokers.NewDhanService()
-		trades, err := dhanService.FetchAndConvertTrades(config.AccessToken, fromDateStr, toDateStr, userID)
-
-		// If we get an "Invalid Token" error, try to auto-renew the token
-		if err != nil && strings.Contains(err.Error(), "Invalid Token") {
-			utils.LogInfo("Token invalid, attempting auto-renewal", map[string]interface{}{
-				"user_id": userID,
-			})
-
-			// Try to renew the token automatically
-			if config.DhanClientID != nil && *config.DhanClientID != "" {
-				renewResponse, renewErr := dhanService.RenewToken(config.AccessToken, *config.DhanClientID)
-				if renewErr != nil {
-					utils.LogError(renewErr, "Failed to auto-renew token", map[string]interface{}{
-						"user_id": userID,
-					})
-				} else {
-					// Parse expiry time
-					expiryTime, parseErr := time.Parse("2006-01-02T15:04:05", renewResponse.ExpiryTime)
-					if parseErr != nil {
-						expiryTime = time.Now().Add(24 * time.Hour)
-					}
-
-					// Update config with new token
-					config.AccessToken = renewResponse.AccessToken
-					config.ExpiryTime = &expiryTime
-					config.ConfiguredAt = time.Now()
-					user.ConfiguredBrokers["dhan"] = config
-
-					// Save updated config
-					if updateErr := userRepo.UpdateUser(user); updateErr != nil {
-						utils.LogError(updateErr, "Failed to save renewed token", map[string]interface{}{
-							"user_id": userID,
-						})
-					} else {
-						utils.LogInfo("Token auto-renewed successfully", map[string]interface{}{
-							"user_id": userID,
-						})
-
-						// Retry fetching trades with new token
-						trades, err = dhanService.FetchAndConvertTrades(config.AccessToken, fromDateStr, toDateStr, userID)
-						if err == nil {
-							utils.LogInfo("Successfully fetched trades after token renewal", map[string]interface{}{
-								"user_id": userID,
-								"count":   len(trades),
-							})
-						} else {
-							utils.LogError(err, "Failed to fetch trades after token renewal", map[string]interface{}{
-								"user_id": userID,
-							})
-						}
-					}
-				}
-			} else {
-				utils.LogError(nil, "Cannot auto-renew token: Dhan Client ID missing", map[string]interface{}{
-					"user_id": userID,
-				})
-			}
-		}
-
-		if err != nil {
-			utils.LogError(err, "Failed to fetch trades from Dhan")
-			errorMsg := err.Error()
-			if strings.Contains(errorMsg, "Invalid Token") {
-				c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-					Error:   "Unauthorized",
-					Message: "Dhan access token is invalid or expired. Please renew the token from the Accounts page.",
-					Code:    http.StatusUnauthorized,
-				})
-			} else {
-				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-					Error:   "Internal Server Error",
-					Message: "Failed to fetch trades from Dhan: " + errorMsg,
-					Code:    http.StatusInternalServerError,
-				})
-			}
-			return
-		}
-
-		utils.LogInfo("Fetched trades from Dhan", map[string]interface{}{
-			"user_id": userID,
-			"count":   len(trades),
-		})
-
-		// Save trades that don't already exist
-		savedCount := 0
-		skippedCount := 0
-		errorCount := 0
-
-		for _, trade := range trades {
-			// Check if trade already exists by broker ID
-			exchangeOrderID := ""
-			orderID := ""
-			if trade.ExchangeOrderID != nil {
-				exchangeOrderID = *trade.ExchangeOrderID
-			}
-			if trade.OrderID != nil {
-				orderID = *trade.OrderID
-			}
-
-			exists, err := tradeRepo.TradeExistsByBrokerID(userID, data.TradingBrokerDhan, exchangeOrderID, orderID)
-			if err != nil {
-				utils.LogError(err, "Failed to check if trade exists", map[string]interface{}{
-					"exchange_order_id": exchangeOrderID,
-					"order_id":          orderID,
-				})
-				errorCount++
-				continue
-			}
-
-			if exists {
-				skippedCount++
-				continue
-			}
-
-			// Save new trade
-			if err := tradeRepo.CreateTrade(trade); err != nil {
-				utils.LogError(err, "Failed to save trade", map[string]interface{}{
-					"exchange_order_id": exchangeOrderID,
-					"order_id":          orderID,
-				})
-				errorCount++
-				continue
-			}
-
-			savedCount++
-		}
-
-		utils.LogInfo("Completed Dhan trade sync", map[string]interface{}{
-			"user_id":       userID,
-			"saved_count":   savedCount,
-			"skipped_count": skippedCount,
-			"error_count":   errorCount,
-			"total_fetched": len(trades),
-		})
-
 		c.JSON(http.StatusOK, dto.SuccessResponse{
-			Message: fmt.Sprintf("Sync completed. Saved %d new trades, skipped %d existing trades", savedCount, skippedCount),
-			Data: map[string]interface{}{
-				"saved_count":   savedCount,
-				"skipped_count": skippedCount,
-				"error_count":   errorCount,
-				"total_fetched": len(trades),
-				"from_date":     fromDateStr,
-				"to_date":       toDateStr,
-				"date_range":    fmt.Sprintf("%s to %s", fromDateStr, toDateStr),
-			},
+			Message: "Order timeline retrieved successfully",
+			Data:    timeline,
 		})
 	}
 }
@@ -58,7 +58,7 @@ func CreateUser(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Create user in database
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		if err := repo.CreateUser(user); err != nil {
 			utils.LogError(err, "Failed to create user")
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -107,7 +107,7 @@ func GetUser(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		user, err := repo.GetUserByID(userID)
 		if err != nil {
 			utils.LogError(err, "Failed to get user", map[string]interface{}{
@@ -186,7 +186,7 @@ func UpdateUser(db *data.DB) gin.HandlerFunc {
 		}
 
 		// Update user in database
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		if err := repo.UpdateUser(user); err != nil {
 			utils.LogError(err, "Failed to update user", map[string]interface{}{
 				"user_id": userID,
@@ -250,7 +250,7 @@ func DeleteUser(db *data.DB) gin.HandlerFunc {
 			return
 		}
 
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		if err := repo.DeleteUser(userID); err != nil {
 			utils.LogError(err, "Failed to delete user", map[string]interface{}{
 				"user_id": userID,
@@ -301,7 +301,7 @@ func ListUsers(db *data.DB) gin.HandlerFunc {
 			offset = 0
 		}
 
-		repo := repos.NewUserRepository(db.GetConnection())
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
 		users, total, err := repo.GetUsers(limit, offset)
 		if err != nil {
 			utils.LogError(err, "Failed to list users")
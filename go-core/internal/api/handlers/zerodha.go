@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-core/internal/api/dto"
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/tokens"
+	"go-core/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	// errZerodhaCredentialsMissing is returned when a login is attempted before the API key and secret are saved
+	errZerodhaCredentialsMissing = errors.New("API key and secret not configured. Please save credentials first.")
+	// errZerodhaLoginState is returned when a login callback does not carry the state of the user's pending login
+	errZerodhaLoginState = errors.New("login state does not match. Please start the login again.")
+)
+
+// SaveZerodhaCredentials saves the Kite Connect API key and secret
+// @Summary Save Zerodha API credentials
+// @Description Saves the Kite Connect API key and secret for a user. Any existing session is kept until it expires.
+// @Tags zerodha
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body dto.ZerodhaSaveCredentialsRequest true "Save credentials request"
+// @Success 200 {object} dto.SuccessResponse{data=dto.ZerodhaBrokerConfigResponse} "Credentials saved successfully"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request data"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/zerodha/save-credentials [post]
+func SaveZerodhaCredentials(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		_, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var req dto.ZerodhaSaveCredentialsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.LogError(err, "Failed to bind save credentials request")
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		// Validate request
+		validate := validator.New()
+		if err := validate.Struct(req); err != nil {
+			utils.LogError(err, "Validation failed for save credentials request")
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := repo.GetUserByID(userIDStr)
+		if err != nil {
+			utils.LogError(err, "Failed to get user")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get user",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		// Update or create Zerodha config
+		config := user.ConfiguredBrokers[string(data.TradingBrokerZerodha)]
+		config.APIKey = &req.APIKey
+		config.APISecret = &req.APISecret
+		config.ConfiguredAt = time.Now()
+
+		if err := repo.UpdateUserBrokerConfig(user.ID, string(data.TradingBrokerZerodha), config); err != nil {
+			utils.LogError(err, "Failed to update user broker config")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to save broker configuration",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Credentials saved successfully",
+			Data: dto.ZerodhaBrokerConfigResponse{
+				Configured:     config.AccessToken != "",
+				HasCredentials: true,
+			},
+		})
+	}
+}
+
+// GetZerodhaLoginURL returns the Kite Connect login URL for the user's API key
+// @Summary Get Zerodha login URL
+// @Description Returns the Kite Connect login URL. After login Kite redirects to the app's registered redirect URL with a request_token; the user ID and a one-time login state are passed back through redirect_params. Requesting a new URL replaces the pending login.
+// @Tags zerodha
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=dto.ZerodhaLoginURLResponse} "Login URL generated successfully"
+// @Failure 400 {object} dto.ErrorResponse "Credentials missing"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/zerodha/login-url [get]
+func GetZerodhaLoginURL(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		_, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := repo.GetUserByID(userIDStr)
+		if err != nil {
+			utils.LogError(err, "Failed to get user")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get user",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		config, exists := user.ConfiguredBrokers[string(data.TradingBrokerZerodha)]
+		if !exists || config.APIKey == nil || config.APISecret == nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: errZerodhaCredentialsMissing.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		// The callback only accepts the state of the latest login, so a redirect cannot be
+		// replayed or forged to attach another Kite account to this user
+		state, err := newZerodhaLoginState()
+		if err != nil {
+			utils.LogError(err, "Failed to generate Zerodha login state")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to start login",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		config.ZerodhaLoginState = &state
+		if err := repo.UpdateUserBrokerConfig(user.ID, string(data.TradingBrokerZerodha), config); err != nil {
+			utils.LogError(err, "Failed to save Zerodha login state")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to start login",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		// Kite hands redirect_params back to the redirect URL, which lets the callback find the user
+		redirectParams := url.Values{}
+		redirectParams.Set("userId", userIDStr)
+		redirectParams.Set("state", state)
+		loginURL := brokers.NewZerodhaService().LoginURL(*config.APIKey, redirectParams)
+
+		// Build callback URL for the Kite Connect app's redirect configuration
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		host := c.Request.Host
+		if host == "" {
+			host = "localhost:8080" // Default for local development
+		}
+		callbackURL := fmt.Sprintf("%s://%s/api/v1/zerodha/callback", scheme, host)
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Login URL generated successfully",
+			Data: dto.ZerodhaLoginURLResponse{
+				LoginURL:    loginURL,
+				CallbackURL: callbackURL,
+			},
+		})
+	}
+}
+
+// CreateZerodhaSession exchanges a request_token for an access token and saves the session
+// @Summary Create Zerodha session
+// @Description Exchanges the request_token from the Kite login redirect for an access token (signed with the SHA-256 checksum of API key, request token and API secret) and saves it. The session expires at 6 AM IST the next day.
+// @Tags zerodha
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body dto.ZerodhaCreateSessionRequest true "Create session request"
+// @Success 200 {object} dto.SuccessResponse{data=dto.ZerodhaSessionResponse} "Session created successfully"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request data"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/zerodha/session [post]
+func CreateZerodhaSession(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		_, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		var req dto.ZerodhaCreateSessionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.LogError(err, "Failed to bind create session request")
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid JSON data",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		// Validate request
+		validate := validator.New()
+		if err := validate.Struct(req); err != nil {
+			utils.LogError(err, "Validation failed for create session request")
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Validation Error",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		config, err := createZerodhaSession(c.Request.Context(), db, userIDStr, req.RequestToken, nil)
+		if err != nil {
+			if errors.Is(err, errZerodhaCredentialsMissing) {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+					Error:   "Bad Request",
+					Message: err.Error(),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to create session: " + err.Error(),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Session created successfully",
+			Data: dto.ZerodhaSessionResponse{
+				ZerodhaUserID:   getStringValue(config.ZerodhaUserID),
+				ZerodhaUserName: getStringValue(config.ZerodhaUserName),
+				ExpiryTime:      config.ExpiryTime.Format(time.RFC3339),
+			},
+		})
+	}
+}
+
+// ZerodhaLoginCallback is the redirect URL endpoint for Kite Connect logins
+// Kite redirects here with request_token and status, plus the userId and state passed through redirect_params
+// @Summary Zerodha login callback
+// @Description Redirect URL for the Kite Connect app. Exchanges the request_token for a session and returns an HTML page with the result.
+// @Tags zerodha
+// @Accept html
+// @Produce html
+// @Param request_token query string true "Request token from the Kite login redirect"
+// @Param status query string false "Login status from Kite"
+// @Param userId query int true "User ID"
+// @Param state query string true "Login state from the login URL"
+// @Success 200 {string} string "HTML success page"
+// @Failure 400 {string} string "Bad request"
+// @Failure 500 {string} string "Internal server error"
+// @Router /api/v1/zerodha/callback [get]
+func ZerodhaLoginCallback(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status := c.Query("status"); status != "" && status != "success" {
+			renderZerodhaCallbackPage(c, http.StatusBadRequest, "Authentication Failed", "Kite login was not completed (status: "+status+")")
+			return
+		}
+
+		requestToken := c.Query("request_token")
+		if requestToken == "" {
+			renderZerodhaCallbackPage(c, http.StatusBadRequest, "Authentication Failed", "Missing request_token parameter")
+			return
+		}
+
+		userIDStr := c.Query("userId")
+		if _, err := strconv.Atoi(userIDStr); err != nil {
+			renderZerodhaCallbackPage(c, http.StatusBadRequest, "Authentication Failed", "Missing or invalid userId parameter")
+			return
+		}
+
+		state := c.Query("state")
+		config, err := createZerodhaSession(c.Request.Context(), db, userIDStr, requestToken, &state)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errZerodhaCredentialsMissing) || errors.Is(err, errZerodhaLoginState) {
+				status = http.StatusBadRequest
+			}
+			renderZerodhaCallbackPage(c, status, "Authentication Failed", "Failed to create session: "+err.Error())
+			return
+		}
+
+		renderZerodhaCallbackPage(c, http.StatusOK, "Authentication Successful!", fmt.Sprintf(
+			"Your Zerodha account %s (%s) has been connected. The session expires at %s IST.",
+			getStringValue(config.ZerodhaUserName),
+			getStringValue(config.ZerodhaUserID),
+			config.ExpiryTime.In(utils.IST).Format("02 Jan 2006 15:04"),
+		))
+	}
+}
+
+// GetZerodhaBrokerConfig gets the Zerodha broker configuration for a user
+// @Summary Get Zerodha broker configuration
+// @Description Gets the Zerodha broker configuration for a user. A session past its expiry is reported as not configured.
+// @Tags zerodha
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} dto.SuccessResponse{data=dto.ZerodhaBrokerConfigResponse} "Broker configuration retrieved successfully"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request data"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /api/v1/users/{id}/zerodha/config [get]
+func GetZerodhaBrokerConfig(db *data.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("id")
+		_, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "Invalid user ID",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+		user, err := repo.GetUserByID(userIDStr)
+		if err != nil {
+			utils.LogError(err, "Failed to get user")
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to get user",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+
+		config, exists := user.ConfiguredBrokers[string(data.TradingBrokerZerodha)]
+		health := tokens.CheckUser(user, data.TradingBrokerZerodha, time.Now())
+		response := dto.ZerodhaBrokerConfigResponse{
+			HasCredentials:     exists && config.APIKey != nil && config.APISecret != nil,
+			TokenStatus:        string(health.State),
+			TokenStatusMessage: health.Message,
+		}
+		if exists && config.AccessToken != "" {
+			response.Configured = config.ExpiryTime == nil || config.ExpiryTime.After(time.Now())
+			response.ZerodhaUserID = getStringValue(config.ZerodhaUserID)
+			response.ZerodhaUserName = getStringValue(config.ZerodhaUserName)
+			if config.ExpiryTime != nil {
+				response.ExpiryTime = config.ExpiryTime.Format(time.RFC3339)
+			}
+		}
+
+		c.JSON(http.StatusOK, dto.SuccessResponse{
+			Message: "Broker configuration retrieved successfully",
+			Data:    response,
+		})
+	}
+}
+
+// createZerodhaSession completes a Kite login for the user and persists the session
+// state is the login state a redirect carried back; nil skips the check for API calls made for the user.
+// A successful login clears the pending state, so it cannot be used again.
+func createZerodhaSession(ctx context.Context, db *data.DB, userIDStr, requestToken string, state *string) (*data.BrokerConfig, error) {
+	repo := repos.NewUserRepository(db.GetConnection(), db.Keyring())
+	user, err := repo.GetUserByID(userIDStr)
+	if err != nil {
+		utils.LogError(err, "Failed to get user")
+		return nil, fmt.Errorf("failed to get user")
+	}
+
+	config, exists := user.ConfiguredBrokers[string(data.TradingBrokerZerodha)]
+	if !exists || config.APIKey == nil || config.APISecret == nil {
+		return nil, errZerodhaCredentialsMissing
+	}
+	if state != nil {
+		pending := getStringValue(config.ZerodhaLoginState)
+		if pending == "" || subtle.ConstantTimeCompare([]byte(pending), []byte(*state)) != 1 {
+			utils.LogWarn("Rejected Zerodha callback with a wrong login state", map[string]interface{}{
+				"user_id": user.ID,
+			})
+			return nil, errZerodhaLoginState
+		}
+	}
+	config.ZerodhaLoginState = nil
+
+	zerodhaService := brokers.NewZerodhaService()
+	if err := zerodhaService.CompleteAuth(ctx, &config, map[string]string{"request_token": requestToken}); err != nil {
+		utils.LogError(err, "Failed to create Zerodha session", map[string]interface{}{
+			"user_id": user.ID,
+		})
+		return nil, err
+	}
+
+	if err := repo.UpdateUserBrokerConfig(user.ID, string(data.TradingBrokerZerodha), config); err != nil {
+		utils.LogError(err, "Failed to update user broker config")
+		return nil, fmt.Errorf("failed to save broker configuration")
+	}
+
+	utils.LogInfo("Zerodha session created", map[string]interface{}{
+		"user_id":         user.ID,
+		"zerodha_user_id": getStringValue(config.ZerodhaUserID),
+		"expiry_time":     config.ExpiryTime,
+	})
+
+	return &config, nil
+}
+
+// newZerodhaLoginState returns a random state for a Kite login
+func newZerodhaLoginState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// renderZerodhaCallbackPage renders the HTML page shown in the login window after the Kite redirect
+func renderZerodhaCallbackPage(c *gin.Context, statusCode int, title, message string) {
+	color := "#10b981"
+	if statusCode != http.StatusOK {
+		color = "#ef4444"
+	}
+
+	page := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Zerodha Authentication</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            display: flex;
+            justify-content: center;
+            align-items: center;
+            min-height: 100vh;
+            margin: 0;
+            background: #f3f4f6;
+        }
+        .container {
+            background: white;
+            padding: 2rem;
+            border-radius: 12px;
+            border-top: 6px solid ` + color + `;
+            box-shadow: 0 10px 40px rgba(0,0,0,0.2);
+            text-align: center;
+            max-width: 500px;
+        }
+        h1 {
+            color: #1f2937;
+            margin: 0 0 0.5rem 0;
+        }
+        p {
+            color: #6b7280;
+            margin: 0.5rem 0;
+        }
+        .close-btn {
+            background: ` + color + `;
+            color: white;
+            border: none;
+            padding: 0.75rem 2rem;
+            border-radius: 6px;
+            font-size: 1rem;
+            cursor: pointer;
+            margin-top: 1rem;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>` + html.EscapeString(title) + `</h1>
+        <p>` + html.EscapeString(message) + `</p>
+        <p style="font-size: 0.9rem; color: #9ca3af;">You can close this window and return to the application.</p>
+        <button class="close-btn" onclick="window.close()">Close Window</button>
+    </div>
+</body>
+</html>`
+
+	c.Data(statusCode, "text/html; charset=utf-8", []byte(page))
+}
@@ -17,13 +17,17 @@
 package api
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"go-core/internal/api/dto"
 	"go-core/internal/api/handlers"
 	"go-core/internal/api/middleware"
 	"go-core/internal/data"
+	"go-core/internal/services/syncjobs"
 	"go-core/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -35,10 +39,12 @@ import (
 type Server struct {
 	router *gin.Engine
 	db     *data.DB
+	jobs   *syncjobs.Runner
 }
 
 // NewServer creates a new API server
-func NewServer(db *data.DB) *Server {
+// jobs executes background broker syncs and must be started by the caller
+func NewServer(db *data.DB, jobs *syncjobs.Runner) *Server {
 	// Set Gin mode based on environment
 	if utils.GetLogger().Level.String() == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -51,6 +57,7 @@ func NewServer(db *data.DB) *Server {
 	server := &Server{
 		router: router,
 		db:     db,
+		jobs:   jobs,
 	}
 
 	server.setupMiddleware()
@@ -103,6 +110,60 @@ func (s *Server) setupRoutes() {
 		// Dhan OAuth callback webhook (separate route, accepts tokenId and userId as query params)
 		v1.GET("/dhan/consent-callback", handlers.ConsumeDhanConsentCallback(s.db))
 
+		// Zerodha Kite Connect routes
+		zerodha := v1.Group("/users/:id/zerodha")
+		{
+			zerodha.POST("/save-credentials", handlers.SaveZerodhaCredentials(s.db)) // Save API key & secret
+			zerodha.GET("/login-url", handlers.GetZerodhaLoginURL(s.db))             // Step 1: Kite login URL
+			zerodha.POST("/session", handlers.CreateZerodhaSession(s.db))            // Step 3: Exchange request_token
+			zerodha.GET("/config", handlers.GetZerodhaBrokerConfig(s.db))
+		}
+
+		// Kite Connect redirect URL (accepts request_token and userId as query params)
+		v1.GET("/zerodha/callback", handlers.ZerodhaLoginCallback(s.db))
+
+		// Broker connector routes, shared by every supported broker
+		v1.GET("/brokers", handlers.ListBrokers()) // Supported brokers and capabilities
+		userBrokers := v1.Group("/users/:id/brokers/:broker")
+		{
+			userBrokers.POST("/auth/start", handlers.StartBrokerAuth(s.db))                 // Start broker login
+			userBrokers.POST("/auth/complete", handlers.CompleteBrokerAuth(s.db))           // Complete login with redirect params
+			userBrokers.POST("/refresh-token", handlers.RefreshBrokerToken(s.db))           // Renew access token
+			userBrokers.GET("/status", handlers.GetBrokerStatus(s.db))                      // Credential health
+			userBrokers.POST("/sync", handlers.SyncBrokerTrades(s.db))                      // Sync new fills into the journal
+			userBrokers.POST("/reconcile", handlers.ReconcileBrokerTrades(s.db))            // Re-sync a window and diff against stored fills
+			userBrokers.GET("/positions", handlers.GetBrokerPositions(s.db))                // Live open positions
+			userBrokers.GET("/holdings", handlers.GetBrokerHoldings(s.db))                  // Live demat holdings
+			userBrokers.GET("/funds", handlers.GetBrokerFunds(s.db))                        // Live account balance
+			userBrokers.GET("/portfolio", handlers.GetBrokerPortfolio(s.db))                // Stored snapshot with journal discrepancies
+			userBrokers.POST("/portfolio/sync", handlers.SyncBrokerPortfolio(s.db))         // Refresh positions and holdings snapshot
+			userBrokers.GET("/orders", handlers.ListBrokerOrders(s.db))                     // Recorded orders with status transitions
+			userBrokers.POST("/orders/sync", handlers.SyncBrokerOrders(s.db))               // Record the day's order book
+			userBrokers.POST("/sync-runs", handlers.QueueBrokerSync(s.jobs))                // Queue a background sync
+			userBrokers.GET("/sync-runs", handlers.ListBrokerSyncRuns(s.jobs))              // Background sync history
+			userBrokers.GET("/sync-runs/:run_id", handlers.GetBrokerSyncRun(s.jobs))        // Background sync progress
+			userBrokers.GET("/sync-schedule", handlers.GetBrokerSyncSchedule(s.jobs))       // Background sync schedule
+			userBrokers.PUT("/sync-schedule", handlers.SaveBrokerSyncSchedule(s.jobs))      // Sync daily at a time of day in IST
+			userBrokers.DELETE("/sync-schedule", handlers.DeleteBrokerSyncSchedule(s.jobs)) // Stop scheduled syncs
+		}
+
+		// Instrument master shared by all users
+		instruments := v1.Group("/instruments")
+		{
+			instruments.GET("", handlers.SearchInstruments(s.db))                 // Search by symbol, name or ISIN
+			instruments.GET("/resolve", handlers.ResolveInstrument(s.db))         // Canonical instrument of a broker reference
+			instruments.POST("/:broker/import", handlers.ImportInstruments(s.db)) // Load a broker's instrument dump
+		}
+
+		// Candle store shared by all users
+		candles := v1.Group("/candles")
+		{
+			candles.GET("", handlers.GetCandles(s.db))                     // Bars of a symbol and timeframe
+			candles.GET("/series", handlers.GetCandleSeries(s.db))         // Stored symbols and timeframes
+			candles.GET("/indicators", handlers.GetCandleIndicators(s.db)) // Indicators over a range of bars
+			candles.POST("/import", handlers.ImportCandles(s.db))          // Load bars from a CSV and resample them
+		}
+
 		// Trade routes
 		trades := v1.Group("/trades")
 		{
@@ -117,7 +178,29 @@ func (s *Server) setupRoutes() {
 		// User-specific trade routes (use :id to match other user routes)
 		userTrades := v1.Group("/users/:id/trades")
 		{
-			userTrades.POST("/sync-dhan", handlers.SyncDhanTrades(s.db)) // Sync Dhan trades
+			userTrades.POST("/sync-dhan", handlers.SyncDhanTrades(s.db))              // Sync Dhan trades
+			userTrades.POST("/sync-zerodha", handlers.SyncZerodhaTrades(s.db))        // Sync today's Zerodha trades
+			userTrades.POST("/reconcile-dhan", handlers.ReconcileDhanTrades(s.db))    // Re-sync a window and diff against stored fills
+			userTrades.GET("/:trade_id/orders", handlers.GetTradeOrderTimeline(s.db)) // Broker order timeline behind a trade
+		}
+
+		// User-specific export routes
+		userExport := v1.Group("/users/:id/export")
+		{
+			userExport.GET("", handlers.ExportJournal(s.db)) // Export journal as CSV, JSON or XLSX
+		}
+
+		// User-specific backup and restore routes
+		userBackup := v1.Group("/users/:id")
+		{
+			userBackup.GET("/backup", handlers.BackupJournal(s.db))    // Download portable backup archive
+			userBackup.POST("/restore", handlers.RestoreJournal(s.db)) // Restore backup archive (merge or replace)
+		}
+
+		// User-specific tax report routes
+		userTax := v1.Group("/users/:id/tax-report")
+		{
+			userTax.GET("", handlers.GetTaxReport(s.db)) // Indian tax report for a financial year
 		}
 
 		// Strategy routes
@@ -147,9 +230,26 @@ func (s *Server) setupRoutes() {
 		algorithms := v1.Group("/algorithms")
 		{
 			algorithms.POST("", handlers.CreateAlgorithm(s.db))
+			algorithms.POST("/validate", handlers.ValidateAlgorithm())
+			algorithms.POST("/graph/compile", handlers.CompileAlgorithmGraph())
 			algorithms.GET("/:id", handlers.GetAlgorithm(s.db))
 			algorithms.PUT("/:id", handlers.UpdateAlgorithm(s.db))
 			algorithms.DELETE("/:id", handlers.DeleteAlgorithm(s.db))
+			algorithms.POST("/:id/evaluate", handlers.EvaluateAlgorithm(s.db))
+			algorithms.GET("/:id/schedule", handlers.GetAlgorithmSchedule(s.db))
+			algorithms.GET("/:id/runs", handlers.GetAlgorithmRuns(s.db))
+			algorithms.GET("/:id/runs/stream", handlers.StreamAlgorithmRuns(s.db))
+			algorithms.GET("/:id/runs/:run_id", handlers.GetAlgorithmRun(s.db))
+			algorithms.GET("/:id/versions", handlers.GetAlgorithmVersions(s.db))
+			algorithms.GET("/:id/versions/diff", handlers.DiffAlgorithmVersions(s.db))
+			algorithms.GET("/:id/versions/:version", handlers.GetAlgorithmVersion(s.db))
+			algorithms.POST("/:id/versions/:version/rollback", handlers.RollbackAlgorithm(s.db))
+			algorithms.POST("/:id/backtests", handlers.RunBacktest(s.db))
+			algorithms.GET("/:id/backtests", handlers.GetBacktests(s.db))
+			algorithms.GET("/:id/backtests/:backtest_id", handlers.GetBacktest(s.db))
+			algorithms.GET("/:id/paper", handlers.GetPaperAccount(s.db))
+			algorithms.PUT("/:id/paper", handlers.ConfigurePaperAccount(s.db))
+			algorithms.POST("/:id/paper/advance", handlers.AdvancePaperTrading(s.db))
 		}
 
 		// User-specific algorithm routes (use :id to match other user routes)
@@ -203,14 +303,57 @@ func (s *Server) healthCheck(c *gin.Context) {
 	})
 }
 
-// Run starts the server
-func (s *Server) Run(addr string) error {
+// defaultShutdownTimeout is how long Run waits for requests in flight unless SHUTDOWN_TIMEOUT says otherwise
+const defaultShutdownTimeout = 5 * time.Second
+
+// Run serves the API on addr until ctx is done, then shuts the server down gracefully
+// It stops accepting connections and waits for the requests in flight to finish for up to
+// SHUTDOWN_TIMEOUT, a Go duration, default 5s; requests still running after it are cancelled.
+func (s *Server) Run(ctx context.Context, addr string) error {
 	utils.LogInfo("Starting API server", map[string]interface{}{
 		"address": addr,
 		"mode":    gin.Mode(),
 	})
 
-	return s.router.Run(addr)
+	requests, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     s.router,
+		BaseContext: func(net.Listener) context.Context { return requests },
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := defaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			timeout = d
+		}
+	}
+	utils.LogInfo("Shutting down API server", map[string]interface{}{
+		"timeout": timeout.String(),
+	})
+
+	shutdown, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		// Cancel what is still running, such as run streams, and close its connections
+		cancelRequests()
+		server.Close()
+		utils.LogWarn("API server shut down before every request finished", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return nil
 }
 
 // GetRouter returns the router for testing
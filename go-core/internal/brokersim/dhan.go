@@ -0,0 +1,236 @@
+package brokersim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// dhanExpiryLayout is how Dhan formats token expiry times
+const dhanExpiryLayout = "2006-01-02T15:04:05"
+
+// dhanUnauthorized answers like Dhan does when the access token is missing, expired or revoked
+func dhanUnauthorized(w http.ResponseWriter) {
+	writeJSON(w, http.StatusUnauthorized, map[string]string{
+		"errorType":    "Invalid_Authentication",
+		"errorCode":    "DH-901",
+		"errorMessage": "Client ID or user generated access token is invalid or expired.",
+	})
+}
+
+// dhanAuthorized reports whether the request carries the current Dhan access token
+// It answers the request itself when it does not.
+func (s *Simulator) dhanAuthorized(w http.ResponseWriter, r *http.Request) (*DhanFixture, bool) {
+	s.mu.Lock()
+	fixture, token := s.fixtures.Dhan, s.dhanToken
+	s.mu.Unlock()
+
+	if fixture == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"errorMessage": "no Dhan fixture loaded"})
+		return nil, false
+	}
+	if token == "" || r.Header.Get("access-token") != token {
+		dhanUnauthorized(w)
+		return nil, false
+	}
+	return fixture, true
+}
+
+// dhanApp reports whether the request carries the fixture's app_id and app_secret
+func (s *Simulator) dhanApp(w http.ResponseWriter, r *http.Request) (*DhanFixture, bool) {
+	fixture := s.fixtures.Dhan
+	if fixture == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"errorMessage": "no Dhan fixture loaded"})
+		return nil, false
+	}
+	if r.Header.Get("app_id") != fixture.AppID || r.Header.Get("app_secret") != fixture.AppSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"errorType":    "Invalid_Authentication",
+			"errorCode":    "DH-901",
+			"errorMessage": "Invalid app_id or app_secret.",
+		})
+		return nil, false
+	}
+	return fixture, true
+}
+
+// dhanRows serves a fixture value to requests with a valid access token
+func (s *Simulator) dhanRows(value func(*DhanFixture) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := s.dhanAuthorized(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, value(fixture))
+	}
+}
+
+// dhanTrades handles GET /trades/{from}/{to}/{page}: trades with an exchangeTime date in
+// the range, page by page, with an empty page after the last one
+func (s *Simulator) dhanTrades(w http.ResponseWriter, r *http.Request) {
+	fixture, ok := s.dhanAuthorized(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := r.PathValue("from"), r.PathValue("to")
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil || page < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"errorType":    "Input_Exception",
+			"errorCode":    "DH-905",
+			"errorMessage": "Invalid page number",
+		})
+		return
+	}
+
+	matching := make([]json.RawMessage, 0)
+	for _, raw := range fixture.Trades {
+		var trade struct {
+			ExchangeTime string `json:"exchangeTime"`
+		}
+		if err := json.Unmarshal(raw, &trade); err != nil || len(trade.ExchangeTime) < 10 {
+			continue
+		}
+		if date := trade.ExchangeTime[:10]; date >= from && date <= to {
+			matching = append(matching, raw)
+		}
+	}
+
+	pageSize := fixture.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	start := min(page*pageSize, len(matching))
+	end := min(start+pageSize, len(matching))
+	writeJSON(w, http.StatusOK, matching[start:end])
+}
+
+// dhanRenewToken handles GET /RenewToken: a new token valid for 24 hours replaces the current one
+func (s *Simulator) dhanRenewToken(w http.ResponseWriter, r *http.Request) {
+	fixture, ok := s.dhanAuthorized(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("dhanClientId") != fixture.ClientID {
+		dhanUnauthorized(w)
+		return
+	}
+
+	s.mu.Lock()
+	s.dhanToken = s.nextID("dhan-token")
+	token := s.dhanToken
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":      "success",
+		"accessToken": token,
+		"expiryTime":  time.Now().UTC().Add(24 * time.Hour).Format(dhanExpiryLayout),
+	})
+}
+
+// dhanGenerateConsent handles POST /app/generate-consent?client_id=
+func (s *Simulator) dhanGenerateConsent(w http.ResponseWriter, r *http.Request) {
+	fixture, ok := s.dhanApp(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("client_id") != fixture.ClientID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"errorType":    "Input_Exception",
+			"errorCode":    "DH-905",
+			"errorMessage": "Invalid client_id",
+		})
+		return
+	}
+
+	s.mu.Lock()
+	consentAppID := s.nextID("consent")
+	s.consents[consentAppID] = true
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"consentAppId":     consentAppID,
+		"consentAppStatus": "GENERATED",
+		"status":           "success",
+	})
+}
+
+// dhanLogin handles the browser login page GET /login/consentApp-login?consentAppId=
+// The user is taken to be signed in at once: with a redirect URL configured the browser is
+// sent there with a tokenId, otherwise the tokenId is returned as JSON.
+func (s *Simulator) dhanLogin(w http.ResponseWriter, r *http.Request) {
+	fixture := s.fixtures.Dhan
+	if fixture == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"errorMessage": "no Dhan fixture loaded"})
+		return
+	}
+
+	s.mu.Lock()
+	consentAppID := r.URL.Query().Get("consentAppId")
+	if !s.consents[consentAppID] {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorMessage": "Invalid or expired consentAppId"})
+		return
+	}
+	delete(s.consents, consentAppID)
+	tokenID := s.nextID("token-id")
+	s.tokenIDs[tokenID] = true
+	s.mu.Unlock()
+
+	if fixture.RedirectURL != "" {
+		http.Redirect(w, r, withQuery(fixture.RedirectURL, url.Values{"tokenId": {tokenID}}), http.StatusFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"tokenId": tokenID})
+}
+
+// dhanConsumeConsent handles GET /app/consumeApp-consent?tokenId=: a tokenId is exchanged
+// once for a new access token
+func (s *Simulator) dhanConsumeConsent(w http.ResponseWriter, r *http.Request) {
+	fixture, ok := s.dhanApp(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	tokenID := r.URL.Query().Get("tokenId")
+	if !s.tokenIDs[tokenID] {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"errorType":    "Input_Exception",
+			"errorCode":    "DH-905",
+			"errorMessage": "Invalid or expired tokenId",
+		})
+		return
+	}
+	delete(s.tokenIDs, tokenID)
+	s.dhanToken = s.nextID("dhan-token")
+	token := s.dhanToken
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dhanClientId":         fixture.ClientID,
+		"dhanClientName":       fixture.ClientName,
+		"dhanClientUcc":        fixture.ClientUcc,
+		"givenPowerOfAttorney": true,
+		"accessToken":          token,
+		"expiryTime":           time.Now().UTC().Add(24 * time.Hour).Format(dhanExpiryLayout),
+	})
+}
+
+// withQuery appends query parameters to a URL that may already have some
+func withQuery(rawURL string, params url.Values) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
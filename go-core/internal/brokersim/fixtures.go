@@ -0,0 +1,92 @@
+package brokersim
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var embedded embed.FS
+
+// Fixtures is the account data the simulator serves, in each broker's own wire format
+// Rows are passed through as they are, so a fixture can be a captured broker response.
+type Fixtures struct {
+	Dhan    *DhanFixture    `json:"dhan,omitempty"`
+	Zerodha *ZerodhaFixture `json:"zerodha,omitempty"`
+}
+
+// DhanFixture is a Dhan account: app credentials, the client it logs in as, and v2 API rows
+type DhanFixture struct {
+	AppID       string `json:"app_id"`
+	AppSecret   string `json:"app_secret"`
+	ClientID    string `json:"client_id"`
+	ClientName  string `json:"client_name"`
+	ClientUcc   string `json:"client_ucc"`
+	AccessToken string `json:"access_token"` // valid from the start; empty until a consent is consumed
+	RedirectURL string `json:"redirect_url"` // where login redirects with tokenId; without it login answers with JSON
+	PageSize    int    `json:"page_size"`    // trades per page of /trades (default 100)
+
+	Trades    []json.RawMessage `json:"trades"` // filtered by the date of exchangeTime
+	Positions []json.RawMessage `json:"positions"`
+	Holdings  []json.RawMessage `json:"holdings"`
+	FundLimit json.RawMessage   `json:"fund_limit"`
+	Orders    []json.RawMessage `json:"orders"`
+}
+
+// ZerodhaFixture is a Kite Connect account: app credentials, the user it logs in as, and API rows
+type ZerodhaFixture struct {
+	APIKey      string `json:"api_key"`
+	APISecret   string `json:"api_secret"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	AccessToken string `json:"access_token"` // valid from the start; empty until a session is created
+	RedirectURL string `json:"redirect_url"` // where login redirects with request_token; without it login answers with JSON
+
+	Trades       []json.RawMessage            `json:"trades"`
+	Positions    []json.RawMessage            `json:"positions"` // served as the net positions
+	Holdings     []json.RawMessage            `json:"holdings"`
+	Margins      json.RawMessage              `json:"margins"`
+	Orders       []json.RawMessage            `json:"orders"`
+	OrderHistory map[string][]json.RawMessage `json:"order_history"` // by order ID
+}
+
+// datePlaceholder matches {{today}}, {{today-N}} and {{today+N}} in fixture files
+var datePlaceholder = regexp.MustCompile(`\{\{today([+-]\d+)?\}\}`)
+
+// ParseFixtures decodes fixtures, replacing date placeholders with UTC dates relative to now
+// Kite only serves the current day's trades, so fixtures meant to be synced use {{today}}.
+func ParseFixtures(raw []byte) (Fixtures, error) {
+	today := time.Now().UTC()
+	expanded := datePlaceholder.ReplaceAllFunc(raw, func(match []byte) []byte {
+		days := 0
+		if offset := datePlaceholder.FindSubmatch(match)[1]; len(offset) > 0 {
+			days, _ = strconv.Atoi(string(offset))
+		}
+		return []byte(today.AddDate(0, 0, days).Format("2006-01-02"))
+	})
+
+	var fixtures Fixtures
+	if err := json.Unmarshal(expanded, &fixtures); err != nil {
+		return Fixtures{}, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+	return fixtures, nil
+}
+
+// LoadFixtures reads fixtures from a file, or from the fixtures built into the simulator
+// when name is not a file (for example "default")
+func LoadFixtures(name string) (Fixtures, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		var embeddedErr error
+		raw, embeddedErr = embedded.ReadFile("fixtures/" + name + ".json")
+		if embeddedErr != nil {
+			return Fixtures{}, fmt.Errorf("failed to read fixtures %s: %w", name, err)
+		}
+	}
+	return ParseFixtures(raw)
+}
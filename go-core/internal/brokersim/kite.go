@@ -0,0 +1,138 @@
+package brokersim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// kiteError answers with Kite's error envelope
+func kiteError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]string{
+		"status":     "error",
+		"message":    message,
+		"error_type": errorType,
+	})
+}
+
+// kiteAuthorized reports whether the request carries "token api_key:access_token" for the
+// current Kite session, answering the request itself when it does not
+func (s *Simulator) kiteAuthorized(w http.ResponseWriter, r *http.Request) (*ZerodhaFixture, bool) {
+	s.mu.Lock()
+	fixture, token := s.fixtures.Zerodha, s.kiteToken
+	s.mu.Unlock()
+
+	if fixture == nil {
+		kiteError(w, http.StatusNotFound, "GeneralException", "No Kite fixture loaded")
+		return nil, false
+	}
+	if token == "" || r.Header.Get("Authorization") != "token "+fixture.APIKey+":"+token {
+		kiteError(w, http.StatusForbidden, "TokenException", "Incorrect `api_key` or `access_token`.")
+		return nil, false
+	}
+	return fixture, true
+}
+
+// kiteData serves a fixture value in Kite's success envelope to authorized requests
+func (s *Simulator) kiteData(value func(*ZerodhaFixture) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := s.kiteAuthorized(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "data": value(fixture)})
+	}
+}
+
+// kiteOrderHistory handles GET /orders/{order_id}
+func (s *Simulator) kiteOrderHistory(w http.ResponseWriter, r *http.Request) {
+	fixture, ok := s.kiteAuthorized(w, r)
+	if !ok {
+		return
+	}
+
+	history, exists := fixture.OrderHistory[r.PathValue("order_id")]
+	if !exists {
+		kiteError(w, http.StatusNotFound, "OrderException", "Couldn't find that `order_id`.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "data": history})
+}
+
+// kiteLogin handles the browser login page GET /connect/login?api_key=&redirect_params=
+// The user is taken to be signed in at once: with a redirect URL configured the browser is
+// sent there with a request_token and the redirect_params, otherwise the request_token is
+// returned as JSON.
+func (s *Simulator) kiteLogin(w http.ResponseWriter, r *http.Request) {
+	fixture := s.fixtures.Zerodha
+	if fixture == nil {
+		kiteError(w, http.StatusNotFound, "GeneralException", "No Kite fixture loaded")
+		return
+	}
+	if r.URL.Query().Get("api_key") != fixture.APIKey {
+		kiteError(w, http.StatusBadRequest, "InputException", "Invalid `api_key`.")
+		return
+	}
+
+	s.mu.Lock()
+	requestToken := s.nextID("request-token")
+	s.requestTokens[requestToken] = true
+	s.mu.Unlock()
+
+	if fixture.RedirectURL == "" {
+		writeJSON(w, http.StatusOK, map[string]string{"request_token": requestToken})
+		return
+	}
+
+	params, _ := url.ParseQuery(r.URL.Query().Get("redirect_params"))
+	params.Set("request_token", requestToken)
+	params.Set("action", "login")
+	params.Set("status", "success")
+	http.Redirect(w, r, withQuery(fixture.RedirectURL, params), http.StatusFound)
+}
+
+// kiteSession handles POST /session/token: a request_token is exchanged once for a session
+// when the checksum is SHA-256(api_key + request_token + api_secret)
+func (s *Simulator) kiteSession(w http.ResponseWriter, r *http.Request) {
+	fixture := s.fixtures.Zerodha
+	if fixture == nil {
+		kiteError(w, http.StatusNotFound, "GeneralException", "No Kite fixture loaded")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		kiteError(w, http.StatusBadRequest, "InputException", "Invalid form body.")
+		return
+	}
+
+	apiKey, requestToken := r.PostForm.Get("api_key"), r.PostForm.Get("request_token")
+	sum := sha256.Sum256([]byte(fixture.APIKey + requestToken + fixture.APISecret))
+	if apiKey != fixture.APIKey || r.PostForm.Get("checksum") != hex.EncodeToString(sum[:]) {
+		kiteError(w, http.StatusForbidden, "TokenException", "Invalid `checksum`.")
+		return
+	}
+
+	s.mu.Lock()
+	if !s.requestTokens[requestToken] {
+		s.mu.Unlock()
+		kiteError(w, http.StatusForbidden, "TokenException", "Token is invalid or has expired.")
+		return
+	}
+	delete(s.requestTokens, requestToken)
+	s.kiteToken = s.nextID("kite-token")
+	token := s.kiteToken
+	s.mu.Unlock()
+
+	session := map[string]interface{}{
+		"user_id":        fixture.UserID,
+		"user_name":      fixture.UserName,
+		"user_shortname": fixture.UserName,
+		"email":          "",
+		"broker":         "ZERODHA",
+		"access_token":   token,
+		"public_token":   token + "-public",
+		"login_time":     time.Now().UTC().Format("2006-01-02 15:04:05"),
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "data": session})
+}
@@ -0,0 +1,238 @@
+// Package brokersim is a fake broker server that mimics the Dhan v2 and Kite Connect APIs,
+// so login, token renewal and sync flows can be exercised without a real broker account.
+//
+// One server handles both brokers under path prefixes:
+//
+//	/dhan/v2    Dhan v2 API (DHAN_PROD_API)
+//	/dhan/auth  Dhan consent login (DHAN_AUTH_URL)
+//	/kite       Kite Connect API (KITE_API_URL)
+//	/kite/auth  Kite login page (KITE_AUTH_URL)
+//	/_sim       controls: POST /_sim/revoke?broker=dhan, POST /_sim/reset
+//
+// Account data comes from fixture files. Access tokens behave like the real ones: requests
+// with any other token are rejected, a renewal replaces the token, and a revoked token is
+// rejected until the user logs in again.
+package brokersim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/brokers"
+)
+
+// failure is an error response injected into the next requests to a path
+type failure struct {
+	status int
+	times  int
+}
+
+// Simulator serves fixture data over fake Dhan and Kite endpoints
+type Simulator struct {
+	mu       sync.Mutex
+	fixtures Fixtures
+	mux      *http.ServeMux
+	seq      int
+
+	dhanToken     string
+	kiteToken     string
+	consents      map[string]bool // generated consentAppIds awaiting login
+	tokenIDs      map[string]bool // tokenIds from logins awaiting consumption
+	requestTokens map[string]bool // Kite request_tokens awaiting a session
+	hits          map[string]int
+	failures      map[string]*failure
+}
+
+// New creates a simulator serving the fixtures
+func New(fixtures Fixtures) *Simulator {
+	s := &Simulator{fixtures: fixtures, mux: http.NewServeMux()}
+	s.Reset()
+
+	s.mux.HandleFunc("GET /dhan/v2/trades/{from}/{to}/{page}", s.dhanTrades)
+	s.mux.HandleFunc("GET /dhan/v2/RenewToken", s.dhanRenewToken)
+	s.mux.HandleFunc("GET /dhan/v2/positions", s.dhanRows(func(f *DhanFixture) interface{} { return rows(f.Positions) }))
+	s.mux.HandleFunc("GET /dhan/v2/holdings", s.dhanRows(func(f *DhanFixture) interface{} { return rows(f.Holdings) }))
+	s.mux.HandleFunc("GET /dhan/v2/fundlimit", s.dhanRows(func(f *DhanFixture) interface{} { return object(f.FundLimit) }))
+	s.mux.HandleFunc("GET /dhan/v2/orders", s.dhanRows(func(f *DhanFixture) interface{} { return rows(f.Orders) }))
+	s.mux.HandleFunc("POST /dhan/auth/app/generate-consent", s.dhanGenerateConsent)
+	s.mux.HandleFunc("GET /dhan/auth/login/consentApp-login", s.dhanLogin)
+	s.mux.HandleFunc("GET /dhan/auth/app/consumeApp-consent", s.dhanConsumeConsent)
+
+	s.mux.HandleFunc("GET /kite/trades", s.kiteData(func(f *ZerodhaFixture) interface{} { return rows(f.Trades) }))
+	s.mux.HandleFunc("GET /kite/portfolio/positions", s.kiteData(func(f *ZerodhaFixture) interface{} {
+		return map[string]interface{}{"net": rows(f.Positions), "day": []json.RawMessage{}}
+	}))
+	s.mux.HandleFunc("GET /kite/portfolio/holdings", s.kiteData(func(f *ZerodhaFixture) interface{} { return rows(f.Holdings) }))
+	s.mux.HandleFunc("GET /kite/user/margins", s.kiteData(func(f *ZerodhaFixture) interface{} { return object(f.Margins) }))
+	s.mux.HandleFunc("GET /kite/orders", s.kiteData(func(f *ZerodhaFixture) interface{} { return rows(f.Orders) }))
+	s.mux.HandleFunc("GET /kite/orders/{order_id}", s.kiteOrderHistory)
+	s.mux.HandleFunc("POST /kite/session/token", s.kiteSession)
+	s.mux.HandleFunc("GET /kite/auth/connect/login", s.kiteLogin)
+
+	s.mux.HandleFunc("POST /_sim/revoke", s.revoke)
+	s.mux.HandleFunc("POST /_sim/reset", func(w http.ResponseWriter, r *http.Request) {
+		s.Reset()
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+	})
+
+	return s
+}
+
+// ServeHTTP counts the request, applies any injected failure and routes it
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.hits[r.URL.Path]++
+	injected := s.failures[r.URL.Path]
+	if injected != nil {
+		injected.times--
+		if injected.times <= 0 {
+			delete(s.failures, r.URL.Path)
+		}
+	}
+	s.mu.Unlock()
+
+	if injected != nil {
+		writeJSON(w, injected.status, map[string]string{
+			"status":  "error",
+			"message": http.StatusText(injected.status),
+		})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Reset restores the fixtures' access tokens and forgets logins, hits and injected failures
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dhanToken, s.kiteToken = "", ""
+	if s.fixtures.Dhan != nil {
+		s.dhanToken = s.fixtures.Dhan.AccessToken
+	}
+	if s.fixtures.Zerodha != nil {
+		s.kiteToken = s.fixtures.Zerodha.AccessToken
+	}
+	s.consents = make(map[string]bool)
+	s.tokenIDs = make(map[string]bool)
+	s.requestTokens = make(map[string]bool)
+	s.hits = make(map[string]int)
+	s.failures = make(map[string]*failure)
+}
+
+// Fixtures returns the fixtures the simulator serves
+func (s *Simulator) Fixtures() Fixtures {
+	return s.fixtures
+}
+
+// Revoke invalidates a broker's current access token, as when the user logs out elsewhere
+func (s *Simulator) Revoke(broker data.TradingBroker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch broker {
+	case data.TradingBrokerDhan:
+		s.dhanToken = ""
+	case data.TradingBrokerZerodha:
+		s.kiteToken = ""
+	}
+}
+
+// AccessToken returns the access token a broker currently accepts
+func (s *Simulator) AccessToken(broker data.TradingBroker) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if broker == data.TradingBrokerDhan {
+		return s.dhanToken
+	}
+	return s.kiteToken
+}
+
+// FailNext answers the next times requests to path (such as "/kite/trades") with status
+func (s *Simulator) FailNext(path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = &failure{status: status, times: times}
+}
+
+// Hits returns how many requests were made to path, including failed ones
+func (s *Simulator) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hits[path]
+}
+
+// ClientConfig returns a broker client config pointing at a simulator served from baseURL
+// Retries back off for milliseconds rather than seconds, and rate limiting is off.
+func ClientConfig(broker data.TradingBroker, baseURL string) brokers.ClientConfig {
+	config := brokers.DefaultClientConfig(broker)
+	config.MinBackoff = 5 * time.Millisecond
+	config.MaxBackoff = 20 * time.Millisecond
+	config.RateLimit = 0
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	switch broker {
+	case data.TradingBrokerDhan:
+		config.APIURL = baseURL + "/dhan/v2"
+		config.AuthURL = baseURL + "/dhan/auth"
+	case data.TradingBrokerZerodha:
+		config.APIURL = baseURL + "/kite"
+		config.AuthURL = baseURL + "/kite/auth"
+	}
+	return config
+}
+
+// Use points both broker clients at a simulator served from baseURL
+func Use(baseURL string) {
+	brokers.Configure(data.TradingBrokerDhan, ClientConfig(data.TradingBrokerDhan, baseURL))
+	brokers.Configure(data.TradingBrokerZerodha, ClientConfig(data.TradingBrokerZerodha, baseURL))
+}
+
+// revoke handles POST /_sim/revoke?broker=
+func (s *Simulator) revoke(w http.ResponseWriter, r *http.Request) {
+	broker := data.TradingBroker(r.URL.Query().Get("broker"))
+	if broker != data.TradingBrokerDhan && broker != data.TradingBrokerZerodha {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "broker must be dhan or zerodha"})
+		return
+	}
+	s.Revoke(broker)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked", "broker": string(broker)})
+}
+
+// nextID returns a fresh identifier with a prefix, for tokens and consents
+// The caller must hold s.mu.
+func (s *Simulator) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), s.seq)
+}
+
+// rows returns fixture rows, as an empty list rather than null when there are none
+func rows(values []json.RawMessage) []json.RawMessage {
+	if values == nil {
+		return []json.RawMessage{}
+	}
+	return values
+}
+
+// object returns a fixture object, as an empty object rather than null when it is missing
+func object(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("{}")
+	}
+	return value
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
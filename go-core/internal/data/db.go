@@ -6,18 +6,29 @@ import (
 	"os"
 	"path/filepath"
 
+	"go-core/internal/secrets"
 	"go-core/internal/utils"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DefaultMigrationsDir is where NewDB reads migrations from, relative to the working directory
+const DefaultMigrationsDir = "migrations"
+
 // DB represents the database connection
 type DB struct {
-	conn *sql.DB
+	conn          *sql.DB
+	keyring       *secrets.Keyring
+	migrationsDir string
 }
 
 // NewDB creates a new database connection
 func NewDB(dbPath string) (*DB, error) {
+	return NewDBWithMigrations(dbPath, DefaultMigrationsDir)
+}
+
+// NewDBWithMigrations creates a new database connection, migrated from migrationsDir
+func NewDBWithMigrations(dbPath, migrationsDir string) (*DB, error) {
 	// Ensure the directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -34,7 +45,7 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, migrationsDir: migrationsDir}
 
 	// Initialize the database with tables
 	if err := db.InitTables(); err != nil {
@@ -54,16 +65,23 @@ func (db *DB) GetConnection() *sql.DB {
 	return db.conn
 }
 
+// SetKeyring sets the keyring broker credentials are encrypted with
+func (db *DB) SetKeyring(keyring *secrets.Keyring) {
+	db.keyring = keyring
+}
+
+// Keyring returns the keyring broker credentials are encrypted with, or nil if none is set
+func (db *DB) Keyring() *secrets.Keyring {
+	return db.keyring
+}
+
 // InitTables runs database migrations to set up the schema
 func (db *DB) InitTables() error {
-	// Get the migrations directory path
-	migrationsDir := "migrations"
-
 	// Create migration runner
 	migrationRunner := NewMigrationRunner(db.conn)
 
 	// Run all pending migrations
-	if err := migrationRunner.RunMigrations(migrationsDir); err != nil {
+	if err := migrationRunner.RunMigrations(db.migrationsDir); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
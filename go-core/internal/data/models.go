@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -16,15 +17,22 @@ type User struct {
 }
 
 // BrokerConfig represents configuration for a broker
+// AccessToken, APIKey and APISecret are encrypted at rest by the user repository.
 type BrokerConfig struct {
-	AccessToken    string     `json:"access_token"`
-	APIKey         *string    `json:"api_key,omitempty"`    // For OAuth flow
-	APISecret      *string    `json:"api_secret,omitempty"` // For OAuth flow (encrypted in production)
-	DhanClientID   *string    `json:"dhan_client_id,omitempty"`
-	DhanClientName *string    `json:"dhan_client_name,omitempty"`
-	DhanClientUcc  *string    `json:"dhan_client_ucc,omitempty"`
-	ExpiryTime     *time.Time `json:"expiry_time,omitempty"`
-	ConfiguredAt   time.Time  `json:"configured_at"`
+	AccessToken       string     `json:"access_token"`
+	APIKey            *string    `json:"api_key,omitempty"`    // For OAuth flow
+	APISecret         *string    `json:"api_secret,omitempty"` // For OAuth flow
+	DhanClientID      *string    `json:"dhan_client_id,omitempty"`
+	DhanClientName    *string    `json:"dhan_client_name,omitempty"`
+	DhanClientUcc     *string    `json:"dhan_client_ucc,omitempty"`
+	ZerodhaUserID     *string    `json:"zerodha_user_id,omitempty"`
+	ZerodhaUserName   *string    `json:"zerodha_user_name,omitempty"`
+	ZerodhaLoginState *string    `json:"zerodha_login_state,omitempty"` // Pending Kite login, echoed back to the callback
+	ExpiryTime        *time.Time `json:"expiry_time,omitempty"`
+	ConfiguredAt      time.Time  `json:"configured_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`        // Broker rejected the token configured before this time
+	RefreshFailedAt   *time.Time `json:"refresh_failed_at,omitempty"` // Last failed renewal of the token configured before this time
+	RefreshError      *string    `json:"refresh_error,omitempty"`
 }
 
 // Trade represents a trading position
@@ -38,6 +46,7 @@ type Trade struct {
 	Quantity       int              `json:"quantity" db:"quantity"`
 	TotalAmount    float64          `json:"total_amount" db:"total_amount"`
 	ExitPrice      *float64         `json:"exit_price" db:"exit_price"`
+	ExitDate       *time.Time       `json:"exit_date" db:"exit_date"`
 	Direction      TradeDirection   `json:"direction" db:"direction"`
 	StopLoss       *float64         `json:"stop_loss" db:"stop_loss"`
 	Target         *float64         `json:"target" db:"target"`
@@ -54,10 +63,444 @@ type Trade struct {
 	OrderID         *string        `json:"order_id,omitempty" db:"order_id"`
 	ProductType     *ProductType   `json:"product_type,omitempty" db:"product_type"`
 	TransactionType *string        `json:"transaction_type,omitempty" db:"transaction_type"` // buy | sell
+	AlgorithmID     *string        `json:"algorithm_id,omitempty" db:"algorithm_id"`         // set on trades made by paper trading
 	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
 }
 
+// BrokerFill is a single execution recorded from a broker, keyed by its exchange trade ID
+type BrokerFill struct {
+	ID              string        `json:"id" db:"id"`
+	UserID          int           `json:"user_id" db:"user_id"`
+	TradingBroker   TradingBroker `json:"trading_broker" db:"trading_broker"`
+	TradeID         string        `json:"trade_id" db:"trade_id"` // Exchange trade ID
+	OrderID         *string       `json:"order_id,omitempty" db:"order_id"`
+	ExchangeOrderID *string       `json:"exchange_order_id,omitempty" db:"exchange_order_id"`
+	Symbol          string        `json:"symbol" db:"symbol"`
+	ProductType     *string       `json:"product_type,omitempty" db:"product_type"`
+	Side            string        `json:"side" db:"side"` // buy | sell
+	Quantity        int           `json:"quantity" db:"quantity"`
+	Price           float64       `json:"price" db:"price"`
+	FillTime        time.Time     `json:"fill_time" db:"fill_time"`
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// BrokerOrder is an order from a broker's order book in its latest known state
+type BrokerOrder struct {
+	ID              string              `json:"id" db:"id"`
+	UserID          int                 `json:"user_id" db:"user_id"`
+	TradingBroker   TradingBroker       `json:"trading_broker" db:"trading_broker"`
+	OrderID         string              `json:"order_id" db:"order_id"` // Broker order ID, shared with fills and trades
+	ExchangeOrderID *string             `json:"exchange_order_id,omitempty" db:"exchange_order_id"`
+	ParentOrderID   *string             `json:"parent_order_id,omitempty" db:"parent_order_id"`
+	Symbol          string              `json:"symbol" db:"symbol"`
+	Exchange        *string             `json:"exchange,omitempty" db:"exchange"`
+	ProductType     *string             `json:"product_type,omitempty" db:"product_type"`
+	OrderType       *string             `json:"order_type,omitempty" db:"order_type"`
+	Side            string              `json:"side" db:"side"` // buy | sell
+	Quantity        int                 `json:"quantity" db:"quantity"`
+	FilledQuantity  int                 `json:"filled_quantity" db:"filled_quantity"`
+	Price           float64             `json:"price" db:"price"`
+	TriggerPrice    float64             `json:"trigger_price" db:"trigger_price"`
+	AveragePrice    float64             `json:"average_price" db:"average_price"`
+	Status          string              `json:"status" db:"status"`               // normalized across brokers
+	BrokerStatus    string              `json:"broker_status" db:"broker_status"` // as reported by the broker
+	StatusMessage   *string             `json:"status_message,omitempty" db:"status_message"`
+	PlacedAt        time.Time           `json:"placed_at" db:"placed_at"`
+	LastUpdatedAt   time.Time           `json:"last_updated_at" db:"last_updated_at"` // broker's last change to the order
+	CreatedAt       time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at" db:"updated_at"`
+	Events          []*BrokerOrderEvent `json:"events,omitempty" db:"-"`
+}
+
+// BrokerOrderEvent is one recorded state of a broker order: placement, modification or status change
+type BrokerOrderEvent struct {
+	ID             string    `json:"id" db:"id"`
+	BrokerOrderID  string    `json:"broker_order_id" db:"broker_order_id"` // BrokerOrder.ID
+	UserID         int       `json:"user_id" db:"user_id"`
+	Status         string    `json:"status" db:"status"`
+	BrokerStatus   string    `json:"broker_status" db:"broker_status"`
+	Quantity       int       `json:"quantity" db:"quantity"`
+	FilledQuantity int       `json:"filled_quantity" db:"filled_quantity"`
+	Price          float64   `json:"price" db:"price"`
+	TriggerPrice   float64   `json:"trigger_price" db:"trigger_price"`
+	Message        *string   `json:"message,omitempty" db:"message"`
+	EventTime      time.Time `json:"event_time" db:"event_time"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// BrokerPositionKind distinguishes open positions from demat holdings in a broker snapshot
+type BrokerPositionKind string
+
+const (
+	BrokerPositionKindPosition BrokerPositionKind = "position"
+	BrokerPositionKindHolding  BrokerPositionKind = "holding"
+)
+
+// BrokerPosition is one row of the latest positions and holdings snapshot taken from a broker
+type BrokerPosition struct {
+	ID            string             `json:"id" db:"id"`
+	UserID        int                `json:"user_id" db:"user_id"`
+	TradingBroker TradingBroker      `json:"trading_broker" db:"trading_broker"`
+	Kind          BrokerPositionKind `json:"kind" db:"kind"`
+	Symbol        string             `json:"symbol" db:"symbol"`
+	Exchange      *string            `json:"exchange,omitempty" db:"exchange"`
+	ProductType   *string            `json:"product_type,omitempty" db:"product_type"`
+	ISIN          *string            `json:"isin,omitempty" db:"isin"`
+	Quantity      int                `json:"quantity" db:"quantity"` // negative for short positions
+	AveragePrice  float64            `json:"average_price" db:"average_price"`
+	LastPrice     float64            `json:"last_price" db:"last_price"`
+	DayPnL        float64            `json:"day_pnl" db:"day_pnl"`
+	PnL           float64            `json:"pnl" db:"pnl"`
+	SyncedAt      time.Time          `json:"synced_at" db:"synced_at"`
+}
+
+// InstrumentSegment groups instruments by market segment
+type InstrumentSegment string
+
+const (
+	InstrumentSegmentEquity     InstrumentSegment = "equity"
+	InstrumentSegmentIndex      InstrumentSegment = "index"
+	InstrumentSegmentDerivative InstrumentSegment = "derivative"
+	InstrumentSegmentCurrency   InstrumentSegment = "currency"
+	InstrumentSegmentCommodity  InstrumentSegment = "commodity"
+)
+
+// Instrument is a tradable contract from a broker's instrument master
+type Instrument struct {
+	ID             string            `json:"id" db:"id"`
+	TradingBroker  TradingBroker     `json:"trading_broker" db:"trading_broker"` // dump the row was loaded from
+	BrokerToken    string            `json:"broker_token" db:"broker_token"`     // Dhan security ID or Kite instrument_token
+	Exchange       string            `json:"exchange" db:"exchange"`             // NSE, BSE or MCX
+	Segment        InstrumentSegment `json:"segment" db:"segment"`
+	TradingSymbol  string            `json:"trading_symbol" db:"trading_symbol"`
+	Name           *string           `json:"name,omitempty" db:"name"`
+	ISIN           *string           `json:"isin,omitempty" db:"isin"`
+	InstrumentType string            `json:"instrument_type" db:"instrument_type"` // EQ, INDEX, FUT, CE or PE
+	Underlying     *string           `json:"underlying,omitempty" db:"underlying"`
+	LotSize        int               `json:"lot_size" db:"lot_size"`
+	TickSize       float64           `json:"tick_size" db:"tick_size"`
+	Expiry         *time.Time        `json:"expiry,omitempty" db:"expiry"`
+	Strike         *float64          `json:"strike,omitempty" db:"strike"`
+	UpdatedAt      time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// Candle is one OHLCV bar of a symbol's price history
+type Candle struct {
+	Symbol    string    `json:"symbol,omitempty" db:"symbol"`
+	Timeframe Timeframe `json:"timeframe,omitempty" db:"timeframe"`
+	Timestamp time.Time `json:"timestamp" db:"timestamp"` // start of the bar
+	Open      float64   `json:"open" db:"open"`
+	High      float64   `json:"high" db:"high"`
+	Low       float64   `json:"low" db:"low"`
+	Close     float64   `json:"close" db:"close"`
+	Volume    int64     `json:"volume" db:"volume"`
+}
+
+// CandleSeries summarizes the stored bars of one symbol and timeframe
+type CandleSeries struct {
+	Symbol    string    `json:"symbol"`
+	Timeframe Timeframe `json:"timeframe"`
+	Count     int       `json:"count"`
+	From      time.Time `json:"from"` // first bar
+	To        time.Time `json:"to"`   // last bar
+}
+
+// ChargeModel is how simulated fills are charged
+type ChargeModel string
+
+const (
+	ChargeModelNone           ChargeModel = "none"
+	ChargeModelFlat           ChargeModel = "flat"            // a fixed amount per fill
+	ChargeModelPercent        ChargeModel = "percent"         // a percentage of turnover
+	ChargeModelEquityIntraday ChargeModel = "equity_intraday" // NSE equity intraday brokerage and statutory charges
+	ChargeModelEquityDelivery ChargeModel = "equity_delivery" // NSE equity delivery statutory charges
+)
+
+// Charges configures the costs of simulated fills
+type Charges struct {
+	Model    ChargeModel `json:"model"`
+	PerOrder float64     `json:"per_order,omitempty"` // flat: charge per fill
+	Percent  float64     `json:"percent,omitempty"`   // percent: charge as a percentage of turnover
+}
+
+// SizingMode is how the quantity of a simulated order is chosen
+type SizingMode string
+
+const (
+	SizingModeSignal        SizingMode = "signal"         // the signal's quantity, else the configured quantity
+	SizingModeFixed         SizingMode = "fixed"          // always the configured quantity
+	SizingModePercentEquity SizingMode = "percent_equity" // a percentage of account equity
+)
+
+// PositionSizing configures the quantity of simulated entries
+type PositionSizing struct {
+	Mode     SizingMode `json:"mode"`
+	Quantity int        `json:"quantity,omitempty"`
+	Percent  float64    `json:"percent,omitempty"`
+}
+
+// FillRule is the price a simulated market order fills at
+type FillRule string
+
+const (
+	FillRuleNextOpen FillRule = "next_open" // the open of the bar after the signal
+	FillRuleClose    FillRule = "close"     // the close of the signal's bar
+)
+
+// SimulationSettings configures a simulated trading account and how it acts on signals
+type SimulationSettings struct {
+	InitialCapital float64        `json:"initial_capital"`
+	SlippageBps    float64        `json:"slippage_bps"` // adverse slippage of market fills, in basis points
+	Charges        Charges        `json:"charges"`
+	Sizing         PositionSizing `json:"sizing"`
+	Fill           FillRule       `json:"fill"`
+	AllowShort     bool           `json:"allow_short"` // whether SELL without a position opens a short
+	Lookback       int            `json:"lookback"`    // bars of history each run sees, including the current bar
+}
+
+// BacktestSettings configures a backtest run
+type BacktestSettings struct {
+	From *time.Time `json:"from,omitempty"` // first bar to trade, default: the first stored bar
+	To   *time.Time `json:"to,omitempty"`   // end of the range, exclusive
+	SimulationSettings
+}
+
+// SimulatedTrade is a closed round trip of a backtest or paper trading
+type SimulatedTrade struct {
+	Symbol     string         `json:"symbol"`
+	Direction  TradeDirection `json:"direction"`
+	Quantity   int            `json:"quantity"`
+	EntryTime  time.Time      `json:"entry_time"`
+	EntryPrice float64        `json:"entry_price"`
+	ExitTime   time.Time      `json:"exit_time"`
+	ExitPrice  float64        `json:"exit_price"`
+	Charges    float64        `json:"charges"`
+	PnL        float64        `json:"pnl"`        // net of charges
+	ReturnPct  float64        `json:"return_pct"` // PnL as a percentage of the entry value
+	ExitReason string         `json:"exit_reason"`
+}
+
+// EquityPoint is the simulated account value at the close of one bar
+type EquityPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Equity      float64   `json:"equity"`
+	Cash        float64   `json:"cash"`
+	DrawdownPct float64   `json:"drawdown_pct"` // below the running peak
+}
+
+// BacktestMetrics summarizes a backtest run
+type BacktestMetrics struct {
+	InitialCapital float64 `json:"initial_capital"`
+	FinalEquity    float64 `json:"final_equity"`
+	TotalPnL       float64 `json:"total_pnl"`
+	ReturnPct      float64 `json:"return_pct"`
+	TotalTrades    int     `json:"total_trades"`
+	WinningTrades  int     `json:"winning_trades"`
+	LosingTrades   int     `json:"losing_trades"`
+	WinRate        float64 `json:"win_rate"` // 0.0 to 1.0
+	AverageWin     float64 `json:"average_win"`
+	AverageLoss    float64 `json:"average_loss"`
+	ProfitFactor   float64 `json:"profit_factor"` // gross profit over gross loss, 0 without losses
+	MaxDrawdown    float64 `json:"max_drawdown"`
+	MaxDrawdownPct float64 `json:"max_drawdown_pct"`
+	SharpeRatio    float64 `json:"sharpe_ratio"` // annualized from per-bar returns
+	TotalCharges   float64 `json:"total_charges"`
+	ExposurePct    float64 `json:"exposure_pct"` // bars closed with a position open
+}
+
+// BacktestStatus is the outcome of a backtest run
+type BacktestStatus string
+
+const (
+	BacktestStatusCompleted BacktestStatus = "completed"
+	BacktestStatusFailed    BacktestStatus = "failed"
+)
+
+// Backtest is a simulated run of an algorithm's code over stored candles
+type Backtest struct {
+	ID          string           `json:"id" db:"id"`
+	AlgorithmID string           `json:"algorithm_id" db:"algorithm_id"`
+	UserID      int              `json:"user_id" db:"user_id"`
+	Symbol      string           `json:"symbol" db:"symbol"`
+	Timeframe   Timeframe        `json:"timeframe" db:"timeframe"`
+	Settings    BacktestSettings `json:"settings" db:"settings"` // JSON
+	Status      BacktestStatus   `json:"status" db:"status"`
+	Error       *string          `json:"error,omitempty" db:"error"`
+	Bars        int              `json:"bar_count" db:"bar_count"`
+	StartAt     *time.Time       `json:"start_at,omitempty" db:"start_at"`
+	EndAt       *time.Time       `json:"end_at,omitempty" db:"end_at"`
+	Metrics     BacktestMetrics  `json:"metrics" db:"metrics"`                     // JSON
+	Trades      []SimulatedTrade `json:"trades,omitempty" db:"trades"`             // JSON, not loaded for listings
+	EquityCurve []EquityPoint    `json:"equity_curve,omitempty" db:"equity_curve"` // JSON, not loaded for listings
+	DurationMs  int64            `json:"duration_ms" db:"duration_ms"`
+	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
+
+	AlgorithmVersion *int `json:"algorithm_version,omitempty" db:"algorithm_version"` // nil for backtests run before versions were kept
+}
+
+// PaperAccount is the simulated account an algorithm in paper trading mode trades with
+type PaperAccount struct {
+	AlgorithmID   string             `json:"algorithm_id" db:"algorithm_id"`
+	UserID        int                `json:"user_id" db:"user_id"`
+	Settings      SimulationSettings `json:"settings" db:"settings"`         // JSON
+	Account       json.RawMessage    `json:"account" db:"account"`           // JSON: cash, positions and pending orders
+	OpenTrades    map[string]string  `json:"open_trades" db:"open_trades"`   // journal trade ID of each open position, by symbol
+	TotalTrades   int                `json:"total_trades" db:"total_trades"` // closed round trips
+	WinningTrades int                `json:"winning_trades" db:"winning_trades"`
+	LastBarAt     *time.Time         `json:"last_bar_at,omitempty" db:"last_bar_at"`
+	CreatedAt     time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// AlgorithmRunSource is what ran an algorithm's code
+type AlgorithmRunSource string
+
+const (
+	AlgorithmRunSourceEvaluate  AlgorithmRunSource = "evaluate"  // the evaluate endpoint
+	AlgorithmRunSourceScheduled AlgorithmRunSource = "scheduled" // the scheduler, for live trading algorithms
+	AlgorithmRunSourcePaper     AlgorithmRunSource = "paper"     // one bar of paper trading
+)
+
+// AlgorithmRunStatus is the outcome of one run of an algorithm's code
+type AlgorithmRunStatus string
+
+const (
+	AlgorithmRunStatusSucceeded AlgorithmRunStatus = "succeeded"
+	AlgorithmRunStatusFailed    AlgorithmRunStatus = "failed"
+)
+
+// StateChange is a state key whose value a run changed
+type StateChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// StateDiff is how a run changed an algorithm's top-level state keys
+type StateDiff struct {
+	Added   map[string]interface{} `json:"added,omitempty"`
+	Changed map[string]StateChange `json:"changed,omitempty"`
+	Removed map[string]interface{} `json:"removed,omitempty"` // with the values they had
+}
+
+// AlgorithmRun is the audit record of one evaluation of an algorithm's code
+type AlgorithmRun struct {
+	ID          string             `json:"id" db:"id"`
+	AlgorithmID string             `json:"algorithm_id" db:"algorithm_id"`
+	UserID      int                `json:"user_id" db:"user_id"`
+	Source      AlgorithmRunSource `json:"source" db:"source"`
+	Status      AlgorithmRunStatus `json:"status" db:"status"`
+	Symbol      string             `json:"symbol" db:"symbol"`
+	BarAt       *time.Time         `json:"bar_at,omitempty" db:"bar_at"` // timestamp of the latest input candle
+	Bars        int                `json:"bars" db:"bars"`               // input candles
+	Signal      *string            `json:"signal,omitempty" db:"signal"` // BUY, SELL or HOLD; nil when the run failed
+	Quantity    int                `json:"quantity,omitempty" db:"quantity"`
+	Price       *float64           `json:"price,omitempty" db:"price"`
+	StopLoss    *float64           `json:"stop_loss,omitempty" db:"stop_loss"`
+	Target      *float64           `json:"target,omitempty" db:"target"`
+	Reason      *string            `json:"reason,omitempty" db:"reason"`
+	StateDiff   *StateDiff         `json:"state_diff,omitempty" db:"state_diff"` // JSON; nil when the run failed
+	Logs        []string           `json:"logs,omitempty" db:"logs"`             // JSON: print() output
+	Error       *string            `json:"error,omitempty" db:"error"`
+	Steps       uint64             `json:"steps" db:"steps"`
+	DurationMs  int64              `json:"duration_ms" db:"duration_ms"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+
+	AlgorithmVersion *int `json:"algorithm_version,omitempty" db:"algorithm_version"` // nil for runs before versions were kept
+}
+
+// AlgorithmVersion is an immutable snapshot of an algorithm's code and config
+// A version is stored when an algorithm is created and whenever its code or config changes.
+type AlgorithmVersion struct {
+	ID          string                 `json:"id" db:"id"`
+	AlgorithmID string                 `json:"algorithm_id" db:"algorithm_id"`
+	UserID      int                    `json:"user_id" db:"user_id"`
+	Version     int                    `json:"version" db:"version"`
+	Code        string                 `json:"code" db:"code"`
+	Graph       *AlgorithmGraph        `json:"graph,omitempty" db:"graph"` // JSON: canvas graph the code was compiled from
+	Config      map[string]interface{} `json:"config" db:"config"`         // JSON
+	AuthorID    int                    `json:"author_id" db:"author_id"`
+	Message     string                 `json:"message" db:"message"`
+	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
+}
+
+// AlgorithmScheduleStatus is the state of an algorithm's latest scheduled run
+type AlgorithmScheduleStatus string
+
+const (
+	AlgorithmScheduleStatusRunning   AlgorithmScheduleStatus = "running"
+	AlgorithmScheduleStatusSucceeded AlgorithmScheduleStatus = "succeeded"
+	AlgorithmScheduleStatusFailed    AlgorithmScheduleStatus = "failed"
+)
+
+// AlgorithmSchedule is the latest bar close the scheduler ran an algorithm for, and how it went
+type AlgorithmSchedule struct {
+	AlgorithmID string                  `json:"algorithm_id" db:"algorithm_id"`
+	BarClose    time.Time               `json:"bar_close" db:"bar_close"`
+	Status      AlgorithmScheduleStatus `json:"status" db:"status"`
+	Signal      *string                 `json:"signal,omitempty" db:"signal"`
+	Bars        int                     `json:"bars" db:"bars"` // bars a paper trading run processed
+	Error       *string                 `json:"error,omitempty" db:"error"`
+	StartedAt   time.Time               `json:"started_at" db:"started_at"`
+	FinishedAt  *time.Time              `json:"finished_at,omitempty" db:"finished_at"`
+	DurationMs  *int64                  `json:"duration_ms,omitempty" db:"duration_ms"`
+}
+
+// BrokerSyncTrigger records what queued a background broker sync
+type BrokerSyncTrigger string
+
+const (
+	BrokerSyncTriggerManual    BrokerSyncTrigger = "manual"
+	BrokerSyncTriggerScheduled BrokerSyncTrigger = "scheduled"
+)
+
+// BrokerSyncStatus is the lifecycle state of a background broker sync
+type BrokerSyncStatus string
+
+const (
+	BrokerSyncStatusQueued    BrokerSyncStatus = "queued"
+	BrokerSyncStatusRunning   BrokerSyncStatus = "running"
+	BrokerSyncStatusSucceeded BrokerSyncStatus = "succeeded"
+	BrokerSyncStatusFailed    BrokerSyncStatus = "failed"
+)
+
+// BrokerSyncRun is one background broker sync with its progress and outcome
+type BrokerSyncRun struct {
+	ID            string            `json:"id" db:"id"`
+	UserID        int               `json:"user_id" db:"user_id"`
+	TradingBroker TradingBroker     `json:"trading_broker" db:"trading_broker"`
+	Trigger       BrokerSyncTrigger `json:"trigger" db:"trigger"`
+	Method        string            `json:"method" db:"method"`
+	Status        BrokerSyncStatus  `json:"status" db:"status"`
+	Stage         *string           `json:"stage,omitempty" db:"stage"` // step of a running sync
+	Fetched       int               `json:"total_fetched" db:"fetched_count"`
+	Saved         int               `json:"saved_count" db:"saved_count"`
+	Updated       int               `json:"updated_count" db:"updated_count"`
+	Skipped       int               `json:"skipped_count" db:"skipped_count"`
+	Warnings      []string          `json:"warnings,omitempty" db:"warnings"` // JSON array
+	Error         *string           `json:"error,omitempty" db:"error"`
+	QueuedAt      time.Time         `json:"queued_at" db:"queued_at"`
+	StartedAt     *time.Time        `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt    *time.Time        `json:"finished_at,omitempty" db:"finished_at"`
+	DurationMs    *int64            `json:"duration_ms,omitempty" db:"duration_ms"`
+}
+
+// BrokerSyncSchedule queues a background sync of one broker at a time of day in IST
+type BrokerSyncSchedule struct {
+	ID            string        `json:"id" db:"id"`
+	UserID        int           `json:"user_id" db:"user_id"`
+	TradingBroker TradingBroker `json:"trading_broker" db:"trading_broker"`
+	RunAt         string        `json:"run_at" db:"run_at"`     // HH:MM in IST
+	Weekdays      []int         `json:"weekdays" db:"weekdays"` // Sunday = 0
+	Method        string        `json:"method" db:"method"`
+	Enabled       bool          `json:"enabled" db:"enabled"`
+	NextRunAt     *time.Time    `json:"next_run_at,omitempty" db:"next_run_at"`
+	LastRunAt     *time.Time    `json:"last_run_at,omitempty" db:"last_run_at"`
+	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at" db:"updated_at"`
+}
+
 // TradePsychology represents psychology information for a trade
 type TradePsychology struct {
 	EntryConfidence    int      `json:"entry_confidence" db:"entry_confidence"`       // 1-10 scale
@@ -216,6 +659,7 @@ type Algorithm struct {
 	Name        string    `json:"name" db:"name"`
 	Description *string   `json:"description,omitempty" db:"description"`
 	Code        string    `json:"code" db:"code"`
+	Graph       *AlgorithmGraph `json:"graph,omitempty" db:"graph"` // JSON: canvas graph Code is compiled from; nil for code algorithms
 	Status      AlgorithmStatus `json:"status" db:"status"`
 	
 	// Execution settings
@@ -244,3 +688,47 @@ type Algorithm struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
+
+// GraphNodeType is the kind of a canvas node
+type GraphNodeType string
+
+const (
+	GraphNodeMarketData     GraphNodeType = "marketData"     // the candles the algorithm runs on
+	GraphNodeIndicator      GraphNodeType = "indicator"      // SMA, EMA, RSI or MACD of a number
+	GraphNodeCondition      GraphNodeType = "condition"      // comparison, crossover or logic
+	GraphNodeCodeBlock      GraphNodeType = "codeBlock"      // a function body of algorithm code
+	GraphNodeRiskManagement GraphNodeType = "riskManagement" // quantity, stop loss and target
+	GraphNodeBroker         GraphNodeType = "broker"         // the signal output
+)
+
+// AlgorithmGraph is a visual algorithm: nodes wired output to input by edges
+// It has the shape the web canvas (React Flow) saves, so field names follow it.
+type AlgorithmGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a step of a visual algorithm; Data holds its settings
+type GraphNode struct {
+	ID       string                 `json:"id"`
+	Type     GraphNodeType          `json:"type"`
+	Position GraphPosition          `json:"position"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// GraphPosition is where a node sits on the canvas
+type GraphPosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// GraphEdge wires an output of Source to an input of Target
+// An empty SourceHandle is the source's first output; an empty TargetHandle is the target's
+// first input of the output's type not wired by an earlier edge.
+type GraphEdge struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	SourceHandle string `json:"sourceHandle,omitempty"`
+	TargetHandle string `json:"targetHandle,omitempty"`
+}
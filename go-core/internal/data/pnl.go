@@ -0,0 +1,16 @@
+package data
+
+// RealizedPnL returns the gross profit or loss of a closed trade
+// Returns nil while the trade has no exit price
+func (t *Trade) RealizedPnL() *float64 {
+	if t.ExitPrice == nil {
+		return nil
+	}
+
+	pnl := (*t.ExitPrice - t.EntryPrice) * float64(t.Quantity)
+	if t.Direction == TradeDirectionShort {
+		pnl = -pnl
+	}
+
+	return &pnl
+}
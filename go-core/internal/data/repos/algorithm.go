@@ -12,7 +12,7 @@ import (
 
 // AlgorithmRepository handles algorithm database operations
 type AlgorithmRepository struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewAlgorithmRepository creates a new algorithm repository
@@ -20,6 +20,11 @@ func NewAlgorithmRepository(db *sql.DB) *AlgorithmRepository {
 	return &AlgorithmRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *AlgorithmRepository) WithTx(tx *sql.Tx) *AlgorithmRepository {
+	return &AlgorithmRepository{db: tx}
+}
+
 // CreateAlgorithm creates a new algorithm
 func (r *AlgorithmRepository) CreateAlgorithm(algo *data.Algorithm) error {
 	// Convert JSON fields
@@ -47,6 +52,11 @@ func (r *AlgorithmRepository) CreateAlgorithm(algo *data.Algorithm) error {
 		tagsJSON = []byte("[]")
 	}
 
+	graphValue, err := marshalGraph(algo.Graph)
+	if err != nil {
+		return err
+	}
+
 	var brokerValue interface{}
 	if algo.Broker != nil {
 		brokerValue = string(*algo.Broker)
@@ -62,9 +72,9 @@ func (r *AlgorithmRepository) CreateAlgorithm(algo *data.Algorithm) error {
 			id, user_id, name, description, code, status,
 			symbol, timeframe, execution_mode, broker, enabled,
 			config, state, last_run_at, last_signal,
-			total_trades, win_rate, total_pnl, version, tags,
+			total_trades, win_rate, total_pnl, version, tags, graph,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = r.db.Exec(
@@ -89,6 +99,7 @@ func (r *AlgorithmRepository) CreateAlgorithm(algo *data.Algorithm) error {
 		algo.TotalPnL,
 		algo.Version,
 		string(tagsJSON),
+		graphValue,
 		algo.CreatedAt.Format(time.RFC3339),
 		algo.UpdatedAt.Format(time.RFC3339),
 	)
@@ -107,7 +118,7 @@ func (r *AlgorithmRepository) GetAlgorithmByID(id string, userID int) (*data.Alg
 		SELECT id, user_id, name, description, code, status,
 		       symbol, timeframe, execution_mode, broker, enabled,
 		       config, state, last_run_at, last_signal,
-		       total_trades, win_rate, total_pnl, version, tags,
+		       total_trades, win_rate, total_pnl, version, tags, graph,
 		       created_at, updated_at
 		FROM algorithms
 		WHERE id = ? AND user_id = ?
@@ -116,7 +127,7 @@ func (r *AlgorithmRepository) GetAlgorithmByID(id string, userID int) (*data.Alg
 	var algo data.Algorithm
 	var statusStr, timeframeStr, executionModeStr, brokerStr sql.NullString
 	var description, lastSignal sql.NullString
-	var lastRunAtStr sql.NullString
+	var lastRunAtStr, graphJSON sql.NullString
 	var configJSON, stateJSON, tagsJSON string
 	var createdAtStr, updatedAtStr string
 
@@ -141,6 +152,7 @@ func (r *AlgorithmRepository) GetAlgorithmByID(id string, userID int) (*data.Alg
 		&algo.TotalPnL,
 		&algo.Version,
 		&tagsJSON,
+		&graphJSON,
 		&createdAtStr,
 		&updatedAtStr,
 	)
@@ -184,6 +196,12 @@ func (r *AlgorithmRepository) GetAlgorithmByID(id string, userID int) (*data.Alg
 		algo.Tags = []string{}
 	}
 
+	if graphJSON.Valid {
+		if err := json.Unmarshal([]byte(graphJSON.String), &algo.Graph); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal graph: %w", err)
+		}
+	}
+
 	// Parse timestamps
 	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
 	if err != nil {
@@ -213,7 +231,7 @@ func (r *AlgorithmRepository) GetAlgorithmsByUser(userID int, limit int, offset
 		SELECT id, user_id, name, description, code, status,
 		       symbol, timeframe, execution_mode, broker, enabled,
 		       config, state, last_run_at, last_signal,
-		       total_trades, win_rate, total_pnl, version, tags,
+		       total_trades, win_rate, total_pnl, version, tags, graph,
 		       created_at, updated_at
 		FROM algorithms
 		WHERE user_id = ?
@@ -241,6 +259,70 @@ func (r *AlgorithmRepository) GetAlgorithmsByUser(userID int, limit int, offset
 	return algorithms, nil
 }
 
+// GetAllAlgorithmsByUser retrieves every algorithm for a user, oldest first
+func (r *AlgorithmRepository) GetAllAlgorithmsByUser(userID int) ([]*data.Algorithm, error) {
+	query := `
+		SELECT id, user_id, name, description, code, status,
+		       symbol, timeframe, execution_mode, broker, enabled,
+		       config, state, last_run_at, last_signal,
+		       total_trades, win_rate, total_pnl, version, tags, graph,
+		       created_at, updated_at
+		FROM algorithms
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all algorithms")
+		return nil, fmt.Errorf("failed to get algorithms: %w", err)
+	}
+	defer rows.Close()
+
+	var algorithms []*data.Algorithm
+	for rows.Next() {
+		algo, err := r.scanAlgorithm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm: %w", err)
+		}
+		algorithms = append(algorithms, algo)
+	}
+
+	return algorithms, rows.Err()
+}
+
+// GetScheduledAlgorithms retrieves every user's enabled live algorithms, oldest first
+func (r *AlgorithmRepository) GetScheduledAlgorithms() ([]*data.Algorithm, error) {
+	query := `
+		SELECT id, user_id, name, description, code, status,
+		       symbol, timeframe, execution_mode, broker, enabled,
+		       config, state, last_run_at, last_signal,
+		       total_trades, win_rate, total_pnl, version, tags, graph,
+		       created_at, updated_at
+		FROM algorithms
+		WHERE enabled = 1 AND status = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, string(data.AlgorithmStatusLive))
+	if err != nil {
+		utils.LogError(err, "Failed to get scheduled algorithms")
+		return nil, fmt.Errorf("failed to get algorithms: %w", err)
+	}
+	defer rows.Close()
+
+	var algorithms []*data.Algorithm
+	for rows.Next() {
+		algo, err := r.scanAlgorithm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm: %w", err)
+		}
+		algorithms = append(algorithms, algo)
+	}
+
+	return algorithms, rows.Err()
+}
+
 // UpdateAlgorithm updates an existing algorithm
 func (r *AlgorithmRepository) UpdateAlgorithm(algo *data.Algorithm) error {
 	// Convert JSON fields
@@ -268,6 +350,11 @@ func (r *AlgorithmRepository) UpdateAlgorithm(algo *data.Algorithm) error {
 		tagsJSON = []byte("[]")
 	}
 
+	graphValue, err := marshalGraph(algo.Graph)
+	if err != nil {
+		return err
+	}
+
 	var brokerValue interface{}
 	if algo.Broker != nil {
 		brokerValue = string(*algo.Broker)
@@ -283,7 +370,7 @@ func (r *AlgorithmRepository) UpdateAlgorithm(algo *data.Algorithm) error {
 		SET name = ?, description = ?, code = ?, status = ?,
 		    symbol = ?, timeframe = ?, execution_mode = ?, broker = ?, enabled = ?,
 		    config = ?, state = ?, last_run_at = ?, last_signal = ?,
-		    total_trades = ?, win_rate = ?, total_pnl = ?, version = ?, tags = ?,
+		    total_trades = ?, win_rate = ?, total_pnl = ?, version = ?, tags = ?, graph = ?,
 		    updated_at = ?
 		WHERE id = ? AND user_id = ?
 	`
@@ -308,6 +395,7 @@ func (r *AlgorithmRepository) UpdateAlgorithm(algo *data.Algorithm) error {
 		algo.TotalPnL,
 		algo.Version,
 		string(tagsJSON),
+		graphValue,
 		algo.UpdatedAt.Format(time.RFC3339),
 		algo.ID,
 		algo.UserID,
@@ -330,14 +418,53 @@ func (r *AlgorithmRepository) UpdateAlgorithm(algo *data.Algorithm) error {
 	return nil
 }
 
-// DeleteAlgorithm deletes an algorithm
-func (r *AlgorithmRepository) DeleteAlgorithm(id string, userID int) error {
-	query := `DELETE FROM algorithms WHERE id = ? AND user_id = ?`
+// RecordRun stores the outcome of running an algorithm without touching its definition
+func (r *AlgorithmRepository) RecordRun(id string, userID int, ranAt time.Time, signal string, state map[string]interface{}) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	query := `
+		UPDATE algorithms
+		SET last_run_at = ?, last_signal = ?, state = ?
+		WHERE id = ? AND user_id = ?
+	`
+
+	result, err := r.db.Exec(query, ranAt.Format(time.RFC3339), signal, string(stateJSON), id, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to record algorithm run", map[string]interface{}{
+			"algorithm_id": id,
+		})
+		return fmt.Errorf("failed to record algorithm run: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("algorithm not found or user mismatch")
+	}
+
+	return nil
+}
+
+// RecordPerformance stores an algorithm's trade count, win rate and realized P&L
+func (r *AlgorithmRepository) RecordPerformance(id string, userID int, totalTrades int, winRate, totalPnL float64) error {
+	query := `
+		UPDATE algorithms
+		SET total_trades = ?, win_rate = ?, total_pnl = ?
+		WHERE id = ? AND user_id = ?
+	`
 
-	result, err := r.db.Exec(query, id, userID)
+	result, err := r.db.Exec(query, totalTrades, winRate, totalPnL, id, userID)
 	if err != nil {
-		utils.LogError(err, "Failed to delete algorithm")
-		return fmt.Errorf("failed to delete algorithm: %w", err)
+		utils.LogError(err, "Failed to record algorithm performance", map[string]interface{}{
+			"algorithm_id": id,
+		})
+		return fmt.Errorf("failed to record algorithm performance: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -352,12 +479,39 @@ func (r *AlgorithmRepository) DeleteAlgorithm(id string, userID int) error {
 	return nil
 }
 
+// DeleteAlgorithm deletes an algorithm of userID and its child rows, all or nothing
+// It checks the owner before deleting anything and runs in one transaction, the repository's own
+// when it has one.
+func (r *AlgorithmRepository) DeleteAlgorithm(id string, userID int) error {
+	return inTx(r.db, func(tx Querier) error {
+		var owner int
+		err := tx.QueryRow(`SELECT user_id FROM algorithms WHERE id = ?`, id).Scan(&owner)
+		if err == sql.ErrNoRows || (err == nil && owner != userID) {
+			return fmt.Errorf("algorithm not found or user mismatch")
+		}
+		if err != nil {
+			utils.LogError(err, "Failed to get algorithm owner")
+			return fmt.Errorf("failed to get algorithm: %w", err)
+		}
+
+		repo := &AlgorithmRepository{db: tx}
+		if err := repo.deleteChildren("id = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM algorithms WHERE id = ?`, id); err != nil {
+			utils.LogError(err, "Failed to delete algorithm")
+			return fmt.Errorf("failed to delete algorithm: %w", err)
+		}
+		return nil
+	})
+}
+
 // scanAlgorithm scans a row into an Algorithm struct
 func (r *AlgorithmRepository) scanAlgorithm(rows *sql.Rows) (*data.Algorithm, error) {
 	var algo data.Algorithm
 	var statusStr, timeframeStr, executionModeStr, brokerStr sql.NullString
 	var description, lastSignal sql.NullString
-	var lastRunAtStr sql.NullString
+	var lastRunAtStr, graphJSON sql.NullString
 	var configJSON, stateJSON, tagsJSON string
 	var createdAtStr, updatedAtStr string
 
@@ -382,6 +536,7 @@ func (r *AlgorithmRepository) scanAlgorithm(rows *sql.Rows) (*data.Algorithm, er
 		&algo.TotalPnL,
 		&algo.Version,
 		&tagsJSON,
+		&graphJSON,
 		&createdAtStr,
 		&updatedAtStr,
 	)
@@ -421,6 +576,12 @@ func (r *AlgorithmRepository) scanAlgorithm(rows *sql.Rows) (*data.Algorithm, er
 		algo.Tags = []string{}
 	}
 
+	if graphJSON.Valid {
+		if err := json.Unmarshal([]byte(graphJSON.String), &algo.Graph); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal graph: %w", err)
+		}
+	}
+
 	// Parse timestamps
 	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
 	if err != nil {
@@ -444,3 +605,57 @@ func (r *AlgorithmRepository) scanAlgorithm(rows *sql.Rows) (*data.Algorithm, er
 	return &algo, nil
 }
 
+// DeleteAllAlgorithmsByUser deletes every algorithm owned by a user and returns how many were removed
+// Child rows are deleted with them in one transaction, the repository's own when it has one.
+func (r *AlgorithmRepository) DeleteAllAlgorithmsByUser(userID int) (int64, error) {
+	var deleted int64
+	err := inTx(r.db, func(tx Querier) error {
+		repo := &AlgorithmRepository{db: tx}
+		if err := repo.deleteChildren("user_id = ?", userID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("DELETE FROM algorithms WHERE user_id = ?", userID)
+		if err != nil {
+			utils.LogError(err, "Failed to delete all algorithms by user", map[string]interface{}{
+				"user_id": userID,
+			})
+			return fmt.Errorf("failed to delete algorithms: %w", err)
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
+
+// algorithmChildTables hold rows keyed by algorithm_id that are deleted with their algorithm
+// Their foreign keys cascade, but SQLite only enforces foreign keys when a connection enables them.
+var algorithmChildTables = []string{
+	"algorithm_runs", "algorithm_versions", "algorithm_schedules", "backtests", "paper_accounts",
+}
+
+// deleteChildren deletes the child rows of the algorithms matching where
+func (r *AlgorithmRepository) deleteChildren(where string, args ...interface{}) error {
+	for _, table := range algorithmChildTables {
+		query := fmt.Sprintf("DELETE FROM %s WHERE algorithm_id IN (SELECT id FROM algorithms WHERE %s)", table, where)
+		if _, err := r.db.Exec(query, args...); err != nil {
+			utils.LogError(err, "Failed to delete algorithm child rows", map[string]interface{}{
+				"table": table,
+			})
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// marshalGraph encodes a canvas graph for its JSON column; nil stays NULL
+func marshalGraph(graph *data.AlgorithmGraph) (interface{}, error) {
+	if graph == nil {
+		return nil, nil
+	}
+	graphJSON, err := json.Marshal(graph)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal graph: %w", err)
+	}
+	return string(graphJSON), nil
+}
@@ -0,0 +1,231 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// AlgorithmRunRepository handles the audit log of algorithm evaluations
+type AlgorithmRunRepository struct {
+	db Querier
+}
+
+// NewAlgorithmRunRepository creates a new algorithm run repository
+func NewAlgorithmRunRepository(db *sql.DB) *AlgorithmRunRepository {
+	return &AlgorithmRunRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *AlgorithmRunRepository) WithTx(tx *sql.Tx) *AlgorithmRunRepository {
+	return &AlgorithmRunRepository{db: tx}
+}
+
+const algorithmRunColumns = `
+	id, algorithm_id, user_id, source, status, symbol, bar_at, bars,
+	signal, quantity, price, stop_loss, target, reason, state_diff, logs, error,
+	steps, duration_ms, created_at, algorithm_version
+`
+
+// AlgorithmRunFilter narrows an algorithm's run listing
+// Nil fields are ignored; From and To bound created_at, To exclusive.
+type AlgorithmRunFilter struct {
+	Source *data.AlgorithmRunSource
+	Status *data.AlgorithmRunStatus
+	Signal *string
+	From   *time.Time
+	To     *time.Time
+}
+
+// whereClause builds the WHERE clause and arguments for an algorithm's runs matching the filter
+func (f AlgorithmRunFilter) whereClause(algorithmID string, userID int) (string, []interface{}) {
+	conditions := []string{"algorithm_id = ?", "user_id = ?"}
+	args := []interface{}{algorithmID, userID}
+
+	if f.Source != nil {
+		conditions = append(conditions, "source = ?")
+		args = append(args, string(*f.Source))
+	}
+	if f.Status != nil {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(*f.Status))
+	}
+	if f.Signal != nil {
+		conditions = append(conditions, "signal = ?")
+		args = append(args, *f.Signal)
+	}
+	if f.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if f.To != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, f.To.UTC())
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// CreateRun records one evaluation of an algorithm
+func (r *AlgorithmRunRepository) CreateRun(run *data.AlgorithmRun) error {
+	var stateDiffJSON, logsJSON interface{}
+	if run.StateDiff != nil {
+		encoded, err := json.Marshal(run.StateDiff)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state diff: %w", err)
+		}
+		stateDiffJSON = string(encoded)
+	}
+	if len(run.Logs) > 0 {
+		encoded, err := json.Marshal(run.Logs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal logs: %w", err)
+		}
+		logsJSON = string(encoded)
+	}
+
+	query := `
+		INSERT INTO algorithm_runs (` + algorithmRunColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.Exec(query,
+		run.ID, run.AlgorithmID, run.UserID, string(run.Source), string(run.Status), run.Symbol, run.BarAt, run.Bars,
+		run.Signal, run.Quantity, run.Price, run.StopLoss, run.Target, run.Reason, stateDiffJSON, logsJSON, run.Error,
+		run.Steps, run.DurationMs, run.CreatedAt, run.AlgorithmVersion,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create algorithm run", map[string]interface{}{
+			"algorithm_id": run.AlgorithmID,
+		})
+		return fmt.Errorf("failed to create algorithm run: %w", err)
+	}
+
+	return nil
+}
+
+// GetRunByID returns one run of a user's algorithm
+func (r *AlgorithmRunRepository) GetRunByID(id, algorithmID string, userID int) (*data.AlgorithmRun, error) {
+	query := `
+		SELECT ` + algorithmRunColumns + `
+		FROM algorithm_runs
+		WHERE id = ? AND algorithm_id = ? AND user_id = ?
+	`
+
+	run, err := scanAlgorithmRun(r.db.QueryRow(query, id, algorithmID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("algorithm run not found")
+		}
+		utils.LogError(err, "Failed to get algorithm run")
+		return nil, fmt.Errorf("failed to get algorithm run: %w", err)
+	}
+
+	return run, nil
+}
+
+// GetRuns returns a page of an algorithm's runs matching the filter, newest first
+func (r *AlgorithmRunRepository) GetRuns(algorithmID string, userID int, filter AlgorithmRunFilter, limit, offset int) ([]*data.AlgorithmRun, error) {
+	where, args := filter.whereClause(algorithmID, userID)
+	query := `
+		SELECT ` + algorithmRunColumns + `
+		FROM algorithm_runs
+		` + where + `
+		ORDER BY created_at DESC, rowid DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		utils.LogError(err, "Failed to get algorithm runs")
+		return nil, fmt.Errorf("failed to get algorithm runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*data.AlgorithmRun{}
+	for rows.Next() {
+		run, err := scanAlgorithmRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetAllRunsByUser returns the runs of all of a user's algorithms, oldest first
+func (r *AlgorithmRunRepository) GetAllRunsByUser(userID int) ([]*data.AlgorithmRun, error) {
+	query := `
+		SELECT ` + algorithmRunColumns + `
+		FROM algorithm_runs
+		WHERE user_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all algorithm runs by user")
+		return nil, fmt.Errorf("failed to get algorithm runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*data.AlgorithmRun{}
+	for rows.Next() {
+		run, err := scanAlgorithmRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// CountRuns counts an algorithm's runs matching the filter
+func (r *AlgorithmRunRepository) CountRuns(algorithmID string, userID int, filter AlgorithmRunFilter) (int, error) {
+	where, args := filter.whereClause(algorithmID, userID)
+
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM algorithm_runs `+where, args...).Scan(&count); err != nil {
+		utils.LogError(err, "Failed to count algorithm runs")
+		return 0, fmt.Errorf("failed to count algorithm runs: %w", err)
+	}
+
+	return count, nil
+}
+
+// scanAlgorithmRun scans algorithmRunColumns
+func scanAlgorithmRun(row interface{ Scan(...interface{}) error }) (*data.AlgorithmRun, error) {
+	var run data.AlgorithmRun
+	var source, status string
+	var stateDiffJSON, logsJSON sql.NullString
+	err := row.Scan(
+		&run.ID, &run.AlgorithmID, &run.UserID, &source, &status, &run.Symbol, &run.BarAt, &run.Bars,
+		&run.Signal, &run.Quantity, &run.Price, &run.StopLoss, &run.Target, &run.Reason, &stateDiffJSON, &logsJSON, &run.Error,
+		&run.Steps, &run.DurationMs, &run.CreatedAt, &run.AlgorithmVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Source = data.AlgorithmRunSource(source)
+	run.Status = data.AlgorithmRunStatus(status)
+	if stateDiffJSON.Valid {
+		if err := json.Unmarshal([]byte(stateDiffJSON.String), &run.StateDiff); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal state diff: %w", err)
+		}
+	}
+	if logsJSON.Valid {
+		if err := json.Unmarshal([]byte(logsJSON.String), &run.Logs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal logs: %w", err)
+		}
+	}
+
+	return &run, nil
+}
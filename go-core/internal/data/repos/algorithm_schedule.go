@@ -0,0 +1,111 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// AlgorithmScheduleRepository tracks which bar closes the scheduler has run algorithms for
+type AlgorithmScheduleRepository struct {
+	db Querier
+}
+
+// NewAlgorithmScheduleRepository creates a new algorithm schedule repository
+func NewAlgorithmScheduleRepository(db *sql.DB) *AlgorithmScheduleRepository {
+	return &AlgorithmScheduleRepository{db: db}
+}
+
+// ClaimBarClose records that an algorithm's run for the bar closing at barClose has started
+// It returns false without changing anything if the algorithm was already run for that bar
+// close or a later one, so each bar close is run at most once, even across restarts.
+func (r *AlgorithmScheduleRepository) ClaimBarClose(algorithmID string, barClose, startedAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO algorithm_schedules (algorithm_id, bar_close, status, started_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(algorithm_id) DO UPDATE SET
+			bar_close = excluded.bar_close, status = excluded.status, started_at = excluded.started_at,
+			signal = NULL, bars = 0, error = NULL, finished_at = NULL, duration_ms = NULL
+		WHERE algorithm_schedules.bar_close < excluded.bar_close
+	`
+
+	result, err := r.db.Exec(query, algorithmID, barClose.UTC(), string(data.AlgorithmScheduleStatusRunning), startedAt.UTC())
+	if err != nil {
+		utils.LogError(err, "Failed to claim scheduled algorithm run", map[string]interface{}{
+			"algorithm_id": algorithmID,
+		})
+		return false, fmt.Errorf("failed to claim scheduled algorithm run: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// FinishRun records the outcome of a claimed run
+func (r *AlgorithmScheduleRepository) FinishRun(schedule *data.AlgorithmSchedule) error {
+	query := `
+		UPDATE algorithm_schedules
+		SET status = ?, signal = ?, bars = ?, error = ?, finished_at = ?, duration_ms = ?
+		WHERE algorithm_id = ? AND bar_close = ?
+	`
+
+	_, err := r.db.Exec(query,
+		string(schedule.Status), schedule.Signal, schedule.Bars, schedule.Error, schedule.FinishedAt, schedule.DurationMs,
+		schedule.AlgorithmID, schedule.BarClose.UTC(),
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to record scheduled algorithm run", map[string]interface{}{
+			"algorithm_id": schedule.AlgorithmID,
+		})
+		return fmt.Errorf("failed to record scheduled algorithm run: %w", err)
+	}
+
+	return nil
+}
+
+// FailInterruptedRuns marks runs left running by a previous process as failed
+func (r *AlgorithmScheduleRepository) FailInterruptedRuns(message string, finishedAt time.Time) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE algorithm_schedules SET status = ?, error = ?, finished_at = ? WHERE status = ?",
+		string(data.AlgorithmScheduleStatusFailed), message, finishedAt.UTC(), string(data.AlgorithmScheduleStatusRunning),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted algorithm runs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// GetSchedule returns an algorithm's latest scheduled run, or nil if it has never been scheduled
+func (r *AlgorithmScheduleRepository) GetSchedule(algorithmID string) (*data.AlgorithmSchedule, error) {
+	query := `
+		SELECT algorithm_id, bar_close, status, signal, bars, error, started_at, finished_at, duration_ms
+		FROM algorithm_schedules
+		WHERE algorithm_id = ?
+	`
+
+	var schedule data.AlgorithmSchedule
+	var status string
+	err := r.db.QueryRow(query, algorithmID).Scan(
+		&schedule.AlgorithmID, &schedule.BarClose, &status, &schedule.Signal, &schedule.Bars, &schedule.Error,
+		&schedule.StartedAt, &schedule.FinishedAt, &schedule.DurationMs,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to get algorithm schedule", map[string]interface{}{
+			"algorithm_id": algorithmID,
+		})
+		return nil, fmt.Errorf("failed to get algorithm schedule: %w", err)
+	}
+	schedule.Status = data.AlgorithmScheduleStatus(status)
+
+	return &schedule, nil
+}
@@ -0,0 +1,84 @@
+package repos
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// newVersionedAlgorithm stores an algorithm of a new user with one version and returns both
+func newVersionedAlgorithm(t *testing.T, conn *sql.DB) (*data.Algorithm, *data.User) {
+	t.Helper()
+	now := time.Now().UTC()
+	user := &data.User{Name: "trader", Email: utils.GenerateID() + "@example.com", CreatedAt: now}
+	if err := NewUserRepository(conn, nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	algo := &data.Algorithm{
+		ID: utils.GenerateID(), UserID: user.ID, Name: "Momentum", Code: "def algorithm(data, context):\n    pass\n",
+		Status: data.AlgorithmStatusDraft, Symbol: "INFY", Timeframe: data.Timeframe1m,
+		ExecutionMode: data.ExecutionModePaperTrading, Version: 1, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := NewAlgorithmRepository(conn).CreateAlgorithm(algo); err != nil {
+		t.Fatalf("create algorithm: %v", err)
+	}
+	version := &data.AlgorithmVersion{
+		ID: utils.GenerateID(), AlgorithmID: algo.ID, UserID: user.ID, Version: 1, Code: algo.Code,
+		AuthorID: user.ID, Message: "Created", CreatedAt: now,
+	}
+	if err := NewAlgorithmVersionRepository(conn).CreateVersion(version); err != nil {
+		t.Fatalf("create version: %v", err)
+	}
+	return algo, user
+}
+
+func TestDeleteAlgorithm(t *testing.T) {
+	conn := testutil.NewDB(t).GetConnection()
+	algo, owner := newVersionedAlgorithm(t, conn)
+	_, other := newVersionedAlgorithm(t, conn)
+	repo, versions := NewAlgorithmRepository(conn), NewAlgorithmVersionRepository(conn)
+
+	remaining := func() (algorithms, versionRows int) {
+		t.Helper()
+		if err := conn.QueryRow(`SELECT COUNT(*) FROM algorithms WHERE id = ?`, algo.ID).Scan(&algorithms); err != nil {
+			t.Fatalf("count algorithms: %v", err)
+		}
+		versionRows, err := versions.CountVersions(algo.ID, owner.ID)
+		if err != nil {
+			t.Fatalf("count versions: %v", err)
+		}
+		return algorithms, versionRows
+	}
+
+	if err := repo.DeleteAlgorithm(algo.ID, other.ID); err == nil {
+		t.Fatal("deleted another user's algorithm")
+	}
+	if algorithms, versionRows := remaining(); algorithms != 1 || versionRows != 1 {
+		t.Fatalf("after another user's delete: %d algorithms and %d versions, want both kept", algorithms, versionRows)
+	}
+
+	// A child delete failing part way rolls back the deletes before it
+	if _, err := conn.Exec(`ALTER TABLE paper_accounts RENAME TO paper_accounts_moved`); err != nil {
+		t.Fatalf("move paper accounts: %v", err)
+	}
+	if err := repo.DeleteAlgorithm(algo.ID, owner.ID); err == nil {
+		t.Fatal("deleted the algorithm without its paper accounts table")
+	}
+	if algorithms, versionRows := remaining(); algorithms != 1 || versionRows != 1 {
+		t.Fatalf("after a failed delete: %d algorithms and %d versions, want both kept", algorithms, versionRows)
+	}
+	if _, err := conn.Exec(`ALTER TABLE paper_accounts_moved RENAME TO paper_accounts`); err != nil {
+		t.Fatalf("restore paper accounts: %v", err)
+	}
+
+	if err := repo.DeleteAlgorithm(algo.ID, owner.ID); err != nil {
+		t.Fatalf("DeleteAlgorithm: %v", err)
+	}
+	if algorithms, versionRows := remaining(); algorithms != 0 || versionRows != 0 {
+		t.Fatalf("after the owner's delete: %d algorithms and %d versions, want none", algorithms, versionRows)
+	}
+}
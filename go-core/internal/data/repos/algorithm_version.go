@@ -0,0 +1,201 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// AlgorithmVersionRepository handles the version history of algorithms
+type AlgorithmVersionRepository struct {
+	db Querier
+}
+
+// NewAlgorithmVersionRepository creates a new algorithm version repository
+func NewAlgorithmVersionRepository(db *sql.DB) *AlgorithmVersionRepository {
+	return &AlgorithmVersionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *AlgorithmVersionRepository) WithTx(tx *sql.Tx) *AlgorithmVersionRepository {
+	return &AlgorithmVersionRepository{db: tx}
+}
+
+const algorithmVersionColumns = `
+	id, algorithm_id, user_id, version, code, config, author_id, message, created_at, graph
+`
+
+// CreateVersion stores a version; versions are never updated
+func (r *AlgorithmVersionRepository) CreateVersion(version *data.AlgorithmVersion) error {
+	config := version.Config
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	graphValue, err := marshalGraph(version.Graph)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO algorithm_versions (` + algorithmVersionColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = r.db.Exec(query,
+		version.ID, version.AlgorithmID, version.UserID, version.Version, version.Code, string(configJSON),
+		version.AuthorID, version.Message, version.CreatedAt, graphValue,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create algorithm version", map[string]interface{}{
+			"algorithm_id": version.AlgorithmID,
+			"version":      version.Version,
+		})
+		return fmt.Errorf("failed to create algorithm version: %w", err)
+	}
+
+	return nil
+}
+
+// GetVersion returns one version of a user's algorithm
+func (r *AlgorithmVersionRepository) GetVersion(algorithmID string, userID, version int) (*data.AlgorithmVersion, error) {
+	query := `
+		SELECT ` + algorithmVersionColumns + `
+		FROM algorithm_versions
+		WHERE algorithm_id = ? AND user_id = ? AND version = ?
+	`
+
+	found, err := scanAlgorithmVersion(r.db.QueryRow(query, algorithmID, userID, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("algorithm version not found")
+		}
+		utils.LogError(err, "Failed to get algorithm version")
+		return nil, fmt.Errorf("failed to get algorithm version: %w", err)
+	}
+
+	return found, nil
+}
+
+// GetLatestVersion returns the newest version of a user's algorithm, or nil if it has none
+func (r *AlgorithmVersionRepository) GetLatestVersion(algorithmID string, userID int) (*data.AlgorithmVersion, error) {
+	query := `
+		SELECT ` + algorithmVersionColumns + `
+		FROM algorithm_versions
+		WHERE algorithm_id = ? AND user_id = ?
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	found, err := scanAlgorithmVersion(r.db.QueryRow(query, algorithmID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.LogError(err, "Failed to get latest algorithm version")
+		return nil, fmt.Errorf("failed to get latest algorithm version: %w", err)
+	}
+
+	return found, nil
+}
+
+// GetVersions returns a page of an algorithm's versions, newest first
+func (r *AlgorithmVersionRepository) GetVersions(algorithmID string, userID int, limit, offset int) ([]*data.AlgorithmVersion, error) {
+	query := `
+		SELECT ` + algorithmVersionColumns + `
+		FROM algorithm_versions
+		WHERE algorithm_id = ? AND user_id = ?
+		ORDER BY version DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, algorithmID, userID, limit, offset)
+	if err != nil {
+		utils.LogError(err, "Failed to get algorithm versions")
+		return nil, fmt.Errorf("failed to get algorithm versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*data.AlgorithmVersion{}
+	for rows.Next() {
+		found, err := scanAlgorithmVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm version: %w", err)
+		}
+		versions = append(versions, found)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetAllVersionsByUser returns the versions of all of a user's algorithms, oldest first
+func (r *AlgorithmVersionRepository) GetAllVersionsByUser(userID int) ([]*data.AlgorithmVersion, error) {
+	query := `
+		SELECT ` + algorithmVersionColumns + `
+		FROM algorithm_versions
+		WHERE user_id = ?
+		ORDER BY algorithm_id ASC, version ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all algorithm versions by user")
+		return nil, fmt.Errorf("failed to get algorithm versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*data.AlgorithmVersion{}
+	for rows.Next() {
+		found, err := scanAlgorithmVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algorithm version: %w", err)
+		}
+		versions = append(versions, found)
+	}
+
+	return versions, rows.Err()
+}
+
+// CountVersions counts an algorithm's versions
+func (r *AlgorithmVersionRepository) CountVersions(algorithmID string, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM algorithm_versions WHERE algorithm_id = ? AND user_id = ?`, algorithmID, userID).Scan(&count)
+	if err != nil {
+		utils.LogError(err, "Failed to count algorithm versions")
+		return 0, fmt.Errorf("failed to count algorithm versions: %w", err)
+	}
+
+	return count, nil
+}
+
+// scanAlgorithmVersion scans algorithmVersionColumns
+func scanAlgorithmVersion(row interface{ Scan(...interface{}) error }) (*data.AlgorithmVersion, error) {
+	var version data.AlgorithmVersion
+	var configJSON string
+	var graphJSON sql.NullString
+	err := row.Scan(
+		&version.ID, &version.AlgorithmID, &version.UserID, &version.Version, &version.Code, &configJSON,
+		&version.AuthorID, &version.Message, &version.CreatedAt, &graphJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(configJSON), &version.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if graphJSON.Valid {
+		if err := json.Unmarshal([]byte(graphJSON.String), &version.Graph); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal graph: %w", err)
+		}
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,200 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// BacktestRepository handles stored backtest runs
+type BacktestRepository struct {
+	db Querier
+}
+
+// NewBacktestRepository creates a new backtest repository
+func NewBacktestRepository(db *sql.DB) *BacktestRepository {
+	return &BacktestRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *BacktestRepository) WithTx(tx *sql.Tx) *BacktestRepository {
+	return &BacktestRepository{db: tx}
+}
+
+const backtestSummaryColumns = `
+	id, algorithm_id, user_id, symbol, timeframe, settings, status, error,
+	bar_count, start_at, end_at, metrics, duration_ms, created_at, algorithm_version
+`
+
+// CreateBacktest stores a finished backtest run
+func (r *BacktestRepository) CreateBacktest(backtest *data.Backtest) error {
+	settingsJSON, err := json.Marshal(backtest.Settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	metricsJSON, err := json.Marshal(backtest.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+	trades := backtest.Trades
+	if trades == nil {
+		trades = []data.SimulatedTrade{}
+	}
+	tradesJSON, err := json.Marshal(trades)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trades: %w", err)
+	}
+	curve := backtest.EquityCurve
+	if curve == nil {
+		curve = []data.EquityPoint{}
+	}
+	curveJSON, err := json.Marshal(curve)
+	if err != nil {
+		return fmt.Errorf("failed to marshal equity curve: %w", err)
+	}
+
+	query := `
+		INSERT INTO backtests (` + backtestSummaryColumns + `, trades, equity_curve)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = r.db.Exec(query,
+		backtest.ID, backtest.AlgorithmID, backtest.UserID, backtest.Symbol, string(backtest.Timeframe),
+		string(settingsJSON), string(backtest.Status), backtest.Error,
+		backtest.Bars, backtest.StartAt, backtest.EndAt, string(metricsJSON), backtest.DurationMs, backtest.CreatedAt,
+		backtest.AlgorithmVersion, string(tradesJSON), string(curveJSON),
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create backtest", map[string]interface{}{
+			"algorithm_id": backtest.AlgorithmID,
+		})
+		return fmt.Errorf("failed to create backtest: %w", err)
+	}
+
+	return nil
+}
+
+// GetBacktestByID returns one of a user's backtests with its trades and equity curve
+func (r *BacktestRepository) GetBacktestByID(id, algorithmID string, userID int) (*data.Backtest, error) {
+	query := `
+		SELECT ` + backtestSummaryColumns + `, trades, equity_curve
+		FROM backtests
+		WHERE id = ? AND algorithm_id = ? AND user_id = ?
+	`
+
+	backtest, err := scanFullBacktest(r.db.QueryRow(query, id, algorithmID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("backtest not found")
+		}
+		utils.LogError(err, "Failed to get backtest")
+		return nil, fmt.Errorf("failed to get backtest: %w", err)
+	}
+
+	return backtest, nil
+}
+
+// GetAllBacktestsByUser returns the backtests of all of a user's algorithms with their trades
+// and equity curves, oldest first
+func (r *BacktestRepository) GetAllBacktestsByUser(userID int) ([]*data.Backtest, error) {
+	query := `
+		SELECT ` + backtestSummaryColumns + `, trades, equity_curve
+		FROM backtests
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all backtests by user")
+		return nil, fmt.Errorf("failed to get backtests: %w", err)
+	}
+	defer rows.Close()
+
+	backtests := []*data.Backtest{}
+	for rows.Next() {
+		backtest, err := scanFullBacktest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan backtest: %w", err)
+		}
+		backtests = append(backtests, backtest)
+	}
+
+	return backtests, rows.Err()
+}
+
+// GetBacktestsByAlgorithm returns summaries of an algorithm's backtests, newest first
+// Trades and equity curves are left out; fetch a single backtest for those.
+func (r *BacktestRepository) GetBacktestsByAlgorithm(algorithmID string, userID int, limit, offset int) ([]*data.Backtest, error) {
+	query := `
+		SELECT ` + backtestSummaryColumns + `
+		FROM backtests
+		WHERE algorithm_id = ? AND user_id = ?
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, algorithmID, userID, limit, offset)
+	if err != nil {
+		utils.LogError(err, "Failed to get backtests")
+		return nil, fmt.Errorf("failed to get backtests: %w", err)
+	}
+	defer rows.Close()
+
+	backtests := []*data.Backtest{}
+	for rows.Next() {
+		backtest, err := scanBacktest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan backtest: %w", err)
+		}
+		backtests = append(backtests, backtest)
+	}
+
+	return backtests, rows.Err()
+}
+
+// scanBacktest scans backtestSummaryColumns followed by any extra destinations
+func scanBacktest(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*data.Backtest, error) {
+	var backtest data.Backtest
+	var timeframe, status, settingsJSON, metricsJSON string
+	dest := []interface{}{
+		&backtest.ID, &backtest.AlgorithmID, &backtest.UserID, &backtest.Symbol, &timeframe, &settingsJSON, &status, &backtest.Error,
+		&backtest.Bars, &backtest.StartAt, &backtest.EndAt, &metricsJSON, &backtest.DurationMs, &backtest.CreatedAt,
+		&backtest.AlgorithmVersion,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	backtest.Timeframe = data.Timeframe(timeframe)
+	backtest.Status = data.BacktestStatus(status)
+	if err := json.Unmarshal([]byte(settingsJSON), &backtest.Settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+	if err := json.Unmarshal([]byte(metricsJSON), &backtest.Metrics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metrics: %w", err)
+	}
+
+	return &backtest, nil
+}
+
+// scanFullBacktest scans backtestSummaryColumns followed by the trades and equity curve
+func scanFullBacktest(row interface{ Scan(...interface{}) error }) (*data.Backtest, error) {
+	var tradesJSON, curveJSON string
+	backtest, err := scanBacktest(row, &tradesJSON, &curveJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tradesJSON), &backtest.Trades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trades: %w", err)
+	}
+	if err := json.Unmarshal([]byte(curveJSON), &backtest.EquityCurve); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal equity curve: %w", err)
+	}
+
+	return backtest, nil
+}
@@ -0,0 +1,221 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// BrokerFillRepository handles the broker fill ledger
+type BrokerFillRepository struct {
+	db Querier
+}
+
+// NewBrokerFillRepository creates a new broker fill repository
+func NewBrokerFillRepository(db *sql.DB) *BrokerFillRepository {
+	return &BrokerFillRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *BrokerFillRepository) WithTx(tx *sql.Tx) *BrokerFillRepository {
+	return &BrokerFillRepository{db: tx}
+}
+
+const brokerFillColumns = `
+	id, user_id, trading_broker, trade_id, order_id, exchange_order_id, symbol, product_type,
+	side, quantity, price, fill_time, created_at, updated_at
+`
+
+// CreateFill records a broker fill
+func (r *BrokerFillRepository) CreateFill(fill *data.BrokerFill) error {
+	query := `INSERT INTO broker_fills (` + brokerFillColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.Exec(query,
+		fill.ID, fill.UserID, string(fill.TradingBroker), fill.TradeID, fill.OrderID, fill.ExchangeOrderID,
+		fill.Symbol, fill.ProductType, fill.Side, fill.Quantity, fill.Price, fill.FillTime,
+		fill.CreatedAt, fill.UpdatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create broker fill", map[string]interface{}{
+			"user_id":  fill.UserID,
+			"trade_id": fill.TradeID,
+		})
+		return fmt.Errorf("failed to create broker fill: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateFill overwrites a recorded fill with the broker's current version
+func (r *BrokerFillRepository) UpdateFill(fill *data.BrokerFill) error {
+	query := `
+		UPDATE broker_fills SET
+			order_id = ?, exchange_order_id = ?, symbol = ?, product_type = ?,
+			side = ?, quantity = ?, price = ?, fill_time = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`
+
+	result, err := r.db.Exec(query,
+		fill.OrderID, fill.ExchangeOrderID, fill.Symbol, fill.ProductType,
+		fill.Side, fill.Quantity, fill.Price, fill.FillTime, fill.UpdatedAt,
+		fill.ID, fill.UserID,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to update broker fill", map[string]interface{}{
+			"user_id":  fill.UserID,
+			"trade_id": fill.TradeID,
+		})
+		return fmt.Errorf("failed to update broker fill: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("broker fill not found or not owned by user")
+	}
+
+	return nil
+}
+
+// DeleteFill removes a recorded fill
+func (r *BrokerFillRepository) DeleteFill(fillID string, userID int) error {
+	if _, err := r.db.Exec("DELETE FROM broker_fills WHERE id = ? AND user_id = ?", fillID, userID); err != nil {
+		utils.LogError(err, "Failed to delete broker fill", map[string]interface{}{
+			"fill_id": fillID,
+			"user_id": userID,
+		})
+		return fmt.Errorf("failed to delete broker fill: %w", err)
+	}
+
+	return nil
+}
+
+// FillExists reports whether a fill with the exchange trade ID is already recorded
+func (r *BrokerFillRepository) FillExists(userID int, tradingBroker data.TradingBroker, tradeID string) (bool, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM broker_fills WHERE user_id = ? AND trading_broker = ? AND trade_id = ?",
+		userID, string(tradingBroker), tradeID,
+	).Scan(&count)
+	if err != nil {
+		utils.LogError(err, "Failed to check if broker fill exists", map[string]interface{}{
+			"user_id":  userID,
+			"trade_id": tradeID,
+		})
+		return false, fmt.Errorf("failed to check if broker fill exists: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// OrderHasFills reports whether any fill of the order is recorded
+// Orders journaled before the ledger existed have trades but no fills
+func (r *BrokerFillRepository) OrderHasFills(userID int, tradingBroker data.TradingBroker, orderID string) (bool, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM broker_fills WHERE user_id = ? AND trading_broker = ? AND order_id = ?",
+		userID, string(tradingBroker), orderID,
+	).Scan(&count)
+	if err != nil {
+		utils.LogError(err, "Failed to check broker fills by order", map[string]interface{}{
+			"user_id":  userID,
+			"order_id": orderID,
+		})
+		return false, fmt.Errorf("failed to check broker fills: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// GetFillsInRange returns a user's recorded fills from a broker with fill_time in [from, to), oldest first
+func (r *BrokerFillRepository) GetFillsInRange(userID int, tradingBroker data.TradingBroker, from, to time.Time) ([]*data.BrokerFill, error) {
+	query := `
+		SELECT ` + brokerFillColumns + `
+		FROM broker_fills
+		WHERE user_id = ? AND trading_broker = ? AND fill_time >= ? AND fill_time < ?
+		ORDER BY fill_time ASC, trade_id ASC
+	`
+
+	return r.queryFills(query, userID, string(tradingBroker), from, to)
+}
+
+// GetAllBrokerFillsByUser returns every recorded fill of a user, oldest first
+func (r *BrokerFillRepository) GetAllBrokerFillsByUser(userID int) ([]*data.BrokerFill, error) {
+	query := `
+		SELECT ` + brokerFillColumns + `
+		FROM broker_fills
+		WHERE user_id = ?
+		ORDER BY fill_time ASC, trade_id ASC
+	`
+
+	return r.queryFills(query, userID)
+}
+
+// queryFills runs a fill query and scans the rows
+func (r *BrokerFillRepository) queryFills(query string, args ...interface{}) ([]*data.BrokerFill, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker fills", map[string]interface{}{
+			"user_id": args[0],
+		})
+		return nil, fmt.Errorf("failed to get broker fills: %w", err)
+	}
+	defer rows.Close()
+
+	var fills []*data.BrokerFill
+	for rows.Next() {
+		var fill data.BrokerFill
+		var broker string
+		err := rows.Scan(
+			&fill.ID, &fill.UserID, &broker, &fill.TradeID, &fill.OrderID, &fill.ExchangeOrderID,
+			&fill.Symbol, &fill.ProductType, &fill.Side, &fill.Quantity, &fill.Price, &fill.FillTime,
+			&fill.CreatedAt, &fill.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broker fill: %w", err)
+		}
+		fill.TradingBroker = data.TradingBroker(broker)
+		fills = append(fills, &fill)
+	}
+
+	return fills, rows.Err()
+}
+
+// GetFillsByOrderIDs returns a user's recorded fills from a broker belonging to any of the orders, oldest first
+func (r *BrokerFillRepository) GetFillsByOrderIDs(userID int, tradingBroker data.TradingBroker, orderIDs []string) ([]*data.BrokerFill, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userID, string(tradingBroker)}
+	for _, orderID := range orderIDs {
+		args = append(args, orderID)
+	}
+	query := `
+		SELECT ` + brokerFillColumns + `
+		FROM broker_fills
+		WHERE user_id = ? AND trading_broker = ? AND order_id IN (?` + strings.Repeat(", ?", len(orderIDs)-1) + `)
+		ORDER BY fill_time ASC, trade_id ASC
+	`
+
+	return r.queryFills(query, args...)
+}
+
+// DeleteAllBrokerFillsByUser deletes every recorded fill of a user and returns how many were removed
+func (r *BrokerFillRepository) DeleteAllBrokerFillsByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM broker_fills WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all broker fills by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete broker fills: %w", err)
+	}
+
+	return result.RowsAffected()
+}
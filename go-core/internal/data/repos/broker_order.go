@@ -0,0 +1,288 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// BrokerOrderRepository handles the broker order book and order events
+type BrokerOrderRepository struct {
+	db Querier
+}
+
+// NewBrokerOrderRepository creates a new broker order repository
+func NewBrokerOrderRepository(db *sql.DB) *BrokerOrderRepository {
+	return &BrokerOrderRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *BrokerOrderRepository) WithTx(tx *sql.Tx) *BrokerOrderRepository {
+	return &BrokerOrderRepository{db: tx}
+}
+
+const brokerOrderColumns = `
+	id, user_id, trading_broker, order_id, exchange_order_id, parent_order_id, symbol, exchange,
+	product_type, order_type, side, quantity, filled_quantity, price, trigger_price, average_price,
+	status, broker_status, status_message, placed_at, last_updated_at, created_at, updated_at
+`
+
+const brokerOrderEventColumns = `
+	id, broker_order_id, user_id, status, broker_status, quantity, filled_quantity,
+	price, trigger_price, message, event_time, created_at
+`
+
+// BrokerOrderFilter narrows a user's broker orders
+type BrokerOrderFilter struct {
+	TradingBroker *data.TradingBroker
+	Symbol        *string
+	Status        *string
+	OrderIDs      []string   // broker order IDs
+	From          *time.Time // placed at or after
+	To            *time.Time // placed before
+}
+
+// whereClause builds the WHERE clause and arguments for a user's orders matching the filter
+func (f BrokerOrderFilter) whereClause(userID int) (string, []interface{}) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if f.TradingBroker != nil {
+		conditions = append(conditions, "trading_broker = ?")
+		args = append(args, string(*f.TradingBroker))
+	}
+	if f.Symbol != nil {
+		conditions = append(conditions, "symbol = ? COLLATE NOCASE")
+		args = append(args, *f.Symbol)
+	}
+	if f.Status != nil {
+		conditions = append(conditions, "status = ?")
+		args = append(args, *f.Status)
+	}
+	if len(f.OrderIDs) > 0 {
+		conditions = append(conditions, "order_id IN (?"+strings.Repeat(", ?", len(f.OrderIDs)-1)+")")
+		for _, orderID := range f.OrderIDs {
+			args = append(args, orderID)
+		}
+	}
+	if f.From != nil {
+		conditions = append(conditions, "placed_at >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		conditions = append(conditions, "placed_at < ?")
+		args = append(args, *f.To)
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// CreateOrder records a broker order
+func (r *BrokerOrderRepository) CreateOrder(order *data.BrokerOrder) error {
+	query := `INSERT INTO broker_orders (` + brokerOrderColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.Exec(query,
+		order.ID, order.UserID, string(order.TradingBroker), order.OrderID, order.ExchangeOrderID, order.ParentOrderID,
+		order.Symbol, order.Exchange, order.ProductType, order.OrderType, order.Side, order.Quantity,
+		order.FilledQuantity, order.Price, order.TriggerPrice, order.AveragePrice, order.Status, order.BrokerStatus,
+		order.StatusMessage, order.PlacedAt, order.LastUpdatedAt, order.CreatedAt, order.UpdatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create broker order", map[string]interface{}{
+			"user_id":  order.UserID,
+			"order_id": order.OrderID,
+		})
+		return fmt.Errorf("failed to create broker order: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateOrder overwrites a recorded order with its latest state
+func (r *BrokerOrderRepository) UpdateOrder(order *data.BrokerOrder) error {
+	query := `
+		UPDATE broker_orders SET
+			exchange_order_id = ?, parent_order_id = ?, symbol = ?, exchange = ?, product_type = ?,
+			order_type = ?, side = ?, quantity = ?, filled_quantity = ?, price = ?, trigger_price = ?,
+			average_price = ?, status = ?, broker_status = ?, status_message = ?, placed_at = ?,
+			last_updated_at = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`
+
+	result, err := r.db.Exec(query,
+		order.ExchangeOrderID, order.ParentOrderID, order.Symbol, order.Exchange, order.ProductType,
+		order.OrderType, order.Side, order.Quantity, order.FilledQuantity, order.Price, order.TriggerPrice,
+		order.AveragePrice, order.Status, order.BrokerStatus, order.StatusMessage, order.PlacedAt,
+		order.LastUpdatedAt, order.UpdatedAt,
+		order.ID, order.UserID,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to update broker order", map[string]interface{}{
+			"user_id":  order.UserID,
+			"order_id": order.OrderID,
+		})
+		return fmt.Errorf("failed to update broker order: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("broker order not found or not owned by user")
+	}
+
+	return nil
+}
+
+// GetOrderByBrokerID returns a recorded order by its broker order ID, or nil if it is not recorded
+func (r *BrokerOrderRepository) GetOrderByBrokerID(userID int, tradingBroker data.TradingBroker, orderID string) (*data.BrokerOrder, error) {
+	orders, err := r.GetOrders(userID, BrokerOrderFilter{TradingBroker: &tradingBroker, OrderIDs: []string{orderID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return orders[0], nil
+}
+
+// GetOrders returns a user's orders matching the filter, oldest first, without events
+func (r *BrokerOrderRepository) GetOrders(userID int, filter BrokerOrderFilter) ([]*data.BrokerOrder, error) {
+	where, args := filter.whereClause(userID)
+	query := `
+		SELECT ` + brokerOrderColumns + `
+		FROM broker_orders
+		` + where + `
+		ORDER BY placed_at ASC, order_id ASC
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker orders", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, fmt.Errorf("failed to get broker orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*data.BrokerOrder
+	for rows.Next() {
+		var order data.BrokerOrder
+		var broker string
+		err := rows.Scan(
+			&order.ID, &order.UserID, &broker, &order.OrderID, &order.ExchangeOrderID, &order.ParentOrderID,
+			&order.Symbol, &order.Exchange, &order.ProductType, &order.OrderType, &order.Side, &order.Quantity,
+			&order.FilledQuantity, &order.Price, &order.TriggerPrice, &order.AveragePrice, &order.Status, &order.BrokerStatus,
+			&order.StatusMessage, &order.PlacedAt, &order.LastUpdatedAt, &order.CreatedAt, &order.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broker order: %w", err)
+		}
+		order.TradingBroker = data.TradingBroker(broker)
+		orders = append(orders, &order)
+	}
+
+	return orders, rows.Err()
+}
+
+// CreateEvent records an order event unless the same state is already recorded
+// It reports whether a new event was stored
+func (r *BrokerOrderRepository) CreateEvent(event *data.BrokerOrderEvent) (bool, error) {
+	query := `INSERT OR IGNORE INTO broker_order_events (` + brokerOrderEventColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.Exec(query,
+		event.ID, event.BrokerOrderID, event.UserID, event.Status, event.BrokerStatus, event.Quantity,
+		event.FilledQuantity, event.Price, event.TriggerPrice, event.Message, event.EventTime, event.CreatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create broker order event", map[string]interface{}{
+			"user_id":         event.UserID,
+			"broker_order_id": event.BrokerOrderID,
+		})
+		return false, fmt.Errorf("failed to create broker order event: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// LoadEvents attaches each order's events, oldest first
+func (r *BrokerOrderRepository) LoadEvents(userID int, orders []*data.BrokerOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*data.BrokerOrder, len(orders))
+	args := []interface{}{userID}
+	for _, order := range orders {
+		byID[order.ID] = order
+		args = append(args, order.ID)
+	}
+
+	query := `
+		SELECT ` + brokerOrderEventColumns + `
+		FROM broker_order_events
+		WHERE user_id = ? AND broker_order_id IN (?` + strings.Repeat(", ?", len(orders)-1) + `)
+		ORDER BY event_time ASC, created_at ASC
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker order events", map[string]interface{}{
+			"user_id": userID,
+		})
+		return fmt.Errorf("failed to get broker order events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event data.BrokerOrderEvent
+		err := rows.Scan(
+			&event.ID, &event.BrokerOrderID, &event.UserID, &event.Status, &event.BrokerStatus, &event.Quantity,
+			&event.FilledQuantity, &event.Price, &event.TriggerPrice, &event.Message, &event.EventTime, &event.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan broker order event: %w", err)
+		}
+		if order := byID[event.BrokerOrderID]; order != nil {
+			order.Events = append(order.Events, &event)
+		}
+	}
+
+	return rows.Err()
+}
+
+// DeleteAllBrokerOrderEventsByUser deletes every order event of a user and returns how many were removed
+func (r *BrokerOrderRepository) DeleteAllBrokerOrderEventsByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM broker_order_events WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all broker order events by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete broker order events: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteAllBrokerOrdersByUser deletes every order of a user and returns how many were removed
+// Delete the user's order events first; foreign keys are not enforced
+func (r *BrokerOrderRepository) DeleteAllBrokerOrdersByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM broker_orders WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all broker orders by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete broker orders: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,134 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// BrokerPositionRepository handles the broker positions and holdings snapshot
+type BrokerPositionRepository struct {
+	db Querier
+}
+
+// NewBrokerPositionRepository creates a new broker position repository
+func NewBrokerPositionRepository(db *sql.DB) *BrokerPositionRepository {
+	return &BrokerPositionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *BrokerPositionRepository) WithTx(tx *sql.Tx) *BrokerPositionRepository {
+	return &BrokerPositionRepository{db: tx}
+}
+
+const brokerPositionColumns = `
+	id, user_id, trading_broker, kind, symbol, exchange, product_type, isin,
+	quantity, average_price, last_price, day_pnl, pnl, synced_at
+`
+
+// CreatePosition records one snapshot row
+func (r *BrokerPositionRepository) CreatePosition(position *data.BrokerPosition) error {
+	query := `INSERT INTO broker_positions (` + brokerPositionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.Exec(query,
+		position.ID, position.UserID, string(position.TradingBroker), string(position.Kind), position.Symbol,
+		position.Exchange, position.ProductType, position.ISIN, position.Quantity, position.AveragePrice,
+		position.LastPrice, position.DayPnL, position.PnL, position.SyncedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create broker position", map[string]interface{}{
+			"user_id": position.UserID,
+			"symbol":  position.Symbol,
+		})
+		return fmt.Errorf("failed to create broker position: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSnapshot removes a user's snapshot for one broker ahead of a fresh one
+func (r *BrokerPositionRepository) DeleteSnapshot(userID int, tradingBroker data.TradingBroker) error {
+	_, err := r.db.Exec(
+		"DELETE FROM broker_positions WHERE user_id = ? AND trading_broker = ?",
+		userID, string(tradingBroker),
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to delete broker snapshot", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": tradingBroker,
+		})
+		return fmt.Errorf("failed to delete broker snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// GetSnapshot returns a user's latest snapshot for one broker, positions before holdings
+func (r *BrokerPositionRepository) GetSnapshot(userID int, tradingBroker data.TradingBroker) ([]*data.BrokerPosition, error) {
+	query := `
+		SELECT ` + brokerPositionColumns + `
+		FROM broker_positions
+		WHERE user_id = ? AND trading_broker = ?
+		ORDER BY kind DESC, symbol ASC
+	`
+
+	return r.queryPositions(query, userID, string(tradingBroker))
+}
+
+// GetAllBrokerPositionsByUser returns the latest snapshot rows of every broker of a user
+func (r *BrokerPositionRepository) GetAllBrokerPositionsByUser(userID int) ([]*data.BrokerPosition, error) {
+	query := `
+		SELECT ` + brokerPositionColumns + `
+		FROM broker_positions
+		WHERE user_id = ?
+		ORDER BY trading_broker ASC, kind DESC, symbol ASC
+	`
+
+	return r.queryPositions(query, userID)
+}
+
+// queryPositions runs a snapshot query and scans the rows
+func (r *BrokerPositionRepository) queryPositions(query string, args ...interface{}) ([]*data.BrokerPosition, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker snapshot", map[string]interface{}{
+			"user_id": args[0],
+		})
+		return nil, fmt.Errorf("failed to get broker snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []*data.BrokerPosition
+	for rows.Next() {
+		var position data.BrokerPosition
+		var broker, kind string
+		err := rows.Scan(
+			&position.ID, &position.UserID, &broker, &kind, &position.Symbol,
+			&position.Exchange, &position.ProductType, &position.ISIN, &position.Quantity, &position.AveragePrice,
+			&position.LastPrice, &position.DayPnL, &position.PnL, &position.SyncedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broker position: %w", err)
+		}
+		position.TradingBroker = data.TradingBroker(broker)
+		position.Kind = data.BrokerPositionKind(kind)
+		positions = append(positions, &position)
+	}
+
+	return positions, rows.Err()
+}
+
+// DeleteAllBrokerPositionsByUser deletes every snapshot row of a user and returns how many were removed
+func (r *BrokerPositionRepository) DeleteAllBrokerPositionsByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM broker_positions WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all broker positions by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete broker positions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
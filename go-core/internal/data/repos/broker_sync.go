@@ -0,0 +1,394 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// BrokerSyncRepository handles background broker sync runs and schedules
+type BrokerSyncRepository struct {
+	db Querier
+}
+
+// NewBrokerSyncRepository creates a new broker sync repository
+func NewBrokerSyncRepository(db *sql.DB) *BrokerSyncRepository {
+	return &BrokerSyncRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *BrokerSyncRepository) WithTx(tx *sql.Tx) *BrokerSyncRepository {
+	return &BrokerSyncRepository{db: tx}
+}
+
+const brokerSyncRunColumns = `
+	id, user_id, trading_broker, trigger, method, status, stage, fetched_count, saved_count,
+	updated_count, skipped_count, warnings, error, queued_at, started_at, finished_at, duration_ms
+`
+
+// BrokerSyncRunFilter selects a user's sync runs
+type BrokerSyncRunFilter struct {
+	TradingBroker *data.TradingBroker
+	Status        *data.BrokerSyncStatus
+	Limit         int
+}
+
+// CreateRun records a queued sync run
+func (r *BrokerSyncRepository) CreateRun(run *data.BrokerSyncRun) error {
+	warningsJSON, err := json.Marshal(run.Warnings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal warnings: %w", err)
+	}
+
+	query := `INSERT INTO broker_sync_runs (` + brokerSyncRunColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = r.db.Exec(query,
+		run.ID, run.UserID, string(run.TradingBroker), string(run.Trigger), run.Method, string(run.Status), run.Stage,
+		run.Fetched, run.Saved, run.Updated, run.Skipped, string(warningsJSON), run.Error,
+		run.QueuedAt, run.StartedAt, run.FinishedAt, run.DurationMs,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create broker sync run", map[string]interface{}{
+			"user_id":        run.UserID,
+			"trading_broker": run.TradingBroker,
+		})
+		return fmt.Errorf("failed to create broker sync run: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateRun saves a run's status, progress and outcome
+func (r *BrokerSyncRepository) UpdateRun(run *data.BrokerSyncRun) error {
+	warningsJSON, err := json.Marshal(run.Warnings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal warnings: %w", err)
+	}
+
+	query := `
+		UPDATE broker_sync_runs SET
+			status = ?, stage = ?, fetched_count = ?, saved_count = ?, updated_count = ?, skipped_count = ?,
+			warnings = ?, error = ?, started_at = ?, finished_at = ?, duration_ms = ?
+		WHERE id = ?
+	`
+
+	_, err = r.db.Exec(query,
+		string(run.Status), run.Stage, run.Fetched, run.Saved, run.Updated, run.Skipped,
+		string(warningsJSON), run.Error, run.StartedAt, run.FinishedAt, run.DurationMs,
+		run.ID,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to update broker sync run", map[string]interface{}{
+			"run_id": run.ID,
+		})
+		return fmt.Errorf("failed to update broker sync run: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateRunStage records the step a running sync has reached
+func (r *BrokerSyncRepository) UpdateRunStage(runID, stage string) error {
+	_, err := r.db.Exec("UPDATE broker_sync_runs SET stage = ? WHERE id = ?", stage, runID)
+	if err != nil {
+		return fmt.Errorf("failed to update broker sync run stage: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimNextRun marks the oldest queued run as running and returns it, or nil if none is queued
+func (r *BrokerSyncRepository) ClaimNextRun(startedAt time.Time) (*data.BrokerSyncRun, error) {
+	runs, err := r.queryRuns(`
+		SELECT `+brokerSyncRunColumns+`
+		FROM broker_sync_runs
+		WHERE status = ?
+		ORDER BY queued_at ASC
+		LIMIT 1
+	`, string(data.BrokerSyncStatusQueued))
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+
+	run := runs[0]
+	_, err = r.db.Exec(
+		"UPDATE broker_sync_runs SET status = ?, started_at = ? WHERE id = ? AND status = ?",
+		string(data.BrokerSyncStatusRunning), startedAt, run.ID, string(data.BrokerSyncStatusQueued),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim broker sync run: %w", err)
+	}
+	run.Status = data.BrokerSyncStatusRunning
+	run.StartedAt = &startedAt
+
+	return run, nil
+}
+
+// FailInterruptedRuns marks runs left running by a previous process as failed
+func (r *BrokerSyncRepository) FailInterruptedRuns(message string, finishedAt time.Time) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE broker_sync_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?",
+		string(data.BrokerSyncStatusFailed), message, finishedAt, string(data.BrokerSyncStatusRunning),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted broker sync runs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// GetRunByID returns one of a user's sync runs
+func (r *BrokerSyncRepository) GetRunByID(userID int, runID string) (*data.BrokerSyncRun, error) {
+	runs, err := r.queryRuns(`
+		SELECT `+brokerSyncRunColumns+`
+		FROM broker_sync_runs
+		WHERE id = ? AND user_id = ?
+	`, runID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("broker sync run not found")
+	}
+
+	return runs[0], nil
+}
+
+// GetActiveRun returns a user's queued or running sync of a broker, or nil if there is none
+func (r *BrokerSyncRepository) GetActiveRun(userID int, tradingBroker data.TradingBroker) (*data.BrokerSyncRun, error) {
+	runs, err := r.queryRuns(`
+		SELECT `+brokerSyncRunColumns+`
+		FROM broker_sync_runs
+		WHERE user_id = ? AND trading_broker = ? AND status IN (?, ?)
+		ORDER BY queued_at ASC
+		LIMIT 1
+	`, userID, string(tradingBroker), string(data.BrokerSyncStatusQueued), string(data.BrokerSyncStatusRunning))
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+
+	return runs[0], nil
+}
+
+// GetRuns returns a user's sync runs matching the filter, newest first
+func (r *BrokerSyncRepository) GetRuns(userID int, filter BrokerSyncRunFilter) ([]*data.BrokerSyncRun, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if filter.TradingBroker != nil {
+		conditions = append(conditions, "trading_broker = ?")
+		args = append(args, string(*filter.TradingBroker))
+	}
+	if filter.Status != nil {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(*filter.Status))
+	}
+
+	query := `
+		SELECT ` + brokerSyncRunColumns + `
+		FROM broker_sync_runs
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY queued_at DESC
+	`
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return r.queryRuns(query, args...)
+}
+
+// queryRuns runs a query selecting brokerSyncRunColumns and scans the rows
+func (r *BrokerSyncRepository) queryRuns(query string, args ...interface{}) ([]*data.BrokerSyncRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker sync runs")
+		return nil, fmt.Errorf("failed to get broker sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*data.BrokerSyncRun
+	for rows.Next() {
+		var run data.BrokerSyncRun
+		var broker, trigger, status string
+		var warningsJSON sql.NullString
+		err := rows.Scan(
+			&run.ID, &run.UserID, &broker, &trigger, &run.Method, &status, &run.Stage, &run.Fetched, &run.Saved,
+			&run.Updated, &run.Skipped, &warningsJSON, &run.Error, &run.QueuedAt, &run.StartedAt, &run.FinishedAt, &run.DurationMs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broker sync run: %w", err)
+		}
+		run.TradingBroker = data.TradingBroker(broker)
+		run.Trigger = data.BrokerSyncTrigger(trigger)
+		run.Status = data.BrokerSyncStatus(status)
+		if warningsJSON.Valid && warningsJSON.String != "" {
+			if err := json.Unmarshal([]byte(warningsJSON.String), &run.Warnings); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal warnings: %w", err)
+			}
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
+
+const brokerSyncScheduleColumns = `
+	id, user_id, trading_broker, run_at, weekdays, method, enabled, next_run_at, last_run_at, created_at, updated_at
+`
+
+// SaveSchedule creates or replaces a user's schedule for one broker
+func (r *BrokerSyncRepository) SaveSchedule(schedule *data.BrokerSyncSchedule) error {
+	query := `
+		INSERT INTO broker_sync_schedules (` + brokerSyncScheduleColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, trading_broker) DO UPDATE SET
+			run_at = excluded.run_at, weekdays = excluded.weekdays, method = excluded.method,
+			enabled = excluded.enabled, next_run_at = excluded.next_run_at, updated_at = excluded.updated_at
+	`
+
+	_, err := r.db.Exec(query,
+		schedule.ID, schedule.UserID, string(schedule.TradingBroker), schedule.RunAt, formatWeekdays(schedule.Weekdays),
+		schedule.Method, schedule.Enabled, schedule.NextRunAt, schedule.LastRunAt, schedule.CreatedAt, schedule.UpdatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to save broker sync schedule", map[string]interface{}{
+			"user_id":        schedule.UserID,
+			"trading_broker": schedule.TradingBroker,
+		})
+		return fmt.Errorf("failed to save broker sync schedule: %w", err)
+	}
+
+	return nil
+}
+
+// MarkScheduleRun records that a schedule queued a run and when it is next due
+func (r *BrokerSyncRepository) MarkScheduleRun(scheduleID string, lastRunAt time.Time, nextRunAt *time.Time) error {
+	_, err := r.db.Exec(
+		"UPDATE broker_sync_schedules SET last_run_at = ?, next_run_at = ? WHERE id = ?",
+		lastRunAt, nextRunAt, scheduleID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update broker sync schedule: %w", err)
+	}
+
+	return nil
+}
+
+// GetSchedule returns a user's schedule for one broker, or nil if there is none
+func (r *BrokerSyncRepository) GetSchedule(userID int, tradingBroker data.TradingBroker) (*data.BrokerSyncSchedule, error) {
+	schedules, err := r.querySchedules(`
+		SELECT `+brokerSyncScheduleColumns+`
+		FROM broker_sync_schedules
+		WHERE user_id = ? AND trading_broker = ?
+	`, userID, string(tradingBroker))
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+
+	return schedules[0], nil
+}
+
+// GetDueSchedules returns enabled schedules whose next run is at or before now
+// next_run_at is stored in UTC and SQLite compares timestamps as text, so now is converted too.
+func (r *BrokerSyncRepository) GetDueSchedules(now time.Time) ([]*data.BrokerSyncSchedule, error) {
+	return r.querySchedules(`
+		SELECT `+brokerSyncScheduleColumns+`
+		FROM broker_sync_schedules
+		WHERE enabled = 1 AND next_run_at IS NOT NULL AND next_run_at <= ?
+		ORDER BY next_run_at ASC
+	`, now.UTC())
+}
+
+// DeleteSchedule removes a user's schedule for one broker
+func (r *BrokerSyncRepository) DeleteSchedule(userID int, tradingBroker data.TradingBroker) error {
+	result, err := r.db.Exec(
+		"DELETE FROM broker_sync_schedules WHERE user_id = ? AND trading_broker = ?",
+		userID, string(tradingBroker),
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to delete broker sync schedule", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": tradingBroker,
+		})
+		return fmt.Errorf("failed to delete broker sync schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("broker sync schedule not found")
+	}
+
+	return nil
+}
+
+// querySchedules runs a query selecting brokerSyncScheduleColumns and scans the rows
+func (r *BrokerSyncRepository) querySchedules(query string, args ...interface{}) ([]*data.BrokerSyncSchedule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get broker sync schedules")
+		return nil, fmt.Errorf("failed to get broker sync schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*data.BrokerSyncSchedule
+	for rows.Next() {
+		var schedule data.BrokerSyncSchedule
+		var broker, weekdays string
+		err := rows.Scan(
+			&schedule.ID, &schedule.UserID, &broker, &schedule.RunAt, &weekdays, &schedule.Method,
+			&schedule.Enabled, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.CreatedAt, &schedule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broker sync schedule: %w", err)
+		}
+		schedule.TradingBroker = data.TradingBroker(broker)
+		if schedule.Weekdays, err = parseWeekdays(weekdays); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// formatWeekdays stores weekdays as a comma separated list
+func formatWeekdays(weekdays []int) string {
+	parts := make([]string, len(weekdays))
+	for i, day := range weekdays {
+		parts[i] = strconv.Itoa(day)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseWeekdays reads a comma separated list of weekdays
+func parseWeekdays(value string) ([]int, error) {
+	weekdays := []int{}
+	for _, part := range strings.Split(value, ",") {
+		if part == "" {
+			continue
+		}
+		day, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weekday %q in broker sync schedule", part)
+		}
+		weekdays = append(weekdays, day)
+	}
+	return weekdays, nil
+}
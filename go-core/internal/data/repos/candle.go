@@ -0,0 +1,150 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// CandleRepository handles stored OHLCV bars
+type CandleRepository struct {
+	db Querier
+}
+
+// NewCandleRepository creates a new candle repository
+func NewCandleRepository(db *sql.DB) *CandleRepository {
+	return &CandleRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *CandleRepository) WithTx(tx *sql.Tx) *CandleRepository {
+	return &CandleRepository{db: tx}
+}
+
+const candleColumns = `symbol, timeframe, timestamp, open, high, low, close, volume`
+
+// sqliteTimestamp is how the SQLite driver writes time.Time values, which aggregates return as text
+const sqliteTimestamp = "2006-01-02 15:04:05.999999999-07:00"
+
+// UpsertCandle records one bar, replacing any bar of the same symbol, timeframe and timestamp
+// Timestamps are stored in UTC so they compare correctly as text.
+func (r *CandleRepository) UpsertCandle(candle *data.Candle) error {
+	query := `INSERT OR REPLACE INTO candles (` + candleColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.Exec(query,
+		candle.Symbol, string(candle.Timeframe), candle.Timestamp.UTC(),
+		candle.Open, candle.High, candle.Low, candle.Close, candle.Volume,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to upsert candle", map[string]interface{}{
+			"symbol":    candle.Symbol,
+			"timeframe": candle.Timeframe,
+		})
+		return fmt.Errorf("failed to upsert candle: %w", err)
+	}
+
+	return nil
+}
+
+// GetCandles returns a symbol's bars in [from, to), oldest first
+// A zero from or to leaves that end of the range open; limit caps the number of bars.
+func (r *CandleRepository) GetCandles(symbol string, timeframe data.Timeframe, from, to time.Time, limit int) ([]*data.Candle, error) {
+	query := `
+		SELECT ` + candleColumns + `
+		FROM candles
+		WHERE symbol = ? AND timeframe = ?
+			AND (? OR timestamp >= ?) AND (? OR timestamp < ?)
+		ORDER BY timestamp ASC
+		LIMIT ?
+	`
+
+	return r.queryCandles(query, symbol, string(timeframe),
+		from.IsZero(), from.UTC(), to.IsZero(), to.UTC(), limit,
+	)
+}
+
+// GetLatestCandles returns a symbol's last limit bars starting before before, oldest first
+// A zero before returns the most recent bars.
+func (r *CandleRepository) GetLatestCandles(symbol string, timeframe data.Timeframe, before time.Time, limit int) ([]*data.Candle, error) {
+	query := `
+		SELECT * FROM (
+			SELECT ` + candleColumns + `
+			FROM candles
+			WHERE symbol = ? AND timeframe = ? AND (? OR timestamp < ?)
+			ORDER BY timestamp DESC
+			LIMIT ?
+		) ORDER BY timestamp ASC
+	`
+
+	return r.queryCandles(query, symbol, string(timeframe), before.IsZero(), before.UTC(), limit)
+}
+
+// GetSeries summarizes the stored series, optionally of one symbol, shortest timeframe first
+func (r *CandleRepository) GetSeries(symbol string) ([]*data.CandleSeries, error) {
+	query := `
+		SELECT symbol, timeframe, COUNT(*), MIN(timestamp), MAX(timestamp)
+		FROM candles
+		WHERE ? = '' OR symbol = ?
+		GROUP BY symbol, timeframe
+		ORDER BY symbol ASC,
+			CASE timeframe WHEN '1m' THEN 0 WHEN '5m' THEN 1 WHEN '15m' THEN 2 WHEN '30m' THEN 3
+				WHEN '1h' THEN 4 WHEN '4h' THEN 5 WHEN '1d' THEN 6 ELSE 7 END
+	`
+
+	rows, err := r.db.Query(query, symbol, symbol)
+	if err != nil {
+		utils.LogError(err, "Failed to get candle series")
+		return nil, fmt.Errorf("failed to get candle series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []*data.CandleSeries
+	for rows.Next() {
+		var s data.CandleSeries
+		var timeframe, from, to string
+		if err := rows.Scan(&s.Symbol, &timeframe, &s.Count, &from, &to); err != nil {
+			return nil, fmt.Errorf("failed to scan candle series: %w", err)
+		}
+		s.Timeframe = data.Timeframe(timeframe)
+		if s.From, err = time.Parse(sqliteTimestamp, from); err != nil {
+			return nil, fmt.Errorf("failed to parse first candle time: %w", err)
+		}
+		if s.To, err = time.Parse(sqliteTimestamp, to); err != nil {
+			return nil, fmt.Errorf("failed to parse last candle time: %w", err)
+		}
+		series = append(series, &s)
+	}
+
+	return series, rows.Err()
+}
+
+// queryCandles runs a candle query and scans the rows
+func (r *CandleRepository) queryCandles(query string, args ...interface{}) ([]*data.Candle, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get candles")
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []*data.Candle
+	for rows.Next() {
+		var candle data.Candle
+		var timeframe string
+		err := rows.Scan(
+			&candle.Symbol, &timeframe, &candle.Timestamp,
+			&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candle.Timeframe = data.Timeframe(timeframe)
+		candle.Timestamp = candle.Timestamp.UTC()
+		candles = append(candles, &candle)
+	}
+
+	return candles, rows.Err()
+}
@@ -0,0 +1,188 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// InstrumentRepository handles the instrument master
+type InstrumentRepository struct {
+	db Querier
+}
+
+// NewInstrumentRepository creates a new instrument repository
+func NewInstrumentRepository(db *sql.DB) *InstrumentRepository {
+	return &InstrumentRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *InstrumentRepository) WithTx(tx *sql.Tx) *InstrumentRepository {
+	return &InstrumentRepository{db: tx}
+}
+
+const instrumentColumns = `
+	id, trading_broker, broker_token, exchange, segment, trading_symbol, name, isin,
+	instrument_type, underlying, lot_size, tick_size, expiry, strike, updated_at
+`
+
+// instrumentPreference orders candidates from several dumps: Kite's trading symbols first,
+// as they are the exchange symbols, then NSE listings ahead of BSE ones
+const instrumentPreference = `
+	ORDER BY CASE trading_broker WHEN 'zerodha' THEN 0 ELSE 1 END,
+		CASE exchange WHEN 'NSE' THEN 0 ELSE 1 END,
+		trading_symbol ASC
+`
+
+// CreateInstrument records one instrument, replacing any row with the same broker token
+func (r *InstrumentRepository) CreateInstrument(instrument *data.Instrument) error {
+	query := `INSERT OR REPLACE INTO instruments (` + instrumentColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.Exec(query,
+		instrument.ID, string(instrument.TradingBroker), instrument.BrokerToken, instrument.Exchange,
+		string(instrument.Segment), instrument.TradingSymbol, instrument.Name, instrument.ISIN,
+		instrument.InstrumentType, instrument.Underlying, instrument.LotSize, instrument.TickSize,
+		instrument.Expiry, instrument.Strike, instrument.UpdatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to create instrument", map[string]interface{}{
+			"trading_broker": instrument.TradingBroker,
+			"broker_token":   instrument.BrokerToken,
+		})
+		return fmt.Errorf("failed to create instrument: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteBroker removes every instrument loaded from one broker's dump and returns how many were removed
+func (r *InstrumentRepository) DeleteBroker(tradingBroker data.TradingBroker) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM instruments WHERE trading_broker = ?", string(tradingBroker))
+	if err != nil {
+		utils.LogError(err, "Failed to delete instruments", map[string]interface{}{
+			"trading_broker": tradingBroker,
+		})
+		return 0, fmt.Errorf("failed to delete instruments: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// GetByBrokerToken returns the instrument a broker identifies by token, or nil when it is not loaded
+func (r *InstrumentRepository) GetByBrokerToken(tradingBroker data.TradingBroker, token string) (*data.Instrument, error) {
+	query := `SELECT ` + instrumentColumns + ` FROM instruments WHERE trading_broker = ? AND broker_token = ?`
+
+	return r.queryOne(query, string(tradingBroker), token)
+}
+
+// GetByISIN returns the preferred equity listing of an ISIN, or nil when none is loaded
+func (r *InstrumentRepository) GetByISIN(isin string) (*data.Instrument, error) {
+	query := `
+		SELECT ` + instrumentColumns + `
+		FROM instruments
+		WHERE isin = ? AND segment = ?
+	` + instrumentPreference + ` LIMIT 1`
+
+	return r.queryOne(query, strings.ToUpper(isin), string(data.InstrumentSegmentEquity))
+}
+
+// GetBySymbol returns the preferred instrument trading as symbol, or nil when none is loaded
+// exchange narrows the match when it is not empty.
+func (r *InstrumentRepository) GetBySymbol(exchange, symbol string) (*data.Instrument, error) {
+	query := `
+		SELECT ` + instrumentColumns + `
+		FROM instruments
+		WHERE trading_symbol = ? AND (? = '' OR exchange = ?)
+	` + instrumentPreference + ` LIMIT 1`
+
+	return r.queryOne(query, strings.ToUpper(symbol), exchange, exchange)
+}
+
+// GetContract returns the preferred listing of a derivative contract, or nil when none is loaded
+// Contracts match on exchange, underlying, expiry day, instrument type and strike.
+func (r *InstrumentRepository) GetContract(instrument *data.Instrument) (*data.Instrument, error) {
+	if instrument.Underlying == nil || instrument.Expiry == nil {
+		return nil, nil
+	}
+
+	day := instrument.Expiry.UTC().Truncate(24 * time.Hour)
+	query := `
+		SELECT ` + instrumentColumns + `
+		FROM instruments
+		WHERE exchange = ? AND segment = ? AND underlying = ? AND instrument_type = ?
+			AND expiry >= ? AND expiry < ?
+			AND COALESCE(strike, 0) = ?
+	` + instrumentPreference + ` LIMIT 1`
+
+	strike := 0.0
+	if instrument.Strike != nil {
+		strike = *instrument.Strike
+	}
+	return r.queryOne(query,
+		instrument.Exchange, string(instrument.Segment), *instrument.Underlying, instrument.InstrumentType,
+		day, day.Add(24*time.Hour), strike,
+	)
+}
+
+// Search returns instruments whose trading symbol or name starts with q, equities first
+// exchange narrows the search when it is not empty.
+func (r *InstrumentRepository) Search(q, exchange string, limit int) ([]*data.Instrument, error) {
+	prefix := strings.ToUpper(q) + "%"
+	query := `
+		SELECT ` + instrumentColumns + `
+		FROM instruments
+		WHERE (trading_symbol LIKE ? OR UPPER(name) LIKE ? OR isin = ?)
+			AND (? = '' OR exchange = ?)
+		ORDER BY CASE segment WHEN 'equity' THEN 0 WHEN 'index' THEN 1 ELSE 2 END,
+			LENGTH(trading_symbol) ASC, trading_symbol ASC, trading_broker DESC
+		LIMIT ?
+	`
+
+	return r.queryInstruments(query, prefix, prefix, strings.ToUpper(q), exchange, exchange, limit)
+}
+
+// queryOne runs an instrument query and returns the first row, or nil when there is none
+func (r *InstrumentRepository) queryOne(query string, args ...interface{}) (*data.Instrument, error) {
+	instruments, err := r.queryInstruments(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(instruments) == 0 {
+		return nil, nil
+	}
+	return instruments[0], nil
+}
+
+// queryInstruments runs an instrument query and scans the rows
+func (r *InstrumentRepository) queryInstruments(query string, args ...interface{}) ([]*data.Instrument, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to get instruments")
+		return nil, fmt.Errorf("failed to get instruments: %w", err)
+	}
+	defer rows.Close()
+
+	var instruments []*data.Instrument
+	for rows.Next() {
+		var instrument data.Instrument
+		var broker, segment string
+		err := rows.Scan(
+			&instrument.ID, &broker, &instrument.BrokerToken, &instrument.Exchange, &segment,
+			&instrument.TradingSymbol, &instrument.Name, &instrument.ISIN, &instrument.InstrumentType,
+			&instrument.Underlying, &instrument.LotSize, &instrument.TickSize, &instrument.Expiry,
+			&instrument.Strike, &instrument.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan instrument: %w", err)
+		}
+		instrument.TradingBroker = data.TradingBroker(broker)
+		instrument.Segment = data.InstrumentSegment(segment)
+		instruments = append(instruments, &instrument)
+	}
+
+	return instruments, rows.Err()
+}
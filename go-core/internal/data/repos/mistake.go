@@ -11,7 +11,7 @@ import (
 
 // MistakeRepository handles mistake database operations
 type MistakeRepository struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewMistakeRepository creates a new mistake repository
@@ -19,6 +19,11 @@ func NewMistakeRepository(db *sql.DB) *MistakeRepository {
 	return &MistakeRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *MistakeRepository) WithTx(tx *sql.Tx) *MistakeRepository {
+	return &MistakeRepository{db: tx}
+}
+
 // CreateMistake creates a new mistake
 func (r *MistakeRepository) CreateMistake(mistake *data.Mistake) error {
 	query := `
@@ -177,6 +182,36 @@ func (r *MistakeRepository) GetMistakesByCategory(userID int, category data.Mist
 	return mistakes, nil
 }
 
+// GetAllMistakesByUser retrieves every mistake for a user, oldest first
+func (r *MistakeRepository) GetAllMistakesByUser(userID int) ([]*data.Mistake, error) {
+	query := `
+		SELECT id, user_id, name, category, created_at, updated_at
+		FROM mistakes 
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all mistakes by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, fmt.Errorf("failed to get mistakes: %w", err)
+	}
+	defer rows.Close()
+
+	var mistakes []*data.Mistake
+	for rows.Next() {
+		mistake, err := r.scanMistake(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mistake: %w", err)
+		}
+		mistakes = append(mistakes, mistake)
+	}
+
+	return mistakes, rows.Err()
+}
+
 // DeleteMistake deletes a mistake
 func (r *MistakeRepository) DeleteMistake(mistakeID string, userID int) error {
 	query := "DELETE FROM mistakes WHERE id = ? AND user_id = ?"
@@ -228,3 +263,16 @@ func (r *MistakeRepository) scanMistake(scanner interface {
 
 	return &mistake, nil
 }
+
+// DeleteAllMistakesByUser deletes every mistake owned by a user and returns how many were removed
+func (r *MistakeRepository) DeleteAllMistakesByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM mistakes WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all mistakes by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete mistakes: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,141 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// PaperAccountRepository handles the simulated accounts of paper trading algorithms
+type PaperAccountRepository struct {
+	db Querier
+}
+
+// NewPaperAccountRepository creates a new paper account repository
+func NewPaperAccountRepository(db *sql.DB) *PaperAccountRepository {
+	return &PaperAccountRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *PaperAccountRepository) WithTx(tx *sql.Tx) *PaperAccountRepository {
+	return &PaperAccountRepository{db: tx}
+}
+
+// SaveAccount creates or replaces an algorithm's paper account
+func (r *PaperAccountRepository) SaveAccount(account *data.PaperAccount) error {
+	settingsJSON, err := json.Marshal(account.Settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	openTrades := account.OpenTrades
+	if openTrades == nil {
+		openTrades = map[string]string{}
+	}
+	openTradesJSON, err := json.Marshal(openTrades)
+	if err != nil {
+		return fmt.Errorf("failed to marshal open trades: %w", err)
+	}
+
+	query := `
+		INSERT OR REPLACE INTO paper_accounts (
+			algorithm_id, user_id, settings, account, open_trades,
+			total_trades, winning_trades, last_bar_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = r.db.Exec(query,
+		account.AlgorithmID, account.UserID, string(settingsJSON), string(account.Account), string(openTradesJSON),
+		account.TotalTrades, account.WinningTrades, account.LastBarAt, account.CreatedAt, account.UpdatedAt,
+	)
+	if err != nil {
+		utils.LogError(err, "Failed to save paper account", map[string]interface{}{
+			"algorithm_id": account.AlgorithmID,
+		})
+		return fmt.Errorf("failed to save paper account: %w", err)
+	}
+
+	return nil
+}
+
+const paperAccountColumns = `
+	algorithm_id, user_id, settings, account, open_trades,
+	total_trades, winning_trades, last_bar_at, created_at, updated_at
+`
+
+// GetAccount returns an algorithm's paper account, or nil if it has none yet
+func (r *PaperAccountRepository) GetAccount(algorithmID string, userID int) (*data.PaperAccount, error) {
+	query := `
+		SELECT ` + paperAccountColumns + `
+		FROM paper_accounts
+		WHERE algorithm_id = ? AND user_id = ?
+	`
+
+	account, err := scanPaperAccount(r.db.QueryRow(query, algorithmID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to get paper account", map[string]interface{}{
+			"algorithm_id": algorithmID,
+		})
+		return nil, fmt.Errorf("failed to get paper account: %w", err)
+	}
+
+	return account, nil
+}
+
+// GetAllAccountsByUser returns the paper accounts of all of a user's algorithms
+func (r *PaperAccountRepository) GetAllAccountsByUser(userID int) ([]*data.PaperAccount, error) {
+	query := `
+		SELECT ` + paperAccountColumns + `
+		FROM paper_accounts
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all paper accounts by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, fmt.Errorf("failed to get paper accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []*data.PaperAccount{}
+	for rows.Next() {
+		account, err := scanPaperAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan paper account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// scanPaperAccount scans paperAccountColumns
+func scanPaperAccount(row interface{ Scan(...interface{}) error }) (*data.PaperAccount, error) {
+	var account data.PaperAccount
+	var settingsJSON, accountJSON, openTradesJSON string
+	err := row.Scan(
+		&account.AlgorithmID, &account.UserID, &settingsJSON, &accountJSON, &openTradesJSON,
+		&account.TotalTrades, &account.WinningTrades, &account.LastBarAt, &account.CreatedAt, &account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(settingsJSON), &account.Settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+	if err := json.Unmarshal([]byte(openTradesJSON), &account.OpenTrades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal open trades: %w", err)
+	}
+	account.Account = json.RawMessage(accountJSON)
+
+	return &account, nil
+}
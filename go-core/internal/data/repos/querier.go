@@ -0,0 +1,37 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Querier is the subset of *sql.DB and *sql.Tx used by repositories
+// It lets the same repository run standalone or inside a transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn inside a transaction: db itself when it already is one, otherwise a new one that
+// is committed when fn succeeds and rolled back when it fails
+func inTx(db Querier, fn func(tx Querier) error) error {
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
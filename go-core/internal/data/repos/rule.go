@@ -11,7 +11,7 @@ import (
 
 // RuleRepository handles rule database operations
 type RuleRepository struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewRuleRepository creates a new rule repository
@@ -19,6 +19,11 @@ func NewRuleRepository(db *sql.DB) *RuleRepository {
 	return &RuleRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *RuleRepository) WithTx(tx *sql.Tx) *RuleRepository {
+	return &RuleRepository{db: tx}
+}
+
 // CreateRule creates a new rule
 func (r *RuleRepository) CreateRule(rule *data.Rule) error {
 	query := `
@@ -177,6 +182,36 @@ func (r *RuleRepository) GetRulesByCategory(userID int, category data.RuleCatego
 	return rules, nil
 }
 
+// GetAllRulesByUser retrieves every rule for a user, oldest first
+func (r *RuleRepository) GetAllRulesByUser(userID int) ([]*data.Rule, error) {
+	query := `
+		SELECT id, user_id, name, description, category, created_at, updated_at
+		FROM rules 
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all rules by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, fmt.Errorf("failed to get rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*data.Rule
+	for rows.Next() {
+		rule, err := r.scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
 // DeleteRule deletes a rule
 func (r *RuleRepository) DeleteRule(ruleID string, userID int) error {
 	query := "DELETE FROM rules WHERE id = ? AND user_id = ?"
@@ -228,3 +263,16 @@ func (r *RuleRepository) scanRule(scanner interface {
 
 	return &rule, nil
 }
+
+// DeleteAllRulesByUser deletes every rule owned by a user and returns how many were removed
+func (r *RuleRepository) DeleteAllRulesByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM rules WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all rules by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete rules: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -11,7 +11,7 @@ import (
 
 // StrategyRepository handles strategy database operations
 type StrategyRepository struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewStrategyRepository creates a new strategy repository
@@ -19,6 +19,11 @@ func NewStrategyRepository(db *sql.DB) *StrategyRepository {
 	return &StrategyRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *StrategyRepository) WithTx(tx *sql.Tx) *StrategyRepository {
+	return &StrategyRepository{db: tx}
+}
+
 // CreateStrategy creates a new strategy
 func (r *StrategyRepository) CreateStrategy(strategy *data.Strategy) error {
 	query := `
@@ -141,6 +146,36 @@ func (r *StrategyRepository) GetStrategiesByUser(userID int, limit, offset int)
 	return strategies, nil
 }
 
+// GetAllStrategiesByUser retrieves every strategy for a user, oldest first
+func (r *StrategyRepository) GetAllStrategiesByUser(userID int) ([]*data.Strategy, error) {
+	query := `
+		SELECT id, user_id, name, description, created_at, updated_at
+		FROM strategies 
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get all strategies by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, fmt.Errorf("failed to get strategies: %w", err)
+	}
+	defer rows.Close()
+
+	var strategies []*data.Strategy
+	for rows.Next() {
+		strategy, err := r.scanStrategy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan strategy: %w", err)
+		}
+		strategies = append(strategies, strategy)
+	}
+
+	return strategies, rows.Err()
+}
+
 // DeleteStrategy deletes a strategy
 func (r *StrategyRepository) DeleteStrategy(strategyID string, userID int) error {
 	query := "DELETE FROM strategies WHERE id = ? AND user_id = ?"
@@ -192,3 +227,16 @@ func (r *StrategyRepository) scanStrategy(scanner interface {
 
 	return &strategy, nil
 }
+
+// DeleteAllStrategiesByUser deletes every strategy owned by a user and returns how many were removed
+func (r *StrategyRepository) DeleteAllStrategiesByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM strategies WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all strategies by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete strategies: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"go-core/internal/data"
@@ -12,7 +13,7 @@ import (
 
 // TradeRepository handles trade database operations
 type TradeRepository struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewTradeRepository creates a new trade repository
@@ -20,6 +21,11 @@ func NewTradeRepository(db *sql.DB) *TradeRepository {
 	return &TradeRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *TradeRepository) WithTx(tx *sql.Tx) *TradeRepository {
+	return &TradeRepository{db: tx}
+}
+
 // CreateTrade creates a new trade
 func (r *TradeRepository) CreateTrade(trade *data.Trade) error {
 	// Convert slices to JSON
@@ -44,11 +50,11 @@ func (r *TradeRepository) CreateTrade(trade *data.Trade) error {
 	query := `
 		INSERT INTO trades (
 			id, user_id, symbol, market_type, entry_date, entry_price, quantity, 
-			total_amount, exit_price, direction, stop_loss, target, strategy, 
+			total_amount, exit_price, exit_date, direction, stop_loss, target, strategy, 
 			outcome_summary, trade_analysis, rules_followed, screenshots, psychology,
-			trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type,
+			trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type, algorithm_id,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var tradingBroker, traderBrokerID, exchangeOrderID, orderID, productType, transactionType interface{}
@@ -73,11 +79,11 @@ func (r *TradeRepository) CreateTrade(trade *data.Trade) error {
 
 	_, err = r.db.Exec(query,
 		trade.ID, trade.UserID, trade.Symbol, trade.MarketType, trade.EntryDate,
-		trade.EntryPrice, trade.Quantity, trade.TotalAmount, trade.ExitPrice,
+		trade.EntryPrice, trade.Quantity, trade.TotalAmount, trade.ExitPrice, trade.ExitDate,
 		trade.Direction, trade.StopLoss, trade.Target, trade.Strategy,
 		trade.OutcomeSummary, trade.TradeAnalysis, string(rulesFollowedJSON),
 		string(screenshotsJSON), string(psychologyJSON),
-		tradingBroker, traderBrokerID, exchangeOrderID, orderID, productType, transactionType,
+		tradingBroker, traderBrokerID, exchangeOrderID, orderID, productType, transactionType, trade.AlgorithmID,
 		trade.CreatedAt, trade.UpdatedAt,
 	)
 
@@ -120,7 +126,7 @@ func (r *TradeRepository) UpdateTrade(trade *data.Trade) error {
 	query := `
 		UPDATE trades SET 
 			symbol = ?, market_type = ?, entry_date = ?, entry_price = ?, 
-			quantity = ?, total_amount = ?, exit_price = ?, direction = ?, 
+			quantity = ?, total_amount = ?, exit_price = ?, exit_date = ?, direction = ?, 
 			stop_loss = ?, target = ?, strategy = ?, outcome_summary = ?, 
 			trade_analysis = ?, rules_followed = ?, screenshots = ?, 
 			psychology = ?, trading_broker = ?, trader_broker_id = ?, 
@@ -151,7 +157,7 @@ func (r *TradeRepository) UpdateTrade(trade *data.Trade) error {
 
 	result, err := r.db.Exec(query,
 		trade.Symbol, trade.MarketType, trade.EntryDate, trade.EntryPrice,
-		trade.Quantity, trade.TotalAmount, trade.ExitPrice, trade.Direction,
+		trade.Quantity, trade.TotalAmount, trade.ExitPrice, trade.ExitDate, trade.Direction,
 		trade.StopLoss, trade.Target, trade.Strategy, trade.OutcomeSummary,
 		trade.TradeAnalysis, string(rulesFollowedJSON), string(screenshotsJSON),
 		string(psychologyJSON),
@@ -187,9 +193,9 @@ func (r *TradeRepository) UpdateTrade(trade *data.Trade) error {
 func (r *TradeRepository) GetTradeByID(tradeID string, userID int) (*data.Trade, error) {
 	query := `
 		SELECT id, user_id, symbol, market_type, entry_date, entry_price, quantity,
-			   total_amount, exit_price, direction, stop_loss, target, strategy,
+			   total_amount, exit_price, exit_date, direction, stop_loss, target, strategy,
 			   outcome_summary, trade_analysis, rules_followed, screenshots, psychology,
-			   trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type,
+			   trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type, algorithm_id,
 			   created_at, updated_at
 		FROM trades 
 		WHERE id = ? AND user_id = ?
@@ -211,39 +217,164 @@ func (r *TradeRepository) GetTradeByID(tradeID string, userID int) (*data.Trade,
 	return trade, nil
 }
 
+// TradeFilter narrows trade listings and exports
+// Nil fields are ignored; dates are compared against entry_date (ToDate is inclusive of the whole day)
+type TradeFilter struct {
+	Symbol         *string
+	MarketType     *data.MarketType
+	Direction      *data.TradeDirection
+	OutcomeSummary *data.OutcomeSummary
+	Strategy       *string
+	TradingBroker  *data.TradingBroker
+	ProductType    *data.ProductType
+	FromDate       *time.Time
+	ToDate         *time.Time
+	OrderID        *string
+	AlgorithmID    *string
+	OpenOnly       bool // only trades without an exit yet
+}
+
+// whereClause builds the WHERE clause and arguments for a user's trades matching the filter
+func (f TradeFilter) whereClause(userID int) (string, []interface{}) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if f.Symbol != nil {
+		conditions = append(conditions, "symbol = ?")
+		args = append(args, *f.Symbol)
+	}
+	if f.MarketType != nil {
+		conditions = append(conditions, "market_type = ?")
+		args = append(args, string(*f.MarketType))
+	}
+	if f.Direction != nil {
+		conditions = append(conditions, "direction = ?")
+		args = append(args, string(*f.Direction))
+	}
+	if f.OutcomeSummary != nil {
+		conditions = append(conditions, "outcome_summary = ?")
+		args = append(args, string(*f.OutcomeSummary))
+	}
+	if f.Strategy != nil {
+		conditions = append(conditions, "strategy = ?")
+		args = append(args, *f.Strategy)
+	}
+	if f.TradingBroker != nil {
+		conditions = append(conditions, "trading_broker = ?")
+		args = append(args, string(*f.TradingBroker))
+	}
+	if f.ProductType != nil {
+		conditions = append(conditions, "product_type = ?")
+		args = append(args, string(*f.ProductType))
+	}
+	if f.OrderID != nil {
+		conditions = append(conditions, "order_id = ?")
+		args = append(args, *f.OrderID)
+	}
+	if f.AlgorithmID != nil {
+		conditions = append(conditions, "algorithm_id = ?")
+		args = append(args, *f.AlgorithmID)
+	}
+	if f.OpenOnly {
+		conditions = append(conditions, "exit_price IS NULL")
+	}
+	if f.FromDate != nil {
+		conditions = append(conditions, "entry_date >= ?")
+		args = append(args, *f.FromDate)
+	}
+	if f.ToDate != nil {
+		conditions = append(conditions, "entry_date < ?")
+		args = append(args, f.ToDate.AddDate(0, 0, 1))
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
 // GetTradesByUser retrieves all trades for a user
 func (r *TradeRepository) GetTradesByUser(userID int, limit, offset int) ([]*data.Trade, error) {
+	return r.GetTradesByUserFiltered(userID, TradeFilter{}, limit, offset)
+}
+
+// GetTradesByUserFiltered retrieves a page of a user's trades matching the filter
+func (r *TradeRepository) GetTradesByUserFiltered(userID int, filter TradeFilter, limit, offset int) ([]*data.Trade, error) {
+	var trades []*data.Trade
+	err := r.forEachTrade(userID, filter, limit, offset, func(trade *data.Trade) error {
+		trades = append(trades, trade)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// ForEachTrade streams every trade of a user matching the filter to fn, oldest first
+// Iteration stops at the first error returned by fn
+func (r *TradeRepository) ForEachTrade(userID int, filter TradeFilter, fn func(*data.Trade) error) error {
+	return r.forEachTrade(userID, filter, -1, 0, fn)
+}
+
+// forEachTrade runs the filtered trade query and hands each scanned row to fn
+// A negative limit returns all rows; paged listings are newest first, full scans oldest first
+func (r *TradeRepository) forEachTrade(userID int, filter TradeFilter, limit, offset int, fn func(*data.Trade) error) error {
+	where, args := filter.whereClause(userID)
+
+	order := "ORDER BY entry_date DESC, created_at DESC"
+	if limit < 0 {
+		order = "ORDER BY entry_date ASC, created_at ASC"
+	}
+
 	query := `
 		SELECT id, user_id, symbol, market_type, entry_date, entry_price, quantity,
-			   total_amount, exit_price, direction, stop_loss, target, strategy,
+			   total_amount, exit_price, exit_date, direction, stop_loss, target, strategy,
 			   outcome_summary, trade_analysis, rules_followed, screenshots, psychology,
-			   trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type,
+			   trading_broker, trader_broker_id, exchange_order_id, order_id, product_type, transaction_type, algorithm_id,
 			   created_at, updated_at
 		FROM trades 
-		WHERE user_id = ?
-		ORDER BY entry_date DESC, created_at DESC
+		` + where + `
+		` + order + `
 		LIMIT ? OFFSET ?
 	`
+	args = append(args, limit, offset)
 
-	rows, err := r.db.Query(query, userID, limit, offset)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		utils.LogError(err, "Failed to get trades by user", map[string]interface{}{
 			"user_id": userID,
 		})
-		return nil, fmt.Errorf("failed to get trades: %w", err)
+		return fmt.Errorf("failed to get trades: %w", err)
 	}
 	defer rows.Close()
 
-	var trades []*data.Trade
 	for rows.Next() {
 		trade, err := r.scanTrade(rows)
 		if err != nil {
 			utils.LogError(err, "Failed to scan trade", map[string]interface{}{
 				"user_id": userID,
 			})
-			return nil, fmt.Errorf("failed to scan trade: %w", err)
+			return fmt.Errorf("failed to scan trade: %w", err)
+		}
+		if err := fn(trade); err != nil {
+			return err
 		}
+	}
+
+	return rows.Err()
+}
+
+// GetOpenTradesByBroker returns a user's open trades imported from a broker, oldest first
+// Broker syncs use these to close positions carried across syncs
+func (r *TradeRepository) GetOpenTradesByBroker(userID int, tradingBroker data.TradingBroker) ([]*data.Trade, error) {
+	filter := TradeFilter{TradingBroker: &tradingBroker, OpenOnly: true}
+
+	var trades []*data.Trade
+	err := r.ForEachTrade(userID, filter, func(trade *data.Trade) error {
 		trades = append(trades, trade)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return trades, nil
@@ -289,11 +420,11 @@ func (r *TradeRepository) scanTrade(scanner interface {
 
 	err := scanner.Scan(
 		&trade.ID, &trade.UserID, &trade.Symbol, &trade.MarketType, &entryDate,
-		&trade.EntryPrice, &trade.Quantity, &trade.TotalAmount, &trade.ExitPrice,
+		&trade.EntryPrice, &trade.Quantity, &trade.TotalAmount, &trade.ExitPrice, &trade.ExitDate,
 		&trade.Direction, &trade.StopLoss, &trade.Target, &trade.Strategy,
 		&trade.OutcomeSummary, &trade.TradeAnalysis, &rulesFollowedJSON,
 		&screenshotsJSON, &psychologyJSON,
-		&tradingBroker, &traderBrokerID, &exchangeOrderID, &orderID, &productType, &transactionType,
+		&tradingBroker, &traderBrokerID, &exchangeOrderID, &orderID, &productType, &transactionType, &trade.AlgorithmID,
 		&createdAt, &updatedAt,
 	)
 
@@ -381,17 +512,20 @@ func (r *TradeRepository) TradeExistsByBrokerID(userID int, tradingBroker data.T
 	return count > 0, nil
 }
 
-// GetLatestTradeDateByBroker gets the latest entry_date for trades from a specific broker for a user
+// GetLatestTradeDateByBroker gets the latest entry or exit date for trades from a specific broker for a user
+// Exit dates count so fills that closed carried positions are not fetched again
 // Returns nil if no trades exist for that broker
 func (r *TradeRepository) GetLatestTradeDateByBroker(userID int, tradingBroker data.TradingBroker) (*time.Time, error) {
 	query := `
-		SELECT MAX(entry_date) 
-		FROM trades 
-		WHERE user_id = ? AND trading_broker = ?
+		SELECT MAX(d) FROM (
+			SELECT entry_date AS d FROM trades WHERE user_id = ? AND trading_broker = ?
+			UNION ALL
+			SELECT exit_date AS d FROM trades WHERE user_id = ? AND trading_broker = ? AND exit_date IS NOT NULL
+		)
 	`
 
 	var latestDateStr sql.NullString
-	err := r.db.QueryRow(query, userID, string(tradingBroker)).Scan(&latestDateStr)
+	err := r.db.QueryRow(query, userID, string(tradingBroker), userID, string(tradingBroker)).Scan(&latestDateStr)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No trades found
@@ -407,8 +541,11 @@ func (r *TradeRepository) GetLatestTradeDateByBroker(userID int, tradingBroker d
 		return nil, nil // No trades found
 	}
 
-	// Parse the date string (SQLite stores dates as strings)
-	latestDate, err := time.Parse("2006-01-02T15:04:05Z07:00", latestDateStr.String)
+	// Parse the date string (SQLite stores dates as strings, go-sqlite3 in its own layout)
+	latestDate, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", latestDateStr.String)
+	if err != nil {
+		latestDate, err = time.Parse("2006-01-02T15:04:05Z07:00", latestDateStr.String)
+	}
 	if err != nil {
 		// Try alternative formats
 		latestDate, err = time.Parse("2006-01-02 15:04:05", latestDateStr.String)
@@ -425,3 +562,16 @@ func (r *TradeRepository) GetLatestTradeDateByBroker(userID int, tradingBroker d
 
 	return &latestDate, nil
 }
+
+// DeleteAllTradesByUser deletes every trade owned by a user and returns how many were removed
+func (r *TradeRepository) DeleteAllTradesByUser(userID int) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM trades WHERE user_id = ?", userID)
+	if err != nil {
+		utils.LogError(err, "Failed to delete all trades by user", map[string]interface{}{
+			"user_id": userID,
+		})
+		return 0, fmt.Errorf("failed to delete trades: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -4,50 +4,58 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"go-core/internal/data"
+	"go-core/internal/secrets"
 	"go-core/internal/utils"
 )
 
 // UserRepository handles user database operations
 type UserRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	keyring *secrets.Keyring
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// keyring encrypts and decrypts broker credentials; without one, reading encrypted
+// credentials or saving any fails.
+func NewUserRepository(db *sql.DB, keyring *secrets.Keyring) *UserRepository {
+	return &UserRepository{db: db, keyring: keyring}
 }
 
 // CreateUser creates a new user
+// Broker credentials are bound to the user ID, so they are encrypted and saved once the row exists.
 func (r *UserRepository) CreateUser(user *data.User) error {
-	// Convert configuredBrokers to JSON
-	var configuredBrokersJSON []byte
-	var err error
-	if user.ConfiguredBrokers == nil {
-		configuredBrokersJSON = []byte("{}")
-	} else {
-		configuredBrokersJSON, err = json.Marshal(user.ConfiguredBrokers)
+	return inTx(r.db, func(tx Querier) error {
+		query := `INSERT INTO users (name, email, phone, configured_brokers, created_at) VALUES (?, ?, ?, '{}', ?)`
+		result, err := tx.Exec(query, user.Name, user.Email, user.Phone, user.CreatedAt)
 		if err != nil {
-			return fmt.Errorf("failed to marshal configured_brokers: %w", err)
+			utils.LogError(err, "Failed to create user")
+			return fmt.Errorf("failed to create user: %w", err)
 		}
-	}
 
-	query := `INSERT INTO users (name, email, phone, configured_brokers, created_at) VALUES (?, ?, ?, ?, ?)`
-	result, err := r.db.Exec(query, user.Name, user.Email, user.Phone, string(configuredBrokersJSON), user.CreatedAt)
-	if err != nil {
-		utils.LogError(err, "Failed to create user")
-		return fmt.Errorf("failed to create user: %w", err)
-	}
+		id, err := result.LastInsertId()
+		if err != nil {
+			utils.LogError(err, "Failed to get last insert ID for user")
+			return fmt.Errorf("failed to get user ID: %w", err)
+		}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		utils.LogError(err, "Failed to get last insert ID for user")
-		return fmt.Errorf("failed to get user ID: %w", err)
-	}
+		if len(user.ConfiguredBrokers) > 0 {
+			// Convert configuredBrokers to JSON, encrypting credentials
+			configuredBrokersJSON, err := r.marshalConfiguredBrokers(int(id), user.ConfiguredBrokers)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`UPDATE users SET configured_brokers = ? WHERE id = ?`, string(configuredBrokersJSON), id); err != nil {
+				utils.LogError(err, "Failed to save broker configs of new user")
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+		}
 
-	user.ID = int(id)
-	return nil
+		user.ID = int(id)
+		return nil
+	})
 }
 
 // GetUserByID retrieves a user by ID
@@ -80,22 +88,22 @@ func (r *UserRepository) GetUserByID(id string) (*data.User, error) {
 	} else {
 		user.ConfiguredBrokers = make(map[string]data.BrokerConfig)
 	}
+	if err := r.decryptConfiguredBrokers(user.ID, user.ConfiguredBrokers); err != nil {
+		utils.LogError(err, "Failed to decrypt broker credentials", map[string]interface{}{
+			"user_id": id,
+		})
+		return nil, err
+	}
 
 	return user, nil
 }
 
 // UpdateUser updates an existing user
 func (r *UserRepository) UpdateUser(user *data.User) error {
-	// Convert configuredBrokers to JSON
-	var configuredBrokersJSON []byte
-	var err error
-	if user.ConfiguredBrokers == nil {
-		configuredBrokersJSON = []byte("{}")
-	} else {
-		configuredBrokersJSON, err = json.Marshal(user.ConfiguredBrokers)
-		if err != nil {
-			return fmt.Errorf("failed to marshal configured_brokers: %w", err)
-		}
+	// Convert configuredBrokers to JSON, encrypting credentials
+	configuredBrokersJSON, err := r.marshalConfiguredBrokers(user.ID, user.ConfiguredBrokers)
+	if err != nil {
+		return err
 	}
 
 	query := `UPDATE users SET name = ?, email = ?, phone = ?, configured_brokers = ? WHERE id = ?`
@@ -110,24 +118,126 @@ func (r *UserRepository) UpdateUser(user *data.User) error {
 	return nil
 }
 
-// UpdateUserBrokerConfig updates the broker configuration for a user
+// UpdateUserBrokerConfig saves a user's configuration of one broker
+// Only that broker's entry is written, in a single statement, so concurrent updates of other
+// brokers and of the user's own fields are not lost.
 func (r *UserRepository) UpdateUserBrokerConfig(userID int, brokerName string, config data.BrokerConfig) error {
-	// Get current user
-	user, err := r.GetUserByID(fmt.Sprintf("%d", userID))
+	path, err := brokerPath(brokerName)
+	if err != nil {
+		return err
+	}
+	config, err = r.encryptBrokerConfig(userID, brokerName, config)
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to marshal %s config: %w", brokerName, err)
 	}
 
-	// Initialize map if nil
-	if user.ConfiguredBrokers == nil {
-		user.ConfiguredBrokers = make(map[string]data.BrokerConfig)
+	query := `
+		UPDATE users
+		SET configured_brokers = json_set(
+			CASE WHEN json_valid(configured_brokers) THEN configured_brokers ELSE '{}' END, ?, json(?))
+		WHERE id = ?
+	`
+	result, err := r.db.Exec(query, path, string(configJSON), userID)
+	if err != nil {
+		utils.LogError(err, "Failed to update user broker config", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": brokerName,
+		})
+		return fmt.Errorf("failed to update broker config: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// UpdateUserBrokerToken saves the access token of a configured broker with its expiry,
+// configuration time and renewal outcome, leaving the rest of the broker's config as stored
+// Background renewal uses it so it never overwrites credentials saved while it ran.
+func (r *UserRepository) UpdateUserBrokerToken(userID int, brokerName string, config data.BrokerConfig) error {
+	path, err := brokerPath(brokerName)
+	if err != nil {
+		return err
+	}
+	if r.keyring == nil {
+		return fmt.Errorf("no master key loaded for broker credentials")
+	}
+	accessToken, err := r.keyring.Encrypt(config.AccessToken, credentialContext(userID, brokerName, "access_token"))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s credentials: %w", brokerName, err)
 	}
 
-	// Update broker config
-	user.ConfiguredBrokers[brokerName] = config
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"access_token", accessToken},
+		{"expiry_time", config.ExpiryTime},
+		{"configured_at", config.ConfiguredAt},
+		{"revoked_at", config.RevokedAt},
+		{"refresh_failed_at", config.RefreshFailedAt},
+		{"refresh_error", config.RefreshError},
+	}
+	set := "configured_brokers"
+	args := make([]interface{}, 0, 2*len(fields)+2)
+	for _, field := range fields {
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", field.name, err)
+		}
+		set = "json_set(" + set + ", ?, json(?))"
+		args = append(args, path+"."+field.name, string(value))
+	}
+	args = append(args, userID, path)
 
-	// Save updated user
-	return r.UpdateUser(user)
+	query := `UPDATE users SET configured_brokers = ` + set + ` WHERE id = ? AND json_type(configured_brokers, ?) = 'object'`
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		utils.LogError(err, "Failed to update user broker token", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": brokerName,
+		})
+		return fmt.Errorf("failed to update broker token: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("%s is not configured for user %d", brokerName, userID)
+	}
+	return nil
+}
+
+// GetUserIDs returns the IDs of every user, lowest first
+func (r *UserRepository) GetUserIDs() ([]int, error) {
+	rows, err := r.db.Query(`SELECT id FROM users ORDER BY id ASC`)
+	if err != nil {
+		utils.LogError(err, "Failed to get user IDs")
+		return nil, fmt.Errorf("failed to get user IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate user IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// brokerPath is the JSON path of a broker's entry in configured_brokers
+func brokerPath(brokerName string) (string, error) {
+	if brokerName == "" || strings.Trim(brokerName, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return "", fmt.Errorf("invalid broker name %q", brokerName)
+	}
+	return `$."` + brokerName + `"`, nil
 }
 
 // DeleteUser deletes a user by ID
@@ -193,6 +303,12 @@ func (r *UserRepository) GetUsers(limit, offset int) ([]*data.User, int, error)
 		} else {
 			user.ConfiguredBrokers = make(map[string]data.BrokerConfig)
 		}
+		if err := r.decryptConfiguredBrokers(user.ID, user.ConfiguredBrokers); err != nil {
+			utils.LogError(err, "Failed to decrypt broker credentials", map[string]interface{}{
+				"user_id": user.ID,
+			})
+			return nil, 0, err
+		}
 
 		users = append(users, user)
 	}
@@ -204,3 +320,168 @@ func (r *UserRepository) GetUsers(limit, offset int) ([]*data.User, int, error)
 
 	return users, total, nil
 }
+
+// ReencryptBrokerCredentials encrypts plaintext broker credentials, credentials sealed without
+// their user and field (enc:v1), and credentials under a retired master key, with the active
+// master key and returns how many users were updated
+// It runs at startup, which encrypts rows written before encryption, moves enc:v1 rows to the
+// current format and completes key rotation.
+func (r *UserRepository) ReencryptBrokerCredentials() (int, error) {
+	if r.keyring == nil {
+		return 0, fmt.Errorf("no master key loaded for broker credentials")
+	}
+
+	rows, err := r.db.Query(`SELECT id, configured_brokers FROM users`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get users: %w", err)
+	}
+	stale := make(map[int]map[string]data.BrokerConfig)
+	for rows.Next() {
+		var id int
+		var configuredBrokersJSON sql.NullString
+		if err := rows.Scan(&id, &configuredBrokersJSON); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if !configuredBrokersJSON.Valid || configuredBrokersJSON.String == "" || configuredBrokersJSON.String == "{}" {
+			continue
+		}
+
+		var configuredBrokers map[string]data.BrokerConfig
+		if err := json.Unmarshal([]byte(configuredBrokersJSON.String), &configuredBrokers); err != nil {
+			utils.LogError(err, "Failed to unmarshal configured_brokers", map[string]interface{}{
+				"user_id": id,
+			})
+			continue
+		}
+		for _, config := range configuredBrokers {
+			if needsReencryption(r.keyring, config) {
+				stale[id] = configuredBrokers
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	for id, configuredBrokers := range stale {
+		if err := r.decryptConfiguredBrokers(id, configuredBrokers); err != nil {
+			return 0, fmt.Errorf("failed to decrypt broker credentials of user %d: %w", id, err)
+		}
+		configuredBrokersJSON, err := r.marshalConfiguredBrokers(id, configuredBrokers)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := r.db.Exec(`UPDATE users SET configured_brokers = ? WHERE id = ?`, string(configuredBrokersJSON), id); err != nil {
+			return 0, fmt.Errorf("failed to update user %d: %w", id, err)
+		}
+	}
+
+	return len(stale), nil
+}
+
+// credential is a broker config field that is stored encrypted
+type credential struct {
+	name  string
+	value *string
+}
+
+// brokerCredentials returns the credential fields of a broker config that are stored encrypted
+func brokerCredentials(config *data.BrokerConfig) []credential {
+	fields := []credential{{"access_token", &config.AccessToken}}
+	if config.APIKey != nil {
+		fields = append(fields, credential{"api_key", config.APIKey})
+	}
+	if config.APISecret != nil {
+		fields = append(fields, credential{"api_secret", config.APISecret})
+	}
+	return fields
+}
+
+// credentialContext is what a credential is bound to when encrypted, so a sealed value moved to
+// another user, broker or field does not decrypt
+func credentialContext(userID int, broker, field string) string {
+	return fmt.Sprintf("user:%d:%s:%s", userID, broker, field)
+}
+
+// needsReencryption reports whether any credential of a config is plaintext, in the legacy
+// format or under a retired key
+func needsReencryption(keyring *secrets.Keyring, config data.BrokerConfig) bool {
+	for _, field := range brokerCredentials(&config) {
+		if keyring.NeedsReencryption(*field.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalConfiguredBrokers converts broker configs to JSON with their credentials encrypted
+// The caller's configs are left untouched.
+func (r *UserRepository) marshalConfiguredBrokers(userID int, configuredBrokers map[string]data.BrokerConfig) ([]byte, error) {
+	if configuredBrokers == nil {
+		return []byte("{}"), nil
+	}
+
+	encrypted := make(map[string]data.BrokerConfig, len(configuredBrokers))
+	for name, config := range configuredBrokers {
+		config, err := r.encryptBrokerConfig(userID, name, config)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[name] = config
+	}
+
+	configuredBrokersJSON, err := json.Marshal(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configured_brokers: %w", err)
+	}
+	return configuredBrokersJSON, nil
+}
+
+// encryptBrokerConfig returns a copy of a broker config with its credentials encrypted
+func (r *UserRepository) encryptBrokerConfig(userID int, name string, config data.BrokerConfig) (data.BrokerConfig, error) {
+	if r.keyring == nil {
+		return config, fmt.Errorf("no master key loaded for broker credentials")
+	}
+
+	if config.APIKey != nil {
+		apiKey := *config.APIKey
+		config.APIKey = &apiKey
+	}
+	if config.APISecret != nil {
+		apiSecret := *config.APISecret
+		config.APISecret = &apiSecret
+	}
+	for _, field := range brokerCredentials(&config) {
+		value, err := r.keyring.Encrypt(*field.value, credentialContext(userID, name, field.name))
+		if err != nil {
+			return config, fmt.Errorf("failed to encrypt %s credentials: %w", name, err)
+		}
+		*field.value = value
+	}
+	return config, nil
+}
+
+// decryptConfiguredBrokers decrypts the credentials of broker configs read from the database in place
+// Plaintext credentials written before encryption was enabled are returned as is.
+func (r *UserRepository) decryptConfiguredBrokers(userID int, configuredBrokers map[string]data.BrokerConfig) error {
+	for name, config := range configuredBrokers {
+		for _, field := range brokerCredentials(&config) {
+			if !secrets.IsEncrypted(*field.value) {
+				continue
+			}
+			if r.keyring == nil {
+				return fmt.Errorf("no master key loaded for broker credentials")
+			}
+			value, err := r.keyring.Decrypt(*field.value, credentialContext(userID, name, field.name))
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s credentials: %w", name, err)
+			}
+			*field.value = value
+		}
+		configuredBrokers[name] = config
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package repos
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/secrets"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// legacyEncrypt seals a value in the enc:v1 format, which bound no user or field
+func legacyEncrypt(t *testing.T, masterKey []byte, plaintext string) string {
+	t.Helper()
+	gcm := func(key []byte) cipher.AEAD {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatalf("cipher: %v", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatalf("gcm: %v", err)
+		}
+		return aead
+	}
+	dataKey := bytes.Repeat([]byte{7}, secrets.KeySize)
+	nonce := make([]byte, 12)
+	wrapped := gcm(masterKey).Seal(nonce, nonce, dataKey, nil)
+	sealed := gcm(dataKey).Seal(nonce, nonce, []byte(plaintext), nil)
+
+	sum := sha256.Sum256(masterKey)
+	encoding := base64.RawStdEncoding
+	return "enc:v1:" + hex.EncodeToString(sum[:4]) + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed)
+}
+
+// storedToken returns the access token of a user's broker as stored in the database
+func storedToken(t *testing.T, conn *sql.DB, userID int) string {
+	t.Helper()
+	var token string
+	if err := conn.QueryRow(`SELECT json_extract(configured_brokers, '$.zerodha.access_token') FROM users WHERE id = ?`, userID).Scan(&token); err != nil {
+		t.Fatalf("read stored token: %v", err)
+	}
+	return token
+}
+
+func setStoredToken(t *testing.T, conn *sql.DB, userID int, token string) {
+	t.Helper()
+	if _, err := conn.Exec(`UPDATE users SET configured_brokers = json_set(configured_brokers, '$.zerodha.access_token', ?) WHERE id = ?`, token, userID); err != nil {
+		t.Fatalf("write stored token: %v", err)
+	}
+}
+
+func TestBrokerCredentialsAreBoundToTheirUser(t *testing.T) {
+	conn := testutil.NewDB(t).GetConnection()
+	masterKey := bytes.Repeat([]byte{1}, secrets.KeySize)
+	keyring, err := secrets.NewKeyring(masterKey)
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	repo := NewUserRepository(conn, keyring)
+
+	apiKey := "api-key"
+	users := make([]*data.User, 2)
+	for i := range users {
+		users[i] = &data.User{
+			Name: "trader", Email: utils.GenerateID() + "@example.com", CreatedAt: time.Now().UTC(),
+			ConfiguredBrokers: map[string]data.BrokerConfig{
+				"zerodha": {AccessToken: "token-" + strconv.Itoa(i), APIKey: &apiKey, ConfiguredAt: time.Now().UTC()},
+			},
+		}
+		if err := repo.CreateUser(users[i]); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	owner, other := users[0], users[1]
+
+	got, err := repo.GetUserByID(strconv.Itoa(owner.ID))
+	if err != nil || got.ConfiguredBrokers["zerodha"].AccessToken != "token-0" {
+		t.Fatalf("GetUserByID = %+v, %v; want the token back", got, err)
+	}
+
+	// A sealed token copied into another user's row does not decrypt there
+	setStoredToken(t, conn, other.ID, storedToken(t, conn, owner.ID))
+	if _, err := repo.GetUserByID(strconv.Itoa(other.ID)); err == nil {
+		t.Errorf("another user's sealed token decrypted")
+	}
+
+	// enc:v1 rows decrypt and are rewritten in the current format at startup
+	setStoredToken(t, conn, other.ID, legacyEncrypt(t, masterKey, "legacy-token"))
+	reencrypted, err := repo.ReencryptBrokerCredentials()
+	if err != nil || reencrypted != 1 {
+		t.Fatalf("ReencryptBrokerCredentials = %d, %v; want 1 user updated", reencrypted, err)
+	}
+	if token := storedToken(t, conn, other.ID); !strings.HasPrefix(token, "enc:v2:") {
+		t.Errorf("stored token after re-encryption = %q, want an enc:v2 value", token)
+	}
+	got, err = repo.GetUserByID(strconv.Itoa(other.ID))
+	if err != nil || got.ConfiguredBrokers["zerodha"].AccessToken != "legacy-token" {
+		t.Errorf("GetUserByID after re-encryption = %+v, %v; want the legacy token", got, err)
+	}
+	if reencrypted, err := repo.ReencryptBrokerCredentials(); err != nil || reencrypted != 0 {
+		t.Errorf("second ReencryptBrokerCredentials = %d, %v; want nothing left", reencrypted, err)
+	}
+}
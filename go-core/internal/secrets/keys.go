@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-core/internal/utils"
+)
+
+// Load builds the keyring from the environment
+//
+// SECRETS_MASTER_KEY holds the active master key and SECRETS_RETIRED_MASTER_KEYS a comma
+// separated list of retired ones, each base64 encoded. Otherwise keys are read from
+// SECRETS_MASTER_KEY_FILE, or from defaultKeyFile if that is unset: one base64 key per
+// line, the first active and the rest retired, with # comments. A missing default keyfile
+// is created with a new random key, so credentials are always encrypted.
+//
+// To rotate, put a new key first and keep the old one as retired. Credentials are
+// re-encrypted under the new key on the next start, after which the old key can be removed.
+func Load(defaultKeyFile string) (*Keyring, error) {
+	if encoded := os.Getenv("SECRETS_MASTER_KEY"); encoded != "" {
+		keys := []string{encoded}
+		// Empty entries, such as from a trailing comma, are ignored
+		for _, retired := range strings.Split(os.Getenv("SECRETS_RETIRED_MASTER_KEYS"), ",") {
+			if retired = strings.TrimSpace(retired); retired != "" {
+				keys = append(keys, retired)
+			}
+		}
+		return keyringFromEncoded(keys)
+	}
+
+	path := os.Getenv("SECRETS_MASTER_KEY_FILE")
+	if path == "" {
+		path = defaultKeyFile
+		if err := createKeyFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("master key file %s contains no keys", path)
+	}
+
+	return keyringFromEncoded(keys)
+}
+
+// GenerateKey returns a new random master key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", fmt.Errorf("failed to generate master key: %w", err)
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// keyringFromEncoded decodes base64 master keys, the first active, into a keyring
+func keyringFromEncoded(keys []string) (*Keyring, error) {
+	decoded := make([][]byte, 0, len(keys))
+	for i, key := range keys {
+		raw, err := decodeKey(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("master key %d is not valid base64: %w", i+1, err)
+		}
+		decoded = append(decoded, raw)
+	}
+	return NewKeyring(decoded[0], decoded[1:]...)
+}
+
+// decodeKey accepts base64 keys with or without padding
+func decodeKey(key string) ([]byte, error) {
+	return encoding.DecodeString(strings.TrimRight(key, "="))
+}
+
+// createKeyFile writes a keyfile with a new master key if none exists at path
+func createKeyFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check master key file: %w", err)
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create master key directory: %w", err)
+	}
+	contents := "# Master key for broker credentials. Back it up: credentials cannot be decrypted without it.\n" + key + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		return fmt.Errorf("failed to write master key file: %w", err)
+	}
+
+	utils.LogInfo("Generated master key for broker credentials", map[string]interface{}{
+		"path": path,
+	})
+	return nil
+}
@@ -0,0 +1,235 @@
+// Package secrets encrypts broker credentials at rest with envelope encryption.
+//
+// Every value is sealed with its own random data key (AES-256-GCM), and the data key is
+// wrapped with a master key. Encrypted values look like
+//
+//	enc:v2:<master key ID>:<wrapped data key>:<sealed value>
+//
+// so a keyring holding the current master key and any retired ones can decrypt values
+// written under either, and re-encrypt old values under the current key.
+//
+// Both the data key and the value are sealed with the caller's context (for broker credentials
+// the user ID and field name) as additional authenticated data, so a value copied into another
+// user's row or another field fails to decrypt. enc:v1 values were sealed without a context;
+// they still decrypt and are reported as needing re-encryption.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// KeySize is the length of a master key in bytes (AES-256)
+	KeySize = 32
+
+	prefix       = "enc:v2:"
+	legacyPrefix = "enc:v1:"
+)
+
+var (
+	// ErrUnknownKey is returned when a value was encrypted under a master key that is not in the keyring
+	ErrUnknownKey = errors.New("value was encrypted with a master key that is not loaded")
+	// ErrMalformed is returned when an encrypted value cannot be parsed
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+var encoding = base64.RawStdEncoding
+
+// masterKey is a key-encryption key identified by a fingerprint of its bytes
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring holds the active master key used for encryption and retired keys kept for decryption
+type Keyring struct {
+	active *masterKey
+	keys   map[string]*masterKey
+}
+
+// NewKeyring creates a keyring from the active master key and any retired ones
+func NewKeyring(active []byte, retired ...[]byte) (*Keyring, error) {
+	activeKey, err := newMasterKey(active)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := &Keyring{
+		active: activeKey,
+		keys:   map[string]*masterKey{activeKey.id: activeKey},
+	}
+	for _, raw := range retired {
+		key, err := newMasterKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retired master key: %w", err)
+		}
+		if _, exists := keyring.keys[key.id]; !exists {
+			keyring.keys[key.id] = key
+		}
+	}
+
+	return keyring, nil
+}
+
+// newMasterKey validates a master key and prepares its cipher
+func newMasterKey(raw []byte) (*masterKey, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", KeySize, len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// ActiveKeyID returns the fingerprint of the master key new values are encrypted with
+func (k *Keyring) ActiveKeyID() string {
+	return k.active.id
+}
+
+// Encrypt seals a value bound to context under a fresh data key wrapped with the active master key
+// Empty values are returned as is, so unset credentials stay unset.
+func (k *Keyring) Encrypt(plaintext, context string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	aad := []byte(context)
+	wrapped, err := seal(k.active.aead, dataKey, aad)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAEAD, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.active.id + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value written by Encrypt under any master key in the keyring with the same context
+// Values without the encrypted prefix are plaintext written before encryption was enabled
+// and are returned as is; enc:v1 values carry no context and ignore it.
+func (k *Keyring) Decrypt(value, context string) (string, error) {
+	var aad []byte
+	switch {
+	case strings.HasPrefix(value, prefix):
+		value, aad = strings.TrimPrefix(value, prefix), []byte(context)
+	case strings.HasPrefix(value, legacyPrefix):
+		value = strings.TrimPrefix(value, legacyPrefix)
+	default:
+		return value, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	key, exists := k.keys[parts[0]]
+	if !exists {
+		return "", fmt.Errorf("%w (key ID %s)", ErrUnknownKey, parts[0])
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	sealed, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := open(key.aead, wrapped, aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, sealed, aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsReencryption reports whether a value is plaintext, sealed without a context, or encrypted
+// under a retired master key
+func (k *Keyring) NeedsReencryption(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	return !strings.HasPrefix(value, prefix+k.active.id+":")
+}
+
+// IsEncrypted reports whether a value was written by Encrypt, in the current format or the legacy one
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix) || strings.HasPrefix(value, legacyPrefix)
+}
+
+// Redact masks a credential for logs and API responses, keeping the last four characters
+// of long values so users can tell tokens apart
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 12 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// newAEAD creates an AES-256-GCM cipher for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// seal encrypts plaintext with a random nonce, returning nonce || ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open reverses seal
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,272 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// key returns a master key filled with one byte
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+// context is what the tests bind values to, shaped like a broker credential's
+const context = "user:1:zerodha:access_token"
+
+func newKeyring(t *testing.T, active []byte, retired ...[]byte) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(active, retired...)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keyring := newKeyring(t, key(1))
+
+	// Each plaintext has a character base64 never produces, so it cannot turn up in the output by chance
+	for _, plaintext := range []string{"access-token-123", "x!", "ünïcode:with:colons"} {
+		encrypted, err := keyring.Encrypt(plaintext, context)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if !IsEncrypted(encrypted) || strings.Contains(encrypted, plaintext) {
+			t.Errorf("Encrypt(%q) = %q, want an opaque enc:v2 value", plaintext, encrypted)
+		}
+		if !strings.HasPrefix(encrypted, prefix+keyring.ActiveKeyID()+":") {
+			t.Errorf("Encrypt(%q) = %q, not under the active key %s", plaintext, encrypted, keyring.ActiveKeyID())
+		}
+		again, _ := keyring.Encrypt(plaintext, context)
+		if again == encrypted {
+			t.Errorf("Encrypt(%q) is deterministic", plaintext)
+		}
+
+		decrypted, err := keyring.Decrypt(encrypted, context)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, decrypted, err)
+		}
+	}
+
+	if encrypted, err := keyring.Encrypt("", context); encrypted != "" || err != nil {
+		t.Errorf("Encrypt(\"\") = %q, %v; want empty", encrypted, err)
+	}
+	if decrypted, err := keyring.Decrypt("legacy-plaintext", context); decrypted != "legacy-plaintext" || err != nil {
+		t.Errorf("Decrypt of plaintext = %q, %v; want it unchanged", decrypted, err)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	keyring := newKeyring(t, key(1))
+	other := newKeyring(t, key(2))
+	foreign, _ := other.Encrypt("secret", context)
+	valid, _ := keyring.Encrypt("secret", context)
+	parts := strings.Split(valid, ":")
+
+	tests := []struct {
+		name    string
+		value   string
+		context string
+		wantErr error
+	}{
+		{name: "unknown master key", value: foreign, wantErr: ErrUnknownKey},
+		{name: "missing part", value: prefix + keyring.ActiveKeyID() + ":abc", wantErr: ErrMalformed},
+		{name: "bad base64", value: prefix + keyring.ActiveKeyID() + ":!!:" + parts[4], wantErr: ErrMalformed},
+		{name: "truncated data key", value: prefix + keyring.ActiveKeyID() + ":AAAA:" + parts[4], wantErr: ErrMalformed},
+		{name: "tampered value", value: strings.Join(parts[:4], ":") + ":" + flipFirst(parts[4])},
+		{name: "other context", value: valid, context: "user:2:zerodha:access_token"},
+	}
+	for _, tt := range tests {
+		if tt.context == "" {
+			tt.context = context
+		}
+		_, err := keyring.Decrypt(tt.value, tt.context)
+		if err == nil {
+			t.Errorf("%s: Decrypt succeeded", tt.name)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Decrypt error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// flipFirst changes the first base64 character of a value, which falls in the nonce
+func flipFirst(value string) string {
+	replacement := "A"
+	if value[0] == 'A' {
+		replacement = "B"
+	}
+	return replacement + value[1:]
+}
+
+func TestRotation(t *testing.T) {
+	old := newKeyring(t, key(1))
+	encrypted, _ := old.Encrypt("token", context)
+
+	rotated := newKeyring(t, key(2), key(1))
+	if rotated.ActiveKeyID() == old.ActiveKeyID() {
+		t.Fatalf("rotated keyring kept the old active key")
+	}
+	if !rotated.NeedsReencryption(encrypted) {
+		t.Errorf("value under the retired key does not need re-encryption")
+	}
+	decrypted, err := rotated.Decrypt(encrypted, context)
+	if err != nil || decrypted != "token" {
+		t.Fatalf("Decrypt under retired key = %q, %v", decrypted, err)
+	}
+
+	reencrypted, _ := rotated.Encrypt(decrypted, context)
+	if rotated.NeedsReencryption(reencrypted) {
+		t.Errorf("value under the active key needs re-encryption")
+	}
+	if _, err := newKeyring(t, key(2)).Decrypt(reencrypted, context); err != nil {
+		t.Errorf("re-encrypted value needs the retired key: %v", err)
+	}
+	if _, err := newKeyring(t, key(2)).Decrypt(encrypted, context); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old value decrypted without the retired key: %v", err)
+	}
+
+	for value, want := range map[string]bool{"": false, "plaintext": true} {
+		if got := rotated.NeedsReencryption(value); got != want {
+			t.Errorf("NeedsReencryption(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+// legacyEncrypt seals a value the way enc:v1 did, without a context
+func legacyEncrypt(t *testing.T, keyring *Keyring, plaintext string) string {
+	t.Helper()
+	dataKey := key(9)
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		t.Fatalf("newAEAD: %v", err)
+	}
+	wrapped, err := seal(keyring.active.aead, dataKey, nil)
+	if err != nil {
+		t.Fatalf("seal data key: %v", err)
+	}
+	sealed, err := seal(dataAEAD, []byte(plaintext), nil)
+	if err != nil {
+		t.Fatalf("seal value: %v", err)
+	}
+	return legacyPrefix + keyring.ActiveKeyID() + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed)
+}
+
+func TestLegacyValues(t *testing.T) {
+	keyring := newKeyring(t, key(1))
+	legacy := legacyEncrypt(t, keyring, "token")
+
+	if !IsEncrypted(legacy) {
+		t.Errorf("enc:v1 value is not recognised as encrypted")
+	}
+	if !keyring.NeedsReencryption(legacy) {
+		t.Errorf("enc:v1 value under the active key does not need re-encryption")
+	}
+	decrypted, err := keyring.Decrypt(legacy, context)
+	if err != nil || decrypted != "token" {
+		t.Fatalf("Decrypt of enc:v1 value = %q, %v", decrypted, err)
+	}
+
+	reencrypted, _ := keyring.Encrypt(decrypted, context)
+	if !strings.HasPrefix(reencrypted, prefix) || keyring.NeedsReencryption(reencrypted) {
+		t.Errorf("re-encrypted value %q is not a current enc:v2 value", reencrypted)
+	}
+}
+
+func TestNewKeyringRejectsShortKeys(t *testing.T) {
+	if _, err := NewKeyring(key(1)[:16]); err == nil {
+		t.Errorf("16-byte active key accepted")
+	}
+	if _, err := NewKeyring(key(1), []byte("short")); err == nil {
+		t.Errorf("short retired key accepted")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"", ""},
+		{"short", "****"},
+		{"exactly12chr", "****"},
+		{"a-longer-access-token", "****oken"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.value); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	active, _ := GenerateKey()
+	retired, _ := GenerateKey()
+	activeID := newKeyring(t, mustDecode(t, active)).ActiveKeyID()
+
+	t.Run("environment keys ignore empty retired entries", func(t *testing.T) {
+		t.Setenv("SECRETS_MASTER_KEY", active)
+		t.Setenv("SECRETS_RETIRED_MASTER_KEYS", " "+retired+", ,")
+		keyring, err := Load(filepath.Join(t.TempDir(), "unused.key"))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if keyring.ActiveKeyID() != activeID || len(keyring.keys) != 2 {
+			t.Errorf("keyring has active %s and %d keys, want %s and 2", keyring.ActiveKeyID(), len(keyring.keys), activeID)
+		}
+	})
+
+	t.Run("key file with comments and a retired key", func(t *testing.T) {
+		t.Setenv("SECRETS_MASTER_KEY", "")
+		path := filepath.Join(t.TempDir(), "master.key")
+		os.WriteFile(path, []byte("# current\n"+active+"\n\n# retired\n"+retired+"\n"), 0600)
+		t.Setenv("SECRETS_MASTER_KEY_FILE", path)
+		keyring, err := Load("")
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if keyring.ActiveKeyID() != activeID || len(keyring.keys) != 2 {
+			t.Errorf("keyring has active %s and %d keys, want %s and 2", keyring.ActiveKeyID(), len(keyring.keys), activeID)
+		}
+	})
+
+	t.Run("missing default key file is created once", func(t *testing.T) {
+		t.Setenv("SECRETS_MASTER_KEY", "")
+		t.Setenv("SECRETS_MASTER_KEY_FILE", "")
+		path := filepath.Join(t.TempDir(), "nested", "master.key")
+		first, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		second, err := Load(path)
+		if err != nil {
+			t.Fatalf("second Load: %v", err)
+		}
+		if first.ActiveKeyID() != second.ActiveKeyID() {
+			t.Errorf("key file was regenerated")
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("key file stat = %v, %v; want mode 0600", info, err)
+		}
+	})
+
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		t.Setenv("SECRETS_MASTER_KEY", "not base64!")
+		if _, err := Load(""); err == nil {
+			t.Errorf("invalid master key accepted")
+		}
+	})
+}
+
+func mustDecode(t *testing.T, encoded string) []byte {
+	t.Helper()
+	raw, err := decodeKey(encoded)
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	return raw
+}
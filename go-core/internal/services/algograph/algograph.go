@@ -0,0 +1,434 @@
+// Package algograph turns the node graphs drawn on the web canvas into algorithm code. A graph
+// is checked for unknown nodes, bad settings, wires between mismatched ports, unconnected inputs
+// and cycles, then compiled into a Starlark algorithm(data, context), so visual algorithms run,
+// backtest, paper trade and keep versions through the same runtime as code algorithms.
+package algograph
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go-core/internal/data"
+)
+
+// PortType is the kind of value a node input or output carries
+type PortType string
+
+const (
+	PortNumber  PortType = "number"  // a price or indicator value; None until there is enough history
+	PortBoolean PortType = "boolean" // a condition
+	PortRisk    PortType = "risk"    // position sizing for the broker
+	PortAny     PortType = "any"     // code block inputs accept every type
+)
+
+// Port is a named input or output of a node
+type Port struct {
+	Name     string   `json:"name"`
+	Type     PortType `json:"type"`
+	Required bool     `json:"required,omitempty"`
+}
+
+// Issue is a problem that keeps a graph from compiling
+type Issue struct {
+	NodeID  string `json:"node_id,omitempty"`
+	EdgeID  string `json:"edge_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by Compile for a graph with issues
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.Message
+	}
+	return "invalid graph: " + strings.Join(messages, "; ")
+}
+
+// Indicators the indicator node computes, with their default periods
+var indicatorPeriods = map[string]int{
+	"SMA": 20,
+	"EMA": 20,
+	"RSI": 14,
+}
+
+// Operators of condition nodes: comparisons and crossovers of two numbers, and logic on booleans
+var (
+	comparisons = map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true}
+	crossovers  = map[string]bool{"crosses_above": true, "crosses_below": true}
+	logic       = map[string]int{"and": 2, "or": 2, "not": 1} // operator to its boolean inputs
+)
+
+// node is a graph node with its ports and parsed settings
+type node struct {
+	*data.GraphNode
+	index   int
+	inputs  []Port
+	outputs []Port
+	wires   map[string]wire // input name to the output feeding it
+
+	// indicator
+	indicator              string
+	period                 int
+	fast, slow, signalSpan int
+	// condition
+	operator string
+	value    *float64 // constant b of a comparison
+	// codeBlock
+	code string
+	// riskManagement
+	quantity               int
+	stopLossPct, targetPct *float64
+}
+
+// wire is the output of a node an input reads
+type wire struct {
+	from   *node
+	output string
+}
+
+// plan is a checked graph
+type plan struct {
+	nodes  []*node
+	broker *node
+}
+
+// Validate checks a graph and returns its issues; none means it compiles
+func Validate(graph *data.AlgorithmGraph) []Issue {
+	_, issues := analyze(graph)
+	return issues
+}
+
+// analyze checks a graph and resolves its wiring
+func analyze(graph *data.AlgorithmGraph) (*plan, []Issue) {
+	issues := []Issue{}
+	if graph == nil || len(graph.Nodes) == 0 {
+		return nil, append(issues, Issue{Message: "graph has no nodes"})
+	}
+	nodeIssue := func(n *data.GraphNode, format string, args ...interface{}) {
+		issues = append(issues, Issue{NodeID: n.ID, Message: fmt.Sprintf("node %q: ", n.ID) + fmt.Sprintf(format, args...)})
+	}
+	edgeIssue := func(e *data.GraphEdge, format string, args ...interface{}) {
+		issues = append(issues, Issue{EdgeID: e.ID, Message: fmt.Sprintf("edge %q: ", e.ID) + fmt.Sprintf(format, args...)})
+	}
+
+	p := &plan{}
+	byID := map[string]*node{}
+	for i := range graph.Nodes {
+		n := &node{GraphNode: &graph.Nodes[i], index: i, wires: map[string]wire{}}
+		switch {
+		case n.ID == "":
+			issues = append(issues, Issue{Message: fmt.Sprintf("node %d has no id", i)})
+			continue
+		case byID[n.ID] != nil:
+			nodeIssue(n.GraphNode, "id is used by another node")
+			continue
+		}
+		byID[n.ID] = n
+		if err := n.configure(); err != nil {
+			nodeIssue(n.GraphNode, "%v", err)
+			n.inputs, n.outputs = nil, nil
+			continue
+		}
+		p.nodes = append(p.nodes, n)
+		if n.Type == data.GraphNodeBroker {
+			if p.broker != nil {
+				nodeIssue(n.GraphNode, "a graph has one broker node, and %q is already one", p.broker.ID)
+				continue
+			}
+			p.broker = n
+		}
+	}
+	if p.broker == nil {
+		issues = append(issues, Issue{Message: "graph has no broker node to send its signal to"})
+	}
+
+	for i := range graph.Edges {
+		e := &graph.Edges[i]
+		source, target := byID[e.Source], byID[e.Target]
+		if source == nil || target == nil {
+			edgeIssue(e, "connects a node that does not exist")
+			continue
+		}
+		if source.outputs == nil || target.inputs == nil {
+			continue // the node is already reported
+		}
+
+		output, ok := findPort(source.outputs, e.SourceHandle)
+		if !ok {
+			edgeIssue(e, "node %q has no output %q", source.ID, e.SourceHandle)
+			continue
+		}
+		input, ok := target.resolveInput(e.TargetHandle, output.Type)
+		if !ok {
+			if e.TargetHandle == "" {
+				edgeIssue(e, "node %q has no free input for the %s output %q of node %q", target.ID, output.Type, output.Name, source.ID)
+			} else {
+				edgeIssue(e, "node %q has no input %q", target.ID, e.TargetHandle)
+			}
+			continue
+		}
+		if _, wired := target.wires[input.Name]; wired {
+			edgeIssue(e, "input %q of node %q is already connected", input.Name, target.ID)
+			continue
+		}
+		if input.Type != PortAny && input.Type != output.Type {
+			edgeIssue(e, "cannot connect the %s output %q of node %q to the %s input %q of node %q",
+				output.Type, output.Name, source.ID, input.Type, input.Name, target.ID)
+			continue
+		}
+		target.wires[input.Name] = wire{from: source, output: output.Name}
+	}
+
+	for _, n := range p.nodes {
+		for _, input := range n.inputs {
+			if _, wired := n.wires[input.Name]; input.Required && !wired {
+				nodeIssue(n.GraphNode, "input %q is not connected", input.Name)
+			}
+		}
+	}
+	if p.broker != nil {
+		_, buy := p.broker.wires["buy"]
+		_, sell := p.broker.wires["sell"]
+		if !buy && !sell {
+			nodeIssue(p.broker.GraphNode, "connect a condition to its buy or sell input")
+		}
+	}
+	issues = append(issues, cycles(p.nodes)...)
+
+	return p, issues
+}
+
+// cycles reports each cycle of wires once
+func cycles(nodes []*node) []Issue {
+	issues := []Issue{}
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[*node]int{}
+	var path []*node
+	var visit func(n *node)
+	visit = func(n *node) {
+		state[n] = visiting
+		path = append(path, n)
+		for _, input := range n.inputs {
+			w, ok := n.wires[input.Name]
+			if !ok {
+				continue
+			}
+			switch state[w.from] {
+			case unvisited:
+				visit(w.from)
+			case visiting:
+				// path runs from consumers to the nodes feeding them, so walking it back
+				// from n follows the wires forward
+				ids := []string{strconv.Quote(w.from.ID)}
+				for i := len(path) - 1; i >= 0; i-- {
+					ids = append(ids, strconv.Quote(path[i].ID))
+					if path[i] == w.from {
+						break
+					}
+				}
+				issues = append(issues, Issue{NodeID: w.from.ID, Message: "nodes " + strings.Join(ids, " -> ") + " form a cycle"})
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = done
+	}
+	for _, n := range nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return issues
+}
+
+// findPort returns the port called name, or the first port when name is empty
+func findPort(ports []Port, name string) (Port, bool) {
+	for _, port := range ports {
+		if port.Name == name || name == "" {
+			return port, true
+		}
+	}
+	return Port{}, false
+}
+
+// resolveInput returns the input called name, or when name is empty the first unwired input
+// that accepts t
+func (n *node) resolveInput(name string, t PortType) (Port, bool) {
+	if name != "" {
+		return findPort(n.inputs, name)
+	}
+	for _, input := range n.inputs {
+		if _, wired := n.wires[input.Name]; !wired && (input.Type == t || input.Type == PortAny) {
+			return input, true
+		}
+	}
+	return Port{}, false
+}
+
+// configure reads a node's settings and works out its ports
+func (n *node) configure() error {
+	switch n.Type {
+	case data.GraphNodeMarketData:
+		n.inputs = []Port{}
+		for _, field := range []string{"close", "open", "high", "low", "volume"} {
+			n.outputs = append(n.outputs, Port{Name: field, Type: PortNumber})
+		}
+
+	case data.GraphNodeIndicator:
+		n.indicator = strings.ToUpper(n.text("indicator"))
+		if n.indicator == "" {
+			// The canvas names the indicator only in the label, such as "RSI Indicator"
+			n.indicator = strings.ToUpper(strings.SplitN(strings.TrimSpace(n.text("label")), " ", 2)[0])
+		}
+		n.inputs = []Port{{Name: "source", Type: PortNumber, Required: true}}
+		n.outputs = []Port{{Name: "value", Type: PortNumber}}
+		var err error
+		if n.indicator == "MACD" {
+			n.outputs = append(n.outputs, Port{Name: "signal", Type: PortNumber}, Port{Name: "histogram", Type: PortNumber})
+			if n.fast, err = n.positiveInt("fast", 12); err != nil {
+				return err
+			}
+			if n.slow, err = n.positiveInt("slow", 26); err != nil {
+				return err
+			}
+			if n.signalSpan, err = n.positiveInt("signal", 9); err != nil {
+				return err
+			}
+			if n.fast >= n.slow {
+				return fmt.Errorf("MACD fast period %d must be shorter than the slow period %d", n.fast, n.slow)
+			}
+			return nil
+		}
+		period, known := indicatorPeriods[n.indicator]
+		if !known {
+			return fmt.Errorf("unknown indicator %q; expected SMA, EMA, RSI or MACD", n.indicator)
+		}
+		if n.period, err = n.positiveInt("period", period); err != nil {
+			return err
+		}
+
+	case data.GraphNodeCondition:
+		operator := n.text("operator")
+		if operator == "" {
+			operator = n.text("condition") // what the canvas calls it
+		}
+		n.operator = strings.ToLower(strings.TrimSpace(operator))
+		n.outputs = []Port{{Name: "result", Type: PortBoolean}}
+		if arity, ok := logic[n.operator]; ok {
+			n.inputs = []Port{{Name: "a", Type: PortBoolean, Required: true}}
+			if arity == 2 {
+				n.inputs = append(n.inputs, Port{Name: "b", Type: PortBoolean, Required: true})
+			}
+			return nil
+		}
+		if !comparisons[n.operator] && !crossovers[n.operator] {
+			return fmt.Errorf("unknown operator %q; expected >, <, >=, <=, ==, !=, crosses_above, crosses_below, and, or or not", n.operator)
+		}
+		value, err := n.number("value")
+		if err != nil {
+			return err
+		}
+		n.value = value
+		n.inputs = []Port{
+			{Name: "a", Type: PortNumber, Required: true},
+			{Name: "b", Type: PortNumber, Required: value == nil}, // compared with value when unconnected
+		}
+
+	case data.GraphNodeCodeBlock:
+		n.code = n.text("code")
+		if strings.TrimSpace(n.code) == "" {
+			return fmt.Errorf("code block has no code")
+		}
+		output := PortType(strings.ToLower(n.text("output")))
+		switch output {
+		case "":
+			output = PortNumber
+		case PortNumber, PortBoolean:
+		default:
+			return fmt.Errorf("code block output must be number or boolean, got %q", output)
+		}
+		n.inputs = []Port{{Name: "a", Type: PortAny}, {Name: "b", Type: PortAny}, {Name: "c", Type: PortAny}}
+		n.outputs = []Port{{Name: "value", Type: output}}
+
+	case data.GraphNodeRiskManagement:
+		n.inputs = []Port{}
+		n.outputs = []Port{{Name: "risk", Type: PortRisk}}
+		var err error
+		if n.quantity, err = n.positiveInt("quantity", 1); err != nil {
+			return err
+		}
+		if n.stopLossPct, err = n.number("stop_loss_pct"); err != nil {
+			return err
+		}
+		if n.stopLossPct != nil && (*n.stopLossPct <= 0 || *n.stopLossPct >= 100) {
+			return fmt.Errorf("stop_loss_pct must be a percentage above 0 and below 100")
+		}
+		if n.targetPct, err = n.number("target_pct"); err != nil {
+			return err
+		}
+		if n.targetPct != nil && *n.targetPct <= 0 {
+			return fmt.Errorf("target_pct must be a percentage above 0")
+		}
+
+	case data.GraphNodeBroker:
+		n.inputs = []Port{{Name: "buy", Type: PortBoolean}, {Name: "sell", Type: PortBoolean}, {Name: "risk", Type: PortRisk}}
+		n.outputs = []Port{}
+
+	default:
+		return fmt.Errorf("unknown node type %q", n.Type)
+	}
+	return nil
+}
+
+// text is a string setting, or empty
+func (n *node) text(key string) string {
+	s, _ := n.Data[key].(string)
+	return s
+}
+
+// number is a numeric setting, or nil when unset; the canvas may send numbers as strings
+func (n *node) number(key string) (*float64, error) {
+	var value float64
+	switch v := n.Data[key].(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		value = v
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number, got %q", key, v)
+		}
+		value = parsed
+	default:
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%s must be a finite number", key)
+	}
+	return &value, nil
+}
+
+// positiveInt is a whole number setting of at least 1, or fallback when unset
+func (n *node) positiveInt(key string, fallback int) (int, error) {
+	value, err := n.number(key)
+	if err != nil || value == nil {
+		return fallback, err
+	}
+	if *value < 1 || *value != math.Trunc(*value) || *value > 100000 {
+		return 0, fmt.Errorf("%s must be a whole number from 1 to 100000, got %v", key, *value)
+	}
+	return int(*value), nil
+}
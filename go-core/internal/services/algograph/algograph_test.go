@@ -0,0 +1,205 @@
+package algograph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-core/internal/data"
+)
+
+func graphNode(id string, nodeType data.GraphNodeType, settings map[string]interface{}) data.GraphNode {
+	return data.GraphNode{ID: id, Type: nodeType, Data: settings}
+}
+
+// graphEdge wires source to target; handles may be empty
+func graphEdge(source, sourceHandle, target, targetHandle string) data.GraphEdge {
+	return data.GraphEdge{ID: source + "-" + target, Source: source, Target: target, SourceHandle: sourceHandle, TargetHandle: targetHandle}
+}
+
+// smaCross buys when the close crosses above its SMA and sells when it crosses below
+func smaCross(period interface{}) *data.AlgorithmGraph {
+	return &data.AlgorithmGraph{
+		Nodes: []data.GraphNode{
+			graphNode("price", data.GraphNodeMarketData, map[string]interface{}{"label": "Price"}),
+			graphNode("sma", data.GraphNodeIndicator, map[string]interface{}{"label": "SMA Indicator", "period": period}),
+			graphNode("up", data.GraphNodeCondition, map[string]interface{}{"label": "close above SMA", "operator": "crosses_above"}),
+			graphNode("down", data.GraphNodeCondition, map[string]interface{}{"label": "close below SMA", "condition": "crosses_below"}),
+			graphNode("risk", data.GraphNodeRiskManagement, map[string]interface{}{"quantity": 5.0, "stop_loss_pct": 2.0, "target_pct": "4"}),
+			graphNode("dhan", data.GraphNodeBroker, map[string]interface{}{"broker": "Dhan"}),
+		},
+		Edges: []data.GraphEdge{
+			graphEdge("price", "", "sma", ""),
+			graphEdge("price", "close", "up", "a"),
+			graphEdge("sma", "", "up", "b"),
+			graphEdge("price", "", "down", ""),
+			graphEdge("sma", "value", "down", ""),
+			graphEdge("up", "", "dhan", "buy"),
+			graphEdge("down", "", "dhan", "sell"),
+			graphEdge("risk", "", "dhan", ""),
+		},
+	}
+}
+
+// withNodes is the SMA cross graph with extra nodes and edges
+func withNodes(nodes []data.GraphNode, edges ...data.GraphEdge) *data.AlgorithmGraph {
+	graph := smaCross(3.0)
+	graph.Nodes = append(graph.Nodes, nodes...)
+	graph.Edges = append(graph.Edges, edges...)
+	return graph
+}
+
+func messages(issues []Issue) []string {
+	all := make([]string, len(issues))
+	for i, issue := range issues {
+		all[i] = issue.Message
+	}
+	return all
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph *data.AlgorithmGraph
+		want  []string
+	}{
+		{name: "valid", graph: smaCross(3.0)},
+		{name: "nil", graph: nil, want: []string{"graph has no nodes"}},
+		{name: "empty", graph: &data.AlgorithmGraph{}, want: []string{"graph has no nodes"}},
+		{
+			name: "types, wiring and cycles",
+			graph: &data.AlgorithmGraph{
+				Nodes: []data.GraphNode{
+					graphNode("price", data.GraphNodeMarketData, nil),
+					graphNode("rsi", data.GraphNodeIndicator, map[string]interface{}{"indicator": "RSI"}),
+					graphNode("mystery", "sentiment", nil),
+					graphNode("x", data.GraphNodeCondition, map[string]interface{}{"operator": "and"}),
+					graphNode("y", data.GraphNodeCondition, map[string]interface{}{"operator": "not"}),
+					graphNode("dhan", data.GraphNodeBroker, nil),
+				},
+				Edges: []data.GraphEdge{
+					graphEdge("price", "close", "dhan", "buy"),
+					graphEdge("x", "", "y", ""),
+					graphEdge("y", "", "x", ""),
+					graphEdge("price", "", "x", "b"),
+				},
+			},
+			want: []string{
+				`node "mystery": unknown node type "sentiment"`,
+				`edge "price-dhan": cannot connect the number output "close" of node "price" to the boolean input "buy" of node "dhan"`,
+				`edge "price-x": cannot connect the number output "close" of node "price" to the boolean input "b" of node "x"`,
+				`node "rsi": input "source" is not connected`,
+				`node "x": input "b" is not connected`,
+				`node "dhan": connect a condition to its buy or sell input`,
+				`nodes "x" -> "y" -> "x" form a cycle`,
+			},
+		},
+		{
+			name: "ids and brokers",
+			graph: withNodes([]data.GraphNode{
+				graphNode("", data.GraphNodeMarketData, nil),
+				graphNode("price", data.GraphNodeMarketData, nil),
+				graphNode("zerodha", data.GraphNodeBroker, nil),
+			}),
+			want: []string{
+				"node 6 has no id",
+				`node "price": id is used by another node`,
+				`node "zerodha": a graph has one broker node, and "dhan" is already one`,
+			},
+		},
+		{
+			name: "settings",
+			graph: withNodes([]data.GraphNode{
+				graphNode("vwap", data.GraphNodeIndicator, map[string]interface{}{"label": "VWAP"}),
+				graphNode("macd", data.GraphNodeIndicator, map[string]interface{}{"indicator": "MACD", "fast": 26.0, "slow": 12.0}),
+				graphNode("half", data.GraphNodeIndicator, map[string]interface{}{"indicator": "EMA", "period": 2.5}),
+				graphNode("text", data.GraphNodeIndicator, map[string]interface{}{"indicator": "SMA", "period": "ten"}),
+				graphNode("between", data.GraphNodeCondition, map[string]interface{}{"operator": "between"}),
+				graphNode("stop", data.GraphNodeRiskManagement, map[string]interface{}{"stop_loss_pct": 100.0}),
+				graphNode("target", data.GraphNodeRiskManagement, map[string]interface{}{"target_pct": "0"}),
+				graphNode("empty", data.GraphNodeCodeBlock, map[string]interface{}{"code": "  \n"}),
+				graphNode("text-out", data.GraphNodeCodeBlock, map[string]interface{}{"code": "return 'x'", "output": "string"}),
+			}),
+			want: []string{
+				`node "vwap": unknown indicator "VWAP"; expected SMA, EMA, RSI or MACD`,
+				`node "macd": MACD fast period 26 must be shorter than the slow period 12`,
+				`node "half": period must be a whole number from 1 to 100000, got 2.5`,
+				`node "text": period must be a number, got "ten"`,
+				`node "between": unknown operator "between"; expected >, <, >=, <=, ==, !=, crosses_above, crosses_below, and, or or not`,
+				`node "stop": stop_loss_pct must be a percentage above 0 and below 100`,
+				`node "target": target_pct must be a percentage above 0`,
+				`node "empty": code block has no code`,
+				`node "text-out": code block output must be number or boolean, got "string"`,
+			},
+		},
+		{
+			name: "edges",
+			graph: withNodes(
+				[]data.GraphNode{
+					graphNode("rsi", data.GraphNodeIndicator, map[string]interface{}{"indicator": "RSI"}),
+					graphNode("all", data.GraphNodeCondition, map[string]interface{}{"operator": "and"}),
+				},
+				graphEdge("ghost", "", "rsi", ""),
+				graphEdge("price", "vwap", "rsi", ""),
+				graphEdge("price", "", "rsi", "length"),
+				graphEdge("price", "close", "rsi", "source"),
+				data.GraphEdge{ID: "again", Source: "price", Target: "rsi", TargetHandle: "source"},
+				graphEdge("risk", "", "all", ""),
+			),
+			want: []string{
+				`edge "ghost-rsi": connects a node that does not exist`,
+				`edge "price-rsi": node "price" has no output "vwap"`,
+				`edge "price-rsi": node "rsi" has no input "length"`,
+				`edge "again": input "source" of node "rsi" is already connected`,
+				`edge "risk-all": node "all" has no free input for the risk output "risk" of node "risk"`,
+				`node "all": input "a" is not connected`,
+				`node "all": input "b" is not connected`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messages(Validate(tt.graph))
+			if len(tt.want) == 0 {
+				tt.want = []string{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issues\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIssuesNameTheirNodeOrEdge(t *testing.T) {
+	graph := withNodes(
+		[]data.GraphNode{graphNode("vwap", data.GraphNodeIndicator, map[string]interface{}{"indicator": "VWAP"})},
+		graphEdge("price", "", "ghost", ""),
+	)
+	issues := Validate(graph)
+	if len(issues) != 2 || issues[0].NodeID != "vwap" || issues[0].EdgeID != "" || issues[1].EdgeID != "price-ghost" || issues[1].NodeID != "" {
+		t.Fatalf("issues %+v", issues)
+	}
+
+	err := &ValidationError{Issues: issues}
+	if !strings.HasPrefix(err.Error(), `invalid graph: node "vwap": unknown indicator`) || !strings.Contains(err.Error(), "; edge ") {
+		t.Fatalf("error %q", err)
+	}
+}
+
+func TestIndicatorFromLabel(t *testing.T) {
+	tests := []struct {
+		settings  map[string]interface{}
+		indicator string
+		period    int
+	}{
+		{settings: map[string]interface{}{"label": "RSI Indicator"}, indicator: "RSI", period: 14},
+		{settings: map[string]interface{}{"label": " ema", "period": "9"}, indicator: "EMA", period: 9},
+		{settings: map[string]interface{}{"indicator": "sma", "label": "EMA Indicator"}, indicator: "SMA", period: 20},
+	}
+	for _, tt := range tests {
+		n := &node{GraphNode: &data.GraphNode{ID: "n", Type: data.GraphNodeIndicator, Data: tt.settings}}
+		if err := n.configure(); err != nil || n.indicator != tt.indicator || n.period != tt.period {
+			t.Errorf("configure(%v) = %s(%d), %v; want %s(%d)", tt.settings, n.indicator, n.period, err, tt.indicator, tt.period)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package algograph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go-core/internal/data"
+	"go-core/internal/services/algoruntime"
+)
+
+// header starts every compiled algorithm
+const header = `# Compiled from the algorithm's canvas graph. Edit the graph rather than this code:
+# saving the graph compiles it again.
+#
+# Each node_N(bars, context, memo) returns a dict of node N's outputs on bars, the candles up
+# to some bar. memo caches them for the current evaluation.
+`
+
+// helpers are the indicator functions compiled code calls, in the order they are emitted
+var helpers = []struct {
+	name string
+	uses []string
+	code string
+}{
+	{"_known", nil, `
+def _known(values):
+    return [v for v in values if v != None]
+`},
+	{"_sma", []string{"_known"}, `
+def _sma(values, period):
+    values = _known(values)
+    if len(values) < period:
+        return None
+    return sum(values[-period:]) / period
+`},
+	{"_ema_series", nil, `
+def _ema_series(values, period):
+    series = []
+    ema = None
+    alpha = 2.0 / (period + 1)
+    for i in range(len(values)):
+        if i + 1 < period:
+            series.append(None)
+            continue
+        if ema == None:
+            ema = sum(values[:period]) / period
+        else:
+            ema = alpha * values[i] + (1 - alpha) * ema
+        series.append(ema)
+    return series
+`},
+	{"_ema", []string{"_known", "_ema_series"}, `
+def _ema(values, period):
+    values = _known(values)
+    if len(values) < period:
+        return None
+    return _ema_series(values, period)[-1]
+`},
+	{"_rsi", []string{"_known"}, `
+def _rsi(values, period):
+    values = _known(values)
+    if len(values) <= period:
+        return None
+    gain = 0.0
+    loss = 0.0
+    for i in range(1, period + 1):
+        change = values[i] - values[i - 1]
+        gain += max(change, 0)
+        loss += max(-change, 0)
+    gain = gain / period
+    loss = loss / period
+    for i in range(period + 1, len(values)):
+        change = values[i] - values[i - 1]
+        gain = (gain * (period - 1) + max(change, 0)) / period
+        loss = (loss * (period - 1) + max(-change, 0)) / period
+    if loss == 0:
+        return 100.0
+    return 100 - 100 / (1 + gain / loss)
+`},
+	{"_macd", []string{"_known", "_ema_series"}, `
+def _macd(values, fast, slow, signal):
+    values = _known(values)
+    if len(values) < slow:
+        return {'value': None, 'signal': None, 'histogram': None}
+    fast_ema = _ema_series(values, fast)
+    slow_ema = _ema_series(values, slow)
+    line = [fast_ema[i] - slow_ema[i] for i in range(slow - 1, len(values))]
+    signal_line = _ema_series(line, signal)[-1]
+    if signal_line == None:
+        return {'value': line[-1], 'signal': None, 'histogram': None}
+    return {'value': line[-1], 'signal': signal_line, 'histogram': line[-1] - signal_line}
+`},
+}
+
+// Compile checks a graph and compiles it into algorithm code for the runtime
+// A graph with issues returns a *ValidationError. Nodes the broker does not depend on are left
+// out. The same graph always compiles to the same code.
+func Compile(graph *data.AlgorithmGraph) (string, error) {
+	p, issues := analyze(graph)
+	if len(issues) > 0 {
+		return "", &ValidationError{Issues: issues}
+	}
+
+	// Nodes the broker reads, each after the nodes it reads
+	var order []*node
+	seen := map[*node]bool{}
+	var visit func(n *node)
+	visit = func(n *node) {
+		seen[n] = true
+		for _, input := range n.inputs {
+			if w, ok := n.wires[input.Name]; ok && !seen[w.from] {
+				visit(w.from)
+			}
+		}
+		order = append(order, n)
+	}
+	visit(p.broker)
+
+	used := map[string]bool{}
+	var nodes strings.Builder
+	for _, n := range order {
+		if n != p.broker {
+			nodes.WriteString(n.compile(used))
+		}
+	}
+
+	var code strings.Builder
+	code.WriteString(header)
+	for _, helper := range helpers {
+		if used[helper.name] {
+			code.WriteString(helper.code)
+		}
+	}
+	code.WriteString(nodes.String())
+	code.WriteString(p.broker.compileBroker())
+
+	// Everything but code blocks is generated; an error in one is reported on its node
+	if _, err := algoruntime.Compile(code.String()); err != nil {
+		return "", &ValidationError{Issues: []Issue{codeBlockIssue(order, code.String(), err)}}
+	}
+	return code.String(), nil
+}
+
+// codeBlockIssue reports an error compiling the code of a graph on the code block it is in
+func codeBlockIssue(nodes []*node, code string, err error) Issue {
+	var codeErr *algoruntime.Error
+	if !errors.As(err, &codeErr) || codeErr.Line == 0 {
+		return Issue{Message: err.Error()}
+	}
+	lines := strings.Split(code, "\n")
+	for _, n := range nodes {
+		if n.Type != data.GraphNodeCodeBlock {
+			continue
+		}
+		def := fmt.Sprintf("def block_%d(", n.index)
+		body := len(n.codeLines())
+		for i, line := range lines {
+			// The body starts on the line after the def, which is line i+1. An error at the end
+			// of its last line is reported on the blank line that follows it.
+			if strings.HasPrefix(line, def) && codeErr.Line > i+1 && codeErr.Line <= i+2+body {
+				return Issue{NodeID: n.ID, Message: fmt.Sprintf("node %q: line %d: %s", n.ID, min(codeErr.Line-i-1, body), codeErr.Msg)}
+			}
+		}
+	}
+	return Issue{Message: err.Error()}
+}
+
+// name is the function computing a node's outputs
+func (n *node) name() string {
+	return fmt.Sprintf("node_%d", n.index)
+}
+
+// read is the expression for an input on bars, or None when it is not connected
+func (n *node) read(input, bars string) string {
+	w, ok := n.wires[input]
+	if !ok {
+		return "None"
+	}
+	return fmt.Sprintf("%s(%s, context, memo)[%s]", w.from.name(), bars, quote(w.output))
+}
+
+// history is the expression for an input on every bar of bars, oldest first
+func (n *node) history(input string) string {
+	w := n.wires[input]
+	if w.from.Type == data.GraphNodeMarketData {
+		return fmt.Sprintf("[bar[%s] for bar in bars]", quote(w.output))
+	}
+	return fmt.Sprintf("[%s(bars[:k], context, memo)[%s] for k in range(1, len(bars) + 1)]", w.from.name(), quote(w.output))
+}
+
+// use marks a helper and the helpers it calls as used
+func use(used map[string]bool, name string) {
+	used[name] = true
+	for _, helper := range helpers {
+		if helper.name == name {
+			for _, dependency := range helper.uses {
+				use(used, dependency)
+			}
+		}
+	}
+}
+
+// compile emits the function of a node other than the broker
+func (n *node) compile(used map[string]bool) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "\n# %s %s\n", n.Type, strconv.Quote(n.ID))
+
+	if n.Type == data.GraphNodeMarketData {
+		// Candles already are dicts of close, open, high, low and volume
+		fmt.Fprintf(&out, "def %s(bars, context, memo):\n    return bars[-1]\n", n.name())
+		return out.String()
+	}
+
+	var body []string
+	switch n.Type {
+	case data.GraphNodeIndicator:
+		switch n.indicator {
+		case "MACD":
+			use(used, "_macd")
+			body = []string{fmt.Sprintf("outputs = _macd(%s, %d, %d, %d)", n.history("source"), n.fast, n.slow, n.signalSpan)}
+		default:
+			helper := "_" + strings.ToLower(n.indicator)
+			use(used, helper)
+			body = []string{fmt.Sprintf("outputs = {'value': %s(%s, %d)}", helper, n.history("source"), n.period)}
+		}
+
+	case data.GraphNodeCondition:
+		body = n.conditionBody()
+
+	case data.GraphNodeCodeBlock:
+		fmt.Fprintf(&out, "def block_%d(bars, context, a, b, c):\n", n.index)
+		for _, line := range n.codeLines() {
+			out.WriteString(strings.TrimRight("    "+line, " ") + "\n")
+		}
+		out.WriteString("\n")
+		body = []string{fmt.Sprintf("outputs = {'value': block_%d(bars, context, %s, %s, %s)}",
+			n.index, n.read("a", "bars"), n.read("b", "bars"), n.read("c", "bars"))}
+
+	case data.GraphNodeRiskManagement:
+		body = []string{fmt.Sprintf("outputs = {'risk': {'quantity': %d, 'stop_loss_pct': %s, 'target_pct': %s}}",
+			n.quantity, literal(n.stopLossPct), literal(n.targetPct))}
+	}
+
+	fmt.Fprintf(&out, "def %s(bars, context, memo):\n", n.name())
+	fmt.Fprintf(&out, "    key = (%s, len(bars))\n", quote(n.name()))
+	out.WriteString("    if key in memo:\n        return memo[key]\n")
+	for _, line := range body {
+		out.WriteString("    " + line + "\n")
+	}
+	out.WriteString("    memo[key] = outputs\n    return outputs\n")
+	return out.String()
+}
+
+// conditionBody computes a condition node's result
+func (n *node) conditionBody() []string {
+	if arity, ok := logic[n.operator]; ok {
+		a := fmt.Sprintf("bool(%s)", n.read("a", "bars"))
+		switch {
+		case arity == 1:
+			return []string{fmt.Sprintf("outputs = {'result': not %s}", a)}
+		default:
+			return []string{fmt.Sprintf("outputs = {'result': %s %s bool(%s)}", a, n.operator, n.read("b", "bars"))}
+		}
+	}
+
+	b := func(bars string) string {
+		if _, wired := n.wires["b"]; !wired {
+			return literal(n.value)
+		}
+		return n.read("b", bars)
+	}
+	body := []string{
+		"a = " + n.read("a", "bars"),
+		"b = " + b("bars"),
+	}
+	if comparisons[n.operator] {
+		return append(body, fmt.Sprintf("outputs = {'result': a != None and b != None and a %s b}", n.operator))
+	}
+
+	// A crossover compares this bar with the one before
+	above, below := ">", "<="
+	if n.operator == "crosses_below" {
+		above, below = "<", ">="
+	}
+	return append(body,
+		"crossed = False",
+		"if len(bars) > 1 and a != None and b != None:",
+		"    before_a = "+n.read("a", "bars[:-1]"),
+		"    before_b = "+b("bars[:-1]"),
+		fmt.Sprintf("    crossed = before_a != None and before_b != None and before_a %s before_b and a %s b", below, above),
+		"outputs = {'result': crossed}",
+	)
+}
+
+// compileBroker emits algorithm(), which turns the broker's buy and sell conditions into a
+// signal sized by its risk settings
+func (n *node) compileBroker() string {
+	reason := func(input string) string {
+		w := n.wires[input]
+		label, _ := w.from.Data["label"].(string)
+		if strings.TrimSpace(label) == "" {
+			label = w.from.ID
+		}
+		return quote(fmt.Sprintf("%s condition met: %s", input, label))
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\n# %s %s\n", n.Type, strconv.Quote(n.ID))
+	out.WriteString("def algorithm(data, context):\n")
+	out.WriteString("    if len(data) == 0:\n        return {'signal': 'HOLD', 'reason': 'No data'}\n")
+	out.WriteString("    memo = {}\n")
+	for _, input := range []string{"buy", "sell"} {
+		value := "False"
+		if _, ok := n.wires[input]; ok {
+			value = fmt.Sprintf("bool(%s)", n.read(input, "data"))
+		}
+		fmt.Fprintf(&out, "    %s = %s\n", input, value)
+	}
+	risk := "{'quantity': 1, 'stop_loss_pct': None, 'target_pct': None}"
+	if _, ok := n.wires["risk"]; ok {
+		risk = n.read("risk", "data")
+	}
+	fmt.Fprintf(&out, "    risk = %s\n", risk)
+	out.WriteString("    price = data[-1]['close']\n")
+
+	for _, side := range []struct{ input, other, signal, stop, target string }{
+		{"buy", "sell", "BUY", "1 -", "1 +"},
+		{"sell", "buy", "SELL", "1 +", "1 -"},
+	} {
+		if _, ok := n.wires[side.input]; !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "    if %s and not %s:\n", side.input, side.other)
+		fmt.Fprintf(&out, "        signal = {'signal': '%s', 'quantity': risk['quantity'], 'reason': %s}\n", side.signal, reason(side.input))
+		fmt.Fprintf(&out, "        if risk['stop_loss_pct'] != None:\n            signal['stop_loss'] = price * (%s risk['stop_loss_pct'] / 100.0)\n", side.stop)
+		fmt.Fprintf(&out, "        if risk['target_pct'] != None:\n            signal['target'] = price * (%s risk['target_pct'] / 100.0)\n", side.target)
+		out.WriteString("        return signal\n")
+	}
+	out.WriteString("    return {'signal': 'HOLD'}\n")
+	return out.String()
+}
+
+// quote is a Starlark string literal, single-quoted like the rest of the compiled code when it
+// needs no escapes
+func quote(s string) string {
+	quoted := strconv.Quote(s)
+	if strings.ContainsAny(s, "'\\") || quoted[1:len(quoted)-1] != s {
+		return quoted
+	}
+	return "'" + s + "'"
+}
+
+// literal is a number as Starlark, or None
+func literal(value *float64) string {
+	if value == nil {
+		return "None"
+	}
+	return strconv.FormatFloat(*value, 'g', -1, 64)
+}
+
+// codeLines are the lines of a code block's code, with tabs as four spaces
+func (n *node) codeLines() []string {
+	return strings.Split(strings.TrimRight(strings.ReplaceAll(n.code, "\t", "    "), "\n "), "\n")
+}
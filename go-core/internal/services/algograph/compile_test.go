@@ -0,0 +1,276 @@
+package algograph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/algoruntime"
+
+	"go.starlark.net/starlark"
+)
+
+// candles are one-minute bars with the given closes
+func candles(closes ...float64) []*data.Candle {
+	start := time.Date(2030, 1, 1, 9, 15, 0, 0, time.UTC)
+	bars := make([]*data.Candle, len(closes))
+	for i, price := range closes {
+		bars[i] = &data.Candle{
+			Symbol: "INFY", Timeframe: data.Timeframe1m, Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open: price, High: price + 1, Low: price - 1, Close: price, Volume: 1000,
+		}
+	}
+	return bars
+}
+
+// evaluate compiles a graph and runs it once over bars with the given closes
+func evaluate(t *testing.T, graph *data.AlgorithmGraph, closes ...float64) *algoruntime.Signal {
+	t.Helper()
+	code, err := Compile(graph)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	program, err := algoruntime.Compile(code)
+	if err != nil {
+		t.Fatalf("compiled code does not compile: %v\n%s", err, code)
+	}
+	result, err := program.Run(context.Background(), algoruntime.Input{Candles: candles(closes...)}, nil, nil, algoruntime.DefaultLimits())
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return result.Signal
+}
+
+func TestCompiledSMACross(t *testing.T) {
+	// SMA(3) goes from 9 to 9.67 while the close jumps from 8 to 12
+	buy := evaluate(t, smaCross(3.0), 10, 10, 10, 9, 8, 12)
+	if buy.Signal != "BUY" || buy.Quantity != 5 || buy.Reason != "buy condition met: close above SMA" ||
+		buy.StopLoss == nil || math.Abs(*buy.StopLoss-11.76) > 1e-9 || buy.Target == nil || math.Abs(*buy.Target-12.48) > 1e-9 {
+		t.Fatalf("crossing above: %+v", buy)
+	}
+
+	// The stop of a sell is above the price and the target below
+	sell := evaluate(t, smaCross(3.0), 10, 10, 10, 11, 12, 8)
+	if sell.Signal != "SELL" || sell.Reason != "sell condition met: close below SMA" ||
+		math.Abs(*sell.StopLoss-8.16) > 1e-9 || math.Abs(*sell.Target-7.68) > 1e-9 {
+		t.Fatalf("crossing below: %+v", sell)
+	}
+
+	for _, closes := range [][]float64{{10, 10, 10, 10}, {10}, {10, 10, 10, 9, 8, 12, 13}} {
+		if got := evaluate(t, smaCross(3.0), closes...); got.Signal != "HOLD" {
+			t.Errorf("closes %v: %+v, want HOLD", closes, got)
+		}
+	}
+}
+
+func TestCompiledConditions(t *testing.T) {
+	// graph sends a BUY when the condition fed by the close is true
+	graph := func(operator string, value interface{}, extra ...data.GraphNode) *data.AlgorithmGraph {
+		return &data.AlgorithmGraph{
+			Nodes: append([]data.GraphNode{
+				graphNode("price", data.GraphNodeMarketData, nil),
+				graphNode("test", data.GraphNodeCondition, map[string]interface{}{"operator": operator, "value": value}),
+				graphNode("dhan", data.GraphNodeBroker, nil),
+			}, extra...),
+			Edges: []data.GraphEdge{graphEdge("price", "", "test", ""), graphEdge("test", "", "dhan", "buy")},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		graph  *data.AlgorithmGraph
+		closes []float64
+		want   string
+	}{
+		{"greater, true", graph(">", 100.0), []float64{101}, "BUY"},
+		{"greater, false", graph(">", 100.0), []float64{100}, "HOLD"},
+		{"at least", graph(">=", "100"), []float64{100}, "BUY"},
+		{"not equal", graph("!=", 100.0), []float64{100}, "HOLD"},
+		{"crosses above a constant", graph("crosses_above", 100.0), []float64{99, 101}, "BUY"},
+		{"already above is no cross", graph("crosses_above", 100.0), []float64{101, 102}, "HOLD"},
+		{"touching is a cross from below", graph("crosses_above", 100.0), []float64{100, 101}, "BUY"},
+		{"crosses below", graph("crosses_below", 100.0), []float64{101, 99}, "BUY"},
+	}
+	for _, tt := range tests {
+		if got := evaluate(t, tt.graph, tt.closes...); got.Signal != tt.want {
+			t.Errorf("%s: closes %v gave %s, want %s", tt.name, tt.closes, got.Signal, tt.want)
+		}
+	}
+
+	// not(close > 100) buys at or below 100
+	inverted := graph(">", 100.0, graphNode("not", data.GraphNodeCondition, map[string]interface{}{"operator": "not"}))
+	inverted.Edges = []data.GraphEdge{graphEdge("price", "", "test", ""), graphEdge("test", "", "not", ""), graphEdge("not", "", "dhan", "buy")}
+	for closes, want := range map[float64]string{100: "BUY", 101: "HOLD"} {
+		if got := evaluate(t, inverted, closes); got.Signal != want {
+			t.Errorf("not(close > 100) at %v gave %s, want %s", closes, got.Signal, want)
+		}
+	}
+}
+
+func TestCompileIndicatorsAndCodeBlocks(t *testing.T) {
+	graph := &data.AlgorithmGraph{
+		Nodes: []data.GraphNode{
+			graphNode("price", data.GraphNodeMarketData, nil),
+			graphNode("rsi", data.GraphNodeIndicator, map[string]interface{}{"label": "RSI Indicator", "period": "5"}),
+			graphNode("ema", data.GraphNodeIndicator, map[string]interface{}{"indicator": "ema", "period": 4.0}),
+			graphNode("macd", data.GraphNodeIndicator, map[string]interface{}{"indicator": "MACD", "fast": 3.0, "slow": 6.0, "signal": 3.0}),
+			graphNode("oversold", data.GraphNodeCondition, map[string]interface{}{"operator": "<", "value": 45.0}),
+			graphNode("momentum", data.GraphNodeCondition, map[string]interface{}{"operator": ">", "value": 0.0}),
+			graphNode("trend", data.GraphNodeCodeBlock, map[string]interface{}{"code": "if a == None or b == None:\n\treturn False\nreturn a > b", "output": "boolean"}),
+			graphNode("both", data.GraphNodeCondition, map[string]interface{}{"operator": "and"}),
+			graphNode("overbought", data.GraphNodeCondition, map[string]interface{}{"operator": ">=", "value": 60.0}),
+			graphNode("unused", data.GraphNodeIndicator, map[string]interface{}{"indicator": "SMA"}),
+			graphNode("dhan", data.GraphNodeBroker, nil),
+		},
+		Edges: []data.GraphEdge{
+			graphEdge("price", "", "rsi", ""),
+			graphEdge("price", "", "ema", ""),
+			graphEdge("price", "", "macd", ""),
+			graphEdge("rsi", "", "oversold", ""),
+			graphEdge("macd", "histogram", "momentum", ""),
+			graphEdge("price", "", "trend", ""),
+			graphEdge("ema", "", "trend", ""),
+			graphEdge("momentum", "", "both", ""),
+			graphEdge("trend", "", "both", ""),
+			graphEdge("both", "", "dhan", "buy"),
+			graphEdge("rsi", "", "overbought", ""),
+			graphEdge("overbought", "", "dhan", "sell"),
+			graphEdge("price", "", "unused", ""),
+		},
+	}
+
+	code, err := Compile(graph)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	again, _ := Compile(graph)
+	if again != code {
+		t.Fatalf("the same graph compiled to different code")
+	}
+	// The SMA node feeds nothing the broker reads, so neither it nor its helper is emitted
+	if strings.Contains(code, `"unused"`) || strings.Contains(code, "def _sma(") || !strings.Contains(code, "def _macd(") {
+		t.Fatalf("compiled code\n%s", code)
+	}
+
+	dryRun := algoruntime.Validate(context.Background(), code, nil, "INFY", 120, algoruntime.DefaultLimits())
+	if !dryRun.Valid || len(dryRun.Diagnostics) != 0 || dryRun.Signals["SELL"] == 0 || dryRun.Signals["HOLD"] == 0 {
+		t.Fatalf("dry run %+v\n%s", dryRun, code)
+	}
+}
+
+func TestCompileReportsCodeBlockErrorsOnTheBlock(t *testing.T) {
+	graph := &data.AlgorithmGraph{
+		Nodes: []data.GraphNode{
+			graphNode("price", data.GraphNodeMarketData, nil),
+			graphNode("block", data.GraphNodeCodeBlock, map[string]interface{}{"code": "x = a\nreturn x >", "output": "boolean"}),
+			graphNode("dhan", data.GraphNodeBroker, nil),
+		},
+		Edges: []data.GraphEdge{graphEdge("price", "", "block", ""), graphEdge("block", "", "dhan", "")},
+	}
+
+	_, err := Compile(graph)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Issues) != 1 {
+		t.Fatalf("Compile error %v, want one issue", err)
+	}
+	if issue := invalid.Issues[0]; issue.NodeID != "block" || !strings.HasPrefix(issue.Message, `node "block": line 2: `) {
+		t.Fatalf("issue %+v, want line 2 of the block", issue)
+	}
+
+	// Graph issues are reported before any code is generated
+	if _, err := Compile(&data.AlgorithmGraph{}); !errors.As(err, &invalid) || invalid.Issues[0].Message != "graph has no nodes" {
+		t.Fatalf("Compile of an empty graph: %v", err)
+	}
+}
+
+// TestCompiledIndicatorHelpers checks the Starlark indicator helpers against published series:
+// StockCharts' 10-day SMA and EMA and 14-day RSI worksheets
+func TestCompiledIndicatorHelpers(t *testing.T) {
+	var src strings.Builder
+	for _, helper := range helpers {
+		src.WriteString(helper.code)
+	}
+	sum := starlark.NewBuiltin("sum", func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		total := 0.0
+		iter := starlark.Iterate(args[0])
+		defer iter.Done()
+		var v starlark.Value
+		for iter.Next(&v) {
+			f, _ := starlark.AsFloat(v)
+			total += f
+		}
+		return starlark.Float(total), nil
+	})
+	globals, err := starlark.ExecFile(&starlark.Thread{}, "helpers.star", src.String(), starlark.StringDict{"sum": sum})
+	if err != nil {
+		t.Fatalf("helpers do not run: %v", err)
+	}
+
+	call := func(name string, values []float64, period int) starlark.Value {
+		list := make([]starlark.Value, len(values))
+		for i, v := range values {
+			list[i] = starlark.Float(v)
+		}
+		result, err := starlark.Call(&starlark.Thread{}, globals[name], starlark.Tuple{starlark.NewList(list), starlark.MakeInt(period)}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		closes    []float64
+		period    int
+		want      []float64 // values from the bar the indicator first has one
+		tolerance float64
+	}{
+		{name: "_sma", closes: emaCloses, period: 10, want: []float64{22.22, 22.21, 22.23, 22.26, 22.30, 22.42, 22.61, 22.77, 22.91, 23.08, 23.21, 23.38, 23.52, 23.65, 23.71, 23.68, 23.61, 23.51, 23.43, 23.28, 23.13}, tolerance: 0.005},
+		{name: "_ema", closes: emaCloses, period: 10, want: []float64{22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34, 23.43, 23.51, 23.54, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92}, tolerance: 0.01},
+		// The worksheet rounds its running averages, so its RSI drifts from the exact values by
+		// up to 0.07
+		{name: "_rsi", closes: rsiCloses, period: 14, want: []float64{70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38, 54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77}, tolerance: 0.1},
+	}
+	for _, tt := range tests {
+		first := len(tt.closes) - len(tt.want)
+		if none := call(tt.name, tt.closes[:first], tt.period); none != starlark.None {
+			t.Errorf("%s over %d closes = %v, want None", tt.name, first, none)
+		}
+		for i, want := range tt.want {
+			got, _ := starlark.AsFloat(call(tt.name, tt.closes[:first+i+1], tt.period))
+			if math.Abs(got-want) > tt.tolerance {
+				t.Errorf("%s at close %d = %.4f, want %.2f", tt.name, first+i+1, got, want)
+			}
+		}
+	}
+
+	// None values, such as an indicator without enough history, are skipped
+	withGaps := append([]float64{}, emaCloses[:10]...)
+	list := []starlark.Value{starlark.None, starlark.None}
+	for _, v := range withGaps {
+		list = append(list, starlark.Float(v))
+	}
+	result, _ := starlark.Call(&starlark.Thread{}, globals["_sma"], starlark.Tuple{starlark.NewList(list), starlark.MakeInt(10)}, nil)
+	if got, _ := starlark.AsFloat(result); fmt.Sprintf("%.2f", got) != "22.22" {
+		t.Errorf("_sma with leading None = %v, want 22.22", result)
+	}
+}
+
+var (
+	// StockCharts' moving average worksheet
+	emaCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29, 22.15, 22.39, 22.38, 22.61, 23.36,
+		24.05, 23.75, 23.83, 23.95, 23.63, 23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+	// StockCharts' RSI worksheet
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28,
+		46.00, 46.03, 46.41, 46.22, 45.64, 46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+)
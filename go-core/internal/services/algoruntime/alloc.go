@@ -0,0 +1,801 @@
+package algoruntime
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Starlark does not account for memory, and one step can allocate without bound: "x" * 10**9,
+// list(range(10**9)) and s.replace("a", s) are a single step each. Compiled code is therefore
+// rewritten so that every operator, method and built-in that can build a large value in one
+// step goes through a wrapper charging the bytes it allocates to the run's budget: before the
+// value is built, or, when only the result tells and it cannot outgrow what the run already
+// holds, once it returns. Growth one value at a time, by append or a comprehension, costs a step
+// per value and is bounded by the step limit instead.
+
+// allocKey is the thread-local key of a run's *allocBudget
+const allocKey = "alloc"
+
+// Bytes charged per value a container holds; strings and bytes are charged their length and big
+// ints their magnitude
+const (
+	slotSize  = 16 // a list or tuple element
+	entrySize = 48 // a dict or set entry
+)
+
+// unknown is the estimate of a call whose cost only its result tells
+const unknown = -1
+
+// allocBudget counts what one run has allocated against its limit
+type allocBudget struct {
+	limit, used int64
+}
+
+// allocError is a run passing its allocation limit
+type allocError struct {
+	limit int64
+}
+
+func (e *allocError) Error() string {
+	return fmt.Sprintf("allocation limit of %d MB exceeded", e.limit>>20)
+}
+
+// charge counts n bytes against the run's budget; runs without a budget are not counted
+func charge(thread *starlark.Thread, n int64) error {
+	budget, _ := thread.Local(allocKey).(*allocBudget)
+	if budget == nil || n <= 0 {
+		return nil
+	}
+	budget.used = addSat(budget.used, n)
+	if budget.used > budget.limit {
+		return &allocError{limit: budget.limit}
+	}
+	return nil
+}
+
+// remaining is what is left of the run's budget, which is as far as estimates need to look
+func remaining(thread *starlark.Thread) int64 {
+	budget, _ := thread.Local(allocKey).(*allocBudget)
+	if budget == nil {
+		return 0
+	}
+	return max(budget.limit-budget.used, 0)
+}
+
+func addSat(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func mulSat(a, b int64) int64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > math.MaxInt64/b {
+		return math.MaxInt64
+	}
+	return a * b
+}
+
+// sizeOf approximates the bytes v takes; of the values a list or tuple holds, only strings and
+// tuples are counted, as split and dict.items build them along with the list
+func sizeOf(v starlark.Value) int64 {
+	switch v := v.(type) {
+	case starlark.String:
+		return int64(len(v))
+	case starlark.Bytes:
+		return int64(len(v))
+	case starlark.Int:
+		return intSize(v)
+	case *starlark.Dict, *starlark.Set:
+		return mulSat(int64(starlark.Len(v)), entrySize)
+	case *starlark.List, starlark.Tuple:
+		seq := v.(starlark.Indexable)
+		size := mulSat(int64(seq.Len()), slotSize)
+		for i := 0; i < seq.Len(); i++ {
+			switch elem := seq.Index(i).(type) {
+			case starlark.String, starlark.Bytes:
+				size = addSat(size, sizeOf(elem))
+			case starlark.Tuple:
+				size = addSat(size, mulSat(int64(len(elem)), slotSize))
+			}
+		}
+		return size
+	}
+	return 0
+}
+
+// intSize is the bytes of a big int; ints that fit in 64 bits take none beyond the value itself
+func intSize(i starlark.Int) int64 {
+	if _, ok := i.Int64(); ok {
+		return 0
+	}
+	return int64(i.BigInt().BitLen()/8 + 1)
+}
+
+// textSize estimates the length of the text str() makes of v, looking no further than limit
+func textSize(v starlark.Value, limit int64) int64 {
+	if s, ok := v.(starlark.String); ok {
+		return int64(len(s))
+	}
+	return reprSize(v, limit)
+}
+
+// reprSize estimates the length of repr(v), stopping once it passes limit
+// A value held in several places is written out each time, so a list nested in itself a few
+// dozen times over is written out billions of times; only a list or dict within itself is
+// written as [...] or {...}.
+func reprSize(v starlark.Value, limit int64) int64 {
+	var size int64
+	var path []starlark.Value // the lists, dicts and sets being written
+	var walk func(v starlark.Value)
+	walk = func(v starlark.Value) {
+		if size > limit {
+			return
+		}
+		switch v := v.(type) {
+		case starlark.String:
+			size += int64(len(v)) + 2
+		case starlark.Bytes:
+			size += int64(len(v)) + 3
+		case starlark.Int:
+			size += 20 + 3*intSize(v)
+		case starlark.Tuple:
+			size += 2
+			for _, elem := range v {
+				size += 2
+				walk(elem)
+			}
+		case *starlark.List, *starlark.Dict, *starlark.Set:
+			for _, outer := range path {
+				if outer == v {
+					size += 5
+					return
+				}
+			}
+			path = append(path, v)
+			size += 2
+			iter := v.(starlark.Iterable).Iterate()
+			var elem starlark.Value
+			for size <= limit && iter.Next(&elem) {
+				size += 2
+				walk(elem)
+				if dict, ok := v.(*starlark.Dict); ok {
+					value, _, _ := dict.Get(elem)
+					size += 2
+					walk(value)
+				}
+			}
+			iter.Done()
+			path = path[:len(path)-1]
+		default:
+			size += int64(len(v.String()))
+		}
+	}
+	walk(v)
+	return size
+}
+
+// costFunc estimates what a call of a built-in bound to recv allocates, or returns unknown
+type costFunc func(thread *starlark.Thread, recv starlark.Value, args starlark.Tuple, kwargs []starlark.Tuple) int64
+
+// charged wraps b so calls are charged their estimated cost before b runs, or, without an
+// estimate, the size of the result and any growth of the receiver once b returns
+func charged(b *starlark.Builtin, cost costFunc) *starlark.Builtin {
+	return starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		estimate := int64(unknown)
+		if cost != nil {
+			estimate = cost(thread, b.Receiver(), args, kwargs)
+		}
+		if estimate != unknown {
+			if err := charge(thread, estimate); err != nil {
+				return nil, err
+			}
+			return b.CallInternal(thread, args, kwargs)
+		}
+
+		before := sizeOf(b.Receiver())
+		result, err := b.CallInternal(thread, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		if err := charge(thread, addSat(sizeOf(result), sizeOf(b.Receiver())-before)); err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+}
+
+// lenCost charges per element of the first argument, for built-ins that copy it
+func lenCost(per int64) costFunc {
+	return func(_ *starlark.Thread, _ starlark.Value, args starlark.Tuple, _ []starlark.Tuple) int64 {
+		if len(args) == 0 {
+			return 0
+		}
+		n := starlark.Len(args[0])
+		if n < 0 {
+			return unknown
+		}
+		return mulSat(int64(n), per)
+	}
+}
+
+// zipCost charges for the tuples zip builds
+func zipCost(_ *starlark.Thread, _ starlark.Value, args starlark.Tuple, _ []starlark.Tuple) int64 {
+	longest := 0
+	for _, arg := range args {
+		n := starlark.Len(arg)
+		if n < 0 {
+			return unknown
+		}
+		longest = max(longest, n)
+	}
+	return mulSat(int64(longest), int64(len(args)+1)*slotSize)
+}
+
+// textCost charges for the text made of the arguments, as by str, repr and print
+func textCost(thread *starlark.Thread, _ starlark.Value, args starlark.Tuple, kwargs []starlark.Tuple) int64 {
+	limit := remaining(thread)
+	var size int64
+	for _, arg := range args {
+		size = addSat(size, textSize(arg, limit))
+	}
+	for _, kwarg := range kwargs {
+		size = addSat(size, textSize(kwarg[1], limit))
+	}
+	return size
+}
+
+// formatCost charges for str.format: the receiver with its fields filled in
+func formatCost(thread *starlark.Thread, recv starlark.Value, args starlark.Tuple, kwargs []starlark.Tuple) int64 {
+	return addSat(sizeOf(recv), textCost(thread, recv, args, kwargs))
+}
+
+// joinCost charges for str.join: every string joined and a separator after each
+func joinCost(_ *starlark.Thread, recv starlark.Value, args starlark.Tuple, _ []starlark.Tuple) int64 {
+	if len(args) != 1 {
+		return 0
+	}
+	iterable, ok := args[0].(starlark.Iterable)
+	if !ok {
+		return 0
+	}
+	separator := sizeOf(recv)
+	var size int64
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		size = addSat(size, addSat(sizeOf(elem), separator))
+	}
+	return size
+}
+
+// replaceCost charges for str.replace: the receiver with every replacement made
+func replaceCost(_ *starlark.Thread, recv starlark.Value, args starlark.Tuple, _ []starlark.Tuple) int64 {
+	s, _ := starlark.AsString(recv)
+	if len(args) < 2 {
+		return 0
+	}
+	old, ok := starlark.AsString(args[0])
+	replacement, ok2 := starlark.AsString(args[1])
+	if !ok || !ok2 {
+		return 0
+	}
+	n := int64(strings.Count(s, old))
+	if len(args) > 2 {
+		if count, err := starlark.AsInt32(args[2]); err == nil && count >= 0 {
+			n = min(n, int64(count))
+		}
+	}
+	return addSat(int64(len(s)), mulSat(n, int64(len(replacement))))
+}
+
+// methodCosts are the methods of strings, lists, dicts and sets that build or add many values,
+// with how each is charged; nil charges the result
+var methodCosts = map[string]costFunc{
+	"capitalize":           nil,
+	"format":               formatCost,
+	"join":                 joinCost,
+	"lower":                nil,
+	"lstrip":               nil,
+	"partition":            nil,
+	"removeprefix":         nil,
+	"removesuffix":         nil,
+	"replace":              replaceCost,
+	"rpartition":           nil,
+	"rsplit":               nil,
+	"rstrip":               nil,
+	"split":                nil,
+	"splitlines":           nil,
+	"strip":                nil,
+	"title":                nil,
+	"upper":                nil,
+	"items":                nil,
+	"keys":                 nil,
+	"values":               nil,
+	"extend":               lenCost(slotSize),
+	"update":               lenCost(entrySize),
+	"difference":           nil,
+	"intersection":         nil,
+	"symmetric_difference": nil,
+	"union":                nil,
+}
+
+// metered returns v, or the charged wrapper of v when it is one of methodCosts
+func metered(v starlark.Value) starlark.Value {
+	if method, ok := v.(*starlark.Builtin); ok && method.Receiver() != nil {
+		if cost, ok := methodCosts[method.Name()]; ok {
+			return charged(method, cost)
+		}
+	}
+	return v
+}
+
+// binaryCost estimates what x op y allocates
+func binaryCost(thread *starlark.Thread, op syntax.Token, x, y starlark.Value) int64 {
+	switch op {
+	case syntax.STAR:
+		if n, ok := y.(starlark.Int); ok && isSequence(x) {
+			return repeatCost(x, n)
+		}
+		if n, ok := x.(starlark.Int); ok && isSequence(y) {
+			return repeatCost(y, n)
+		}
+	case syntax.PERCENT:
+		if format, ok := x.(starlark.String); ok {
+			args, ok := y.(starlark.Tuple)
+			if !ok {
+				args = starlark.Tuple{y}
+			}
+			return addSat(int64(len(format)), textCost(thread, nil, args, nil))
+		}
+	case syntax.LTLT:
+		if n, ok := y.(starlark.Int); ok {
+			if shift, ok := n.Int64(); ok && shift > 0 {
+				return addSat(sizeOf(x), shift/8+1)
+			}
+		}
+	}
+	return addSat(sizeOf(x), sizeOf(y))
+}
+
+// repeatCost estimates what repeating seq n times allocates
+func repeatCost(seq starlark.Value, n starlark.Int) int64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	count, ok := n.Int64()
+	if !ok {
+		return math.MaxInt64
+	}
+	return mulSat(sizeOf(seq), count)
+}
+
+func isSequence(v starlark.Value) bool {
+	switch v.(type) {
+	case starlark.String, starlark.Bytes, *starlark.List, starlark.Tuple:
+		return true
+	}
+	return false
+}
+
+// binaryOps are the binary operators code is rewritten to call through wrappers, by wrapper name
+// Wrapper names are not identifiers, so code cannot shadow them.
+var binaryOps = map[syntax.Token]string{
+	syntax.PLUS:       "$add",
+	syntax.MINUS:      "$sub",
+	syntax.STAR:       "$mul",
+	syntax.PERCENT:    "$mod",
+	syntax.PIPE:       "$or",
+	syntax.AMP:        "$and",
+	syntax.CIRCUMFLEX: "$xor",
+	syntax.LTLT:       "$lshift",
+	syntax.GTGT:       "$rshift",
+}
+
+// unaryOps are the unary operators that copy a big int, by wrapper name
+var unaryOps = map[syntax.Token]string{
+	syntax.MINUS: "$neg",
+	syntax.TILDE: "$invert",
+}
+
+// meteredBuiltins are the wrappers rewritten code calls and the built-ins replaced by charged
+// ones, all predeclared for algorithm code
+var meteredBuiltins = func() starlark.StringDict {
+	builtins := starlark.StringDict{
+		"$iadd":   starlark.NewBuiltin("$iadd", builtinIadd),
+		"$ior":    starlark.NewBuiltin("$ior", builtinIor),
+		"$attr":   starlark.NewBuiltin("$attr", builtinAttr),
+		"$alloc":  starlark.NewBuiltin("$alloc", builtinAlloc),
+		"getattr": starlark.NewBuiltin("getattr", builtinGetattr),
+	}
+	for op, name := range binaryOps {
+		builtins[name] = binaryOperator(name, op)
+	}
+	for op, name := range unaryOps {
+		builtins[name] = unaryOperator(name, op)
+	}
+	for name, cost := range map[string]costFunc{
+		"bytes":     lenCost(1),
+		"dict":      lenCost(entrySize),
+		"enumerate": lenCost(3 * slotSize),
+		"list":      lenCost(slotSize),
+		"reversed":  lenCost(slotSize),
+		"set":       lenCost(entrySize),
+		"sorted":    lenCost(slotSize),
+		"tuple":     lenCost(slotSize),
+		"zip":       zipCost,
+		"fail":      textCost,
+		"print":     textCost,
+		"repr":      textCost,
+		"str":       textCost,
+		"abs":       nil,
+		"int":       nil,
+	} {
+		builtins[name] = charged(starlark.Universe[name].(*starlark.Builtin), cost)
+	}
+	return builtins
+}()
+
+// binaryOperator is the wrapper of x op y
+func binaryOperator(name string, op syntax.Token) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		x, y := args[0], args[1]
+		if err := charge(thread, binaryCost(thread, op, x, y)); err != nil {
+			return nil, err
+		}
+		return starlark.Binary(op, x, y)
+	})
+}
+
+// unaryOperator is the wrapper of op x
+func unaryOperator(name string, op syntax.Token) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		result, err := starlark.Unary(op, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := charge(thread, sizeOf(result)); err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+}
+
+// builtinIadd is x += y, which extends a list in place
+func builtinIadd(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	x, y := args[0], args[1]
+	list, isList := x.(*starlark.List)
+	iterable, isIterable := y.(starlark.Iterable)
+	if !isList || !isIterable {
+		if err := charge(thread, binaryCost(thread, syntax.PLUS, x, y)); err != nil {
+			return nil, err
+		}
+		return starlark.Binary(syntax.PLUS, x, y)
+	}
+
+	// Collect y first, as it may be x itself
+	n := starlark.Len(y)
+	if err := charge(thread, mulSat(int64(n), slotSize)); err != nil {
+		return nil, err
+	}
+	var elems []starlark.Value
+	iter := iterable.Iterate()
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		elems = append(elems, elem)
+	}
+	iter.Done()
+	if n < 0 {
+		if err := charge(thread, mulSat(int64(len(elems)), slotSize)); err != nil {
+			return nil, err
+		}
+	}
+	for _, elem := range elems {
+		if err := list.Append(elem); err != nil {
+			return nil, fmt.Errorf("%s", strings.Replace(err.Error(), "append to", "apply += to", 1))
+		}
+	}
+	return list, nil
+}
+
+// builtinIor is x |= y, which updates a dict in place
+func builtinIor(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	x, y := args[0], args[1]
+	dict, isDict := x.(*starlark.Dict)
+	other, otherIsDict := y.(*starlark.Dict)
+	if !isDict || !otherIsDict {
+		if err := charge(thread, binaryCost(thread, syntax.PIPE, x, y)); err != nil {
+			return nil, err
+		}
+		return starlark.Binary(syntax.PIPE, x, y)
+	}
+
+	if err := charge(thread, mulSat(int64(other.Len()), entrySize)); err != nil {
+		return nil, err
+	}
+	for _, item := range other.Items() {
+		if err := dict.SetKey(item[0], item[1]); err != nil {
+			return nil, fmt.Errorf("%s", strings.Replace(err.Error(), "insert into", "apply |= to", 1))
+		}
+	}
+	return dict, nil
+}
+
+// builtinAttr is x.name for the names in methodCosts
+func builtinAttr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	x, name := args[0], string(args[1].(starlark.String))
+	if object, ok := x.(starlark.HasAttrs); ok {
+		v, err := object.Attr(name)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			return metered(v), nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no .%s field or method", x.Type(), name)
+}
+
+// builtinGetattr is getattr, returning the charged wrapper of the methods in methodCosts
+func builtinGetattr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	v, err := starlark.Universe["getattr"].(*starlark.Builtin).CallInternal(thread, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return metered(v), nil
+}
+
+// builtinAlloc charges for a value already built, such as a slice, and returns it
+func builtinAlloc(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	if err := charge(thread, sizeOf(args[0])); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}
+
+// meter rewrites parsed code to call the wrappers in meteredBuiltins: binary and unary
+// operators, augmented assignments, slices and the methods in methodCosts
+func meter(file *syntax.File) {
+	m := &meterer{}
+	file.Stmts = m.stmts(file.Stmts)
+}
+
+// meterer rewrites one file
+type meterer struct {
+	temps int // temporaries introduced so far
+}
+
+func (m *meterer) stmts(stmts []syntax.Stmt) []syntax.Stmt {
+	out := make([]syntax.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.AssignStmt:
+			if stmt.Op != syntax.EQ {
+				out = append(out, m.augmented(stmt)...)
+				continue
+			}
+			stmt.LHS = m.target(stmt.LHS)
+			stmt.RHS = m.expr(stmt.RHS)
+		case *syntax.DefStmt:
+			m.params(stmt.Params)
+			stmt.Body = m.stmts(stmt.Body)
+		case *syntax.ExprStmt:
+			stmt.X = m.expr(stmt.X)
+		case *syntax.ForStmt:
+			stmt.Vars = m.target(stmt.Vars)
+			stmt.X = m.expr(stmt.X)
+			stmt.Body = m.stmts(stmt.Body)
+		case *syntax.WhileStmt:
+			stmt.Cond = m.expr(stmt.Cond)
+			stmt.Body = m.stmts(stmt.Body)
+		case *syntax.IfStmt:
+			stmt.Cond = m.expr(stmt.Cond)
+			stmt.True = m.stmts(stmt.True)
+			stmt.False = m.stmts(stmt.False)
+		case *syntax.ReturnStmt:
+			if stmt.Result != nil {
+				stmt.Result = m.expr(stmt.Result)
+			}
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// augmented rewrites x op= y into x = $op(x, y)
+// The object and index of an indexed or dotted target are assigned to temporaries first, so
+// they are still evaluated once; x += y and x |= y keep updating lists and dicts in place.
+func (m *meterer) augmented(stmt *syntax.AssignStmt) []syntax.Stmt {
+	stmt.RHS = m.expr(stmt.RHS)
+	var name string
+	switch stmt.Op {
+	case syntax.PLUS_EQ:
+		name = "$iadd"
+	case syntax.PIPE_EQ:
+		name = "$ior"
+	default:
+		name = binaryOps[stmt.Op-syntax.PLUS_EQ+syntax.PLUS]
+	}
+	if name == "" {
+		stmt.LHS = m.target(stmt.LHS)
+		return []syntax.Stmt{stmt}
+	}
+
+	var out []syntax.Stmt
+	temp := func(x syntax.Expr) syntax.Expr {
+		switch x.(type) {
+		case *syntax.Ident, *syntax.Literal:
+			return x
+		}
+		m.temps++
+		pos, _ := x.Span()
+		out = append(out, &syntax.AssignStmt{OpPos: pos, Op: syntax.EQ, LHS: ident(fmt.Sprintf("$t%d", m.temps), pos), RHS: m.expr(x)})
+		return ident(fmt.Sprintf("$t%d", m.temps), pos)
+	}
+
+	var target, operand syntax.Expr
+	switch lhs := unparen(stmt.LHS).(type) {
+	case *syntax.Ident:
+		target, operand = lhs, clone(lhs)
+	case *syntax.IndexExpr:
+		object, index := temp(lhs.X), temp(lhs.Y)
+		target = &syntax.IndexExpr{X: object, Lbrack: lhs.Lbrack, Y: index, Rbrack: lhs.Rbrack}
+		operand = &syntax.IndexExpr{X: clone(object), Lbrack: lhs.Lbrack, Y: clone(index), Rbrack: lhs.Rbrack}
+	case *syntax.DotExpr:
+		object := temp(lhs.X)
+		target = &syntax.DotExpr{X: object, Dot: lhs.Dot, NamePos: lhs.NamePos, Name: lhs.Name}
+		operand = &syntax.DotExpr{X: clone(object), Dot: lhs.Dot, NamePos: lhs.NamePos, Name: clone(lhs.Name).(*syntax.Ident)}
+	default:
+		// The resolver rejects any other target
+		return []syntax.Stmt{stmt}
+	}
+	return append(out, &syntax.AssignStmt{OpPos: stmt.OpPos, Op: syntax.EQ, LHS: target, RHS: call(name, stmt.OpPos, operand, stmt.RHS)})
+}
+
+// target rewrites the expressions within an assignment target, leaving the target itself
+func (m *meterer) target(e syntax.Expr) syntax.Expr {
+	switch e := e.(type) {
+	case *syntax.IndexExpr:
+		e.X, e.Y = m.expr(e.X), m.expr(e.Y)
+	case *syntax.DotExpr:
+		e.X = m.expr(e.X)
+	case *syntax.ParenExpr:
+		e.X = m.target(e.X)
+	case *syntax.ListExpr:
+		for i := range e.List {
+			e.List[i] = m.target(e.List[i])
+		}
+	case *syntax.TupleExpr:
+		for i := range e.List {
+			e.List[i] = m.target(e.List[i])
+		}
+	}
+	return e
+}
+
+// params rewrites the default values of parameters
+func (m *meterer) params(params []syntax.Expr) {
+	for _, param := range params {
+		if param, ok := param.(*syntax.BinaryExpr); ok {
+			param.Y = m.expr(param.Y)
+		}
+	}
+}
+
+func (m *meterer) expr(e syntax.Expr) syntax.Expr {
+	switch e := e.(type) {
+	case *syntax.BinaryExpr:
+		e.X, e.Y = m.expr(e.X), m.expr(e.Y)
+		name, ok := binaryOps[e.Op]
+		// A float operand makes the result a float, or an error, except in string formatting
+		if !ok || (e.Op != syntax.PERCENT && (isFloatLiteral(e.X) || isFloatLiteral(e.Y))) {
+			return e
+		}
+		return call(name, e.OpPos, e.X, e.Y)
+	case *syntax.UnaryExpr:
+		if e.X == nil {
+			return e
+		}
+		e.X = m.expr(e.X)
+		if _, literal := e.X.(*syntax.Literal); literal {
+			return e
+		}
+		if name, ok := unaryOps[e.Op]; ok {
+			return call(name, e.OpPos, e.X)
+		}
+	case *syntax.CallExpr:
+		e.Fn = m.expr(e.Fn)
+		for i := range e.Args {
+			e.Args[i] = m.expr(e.Args[i])
+		}
+	case *syntax.Comprehension:
+		e.Body = m.expr(e.Body)
+		for _, clause := range e.Clauses {
+			switch clause := clause.(type) {
+			case *syntax.ForClause:
+				clause.Vars = m.target(clause.Vars)
+				clause.X = m.expr(clause.X)
+			case *syntax.IfClause:
+				clause.Cond = m.expr(clause.Cond)
+			}
+		}
+	case *syntax.CondExpr:
+		e.Cond, e.True, e.False = m.expr(e.Cond), m.expr(e.True), m.expr(e.False)
+	case *syntax.DictEntry:
+		e.Key, e.Value = m.expr(e.Key), m.expr(e.Value)
+	case *syntax.DictExpr:
+		for i := range e.List {
+			e.List[i] = m.expr(e.List[i])
+		}
+	case *syntax.DotExpr:
+		e.X = m.expr(e.X)
+		if _, ok := methodCosts[e.Name.Name]; ok {
+			name := &syntax.Literal{Token: syntax.STRING, TokenPos: e.NamePos, Raw: strconv.Quote(e.Name.Name), Value: e.Name.Name}
+			return call("$attr", e.Dot, e.X, name)
+		}
+	case *syntax.IndexExpr:
+		e.X, e.Y = m.expr(e.X), m.expr(e.Y)
+	case *syntax.LambdaExpr:
+		m.params(e.Params)
+		e.Body = m.expr(e.Body)
+	case *syntax.ListExpr:
+		for i := range e.List {
+			e.List[i] = m.expr(e.List[i])
+		}
+	case *syntax.TupleExpr:
+		for i := range e.List {
+			e.List[i] = m.expr(e.List[i])
+		}
+	case *syntax.ParenExpr:
+		e.X = m.expr(e.X)
+	case *syntax.SliceExpr:
+		e.X = m.expr(e.X)
+		for _, bound := range []*syntax.Expr{&e.Lo, &e.Hi, &e.Step} {
+			if *bound != nil {
+				*bound = m.expr(*bound)
+			}
+		}
+		return call("$alloc", e.Lbrack, e)
+	}
+	return e
+}
+
+func call(name string, pos syntax.Position, args ...syntax.Expr) *syntax.CallExpr {
+	return &syntax.CallExpr{Fn: ident(name, pos), Lparen: pos, Args: args, Rparen: pos}
+}
+
+func ident(name string, pos syntax.Position) *syntax.Ident {
+	return &syntax.Ident{NamePos: pos, Name: name}
+}
+
+// clone copies an identifier or literal, as the resolver annotates each identifier it visits
+func clone(e syntax.Expr) syntax.Expr {
+	if id, ok := e.(*syntax.Ident); ok {
+		return ident(id.Name, id.NamePos)
+	}
+	return e
+}
+
+func unparen(e syntax.Expr) syntax.Expr {
+	for {
+		paren, ok := e.(*syntax.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = paren.X
+	}
+}
+
+func isFloatLiteral(e syntax.Expr) bool {
+	literal, ok := unparen(e).(*syntax.Literal)
+	return ok && literal.Token == syntax.FLOAT
+}
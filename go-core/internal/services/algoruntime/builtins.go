@@ -0,0 +1,295 @@
+package algoruntime
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	starlarkmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// predeclared returns the names available to algorithm code besides Starlark's built-ins:
+// the Python built-ins Starlark lacks, the math module, the f-string helper and the charged
+// built-ins and wrappers of alloc.go
+func predeclared() starlark.StringDict {
+	builtins := starlark.StringDict{
+		"sum":   starlark.NewBuiltin("sum", builtinSum),
+		"round": starlark.NewBuiltin("round", builtinRound),
+		"pow":   starlark.NewBuiltin("pow", builtinPow),
+		"math":  starlarkmath.Module,
+		"_fstr": starlark.NewBuiltin("_fstr", builtinFstr),
+	}
+	for name, builtin := range meteredBuiltins {
+		builtins[name] = builtin
+	}
+	return builtins
+}
+
+// builtinSum is Python's sum(iterable, start=0)
+func builtinSum(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var iterable starlark.Iterable
+	var total starlark.Value = starlark.MakeInt(0)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "iterable", &iterable, "start?", &total); err != nil {
+		return nil, err
+	}
+
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		if err := charge(thread, binaryCost(thread, syntax.PLUS, total, x)); err != nil {
+			return nil, err
+		}
+		sum, err := starlark.Binary(syntax.PLUS, total, x)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		total = sum
+	}
+	return total, nil
+}
+
+// builtinRound is Python's round(number, ndigits=None): an int without ndigits, halves to even
+func builtinRound(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var number starlark.Value
+	var ndigits starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "number", &number, "ndigits?", &ndigits); err != nil {
+		return nil, err
+	}
+
+	if i, ok := number.(starlark.Int); ok && ndigits == starlark.None {
+		return i, nil
+	}
+	f, ok := starlark.AsFloat(number)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s, want number", b.Name(), number.Type())
+	}
+	if ndigits == starlark.None {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%s: cannot convert %v to an integer", b.Name(), f)
+		}
+		return starlark.NumberToInt(starlark.Float(math.RoundToEven(f)))
+	}
+
+	digits, err := starlark.AsInt32(ndigits)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ndigits: %w", b.Name(), err)
+	}
+	if digits < 0 {
+		scale := math.Pow(10, float64(-digits))
+		return starlark.Float(math.RoundToEven(f/scale) * scale), nil
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'f', digits, 64), 64)
+	return starlark.Float(rounded), nil
+}
+
+// builtinPow is Python's pow(base, exp), standing in for the ** operator Starlark lacks
+func builtinPow(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var base, exp starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &base, &exp); err != nil {
+		return nil, err
+	}
+
+	baseInt, baseIsInt := base.(starlark.Int)
+	expInt, expIsInt := exp.(starlark.Int)
+	if baseIsInt && expIsInt {
+		if e, ok := expInt.Int64(); ok && e >= 0 && e <= 64 {
+			if err := charge(thread, mulSat(intSize(baseInt), e)); err != nil {
+				return nil, err
+			}
+			return starlark.MakeBigInt(new(big.Int).Exp(baseInt.BigInt(), big.NewInt(e), nil)), nil
+		}
+	}
+
+	x, ok := starlark.AsFloat(base)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s, want number", b.Name(), base.Type())
+	}
+	y, ok := starlark.AsFloat(exp)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s, want number", b.Name(), exp.Type())
+	}
+	return starlark.Float(math.Pow(x, y)), nil
+}
+
+// builtinFstr formats one f-string field: _fstr(value, spec, conversion)
+func builtinFstr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	var spec, conversion string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &value, &spec, &conversion); err != nil {
+		return nil, err
+	}
+
+	if err := charge(thread, textSize(value, remaining(thread))); err != nil {
+		return nil, err
+	}
+	if conversion == "r" || conversion == "a" {
+		value = starlark.String(value.String())
+	}
+	formatted, err := formatSpec(thread, value, spec)
+	if err != nil {
+		return nil, fmt.Errorf("f-string: %w", err)
+	}
+	return starlark.String(formatted), nil
+}
+
+// formatSpec applies a Python format spec, [[fill]align][sign][0][width][,][.precision][type],
+// to a value; types f, e, g, d, s and % are supported. The width and precision are charged to the
+// run before the value is padded or formatted to them.
+func formatSpec(thread *starlark.Thread, value starlark.Value, spec string) (string, error) {
+	if spec == "" {
+		if s, ok := starlark.AsString(value); ok {
+			return s, nil
+		}
+		return value.String(), nil
+	}
+
+	var fill, align, sign byte = ' ', 0, '-'
+	if len(spec) >= 2 && strings.IndexByte("<>^=", spec[1]) >= 0 {
+		fill, align, spec = spec[0], spec[1], spec[2:]
+	} else if len(spec) >= 1 && strings.IndexByte("<>^=", spec[0]) >= 0 {
+		align, spec = spec[0], spec[1:]
+	}
+	if len(spec) > 0 && strings.IndexByte("+- ", spec[0]) >= 0 {
+		sign, spec = spec[0], spec[1:]
+	}
+	if len(spec) > 0 && spec[0] == '0' {
+		if align == 0 {
+			fill, align = '0', '='
+		}
+		spec = spec[1:]
+	}
+	width := 0
+	for len(spec) > 0 && spec[0] >= '0' && spec[0] <= '9' {
+		width = min(width*10+int(spec[0]-'0'), math.MaxInt32)
+		spec = spec[1:]
+	}
+	var grouping byte
+	if len(spec) > 0 && (spec[0] == ',' || spec[0] == '_') {
+		grouping, spec = spec[0], spec[1:]
+	}
+	precision := -1
+	if len(spec) > 0 && spec[0] == '.' {
+		spec = spec[1:]
+		precision = 0
+		for len(spec) > 0 && spec[0] >= '0' && spec[0] <= '9' {
+			precision = min(precision*10+int(spec[0]-'0'), math.MaxInt32)
+			spec = spec[1:]
+		}
+	}
+	var kind byte
+	if len(spec) == 1 {
+		kind, spec = spec[0], ""
+	}
+	if spec != "" {
+		return "", fmt.Errorf("unsupported format spec")
+	}
+	if err := charge(thread, int64(width)+int64(max(precision, 0))); err != nil {
+		return "", err
+	}
+
+	var body string
+	numeric := true
+	switch {
+	case kind == 's' || (kind == 0 && isString(value)):
+		s, ok := starlark.AsString(value)
+		if !ok {
+			s = value.String()
+		}
+		if precision >= 0 && precision < len(s) {
+			s = s[:precision]
+		}
+		body, numeric = s, false
+	case kind == 'd':
+		i, ok := value.(starlark.Int)
+		if !ok {
+			return "", fmt.Errorf("format code 'd' requires an int, not %s", value.Type())
+		}
+		body = i.String()
+	default:
+		f, ok := starlark.AsFloat(value)
+		if !ok {
+			return "", fmt.Errorf("format code %q requires a number, not %s", string(kind), value.Type())
+		}
+		switch kind {
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			if precision < 0 {
+				precision = 6
+			}
+			body = strconv.FormatFloat(f, kind|0x20, precision, 64)
+		case '%':
+			if precision < 0 {
+				precision = 6
+			}
+			body = strconv.FormatFloat(f*100, 'f', precision, 64) + "%"
+		case 0:
+			if _, isInt := value.(starlark.Int); isInt && precision < 0 {
+				body = value.String()
+			} else {
+				body = strconv.FormatFloat(f, 'g', precision, 64)
+			}
+		default:
+			return "", fmt.Errorf("unknown format code %q", string(kind))
+		}
+	}
+
+	prefix := ""
+	if numeric {
+		if strings.HasPrefix(body, "-") {
+			prefix, body = "-", body[1:]
+		} else if sign == '+' || sign == ' ' {
+			prefix = string(sign)
+		}
+		if grouping != 0 {
+			body = group(body, grouping)
+		}
+	}
+
+	pad := width - len(prefix) - len(body)
+	if pad <= 0 {
+		return prefix + body, nil
+	}
+	if align == 0 {
+		align = '<'
+		if numeric {
+			align = '>'
+		}
+	}
+	padding := strings.Repeat(string(fill), pad)
+	switch align {
+	case '<':
+		return prefix + body + padding, nil
+	case '^':
+		return strings.Repeat(string(fill), pad/2) + prefix + body + strings.Repeat(string(fill), pad-pad/2), nil
+	case '=':
+		return prefix + padding + body, nil
+	default:
+		return padding + prefix + body, nil
+	}
+}
+
+// group inserts a thousands separator into the integer digits of a formatted number
+func group(number string, separator byte) string {
+	end := strings.IndexAny(number, ".e%")
+	if end < 0 {
+		end = len(number)
+	}
+	digits := number[:end]
+	var out strings.Builder
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteByte(separator)
+		}
+		out.WriteByte(digits[i])
+	}
+	return out.String() + number[end:]
+}
+
+func isString(value starlark.Value) bool {
+	_, ok := value.(starlark.String)
+	return ok
+}
@@ -0,0 +1,142 @@
+package algoruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// subscriberBuffer is how many runs a slow subscriber may fall behind before runs are dropped
+const subscriberBuffer = 16
+
+// NewRun builds the audit record of one run of an algorithm's code
+// state is the algorithm's state before the run; result may be nil when the code did not
+// compile, and err is the run's failure, if any.
+func NewRun(algo *data.Algorithm, source data.AlgorithmRunSource, input Input, state map[string]interface{}, result *Result, err error) *data.AlgorithmRun {
+	run := &data.AlgorithmRun{
+		ID:          utils.GenerateID(),
+		AlgorithmID: algo.ID,
+		UserID:      algo.UserID,
+		Source:      source,
+		Status:      data.AlgorithmRunStatusSucceeded,
+		Symbol:      input.Symbol,
+		Bars:        len(input.Candles),
+		CreatedAt:   time.Now().UTC(),
+	}
+	version := algo.Version
+	run.AlgorithmVersion = &version
+	if len(input.Candles) > 0 {
+		barAt := input.Candles[len(input.Candles)-1].Timestamp
+		run.BarAt = &barAt
+	}
+	if result != nil {
+		run.Logs = result.Logs
+		run.Steps = result.Steps
+		run.DurationMs = result.DurationMs
+	}
+
+	if err != nil {
+		message := err.Error()
+		run.Status = data.AlgorithmRunStatusFailed
+		run.Error = &message
+		return run
+	}
+
+	signal := result.Signal
+	run.Signal = &signal.Signal
+	run.Quantity = signal.Quantity
+	run.Price, run.StopLoss, run.Target = signal.Price, signal.StopLoss, signal.Target
+	if signal.Reason != "" {
+		run.Reason = &signal.Reason
+	}
+	run.StateDiff = DiffState(state, result.State)
+	return run
+}
+
+// DiffState compares two states, or configs, key by key
+// Values are compared by their JSON encoding, so a number stored as 1 and computed as 1.0 is
+// unchanged.
+func DiffState(before, after map[string]interface{}) *data.StateDiff {
+	diff := &data.StateDiff{}
+	for key, value := range after {
+		previous, found := before[key]
+		if !found {
+			if diff.Added == nil {
+				diff.Added = map[string]interface{}{}
+			}
+			diff.Added[key] = value
+		} else if !sameJSON(previous, value) {
+			if diff.Changed == nil {
+				diff.Changed = map[string]data.StateChange{}
+			}
+			diff.Changed[key] = data.StateChange{From: previous, To: value}
+		}
+	}
+	for key, value := range before {
+		if _, found := after[key]; !found {
+			if diff.Removed == nil {
+				diff.Removed = map[string]interface{}{}
+			}
+			diff.Removed[key] = value
+		}
+	}
+	return diff
+}
+
+func sameJSON(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// runHub fans recorded runs out to the subscribers of their algorithm
+type runHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan *data.AlgorithmRun]struct{} // by algorithm ID
+}
+
+var hub = &runHub{subscribers: make(map[string]map[chan *data.AlgorithmRun]struct{})}
+
+// Subscribe returns a channel receiving the runs of an algorithm as they are recorded, and a
+// function that ends the subscription and closes the channel
+// A subscriber that falls behind misses runs rather than holding up the algorithm.
+func Subscribe(algorithmID string) (<-chan *data.AlgorithmRun, func()) {
+	runs := make(chan *data.AlgorithmRun, subscriberBuffer)
+
+	hub.mu.Lock()
+	if hub.subscribers[algorithmID] == nil {
+		hub.subscribers[algorithmID] = make(map[chan *data.AlgorithmRun]struct{})
+	}
+	hub.subscribers[algorithmID][runs] = struct{}{}
+	hub.mu.Unlock()
+
+	var once sync.Once
+	return runs, func() {
+		once.Do(func() {
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			delete(hub.subscribers[algorithmID], runs)
+			if len(hub.subscribers[algorithmID]) == 0 {
+				delete(hub.subscribers, algorithmID)
+			}
+			close(runs)
+		})
+	}
+}
+
+// Publish sends a recorded run to its algorithm's subscribers
+func Publish(run *data.AlgorithmRun) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for runs := range hub.subscribers[run.AlgorithmID] {
+		select {
+		case runs <- run:
+		default:
+		}
+	}
+}
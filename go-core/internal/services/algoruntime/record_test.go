@@ -0,0 +1,104 @@
+package algoruntime
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-core/internal/data"
+)
+
+func TestNewRun(t *testing.T) {
+	algo := &data.Algorithm{ID: "algo", UserID: 7, Version: 3}
+	input := Input{Candles: candles(100, 101, 102), Symbol: "INFY"}
+	stop := 99.0
+	result := &Result{
+		Signal: &Signal{Signal: SignalBuy, Quantity: 5, StopLoss: &stop, Reason: "breakout"},
+		State:  map[string]interface{}{"bar": 2, "peak": 102.0},
+		Logs:   []string{"bar 2"},
+		Steps:  120,
+	}
+
+	run := NewRun(algo, data.AlgorithmRunSourceEvaluate, input, map[string]interface{}{"bar": 1}, result, nil)
+	if run.ID == "" || run.AlgorithmID != "algo" || run.UserID != 7 || *run.AlgorithmVersion != 3 || run.Source != data.AlgorithmRunSourceEvaluate {
+		t.Errorf("run %+v, want it to name the algorithm", run)
+	}
+	if run.Status != data.AlgorithmRunStatusSucceeded || run.Symbol != "INFY" || run.Bars != 3 || !run.BarAt.Equal(input.Candles[2].Timestamp) {
+		t.Errorf("run %+v, want a success at the latest of three bars", run)
+	}
+	if *run.Signal != SignalBuy || run.Quantity != 5 || *run.StopLoss != 99 || run.Target != nil || *run.Reason != "breakout" {
+		t.Errorf("run signal %v x%d, stop %v, target %v, reason %v", *run.Signal, run.Quantity, run.StopLoss, run.Target, run.Reason)
+	}
+	wantDiff := &data.StateDiff{
+		Added:   map[string]interface{}{"peak": 102.0},
+		Changed: map[string]data.StateChange{"bar": {From: 1, To: 2}},
+	}
+	if !reflect.DeepEqual(run.StateDiff, wantDiff) || !reflect.DeepEqual(run.Logs, []string{"bar 2"}) || run.Steps != 120 || run.Error != nil {
+		t.Errorf("run diff %+v, logs %q, steps %d, error %v", run.StateDiff, run.Logs, run.Steps, run.Error)
+	}
+
+	// A failed run keeps the output up to the failure but has no signal or state diff
+	failed := NewRun(algo, data.AlgorithmRunSourcePaper, input, nil, &Result{Logs: []string{"bar 3"}, Steps: 40}, errors.New("runtime error at line 6: fail: boom"))
+	if failed.Status != data.AlgorithmRunStatusFailed || *failed.Error != "runtime error at line 6: fail: boom" ||
+		failed.Signal != nil || failed.StateDiff != nil || failed.Logs[0] != "bar 3" || failed.Steps != 40 {
+		t.Errorf("failed run %+v", failed)
+	}
+
+	// Code that did not compile has no result at all
+	if broken := NewRun(algo, data.AlgorithmRunSourceScheduled, Input{}, nil, nil, errors.New("syntax error")); broken.Status != data.AlgorithmRunStatusFailed || broken.BarAt != nil || broken.Logs != nil {
+		t.Errorf("run without a result %+v", broken)
+	}
+}
+
+func TestDiffState(t *testing.T) {
+	before := map[string]interface{}{"count": 1, "levels": []interface{}{1.0, 2.0}, "gone": "x", "same": map[string]interface{}{"a": 1}}
+	after := map[string]interface{}{"count": 1.0, "levels": []interface{}{1.0, 3.0}, "new": true, "same": map[string]interface{}{"a": 1.0}}
+
+	// 1 and 1.0 encode alike, so only levels changed
+	want := &data.StateDiff{
+		Added:   map[string]interface{}{"new": true},
+		Changed: map[string]data.StateChange{"levels": {From: []interface{}{1.0, 2.0}, To: []interface{}{1.0, 3.0}}},
+		Removed: map[string]interface{}{"gone": "x"},
+	}
+	if got := DiffState(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffState = %+v, want %+v", got, want)
+	}
+	if got := DiffState(nil, nil); !reflect.DeepEqual(got, &data.StateDiff{}) {
+		t.Errorf("DiffState of nothing = %+v, want an empty diff", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	runs, stop := Subscribe("watched")
+	other, stopOther := Subscribe("other")
+	defer stopOther()
+
+	Publish(&data.AlgorithmRun{ID: "r1", AlgorithmID: "watched"})
+	if got := <-runs; got.ID != "r1" {
+		t.Fatalf("received %s, want r1", got.ID)
+	}
+	select {
+	case got := <-other:
+		t.Fatalf("another algorithm's subscriber received %s", got.ID)
+	default:
+	}
+
+	// A subscriber that falls behind misses runs instead of blocking Publish
+	for i := 0; i < subscriberBuffer+5; i++ {
+		Publish(&data.AlgorithmRun{AlgorithmID: "watched"})
+	}
+	if len(runs) != subscriberBuffer {
+		t.Fatalf("%d runs buffered, want %d", len(runs), subscriberBuffer)
+	}
+
+	stop()
+	stop()
+	for range runs {
+	}
+	Publish(&data.AlgorithmRun{AlgorithmID: "watched"}) // no subscribers left
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, found := hub.subscribers["watched"]; found {
+		t.Fatalf("the algorithm still has subscribers after the last unsubscribed")
+	}
+}
@@ -0,0 +1,549 @@
+// Package algoruntime runs the Python-like algorithm code written in the web editor in an
+// in-process Starlark sandbox under time and step limits, and validates the signal it
+// returns. Code has no access to files, the network or the clock; it sees only its arguments.
+package algoruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/indicators"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ErrorKind classifies why algorithm code failed
+type ErrorKind string
+
+const (
+	ErrorKindSyntax  ErrorKind = "syntax"         // the code does not compile
+	ErrorKindRuntime ErrorKind = "runtime"        // the code raised an error while running
+	ErrorKindLimit   ErrorKind = "limit"          // the run exceeded its time, step or allocation limit
+	ErrorKindServer  ErrorKind = "server"         // the server cancelled the run for a reason outside the code, such as memory pressure
+	ErrorKindSignal  ErrorKind = "invalid_signal" // algorithm() returned something that is not a valid signal
+	ErrorKindLint    ErrorKind = "lint"           // the code compiles but uses a construct that fails or misbehaves when run
+	ErrorKindConfig  ErrorKind = "config"         // the algorithm's config declares invalid indicators
+)
+
+// Error is a failure of algorithm code, reported back to its author
+type Error struct {
+	Kind      ErrorKind `json:"kind"`
+	Line      int       `json:"line,omitempty"`
+	Msg       string    `json:"message"`
+	Backtrace string    `json:"backtrace,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s error at line %d: %s", e.Kind, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s error: %s", e.Kind, e.Msg)
+}
+
+// Limits bound one run of algorithm code
+// MaxAlloc bounds memory per run: the operations that can build a large value in one step charge
+// what they allocate to the run (see alloc.go), and values built one step at a time are bounded
+// by MaxSteps. MaxHeap is not a limit of the run: the heap is shared by the whole process, so it
+// is a last-resort backstop that protects the server, and runs it cancels are reported as server
+// errors.
+type Limits struct {
+	Timeout  time.Duration // wall-clock time for the whole run
+	MaxSteps uint64        // Starlark execution steps, a deterministic measure of CPU
+	MaxAlloc uint64        // bytes the run may allocate in bulk, approximately; 0 does not count them
+	MaxHeap  uint64        // process heap size in bytes above which runs in progress are cancelled
+}
+
+// DefaultLimits returns the run limits, overridable with ALGORITHM_TIMEOUT (a Go duration),
+// ALGORITHM_MAX_STEPS, ALGORITHM_MAX_ALLOC_MB and ALGORITHM_MAX_HEAP_MB
+func DefaultLimits() Limits {
+	limits := Limits{
+		Timeout:  2 * time.Second,
+		MaxSteps: 10_000_000,
+		MaxAlloc: 256 << 20,
+		MaxHeap:  1 << 30,
+	}
+	if value := os.Getenv("ALGORITHM_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			limits.Timeout = timeout
+		}
+	}
+	if value := os.Getenv("ALGORITHM_MAX_STEPS"); value != "" {
+		if steps, err := strconv.ParseUint(value, 10, 64); err == nil && steps > 0 {
+			limits.MaxSteps = steps
+		}
+	}
+	if value := os.Getenv("ALGORITHM_MAX_ALLOC_MB"); value != "" {
+		if mb, err := strconv.ParseUint(value, 10, 64); err == nil && mb > 0 {
+			limits.MaxAlloc = mb << 20
+		}
+	}
+	if value := os.Getenv("ALGORITHM_MAX_HEAP_MB"); value != "" {
+		if mb, err := strconv.ParseUint(value, 10, 64); err == nil && mb > 0 {
+			limits.MaxHeap = mb << 20
+		}
+	}
+	return limits
+}
+
+// Position is an open position shown to algorithm code in context['portfolio']['positions']
+type Position struct {
+	Quantity     int     `json:"quantity"` // negative when short
+	AveragePrice float64 `json:"average_price"`
+	LastPrice    float64 `json:"last_price"`
+	PnL          float64 `json:"pnl"`
+}
+
+// Portfolio is context['portfolio']
+type Portfolio struct {
+	Cash       float64             `json:"cash"`
+	Positions  map[string]Position `json:"positions"` // keyed by symbol
+	TotalValue float64             `json:"total_value"`
+	PnL        float64             `json:"pnl"`
+}
+
+// Input is the market data one run sees; state and config come from the algorithm itself
+type Input struct {
+	Candles    []*data.Candle         `json:"candles"` // oldest first
+	Symbol     string                 `json:"symbol,omitempty"`
+	Portfolio  Portfolio              `json:"portfolio"`
+	Indicators map[string]interface{} `json:"indicators,omitempty"` // added to those the config declares
+
+	bars   []starlark.Value // Candles already converted, when the input comes from Bars.Input
+	series *Bars            // the Bars the input comes from, and the end of its window in them
+	end    int
+}
+
+// Bars converts a candle series for the runtime once, so runs over sliding windows of a long
+// series, as in a backtest, do not convert the same candles again on every bar, and computes
+// the indicators algorithms declare once over the whole series
+type Bars struct {
+	candles    []*data.Candle
+	values     []starlark.Value
+	indicators map[string]*indicators.Series // by the specs computed
+}
+
+// NewBars converts candles, oldest first
+func NewBars(candles []*data.Candle) *Bars {
+	values := make([]starlark.Value, len(candles))
+	for i, candle := range candles {
+		values[i] = candleValue(candle)
+	}
+	return &Bars{candles: candles, values: values}
+}
+
+// Input returns an input whose candles are the bars in [start, end)
+func (b *Bars) Input(start, end int) Input {
+	return Input{Candles: b.candles[start:end], bars: b.values[start:end], series: b, end: end}
+}
+
+// indicatorSeries computes specs over the bars, once
+func (b *Bars) indicatorSeries(specs []indicators.Spec) *indicators.Series {
+	key := fmt.Sprint(specs)
+	if series, ok := b.indicators[key]; ok {
+		return series
+	}
+	if b.indicators == nil {
+		b.indicators = map[string]*indicators.Series{}
+	}
+	series := indicators.Compute(specs, b.candles)
+	b.indicators[key] = series
+	return series
+}
+
+// indicatorValues is what a run sees in context['indicators']: the indicators config declares,
+// at the latest candle, and those posted with the input, which take precedence
+// An input from Bars reads indicators computed over all the bars before its window too.
+func (in Input) indicatorValues(config map[string]interface{}) (map[string]interface{}, error) {
+	specs, err := indicators.ParseSpecs(config)
+	if err != nil || len(specs) == 0 || len(in.Candles) == 0 {
+		return in.Indicators, err
+	}
+
+	var values map[string]interface{}
+	if in.series != nil {
+		values = in.series.indicatorSeries(specs).At(in.end - 1)
+	} else {
+		values = indicators.Compute(specs, in.Candles).At(len(in.Candles) - 1)
+	}
+	for key, value := range in.Indicators {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// Result is the outcome of one run
+type Result struct {
+	Signal     *Signal                `json:"signal"`
+	State      map[string]interface{} `json:"state"`
+	Logs       []string               `json:"logs,omitempty"` // print() output
+	Steps      uint64                 `json:"steps"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+const (
+	maxLogLines      = 100
+	maxLogLineLength = 1000
+)
+
+// fileOptions allows the Python constructs the editor's template may use beyond core Starlark
+var fileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Recursion:       true,
+}
+
+// Program is compiled algorithm code, safe to run many times and concurrently
+// It is compiled from the code rewritten by meter, so runs charge what they allocate.
+type Program struct {
+	program *starlark.Program
+}
+
+// Compile translates and compiles algorithm code and checks it defines algorithm(data, context)
+func Compile(code string) (*Program, error) {
+	program, _, err := compile(code)
+	return program, err
+}
+
+// compile is Compile, also returning the parsed file for static checks
+func compile(code string) (*Program, *syntax.File, error) {
+	src, err := translate(code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := fileOptions.Parse("algorithm.py", src, 0)
+	if err != nil {
+		return nil, nil, compileError(err)
+	}
+	// The program is compiled from a second parse, rewritten; the file returned is the code as written
+	metered, err := fileOptions.Parse("algorithm.py", src, 0)
+	if err != nil {
+		return nil, nil, compileError(err)
+	}
+	meter(metered)
+	builtins := predeclared()
+	program, err := starlark.FileProgram(metered, builtins.Has)
+	if err != nil {
+		return nil, nil, compileError(err)
+	}
+
+	for _, stmt := range file.Stmts {
+		if def, ok := stmt.(*syntax.DefStmt); ok && def.Name.Name == "algorithm" {
+			if len(def.Params) < 2 {
+				return nil, nil, &Error{Kind: ErrorKindSyntax, Line: int(def.Def.Line), Msg: "algorithm must take (data, context)"}
+			}
+			return &Program{program: program}, file, nil
+		}
+	}
+	return nil, nil, &Error{Kind: ErrorKindSyntax, Msg: "code must define algorithm(data, context)"}
+}
+
+// compileError converts a Starlark parse or resolve error into an Error
+func compileError(err error) error {
+	var syntaxErr syntax.Error
+	if errors.As(err, &syntaxErr) {
+		return &Error{Kind: ErrorKindSyntax, Line: int(syntaxErr.Pos.Line), Msg: syntaxErr.Msg}
+	}
+	var resolveErrs resolve.ErrorList
+	if errors.As(err, &resolveErrs) && len(resolveErrs) > 0 {
+		return &Error{Kind: ErrorKindSyntax, Line: int(resolveErrs[0].Pos.Line), Msg: resolveErrs[0].Msg}
+	}
+	return &Error{Kind: ErrorKindSyntax, Msg: err.Error()}
+}
+
+// Run calls algorithm(data, context) once under limits
+// state is the algorithm's persisted state; the state the code leaves in context['state'] is
+// returned in the result. Candles, portfolio and config are frozen, so mutating them is an error.
+// A run that fails still returns its result, without a signal or state, for the print output,
+// steps and duration up to the failure.
+func (p *Program) Run(ctx context.Context, input Input, state, config map[string]interface{}, limits Limits) (*Result, error) {
+	started := time.Now()
+	result := &Result{}
+
+	thread := &starlark.Thread{
+		Name: "algorithm",
+		Print: func(_ *starlark.Thread, msg string) {
+			if len(result.Logs) >= maxLogLines {
+				return
+			}
+			if len(msg) > maxLogLineLength {
+				msg = msg[:maxLogLineLength] + "..."
+			}
+			result.Logs = append(result.Logs, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(limits.MaxSteps)
+	if limits.MaxAlloc > 0 {
+		thread.SetLocal(allocKey, &allocBudget{limit: int64(min(limits.MaxAlloc, math.MaxInt64))})
+	}
+
+	stop := watch(ctx, thread, limits)
+	defer stop()
+
+	fail := func(err error) (*Result, error) {
+		result.Steps = thread.ExecutionSteps()
+		result.DurationMs = time.Since(started).Milliseconds()
+		return result, err
+	}
+
+	indicatorValues, err := input.indicatorValues(config)
+	if err != nil {
+		return fail(&Error{Kind: ErrorKindConfig, Msg: err.Error()})
+	}
+	input.Indicators = indicatorValues
+	data, contextDict, err := arguments(input, state, config)
+	if err != nil {
+		return fail(err)
+	}
+
+	globals, err := p.program.Init(thread, predeclared())
+	if err != nil {
+		return fail(runError(err, limits))
+	}
+	algorithm, ok := globals["algorithm"].(starlark.Callable)
+	if !ok {
+		return fail(&Error{Kind: ErrorKindRuntime, Msg: "algorithm is not a function"})
+	}
+
+	value, err := starlark.Call(thread, algorithm, starlark.Tuple{data, contextDict}, nil)
+	if err != nil {
+		return fail(runError(err, limits))
+	}
+	result.Steps = thread.ExecutionSteps()
+	result.DurationMs = time.Since(started).Milliseconds()
+
+	lastClose := 0.0
+	if len(input.Candles) > 0 {
+		lastClose = input.Candles[len(input.Candles)-1].Close
+	}
+	signal, err := parseSignal(value, lastClose)
+	if err != nil {
+		return fail(err)
+	}
+
+	stateMap := map[string]interface{}{}
+	if newState, found, _ := contextDict.Get(starlark.String("state")); found && newState != starlark.None {
+		converted, err := fromStarlark(newState)
+		if err != nil {
+			return fail(&Error{Kind: ErrorKindRuntime, Msg: fmt.Sprintf("context['state']: %s", err)})
+		}
+		var ok bool
+		if stateMap, ok = converted.(map[string]interface{}); !ok {
+			return fail(&Error{Kind: ErrorKindRuntime, Msg: fmt.Sprintf("context['state'] must be a dict, got %s", newState.Type())})
+		}
+	}
+
+	result.Signal, result.State = signal, stateMap
+	return result, nil
+}
+
+// arguments builds the data and context arguments of algorithm()
+func arguments(input Input, state, config map[string]interface{}) (*starlark.List, *starlark.Dict, error) {
+	candles := make([]starlark.Value, len(input.Candles))
+	if len(input.bars) == len(input.Candles) {
+		copy(candles, input.bars)
+	} else {
+		for i, candle := range input.Candles {
+			candles[i] = candleValue(candle)
+		}
+	}
+	data := starlark.NewList(candles)
+	data.Freeze()
+
+	positions := make(map[string]interface{}, len(input.Portfolio.Positions))
+	for symbol, position := range input.Portfolio.Positions {
+		positions[symbol] = map[string]interface{}{
+			"quantity":      position.Quantity,
+			"average_price": position.AveragePrice,
+			"last_price":    position.LastPrice,
+			"pnl":           position.PnL,
+		}
+	}
+	portfolio, err := toStarlark(map[string]interface{}{
+		"cash":        input.Portfolio.Cash,
+		"positions":   positions,
+		"total_value": input.Portfolio.TotalValue,
+		"pnl":         input.Portfolio.PnL,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	portfolio.Freeze()
+
+	contextDict := starlark.NewDict(5)
+	contextDict.SetKey(starlark.String("portfolio"), portfolio)
+	contextDict.SetKey(starlark.String("symbol"), starlark.String(input.Symbol))
+	for key, value := range map[string]map[string]interface{}{
+		"indicators": input.Indicators,
+		"state":      state,
+		"config":     config,
+	} {
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+		converted, err := toStarlark(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if key != "state" {
+			converted.Freeze()
+		}
+		contextDict.SetKey(starlark.String(key), converted)
+	}
+
+	return data, contextDict, nil
+}
+
+// candleValue converts a candle into the frozen dict algorithm code sees
+func candleValue(candle *data.Candle) starlark.Value {
+	dict := starlark.NewDict(6)
+	dict.SetKey(starlark.String("timestamp"), starlark.String(candle.Timestamp.UTC().Format(time.RFC3339)))
+	dict.SetKey(starlark.String("open"), starlark.Float(candle.Open))
+	dict.SetKey(starlark.String("high"), starlark.Float(candle.High))
+	dict.SetKey(starlark.String("low"), starlark.Float(candle.Low))
+	dict.SetKey(starlark.String("close"), starlark.Float(candle.Close))
+	dict.SetKey(starlark.String("volume"), starlark.MakeInt64(candle.Volume))
+	dict.Freeze()
+	return dict
+}
+
+// runError converts an error from running algorithm code into an Error
+// Running out of the allocation budget and cancellation by the time or step limit are reported
+// as limit errors, and cancellation by heap pressure as a server error.
+func runError(err error, limits Limits) error {
+	var evalErr *starlark.EvalError
+	if !errors.As(err, &evalErr) {
+		return &Error{Kind: ErrorKindRuntime, Msg: err.Error()}
+	}
+
+	// The wrappers of operators are not part of the code as written, so the backtrace leaves them out
+	written := *evalErr
+	if last := len(written.CallStack) - 1; last >= 0 && strings.HasPrefix(written.CallStack[last].Name, "$") {
+		written.CallStack = written.CallStack[:last]
+	}
+	result := &Error{Kind: ErrorKindRuntime, Msg: evalErr.Msg, Backtrace: written.Backtrace()}
+	for i := len(evalErr.CallStack) - 1; i >= 0; i-- {
+		if pos := evalErr.CallStack[i].Pos; pos.Filename() == "algorithm.py" {
+			result.Line = int(pos.Line)
+			break
+		}
+	}
+	var allocErr *allocError
+	if errors.As(err, &allocErr) {
+		result.Kind, result.Msg = ErrorKindLimit, allocErr.Error()
+	}
+	if strings.HasPrefix(evalErr.Msg, "Starlark computation cancelled: ") {
+		result.Kind = ErrorKindLimit
+		result.Msg = strings.TrimPrefix(evalErr.Msg, "Starlark computation cancelled: ")
+		switch result.Msg {
+		case "too many steps":
+			result.Msg = fmt.Sprintf("step limit of %d exceeded", limits.MaxSteps)
+		case heapCancelled:
+			result.Kind = ErrorKindServer
+			result.Msg = fmt.Sprintf("the server's heap passed %d MB, so runs in progress were cancelled; this is not a fault of the code and the run can be retried", limits.MaxHeap>>20)
+		}
+	}
+	return result
+}
+
+// heapMetric is the live heap size; runtime/metrics is cheap enough to sample while code runs
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// heapCancelled is the reason watch cancels a thread with when the process heap passes MaxHeap
+const heapCancelled = "server heap limit exceeded"
+
+// heapInterval is how often the process heap is sampled while runs are in progress
+const heapInterval = 10 * time.Millisecond
+
+// watch cancels thread when ctx ends, the timeout passes or the process heap passes
+// limits.MaxHeap. The heap holds every run in progress and the rest of the server, so it
+// cannot tell which run allocated; passing it cancels runs without blaming their code. Runs are
+// held to their own allocation budget first, so this is a last resort against what the budget
+// does not count.
+// Runs start no goroutine of their own: a backtest runs the code once per bar, and one shared
+// sampler watches the heap for all of them.
+// The returned function stops watching.
+func watch(ctx context.Context, thread *starlark.Thread, limits Limits) func() {
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	stopCancel := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			thread.Cancel(fmt.Sprintf("time limit of %s exceeded", limits.Timeout))
+		} else {
+			thread.Cancel("run cancelled")
+		}
+	})
+	sampler.add(thread, limits.MaxHeap)
+
+	return func() {
+		sampler.remove(thread)
+		stopCancel()
+		cancel()
+	}
+}
+
+// sampler watches the heap for every run in progress
+var sampler = &heapSampler{threads: make(map[*starlark.Thread]uint64)}
+
+// heapSampler cancels the runs it watches once the process heap passes their MaxHeap
+// Its goroutine runs while any run is watched and exits at the first sample with none.
+type heapSampler struct {
+	mu       sync.Mutex
+	threads  map[*starlark.Thread]uint64 // MaxHeap of each run
+	sampling bool
+}
+
+func (h *heapSampler) add(thread *starlark.Thread, maxHeap uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.threads[thread] = maxHeap
+	if !h.sampling {
+		h.sampling = true
+		go h.sample()
+	}
+}
+
+func (h *heapSampler) remove(thread *starlark.Thread) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.threads, thread)
+}
+
+func (h *heapSampler) sample() {
+	ticker := time.NewTicker(heapInterval)
+	defer ticker.Stop()
+
+	sample := []metrics.Sample{{Name: heapMetric}}
+	for range ticker.C {
+		metrics.Read(sample)
+		size := sample[0].Value.Uint64()
+
+		h.mu.Lock()
+		if len(h.threads) == 0 {
+			h.sampling = false
+			h.mu.Unlock()
+			return
+		}
+		for thread, maxHeap := range h.threads {
+			if size > maxHeap {
+				thread.Cancel(heapCancelled)
+				delete(h.threads, thread)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
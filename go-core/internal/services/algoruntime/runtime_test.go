@@ -0,0 +1,240 @@
+package algoruntime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+
+	"go.starlark.net/starlark"
+)
+
+// candles returns one-minute bars closing at closes, oldest first
+func candles(closes ...float64) []*data.Candle {
+	start := time.Date(2024, time.March, 4, 3, 45, 0, 0, time.UTC)
+	bars := make([]*data.Candle, len(closes))
+	for i, c := range closes {
+		bars[i] = &data.Candle{Symbol: "INFY", Timestamp: start.Add(time.Duration(i) * time.Minute), Open: c, High: c + 1, Low: c - 1, Close: c, Volume: 100}
+	}
+	return bars
+}
+
+func run(t *testing.T, code string, input Input, state, config map[string]interface{}, limits Limits) (*Result, error) {
+	t.Helper()
+	program, err := Compile(code)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return program.Run(context.Background(), input, state, config, limits)
+}
+
+func TestRun(t *testing.T) {
+	const code = `def algorithm(data, context):
+    state = context['state']
+    state['runs'] = state.get('runs', 0) + 1
+    price = data[-1]['close']
+    print('runs', state['runs'], context['portfolio']['cash'])
+    return {
+        'signal': 'buy',
+        'quantity': context['config']['quantity'],
+        'stop_loss': price * 0.98,
+        'target': None,
+        'reason': f"{len(data)} bars closing at {price:.1f}",
+    }
+`
+	input := Input{Candles: candles(100, 101, 102), Portfolio: Portfolio{Cash: 5000}}
+	result, err := run(t, code, input, map[string]interface{}{"runs": 4}, map[string]interface{}{"quantity": 3.0}, DefaultLimits())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	stop := 99.96
+	want := &Signal{Signal: SignalBuy, Quantity: 3, StopLoss: &stop, Reason: "3 bars closing at 102.0"}
+	if !reflect.DeepEqual(result.Signal, want) {
+		t.Errorf("signal %+v, want %+v", result.Signal, want)
+	}
+	if !reflect.DeepEqual(result.State, map[string]interface{}{"runs": int64(5)}) {
+		t.Errorf("state %v, want runs 5", result.State)
+	}
+	if !reflect.DeepEqual(result.Logs, []string{"runs 5 5000"}) || result.Steps == 0 {
+		t.Errorf("logs %q after %d steps", result.Logs, result.Steps)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	limits := Limits{Timeout: time.Second, MaxSteps: 10_000, MaxHeap: 1 << 40}
+	tests := []struct {
+		name string
+		code string
+		kind ErrorKind
+		line int // checked when set; a limit stops the code wherever it is
+		msg  string
+	}{
+		{name: "runtime", code: "def algorithm(data, context):\n    return {'signal': 'HOLD', 'reason': 1 / 0}\n", kind: ErrorKindRuntime, line: 2, msg: "floating-point division by zero"},
+		{name: "step limit", code: "def algorithm(data, context):\n    while True:\n        pass\n", kind: ErrorKindLimit, msg: "step limit of 10000 exceeded"},
+		{name: "operator", code: "def algorithm(data, context):\n    return {'signal': 'HOLD', 'reason': 'bars: ' + len(data)}\n", kind: ErrorKindRuntime, line: 2, msg: "unknown binary op: string + int"},
+		{name: "frozen config", code: "def algorithm(data, context):\n    context['config']['x'] = 1\n", kind: ErrorKindRuntime, line: 2, msg: "cannot insert into frozen hash table"},
+		{name: "frozen candles", code: "def algorithm(data, context):\n    data.append(1)\n", kind: ErrorKindRuntime, line: 2, msg: "append: cannot append to frozen list"},
+		{name: "not a dict", code: "def algorithm(data, context):\n    return 'BUY'\n", kind: ErrorKindSignal, msg: "algorithm must return a dict, got string"},
+		{name: "no signal", code: "def algorithm(data, context):\n    return {'quantity': 1}\n", kind: ErrorKindSignal, msg: "'signal' is required"},
+		{name: "unknown signal", code: "def algorithm(data, context):\n    return {'signal': 'short'}\n", kind: ErrorKindSignal, msg: `'signal' must be BUY, SELL or HOLD, got "SHORT"`},
+		{name: "unknown keys", code: "def algorithm(data, context):\n    return {'signal': 'HOLD', 'stop': 1, 'qty': 2}\n", kind: ErrorKindSignal, msg: "unknown keys qty, stop; expected signal, quantity, price, stop_loss, target and reason"},
+		{name: "fractional quantity", code: "def algorithm(data, context):\n    return {'signal': 'BUY', 'quantity': 1.5}\n", kind: ErrorKindSignal, msg: "'quantity' must be a positive whole number, got 1.5"},
+		{name: "buy stop above the close", code: "def algorithm(data, context):\n    return {'signal': 'BUY', 'stop_loss': 500}\n", kind: ErrorKindSignal, msg: "BUY stop_loss 500 must be below the entry price 102"},
+		{name: "sell target above the price", code: "def algorithm(data, context):\n    return {'signal': 'SELL', 'price': 90, 'target': 95}\n", kind: ErrorKindSignal, msg: "SELL target 95 must be below the entry price 90"},
+		{name: "state is not a dict", code: "def algorithm(data, context):\n    context['state'] = [1]\n    return {'signal': 'HOLD'}\n", kind: ErrorKindRuntime, msg: "context['state'] must be a dict, got list"},
+	}
+	for _, tt := range tests {
+		result, err := run(t, tt.code, Input{Candles: candles(100, 101, 102)}, nil, nil, limits)
+		var codeErr *Error
+		if !errors.As(err, &codeErr) || codeErr.Kind != tt.kind || codeErr.Msg != tt.msg || (tt.line > 0 && codeErr.Line != tt.line) {
+			t.Errorf("%s: error %v, want a %s error at line %d: %s", tt.name, err, tt.kind, tt.line, tt.msg)
+			continue
+		}
+		if result == nil || result.Signal != nil || result.State != nil {
+			t.Errorf("%s: failed run returned %+v, want no signal or state", tt.name, result)
+		}
+	}
+}
+
+func TestRunAllocLimit(t *testing.T) {
+	limits := Limits{Timeout: time.Second, MaxSteps: 10_000, MaxAlloc: 1 << 20, MaxHeap: 1 << 40}
+	tests := []struct {
+		name string
+		body string // of algorithm(data, context)
+	}{
+		{name: "repetition", body: "s = 'x' * 1000000000"},
+		{name: "list of a range", body: "xs = list(range(1000000000))"},
+		{name: "doubling", body: "s = 'xx'\nfor i in range(64):\n    s = s + s"},
+		{name: "extending a list by itself", body: "xs = [1]\nfor i in range(64):\n    xs += xs"},
+		{name: "replacing with the string itself", body: "s = 'aa'\nfor i in range(10):\n    s = s.replace('a', s)"},
+		{name: "join", body: "s = 'x' * 1000\nfor i in range(20):\n    s = s.join([s, s])"},
+		{name: "formatting a shared structure", body: "x = [1]\nfor i in range(64):\n    x = [x, x]\ns = str(x)"},
+		{name: "f-string width", body: "s = f'{1:999999999}'"},
+		{name: "keeping copies of slices", body: "s = 'x' * 100000\nkept = []\nfor i in range(100):\n    kept.append(s[1:])"},
+		{name: "keeping copies of dict items", body: "d = dict(zip(range(3000), range(3000)))\nkept = []\nfor i in range(100):\n    kept.append(d.items())"},
+	}
+	for _, tt := range tests {
+		code := "def algorithm(data, context):\n    " + strings.ReplaceAll(tt.body, "\n", "\n    ") + "\n    return {'signal': 'HOLD'}\n"
+		_, err := run(t, code, Input{}, nil, nil, limits)
+		var codeErr *Error
+		if !errors.As(err, &codeErr) || codeErr.Kind != ErrorKindLimit || codeErr.Msg != "allocation limit of 1 MB exceeded" {
+			t.Errorf("%s: error %v, want the allocation limit", tt.name, err)
+			continue
+		}
+		if codeErr.Line < 2 || strings.Contains(codeErr.Backtrace, "$") {
+			t.Errorf("%s: error at line %d with backtrace %q, want the line of the code as written", tt.name, codeErr.Line, codeErr.Backtrace)
+		}
+	}
+}
+
+// TestRunMetered checks the rewrite that charges allocations keeps what code does
+func TestRunMetered(t *testing.T) {
+	const code = `def algorithm(data, context):
+    state = context['state']
+    xs = [1]
+    alias = xs
+    xs += [2]
+    calls = [0]
+    def first():
+        calls[0] += 1
+        return 0
+    cells = [10]
+    cells[first()] *= 3
+    d = {'a': 1}
+    d |= {'b': 2}
+    state['alias'] = alias
+    state['calls'] = calls[0]
+    state['cells'] = cells
+    state['keys'] = sorted(d.keys())
+    state['text'] = ', '.join(['%d' % n for n in alias]) + '!' * 2
+    state['tail'] = data[-2:][0]['close'] - -1
+    return {'signal': 'HOLD'}
+`
+	result, err := run(t, code, Input{Candles: candles(100, 101, 102)}, map[string]interface{}{}, nil, DefaultLimits())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]interface{}{
+		"alias": []interface{}{int64(1), int64(2)},
+		"calls": int64(1),
+		"cells": []interface{}{int64(30)},
+		"keys":  []interface{}{"a", "b"},
+		"text":  "1, 2!!",
+		"tail":  102.0,
+	}
+	if !reflect.DeepEqual(result.State, want) {
+		t.Errorf("state %v, want %v", result.State, want)
+	}
+}
+
+func TestRunTimeLimit(t *testing.T) {
+	limits := Limits{Timeout: 50 * time.Millisecond, MaxSteps: 1 << 62, MaxHeap: 1 << 40}
+	started := time.Now()
+	_, err := run(t, "def algorithm(data, context):\n    while True:\n        pass\n", Input{}, nil, nil, limits)
+
+	var codeErr *Error
+	if !errors.As(err, &codeErr) || codeErr.Kind != ErrorKindLimit || codeErr.Msg != "time limit of 50ms exceeded" {
+		t.Fatalf("error %v, want the time limit", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("the run was cancelled after %s", elapsed)
+	}
+}
+
+func TestRunHeapLimit(t *testing.T) {
+	limits := Limits{Timeout: 5 * time.Second, MaxSteps: 1 << 62, MaxHeap: 1 << 20}
+	_, err := run(t, "def algorithm(data, context):\n    while True:\n        pass\n", Input{}, nil, nil, limits)
+
+	var codeErr *Error
+	if !errors.As(err, &codeErr) || codeErr.Kind != ErrorKindServer || !strings.HasPrefix(codeErr.Msg, "the server's heap passed 1 MB") {
+		t.Fatalf("error %v, want the server heap limit", err)
+	}
+}
+
+func TestWatchSharesOneSampler(t *testing.T) {
+	before := runtime.NumGoroutine()
+	limits := Limits{Timeout: time.Minute, MaxHeap: 1 << 40}
+
+	stops := make([]func(), 100)
+	for i := range stops {
+		stops[i] = watch(context.Background(), &starlark.Thread{}, limits)
+	}
+	if started := runtime.NumGoroutine() - before; started > 1 {
+		t.Errorf("watching %d runs started %d goroutines, want one sampler", len(stops), started)
+	}
+
+	for _, stop := range stops {
+		stop()
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(heapInterval) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running after every run stopped", runtime.NumGoroutine()-before)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{name: "syntax", code: "def algorithm(data, context):\n    return {\n", want: "syntax error at line 3"},
+		{name: "import", code: "import os\ndef algorithm(data, context):\n    pass\n", want: `syntax error at line 1: "import os" is not available: only the math module can be imported`},
+		{name: "undefined name", code: "def algorithm(data, context):\n    return helper()\n", want: "syntax error at line 2: undefined: helper"},
+		{name: "no algorithm", code: "def strategy(data, context):\n    pass\n", want: "syntax error: code must define algorithm(data, context)"},
+		{name: "too few parameters", code: "x = 1\ndef algorithm(data):\n    pass\n", want: "syntax error at line 2: algorithm must take (data, context)"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.code)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
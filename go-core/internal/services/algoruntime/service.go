@@ -0,0 +1,100 @@
+package algoruntime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// storedCandles is how many of the latest stored bars a run gets when no candles are passed in
+const storedCandles = 500
+
+// Service runs stored algorithms and records the outcome on the algorithm
+type Service struct {
+	db     *sql.DB
+	limits Limits
+}
+
+// NewService creates an algorithm runtime service with the default limits
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db, limits: DefaultLimits()}
+}
+
+// Evaluate runs an algorithm's code once against input with its config and persisted state
+// Without candles in input, the latest bars of the algorithm's symbol and timeframe are read
+// from the candle store.
+// Every run that gets as far as the code, failed or not, is recorded in the algorithm's run
+// log under source and published to its subscribers. On success the algorithm's LastRunAt,
+// LastSignal and State are updated; a run that fails leaves them untouched and returns an
+// *Error describing what went wrong in the code.
+func (s *Service) Evaluate(ctx context.Context, algo *data.Algorithm, source data.AlgorithmRunSource, input Input) (*Result, error) {
+	if input.Symbol == "" {
+		input.Symbol = algo.Symbol
+	}
+
+	program, err := Compile(algo.Code)
+	if err != nil {
+		s.recordFailure(NewRun(algo, source, input, algo.State, nil, err))
+		return nil, err
+	}
+
+	if len(input.Candles) == 0 {
+		input.Candles, err = repos.NewCandleRepository(s.db).GetLatestCandles(input.Symbol, algo.Timeframe, time.Time{}, storedCandles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load candles: %w", err)
+		}
+	}
+	result, err := program.Run(ctx, input, algo.State, algo.Config, s.limits)
+	if err != nil {
+		s.recordFailure(NewRun(algo, source, input, algo.State, result, err))
+		return nil, err
+	}
+
+	run := NewRun(algo, source, input, algo.State, result, nil)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := repos.NewAlgorithmRunRepository(s.db).WithTx(tx).CreateRun(run); err != nil {
+		return nil, err
+	}
+	if err := repos.NewAlgorithmRepository(s.db).WithTx(tx).RecordRun(algo.ID, algo.UserID, run.CreatedAt, result.Signal.Signal, result.State); err != nil {
+		return nil, fmt.Errorf("failed to record run: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	Publish(run)
+
+	algo.LastRunAt = &run.CreatedAt
+	algo.LastSignal = &result.Signal.Signal
+	algo.State = result.State
+
+	utils.LogInfo("Algorithm evaluated", map[string]interface{}{
+		"algorithm_id": algo.ID,
+		"signal":       result.Signal.Signal,
+		"steps":        result.Steps,
+		"duration_ms":  result.DurationMs,
+	})
+
+	return result, nil
+}
+
+// recordFailure records and publishes a failed run
+// The run's failure is what the caller reports, so failing to record it is only logged.
+func (s *Service) recordFailure(run *data.AlgorithmRun) {
+	if err := repos.NewAlgorithmRunRepository(s.db).CreateRun(run); err != nil {
+		utils.LogError(err, "Failed to record failed algorithm run", map[string]interface{}{
+			"algorithm_id": run.AlgorithmID,
+		})
+		return
+	}
+	Publish(run)
+}
@@ -0,0 +1,151 @@
+package algoruntime
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// Signals an algorithm can return
+const (
+	SignalBuy  = "BUY"
+	SignalSell = "SELL"
+	SignalHold = "HOLD"
+)
+
+// Signal is the validated dict an algorithm returns
+type Signal struct {
+	Signal   string   `json:"signal"` // BUY, SELL or HOLD
+	Quantity int      `json:"quantity,omitempty"`
+	Price    *float64 `json:"price,omitempty"`
+	StopLoss *float64 `json:"stop_loss,omitempty"`
+	Target   *float64 `json:"target,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// parseSignal validates the value returned by algorithm()
+// lastClose is the price stop losses and targets are checked against when the signal has none.
+func parseSignal(value starlark.Value, lastClose float64) (*Signal, error) {
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return nil, signalErrorf("algorithm must return a dict, got %s", value.Type())
+	}
+
+	signal := &Signal{}
+	var unknown []string
+	for _, entry := range dict.Items() {
+		key, ok := starlark.AsString(entry[0])
+		if !ok {
+			return nil, signalErrorf("keys must be strings, got %s", entry[0].Type())
+		}
+		field := entry[1]
+		if field == starlark.None && key != "signal" {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "signal":
+			s, ok := starlark.AsString(field)
+			if !ok {
+				return nil, signalErrorf("'signal' must be a string, got %s", field.Type())
+			}
+			signal.Signal = strings.ToUpper(strings.TrimSpace(s))
+		case "quantity":
+			signal.Quantity, err = parseQuantity(field)
+		case "price":
+			signal.Price, err = parsePrice(key, field)
+		case "stop_loss":
+			signal.StopLoss, err = parsePrice(key, field)
+		case "target":
+			signal.Target, err = parsePrice(key, field)
+		case "reason":
+			s, ok := starlark.AsString(field)
+			if !ok {
+				return nil, signalErrorf("'reason' must be a string, got %s", field.Type())
+			}
+			signal.Reason = s
+		default:
+			unknown = append(unknown, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, signalErrorf("unknown keys %s; expected signal, quantity, price, stop_loss, target and reason", strings.Join(unknown, ", "))
+	}
+
+	switch signal.Signal {
+	case SignalHold:
+		return signal, nil
+	case SignalBuy, SignalSell:
+	case "":
+		return nil, signalErrorf("'signal' is required")
+	default:
+		return nil, signalErrorf("'signal' must be BUY, SELL or HOLD, got %q", signal.Signal)
+	}
+
+	reference := lastClose
+	if signal.Price != nil {
+		reference = *signal.Price
+	}
+	if reference <= 0 {
+		return signal, nil
+	}
+	if signal.Signal == SignalBuy {
+		if signal.StopLoss != nil && *signal.StopLoss >= reference {
+			return nil, signalErrorf("BUY stop_loss %v must be below the entry price %v", *signal.StopLoss, reference)
+		}
+		if signal.Target != nil && *signal.Target <= reference {
+			return nil, signalErrorf("BUY target %v must be above the entry price %v", *signal.Target, reference)
+		}
+	} else {
+		if signal.StopLoss != nil && *signal.StopLoss <= reference {
+			return nil, signalErrorf("SELL stop_loss %v must be above the entry price %v", *signal.StopLoss, reference)
+		}
+		if signal.Target != nil && *signal.Target >= reference {
+			return nil, signalErrorf("SELL target %v must be below the entry price %v", *signal.Target, reference)
+		}
+	}
+
+	return signal, nil
+}
+
+// parseQuantity accepts a positive int, or a float with no fractional part
+func parseQuantity(value starlark.Value) (int, error) {
+	switch v := value.(type) {
+	case starlark.Int:
+		if q, ok := v.Int64(); ok && q > 0 && q <= math.MaxInt32 {
+			return int(q), nil
+		}
+	case starlark.Float:
+		if f := float64(v); f > 0 && f == math.Trunc(f) && f <= math.MaxInt32 {
+			return int(f), nil
+		}
+	default:
+		return 0, signalErrorf("'quantity' must be an int, got %s", value.Type())
+	}
+	return 0, signalErrorf("'quantity' must be a positive whole number, got %s", value.String())
+}
+
+// parsePrice accepts a positive, finite number
+func parsePrice(key string, value starlark.Value) (*float64, error) {
+	f, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, signalErrorf("'%s' must be a number, got %s", key, value.Type())
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) || f <= 0 {
+		return nil, signalErrorf("'%s' must be a positive number, got %s", key, value.String())
+	}
+	return &f, nil
+}
+
+func signalErrorf(format string, args ...interface{}) error {
+	return &Error{Kind: ErrorKindSignal, Msg: fmt.Sprintf(format, args...)}
+}
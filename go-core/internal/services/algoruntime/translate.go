@@ -0,0 +1,452 @@
+package algoruntime
+
+import (
+	"fmt"
+	"strings"
+)
+
+// translate rewrites the Python conveniences the web editor's template uses into Starlark:
+//
+//   - type annotations on def parameters and return types are dropped
+//   - f-strings become concatenations of _fstr(value, spec, conversion) calls
+//   - "x is None" and "x is not None" become == and !=; any other use of is is an error
+//   - "import math" and "from math import ..." bind the predeclared math module
+//
+// Everything else is passed through, so unsupported Python shows up as a Starlark syntax error
+// at the same line. Rewrites never add or remove newlines, keeping line numbers intact.
+func translate(src string) (string, error) {
+	t := &translator{src: src}
+	if err := t.run(); err != nil {
+		return "", err
+	}
+	return t.out.String(), nil
+}
+
+type translator struct {
+	src string
+	pos int
+	out strings.Builder
+}
+
+// line returns the 1-based line of a source offset
+func (t *translator) line(offset int) int {
+	return strings.Count(t.src[:offset], "\n") + 1
+}
+
+func (t *translator) errorf(offset int, format string, args ...interface{}) error {
+	return &Error{Kind: ErrorKindSyntax, Line: t.line(offset), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (t *translator) run() error {
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		switch {
+		case c == '#':
+			end := strings.IndexByte(t.src[t.pos:], '\n')
+			if end < 0 {
+				end = len(t.src) - t.pos
+			}
+			t.out.WriteString(t.src[t.pos : t.pos+end])
+			t.pos += end
+		case c == '\'' || c == '"':
+			if err := t.string(""); err != nil {
+				return err
+			}
+		case isIdentStart(c):
+			if err := t.word(); err != nil {
+				return err
+			}
+		case isDigit(c):
+			start := t.pos
+			for t.pos < len(t.src) && (isIdentPart(t.src[t.pos]) || t.src[t.pos] == '.') {
+				t.pos++
+			}
+			t.out.WriteString(t.src[start:t.pos])
+		default:
+			t.out.WriteByte(c)
+			t.pos++
+		}
+	}
+	return nil
+}
+
+// word handles an identifier or keyword, including string prefixes such as f and r
+func (t *translator) word() error {
+	start := t.pos
+	for t.pos < len(t.src) && isIdentPart(t.src[t.pos]) {
+		t.pos++
+	}
+	word := t.src[start:t.pos]
+
+	if t.pos < len(t.src) && (t.src[t.pos] == '\'' || t.src[t.pos] == '"') && isStringPrefix(word) {
+		// Starlark has no u prefix; its strings are already Unicode
+		return t.string(strings.ReplaceAll(strings.ToLower(word), "u", ""))
+	}
+
+	switch word {
+	case "def":
+		t.out.WriteString(word)
+		return t.defHeader()
+	case "is":
+		// Only comparisons with None have a Starlark equivalent: is tests identity, which
+		// Starlark lacks, and == would silently change what the comparison means for values
+		rest := t.skipBlanks(t.pos)
+		negated := t.keywordAt(rest, "not")
+		operand := rest
+		if negated {
+			operand = t.skipBlanks(rest + len("not"))
+		}
+		if !t.keywordAt(operand, "None") {
+			return t.errorf(start, "'is' only compares with None: use == or != to compare values")
+		}
+		if negated {
+			t.out.WriteString("!=")
+			t.out.WriteString(t.src[t.pos:rest])
+			t.out.WriteString("   ")
+			t.pos = rest + len("not")
+			return nil
+		}
+		t.out.WriteString("==")
+		return nil
+	case "import", "from":
+		if t.atStatementStart(start) {
+			return t.importStatement(start, word)
+		}
+	}
+	t.out.WriteString(word)
+	return nil
+}
+
+// skipBlanks returns the offset of the first character from offset that is not a space or tab
+func (t *translator) skipBlanks(offset int) int {
+	for offset < len(t.src) && (t.src[offset] == ' ' || t.src[offset] == '\t') {
+		offset++
+	}
+	return offset
+}
+
+// keywordAt reports whether the word at offset is keyword
+func (t *translator) keywordAt(offset int, keyword string) bool {
+	end := offset + len(keyword)
+	return strings.HasPrefix(t.src[offset:], keyword) && (end == len(t.src) || !isIdentPart(t.src[end]))
+}
+
+// atStatementStart reports whether only indentation precedes offset on its line
+func (t *translator) atStatementStart(offset int) bool {
+	lineStart := strings.LastIndexByte(t.src[:offset], '\n') + 1
+	return strings.TrimLeft(t.src[lineStart:offset], " \t") == ""
+}
+
+// importStatement rewrites imports of the math module, the only module algorithms can use
+func (t *translator) importStatement(start int, keyword string) error {
+	end := strings.IndexByte(t.src[t.pos:], '\n')
+	if end < 0 {
+		end = len(t.src) - t.pos
+	}
+	statement := strings.TrimSpace(t.src[start : t.pos+end])
+	if comment := strings.IndexByte(statement, '#'); comment >= 0 {
+		statement = strings.TrimSpace(statement[:comment])
+	}
+	fields := strings.Fields(strings.ReplaceAll(statement, ",", " , "))
+
+	switch {
+	case keyword == "import" && len(fields) == 2 && fields[1] == "math":
+		t.out.WriteString("pass")
+	case keyword == "from" && len(fields) >= 4 && fields[1] == "math" && fields[2] == "import":
+		var names []string
+		for _, name := range fields[3:] {
+			if name != "," {
+				names = append(names, name)
+			}
+		}
+		values := make([]string, len(names))
+		for i, name := range names {
+			values[i] = "math." + name
+		}
+		t.out.WriteString(strings.Join(names, ", ") + " = " + strings.Join(values, ", "))
+	default:
+		return t.errorf(start, "%q is not available: only the math module can be imported", statement)
+	}
+	t.pos += end
+	return nil
+}
+
+// defHeader copies a def statement's name and parameters without type annotations
+func (t *translator) defHeader() error {
+	open := strings.IndexByte(t.src[t.pos:], '(')
+	if open < 0 {
+		return nil
+	}
+	t.out.WriteString(t.src[t.pos : t.pos+open+1])
+	t.pos += open + 1
+
+	close, err := t.matching(t.pos, ')')
+	if err != nil {
+		return err
+	}
+	for i, param := range splitTopLevel(t.src[t.pos:close], ',') {
+		if i > 0 {
+			t.out.WriteByte(',')
+		}
+		t.out.WriteString(stripAnnotation(param))
+	}
+	t.out.WriteByte(')')
+	t.pos = close + 1
+
+	// A return annotation runs from -> to the colon ending the header
+	rest := t.skipBlanks(t.pos)
+	if strings.HasPrefix(t.src[rest:], "->") {
+		colon, err := t.matching(rest+2, ':')
+		if err != nil {
+			return err
+		}
+		t.out.WriteString(keepNewlines(t.src[t.pos:colon]))
+		t.pos = colon
+	}
+	return nil
+}
+
+// matching returns the offset of the first closing character at nesting depth zero from offset
+func (t *translator) matching(offset int, closing byte) (int, error) {
+	depth := 0
+	for i := offset; i < len(t.src); i++ {
+		switch c := t.src[i]; {
+		case c == '\'' || c == '"':
+			end, err := skipString(t.src, i)
+			if err != nil {
+				return 0, t.errorf(i, "%s", err)
+			}
+			i = end - 1
+		case c == closing && depth == 0:
+			return i, nil
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		}
+	}
+	return 0, t.errorf(offset, "expected %q", closing)
+}
+
+// string translates a string literal starting at t.pos; prefix is its lower-cased prefix
+func (t *translator) string(prefix string) error {
+	start := t.pos
+	end, err := skipString(t.src, start)
+	if err != nil {
+		return t.errorf(start, "%s", err)
+	}
+	t.pos = end
+
+	if !strings.Contains(prefix, "f") {
+		t.out.WriteString(prefix + t.src[start:end])
+		return nil
+	}
+
+	quote := t.src[start : start+1]
+	if strings.HasPrefix(t.src[start:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	body := t.src[start+len(quote) : end-len(quote)]
+	literal := strings.ReplaceAll(prefix, "f", "") + quote
+
+	parts, err := t.fstring(body, start+len(quote), literal, quote)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		parts = []string{literal + quote}
+	}
+	t.out.WriteString("(" + strings.Join(parts, " + ") + ")")
+	return nil
+}
+
+// fstring splits an f-string body into quoted literal parts and _fstr calls for its fields
+// offset is the body's position in the source, for error lines.
+func (t *translator) fstring(body string, offset int, open, close string) ([]string, error) {
+	var parts []string
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, open+text.String()+close)
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			text.WriteString(body[i : i+2])
+			i++
+		case c == '{' && i+1 < len(body) && body[i+1] == '{':
+			text.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(body) && body[i+1] == '}':
+			text.WriteByte('}')
+			i++
+		case c == '}':
+			return nil, t.errorf(offset+i, "single '}' is not allowed in an f-string")
+		case c == '{':
+			end, expr, conversion, spec, err := splitField(body, i+1)
+			if err != nil {
+				return nil, t.errorf(offset+i, "%s", err)
+			}
+			translated, err := translate(expr)
+			if err != nil {
+				return nil, t.errorf(offset+i, "%s", err.(*Error).Msg)
+			}
+			flush()
+			parts = append(parts, fmt.Sprintf("_fstr((%s), %q, %q)", translated, spec, conversion))
+			i = end
+		default:
+			text.WriteByte(c)
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// splitField parses an f-string replacement field starting after its '{'
+// It returns the offset of the closing '}', the expression, and the optional !conversion and :spec.
+func splitField(body string, start int) (end int, expr, conversion, spec string, err error) {
+	depth := 0
+	exprEnd := -1
+	for i := start; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' || c == '"':
+			stringEnd, err := skipString(body, i)
+			if err != nil {
+				return 0, "", "", "", err
+			}
+			i = stringEnd - 1
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case c == '}' && depth > 0:
+			depth--
+		case depth > 0:
+		case c == '!' && i+1 < len(body) && body[i+1] != '=' && exprEnd < 0:
+			exprEnd = i
+			j := i + 1
+			for j < len(body) && body[j] != ':' && body[j] != '}' {
+				j++
+			}
+			conversion = body[i+1 : j]
+			i = j - 1
+		case c == ':' && exprEnd < 0:
+			exprEnd = i
+			closing := strings.IndexByte(body[i:], '}')
+			if closing < 0 {
+				return 0, "", "", "", fmt.Errorf("unterminated f-string field")
+			}
+			spec = body[i+1 : i+closing]
+			if strings.ContainsRune(spec, '{') {
+				return 0, "", "", "", fmt.Errorf("nested fields in f-string format specs are not supported")
+			}
+			i += closing - 1
+		case c == ':':
+			closing := strings.IndexByte(body[i:], '}')
+			if closing < 0 {
+				return 0, "", "", "", fmt.Errorf("unterminated f-string field")
+			}
+			spec = body[i+1 : i+closing]
+			i += closing - 1
+		case c == '}':
+			if exprEnd < 0 {
+				exprEnd = i
+			}
+			expr = strings.TrimSpace(body[start:exprEnd])
+			if expr == "" {
+				return 0, "", "", "", fmt.Errorf("empty expression in f-string")
+			}
+			if conversion != "" && conversion != "r" && conversion != "s" && conversion != "a" {
+				return 0, "", "", "", fmt.Errorf("unknown f-string conversion !%s", conversion)
+			}
+			return i, expr, conversion, spec, nil
+		}
+	}
+	return 0, "", "", "", fmt.Errorf("unterminated f-string field")
+}
+
+// skipString returns the offset just past the string literal starting with a quote at start
+func skipString(src string, start int) (int, error) {
+	quote := src[start : start+1]
+	if strings.HasPrefix(src[start:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	for i := start + len(quote); i < len(src); i++ {
+		switch {
+		case src[i] == '\\':
+			i++
+		case src[i] == '\n' && len(quote) == 1:
+			return 0, fmt.Errorf("unterminated string literal")
+		case strings.HasPrefix(src[i:], quote):
+			return i + len(quote), nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal")
+}
+
+// splitTopLevel splits s at separators outside brackets and strings
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '"':
+			if end, err := skipString(s, i); err == nil {
+				i = end - 1
+			}
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// stripAnnotation removes the ": type" from a parameter, keeping any default value
+// An annotation is a top-level colon before the first top-level "=", so lambdas in defaults are kept.
+func stripAnnotation(param string) string {
+	head := param
+	if parts := splitTopLevel(param, '='); len(parts) > 1 {
+		head = parts[0]
+	}
+	pieces := splitTopLevel(head, ':')
+	if len(pieces) < 2 {
+		return param
+	}
+	colon := len(pieces[0])
+	return param[:colon] + keepNewlines(head[colon:]) + param[len(head):]
+}
+
+// keepNewlines replaces text with its newlines, so removed code does not shift later lines
+func keepNewlines(s string) string {
+	return strings.Repeat("\n", strings.Count(s, "\n"))
+}
+
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "r", "b", "u", "f", "rb", "br", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
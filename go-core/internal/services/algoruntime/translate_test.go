@@ -0,0 +1,127 @@
+package algoruntime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "annotations are dropped",
+			src:  "def f(x: int, y: float = 1.0) -> bool:\n    return x > y\n",
+			want: "def f(x, y= 1.0):\n    return x > y\n",
+		},
+		{
+			name: "multi-line headers keep their lines",
+			src:  "def algorithm(\n    data: dict,\n    context: dict,\n) -> dict:\n    pass",
+			want: "def algorithm(\n    data,\n    context,\n):\n    pass",
+		},
+		{
+			name: "defaults with colons are kept",
+			src:  "def f(key=lambda c: c['close'], opts={'a': 1}):",
+			want: "def f(key=lambda c: c['close'], opts={'a': 1}):",
+		},
+		{name: "plain f-string field", src: `f"{x}"`, want: `(_fstr((x), "", ""))`},
+		{name: "f-string text, spec and conversion", src: `f'p={price:.2f} {name!r}'`, want: `('p=' + _fstr((price), ".2f", "") + ' ' + _fstr((name), "", "r"))`},
+		{name: "doubled braces", src: `f"{{x}}"`, want: `("{x}")`},
+		{name: "empty f-string", src: `f""`, want: `("")`},
+		{name: "raw f-string keeps escapes", src: `rf"\d{n}"`, want: `(r"\d" + _fstr((n), "", ""))`},
+		{name: "fields are translated too", src: `f"{x is None}"`, want: `(_fstr((x == None), "", ""))`},
+		{name: "u prefix is dropped", src: `u"x" + b'y'`, want: `"x" + b'y'`},
+		{name: "is None", src: "if x is None:", want: "if x == None:"},
+		{name: "is not None keeps the width", src: "if x is not None:", want: "if x !=     None:"},
+		{name: "is inside words and strings is untouched", src: `this = isinstance + "a is b" # is it`, want: `this = isinstance + "a is b" # is it`},
+		{name: "import math", src: "import math\nx = math.sqrt(4)", want: "pass\nx = math.sqrt(4)"},
+		{name: "from math import", src: "  from math import sqrt, floor  # helpers\n", want: "  sqrt, floor = math.sqrt, math.floor\n"},
+		{name: "import as a name is not a statement", src: "x = data.import_count", want: "x = data.import_count"},
+	}
+	for _, tt := range tests {
+		got, err := translate(tt.src)
+		if err != nil {
+			t.Errorf("%s: translate error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: translate(%q)\n got %q\nwant %q", tt.name, tt.src, got, tt.want)
+		}
+		if strings.Count(got, "\n") != strings.Count(tt.src, "\n") {
+			t.Errorf("%s: translation changed the number of lines", tt.name)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantLine int
+		wantMsg  string
+	}{
+		{name: "is with a value", src: "x = 1\nif x is 5:", wantLine: 2, wantMsg: "'is' only compares with None"},
+		{name: "is not with a value", src: "if x is not y:", wantLine: 1, wantMsg: "'is' only compares with None"},
+		{name: "is with a name starting with None", src: "if x is Nonesuch:", wantLine: 1, wantMsg: "'is' only compares with None"},
+		{name: "trailing is", src: "x is", wantLine: 1, wantMsg: "'is' only compares with None"},
+		{name: "other modules", src: "\n\nimport os", wantLine: 3, wantMsg: "only the math module"},
+		{name: "math submodule", src: "import math.pi", wantLine: 1, wantMsg: "only the math module"},
+		{name: "empty f-string field", src: "x = 1\ny = f\"{}\"", wantLine: 2, wantMsg: "empty expression"},
+		{name: "single closing brace", src: `f"a}"`, wantLine: 1, wantMsg: "single '}'"},
+		{name: "unterminated field", src: `f"{x"`, wantLine: 1, wantMsg: "unterminated f-string field"},
+		{name: "unknown conversion", src: `f"{x!z}"`, wantLine: 1, wantMsg: "unknown f-string conversion"},
+		{name: "nested spec", src: `f"{x:{width}}"`, wantLine: 1, wantMsg: "nested fields"},
+		{name: "unterminated string", src: "x = 1\ny = 'abc\n", wantLine: 2, wantMsg: "unterminated string literal"},
+	}
+	for _, tt := range tests {
+		_, err := translate(tt.src)
+		var runtimeErr *Error
+		if !errors.As(err, &runtimeErr) {
+			t.Errorf("%s: translate(%q) error %v, want an *Error", tt.name, tt.src, err)
+			continue
+		}
+		if runtimeErr.Kind != ErrorKindSyntax || runtimeErr.Line != tt.wantLine || !strings.Contains(runtimeErr.Msg, tt.wantMsg) {
+			t.Errorf("%s: translate(%q) = %v, want a syntax error at line %d containing %q", tt.name, tt.src, err, tt.wantLine, tt.wantMsg)
+		}
+	}
+}
+
+// TestTranslatedFStrings evaluates translated f-strings against the values Python produces
+func TestTranslatedFStrings(t *testing.T) {
+	env := predeclared()
+	env["price"] = starlark.Float(1234.5)
+	env["qty"] = starlark.MakeInt(7)
+	env["name"] = starlark.String("INFY")
+	env["missing"] = starlark.None
+
+	tests := []struct {
+		src, want string
+	}{
+		{`f"{name} x{qty}"`, "INFY x7"},
+		{`f"{price:.2f}"`, "1234.50"},
+		{`f"{price:,.1f}"`, "1,234.5"},
+		{`f"{qty:03d}|{qty:>4}|{qty:<4}|{qty:^5}|"`, "007|   7|7   |  7  |"},
+		{`f"{qty / 28:.1%}"`, "25.0%"},
+		{`f"{name!r}"`, `"INFY"`},
+		{`f"{missing is None}"`, "True"},
+		{`f"{{literal}} {qty + 1}"`, "{literal} 8"},
+	}
+	for _, tt := range tests {
+		src, err := translate(tt.src)
+		if err != nil {
+			t.Errorf("translate(%q): %v", tt.src, err)
+			continue
+		}
+		value, err := starlark.EvalOptions(fileOptions, &starlark.Thread{}, "expr", src, env)
+		if err != nil {
+			t.Errorf("eval %q (from %q): %v", src, tt.src, err)
+			continue
+		}
+		if got, _ := starlark.AsString(value); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
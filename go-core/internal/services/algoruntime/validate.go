@@ -0,0 +1,234 @@
+package algoruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+
+	"go.starlark.net/syntax"
+)
+
+const (
+	// DefaultDryRunBars is how many synthetic bars a dry run uses unless asked otherwise
+	DefaultDryRunBars = 50
+	// MaxDryRunBars caps the synthetic bars of a dry run; every bar is one run of the code
+	MaxDryRunBars = 200
+	// dryRunCapital is the cash of the portfolio a dry run shows the code
+	dryRunCapital = 100000
+)
+
+// Severity is how serious a diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // the code cannot run as an algorithm
+	SeverityWarning Severity = "warning" // the code runs but likely not as intended
+)
+
+// Diagnostic is a problem found in algorithm code
+type Diagnostic struct {
+	Severity Severity  `json:"severity"`
+	Kind     ErrorKind `json:"kind"`
+	Line     int       `json:"line,omitempty"`
+	Message  string    `json:"message"`
+	Bar      *int      `json:"bar,omitempty"` // the dry run bar the code failed on
+}
+
+// Sample is the signal the code returned on one dry run bar
+type Sample struct {
+	Bar       int       `json:"bar"` // index into the synthetic bars, oldest first
+	Timestamp time.Time `json:"timestamp"`
+	Close     float64   `json:"close"`
+	Signal    *Signal   `json:"signal"`
+}
+
+// Validation is the outcome of checking and dry-running algorithm code
+type Validation struct {
+	Valid       bool                   `json:"valid"` // no error diagnostics
+	Diagnostics []Diagnostic           `json:"diagnostics"`
+	Samples     []Sample               `json:"samples"`
+	Signals     map[string]int         `json:"signals"`         // samples per signal
+	State       map[string]interface{} `json:"state,omitempty"` // state after the last bar
+	Logs        []string               `json:"logs,omitempty"`  // print() output, prefixed with the bar
+	Steps       uint64                 `json:"steps"`
+	DurationMs  int64                  `json:"duration_ms"`
+}
+
+// Validate compiles code, checks it for constructs that fail or misbehave when run, and
+// dry-runs it over bars synthetic candles of symbol, one run per bar with the bars up to it,
+// config and state carried from bar to bar, as in a backtest
+// The dry run stops at the first bar the code fails on. Nothing is stored.
+func Validate(ctx context.Context, code string, config map[string]interface{}, symbol string, bars int, limits Limits) *Validation {
+	started := time.Now()
+	validation := &Validation{
+		Diagnostics: []Diagnostic{},
+		Samples:     []Sample{},
+		Signals:     map[string]int{},
+	}
+	defer func() {
+		validation.Valid = true
+		for _, diagnostic := range validation.Diagnostics {
+			if diagnostic.Severity == SeverityError {
+				validation.Valid = false
+			}
+		}
+		validation.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	program, file, err := compile(code)
+	if err != nil {
+		validation.Diagnostics = append(validation.Diagnostics, diagnose(err, nil))
+		return validation
+	}
+	validation.Diagnostics = append(validation.Diagnostics, lint(file)...)
+	if len(validation.Diagnostics) > 0 && validation.Diagnostics[0].Severity == SeverityError {
+		return validation
+	}
+
+	synthetic := SyntheticCandles(symbol, bars)
+	series := NewBars(synthetic)
+	state := map[string]interface{}{}
+	for i, candle := range synthetic {
+		input := series.Input(0, i+1)
+		input.Symbol = symbol
+		input.Portfolio = Portfolio{Cash: dryRunCapital, Positions: map[string]Position{}, TotalValue: dryRunCapital}
+
+		result, err := program.Run(ctx, input, state, config, limits)
+		if result != nil {
+			validation.Steps += result.Steps
+			for _, line := range result.Logs {
+				if len(validation.Logs) < maxLogLines {
+					validation.Logs = append(validation.Logs, fmt.Sprintf("[bar %d] %s", i, line))
+				}
+			}
+		}
+		if err != nil {
+			bar := i
+			validation.Diagnostics = append(validation.Diagnostics, diagnose(err, &bar))
+			break
+		}
+
+		state = result.State
+		validation.Samples = append(validation.Samples, Sample{Bar: i, Timestamp: candle.Timestamp, Close: candle.Close, Signal: result.Signal})
+		validation.Signals[result.Signal.Signal]++
+	}
+	validation.State = state
+
+	return validation
+}
+
+// diagnose turns a compile or run failure into an error diagnostic
+func diagnose(err error, bar *int) Diagnostic {
+	var codeErr *Error
+	if errors.As(err, &codeErr) {
+		return Diagnostic{Severity: SeverityError, Kind: codeErr.Kind, Line: codeErr.Line, Message: codeErr.Msg, Bar: bar}
+	}
+	return Diagnostic{Severity: SeverityError, Kind: ErrorKindRuntime, Message: err.Error(), Bar: bar}
+}
+
+// lint checks compiled code for what the compiler accepts but running as an algorithm does not:
+// load statements, an algorithm() that needs more than (data, context) or never returns a
+// signal, a second algorithm() replacing the first, and top-level code, which reruns on every
+// evaluation. Errors come first.
+func lint(file *syntax.File) []Diagnostic {
+	var errs, warnings []Diagnostic
+	lintError := func(pos syntax.Position, format string, args ...interface{}) {
+		errs = append(errs, Diagnostic{Severity: SeverityError, Kind: ErrorKindLint, Line: int(pos.Line), Message: fmt.Sprintf(format, args...)})
+	}
+	lintWarning := func(pos syntax.Position, format string, args ...interface{}) {
+		warnings = append(warnings, Diagnostic{Severity: SeverityWarning, Kind: ErrorKindLint, Line: int(pos.Line), Message: fmt.Sprintf(format, args...)})
+	}
+
+	var algorithm *syntax.DefStmt
+	for _, stmt := range file.Stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.LoadStmt:
+			lintError(stmt.Load, "load is not available: algorithms cannot load modules")
+		case *syntax.DefStmt:
+			if stmt.Name.Name != "algorithm" {
+				continue
+			}
+			if algorithm != nil {
+				lintWarning(stmt.Def, "algorithm is defined again; this definition replaces the one at line %d", algorithm.Def.Line)
+			}
+			algorithm = stmt
+		case *syntax.ForStmt:
+			lintWarning(stmt.For, "top-level loop runs on every evaluation; move it into a function")
+		case *syntax.WhileStmt:
+			lintWarning(stmt.While, "top-level loop runs on every evaluation; move it into a function")
+		case *syntax.IfStmt:
+			lintWarning(stmt.If, "top-level if runs on every evaluation; move it into a function")
+		case *syntax.ExprStmt:
+			if _, docstring := stmt.X.(*syntax.Literal); !docstring {
+				start, _ := stmt.Span()
+				lintWarning(start, "top-level expression runs on every evaluation; move it into a function")
+			}
+		}
+	}
+	if algorithm == nil {
+		return append(errs, warnings...)
+	}
+
+	required := 0
+	for _, param := range algorithm.Params {
+		if _, ok := param.(*syntax.Ident); ok {
+			required++
+		}
+	}
+	if required > 2 {
+		lintError(algorithm.Def, "algorithm is called with (data, context) but requires %d parameters; give the others defaults", required)
+	}
+
+	returns := false
+	for _, stmt := range algorithm.Body {
+		syntax.Walk(stmt, func(node syntax.Node) bool {
+			switch node := node.(type) {
+			case *syntax.DefStmt, *syntax.LambdaExpr:
+				return false // returns of nested functions do not return a signal
+			case *syntax.ReturnStmt:
+				if node.Result != nil {
+					returns = true
+				}
+			}
+			return true
+		})
+	}
+	if !returns {
+		lintError(algorithm.Def, "algorithm never returns a signal; return a dict such as {'signal': 'HOLD'}")
+	}
+
+	return append(errs, warnings...)
+}
+
+// SyntheticCandles returns n one-minute bars of symbol from a market open in IST, oldest first
+// Prices follow a gentle uptrend with a few swings, so crossovers and thresholds in typical
+// code have something to trigger on; the same n always gives the same bars. n is clamped to
+// [1, MaxDryRunBars].
+func SyntheticCandles(symbol string, n int) []*data.Candle {
+	n = min(max(n, 1), MaxDryRunBars)
+	start := time.Date(2024, 1, 1, 9, 15, 0, 0, utils.IST).UTC()
+
+	bars := make([]*data.Candle, n)
+	previous := 100.0
+	for i := range bars {
+		price := 100 + 0.05*float64(i) + 3*math.Sin(float64(i)/6) + 0.8*math.Sin(float64(i)*1.7)
+		price = math.Round(price*100) / 100
+		bars[i] = &data.Candle{
+			Symbol:    symbol,
+			Timeframe: data.Timeframe1m,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open:      previous,
+			High:      math.Round((math.Max(previous, price)+0.25)*100) / 100,
+			Low:       math.Round((math.Min(previous, price)-0.25)*100) / 100,
+			Close:     price,
+			Volume:    int64(1000 + 150*(i%7)),
+		}
+		previous = price
+	}
+	return bars
+}
@@ -0,0 +1,125 @@
+package algoruntime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func validate(code string, bars int) *Validation {
+	return Validate(context.Background(), code, nil, "INFY", bars, DefaultLimits())
+}
+
+func TestValidateDryRuns(t *testing.T) {
+	const code = `def algorithm(data, context):
+    state = context['state']
+    state['bars'] = len(data)
+    if data[-1]['close'] > data[0]['close']:
+        return {'signal': 'BUY', 'quantity': 1}
+    return {'signal': 'HOLD'}
+`
+	got := validate(code, 30)
+	if !got.Valid || len(got.Diagnostics) != 0 || len(got.Samples) != 30 || got.Signals["BUY"]+got.Signals["HOLD"] != 30 {
+		t.Fatalf("validation %+v, want a signal for each of 30 bars", got)
+	}
+	if got.Samples[0].Signal.Signal != SignalHold || got.Samples[29].Bar != 29 || got.State["bars"] != int64(30) {
+		t.Fatalf("samples %+v and state %v", got.Samples, got.State)
+	}
+	if again := validate(code, 30); !reflect.DeepEqual(again.Signals, got.Signals) {
+		t.Fatalf("dry runs differ: %v then %v", got.Signals, again.Signals)
+	}
+}
+
+func TestValidateDiagnoses(t *testing.T) {
+	bar := func(i int) *int { return &i }
+	tests := []struct {
+		name    string
+		code    string
+		want    []Diagnostic
+		samples int
+	}{
+		{
+			name: "syntax errors stop before the dry run",
+			code: "def algorithm(data, context):\n    x = (\n    return {'signal': 'HOLD'}\n",
+			want: []Diagnostic{{Severity: SeverityError, Kind: ErrorKindSyntax, Line: 3, Message: "got return, want primary expression"}},
+		},
+		{
+			name: "lint errors come before warnings",
+			code: "for i in range(3):\n    pass\n\ndef algorithm(data, context, extra):\n    print('no signal')\n",
+			want: []Diagnostic{
+				{Severity: SeverityError, Kind: ErrorKindLint, Line: 4, Message: "algorithm is called with (data, context) but requires 3 parameters; give the others defaults"},
+				{Severity: SeverityError, Kind: ErrorKindLint, Line: 4, Message: "algorithm never returns a signal; return a dict such as {'signal': 'HOLD'}"},
+				{Severity: SeverityWarning, Kind: ErrorKindLint, Line: 1, Message: "top-level loop runs on every evaluation; move it into a function"},
+			},
+		},
+		{
+			name: "nested returns do not count",
+			code: "def algorithm(data, context):\n    def helper():\n        return {'signal': 'HOLD'}\n    helper()\n",
+			want: []Diagnostic{{Severity: SeverityError, Kind: ErrorKindLint, Line: 1, Message: "algorithm never returns a signal; return a dict such as {'signal': 'HOLD'}"}},
+		},
+		{
+			name: "warnings still dry run",
+			code: "'''docstring'''\nif True:\n    pass\ndef algorithm(data, context):\n    return {'signal': 'HOLD'}\ndef algorithm(data, context=None):\n    return {'signal': 'HOLD'}\n",
+			want: []Diagnostic{
+				{Severity: SeverityWarning, Kind: ErrorKindLint, Line: 2, Message: "top-level if runs on every evaluation; move it into a function"},
+				{Severity: SeverityWarning, Kind: ErrorKindLint, Line: 6, Message: "algorithm is defined again; this definition replaces the one at line 4"},
+			},
+			samples: 5,
+		},
+		{
+			name:    "a failing bar ends the dry run",
+			code:    "def algorithm(data, context):\n    if len(data) == 3:\n        fail('boom')\n    return {'signal': 'HOLD'}\n",
+			want:    []Diagnostic{{Severity: SeverityError, Kind: ErrorKindRuntime, Line: 3, Message: "fail: boom", Bar: bar(2)}},
+			samples: 2,
+		},
+	}
+	for _, tt := range tests {
+		got := validate(tt.code, 5)
+		if !reflect.DeepEqual(got.Diagnostics, tt.want) {
+			t.Errorf("%s: diagnostics\n got %+v\nwant %+v", tt.name, got.Diagnostics, tt.want)
+		}
+		if len(got.Samples) != tt.samples {
+			t.Errorf("%s: %d samples, want %d", tt.name, len(got.Samples), tt.samples)
+		}
+		if valid := tt.want[0].Severity == SeverityWarning; got.Valid != valid {
+			t.Errorf("%s: valid %v, want %v", tt.name, got.Valid, valid)
+		}
+	}
+}
+
+func TestValidateKeepsLogsUpToTheFailure(t *testing.T) {
+	const code = `def algorithm(data, context):
+    print('bar', len(data))
+    if len(data) == 3:
+        fail('boom')
+    return {'signal': 'HOLD'}
+`
+	got := validate(code, 10)
+	if want := []string{"[bar 0] bar 1", "[bar 1] bar 2", "[bar 2] bar 3"}; !reflect.DeepEqual(got.Logs, want) {
+		t.Fatalf("logs %q, want %q", got.Logs, want)
+	}
+	if got.Steps == 0 || got.State == nil {
+		t.Fatalf("validation %+v, want the steps and state of the bars that ran", got)
+	}
+}
+
+func TestSyntheticCandles(t *testing.T) {
+	got := SyntheticCandles("INFY", 1000)
+	if len(got) != MaxDryRunBars {
+		t.Fatalf("%d bars, want the cap of %d", len(got), MaxDryRunBars)
+	}
+	if len(SyntheticCandles("INFY", 0)) != 1 {
+		t.Fatalf("no bars asked for, want one")
+	}
+	if again := SyntheticCandles("INFY", 1000); !reflect.DeepEqual(again, got) {
+		t.Fatalf("synthetic candles are not deterministic")
+	}
+	for i, candle := range got {
+		if candle.Symbol != "INFY" || candle.Low > candle.Open || candle.Low > candle.Close || candle.High < candle.Open || candle.High < candle.Close {
+			t.Fatalf("bar %d is not a valid candle: %+v", i, candle)
+		}
+		if i > 0 && candle.Timestamp.Sub(got[i-1].Timestamp).Minutes() != 1 {
+			t.Fatalf("bar %d is not a minute after the one before", i)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package algoruntime
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.starlark.net/starlark"
+)
+
+// maxDepth bounds how deeply nested values passed out of algorithm code may be, which also
+// stops lists that contain themselves
+const maxDepth = 64
+
+// toStarlark converts a JSON-shaped Go value into a Starlark value
+// Whole floats become ints, since JSON round trips turn every number in persisted state into a float.
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			converted, err := toStarlark(v[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// fromStarlark converts a Starlark value into its JSON-shaped Go equivalent
+// Only None, bools, numbers, strings, lists, tuples and dicts with string keys can be converted.
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	return fromStarlarkDepth(value, 0)
+}
+
+func fromStarlarkDepth(value starlark.Value, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("value is nested more than %d levels deep", maxDepth)
+	}
+
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		f, _ := starlark.AsFloat(v)
+		return f, nil
+	case starlark.Float:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%v cannot be stored", v)
+		}
+		return f, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Indexable:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := fromStarlarkDepth(v.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, entry := range v.Items() {
+			key, ok := entry[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", entry[0].Type())
+			}
+			item, err := fromStarlarkDepth(entry[1], depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", string(key), err)
+			}
+			result[string(key)] = item
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("values of type %s cannot be stored", value.Type())
+}
@@ -0,0 +1,312 @@
+// Package algoscheduler runs enabled live algorithms as the bars of their timeframes close,
+// following the exchange session and holidays of the candle store's calendar.
+package algoscheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/candles"
+	"go-core/internal/services/papertrade"
+	"go-core/internal/utils"
+)
+
+const (
+	// defaultWorkers is how many algorithms run at once unless ALGORITHM_SCHEDULER_WORKERS says otherwise
+	defaultWorkers = 4
+	// settleDelay is how long after a bar closes its algorithms run, giving the bar time to be stored
+	settleDelay = 2 * time.Second
+	// idleWait is how long the scheduler sleeps when the calendar has no bar close ahead
+	idleWait = time.Hour
+)
+
+// Scheduler runs every enabled algorithm with status live once per bar close of its timeframe
+// Paper trading algorithms advance their paper accounts over the bars stored since their last
+// run; live trading algorithms are evaluated against the latest stored bars and their signal
+// and state recorded, without placing orders. Each algorithm runs in its own goroutine, at most
+// one run per algorithm at a time, and a panic or error in one run does not affect the others.
+// A bar close is claimed in the database before its run starts, so a restart never runs an
+// algorithm twice for the same bar; bars that closed while the server was down are caught up
+// with a single run for the latest of them. Algorithms only run once a bar newer than their
+// last run is stored, so holidays missing from the calendar pass without runs, and a live
+// trading run whose latest stored bar is not the one that just closed is recorded as stale
+// rather than evaluated.
+type Scheduler struct {
+	db      *sql.DB
+	slots   chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	loop    sync.WaitGroup
+	runs    sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]bool // algorithm IDs with a run in progress
+
+	evaluate func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error
+}
+
+// NewScheduler creates an algorithm scheduler; call Start to begin running algorithms
+// ALGORITHM_SCHEDULER_WORKERS caps the algorithms running at once, default 4.
+func NewScheduler(db *sql.DB) *Scheduler {
+	workers := defaultWorkers
+	if value := os.Getenv("ALGORITHM_SCHEDULER_WORKERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			workers = n
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		db:      db,
+		slots:   make(chan struct{}, workers),
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]bool),
+	}
+	s.evaluate = s.evaluateByMode
+	return s
+}
+
+// Start fails runs interrupted by a previous shutdown and starts scheduling
+func (s *Scheduler) Start() {
+	interrupted, err := repos.NewAlgorithmScheduleRepository(s.db).FailInterruptedRuns("interrupted by a server restart", time.Now())
+	if err != nil {
+		utils.LogError(err, "Failed to fail interrupted algorithm runs")
+	} else if interrupted > 0 {
+		utils.LogInfo("Marked interrupted algorithm runs as failed", map[string]interface{}{
+			"count": interrupted,
+		})
+	}
+
+	s.loop.Add(1)
+	go s.schedule()
+}
+
+// Stop cancels runs in progress and waits for them and the scheduler to stop
+// Interrupted runs are recorded as failed and are not run again for the same bar.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.loop.Wait()
+	s.runs.Wait()
+}
+
+// Wait blocks until the runs in progress have finished
+func (s *Scheduler) Wait() {
+	s.runs.Wait()
+}
+
+// schedule runs due algorithms after every bar close until stopped
+// One-minute bars close every minute of the session, so waking after each of them catches
+// the closes of every timeframe.
+func (s *Scheduler) schedule() {
+	defer s.loop.Done()
+
+	for {
+		s.RunDue(time.Now())
+
+		wait := idleWait
+		if next, ok := candles.NextClose(data.Timeframe1m, time.Now()); ok {
+			wait = time.Until(next) + settleDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RunDue starts a run of every scheduled algorithm whose latest bar close at or before at has
+// not been run yet, and returns how many it started without waiting for them
+// Algorithms still running from an earlier bar close are skipped until they finish.
+func (s *Scheduler) RunDue(at time.Time) int {
+	if s.ctx.Err() != nil {
+		return 0
+	}
+
+	algorithms, err := repos.NewAlgorithmRepository(s.db).GetScheduledAlgorithms()
+	if err != nil {
+		utils.LogError(err, "Failed to get scheduled algorithms")
+		return 0
+	}
+
+	// Every due bar close is claimed before any run starts, so the claims never contend with
+	// the write transactions of runs already under way
+	type due struct {
+		algo             *data.Algorithm
+		barClose, latest time.Time
+	}
+	var claimed []due
+	scheduleRepo := repos.NewAlgorithmScheduleRepository(s.db)
+	for _, algo := range algorithms {
+		barClose, ok := candles.LastClose(algo.Timeframe, at)
+		if !ok {
+			continue
+		}
+		latest, ok := s.newBar(algo, barClose)
+		if !ok || !s.reserve(algo.ID) {
+			continue
+		}
+
+		ok, err := scheduleRepo.ClaimBarClose(algo.ID, barClose, time.Now())
+		if err != nil || !ok {
+			s.release(algo.ID)
+			continue
+		}
+		claimed = append(claimed, due{algo, barClose, latest})
+	}
+
+	for _, d := range claimed {
+		s.runs.Add(1)
+		go s.run(d.algo, d.barClose, d.latest)
+	}
+	return len(claimed)
+}
+
+// newBar returns when the latest stored bar of an algorithm closed, counting only bars that
+// closed by barClose, and reports whether that bar is newer than the algorithm's last run
+// A calendar close with no new bar behind it, as on an exchange holiday the calendar does not
+// know about, is not run.
+func (s *Scheduler) newBar(algo *data.Algorithm, barClose time.Time) (time.Time, bool) {
+	bars, err := repos.NewCandleRepository(s.db).GetLatestCandles(algo.Symbol, algo.Timeframe, barClose, 1)
+	if err != nil || len(bars) == 0 {
+		return time.Time{}, false
+	}
+	latest, ok := candles.NextClose(algo.Timeframe, bars[0].Timestamp)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	last, err := repos.NewAlgorithmScheduleRepository(s.db).GetSchedule(algo.ID)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return latest, last == nil || latest.After(last.BarClose)
+}
+
+// reserve marks an algorithm as running, unless it already is
+func (s *Scheduler) reserve(algorithmID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running[algorithmID] {
+		return false
+	}
+	s.running[algorithmID] = true
+	return true
+}
+
+// release marks an algorithm as no longer running
+func (s *Scheduler) release(algorithmID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, algorithmID)
+}
+
+// run runs an algorithm for a claimed bar close and records the outcome
+// latest is when the latest stored bar closed; live trading algorithms only act on the bar of barClose.
+func (s *Scheduler) run(algo *data.Algorithm, barClose, latest time.Time) {
+	defer s.runs.Done()
+	defer s.release(algo.ID)
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-s.ctx.Done():
+	}
+
+	started := time.Now()
+	schedule := &data.AlgorithmSchedule{
+		AlgorithmID: algo.ID,
+		BarClose:    barClose,
+		Status:      data.AlgorithmScheduleStatusSucceeded,
+		StartedAt:   started,
+	}
+
+	err := s.ctx.Err()
+	if err == nil && algo.ExecutionMode != data.ExecutionModePaperTrading && !latest.Equal(barClose) {
+		err = fmt.Errorf("stale bars: the latest stored bar closed at %s, not at %s",
+			latest.In(utils.IST).Format(time.DateTime), barClose.In(utils.IST).Format(time.DateTime))
+	}
+	if err == nil {
+		err = s.execute(algo, schedule)
+	}
+
+	finishedAt := time.Now()
+	duration := finishedAt.Sub(started).Milliseconds()
+	schedule.FinishedAt = &finishedAt
+	schedule.DurationMs = &duration
+	if err != nil {
+		message := err.Error()
+		if s.ctx.Err() != nil {
+			message = "interrupted by a server shutdown"
+		}
+		schedule.Status = data.AlgorithmScheduleStatusFailed
+		schedule.Error = &message
+		utils.LogWarn("Scheduled algorithm run failed", map[string]interface{}{
+			"algorithm_id": algo.ID,
+			"bar_close":    barClose,
+			"error":        message,
+		})
+	} else {
+		utils.LogInfo("Scheduled algorithm run completed", map[string]interface{}{
+			"algorithm_id": algo.ID,
+			"bar_close":    barClose,
+			"bars":         schedule.Bars,
+			"duration_ms":  duration,
+		})
+	}
+
+	if err := repos.NewAlgorithmScheduleRepository(s.db).FinishRun(schedule); err != nil {
+		utils.LogError(err, "Failed to record scheduled algorithm run outcome", map[string]interface{}{
+			"algorithm_id": algo.ID,
+		})
+	}
+}
+
+// execute runs an algorithm, turning a panic into an error
+func (s *Scheduler) execute(algo *data.Algorithm, schedule *data.AlgorithmSchedule) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	return s.evaluate(algo, schedule)
+}
+
+// evaluateByMode runs an algorithm by its execution mode
+func (s *Scheduler) evaluateByMode(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+	if algo.ExecutionMode == data.ExecutionModePaperTrading {
+		result, err := papertrade.NewService(s.db).Advance(s.ctx, algo)
+		if err != nil {
+			return err
+		}
+		schedule.Bars = result.Bars
+		if result.Signal != nil {
+			schedule.Signal = &result.Signal.Signal
+		}
+		if result.Error != nil {
+			return errors.New(*result.Error)
+		}
+		return nil
+	}
+
+	result, err := algoruntime.NewService(s.db).Evaluate(s.ctx, algo, data.AlgorithmRunSourceScheduled, algoruntime.Input{})
+	if err != nil {
+		return err
+	}
+	schedule.Signal = &result.Signal.Signal
+	return nil
+}
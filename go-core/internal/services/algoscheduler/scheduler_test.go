@@ -0,0 +1,330 @@
+package algoscheduler
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// at is a fixed time in a Monday session, thirty seconds after a one-minute bar closed at barClose
+var (
+	at       = time.Date(2024, time.March, 4, 10, 0, 30, 0, utils.IST)
+	barClose = time.Date(2024, time.March, 4, 4, 30, 0, 0, time.UTC)
+)
+
+// newScheduler opens a fresh database with n enabled live one-minute algorithms on INFY and the
+// bar closing at barClose, and returns a scheduler over it that runs them with evaluate
+func newScheduler(t *testing.T, n int, evaluate func(*data.Algorithm, *data.AlgorithmSchedule) error) (*Scheduler, []*data.Algorithm) {
+	t.Helper()
+	conn := testutil.NewDB(t).GetConnection()
+
+	now := time.Now().UTC()
+	user := &data.User{Name: "trader", Email: "trader@example.com", CreatedAt: now}
+	if err := repos.NewUserRepository(conn, nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	algorithms := make([]*data.Algorithm, n)
+	for i := range algorithms {
+		algorithms[i] = &data.Algorithm{
+			ID: utils.GenerateID(), UserID: user.ID, Name: "Momentum", Code: "def algorithm(data, context):\n    pass\n",
+			Status: data.AlgorithmStatusLive, Enabled: true, Symbol: "INFY", Timeframe: data.Timeframe1m,
+			ExecutionMode: data.ExecutionModeLiveTrading, Version: 1,
+			CreatedAt: now.Add(time.Duration(i) * time.Second), UpdatedAt: now,
+		}
+		if err := repos.NewAlgorithmRepository(conn).CreateAlgorithm(algorithms[i]); err != nil {
+			t.Fatalf("create algorithm: %v", err)
+		}
+	}
+
+	s := restart(conn, evaluate)
+	storeBar(t, s, barClose)
+	return s, algorithms
+}
+
+// storeBar stores the one-minute INFY bar closing at close
+func storeBar(t *testing.T, s *Scheduler, close time.Time) {
+	t.Helper()
+	if err := repos.NewCandleRepository(s.db).UpsertCandle(&data.Candle{
+		Symbol: "INFY", Timeframe: data.Timeframe1m, Timestamp: close.Add(-time.Minute),
+		Open: 1500, High: 1505, Low: 1495, Close: 1502, Volume: 100,
+	}); err != nil {
+		t.Fatalf("store bar: %v", err)
+	}
+}
+
+// restart returns a new scheduler over conn, as after a server restart
+func restart(conn *sql.DB, evaluate func(*data.Algorithm, *data.AlgorithmSchedule) error) *Scheduler {
+	s := NewScheduler(conn)
+	s.evaluate = evaluate
+	return s
+}
+
+func schedule(t *testing.T, s *Scheduler, algorithmID string) *data.AlgorithmSchedule {
+	t.Helper()
+	schedule, err := repos.NewAlgorithmScheduleRepository(s.db).GetSchedule(algorithmID)
+	if err != nil {
+		t.Fatalf("get schedule: %v", err)
+	}
+	return schedule
+}
+
+func hold(_ *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+	signal := "HOLD"
+	schedule.Signal = &signal
+	return nil
+}
+
+func TestClaimBarClose(t *testing.T) {
+	s, algorithms := newScheduler(t, 1, hold)
+	repo := repos.NewAlgorithmScheduleRepository(s.db)
+	id := algorithms[0].ID
+
+	claim := func(bar time.Time) bool {
+		t.Helper()
+		claimed, err := repo.ClaimBarClose(id, bar, at)
+		if err != nil {
+			t.Fatalf("ClaimBarClose: %v", err)
+		}
+		return claimed
+	}
+
+	if !claim(barClose) {
+		t.Fatal("first claim of a bar close was refused")
+	}
+	signal, errMessage, finished, duration := "BUY", "boom", at.Add(time.Second), int64(1000)
+	if err := repo.FinishRun(&data.AlgorithmSchedule{
+		AlgorithmID: id, BarClose: barClose, Status: data.AlgorithmScheduleStatusFailed,
+		Signal: &signal, Bars: 3, Error: &errMessage, FinishedAt: &finished, DurationMs: &duration,
+	}); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	if claim(barClose) {
+		t.Error("the same bar close was claimed twice")
+	}
+	if claim(barClose.Add(-time.Minute)) {
+		t.Error("an earlier bar close was claimed after a later one")
+	}
+	if got := schedule(t, s, id); !got.BarClose.Equal(barClose) || got.Status != data.AlgorithmScheduleStatusFailed || got.Bars != 3 {
+		t.Errorf("refused claims changed the schedule to %+v", got)
+	}
+
+	next := barClose.Add(time.Minute)
+	if !claim(next) {
+		t.Fatal("the next bar close was refused")
+	}
+	got := schedule(t, s, id)
+	if !got.BarClose.Equal(next) || got.Status != data.AlgorithmScheduleStatusRunning {
+		t.Errorf("claimed schedule is %s for %s, want running for %s", got.Status, got.BarClose, next)
+	}
+	if got.Signal != nil || got.Bars != 0 || got.Error != nil || got.FinishedAt != nil || got.DurationMs != nil {
+		t.Errorf("claim kept the previous run's outcome: %+v", got)
+	}
+}
+
+func TestRunDueRunsEachBarCloseOnce(t *testing.T) {
+	var mu sync.Mutex
+	var runs []string
+	evaluate := func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+		mu.Lock()
+		runs = append(runs, algo.ID)
+		mu.Unlock()
+		return hold(algo, schedule)
+	}
+	s, algorithms := newScheduler(t, 2, evaluate)
+
+	if started := s.RunDue(at); started != 2 {
+		t.Fatalf("RunDue started %d runs, want 2", started)
+	}
+	s.Wait()
+	for _, algo := range algorithms {
+		got := schedule(t, s, algo.ID)
+		if !got.BarClose.Equal(barClose) || got.Status != data.AlgorithmScheduleStatusSucceeded || got.Signal == nil || *got.Signal != "HOLD" {
+			t.Errorf("schedule of %s is %+v, want a succeeded HOLD for %s", algo.ID, got, barClose)
+		}
+	}
+
+	if started := s.RunDue(at.Add(20 * time.Second)); started != 0 {
+		t.Errorf("RunDue started %d runs for the same bar close, want none", started)
+	}
+
+	// After a restart the claimed bar close is skipped and the next one runs
+	storeBar(t, s, barClose.Add(time.Minute))
+	restarted := restart(s.db, evaluate)
+	if started := restarted.RunDue(at); started != 0 {
+		t.Errorf("RunDue after a restart started %d runs for a bar close already run, want none", started)
+	}
+	if started := restarted.RunDue(at.Add(time.Minute)); started != 2 {
+		t.Errorf("RunDue after a restart started %d runs for the next bar close, want 2", started)
+	}
+	restarted.Wait()
+
+	if len(runs) != 4 {
+		t.Errorf("algorithms ran %d times, want twice each", len(runs))
+	}
+}
+
+func TestRunDueSkipsRunningAlgorithms(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	var mu sync.Mutex
+	active, mostActive := 0, 0
+	s, algorithms := newScheduler(t, 2, func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+		mu.Lock()
+		active++
+		mostActive = max(mostActive, active)
+		mu.Unlock()
+		started <- algo.ID
+		<-release
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return hold(algo, schedule)
+	})
+	s.slots = make(chan struct{}, 1)
+	storeBar(t, s, barClose.Add(time.Minute))
+
+	if n := s.RunDue(at); n != 2 {
+		t.Fatalf("RunDue started %d runs, want 2", n)
+	}
+	first := <-started
+
+	// Both algorithms are reserved, one running and one waiting for the single worker slot
+	if n := s.RunDue(at.Add(time.Minute)); n != 0 {
+		t.Errorf("RunDue started %d runs of algorithms still running, want none", n)
+	}
+	for _, algo := range algorithms {
+		if got := schedule(t, s, algo.ID); !got.BarClose.Equal(barClose) {
+			t.Errorf("skipped run of %s claimed %s", algo.ID, got.BarClose)
+		}
+	}
+
+	release <- struct{}{}
+	if second := <-started; second == first {
+		t.Errorf("%s ran twice", first)
+	}
+	release <- struct{}{}
+	s.Wait()
+	if mostActive != 1 {
+		t.Errorf("%d runs were active at once with one worker slot", mostActive)
+	}
+
+	// Finished runs release their algorithms
+	close(release)
+	if n := s.RunDue(at.Add(time.Minute)); n != 2 {
+		t.Errorf("RunDue started %d runs after the earlier ones finished, want 2", n)
+	}
+	s.Wait()
+}
+
+func TestRunRecoversFromPanics(t *testing.T) {
+	var panicking string
+	s, algorithms := newScheduler(t, 2, func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+		if algo.ID == panicking {
+			panic("boom")
+		}
+		return hold(algo, schedule)
+	})
+	panicking = algorithms[0].ID
+
+	if n := s.RunDue(at); n != 2 {
+		t.Fatalf("RunDue started %d runs, want 2", n)
+	}
+	s.Wait()
+
+	failed := schedule(t, s, algorithms[0].ID)
+	if failed.Status != data.AlgorithmScheduleStatusFailed || failed.Error == nil || *failed.Error != "panic: boom" || failed.FinishedAt == nil {
+		t.Errorf("schedule of the panicking run is %+v, want failed with panic: boom", failed)
+	}
+	if got := schedule(t, s, algorithms[1].ID); got.Status != data.AlgorithmScheduleStatusSucceeded {
+		t.Errorf("schedule of the other run is %s, want succeeded", got.Status)
+	}
+
+	// The panicking algorithm is released and runs again at the next bar close
+	panicking = ""
+	storeBar(t, s, barClose.Add(time.Minute))
+	if n := s.RunDue(at.Add(time.Minute)); n != 2 {
+		t.Errorf("RunDue started %d runs after a panic, want 2", n)
+	}
+	s.Wait()
+	if got := schedule(t, s, algorithms[0].ID); got.Status != data.AlgorithmScheduleStatusSucceeded {
+		t.Errorf("schedule after the panic is %s, want succeeded", got.Status)
+	}
+}
+
+func TestRunDueWaitsForANewBar(t *testing.T) {
+	var runs int
+	s, algorithms := newScheduler(t, 1, func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+		runs++
+		return hold(algo, schedule)
+	})
+	if n := s.RunDue(at); n != 1 {
+		t.Fatalf("RunDue started %d runs, want 1", n)
+	}
+	s.Wait()
+
+	// On a holiday the calendar does not know about, bars close on the calendar but none is stored
+	for _, later := range []time.Duration{time.Minute, time.Hour, 24 * time.Hour} {
+		if n := s.RunDue(at.Add(later)); n != 0 {
+			t.Errorf("RunDue %s later started %d runs without a new bar, want none", later, n)
+		}
+	}
+	if got := schedule(t, s, algorithms[0].ID); !got.BarClose.Equal(barClose) {
+		t.Errorf("RunDue without a new bar claimed %s", got.BarClose)
+	}
+
+	storeBar(t, s, barClose.Add(time.Hour))
+	if n := s.RunDue(at.Add(time.Hour)); n != 1 {
+		t.Errorf("RunDue started %d runs once a new bar was stored, want 1", n)
+	}
+	s.Wait()
+	if runs != 2 {
+		t.Errorf("algorithm ran %d times, want 2", runs)
+	}
+}
+
+func TestRunDueRecordsStaleLiveRuns(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       data.ExecutionMode
+		wantStatus data.AlgorithmScheduleStatus
+		wantRun    bool
+	}{
+		{"live trading", data.ExecutionModeLiveTrading, data.AlgorithmScheduleStatusFailed, false},
+		{"paper trading", data.ExecutionModePaperTrading, data.AlgorithmScheduleStatusSucceeded, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			s, algorithms := newScheduler(t, 1, func(algo *data.Algorithm, schedule *data.AlgorithmSchedule) error {
+				ran = true
+				return hold(algo, schedule)
+			})
+			id := algorithms[0].ID
+			if _, err := s.db.Exec("UPDATE algorithms SET execution_mode = ? WHERE id = ?", string(tt.mode), id); err != nil {
+				t.Fatalf("set execution mode: %v", err)
+			}
+
+			// The bar that closed a minute after barClose has not been stored yet
+			if n := s.RunDue(at.Add(time.Minute)); n != 1 {
+				t.Fatalf("RunDue started %d runs, want 1", n)
+			}
+			s.Wait()
+
+			got := schedule(t, s, id)
+			if ran != tt.wantRun || got.Status != tt.wantStatus || !got.BarClose.Equal(barClose.Add(time.Minute)) {
+				t.Errorf("ran %v and recorded %s for %s, want ran %v and %s", ran, got.Status, got.BarClose, tt.wantRun, tt.wantStatus)
+			}
+			if !tt.wantRun && (got.Error == nil || !strings.HasPrefix(*got.Error, "stale bars")) {
+				t.Errorf("stale run recorded error %v, want stale bars", got.Error)
+			}
+		})
+	}
+}
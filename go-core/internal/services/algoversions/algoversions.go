@@ -0,0 +1,191 @@
+// Package algoversions keeps the version history of algorithms: an immutable snapshot of the
+// code and config at creation and at every change to either, diffs between snapshots, and
+// rollbacks to earlier ones.
+package algoversions
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// ErrVersionNotFound is returned for a version the algorithm does not have
+var ErrVersionNotFound = errors.New("algorithm version not found")
+
+// Service stores algorithms together with their versions
+type Service struct {
+	db *sql.DB
+}
+
+// NewService creates an algorithm version service
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// Create stores a new algorithm as version 1
+// message describes the version; empty means "Created".
+func (s *Service) Create(algo *data.Algorithm, authorID int, message string) (*data.AlgorithmVersion, error) {
+	if message == "" {
+		message = "Created"
+	}
+	algo.Version = 1
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := repos.NewAlgorithmRepository(s.db).WithTx(tx).CreateAlgorithm(algo); err != nil {
+		return nil, err
+	}
+	version := snapshot(algo, authorID, message)
+	if err := repos.NewAlgorithmVersionRepository(s.db).WithTx(tx).CreateVersion(version); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return version, nil
+}
+
+// Update saves an algorithm, storing a new version when its code, config or graph differ from
+// its latest version, and returns that version, or nil when none changed
+// message describes the version; empty means one naming what changed.
+func (s *Service) Update(algo *data.Algorithm, authorID int, message string) (*data.AlgorithmVersion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	versionRepo := repos.NewAlgorithmVersionRepository(s.db).WithTx(tx)
+	latest, err := versionRepo.GetLatestVersion(algo.ID, algo.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var version *data.AlgorithmVersion
+	codeChanged := latest == nil || latest.Code != algo.Code
+	configChanged := latest == nil || !sameConfig(latest.Config, algo.Config)
+	graphChanged := latest == nil || !sameGraph(latest.Graph, algo.Graph)
+	if codeChanged || configChanged || graphChanged {
+		algo.Version++
+		if latest != nil && latest.Version >= algo.Version {
+			algo.Version = latest.Version + 1
+		}
+		if message == "" {
+			message = describe(codeChanged, configChanged, graphChanged)
+		}
+		version = snapshot(algo, authorID, message)
+		if err := versionRepo.CreateVersion(version); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := repos.NewAlgorithmRepository(s.db).WithTx(tx).UpdateAlgorithm(algo); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if version != nil {
+		utils.LogInfo("Algorithm version created", map[string]interface{}{
+			"algorithm_id": algo.ID,
+			"version":      version.Version,
+		})
+	}
+	return version, nil
+}
+
+// Rollback restores the code, config and graph of one of an algorithm's versions as a new version
+// History is never rewritten: rolling back from version 5 to version 2 creates version 6 with
+// version 2's code and config. Nothing is stored when the algorithm already has them.
+// message describes the version; empty means "Rolled back to version N".
+func (s *Service) Rollback(algo *data.Algorithm, to, authorID int, message string) (*data.AlgorithmVersion, error) {
+	target, err := s.Get(algo.ID, algo.UserID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Rolled back to version %d", to)
+	}
+	algo.Code = target.Code
+	algo.Graph = target.Graph
+	algo.Config = target.Config
+	if algo.Config == nil {
+		algo.Config = map[string]interface{}{}
+	}
+	algo.UpdatedAt = time.Now()
+	return s.Update(algo, authorID, message)
+}
+
+// Get returns one version of a user's algorithm
+func (s *Service) Get(algorithmID string, userID, version int) (*data.AlgorithmVersion, error) {
+	found, err := repos.NewAlgorithmVersionRepository(s.db).GetVersion(algorithmID, userID, version)
+	if err != nil {
+		return nil, fmt.Errorf("%w: version %d", ErrVersionNotFound, version)
+	}
+	return found, nil
+}
+
+// snapshot is a version holding an algorithm's current code, graph and config
+func snapshot(algo *data.Algorithm, authorID int, message string) *data.AlgorithmVersion {
+	return &data.AlgorithmVersion{
+		ID:          utils.GenerateID(),
+		AlgorithmID: algo.ID,
+		UserID:      algo.UserID,
+		Version:     algo.Version,
+		Code:        algo.Code,
+		Graph:       algo.Graph,
+		Config:      algo.Config,
+		AuthorID:    authorID,
+		Message:     message,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// describe is the default message of a version
+// A change to the graph alone moved or relabelled nodes without changing the code.
+func describe(codeChanged, configChanged, graphChanged bool) string {
+	switch {
+	case codeChanged && configChanged:
+		return "Updated code and config"
+	case codeChanged:
+		return "Updated code"
+	case configChanged:
+		return "Updated config"
+	default:
+		return "Updated graph"
+	}
+}
+
+// sameConfig compares configs by their JSON encoding, treating nil as empty
+func sameConfig(a, b map[string]interface{}) bool {
+	if a == nil {
+		a = map[string]interface{}{}
+	}
+	if b == nil {
+		b = map[string]interface{}{}
+	}
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// sameGraph compares graphs by their JSON encoding
+func sameGraph(a, b *data.AlgorithmGraph) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
@@ -0,0 +1,196 @@
+package algoversions
+
+import (
+	"fmt"
+	"strings"
+
+	"go-core/internal/data"
+	"go-core/internal/services/algoruntime"
+)
+
+const (
+	// diffContext is how many unchanged lines surround each change in a code diff
+	diffContext = 3
+	// maxDiffCells bounds the line comparison table; larger changes are shown as a replacement
+	// of every changed line
+	maxDiffCells = 4_000_000
+)
+
+// Diff is how an algorithm's code and config changed from one version to another
+type Diff struct {
+	AlgorithmID  string          `json:"algorithm_id"`
+	From         int             `json:"from"`
+	To           int             `json:"to"`
+	Code         string          `json:"code"` // unified diff; empty when the code is the same
+	LinesAdded   int             `json:"lines_added"`
+	LinesRemoved int             `json:"lines_removed"`
+	Config       *data.StateDiff `json:"config"` // added, changed and removed top-level keys
+}
+
+// Diff compares two versions of a user's algorithm
+func (s *Service) Diff(algorithmID string, userID, from, to int) (*Diff, error) {
+	fromVersion, err := s.Get(algorithmID, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := s.Get(algorithmID, userID, to)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(fromVersion, toVersion), nil
+}
+
+// Compare diffs two versions
+func Compare(from, to *data.AlgorithmVersion) *Diff {
+	ops := diffLines(splitLines(from.Code), splitLines(to.Code))
+	diff := &Diff{
+		AlgorithmID: from.AlgorithmID,
+		From:        from.Version,
+		To:          to.Version,
+		Config:      algoruntime.DiffState(from.Config, to.Config),
+	}
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			diff.LinesAdded++
+		case '-':
+			diff.LinesRemoved++
+		}
+	}
+	if diff.LinesAdded > 0 || diff.LinesRemoved > 0 {
+		diff.Code = fmt.Sprintf("--- version %d\n+++ version %d\n", from.Version, to.Version) + unified(ops)
+	}
+	return diff
+}
+
+// lineOp is one line of a diff: ' ' unchanged, '-' removed or '+' added
+type lineOp struct {
+	kind byte
+	line string
+}
+
+func splitLines(code string) []string {
+	if code == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+}
+
+// diffLines turns a into b with the fewest added and removed lines, by longest common
+// subsequence over the lines between the common prefix and suffix
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, lineOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	i, j := 0, 0
+	if n*m <= maxDiffCells {
+		// common[i*(m+1)+j] is the longest common subsequence of midA[i:] and midB[j:]
+		common := make([]int32, (n+1)*(m+1))
+		at := func(i, j int) int32 { return common[i*(m+1)+j] }
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					common[i*(m+1)+j] = at(i+1, j+1) + 1
+				} else {
+					common[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+				}
+			}
+		}
+		for i < n && j < m {
+			switch {
+			case midA[i] == midB[j]:
+				ops = append(ops, lineOp{' ', midA[i]})
+				i++
+				j++
+			case at(i+1, j) >= at(i, j+1):
+				ops = append(ops, lineOp{'-', midA[i]})
+				i++
+			default:
+				ops = append(ops, lineOp{'+', midB[j]})
+				j++
+			}
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, lineOp{'-', midA[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, lineOp{'+', midB[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, lineOp{' ', line})
+	}
+	return ops
+}
+
+// unified formats a diff as unified diff hunks with diffContext lines of context
+func unified(ops []lineOp) string {
+	// Line numbers in a and b before each op
+	lineA := make([]int, len(ops)+1)
+	lineB := make([]int, len(ops)+1)
+	for k, op := range ops {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if op.kind != '+' {
+			lineA[k+1]++
+		}
+		if op.kind != '-' {
+			lineB[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// A hunk runs until more unchanged lines than two contexts separate it from the next change
+		start := max(0, k-diffContext)
+		end := k + 1
+		for next := k + 1; next < len(ops); next++ {
+			if ops[next].kind != ' ' {
+				end = next + 1
+			} else if next-end+1 > 2*diffContext {
+				break
+			}
+		}
+		end = min(len(ops), end+diffContext)
+
+		countA, countB := lineA[end]-lineA[start], lineB[end]-lineB[start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(lineA[start], countA), hunkRange(lineB[start], countB))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk on one side; an empty side names the line
+// before it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
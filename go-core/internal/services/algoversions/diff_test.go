@@ -0,0 +1,109 @@
+package algoversions
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-core/internal/data"
+)
+
+// numbered returns n lines "line 1".."line n" with some replaced, newline terminated
+func numbered(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := replace[i]
+		if !ok {
+			line = fmt.Sprintf("line %d", i)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func TestCompareCode(t *testing.T) {
+	// Expected hunks are GNU diff -u output for the same inputs
+	tests := []struct {
+		name           string
+		from, to       string
+		want           string
+		added, removed int
+	}{
+		{name: "identical", from: numbered(5, nil), to: numbered(5, nil)},
+		{
+			name: "one changed line", from: numbered(10, nil), to: numbered(10, map[int]string{5: "line five"}),
+			want:  "@@ -2,7 +2,7 @@\n line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n",
+			added: 1, removed: 1,
+		},
+		{
+			name: "distant changes get their own hunks", from: numbered(20, nil), to: numbered(20, map[int]string{2: "line two", 15: "line fifteen"}),
+			want: "@@ -1,5 +1,5 @@\n line 1\n-line 2\n+line two\n line 3\n line 4\n line 5\n" +
+				"@@ -12,7 +12,7 @@\n line 12\n line 13\n line 14\n-line 15\n+line fifteen\n line 16\n line 17\n line 18\n",
+			added: 2, removed: 2,
+		},
+		{
+			name: "nearby changes share a hunk", from: numbered(10, nil), to: numbered(10, map[int]string{2: "line two", 8: "line eight"}),
+			want: "@@ -1,10 +1,10 @@\n line 1\n-line 2\n+line two\n line 3\n line 4\n line 5\n line 6\n line 7\n" +
+				"-line 8\n+line eight\n line 9\n line 10\n",
+			added: 2, removed: 2,
+		},
+		{name: "from empty", from: "", to: "a\nb\nc\n", want: "@@ -0,0 +1,3 @@\n+a\n+b\n+c\n", added: 3},
+		{name: "appended line", from: "a\nb\nc\n", to: "a\nb\nc\nd\n", want: "@@ -1,3 +1,4 @@\n a\n b\n c\n+d\n", added: 1},
+		{name: "removed line", from: "a\nb\nc\n", to: "a\nc\n", want: "@@ -1,3 +1,2 @@\n a\n-b\n c\n", removed: 1},
+		{name: "moved line", from: "x\ny\n", to: "y\nz\n", want: "@@ -1,2 +1,2 @@\n-x\n y\n+z\n", added: 1, removed: 1},
+		{name: "a missing final newline is not a change", from: "a\nb\n", to: "a\nb"},
+	}
+	for _, tt := range tests {
+		from := &data.AlgorithmVersion{AlgorithmID: "algo", Version: 1, Code: tt.from}
+		to := &data.AlgorithmVersion{AlgorithmID: "algo", Version: 2, Code: tt.to}
+		diff := Compare(from, to)
+
+		want := tt.want
+		if want != "" {
+			want = "--- version 1\n+++ version 2\n" + want
+		}
+		if diff.Code != want {
+			t.Errorf("%s: code diff\n got %q\nwant %q", tt.name, diff.Code, want)
+		}
+		if diff.LinesAdded != tt.added || diff.LinesRemoved != tt.removed {
+			t.Errorf("%s: +%d -%d, want +%d -%d", tt.name, diff.LinesAdded, diff.LinesRemoved, tt.added, tt.removed)
+		}
+		if diff.AlgorithmID != "algo" || diff.From != 1 || diff.To != 2 {
+			t.Errorf("%s: diff of %s %d..%d", tt.name, diff.AlgorithmID, diff.From, diff.To)
+		}
+	}
+}
+
+func TestCompareLargeChangesAreAReplacement(t *testing.T) {
+	// 2001 × 2001 lines exceeds maxDiffCells, so the changed middle is replaced wholesale
+	const n = 2001
+	from, to := make([]string, n), make([]string, n)
+	for i := range from {
+		from[i] = fmt.Sprintf("old %d", i)
+		to[i] = fmt.Sprintf("new %d", i)
+	}
+	code := func(lines []string) string { return "header\n" + strings.Join(lines, "\n") + "\nfooter\n" }
+
+	diff := Compare(&data.AlgorithmVersion{Version: 1, Code: code(from)}, &data.AlgorithmVersion{Version: 2, Code: code(to)})
+	if diff.LinesAdded != n || diff.LinesRemoved != n {
+		t.Fatalf("+%d -%d, want +%d -%d", diff.LinesAdded, diff.LinesRemoved, n, n)
+	}
+	if !strings.HasPrefix(diff.Code, fmt.Sprintf("--- version 1\n+++ version 2\n@@ -1,%d +1,%d @@\n header\n-old 0\n", n+2, n+2)) {
+		t.Fatalf("diff starts %q", diff.Code[:80])
+	}
+}
+
+func TestCompareConfig(t *testing.T) {
+	from := &data.AlgorithmVersion{Version: 1, Config: map[string]interface{}{"period": 14, "symbol": "INFY", "stop": 2.0}}
+	to := &data.AlgorithmVersion{Version: 2, Config: map[string]interface{}{"period": 20, "symbol": "INFY", "target": 4.0}}
+
+	want := &data.StateDiff{
+		Added:   map[string]interface{}{"target": 4.0},
+		Changed: map[string]data.StateChange{"period": {From: 14, To: 20}},
+		Removed: map[string]interface{}{"stop": 2.0},
+	}
+	if got := Compare(from, to).Config; !reflect.DeepEqual(got, want) {
+		t.Fatalf("config diff = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+// Package backtest replays stored candles through an algorithm's code bar by bar, acting on
+// its signals with a simulated account, and records the trades, equity curve and metrics.
+package backtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/tradesim"
+	"go-core/internal/utils"
+)
+
+// defaultMaxBars caps the bars of one backtest unless BACKTEST_MAX_BARS says otherwise
+const defaultMaxBars = 50000
+
+// defaultTimeout caps the wall-clock time of one backtest unless BACKTEST_TIMEOUT says otherwise
+const defaultTimeout = 2 * time.Minute
+
+// ErrInvalidSettings wraps settings a backtest cannot run with
+var ErrInvalidSettings = errors.New("invalid backtest settings")
+
+// Service runs and stores backtests
+type Service struct {
+	db      *sql.DB
+	limits  algoruntime.Limits
+	maxBars int
+	timeout time.Duration
+}
+
+// NewService creates a backtest service
+// BACKTEST_MAX_BARS caps the bars one backtest may simulate, default 50000; each bar is one
+// run of the algorithm's code under the runtime's limits. BACKTEST_TIMEOUT, a Go duration,
+// caps the wall-clock time of the whole backtest, default 2m.
+func NewService(db *sql.DB) *Service {
+	service := &Service{db: db, limits: algoruntime.DefaultLimits(), maxBars: defaultMaxBars, timeout: defaultTimeout}
+	if value := os.Getenv("BACKTEST_MAX_BARS"); value != "" {
+		if maxBars, err := strconv.Atoi(value); err == nil && maxBars > 0 {
+			service.maxBars = maxBars
+		}
+	}
+	if value := os.Getenv("BACKTEST_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			service.timeout = timeout
+		}
+	}
+	return service
+}
+
+// Run backtests an algorithm over its symbol's stored bars of its timeframe and stores the result
+// Every bar in the range runs the code once with the bars before it, up to settings.Lookback, and
+// the portfolio of the simulated account; state starts empty and carries from bar to bar, and
+// the algorithm's own state is left alone. Positions still open after the last bar are closed
+// at its close.
+// Settings that cannot run return ErrInvalidSettings and code that does not compile returns an
+// *algoruntime.Error, both without storing anything. Code that fails on a bar, or running out
+// of the service's time limit, stops the backtest, which is stored as failed with the trades up
+// to that bar. Cancelling ctx stops it without storing anything.
+func (s *Service) Run(ctx context.Context, algo *data.Algorithm, settings data.BacktestSettings) (*data.Backtest, error) {
+	if err := validate(&settings); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+
+	program, err := algoruntime.Compile(algo.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	candles, warmup, err := s.load(algo, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	backtest := &data.Backtest{
+		ID:          utils.GenerateID(),
+		AlgorithmID: algo.ID,
+		UserID:      algo.UserID,
+		Symbol:      algo.Symbol,
+		Timeframe:   algo.Timeframe,
+		Settings:    settings,
+		Status:      data.BacktestStatusCompleted,
+		Trades:      []data.SimulatedTrade{},
+		EquityCurve: []data.EquityPoint{},
+		CreatedAt:   started.UTC(),
+	}
+	version := algo.Version
+	backtest.AlgorithmVersion = &version
+
+	account := tradesim.NewAccount(settings.InitialCapital, tradesim.CostsOf(settings.SimulationSettings))
+	bars := algoruntime.NewBars(candles)
+	state := map[string]interface{}{}
+	peak := settings.InitialCapital
+	exposed := 0
+
+	limited, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	for i := warmup; i < len(candles); i++ {
+		bar := candles[i]
+		_, trades := account.Step(bar)
+		backtest.Trades = append(backtest.Trades, trades...)
+
+		input := bars.Input(max(0, i+1-settings.Lookback), i+1)
+		input.Symbol = algo.Symbol
+		input.Portfolio = account.Portfolio()
+		result, err := program.Run(limited, input, state, algo.Config, s.limits)
+		if err == nil && limited.Err() != nil {
+			err = limited.Err() // the run finished, but past the time limit
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var codeErr *algoruntime.Error
+			reason := fmt.Sprintf("backtest time limit of %s exceeded", s.timeout)
+			if limited.Err() == nil {
+				if !errors.As(err, &codeErr) {
+					return nil, err
+				}
+				reason = codeErr.Error()
+			}
+			message := fmt.Sprintf("bar %s: %s", bar.Timestamp.Format(time.RFC3339), reason)
+			backtest.Status = data.BacktestStatusFailed
+			backtest.Error = &message
+		} else {
+			state = result.State
+			_, trades = account.Act(result.Signal, bar, settings.SimulationSettings)
+			backtest.Trades = append(backtest.Trades, trades...)
+		}
+
+		if len(account.Positions) > 0 {
+			exposed++
+		}
+		backtest.EquityCurve = append(backtest.EquityCurve, equityPoint(account, bar.Timestamp, &peak))
+		backtest.Bars++
+		if backtest.Status == data.BacktestStatusFailed {
+			break
+		}
+	}
+
+	if backtest.Bars > 0 {
+		first := candles[warmup].Timestamp
+		last := candles[warmup+backtest.Bars-1].Timestamp
+		backtest.StartAt, backtest.EndAt = &first, &last
+
+		_, trades := account.CloseAll(tradesim.ExitEnd, last)
+		backtest.Trades = append(backtest.Trades, trades...)
+		backtest.EquityCurve[len(backtest.EquityCurve)-1] = equityPoint(account, last, &peak)
+	}
+	backtest.Metrics = metrics(settings.InitialCapital, account, backtest.Trades, backtest.EquityCurve, exposed, algo.Timeframe)
+	backtest.DurationMs = time.Since(started).Milliseconds()
+
+	if err := repos.NewBacktestRepository(s.db).CreateBacktest(backtest); err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("Backtest finished", map[string]interface{}{
+		"backtest_id":  backtest.ID,
+		"algorithm_id": algo.ID,
+		"status":       backtest.Status,
+		"bars":         backtest.Bars,
+		"trades":       len(backtest.Trades),
+		"duration_ms":  backtest.DurationMs,
+	})
+
+	return backtest, nil
+}
+
+// load reads the bars to simulate and the warmup bars before them
+// It returns the bars oldest first and the index of the first bar to simulate.
+func (s *Service) load(algo *data.Algorithm, settings data.BacktestSettings) ([]*data.Candle, int, error) {
+	var from, to time.Time
+	if settings.From != nil {
+		from = *settings.From
+	}
+	if settings.To != nil {
+		to = *settings.To
+	}
+
+	repo := repos.NewCandleRepository(s.db)
+	candles, err := repo.GetCandles(algo.Symbol, algo.Timeframe, from, to, s.maxBars+1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load candles: %w", err)
+	}
+	if len(candles) == 0 {
+		return nil, 0, fmt.Errorf("%w: no %s candles of %s stored in the range", ErrInvalidSettings, algo.Timeframe, algo.Symbol)
+	}
+	if len(candles) > s.maxBars {
+		return nil, 0, fmt.Errorf("%w: the range has more than %d bars", ErrInvalidSettings, s.maxBars)
+	}
+
+	warmup, err := repo.GetLatestCandles(algo.Symbol, algo.Timeframe, candles[0].Timestamp, settings.Lookback-1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load candles: %w", err)
+	}
+	return append(warmup, candles...), len(warmup), nil
+}
+
+// validate checks settings and fills in their defaults
+func validate(settings *data.BacktestSettings) error {
+	if settings.From != nil && settings.To != nil && !settings.From.Before(*settings.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	return tradesim.Validate(&settings.SimulationSettings)
+}
+
+// equityPoint records the account's value at the close of a bar and tracks the peak equity
+func equityPoint(account *tradesim.Account, at time.Time, peak *float64) data.EquityPoint {
+	equity := account.Equity()
+	if equity > *peak {
+		*peak = equity
+	}
+	return data.EquityPoint{
+		Timestamp:   at,
+		Equity:      round(equity),
+		Cash:        round(account.Cash),
+		DrawdownPct: round((*peak - equity) / *peak * 100),
+	}
+}
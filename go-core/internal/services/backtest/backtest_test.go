@@ -0,0 +1,137 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+var start = time.Date(2030, 1, 7, 3, 45, 0, 0, time.UTC)
+
+// scripted buys 10 shares on the third bar and fails on the bar config['fail_at'] names
+const scripted = `def algorithm(data, context):
+    state = context['state']
+    state['bar'] = state.get('bar', 0) + 1
+    if state['bar'] == context['config'].get('fail_at'):
+        fail('boom')
+    if state['bar'] == 3:
+        return {'signal': 'BUY', 'quantity': 10}
+    return {'signal': 'HOLD'}
+`
+
+// newService opens a fresh database with ten one-minute INFY bars closing 100 to 109, each
+// opening half a rupee below its close, and returns an algorithm of a user to backtest
+func newService(t *testing.T, code string, config map[string]interface{}) (*Service, *data.Algorithm) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	conn := db.GetConnection()
+
+	user := &data.User{Name: "trader", Email: "trader@example.com", CreatedAt: time.Now().UTC()}
+	if err := repos.NewUserRepository(conn, nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		price := 100 + float64(i)
+		candle := &data.Candle{
+			Symbol: "INFY", Timeframe: data.Timeframe1m, Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open: price - 0.5, High: price + 1, Low: price - 1, Close: price, Volume: 1000,
+		}
+		if err := repos.NewCandleRepository(conn).UpsertCandle(candle); err != nil {
+			t.Fatalf("store candle: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	algo := &data.Algorithm{
+		ID: utils.GenerateID(), UserID: user.ID, Name: "Scripted", Code: code, Status: data.AlgorithmStatusDraft,
+		Symbol: "INFY", Timeframe: data.Timeframe1m, ExecutionMode: data.ExecutionModePaperTrading,
+		Config: config, State: map[string]interface{}{}, Version: 1, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repos.NewAlgorithmRepository(conn).CreateAlgorithm(algo); err != nil {
+		t.Fatalf("create algorithm: %v", err)
+	}
+	return NewService(conn), algo
+}
+
+func TestRunStopsAtTheFailingBar(t *testing.T) {
+	service, algo := newService(t, scripted, map[string]interface{}{"fail_at": 5})
+
+	backtest, err := service.Run(context.Background(), algo, data.BacktestSettings{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if backtest.Status != data.BacktestStatusFailed || backtest.Bars != 5 || len(backtest.EquityCurve) != 5 {
+		t.Fatalf("backtest %s over %d bars, want failed on the fifth", backtest.Status, backtest.Bars)
+	}
+	if want := "bar 2030-01-07T03:49:00Z: runtime error at line 5: fail: boom"; backtest.Error == nil || *backtest.Error != want {
+		t.Fatalf("error %v, want %q", backtest.Error, want)
+	}
+	// Bought at the fourth bar's open and closed at the last simulated bar's close
+	if len(backtest.Trades) != 1 || backtest.Trades[0].EntryPrice != 102.5 || backtest.Trades[0].ExitPrice != 104 || backtest.Trades[0].PnL != 15 {
+		t.Fatalf("trades %+v, want 102.5 to 104", backtest.Trades)
+	}
+
+	stored, err := repos.NewBacktestRepository(service.db).GetBacktestByID(backtest.ID, algo.ID, algo.UserID)
+	if err != nil || stored.Status != data.BacktestStatusFailed || len(stored.Trades) != 1 {
+		t.Fatalf("stored backtest %+v, %v", stored, err)
+	}
+}
+
+func TestRunTimeLimit(t *testing.T) {
+	service, algo := newService(t, "def algorithm(data, context):\n    while True:\n        pass\n", nil)
+	service.timeout = 20 * time.Millisecond
+
+	backtest, err := service.Run(context.Background(), algo, data.BacktestSettings{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if backtest.Status != data.BacktestStatusFailed || backtest.Bars != 1 || backtest.Error == nil ||
+		!strings.HasSuffix(*backtest.Error, "backtest time limit of 20ms exceeded") {
+		t.Fatalf("backtest %s over %d bars: %v, want the time limit on the first bar", backtest.Status, backtest.Bars, backtest.Error)
+	}
+}
+
+func TestRunRejectsWithoutStoring(t *testing.T) {
+	from, to := start.Add(5*time.Minute), start
+	later := start.AddDate(1, 0, 0)
+	tests := []struct {
+		name     string
+		code     string
+		settings data.BacktestSettings
+		want     string
+	}{
+		{name: "fill rule", code: scripted, settings: data.BacktestSettings{SimulationSettings: data.SimulationSettings{Fill: "midpoint"}}, want: "invalid backtest settings"},
+		{name: "empty range", code: scripted, settings: data.BacktestSettings{From: &from, To: &to}, want: "invalid backtest settings: from must be before to"},
+		{name: "no candles", code: scripted, settings: data.BacktestSettings{From: &later}, want: "invalid backtest settings: no 1m candles of INFY stored in the range"},
+		{name: "bad code", code: "def algorithm(data):\n    return {}\n", want: "syntax error at line 1: algorithm must take (data, context)"},
+	}
+	for _, tt := range tests {
+		service, algo := newService(t, tt.code, nil)
+		_, err := service.Run(context.Background(), algo, tt.settings)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+		var codeErr *algoruntime.Error
+		if errors.Is(err, ErrInvalidSettings) == errors.As(err, &codeErr) {
+			t.Errorf("%s: error %v is not one of ErrInvalidSettings or a code error", tt.name, err)
+		}
+		if stored, _ := repos.NewBacktestRepository(service.db).GetBacktestsByAlgorithm(algo.ID, algo.UserID, 10, 0); len(stored) != 0 {
+			t.Errorf("%s: stored %d backtests", tt.name, len(stored))
+		}
+	}
+
+	service, algo := newService(t, scripted, nil)
+	service.maxBars = 9
+	if _, err := service.Run(context.Background(), algo, data.BacktestSettings{}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("ten bars over a cap of nine: error %v, want ErrInvalidSettings", err)
+	}
+}
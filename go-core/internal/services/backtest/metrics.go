@@ -0,0 +1,119 @@
+package backtest
+
+import (
+	"math"
+
+	"go-core/internal/data"
+	"go-core/internal/services/candles"
+	"go-core/internal/services/tradesim"
+)
+
+const (
+	tradingDaysPerYear = 252
+	sessionMinutes     = 375 // 09:15 to 15:30 IST
+)
+
+// metrics summarizes a finished backtest
+func metrics(capital float64, account *tradesim.Account, trades []data.SimulatedTrade, curve []data.EquityPoint, exposed int, timeframe data.Timeframe) data.BacktestMetrics {
+	equity := account.Equity()
+	m := data.BacktestMetrics{
+		InitialCapital: capital,
+		FinalEquity:    round(equity),
+		TotalPnL:       round(equity - capital),
+		ReturnPct:      round((equity - capital) / capital * 100),
+		TotalTrades:    len(trades),
+		TotalCharges:   round(account.Charges),
+	}
+
+	var grossProfit, grossLoss float64
+	for _, trade := range trades {
+		if trade.PnL > 0 {
+			m.WinningTrades++
+			grossProfit += trade.PnL
+		} else {
+			m.LosingTrades++
+			grossLoss -= trade.PnL
+		}
+	}
+	if m.TotalTrades > 0 {
+		m.WinRate = round4(float64(m.WinningTrades) / float64(m.TotalTrades))
+	}
+	if m.WinningTrades > 0 {
+		m.AverageWin = round(grossProfit / float64(m.WinningTrades))
+	}
+	if m.LosingTrades > 0 {
+		m.AverageLoss = round(-grossLoss / float64(m.LosingTrades))
+	}
+	if grossLoss > 0 {
+		m.ProfitFactor = round4(grossProfit / grossLoss)
+	}
+
+	peak := capital
+	previous := capital
+	var returns []float64
+	for _, point := range curve {
+		peak = math.Max(peak, point.Equity)
+		if drawdown := peak - point.Equity; drawdown > m.MaxDrawdown {
+			m.MaxDrawdown = round(drawdown)
+		}
+		m.MaxDrawdownPct = math.Max(m.MaxDrawdownPct, point.DrawdownPct)
+		if previous > 0 {
+			returns = append(returns, point.Equity/previous-1)
+		}
+		previous = point.Equity
+	}
+	if len(curve) > 0 {
+		m.ExposurePct = round(float64(exposed) / float64(len(curve)) * 100)
+	}
+	m.SharpeRatio = round4(sharpe(returns, timeframe))
+
+	return m
+}
+
+// sharpe annualizes the mean over the standard deviation of per-bar returns, with no risk-free rate
+func sharpe(returns []float64, timeframe data.Timeframe) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(returns)-1))
+	if stddev == 0 {
+		return 0
+	}
+	return mean / stddev * math.Sqrt(barsPerYear(timeframe))
+}
+
+// barsPerYear is how many bars of timeframe a year of NSE sessions has
+func barsPerYear(timeframe data.Timeframe) float64 {
+	switch timeframe {
+	case data.Timeframe1d:
+		return tradingDaysPerYear
+	case data.Timeframe1w:
+		return 52
+	}
+	duration, ok := candles.Duration(timeframe)
+	if !ok {
+		return tradingDaysPerYear
+	}
+	return tradingDaysPerYear * math.Ceil(sessionMinutes/duration.Minutes())
+}
+
+// round rounds to the paisa
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// round4 rounds ratios to four decimal places
+func round4(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
@@ -0,0 +1,299 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+)
+
+// FormatName identifies a journal backup archive
+const FormatName = "100xtrader-journal-backup"
+
+// SchemaVersion is the archive layout written by this build
+// Bump it whenever the JSON shapes below change and teach Read how to upgrade older archives
+// Version 2 added the broker mirrors and the algorithm history; version 1 archives restore without them.
+const SchemaVersion = 2
+
+// Archive entry names
+const (
+	manifestFile    = "manifest.json"
+	userFile        = "user.json"
+	tradesFile      = "trades.json"
+	strategiesFile  = "strategies.json"
+	rulesFile       = "rules.json"
+	mistakesFile    = "mistakes.json"
+	algorithmsFile  = "algorithms.json"
+	versionsFile    = "algorithm_versions.json"
+	runsFile        = "algorithm_runs.json"
+	backtestsFile   = "backtests.json"
+	paperFile       = "paper_accounts.json"
+	fillsFile       = "broker_fills.json"
+	ordersFile      = "broker_orders.json"
+	positionsFile   = "broker_positions.json"
+	screenshotsDir  = "screenshots/"
+	screenshotRef   = "archive:"
+	maxEntryBytes   = 256 << 20
+	maxScreenshotMB = 25
+)
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Format        string         `json:"format"`
+	SchemaVersion int            `json:"schema_version"`
+	AppVersion    string         `json:"app_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	SourceUserID  int            `json:"source_user_id"`
+	Counts        map[string]int `json:"counts"`
+	Excluded      []string       `json:"excluded,omitempty"`
+}
+
+// excludedData lists the user data an archive leaves out, recorded in each manifest
+// Broker history is archived rather than left to a sync, since some brokers only report today's trades.
+var excludedData = []string{
+	"broker credentials; reconnect brokers after restoring",
+	"broker sync schedules and their run history",
+	"algorithm schedules; scheduled algorithms resume at the next bar close",
+}
+
+// UserProfile is the non-secret part of the user record
+// Broker credentials are deliberately left out; brokers must be reconnected after a restore
+type UserProfile struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     *string   `json:"phone"`
+	Brokers   []string  `json:"brokers"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Contents is a fully decoded and validated archive
+type Contents struct {
+	Manifest    Manifest
+	User        UserProfile
+	Trades      []*data.Trade
+	Strategies  []*data.Strategy
+	Rules       []*data.Rule
+	Mistakes    []*data.Mistake
+	Algorithms  []*data.Algorithm
+	Versions    []*data.AlgorithmVersion
+	Runs        []*data.AlgorithmRun
+	Backtests   []*data.Backtest
+	Paper       []*data.PaperAccount
+	Fills       []*data.BrokerFill
+	Orders      []*data.BrokerOrder // with their events
+	Positions   []*data.BrokerPosition
+	Screenshots map[string][]byte
+}
+
+// Read decodes an archive and validates its schema version and contents
+func Read(r io.ReaderAt, size int64) (*Contents, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid backup archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	contents := &Contents{Screenshots: make(map[string][]byte)}
+	if err := decodeEntry(files, manifestFile, &contents.Manifest); err != nil {
+		return nil, err
+	}
+	if err := contents.Manifest.validate(); err != nil {
+		return nil, err
+	}
+
+	entries := []struct {
+		name   string
+		target interface{}
+	}{
+		{userFile, &contents.User},
+		{tradesFile, &contents.Trades},
+		{strategiesFile, &contents.Strategies},
+		{rulesFile, &contents.Rules},
+		{mistakesFile, &contents.Mistakes},
+		{algorithmsFile, &contents.Algorithms},
+	}
+	if contents.Manifest.SchemaVersion >= 2 {
+		entries = append(entries, []struct {
+			name   string
+			target interface{}
+		}{
+			{versionsFile, &contents.Versions},
+			{runsFile, &contents.Runs},
+			{backtestsFile, &contents.Backtests},
+			{paperFile, &contents.Paper},
+			{fillsFile, &contents.Fills},
+			{ordersFile, &contents.Orders},
+			{positionsFile, &contents.Positions},
+		}...)
+	}
+	for _, entry := range entries {
+		if err := decodeEntry(files, entry.name, entry.target); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, f := range files {
+		if !strings.HasPrefix(name, screenshotsDir) || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if f.UncompressedSize64 > maxScreenshotMB<<20 {
+			return nil, fmt.Errorf("screenshot %s exceeds %d MB", name, maxScreenshotMB)
+		}
+		content, err := readEntry(f, maxScreenshotMB<<20)
+		if err != nil {
+			return nil, err
+		}
+		contents.Screenshots[name] = content
+	}
+
+	if err := contents.validate(); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// validate rejects archives from other tools or from newer builds
+func (m Manifest) validate() error {
+	if m.Format != FormatName {
+		return fmt.Errorf("unrecognised archive format %q", m.Format)
+	}
+	if m.SchemaVersion < 1 {
+		return fmt.Errorf("invalid archive schema version %d", m.SchemaVersion)
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("archive schema version %d is newer than the supported version %d", m.SchemaVersion, SchemaVersion)
+	}
+	return nil
+}
+
+// validate checks that every record is usable and every screenshot reference resolves
+func (c *Contents) validate() error {
+	for i, t := range c.Trades {
+		if t == nil || t.Symbol == "" || t.EntryDate.IsZero() {
+			return fmt.Errorf("trade %d is missing a symbol or entry date", i+1)
+		}
+		for _, s := range t.Screenshots {
+			if name, ok := screenshotName(s); ok {
+				if _, found := c.Screenshots[name]; !found {
+					return fmt.Errorf("trade %d references missing screenshot %s", i+1, name)
+				}
+			}
+		}
+	}
+	for i, s := range c.Strategies {
+		if s == nil || s.Name == "" {
+			return fmt.Errorf("strategy %d is missing a name", i+1)
+		}
+	}
+	for i, r := range c.Rules {
+		if r == nil || r.Name == "" {
+			return fmt.Errorf("rule %d is missing a name", i+1)
+		}
+	}
+	for i, m := range c.Mistakes {
+		if m == nil || m.Name == "" {
+			return fmt.Errorf("mistake %d is missing a name", i+1)
+		}
+	}
+	for i, a := range c.Algorithms {
+		if a == nil || a.Name == "" {
+			return fmt.Errorf("algorithm %d is missing a name", i+1)
+		}
+	}
+	for i, v := range c.Versions {
+		if v == nil || v.AlgorithmID == "" || v.Version < 1 {
+			return fmt.Errorf("algorithm version %d is missing its algorithm or number", i+1)
+		}
+	}
+	for i, run := range c.Runs {
+		if run == nil || run.AlgorithmID == "" {
+			return fmt.Errorf("algorithm run %d is missing its algorithm", i+1)
+		}
+	}
+	for i, b := range c.Backtests {
+		if b == nil || b.AlgorithmID == "" {
+			return fmt.Errorf("backtest %d is missing its algorithm", i+1)
+		}
+	}
+	for i, p := range c.Paper {
+		if p == nil || p.AlgorithmID == "" {
+			return fmt.Errorf("paper account %d is missing its algorithm", i+1)
+		}
+	}
+	for i, f := range c.Fills {
+		if f == nil || f.TradingBroker == "" || f.TradeID == "" {
+			return fmt.Errorf("broker fill %d is missing a broker or trade ID", i+1)
+		}
+	}
+	for i, o := range c.Orders {
+		if o == nil || o.TradingBroker == "" || o.OrderID == "" {
+			return fmt.Errorf("broker order %d is missing a broker or order ID", i+1)
+		}
+		for _, e := range o.Events {
+			if e == nil {
+				return fmt.Errorf("broker order %d has an empty event", i+1)
+			}
+		}
+	}
+	for i, p := range c.Positions {
+		if p == nil || p.TradingBroker == "" || p.Symbol == "" {
+			return fmt.Errorf("broker position %d is missing a broker or symbol", i+1)
+		}
+	}
+	return nil
+}
+
+// decodeEntry decodes a required JSON entry
+func decodeEntry(files map[string]*zip.File, name string, target interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("archive is missing %s", name)
+	}
+	content, err := readEntry(f, maxEntryBytes)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, target); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// readEntry reads an entry, refusing to inflate more than limit bytes
+func readEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return content, nil
+}
+
+// screenshotName returns the archive entry a trade screenshot points to, if any
+func screenshotName(value string) (string, bool) {
+	if !strings.HasPrefix(value, screenshotRef) {
+		return "", false
+	}
+	name := path.Clean(strings.TrimPrefix(value, screenshotRef))
+	if !strings.HasPrefix(name, screenshotsDir) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,264 @@
+package backup
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+)
+
+// appVersion is recorded in manifests to help diagnose archives from older builds
+const appVersion = "1.0.0"
+
+// Service produces and restores journal backup archives
+type Service struct {
+	db      *sql.DB
+	keyring *secrets.Keyring
+}
+
+// NewService creates a new backup service
+// keyring decrypts the user record the archive describes.
+func NewService(db *sql.DB, keyring *secrets.Keyring) *Service {
+	return &Service{db: db, keyring: keyring}
+}
+
+// FileName returns the suggested download name for a user's backup
+func FileName(userID int, now time.Time) string {
+	return fmt.Sprintf("journal-backup-%d-%s.zip", userID, now.Format("20060102-150405"))
+}
+
+// Backup writes an archive of a user's journal to w
+// The manifest lists the data the archive leaves out.
+// Trades are streamed twice: once for trades.json and once to copy inline screenshots into screenshots/
+func (s *Service) Backup(w io.Writer, userID int) (*Manifest, error) {
+	user, err := repos.NewUserRepository(s.db, s.keyring).GetUserByID(strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	strategies, err := repos.NewStrategyRepository(s.db).GetAllStrategiesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := repos.NewRuleRepository(s.db).GetAllRulesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	mistakes, err := repos.NewMistakeRepository(s.db).GetAllMistakesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	algorithms, err := repos.NewAlgorithmRepository(s.db).GetAllAlgorithmsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := repos.NewAlgorithmVersionRepository(s.db).GetAllVersionsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := repos.NewAlgorithmRunRepository(s.db).GetAllRunsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	backtests, err := repos.NewBacktestRepository(s.db).GetAllBacktestsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	paper, err := repos.NewPaperAccountRepository(s.db).GetAllAccountsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	fills, err := repos.NewBrokerFillRepository(s.db).GetAllBrokerFillsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	orderRepo := repos.NewBrokerOrderRepository(s.db)
+	orders, err := orderRepo.GetOrders(userID, repos.BrokerOrderFilter{})
+	if err != nil {
+		return nil, err
+	}
+	if err := orderRepo.LoadEvents(userID, orders); err != nil {
+		return nil, err
+	}
+	positions, err := repos.NewBrokerPositionRepository(s.db).GetAllBrokerPositionsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := zip.NewWriter(w)
+	counts := map[string]int{
+		"strategies": len(strategies),
+		"rules":      len(rules),
+		"mistakes":   len(mistakes),
+		"algorithms": len(algorithms),
+
+		"algorithm_versions": len(versions),
+		"algorithm_runs":     len(runs),
+		"backtests":          len(backtests),
+		"paper_accounts":     len(paper),
+		"broker_fills":       len(fills),
+		"broker_orders":      len(orders),
+		"broker_positions":   len(positions),
+	}
+
+	brokers := make([]string, 0, len(user.ConfiguredBrokers))
+	for name := range user.ConfiguredBrokers {
+		brokers = append(brokers, name)
+	}
+	sort.Strings(brokers)
+
+	profile := UserProfile{
+		Name:      user.Name,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		Brokers:   brokers,
+		CreatedAt: user.CreatedAt,
+	}
+	entries := []struct {
+		name  string
+		value interface{}
+	}{
+		{userFile, profile},
+		{strategiesFile, nonNil(strategies)},
+		{rulesFile, nonNil(rules)},
+		{mistakesFile, nonNil(mistakes)},
+		{algorithmsFile, nonNil(algorithms)},
+		{versionsFile, nonNil(versions)},
+		{runsFile, nonNil(runs)},
+		{backtestsFile, nonNil(backtests)},
+		{paperFile, nonNil(paper)},
+		{fillsFile, nonNil(fills)},
+		{ordersFile, nonNil(orders)},
+		{positionsFile, nonNil(positions)},
+	}
+	for _, entry := range entries {
+		if err := writeJSON(archive, entry.name, entry.value); err != nil {
+			return nil, err
+		}
+	}
+
+	tradeCount, screenshotCount, err := s.writeTrades(archive, userID)
+	if err != nil {
+		return nil, err
+	}
+	counts["trades"] = tradeCount
+	counts["screenshots"] = screenshotCount
+
+	manifest := &Manifest{
+		Format:        FormatName,
+		SchemaVersion: SchemaVersion,
+		AppVersion:    appVersion,
+		CreatedAt:     time.Now().UTC(),
+		SourceUserID:  userID,
+		Counts:        counts,
+		Excluded:      excludedData,
+	}
+	if err := writeJSON(archive, manifestFile, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeTrades streams trades.json, replacing inline screenshots with archive references,
+// then copies the screenshot bytes into their own entries
+func (s *Service) writeTrades(archive *zip.Writer, userID int) (int, int, error) {
+	repo := repos.NewTradeRepository(s.db)
+
+	entry, err := archive.Create(tradesFile)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create %s: %w", tradesFile, err)
+	}
+	if _, err := io.WriteString(entry, "["); err != nil {
+		return 0, 0, err
+	}
+
+	trades := 0
+	err = repo.ForEachTrade(userID, repos.TradeFilter{}, func(t *data.Trade) error {
+		screenshots := make([]string, len(t.Screenshots))
+		for i, value := range t.Screenshots {
+			screenshots[i] = value
+			if _, extension, ok := decodeDataURI(value); ok {
+				screenshots[i] = screenshotRef + screenshotEntry(t.ID, i, extension)
+			}
+		}
+		archived := *t
+		archived.Screenshots = screenshots
+
+		encoded, err := json.Marshal(archived)
+		if err != nil {
+			return err
+		}
+		if trades > 0 {
+			if _, err := io.WriteString(entry, ","); err != nil {
+				return err
+			}
+		}
+		trades++
+		_, err = entry.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write trades: %w", err)
+	}
+	if _, err := io.WriteString(entry, "]"); err != nil {
+		return 0, 0, err
+	}
+
+	screenshots := 0
+	err = repo.ForEachTrade(userID, repos.TradeFilter{}, func(t *data.Trade) error {
+		for i, value := range t.Screenshots {
+			content, extension, ok := decodeDataURI(value)
+			if !ok {
+				continue
+			}
+			entry, err := archive.Create(screenshotEntry(t.ID, i, extension))
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write(content); err != nil {
+				return err
+			}
+			screenshots++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write screenshots: %w", err)
+	}
+
+	return trades, screenshots, nil
+}
+
+// writeJSON writes value as an indented JSON entry
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// nonNil keeps empty collections as [] rather than null in the archive
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
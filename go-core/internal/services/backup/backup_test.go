@@ -0,0 +1,606 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// newService opens a fresh database with two users and returns a backup service over it
+func newService(t *testing.T) (*Service, *data.DB, [2]int) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+
+	masterKey := make([]byte, secrets.KeySize)
+	rand.Read(masterKey)
+	keyring, err := secrets.NewKeyring(masterKey)
+	if err != nil {
+		t.Fatalf("create keyring: %v", err)
+	}
+
+	var users [2]int
+	userRepo := repos.NewUserRepository(db.GetConnection(), keyring)
+	for i, name := range []string{"source", "target"} {
+		user := &data.User{Name: name, Email: name + "@example.com", CreatedAt: time.Now().UTC()}
+		if err := userRepo.CreateUser(user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		users[i] = user.ID
+	}
+	return NewService(db.GetConnection(), keyring), db, users
+}
+
+// seedJournal gives a user one strategy, rule and mistake and two trades, the first with an
+// inline screenshot and the second imported from a broker
+func seedJournal(t *testing.T, db *data.DB, userID int) {
+	t.Helper()
+	conn := db.GetConnection()
+	now := time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)
+
+	if err := repos.NewStrategyRepository(conn).CreateStrategy(&data.Strategy{
+		ID: utils.GenerateID(), UserID: userID, Name: "Breakout", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("create strategy: %v", err)
+	}
+	if err := repos.NewRuleRepository(conn).CreateRule(&data.Rule{
+		ID: utils.GenerateID(), UserID: userID, Name: "Wait for close", Category: data.RuleCategoryEntry, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if err := repos.NewMistakeRepository(conn).CreateMistake(&data.Mistake{
+		ID: utils.GenerateID(), UserID: userID, Name: "FOMO", Category: data.MistakeCategoryPsychological, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("create mistake: %v", err)
+	}
+
+	broker := data.TradingBrokerDhan
+	orderID := "ORD-1"
+	trades := []*data.Trade{
+		{
+			Symbol: "INFY", EntryPrice: 1500, Quantity: 10,
+			Screenshots: []string{"data:image/png;base64,iVBORw0KGgo=", "https://example.com/chart.png"},
+		},
+		{Symbol: "TCS", EntryPrice: 3900, Quantity: 2, TradingBroker: &broker, OrderID: &orderID},
+	}
+	for _, trade := range trades {
+		trade.ID, trade.UserID = utils.GenerateID(), userID
+		trade.MarketType, trade.Direction, trade.OutcomeSummary = data.MarketTypeIndian, data.TradeDirectionLong, data.OutcomeSummaryProfitable
+		trade.EntryDate, trade.CreatedAt, trade.UpdatedAt = now, now, now
+		trade.TotalAmount = trade.EntryPrice * float64(trade.Quantity)
+		if err := repos.NewTradeRepository(conn).CreateTrade(trade); err != nil {
+			t.Fatalf("create trade: %v", err)
+		}
+	}
+}
+
+// tradesOf returns a user's trades by symbol
+func tradesOf(t *testing.T, db *data.DB, userID int) map[string]*data.Trade {
+	t.Helper()
+	trades := make(map[string]*data.Trade)
+	err := repos.NewTradeRepository(db.GetConnection()).ForEachTrade(userID, repos.TradeFilter{}, func(trade *data.Trade) error {
+		trades[trade.Symbol] = trade
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list trades: %v", err)
+	}
+	return trades
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	service, db, users := newService(t)
+	seedJournal(t, db, users[0])
+
+	var archive bytes.Buffer
+	manifest, err := service.Backup(&archive, users[0])
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	wantCounts := map[string]int{"trades": 2, "screenshots": 1, "strategies": 1, "rules": 1, "mistakes": 1, "algorithms": 0}
+	for name, want := range wantCounts {
+		if manifest.Counts[name] != want {
+			t.Errorf("manifest counts %s = %d, want %d", name, manifest.Counts[name], want)
+		}
+	}
+
+	contents, err := Read(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if contents.User.Name != "source" || len(contents.Trades) != 2 || len(contents.Screenshots) != 1 {
+		t.Fatalf("archive holds user %q, %d trades and %d screenshots", contents.User.Name, len(contents.Trades), len(contents.Screenshots))
+	}
+
+	result, err := service.Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), users[1], RestoreModeMerge)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if result.Created["trades"] != 2 || result.Created["strategies"] != 1 {
+		t.Fatalf("restore created %v", result.Created)
+	}
+
+	source, restored := tradesOf(t, db, users[0]), tradesOf(t, db, users[1])
+	for symbol, original := range source {
+		copied, ok := restored[symbol]
+		if !ok {
+			t.Fatalf("%s was not restored", symbol)
+		}
+		if copied.ID == original.ID {
+			t.Errorf("%s kept its ID %s", symbol, copied.ID)
+		}
+		if copied.EntryPrice != original.EntryPrice || copied.Quantity != original.Quantity || !copied.EntryDate.Equal(original.EntryDate) {
+			t.Errorf("%s restored as %+v, want %+v", symbol, copied, original)
+		}
+		if strings.Join(copied.Screenshots, " ") != strings.Join(original.Screenshots, " ") {
+			t.Errorf("%s screenshots restored as %v, want %v", symbol, copied.Screenshots, original.Screenshots)
+		}
+	}
+}
+
+func TestRestoreModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        RestoreMode
+		into        int // index of the user restored into
+		wantCreated map[string]int
+		wantSkipped map[string]int
+		wantDeleted map[string]int
+		wantTrades  int
+	}{
+		{
+			name:        "merge into the source skips every record",
+			mode:        RestoreModeMerge,
+			into:        0,
+			wantCreated: map[string]int{},
+			wantSkipped: map[string]int{"trades": 2, "strategies": 1, "rules": 1, "mistakes": 1},
+			wantDeleted: map[string]int{},
+			wantTrades:  2,
+		},
+		{
+			name:        "merge into another user creates every record",
+			mode:        RestoreModeMerge,
+			into:        1,
+			wantCreated: map[string]int{"trades": 2, "strategies": 1, "rules": 1, "mistakes": 1},
+			wantSkipped: map[string]int{},
+			wantDeleted: map[string]int{},
+			wantTrades:  2,
+		},
+		{
+			name:        "replace deletes the journal before loading",
+			mode:        RestoreModeReplace,
+			into:        0,
+			wantCreated: map[string]int{"trades": 2, "strategies": 1, "rules": 1, "mistakes": 1},
+			wantSkipped: map[string]int{},
+			wantDeleted: map[string]int{"trades": 2, "strategies": 1, "rules": 1, "mistakes": 1},
+			wantTrades:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db, users := newService(t)
+			seedJournal(t, db, users[0])
+
+			var archive bytes.Buffer
+			if _, err := service.Backup(&archive, users[0]); err != nil {
+				t.Fatalf("backup: %v", err)
+			}
+			result, err := service.Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), users[tt.into], tt.mode)
+			if err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+
+			for _, counts := range []struct {
+				name      string
+				got, want map[string]int
+			}{
+				{"created", result.Created, tt.wantCreated},
+				{"skipped", result.Skipped, tt.wantSkipped},
+				{"deleted", result.Deleted, tt.wantDeleted},
+			} {
+				for entity, want := range counts.want {
+					if counts.got[entity] != want {
+						t.Errorf("%s %s = %d, want %d (all: %v)", counts.name, entity, counts.got[entity], want, counts.got)
+					}
+				}
+				for entity, got := range counts.got {
+					if _, expected := counts.want[entity]; !expected && got != 0 {
+						t.Errorf("%s %s = %d, want 0", counts.name, entity, got)
+					}
+				}
+			}
+			if got := len(tradesOf(t, db, users[tt.into])); got != tt.wantTrades {
+				t.Errorf("user has %d trades after restore, want %d", got, tt.wantTrades)
+			}
+		})
+	}
+}
+
+func TestRestoreRelinksAlgorithmTrades(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mode RestoreMode
+		into int
+	}{
+		{"replace", RestoreModeReplace, 0},
+		{"merge into another user", RestoreModeMerge, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db, users := newService(t)
+			conn := db.GetConnection()
+			now := time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)
+
+			algo := &data.Algorithm{
+				ID: utils.GenerateID(), UserID: users[0], Name: "Paper", Status: data.AlgorithmStatusDraft,
+				Symbol: "INFY", Timeframe: data.Timeframe1m, ExecutionMode: data.ExecutionModePaperTrading,
+				State: map[string]interface{}{}, Version: 1, CreatedAt: now, UpdatedAt: now,
+			}
+			if err := repos.NewAlgorithmRepository(conn).CreateAlgorithm(algo); err != nil {
+				t.Fatalf("create algorithm: %v", err)
+			}
+			trade := &data.Trade{
+				ID: utils.GenerateID(), UserID: users[0], Symbol: "INFY", EntryPrice: 1500, Quantity: 10, TotalAmount: 15000,
+				MarketType: data.MarketTypeIndian, Direction: data.TradeDirectionLong, OutcomeSummary: data.OutcomeSummaryProfitable,
+				EntryDate: now, CreatedAt: now, UpdatedAt: now, AlgorithmID: &algo.ID,
+			}
+			if err := repos.NewTradeRepository(conn).CreateTrade(trade); err != nil {
+				t.Fatalf("create trade: %v", err)
+			}
+
+			var archive bytes.Buffer
+			manifest, err := service.Backup(&archive, users[0])
+			if err != nil {
+				t.Fatalf("backup: %v", err)
+			}
+			if len(manifest.Excluded) == 0 {
+				t.Errorf("manifest does not list the data it excludes")
+			}
+			if _, err := service.Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), users[tt.into], tt.mode); err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+
+			restored, err := repos.NewAlgorithmRepository(conn).GetAllAlgorithmsByUser(users[tt.into])
+			if err != nil || len(restored) != 1 {
+				t.Fatalf("user has algorithms %v (error %v), want one", restored, err)
+			}
+			got := tradesOf(t, db, users[tt.into])["INFY"]
+			if got == nil || got.AlgorithmID == nil || *got.AlgorithmID != restored[0].ID {
+				t.Fatalf("restored trade links algorithm %v, want %s", got.AlgorithmID, restored[0].ID)
+			}
+		})
+	}
+}
+
+func TestMergeRestoreKeepsSplitBrokerTrades(t *testing.T) {
+	service, db, users := newService(t)
+	conn := db.GetConnection()
+
+	// A partial exit splits one broker order into two round trips that share its order IDs
+	broker := data.TradingBrokerDhan
+	orderID, exchangeOrderID := "ORD-7", "EX-7"
+	entry := time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)
+	for i, quantity := range []int{6, 4} {
+		exit := entry.Add(time.Duration(i+1) * time.Hour)
+		trade := &data.Trade{
+			ID: utils.GenerateID(), UserID: users[0], Symbol: "SBIN", EntryPrice: 600, Quantity: quantity,
+			TotalAmount: 600 * float64(quantity), MarketType: data.MarketTypeIndian, Direction: data.TradeDirectionLong,
+			OutcomeSummary: data.OutcomeSummaryProfitable, EntryDate: entry, ExitDate: &exit,
+			TradingBroker: &broker, OrderID: &orderID, ExchangeOrderID: &exchangeOrderID,
+			CreatedAt: entry, UpdatedAt: entry,
+		}
+		if err := repos.NewTradeRepository(conn).CreateTrade(trade); err != nil {
+			t.Fatalf("create trade: %v", err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if _, err := service.Backup(&archive, users[0]); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	for _, tt := range []struct {
+		into                     int
+		wantCreated, wantSkipped int
+	}{
+		{into: 1, wantCreated: 2},
+		{into: 0, wantSkipped: 2},
+	} {
+		result, err := service.Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), users[tt.into], RestoreModeMerge)
+		if err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if result.Created["trades"] != tt.wantCreated || result.Skipped["trades"] != tt.wantSkipped {
+			t.Errorf("merge into user %d created %d and skipped %d trades, want %d and %d",
+				tt.into, result.Created["trades"], result.Skipped["trades"], tt.wantCreated, tt.wantSkipped)
+		}
+	}
+}
+
+// seedHistory gives a user a paper trading algorithm with two versions, a run, a backtest, a
+// paper account holding an open journal trade, and one broker fill, order and position
+func seedHistory(t *testing.T, db *data.DB, userID int) {
+	t.Helper()
+	conn := db.GetConnection()
+	now := time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)
+
+	algo := &data.Algorithm{
+		ID: utils.GenerateID(), UserID: userID, Name: "Paper", Code: "def algorithm(data, context):\n    pass\n",
+		Status: data.AlgorithmStatusDraft, Symbol: "INFY", Timeframe: data.Timeframe1m,
+		ExecutionMode: data.ExecutionModePaperTrading, State: map[string]interface{}{}, Version: 2, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repos.NewAlgorithmRepository(conn).CreateAlgorithm(algo); err != nil {
+		t.Fatalf("create algorithm: %v", err)
+	}
+	for _, version := range []int{1, 2} {
+		if err := repos.NewAlgorithmVersionRepository(conn).CreateVersion(&data.AlgorithmVersion{
+			ID: utils.GenerateID(), AlgorithmID: algo.ID, UserID: userID, Version: version, Code: algo.Code,
+			AuthorID: userID, Message: "v" + strconv.Itoa(version), CreatedAt: now,
+		}); err != nil {
+			t.Fatalf("create version: %v", err)
+		}
+	}
+	signal := "BUY"
+	if err := repos.NewAlgorithmRunRepository(conn).CreateRun(&data.AlgorithmRun{
+		ID: utils.GenerateID(), AlgorithmID: algo.ID, UserID: userID, Source: data.AlgorithmRunSourcePaper,
+		Status: data.AlgorithmRunStatusSucceeded, Symbol: "INFY", Signal: &signal, CreatedAt: now,
+	}); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := repos.NewBacktestRepository(conn).CreateBacktest(&data.Backtest{
+		ID: utils.GenerateID(), AlgorithmID: algo.ID, UserID: userID, Symbol: "INFY", Timeframe: data.Timeframe1m,
+		Status: data.BacktestStatusCompleted, Bars: 10, EquityCurve: []data.EquityPoint{{Timestamp: now, Equity: 100000}},
+		CreatedAt: now,
+	}); err != nil {
+		t.Fatalf("create backtest: %v", err)
+	}
+
+	trade := &data.Trade{
+		ID: utils.GenerateID(), UserID: userID, Symbol: "INFY", EntryPrice: 1500, Quantity: 10, TotalAmount: 15000,
+		MarketType: data.MarketTypeIndian, Direction: data.TradeDirectionLong, OutcomeSummary: data.OutcomeSummaryProfitable,
+		EntryDate: now, CreatedAt: now, UpdatedAt: now, AlgorithmID: &algo.ID,
+	}
+	if err := repos.NewTradeRepository(conn).CreateTrade(trade); err != nil {
+		t.Fatalf("create trade: %v", err)
+	}
+	if err := repos.NewPaperAccountRepository(conn).SaveAccount(&data.PaperAccount{
+		AlgorithmID: algo.ID, UserID: userID, Account: json.RawMessage(`{"cash":85000}`),
+		OpenTrades: map[string]string{"INFY": trade.ID}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("save paper account: %v", err)
+	}
+
+	orderID := "ORD-9"
+	if err := repos.NewBrokerFillRepository(conn).CreateFill(&data.BrokerFill{
+		ID: utils.GenerateID(), UserID: userID, TradingBroker: data.TradingBrokerZerodha, TradeID: "FILL-9", OrderID: &orderID,
+		Symbol: "INFY", Side: "buy", Quantity: 10, Price: 1500, FillTime: now, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("create fill: %v", err)
+	}
+	order := &data.BrokerOrder{
+		ID: utils.GenerateID(), UserID: userID, TradingBroker: data.TradingBrokerZerodha, OrderID: orderID,
+		Symbol: "INFY", Side: "buy", Quantity: 10, FilledQuantity: 10, Status: "filled", BrokerStatus: "COMPLETE",
+		PlacedAt: now, LastUpdatedAt: now, CreatedAt: now, UpdatedAt: now,
+	}
+	orders := repos.NewBrokerOrderRepository(conn)
+	if err := orders.CreateOrder(order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	for i, status := range []string{"OPEN", "COMPLETE"} {
+		if _, err := orders.CreateEvent(&data.BrokerOrderEvent{
+			ID: utils.GenerateID(), BrokerOrderID: order.ID, UserID: userID, Status: strings.ToLower(status), BrokerStatus: status,
+			Quantity: 10, FilledQuantity: 10 * i, EventTime: now.Add(time.Duration(i) * time.Second), CreatedAt: now,
+		}); err != nil {
+			t.Fatalf("create order event: %v", err)
+		}
+	}
+	if err := repos.NewBrokerPositionRepository(conn).CreatePosition(&data.BrokerPosition{
+		ID: utils.GenerateID(), UserID: userID, TradingBroker: data.TradingBrokerZerodha, Kind: data.BrokerPositionKindHolding,
+		Symbol: "INFY", Quantity: 10, AveragePrice: 1500, LastPrice: 1510, SyncedAt: now,
+	}); err != nil {
+		t.Fatalf("create position: %v", err)
+	}
+}
+
+// checkHistory fails unless the user holds exactly the history seedHistory creates, linked to
+// the user's own algorithm and trade
+func checkHistory(t *testing.T, db *data.DB, userID int) {
+	t.Helper()
+	conn := db.GetConnection()
+
+	algorithms, err := repos.NewAlgorithmRepository(conn).GetAllAlgorithmsByUser(userID)
+	if err != nil || len(algorithms) != 1 {
+		t.Fatalf("user has algorithms %v (error %v), want one", algorithms, err)
+	}
+	algoID := algorithms[0].ID
+
+	versions, err := repos.NewAlgorithmVersionRepository(conn).GetVersions(algoID, userID, 10, 0)
+	if err != nil || len(versions) != 2 || versions[0].Message != "v2" || versions[1].Message != "v1" {
+		t.Errorf("algorithm has versions %+v (error %v), want v2 and v1", versions, err)
+	}
+	if runs, err := repos.NewAlgorithmRunRepository(conn).GetRuns(algoID, userID, repos.AlgorithmRunFilter{}, 10, 0); err != nil || len(runs) != 1 {
+		t.Errorf("algorithm has %d runs (error %v), want 1", len(runs), err)
+	}
+	backtests, err := repos.NewBacktestRepository(conn).GetAllBacktestsByUser(userID)
+	if err != nil || len(backtests) != 1 || backtests[0].AlgorithmID != algoID || len(backtests[0].EquityCurve) != 1 {
+		t.Errorf("user has backtests %+v (error %v), want one of %s with its equity curve", backtests, err, algoID)
+	}
+	account, err := repos.NewPaperAccountRepository(conn).GetAccount(algoID, userID)
+	trade := tradesOf(t, db, userID)["INFY"]
+	if err != nil || account == nil || trade == nil || account.OpenTrades["INFY"] != trade.ID {
+		t.Errorf("paper account is %+v (error %v), want its open INFY position on the restored trade", account, err)
+	}
+
+	zerodha := data.TradingBrokerZerodha
+	fills, err := repos.NewBrokerFillRepository(conn).GetAllBrokerFillsByUser(userID)
+	if err != nil || len(fills) != 1 || fills[0].TradeID != "FILL-9" {
+		t.Errorf("user has fills %+v (error %v), want FILL-9", fills, err)
+	}
+	orders := repos.NewBrokerOrderRepository(conn)
+	found, err := orders.GetOrders(userID, repos.BrokerOrderFilter{TradingBroker: &zerodha})
+	if err == nil {
+		err = orders.LoadEvents(userID, found)
+	}
+	if err != nil || len(found) != 1 || found[0].OrderID != "ORD-9" || len(found[0].Events) != 2 {
+		t.Errorf("user has orders %+v (error %v), want ORD-9 with two events", found, err)
+	}
+	if positions, err := repos.NewBrokerPositionRepository(conn).GetSnapshot(userID, zerodha); err != nil || len(positions) != 1 {
+		t.Errorf("user has %d Zerodha positions (error %v), want 1", len(positions), err)
+	}
+}
+
+func TestRestoreKeepsBrokerAndAlgorithmHistory(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		mode        RestoreMode
+		into        int
+		wantSkipped map[string]int
+	}{
+		{"replace", RestoreModeReplace, 0, map[string]int{}},
+		{"merge into another user", RestoreModeMerge, 1, map[string]int{}},
+		{"merge into the source", RestoreModeMerge, 0, map[string]int{
+			"algorithms": 1, "algorithm_versions": 2, "algorithm_runs": 1, "backtests": 1, "paper_accounts": 1,
+			"broker_fills": 1, "broker_orders": 1, "broker_order_events": 2, "broker_positions": 1,
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db, users := newService(t)
+			seedHistory(t, db, users[0])
+
+			var archive bytes.Buffer
+			if _, err := service.Backup(&archive, users[0]); err != nil {
+				t.Fatalf("backup: %v", err)
+			}
+			result, err := service.Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), users[tt.into], tt.mode)
+			if err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			for entity, want := range tt.wantSkipped {
+				if result.Skipped[entity] != want {
+					t.Errorf("skipped %s = %d, want %d (all: %v)", entity, result.Skipped[entity], want, result.Skipped)
+				}
+			}
+			checkHistory(t, db, users[tt.into])
+		})
+	}
+}
+
+func TestReplaceRestoreOfVersion1ArchiveKeepsBrokerHistory(t *testing.T) {
+	service, db, users := newService(t)
+	seedHistory(t, db, users[0])
+
+	var archive bytes.Buffer
+	if _, err := service.Backup(&archive, users[0]); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	v1 := downgrade(t, archive.Bytes())
+	result, err := service.Restore(bytes.NewReader(v1), int64(len(v1)), users[0], RestoreModeReplace)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	for _, entity := range []string{"broker_fills", "broker_orders", "broker_order_events", "broker_positions"} {
+		if deleted, ok := result.Deleted[entity]; ok {
+			t.Errorf("restore of an archive without broker history deleted %d %s", deleted, entity)
+		}
+	}
+	if fills, err := repos.NewBrokerFillRepository(db.GetConnection()).GetAllBrokerFillsByUser(users[0]); err != nil || len(fills) != 1 {
+		t.Errorf("user has %d fills after the restore (error %v), want 1", len(fills), err)
+	}
+}
+
+// downgrade rewrites an archive as schema version 1, without the entries version 2 added
+func downgrade(t *testing.T, archive []byte) []byte {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	added := map[string]bool{
+		versionsFile: true, runsFile: true, backtestsFile: true, paperFile: true,
+		fillsFile: true, ordersFile: true, positionsFile: true,
+	}
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for _, f := range reader.File {
+		if added[f.Name] {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		if f.Name == manifestFile {
+			var manifest Manifest
+			if err := json.Unmarshal(content, &manifest); err != nil {
+				t.Fatalf("decode manifest: %v", err)
+			}
+			manifest.SchemaVersion = 1
+			if content, err = json.Marshal(manifest); err != nil {
+				t.Fatalf("encode manifest: %v", err)
+			}
+		}
+		entry, err := writer.Create(f.Name)
+		if err == nil {
+			_, err = entry.Write(content)
+		}
+		if err != nil {
+			t.Fatalf("write %s: %v", f.Name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestRestoreRejectsInvalidArchives(t *testing.T) {
+	service, _, users := newService(t)
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"empty", nil},
+		{"not a zip", []byte("journal")},
+	}
+	for _, tt := range tests {
+		if _, err := service.Restore(bytes.NewReader(tt.archive), int64(len(tt.archive)), users[0], RestoreModeMerge); err == nil {
+			t.Errorf("%s archive restored without error", tt.name)
+		}
+	}
+}
+
+func TestParseRestoreMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RestoreMode
+		wantErr bool
+	}{
+		{value: "merge", want: RestoreModeMerge},
+		{value: " Replace ", want: RestoreModeReplace},
+		{value: "", wantErr: true},
+		{value: "overwrite", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestoreMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRestoreMode(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
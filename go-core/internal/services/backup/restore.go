@@ -0,0 +1,526 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// RestoreMode controls how an archive is applied to an existing user
+type RestoreMode string
+
+const (
+	// RestoreModeMerge adds archived records the user does not already have
+	RestoreModeMerge RestoreMode = "merge"
+	// RestoreModeReplace deletes the user's journal before loading the archive
+	RestoreModeReplace RestoreMode = "replace"
+)
+
+// ParseRestoreMode validates a restore mode name
+func ParseRestoreMode(value string) (RestoreMode, error) {
+	switch mode := RestoreMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case RestoreModeMerge, RestoreModeReplace:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported restore mode %q (use merge or replace)", value)
+	}
+}
+
+// RestoreResult summarises what a restore changed
+type RestoreResult struct {
+	Mode          RestoreMode    `json:"mode"`
+	SchemaVersion int            `json:"schema_version"`
+	SourceUserID  int            `json:"source_user_id"`
+	Created       map[string]int `json:"created"`
+	Skipped       map[string]int `json:"skipped"`
+	Deleted       map[string]int `json:"deleted"`
+}
+
+// Restore validates an archive and loads it into an existing user's journal
+// Every record gets a fresh ID, so archives can be restored into any user on any machine.
+// In merge mode records matching an existing one by natural key are skipped.
+// The whole restore runs in one transaction; a failure leaves the journal untouched.
+func (s *Service) Restore(r io.ReaderAt, size int64, userID int, mode RestoreMode) (*RestoreResult, error) {
+	contents, err := Read(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repos.NewUserRepository(s.db, s.keyring).GetUserByID(strconv.Itoa(userID)); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	run := &restorer{
+		userID:     userID,
+		trades:     repos.NewTradeRepository(s.db).WithTx(tx),
+		strategies: repos.NewStrategyRepository(s.db).WithTx(tx),
+		rules:      repos.NewRuleRepository(s.db).WithTx(tx),
+		mistakes:   repos.NewMistakeRepository(s.db).WithTx(tx),
+		algorithms: repos.NewAlgorithmRepository(s.db).WithTx(tx),
+		versions:   repos.NewAlgorithmVersionRepository(s.db).WithTx(tx),
+		runs:       repos.NewAlgorithmRunRepository(s.db).WithTx(tx),
+		backtests:  repos.NewBacktestRepository(s.db).WithTx(tx),
+		paper:      repos.NewPaperAccountRepository(s.db).WithTx(tx),
+		fills:      repos.NewBrokerFillRepository(s.db).WithTx(tx),
+		positions:  repos.NewBrokerPositionRepository(s.db).WithTx(tx),
+		orders:     repos.NewBrokerOrderRepository(s.db).WithTx(tx),
+		result: &RestoreResult{
+			Mode:          mode,
+			SchemaVersion: contents.Manifest.SchemaVersion,
+			SourceUserID:  contents.Manifest.SourceUserID,
+			Created:       map[string]int{},
+			Skipped:       map[string]int{},
+			Deleted:       map[string]int{},
+		},
+	}
+
+	if mode == RestoreModeReplace {
+		if err := run.clear(contents.Manifest.SchemaVersion); err != nil {
+			return nil, err
+		}
+	}
+	if err := run.load(contents, mode == RestoreModeMerge); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	utils.LogInfo("Journal restored from backup", map[string]interface{}{
+		"user_id":        userID,
+		"mode":           mode,
+		"schema_version": contents.Manifest.SchemaVersion,
+		"created":        run.result.Created,
+		"skipped":        run.result.Skipped,
+	})
+	return run.result, nil
+}
+
+// restorer applies one archive inside a transaction
+type restorer struct {
+	userID     int
+	trades     *repos.TradeRepository
+	strategies *repos.StrategyRepository
+	rules      *repos.RuleRepository
+	mistakes   *repos.MistakeRepository
+	algorithms *repos.AlgorithmRepository
+	versions   *repos.AlgorithmVersionRepository
+	runs       *repos.AlgorithmRunRepository
+	backtests  *repos.BacktestRepository
+	paper      *repos.PaperAccountRepository
+	fills      *repos.BrokerFillRepository
+	positions  *repos.BrokerPositionRepository
+	orders     *repos.BrokerOrderRepository
+	result     *RestoreResult
+}
+
+// clear removes the user's existing journal for a replace restore
+// Broker history is only replaced by archives that hold it; a sync cannot rebuild it for brokers
+// that report just today's trades, so version 1 archives leave it in place.
+func (r *restorer) clear(schemaVersion int) error {
+	type deletion struct {
+		name string
+		fn   func(int) (int64, error)
+	}
+	deletes := []deletion{
+		{"trades", r.trades.DeleteAllTradesByUser},
+		{"strategies", r.strategies.DeleteAllStrategiesByUser},
+		{"rules", r.rules.DeleteAllRulesByUser},
+		{"mistakes", r.mistakes.DeleteAllMistakesByUser},
+		{"algorithms", r.algorithms.DeleteAllAlgorithmsByUser},
+	}
+	if schemaVersion >= 2 {
+		deletes = append(deletes,
+			deletion{"broker_fills", r.fills.DeleteAllBrokerFillsByUser},
+			deletion{"broker_positions", r.positions.DeleteAllBrokerPositionsByUser},
+			deletion{"broker_order_events", r.orders.DeleteAllBrokerOrderEventsByUser},
+			deletion{"broker_orders", r.orders.DeleteAllBrokerOrdersByUser},
+		)
+	}
+	for _, d := range deletes {
+		deleted, err := d.fn(r.userID)
+		if err != nil {
+			return err
+		}
+		r.result.Deleted[d.name] = int(deleted)
+	}
+	return nil
+}
+
+// load inserts archived records under new IDs, skipping duplicates when merging
+func (r *restorer) load(contents *Contents, merge bool) error {
+	existing, err := r.existingKeys(merge)
+	if err != nil {
+		return err
+	}
+	algorithmIDs, err := r.existingAlgorithmIDs(merge)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range contents.Strategies {
+		if !r.claim(existing, "strategies", strategyKey(s)) {
+			continue
+		}
+		s.ID, s.UserID = utils.GenerateID(), r.userID
+		if err := r.strategies.CreateStrategy(s); err != nil {
+			return err
+		}
+	}
+	for _, rule := range contents.Rules {
+		if !r.claim(existing, "rules", ruleKey(rule)) {
+			continue
+		}
+		rule.ID, rule.UserID = utils.GenerateID(), r.userID
+		if err := r.rules.CreateRule(rule); err != nil {
+			return err
+		}
+	}
+	for _, m := range contents.Mistakes {
+		if !r.claim(existing, "mistakes", mistakeKey(m)) {
+			continue
+		}
+		m.ID, m.UserID = utils.GenerateID(), r.userID
+		if err := r.mistakes.CreateMistake(m); err != nil {
+			return err
+		}
+	}
+	// restoredIDs maps archived algorithm IDs to the algorithms their trades now belong to;
+	// createdIDs holds only the algorithms this restore created, which take the archived history
+	restoredIDs := make(map[string]string, len(contents.Algorithms))
+	createdIDs := make(map[string]string, len(contents.Algorithms))
+	versions := make(map[string][]*data.AlgorithmVersion)
+	for _, v := range contents.Versions {
+		versions[v.AlgorithmID] = append(versions[v.AlgorithmID], v)
+	}
+	for _, a := range contents.Algorithms {
+		archivedID, key := a.ID, algorithmKey(a)
+		if !r.claim(existing, "algorithms", key) {
+			if id, ok := algorithmIDs[key]; ok {
+				restoredIDs[archivedID] = id
+			}
+			r.result.Skipped["algorithm_versions"] += len(versions[archivedID])
+			continue
+		}
+		a.ID, a.UserID = utils.GenerateID(), r.userID
+		restoredIDs[archivedID], createdIDs[archivedID], algorithmIDs[key] = a.ID, a.ID, a.ID
+		if err := r.algorithms.CreateAlgorithm(a); err != nil {
+			return err
+		}
+		if err := r.loadVersions(a, versions[archivedID]); err != nil {
+			return err
+		}
+	}
+	// tradeIDs maps archived trade IDs to restored ones, for the open trades of paper accounts
+	tradeIDs := make(map[string]string, len(contents.Trades))
+	for _, t := range contents.Trades {
+		if !r.claim(existing, "trades", tradeKey(t)) {
+			continue
+		}
+		archivedID := t.ID
+		t.ID, t.UserID = utils.GenerateID(), r.userID
+		tradeIDs[archivedID] = t.ID
+		if t.AlgorithmID != nil {
+			// Trades of an algorithm missing from the archive keep no link rather than a dangling one
+			id, ok := restoredIDs[*t.AlgorithmID]
+			t.AlgorithmID = nil
+			if ok {
+				t.AlgorithmID = &id
+			}
+		}
+		for i, value := range t.Screenshots {
+			if name, ok := screenshotName(value); ok {
+				t.Screenshots[i] = encodeDataURI(name, contents.Screenshots[name])
+			}
+		}
+		if err := r.trades.CreateTrade(t); err != nil {
+			return err
+		}
+	}
+	if err := r.loadAlgorithmHistory(contents, createdIDs, tradeIDs); err != nil {
+		return err
+	}
+	return r.loadBrokerHistory(contents, existing)
+}
+
+// loadVersions stores the archived history of a restored algorithm
+// Archives from before version history was kept start the history at the current version.
+func (r *restorer) loadVersions(a *data.Algorithm, archived []*data.AlgorithmVersion) error {
+	if len(archived) == 0 {
+		archived = []*data.AlgorithmVersion{{
+			Version:   a.Version,
+			Code:      a.Code,
+			Graph:     a.Graph,
+			Config:    a.Config,
+			Message:   "Restored from backup",
+			CreatedAt: time.Now().UTC(),
+		}}
+	}
+	for _, v := range archived {
+		// Author IDs from the source database mean nothing here; the restoring user owns the history
+		v.ID, v.AlgorithmID, v.UserID, v.AuthorID = utils.GenerateID(), a.ID, r.userID, r.userID
+		if err := r.versions.CreateVersion(v); err != nil {
+			return err
+		}
+		r.result.Created["algorithm_versions"]++
+	}
+	return nil
+}
+
+// loadAlgorithmHistory stores the runs, backtests and paper accounts of algorithms this restore created
+// History of an algorithm skipped while merging stays with the archive, as the existing algorithm has its own.
+func (r *restorer) loadAlgorithmHistory(contents *Contents, createdIDs, tradeIDs map[string]string) error {
+	for _, run := range contents.Runs {
+		id, ok := createdIDs[run.AlgorithmID]
+		if !ok {
+			r.result.Skipped["algorithm_runs"]++
+			continue
+		}
+		run.ID, run.AlgorithmID, run.UserID = utils.GenerateID(), id, r.userID
+		if err := r.runs.CreateRun(run); err != nil {
+			return err
+		}
+		r.result.Created["algorithm_runs"]++
+	}
+	for _, b := range contents.Backtests {
+		id, ok := createdIDs[b.AlgorithmID]
+		if !ok {
+			r.result.Skipped["backtests"]++
+			continue
+		}
+		b.ID, b.AlgorithmID, b.UserID = utils.GenerateID(), id, r.userID
+		if err := r.backtests.CreateBacktest(b); err != nil {
+			return err
+		}
+		r.result.Created["backtests"]++
+	}
+	for _, p := range contents.Paper {
+		id, ok := createdIDs[p.AlgorithmID]
+		if !ok {
+			r.result.Skipped["paper_accounts"]++
+			continue
+		}
+		p.AlgorithmID, p.UserID = id, r.userID
+		// Open positions follow their journal trades; a trade skipped while merging leaves its position unlinked
+		openTrades := make(map[string]string, len(p.OpenTrades))
+		for symbol, tradeID := range p.OpenTrades {
+			if restored, ok := tradeIDs[tradeID]; ok {
+				openTrades[symbol] = restored
+			}
+		}
+		p.OpenTrades = openTrades
+		if err := r.paper.SaveAccount(p); err != nil {
+			return err
+		}
+		r.result.Created["paper_accounts"]++
+	}
+	return nil
+}
+
+// loadBrokerHistory stores the fill ledger, order book and position snapshots
+// Fills and orders are matched by their broker IDs when merging. A position snapshot is only
+// restored for brokers the user has no snapshot of, since each sync replaces it wholesale.
+func (r *restorer) loadBrokerHistory(contents *Contents, existing map[string]map[string]bool) error {
+	for _, f := range contents.Fills {
+		if !r.claim(existing, "broker_fills", fillKey(f)) {
+			continue
+		}
+		f.ID, f.UserID = utils.GenerateID(), r.userID
+		if err := r.fills.CreateFill(f); err != nil {
+			return err
+		}
+	}
+	for _, o := range contents.Orders {
+		if !r.claim(existing, "broker_orders", orderKey(o)) {
+			r.result.Skipped["broker_order_events"] += len(o.Events)
+			continue
+		}
+		o.ID, o.UserID = utils.GenerateID(), r.userID
+		if err := r.orders.CreateOrder(o); err != nil {
+			return err
+		}
+		for _, e := range o.Events {
+			e.ID, e.BrokerOrderID, e.UserID = utils.GenerateID(), o.ID, r.userID
+			created, err := r.orders.CreateEvent(e)
+			if err != nil {
+				return err
+			}
+			if created {
+				r.result.Created["broker_order_events"]++
+			} else {
+				r.result.Skipped["broker_order_events"]++
+			}
+		}
+	}
+	for _, p := range contents.Positions {
+		if existing != nil && existing["broker_positions"][string(p.TradingBroker)] {
+			r.result.Skipped["broker_positions"]++
+			continue
+		}
+		p.ID, p.UserID = utils.GenerateID(), r.userID
+		if err := r.positions.CreatePosition(p); err != nil {
+			return err
+		}
+		r.result.Created["broker_positions"]++
+	}
+	return nil
+}
+
+// claim reports whether a record should be inserted
+// When merging it also remembers the key, so duplicates inside the archive are skipped too
+func (r *restorer) claim(existing map[string]map[string]bool, entity, key string) bool {
+	if existing != nil {
+		if existing[entity][key] {
+			r.result.Skipped[entity]++
+			return false
+		}
+		existing[entity][key] = true
+	}
+	r.result.Created[entity]++
+	return true
+}
+
+// existingKeys collects natural keys of the user's current journal; nil when not merging
+func (r *restorer) existingKeys(merge bool) (map[string]map[string]bool, error) {
+	if !merge {
+		return nil, nil
+	}
+
+	keys := map[string]map[string]bool{
+		"trades": {}, "strategies": {}, "rules": {}, "mistakes": {}, "algorithms": {},
+		"broker_fills": {}, "broker_orders": {}, "broker_positions": {},
+	}
+
+	strategies, err := r.strategies.GetAllStrategiesByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strategies {
+		keys["strategies"][strategyKey(s)] = true
+	}
+	rules, err := r.rules.GetAllRulesByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		keys["rules"][ruleKey(rule)] = true
+	}
+	mistakes, err := r.mistakes.GetAllMistakesByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mistakes {
+		keys["mistakes"][mistakeKey(m)] = true
+	}
+	algorithms, err := r.algorithms.GetAllAlgorithmsByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range algorithms {
+		keys["algorithms"][algorithmKey(a)] = true
+	}
+	err = r.trades.ForEachTrade(r.userID, repos.TradeFilter{}, func(t *data.Trade) error {
+		keys["trades"][tradeKey(t)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fills, err := r.fills.GetAllBrokerFillsByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fills {
+		keys["broker_fills"][fillKey(f)] = true
+	}
+	orders, err := r.orders.GetOrders(r.userID, repos.BrokerOrderFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		keys["broker_orders"][orderKey(o)] = true
+	}
+	// Positions are keyed by broker: a broker's snapshot is kept or restored as a whole
+	positions, err := r.positions.GetAllBrokerPositionsByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		keys["broker_positions"][string(p.TradingBroker)] = true
+	}
+
+	return keys, nil
+}
+
+// existingAlgorithmIDs maps the user's algorithms by natural key, so merged trades can
+// follow an archived algorithm to the existing one it was skipped for
+func (r *restorer) existingAlgorithmIDs(merge bool) (map[string]string, error) {
+	ids := map[string]string{}
+	if !merge {
+		return ids, nil
+	}
+	algorithms, err := r.algorithms.GetAllAlgorithmsByUser(r.userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range algorithms {
+		ids[algorithmKey(a)] = a.ID
+	}
+	return ids, nil
+}
+
+func strategyKey(s *data.Strategy) string {
+	return strings.ToLower(s.Name)
+}
+
+func ruleKey(r *data.Rule) string {
+	return string(r.Category) + "|" + strings.ToLower(r.Name)
+}
+
+func mistakeKey(m *data.Mistake) string {
+	return string(m.Category) + "|" + strings.ToLower(m.Name)
+}
+
+func algorithmKey(a *data.Algorithm) string {
+	return strings.ToLower(a.Name)
+}
+
+func fillKey(f *data.BrokerFill) string {
+	return string(f.TradingBroker) + "|" + f.TradeID
+}
+
+func orderKey(o *data.BrokerOrder) string {
+	return string(o.TradingBroker) + "|" + o.OrderID
+}
+
+// tradeKey identifies imported trades by broker order IDs and manual trades by their entry details
+// One broker order split into several round trips shares its order IDs, so broker keys also
+// carry the dates, quantity and entry price telling the round trips apart.
+func tradeKey(t *data.Trade) string {
+	if t.TradingBroker != nil && (t.ExchangeOrderID != nil || t.OrderID != nil) {
+		var exitDate string
+		if t.ExitDate != nil {
+			exitDate = t.ExitDate.UTC().Format(time.RFC3339)
+		}
+		return fmt.Sprintf("broker|%s|%s|%s|%s|%s|%d|%s",
+			*t.TradingBroker, utils.StringValue(t.ExchangeOrderID), utils.StringValue(t.OrderID),
+			t.EntryDate.UTC().Format(time.RFC3339), exitDate, t.Quantity,
+			strconv.FormatFloat(t.EntryPrice, 'f', -1, 64))
+	}
+	return fmt.Sprintf("manual|%s|%s|%s|%s|%d",
+		strings.ToUpper(t.Symbol), t.Direction, t.EntryDate.UTC().Format(time.RFC3339),
+		strconv.FormatFloat(t.EntryPrice, 'f', -1, 64), t.Quantity)
+}
@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// decodeDataURI splits an inline screenshot ("data:image/png;base64,...") into its bytes and extension
+// Screenshots stored as plain URLs are not data URIs and stay as references in trades.json
+func decodeDataURI(value string) ([]byte, string, bool) {
+	if !strings.HasPrefix(value, "data:") {
+		return nil, "", false
+	}
+	meta, payload, found := strings.Cut(strings.TrimPrefix(value, "data:"), ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return nil, "", false
+	}
+
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, "", false
+	}
+
+	extension := ".bin"
+	if extensions, err := mime.ExtensionsByType(strings.TrimSuffix(meta, ";base64")); err == nil && len(extensions) > 0 {
+		extension = extensions[0]
+	}
+	return content, extension, true
+}
+
+// encodeDataURI turns an archived screenshot back into the inline form the journal stores
+func encodeDataURI(name string, content []byte) string {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(content))
+}
+
+// screenshotEntry names the archive entry for the index-th screenshot of a trade
+func screenshotEntry(tradeID string, index int, extension string) string {
+	return fmt.Sprintf("%s%s-%d%s", screenshotsDir, tradeID, index+1, extension)
+}
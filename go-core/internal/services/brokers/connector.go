@@ -0,0 +1,131 @@
+package brokers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+)
+
+var (
+	// ErrNotSupported is returned when a connector lacks a capability
+	ErrNotSupported = errors.New("not supported by this broker")
+	// ErrInvalidToken is returned when the broker rejects the access token
+	ErrInvalidToken = errors.New("invalid or expired access token")
+)
+
+// AuthFlow names how a broker issues access tokens
+type AuthFlow string
+
+const (
+	// AuthFlowConsent is Dhan's consent flow: generate consent, browser login, consume tokenId
+	AuthFlowConsent AuthFlow = "consent"
+	// AuthFlowRequestToken is Kite Connect's flow: browser login, exchange request_token for a session
+	AuthFlowRequestToken AuthFlow = "request_token"
+)
+
+// Capabilities describes what a broker connector supports
+type Capabilities struct {
+	Broker       data.TradingBroker `json:"broker"`
+	AuthFlow     AuthFlow           `json:"auth_flow"`
+	TokenRefresh bool               `json:"token_refresh"` // the access token can be renewed without a new login
+	TradeHistory bool               `json:"trade_history"` // trades can be fetched for past date ranges, not just today
+	Positions    bool               `json:"positions"`
+	Holdings     bool               `json:"holdings"`
+	Funds        bool               `json:"funds"`
+	Orders       bool               `json:"orders"`        // the day's order book can be fetched
+	OrderHistory bool               `json:"order_history"` // orders carry every status transition, not just the latest state
+}
+
+// AuthStart is the first step of a broker login
+type AuthStart struct {
+	LoginURL string `json:"login_url"` // where the user signs in to the broker
+}
+
+// Position is an open intraday or carry-forward position at the broker
+type Position struct {
+	Symbol       string  `json:"symbol"`
+	Exchange     string  `json:"exchange"`
+	SecurityID   string  `json:"security_id,omitempty"` // broker's instrument identifier
+	ProductType  string  `json:"product_type"`
+	Quantity     int     `json:"quantity"` // negative for short positions
+	AveragePrice float64 `json:"average_price"`
+	LastPrice    float64 `json:"last_price"`
+	DayPnL       float64 `json:"day_pnl"`
+	PnL          float64 `json:"pnl"` // realized plus unrealized
+}
+
+// Holding is a delivery holding in the user's demat account
+type Holding struct {
+	Symbol       string  `json:"symbol"`
+	Exchange     string  `json:"exchange"`
+	SecurityID   string  `json:"security_id,omitempty"` // broker's instrument identifier
+	ISIN         string  `json:"isin,omitempty"`
+	Quantity     int     `json:"quantity"`
+	AveragePrice float64 `json:"average_price"`
+	LastPrice    float64 `json:"last_price"`
+	DayPnL       float64 `json:"day_pnl"`
+	PnL          float64 `json:"pnl"`
+}
+
+// Funds summarizes the trading account balance
+type Funds struct {
+	Available    float64 `json:"available"`
+	Utilised     float64 `json:"utilised"`
+	Collateral   float64 `json:"collateral"`
+	Withdrawable float64 `json:"withdrawable"`
+}
+
+// Connector is a live broker integration: authentication, token refresh and account data
+// Methods take the user's stored broker config; auth methods update it in place and the caller persists it.
+// Broker calls are abandoned when ctx is cancelled, including while waiting to retry.
+type Connector interface {
+	BrokerService
+
+	// Capabilities reports what the connector supports
+	Capabilities() Capabilities
+
+	// BeginAuth starts a login and returns the URL the user must visit
+	BeginAuth(ctx context.Context, config *data.BrokerConfig) (*AuthStart, error)
+
+	// CompleteAuth finishes a login with the parameters the broker redirected back with
+	CompleteAuth(ctx context.Context, config *data.BrokerConfig, params map[string]string) error
+
+	// RefreshToken renews the access token in config
+	RefreshToken(ctx context.Context, config *data.BrokerConfig) error
+
+	// FetchFills fetches executions between from and to (inclusive dates)
+	FetchFills(ctx context.Context, config *data.BrokerConfig, from, to time.Time) ([]matching.Fill, error)
+
+	// FetchPositions fetches open positions
+	FetchPositions(ctx context.Context, config *data.BrokerConfig) ([]Position, error)
+
+	// FetchHoldings fetches demat holdings
+	FetchHoldings(ctx context.Context, config *data.BrokerConfig) ([]Holding, error)
+
+	// FetchFunds fetches the account balance
+	FetchFunds(ctx context.Context, config *data.BrokerConfig) (*Funds, error)
+
+	// FetchOrders fetches the day's order book, including rejected and cancelled orders
+	FetchOrders(ctx context.Context, config *data.BrokerConfig) ([]Order, error)
+}
+
+// GetConnector returns the live connector for a broker
+func GetConnector(brokerName data.TradingBroker) (Connector, error) {
+	switch brokerName {
+	case data.TradingBrokerZerodha:
+		return NewZerodhaService(), nil
+	case data.TradingBrokerDhan:
+		return NewDhanService(), nil
+	default:
+		return nil, fmt.Errorf("unsupported broker: %s", brokerName)
+	}
+}
+
+// Connectors returns every available connector
+func Connectors() []Connector {
+	return []Connector{NewDhanService(), NewZerodhaService()}
+}
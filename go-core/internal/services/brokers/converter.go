@@ -15,13 +15,9 @@ func ConvertBrokerTradeToTrade(
 	broker data.TradingBroker,
 ) (*data.Trade, error) {
 	// Parse exchange time
-	exchangeTime, err := time.Parse("2006-01-02 15:04:05", brokerTrade.ExchangeTime)
+	exchangeTime, err := parseExchangeTime(brokerTrade.ExchangeTime)
 	if err != nil {
-		// Try alternative formats
-		exchangeTime, err = time.Parse(time.RFC3339, brokerTrade.ExchangeTime)
-		if err != nil {
-			exchangeTime = time.Now() // Fallback to current time
-		}
+		return nil, err
 	}
 
 	// Determine direction from transaction type
@@ -85,11 +81,11 @@ func ConvertBrokerTradeToTrade(
 // convertProductType converts string product type to ProductType enum
 func convertProductType(productType string) data.ProductType {
 	switch productType {
-	case "CNC":
+	case "CNC", "MTF": // Margin trading funds a delivery position
 		return data.ProductTypeCNC
-	case "MIS":
+	case "MIS", "BO", "CO": // Bracket and cover orders are intraday
 		return data.ProductTypeMIS
-	case "NRML":
+	case "NRML", "MARGIN": // Dhan's carry-forward F&O product
 		return data.ProductTypeNRML
 	case "INTRADAY":
 		return data.ProductTypeIntraday
@@ -1,31 +1,26 @@
 package brokers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
+	"net/url"
 	"time"
 
 	"go-core/internal/data"
+	"go-core/internal/services/matching"
 	"go-core/internal/utils"
 )
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // DhanService implements BrokerService for Dhan broker
-type DhanService struct{}
+type DhanService struct {
+	http *Transport
+}
 
 // NewDhanService creates a new Dhan broker service
 func NewDhanService() *DhanService {
-	return &DhanService{}
+	return &DhanService{http: transportFor(data.TradingBrokerDhan)}
 }
 
 // GetBrokerName returns the broker name
@@ -72,28 +67,36 @@ func (d *DhanService) ParseTrades(rawData []byte) ([]BrokerTrade, error) {
 
 	brokerTrades := make([]BrokerTrade, 0, len(trades))
 	for _, trade := range trades {
-		// Use customSymbol or construct symbol from other fields
-		symbol := trade.CustomSymbol
-		if symbol == "" {
-			symbol = trade.SecurityID // Fallback to security ID
-		}
-
-		brokerTrade := BrokerTrade{
-			Symbol:          symbol,
-			Quantity:        trade.TradedQuantity,
-			Price:           trade.TradedPrice,
-			TransactionType: trade.TransactionType,
-			ExchangeOrderID: trade.ExchangeOrderID,
-			OrderID:         trade.OrderID,
-			ProductType:     trade.ProductType,
-			ExchangeTime:    trade.ExchangeTime,
-		}
-		brokerTrades = append(brokerTrades, brokerTrade)
+		brokerTrades = append(brokerTrades, d.toBrokerTrade(trade))
 	}
 
 	return brokerTrades, nil
 }
 
+// toBrokerTrade maps a Dhan execution to the common broker format
+func (d *DhanService) toBrokerTrade(trade DhanTrade) BrokerTrade {
+	// Use customSymbol or construct symbol from other fields
+	symbol := trade.CustomSymbol
+	if symbol == "" {
+		symbol = trade.SecurityID // Fallback to security ID
+	}
+
+	return BrokerTrade{
+		TradeID:         trade.ExchangeTradeID,
+		Symbol:          symbol,
+		Quantity:        trade.TradedQuantity,
+		Price:           trade.TradedPrice,
+		TransactionType: trade.TransactionType,
+		ExchangeOrderID: trade.ExchangeOrderID,
+		OrderID:         trade.OrderID,
+		ProductType:     trade.ProductType,
+		ExchangeTime:    trade.ExchangeTime,
+		Exchange:        trade.ExchangeSegment,
+		SecurityID:      trade.SecurityID,
+		ISIN:            trade.ISIN,
+	}
+}
+
 // ConvertToTrade converts BrokerTrade to the internal Trade model
 func (d *DhanService) ConvertToTrade(brokerTrade BrokerTrade, userID int) (*data.Trade, error) {
 	return ConvertBrokerTradeToTrade(brokerTrade, userID, data.TradingBrokerDhan)
@@ -103,34 +106,9 @@ func (d *DhanService) ConvertToTrade(brokerTrade BrokerTrade, userID int) (*data
 // fromDate and toDate should be in YYYY-MM-DD format
 // accessToken is the Dhan API access token
 // pageNumber is the page number for pagination (starts from 0)
-func (d *DhanService) FetchTrades(accessToken, fromDate, toDate string, pageNumber int) ([]DhanTrade, error) {
-	// Get base URL from environment - check both possible env var names
-	baseURL := os.Getenv("DHAN_PROD_API")
-	if baseURL == "" {
-		baseURL = os.Getenv("DHAN_PROD_API_ENDPOINT")
-	}
-	if baseURL == "" {
-		// Default to production API (api.dhan.co) as per curl example
-		baseURL = "https://api.dhan.co/v2"
-	}
-
+func (d *DhanService) FetchTrades(ctx context.Context, accessToken, fromDate, toDate string, pageNumber int) ([]DhanTrade, error) {
 	// Build the API URL
-	url := fmt.Sprintf("%s/trades/%s/%s/%d", baseURL, fromDate, toDate, pageNumber)
-
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("access-token", accessToken)
-
-	// Make HTTP request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	url := fmt.Sprintf("%s/trades/%s/%s/%d", d.http.Config().APIURL, fromDate, toDate, pageNumber)
 
 	utils.LogInfo("Fetching trades from Dhan API", map[string]interface{}{
 		"url":       url,
@@ -139,33 +117,11 @@ func (d *DhanService) FetchTrades(accessToken, fromDate, toDate string, pageNumb
 		"page":      pageNumber,
 	})
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Dhan API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("dhan API returned status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := d.http.Do(ctx, http.MethodGet, url, dhanHeaders(accessToken), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
-
-	// Log raw response for debugging
 	responseBodyStr := string(bodyBytes)
-	utils.LogInfo("Dhan API raw response", map[string]interface{}{
-		"url":          url,
-		"status":       resp.StatusCode,
-		"body_len":     len(bodyBytes),
-		"body_preview": responseBodyStr[:min(500, len(bodyBytes))], // First 500 chars
-		"full_body":    responseBodyStr,                            // Full response for debugging
-	})
 
 	// Try to parse as array first
 	var trades []DhanTrade
@@ -206,7 +162,7 @@ func (d *DhanService) FetchTrades(accessToken, fromDate, toDate string, pageNumb
 // FetchTradesForDateRange fetches all trades for a date range, handling pagination
 // fromDate and toDate should be in YYYY-MM-DD format
 // accessToken is the Dhan API access token
-func (d *DhanService) FetchTradesForDateRange(accessToken, fromDate, toDate string) ([]DhanTrade, error) {
+func (d *DhanService) FetchTradesForDateRange(ctx context.Context, accessToken, fromDate, toDate string) ([]DhanTrade, error) {
 	allTrades := make([]DhanTrade, 0)
 	pageNumber := 0 // Start from page 0 as per API documentation (curl example uses 0)
 
@@ -217,7 +173,7 @@ func (d *DhanService) FetchTradesForDateRange(accessToken, fromDate, toDate stri
 	})
 
 	for {
-		trades, err := d.FetchTrades(accessToken, fromDate, toDate, pageNumber)
+		trades, err := d.FetchTrades(ctx, accessToken, fromDate, toDate, pageNumber)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch trades for page %d: %w", pageNumber, err)
 		}
@@ -262,193 +218,21 @@ func (d *DhanService) FetchTradesForDateRange(accessToken, fromDate, toDate stri
 }
 
 // FetchAndConvertTrades fetches trades from Dhan API and converts them to internal Trade model
-// This is a convenience method that combines fetching and conversion
+// This is a convenience method that combines fetching and FIFO round-trip matching
 // fromDate and toDate should be in YYYY-MM-DD format
 // accessToken is the Dhan API access token
 // userID is the user ID to associate the trades with
-func (d *DhanService) FetchAndConvertTrades(accessToken, fromDate, toDate string, userID int) ([]*data.Trade, error) {
-	// Fetch trades from API
-	dhanTrades, err := d.FetchTradesForDateRange(accessToken, fromDate, toDate)
+func (d *DhanService) FetchAndConvertTrades(ctx context.Context, accessToken, fromDate, toDate string, userID int) ([]*data.Trade, error) {
+	dhanTrades, err := d.FetchTradesForDateRange(ctx, accessToken, fromDate, toDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch trades: %w", err)
 	}
 
-	// Convert to BrokerTrade format with full Dhan trade data
-	enhancedTrades := make([]EnhancedBrokerTrade, 0, len(dhanTrades))
+	brokerTrades := make([]BrokerTrade, 0, len(dhanTrades))
 	for _, trade := range dhanTrades {
-		symbol := trade.CustomSymbol
-		if symbol == "" {
-			symbol = trade.SecurityID // Fallback to security ID
-		}
-
-		// Parse exchange time
-		exchangeTime, err := time.Parse("2006-01-02 15:04:05", trade.ExchangeTime)
-		if err != nil {
-			exchangeTime, err = time.Parse(time.RFC3339, trade.ExchangeTime)
-			if err != nil {
-				exchangeTime = time.Now()
-			}
-		}
-
-		enhancedTrade := EnhancedBrokerTrade{
-			BrokerTrade: BrokerTrade{
-				Symbol:          symbol,
-				Quantity:        trade.TradedQuantity,
-				Price:           trade.TradedPrice,
-				TransactionType: trade.TransactionType,
-				ExchangeOrderID: trade.ExchangeOrderID,
-				OrderID:         trade.OrderID,
-				ProductType:     trade.ProductType,
-				ExchangeTime:    trade.ExchangeTime,
-			},
-			ExchangeTime: exchangeTime,
-			ProductType:  trade.ProductType,
-		}
-		enhancedTrades = append(enhancedTrades, enhancedTrade)
-	}
-
-	// Match BUY and SELL trades to calculate P&L
-	matchedTrades := d.matchBuySellTrades(enhancedTrades, userID)
-
-	return matchedTrades, nil
-}
-
-// EnhancedBrokerTrade represents a broker trade with parsed time
-type EnhancedBrokerTrade struct {
-	BrokerTrade
-	ExchangeTime time.Time
-	ProductType  string
-}
-
-// matchBuySellTrades matches BUY and SELL trades to create complete trade entries with P&L
-// Creates a separate trade entry for each transaction, then tries to find matching exit prices
-func (d *DhanService) matchBuySellTrades(enhancedTrades []EnhancedBrokerTrade, userID int) []*data.Trade {
-	// First, create a trade entry for each transaction
-	trades := make([]*data.Trade, 0, len(enhancedTrades))
-	usedSells := make(map[int]bool) // Track which SELL trades have been used for matching
-
-	// Sort trades by time to process in chronological order
-	sortedTrades := make([]EnhancedBrokerTrade, len(enhancedTrades))
-	copy(sortedTrades, enhancedTrades)
-	for i := 0; i < len(sortedTrades)-1; i++ {
-		for j := i + 1; j < len(sortedTrades); j++ {
-			if sortedTrades[i].ExchangeTime.After(sortedTrades[j].ExchangeTime) {
-				sortedTrades[i], sortedTrades[j] = sortedTrades[j], sortedTrades[i]
-			}
-		}
-	}
-
-	// Create trade entries and try to match exit prices
-	for i, trade := range sortedTrades {
-		// Determine direction
-		direction := data.TradeDirectionLong
-		if trade.TransactionType == "SELL" {
-			direction = data.TradeDirectionShort
-		}
-
-		// Convert product type
-		var productType *data.ProductType
-		if trade.ProductType != "" {
-			pt := convertProductType(trade.ProductType)
-			productType = &pt
-		}
-
-		// Convert transaction type
-		transactionType := "buy"
-		if trade.TransactionType == "SELL" {
-			transactionType = "sell"
-		}
-
-		// Try to find matching exit price
-		var exitPrice *float64
-		var pnl float64
-		var outcome data.OutcomeSummary
-
-		if direction == data.TradeDirectionLong && trade.TransactionType == "BUY" {
-			// For LONG: find a SELL on same or later date with matching quantity
-			for j := i + 1; j < len(sortedTrades); j++ {
-				if usedSells[j] {
-					continue
-				}
-				sell := sortedTrades[j]
-				if sell.Symbol == trade.Symbol &&
-					sell.TransactionType == "SELL" &&
-					sell.ProductType == trade.ProductType &&
-					sell.Quantity == trade.Quantity &&
-					!sell.ExchangeTime.Before(trade.ExchangeTime) {
-					exitPrice = &sell.Price
-					pnl = (sell.Price - trade.Price) * float64(trade.Quantity)
-					usedSells[j] = true
-					break
-				}
-			}
-		} else if direction == data.TradeDirectionShort && trade.TransactionType == "SELL" {
-			// For SHORT: find a BUY on same or later date with matching quantity
-			for j := i + 1; j < len(sortedTrades); j++ {
-				if usedSells[j] {
-					continue
-				}
-				buy := sortedTrades[j]
-				if buy.Symbol == trade.Symbol &&
-					buy.TransactionType == "BUY" &&
-					buy.ProductType == trade.ProductType &&
-					buy.Quantity == trade.Quantity &&
-					!buy.ExchangeTime.Before(trade.ExchangeTime) {
-					exitPrice = &buy.Price
-					pnl = (trade.Price - buy.Price) * float64(trade.Quantity)
-					usedSells[j] = true
-					break
-				}
-			}
-		}
-
-		// Determine outcome based on P&L
-		if exitPrice != nil {
-			if pnl > 0 {
-				outcome = data.OutcomeSummaryProfitable
-			} else if pnl < 0 {
-				outcome = data.OutcomeSummaryLoss
-			} else {
-				outcome = data.OutcomeSummaryBreakeven
-			}
-		} else {
-			outcome = data.OutcomeSummaryBreakeven
-		}
-
-		tradeEntry := &data.Trade{
-			ID:             utils.GenerateID(),
-			UserID:         userID,
-			Symbol:         trade.Symbol,
-			MarketType:     data.MarketTypeIndian,
-			EntryDate:      trade.ExchangeTime,
-			EntryPrice:     trade.Price,
-			Quantity:       trade.Quantity,
-			TotalAmount:    trade.Price * float64(trade.Quantity),
-			ExitPrice:      exitPrice,
-			Direction:      direction,
-			StopLoss:       nil,
-			Target:         nil,
-			Strategy:       "",
-			OutcomeSummary: outcome,
-			TradeAnalysis:  nil,
-			RulesFollowed:  []string{},
-			Screenshots:    []string{},
-			Psychology:     nil,
-			// Broker-specific fields
-			TradingBroker:   func() *data.TradingBroker { b := data.TradingBrokerDhan; return &b }(),
-			TraderBrokerID:  nil,
-			ExchangeOrderID: &trade.ExchangeOrderID,
-			OrderID:         &trade.OrderID,
-			ProductType:     productType,
-			TransactionType: &transactionType,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
-		}
-
-		trades = append(trades, tradeEntry)
+		brokerTrades = append(brokerTrades, d.toBrokerTrade(trade))
 	}
-
-	return trades
+	return BuildTrades(fillsFromBrokerTrades(brokerTrades), nil, matching.MethodFIFO, userID, data.TradingBrokerDhan).New, nil
 }
 
 // FormatDateForAPI formats a time.Time to YYYY-MM-DD format for Dhan API
@@ -466,62 +250,23 @@ type RenewTokenResponse struct {
 // RenewToken renews the Dhan access token
 // accessToken is the current access token
 // dhanClientID is the Dhan client ID
-func (d *DhanService) RenewToken(accessToken, dhanClientID string) (*RenewTokenResponse, error) {
-	// Get base URL from environment - check both possible env var names, use same base as FetchTrades for consistency
-	baseURL := os.Getenv("DHAN_PROD_API")
-	if baseURL == "" {
-		baseURL = os.Getenv("DHAN_PROD_API_ENDPOINT")
-	}
-	if baseURL == "" {
-		baseURL = "https://api.dhan.co/v2" // Default to api (same as FetchTrades)
-	}
-
+func (d *DhanService) RenewToken(ctx context.Context, accessToken, dhanClientID string) (*RenewTokenResponse, error) {
 	// Build the API URL
-	url := fmt.Sprintf("%s/RenewToken", baseURL)
-
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	url := d.http.Config().APIURL + "/RenewToken"
 
 	// Set headers
-	req.Header.Set("access-token", accessToken)
-	req.Header.Set("dhanClientId", dhanClientID)
-
-	// Make HTTP request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	header := http.Header{}
+	header.Set("access-token", accessToken)
+	header.Set("dhanClientId", dhanClientID)
 
 	utils.LogInfo("Renewing Dhan access token", map[string]interface{}{
 		"url":            url,
 		"dhan_client_id": dhanClientID,
 	})
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Dhan API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		errorMsg := string(bodyBytes)
-		if errorMsg == "" {
-			errorMsg = "No error message provided by Dhan API"
-		}
-		if readErr != nil {
-			errorMsg = fmt.Sprintf("Failed to read error response: %v", readErr)
-		}
-		return nil, fmt.Errorf("dhan API returned status %d: %s", resp.StatusCode, errorMsg)
-	}
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := d.http.Do(ctx, http.MethodGet, url, header, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	// Parse JSON response
@@ -548,56 +293,21 @@ type GenerateConsentResponse struct {
 // dhanClientID is the Dhan client ID (required)
 // appID is the Dhan API key
 // appSecret is the Dhan API secret
-func (d *DhanService) GenerateConsent(dhanClientID, appID, appSecret string) (*GenerateConsentResponse, error) {
+func (d *DhanService) GenerateConsent(ctx context.Context, dhanClientID, appID, appSecret string) (*GenerateConsentResponse, error) {
 	// Build the API URL - client_id is required according to API docs
 	if dhanClientID == "" {
 		return nil, fmt.Errorf("dhan client ID is required")
 	}
-	url := fmt.Sprintf("https://auth.dhan.co/app/generate-consent?client_id=%s", dhanClientID)
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("app_id", appID)
-	req.Header.Set("app_secret", appSecret)
-
-	// Make HTTP request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	url := fmt.Sprintf("%s/app/generate-consent?client_id=%s", d.http.Config().AuthURL, url.QueryEscape(dhanClientID))
 
 	utils.LogInfo("Generating Dhan consent", map[string]interface{}{
 		"url":            url,
 		"dhan_client_id": dhanClientID,
 	})
 
-	resp, err := client.Do(req)
+	bodyBytes, err := d.http.Do(ctx, http.MethodPost, url, dhanAppHeaders(appID, appSecret), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Dhan API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		errorMsg := string(bodyBytes)
-		if errorMsg == "" {
-			errorMsg = "No error message provided by Dhan API"
-		}
-		if readErr != nil {
-			errorMsg = fmt.Sprintf("Failed to read error response: %v", readErr)
-		}
-		return nil, fmt.Errorf("dhan API returned status %d: %s", resp.StatusCode, errorMsg)
-	}
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	// Parse JSON response
@@ -628,52 +338,17 @@ type ConsumeConsentResponse struct {
 // tokenID is the token ID received from the browser login redirect
 // appID is the Dhan API key
 // appSecret is the Dhan API secret
-func (d *DhanService) ConsumeConsent(tokenID, appID, appSecret string) (*ConsumeConsentResponse, error) {
+func (d *DhanService) ConsumeConsent(ctx context.Context, tokenID, appID, appSecret string) (*ConsumeConsentResponse, error) {
 	// Build the API URL
-	url := fmt.Sprintf("https://auth.dhan.co/app/consumeApp-consent?tokenId=%s", tokenID)
-
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("app_id", appID)
-	req.Header.Set("app_secret", appSecret)
-
-	// Make HTTP request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	url := fmt.Sprintf("%s/app/consumeApp-consent?tokenId=%s", d.http.Config().AuthURL, url.QueryEscape(tokenID))
 
 	utils.LogInfo("Consuming Dhan consent", map[string]interface{}{
-		"url": url,
+		"url": utils.RedactSecrets(url),
 	})
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Dhan API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		errorMsg := string(bodyBytes)
-		if errorMsg == "" {
-			errorMsg = "No error message provided by Dhan API"
-		}
-		if readErr != nil {
-			errorMsg = fmt.Sprintf("Failed to read error response: %v", readErr)
-		}
-		return nil, fmt.Errorf("dhan API returned status %d: %s", resp.StatusCode, errorMsg)
-	}
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := d.http.Do(ctx, http.MethodGet, url, dhanAppHeaders(appID, appSecret), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	// Parse JSON response
@@ -689,3 +364,19 @@ func (d *DhanService) ConsumeConsent(tokenID, appID, appSecret string) (*Consume
 
 	return &response, nil
 }
+
+// dhanHeaders returns the headers of a Dhan API call made with a user's access token
+func dhanHeaders(accessToken string) http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	header.Set("access-token", accessToken)
+	return header
+}
+
+// dhanAppHeaders returns the headers of a Dhan auth call made with the app's API key and secret
+func dhanAppHeaders(appID, appSecret string) http.Header {
+	header := http.Header{}
+	header.Set("app_id", appID)
+	header.Set("app_secret", appSecret)
+	return header
+}
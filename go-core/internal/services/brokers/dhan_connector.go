@@ -0,0 +1,322 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+)
+
+// Capabilities reports what the Dhan connector supports
+func (d *DhanService) Capabilities() Capabilities {
+	return Capabilities{
+		Broker:       data.TradingBrokerDhan,
+		AuthFlow:     AuthFlowConsent,
+		TokenRefresh: true,
+		TradeHistory: true,
+		Positions:    true,
+		Holdings:     true,
+		Funds:        true,
+		Orders:       true,
+		OrderHistory: false,
+	}
+}
+
+// BeginAuth generates a consent and returns Dhan's login URL for it
+func (d *DhanService) BeginAuth(ctx context.Context, config *data.BrokerConfig) (*AuthStart, error) {
+	if config.APIKey == nil || config.APISecret == nil {
+		return nil, fmt.Errorf("API key and secret not configured")
+	}
+	if config.DhanClientID == nil || *config.DhanClientID == "" {
+		return nil, fmt.Errorf("dhan client ID is required")
+	}
+
+	response, err := d.GenerateConsent(ctx, *config.DhanClientID, *config.APIKey, *config.APISecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthStart{LoginURL: d.ConsentLoginURL(response.ConsentAppID)}, nil
+}
+
+// ConsentLoginURL returns the Dhan login page for a generated consent
+func (d *DhanService) ConsentLoginURL(consentAppID string) string {
+	return d.http.Config().AuthURL + "/login/consentApp-login?consentAppId=" + url.QueryEscape(consentAppID)
+}
+
+// CompleteAuth consumes the tokenId Dhan redirected back with and stores the access token
+func (d *DhanService) CompleteAuth(ctx context.Context, config *data.BrokerConfig, params map[string]string) error {
+	tokenID := params["tokenId"]
+	if tokenID == "" {
+		return fmt.Errorf("tokenId is required")
+	}
+	if config.APIKey == nil || config.APISecret == nil {
+		return fmt.Errorf("API key and secret not configured")
+	}
+
+	response, err := d.ConsumeConsent(ctx, tokenID, *config.APIKey, *config.APISecret)
+	if err != nil {
+		return err
+	}
+
+	config.AccessToken = response.AccessToken
+	config.DhanClientID = &response.DhanClientID
+	config.DhanClientName = &response.DhanClientName
+	config.DhanClientUcc = &response.DhanClientUcc
+	config.ExpiryTime = parseDhanExpiry(response.ExpiryTime)
+	config.ConfiguredAt = time.Now()
+	return nil
+}
+
+// RefreshToken renews the Dhan access token
+func (d *DhanService) RefreshToken(ctx context.Context, config *data.BrokerConfig) error {
+	if config.AccessToken == "" {
+		return fmt.Errorf("no access token to renew")
+	}
+	if config.DhanClientID == nil || *config.DhanClientID == "" {
+		return fmt.Errorf("dhan client ID is required to renew the token")
+	}
+
+	response, err := d.RenewToken(ctx, config.AccessToken, *config.DhanClientID)
+	if err != nil {
+		return dhanError(err)
+	}
+
+	config.AccessToken = response.AccessToken
+	config.ExpiryTime = parseDhanExpiry(response.ExpiryTime)
+	config.ConfiguredAt = time.Now()
+	return nil
+}
+
+// FetchFills fetches executions from Dhan API for the date range as matching fills
+func (d *DhanService) FetchFills(ctx context.Context, config *data.BrokerConfig, from, to time.Time) ([]matching.Fill, error) {
+	dhanTrades, err := d.FetchTradesForDateRange(ctx, config.AccessToken, FormatDateForAPI(from), FormatDateForAPI(to))
+	if err != nil {
+		return nil, dhanError(fmt.Errorf("failed to fetch trades: %w", err))
+	}
+
+	brokerTrades := make([]BrokerTrade, 0, len(dhanTrades))
+	for _, trade := range dhanTrades {
+		brokerTrades = append(brokerTrades, d.toBrokerTrade(trade))
+	}
+	return fillsFromBrokerTrades(brokerTrades), nil
+}
+
+// dhanPosition is a row of Dhan's /positions response
+type dhanPosition struct {
+	TradingSymbol    string  `json:"tradingSymbol"`
+	SecurityID       string  `json:"securityId"`
+	ExchangeSegment  string  `json:"exchangeSegment"`
+	ProductType      string  `json:"productType"`
+	PositionType     string  `json:"positionType"`
+	NetQty           int     `json:"netQty"`
+	CostPrice        float64 `json:"costPrice"`
+	RealizedProfit   float64 `json:"realizedProfit"`
+	UnrealizedProfit float64 `json:"unrealizedProfit"`
+	Multiplier       float64 `json:"multiplier"`
+}
+
+// FetchPositions fetches the day's open positions from Dhan
+// Dhan does not return the last price, so it is derived from the unrealized profit
+func (d *DhanService) FetchPositions(ctx context.Context, config *data.BrokerConfig) ([]Position, error) {
+	var rows []dhanPosition
+	if err := d.get(ctx, config.AccessToken, "/positions", &rows); err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, 0, len(rows))
+	for _, row := range rows {
+		if row.NetQty == 0 {
+			continue // closed during the day
+		}
+		multiplier := row.Multiplier
+		if multiplier == 0 {
+			multiplier = 1
+		}
+		pnl := row.RealizedProfit + row.UnrealizedProfit
+		positions = append(positions, Position{
+			Symbol:       row.TradingSymbol,
+			Exchange:     row.ExchangeSegment,
+			SecurityID:   row.SecurityID,
+			ProductType:  row.ProductType,
+			Quantity:     row.NetQty,
+			AveragePrice: row.CostPrice,
+			LastPrice:    row.CostPrice + row.UnrealizedProfit/(float64(row.NetQty)*multiplier),
+			DayPnL:       pnl,
+			PnL:          pnl,
+		})
+	}
+	return positions, nil
+}
+
+// dhanHolding is a row of Dhan's /holdings response
+type dhanHolding struct {
+	Exchange        string  `json:"exchange"`
+	TradingSymbol   string  `json:"tradingSymbol"`
+	SecurityID      string  `json:"securityId"`
+	ISIN            string  `json:"isin"`
+	TotalQty        int     `json:"totalQty"`
+	AvgCostPrice    float64 `json:"avgCostPrice"`
+	LastTradedPrice float64 `json:"lastTradedPrice"`
+}
+
+// FetchHoldings fetches demat holdings from Dhan
+// P&L is only computed when Dhan includes a last traded price
+func (d *DhanService) FetchHoldings(ctx context.Context, config *data.BrokerConfig) ([]Holding, error) {
+	var rows []dhanHolding
+	if err := d.get(ctx, config.AccessToken, "/holdings", &rows); err != nil {
+		return nil, err
+	}
+
+	holdings := make([]Holding, 0, len(rows))
+	for _, row := range rows {
+		holding := Holding{
+			Symbol:       row.TradingSymbol,
+			Exchange:     row.Exchange,
+			SecurityID:   row.SecurityID,
+			ISIN:         row.ISIN,
+			Quantity:     row.TotalQty,
+			AveragePrice: row.AvgCostPrice,
+			LastPrice:    row.LastTradedPrice,
+		}
+		if row.LastTradedPrice > 0 {
+			holding.PnL = (row.LastTradedPrice - row.AvgCostPrice) * float64(row.TotalQty)
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, nil
+}
+
+// dhanFundLimit is Dhan's /fundlimit response; availabelBalance is spelled as Dhan sends it
+type dhanFundLimit struct {
+	AvailableBalance    float64 `json:"availabelBalance"`
+	CollateralAmount    float64 `json:"collateralAmount"`
+	UtilizedAmount      float64 `json:"utilizedAmount"`
+	WithdrawableBalance float64 `json:"withdrawableBalance"`
+}
+
+// FetchFunds fetches the trading account balance from Dhan
+func (d *DhanService) FetchFunds(ctx context.Context, config *data.BrokerConfig) (*Funds, error) {
+	var limit dhanFundLimit
+	if err := d.get(ctx, config.AccessToken, "/fundlimit", &limit); err != nil {
+		return nil, err
+	}
+
+	return &Funds{
+		Available:    limit.AvailableBalance,
+		Utilised:     limit.UtilizedAmount,
+		Collateral:   limit.CollateralAmount,
+		Withdrawable: limit.WithdrawableBalance,
+	}, nil
+}
+
+// dhanOrder is a row of Dhan's /orders response
+type dhanOrder struct {
+	OrderID             string  `json:"orderId"`
+	ExchangeOrderID     string  `json:"exchangeOrderId"`
+	OrderStatus         string  `json:"orderStatus"`
+	TransactionType     string  `json:"transactionType"`
+	ExchangeSegment     string  `json:"exchangeSegment"`
+	ProductType         string  `json:"productType"`
+	OrderType           string  `json:"orderType"`
+	TradingSymbol       string  `json:"tradingSymbol"`
+	SecurityID          string  `json:"securityId"`
+	Quantity            int     `json:"quantity"`
+	FilledQty           int     `json:"filledQty"`
+	Price               float64 `json:"price"`
+	TriggerPrice        float64 `json:"triggerPrice"`
+	AverageTradedPrice  float64 `json:"averageTradedPrice"`
+	LegName             string  `json:"legName"`
+	CreateTime          string  `json:"createTime"`
+	UpdateTime          string  `json:"updateTime"`
+	OmsErrorDescription string  `json:"omsErrorDescription"`
+}
+
+// FetchOrders fetches the day's order book from Dhan
+// Dhan only reports each order's latest state, so every order carries a single event;
+// modifications show up as separate events when consecutive syncs see different states.
+func (d *DhanService) FetchOrders(ctx context.Context, config *data.BrokerConfig) ([]Order, error) {
+	var rows []dhanOrder
+	if err := d.get(ctx, config.AccessToken, "/orders", &rows); err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(rows))
+	for _, row := range rows {
+		symbol := row.TradingSymbol
+		if symbol == "" {
+			symbol = row.SecurityID
+		}
+		order := Order{
+			OrderID:         row.OrderID,
+			ExchangeOrderID: row.ExchangeOrderID,
+			Symbol:          symbol,
+			Exchange:        row.ExchangeSegment,
+			SecurityID:      row.SecurityID,
+			ProductType:     row.ProductType,
+			OrderType:       row.OrderType,
+			Side:            strings.ToLower(row.TransactionType),
+			Quantity:        row.Quantity,
+			FilledQuantity:  row.FilledQty,
+			Price:           row.Price,
+			TriggerPrice:    row.TriggerPrice,
+			AveragePrice:    row.AverageTradedPrice,
+			Status:          dhanOrderStatus(row),
+			BrokerStatus:    row.OrderStatus,
+			StatusMessage:   row.OmsErrorDescription,
+			PlacedAt:        orderTime(row.OrderID, row.CreateTime),
+			UpdatedAt:       orderTime(row.OrderID, row.UpdateTime, row.CreateTime),
+		}
+		order.Events = []OrderEvent{latestOrderEvent(order)}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// dhanOrderStatus normalizes a Dhan order status
+// Dhan reports orders resting at the exchange as PENDING, including stop orders waiting for their trigger.
+func dhanOrderStatus(row dhanOrder) OrderStatus {
+	if !strings.EqualFold(row.OrderStatus, "PENDING") {
+		return NormalizeOrderStatus(row.OrderStatus)
+	}
+	if strings.HasPrefix(strings.ToUpper(row.OrderType), "STOP_LOSS") && row.TriggerPrice > 0 {
+		return OrderStatusTriggerPending
+	}
+	return OrderStatusOpen
+}
+
+// get calls a Dhan v2 endpoint and decodes the JSON response into out
+func (d *DhanService) get(ctx context.Context, accessToken, path string, out interface{}) error {
+	bodyBytes, err := d.http.Do(ctx, http.MethodGet, d.http.Config().APIURL+path, dhanHeaders(accessToken), nil)
+	if err != nil {
+		return dhanError(err)
+	}
+
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("failed to parse Dhan API response: %w", err)
+	}
+	return nil
+}
+
+// dhanError marks errors caused by a rejected access token with ErrInvalidToken
+func dhanError(err error) error {
+	if isStatus(err, http.StatusUnauthorized) || strings.Contains(err.Error(), "Invalid Token") {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return err
+}
+
+// parseDhanExpiry parses Dhan's token expiry, defaulting to 24 hours from now
+func parseDhanExpiry(value string) *time.Time {
+	expiryTime, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		expiryTime = time.Now().Add(24 * time.Hour)
+	}
+	return &expiryTime
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"go-core/internal/data"
+	"go-core/internal/services/matching"
 )
 
 // GetBrokerService returns the appropriate broker service based on broker name
@@ -19,11 +20,13 @@ func GetBrokerService(brokerName data.TradingBroker) (BrokerService, error) {
 }
 
 // ImportTrades imports trades from broker data
-// This is a convenience function that handles the full import process
+// This is a convenience function that handles the full import process:
+// executions are parsed and matched into round-trip trades with the given method
 func ImportTrades(
 	brokerName data.TradingBroker,
 	rawData []byte,
 	userID int,
+	method matching.Method,
 ) ([]*data.Trade, error) {
 	// Get the appropriate broker service
 	brokerService, err := GetBrokerService(brokerName)
@@ -37,15 +40,6 @@ func ImportTrades(
 		return nil, fmt.Errorf("failed to parse broker trades: %w", err)
 	}
 
-	// Convert to internal Trade model
-	trades := make([]*data.Trade, 0, len(brokerTrades))
-	for _, brokerTrade := range brokerTrades {
-		trade, err := brokerService.ConvertToTrade(brokerTrade, userID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert trade: %w", err)
-		}
-		trades = append(trades, trade)
-	}
-
-	return trades, nil
+	// Match executions into round-trip trades
+	return BuildTrades(fillsFromBrokerTrades(brokerTrades), nil, method, userID, brokerService.GetBrokerName()).New, nil
 }
@@ -0,0 +1,313 @@
+package brokers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+// FillFromBrokerTrade converts one broker execution into a matching fill
+// An execution without a readable exchange time is an error: the engine orders fills by time,
+// so a guessed time would change which lots it closes.
+func FillFromBrokerTrade(brokerTrade BrokerTrade) (matching.Fill, error) {
+	side := matching.SideSell
+	if strings.EqualFold(brokerTrade.TransactionType, "buy") {
+		side = matching.SideBuy
+	}
+	exchangeTime, err := parseExchangeTime(brokerTrade.ExchangeTime)
+	if err != nil {
+		return matching.Fill{}, fmt.Errorf("trade %s: %w", brokerTrade.TradeID, err)
+	}
+
+	return matching.Fill{
+		TradeID:         brokerTrade.TradeID,
+		OrderID:         brokerTrade.OrderID,
+		ExchangeOrderID: brokerTrade.ExchangeOrderID,
+		Symbol:          brokerTrade.Symbol,
+		Product:         brokerTrade.ProductType,
+		Side:            side,
+		Quantity:        brokerTrade.Quantity,
+		Price:           brokerTrade.Price,
+		Time:            exchangeTime,
+		Exchange:        brokerTrade.Exchange,
+		SecurityID:      brokerTrade.SecurityID,
+		ISIN:            brokerTrade.ISIN,
+	}, nil
+}
+
+// fillsFromBrokerTrades converts broker executions into fills, skipping with a warning those
+// FillFromBrokerTrade cannot convert
+func fillsFromBrokerTrades(brokerTrades []BrokerTrade) []matching.Fill {
+	fills := make([]matching.Fill, 0, len(brokerTrades))
+	for _, brokerTrade := range brokerTrades {
+		fill, err := FillFromBrokerTrade(brokerTrade)
+		if err != nil {
+			utils.LogWarn("Skipping broker trade", map[string]interface{}{
+				"symbol": brokerTrade.Symbol,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		fills = append(fills, fill)
+	}
+	return fills
+}
+
+// BuildResult is the journal change set produced from a batch of fills
+type BuildResult struct {
+	// New are trades opened by the fills: closed round trips and still-open positions
+	New []*data.Trade
+	// Splits are closed portions of carried positions that were only partly exited
+	Splits []*data.Trade
+	// Updated are carried open trades that were closed or reduced and must be saved
+	Updated []*data.Trade
+}
+
+// BuildTrades turns broker fills into round-trip journal trades using the matching engine
+// open holds the user's existing open trades from this broker; they seed the engine so positions
+// carried overnight between syncs close against their original entries.
+// Every trade takes the cost basis of the lot it comes from, so under MethodAverage carried
+// trades that are closed, reduced or re-averaged have their entry price set to the average cost.
+func BuildTrades(
+	fills []matching.Fill,
+	open []*data.Trade,
+	method matching.Method,
+	userID int,
+	broker data.TradingBroker,
+) BuildResult {
+	var built BuildResult
+	seeds := make([]matching.Lot, 0, len(open))
+	openByID := make(map[string]*data.Trade, len(open))
+	remaining := make(map[string]int, len(open))
+	for _, t := range open {
+		if t.ExitPrice != nil {
+			continue
+		}
+		seeds = append(seeds, lotFromOpenTrade(t))
+		openByID[t.ID] = t
+		remaining[t.ID] = t.Quantity
+	}
+
+	// Fills and carried trades net against each other by product, so both go through the same
+	// product mapping the journal stores
+	keyed := make([]matching.Fill, len(fills))
+	for i, fill := range fills {
+		fill.Product = productKey(fill.Product)
+		keyed[i] = fill
+	}
+	result := matching.Run(keyed, method, seeds...)
+
+	touched := make(map[string]bool)
+	for _, match := range result.Matches {
+		seeded, ok := openByID[match.Open.Ref]
+		if !ok {
+			built.New = append(built.New, tradeFromMatch(match, userID, broker))
+			continue
+		}
+
+		if !touched[seeded.ID] {
+			touched[seeded.ID] = true
+			built.Updated = append(built.Updated, seeded)
+		}
+
+		if match.Quantity == remaining[seeded.ID] {
+			// The match closes whatever is left of the journal trade, so close it in place
+			// and keep the user's notes attached to it
+			closeTrade(seeded, match)
+			remaining[seeded.ID] = 0
+			continue
+		}
+
+		// Partial exit of a carried position: book the closed part as its own trade
+		split := tradeFromMatch(match, userID, broker)
+		copyJournalFields(split, seeded)
+		built.Splits = append(built.Splits, split)
+
+		remaining[seeded.ID] -= match.Quantity
+		seeded.Quantity = remaining[seeded.ID]
+		seeded.UpdatedAt = time.Now()
+	}
+
+	for _, lot := range result.Open {
+		seeded, ok := openByID[lot.Ref]
+		if !ok {
+			built.New = append(built.New, tradeFromLot(lot, userID, broker))
+			continue
+		}
+
+		// A carried trade still open takes its lot's current cost, as closed and split rows do
+		if !touched[seeded.ID] && seeded.EntryPrice == lot.Cost {
+			continue
+		}
+		if !touched[seeded.ID] {
+			touched[seeded.ID] = true
+			built.Updated = append(built.Updated, seeded)
+		}
+		seeded.EntryPrice = lot.Cost
+		seeded.TotalAmount = lot.Cost * float64(seeded.Quantity)
+		seeded.UpdatedAt = time.Now()
+	}
+
+	return built
+}
+
+// tradeFromMatch builds a closed journal trade from a matched lot
+func tradeFromMatch(match matching.Match, userID int, broker data.TradingBroker) *data.Trade {
+	trade := tradeFromLot(match.Open, userID, broker)
+	trade.Quantity = match.Quantity
+	trade.TotalAmount = trade.EntryPrice * float64(match.Quantity)
+	closeTrade(trade, match)
+	return trade
+}
+
+// tradeFromLot builds an open journal trade from the opening side of a lot
+func tradeFromLot(lot matching.Lot, userID int, broker data.TradingBroker) *data.Trade {
+	direction := data.TradeDirectionLong
+	transactionType := "buy"
+	if !lot.Long {
+		direction = data.TradeDirectionShort
+		transactionType = "sell"
+	}
+
+	var productType *data.ProductType
+	if lot.Fill.Product != "" {
+		pt := convertProductType(lot.Fill.Product)
+		productType = &pt
+	}
+
+	now := time.Now()
+	return &data.Trade{
+		ID:              utils.GenerateID(),
+		UserID:          userID,
+		Symbol:          lot.Fill.Symbol,
+		MarketType:      data.MarketTypeIndian,
+		EntryDate:       lot.Fill.Time,
+		EntryPrice:      lot.Cost,
+		Quantity:        lot.Remaining,
+		TotalAmount:     lot.Cost * float64(lot.Remaining),
+		Direction:       direction,
+		OutcomeSummary:  data.OutcomeSummaryBreakeven, // Open until a closing fill arrives
+		RulesFollowed:   []string{},
+		Screenshots:     []string{},
+		TradingBroker:   &broker,
+		ExchangeOrderID: utils.OptionalString(lot.Fill.ExchangeOrderID),
+		OrderID:         utils.OptionalString(lot.Fill.OrderID),
+		ProductType:     productType,
+		TransactionType: &transactionType,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// closeTrade records the exit of a match on a trade
+func closeTrade(trade *data.Trade, match matching.Match) {
+	exitPrice := match.Close.Price
+	exitDate := match.Close.Time
+
+	trade.Quantity = match.Quantity
+	trade.EntryPrice = match.Open.Cost
+	trade.TotalAmount = match.Open.Cost * float64(match.Quantity)
+	trade.ExitPrice = &exitPrice
+	trade.ExitDate = &exitDate
+	trade.OutcomeSummary = outcomeFor(match.PnL)
+	trade.UpdatedAt = time.Now()
+}
+
+// copyJournalFields carries the user's annotations from a carried trade onto a split-off exit
+func copyJournalFields(to, from *data.Trade) {
+	to.Strategy = from.Strategy
+	to.StopLoss = from.StopLoss
+	to.Target = from.Target
+	to.TradeAnalysis = from.TradeAnalysis
+	to.RulesFollowed = from.RulesFollowed
+	to.Psychology = from.Psychology
+	to.MarketType = from.MarketType
+}
+
+// lotFromOpenTrade seeds the engine with an open journal trade
+func lotFromOpenTrade(t *data.Trade) matching.Lot {
+	long := t.Direction != data.TradeDirectionShort
+	side := matching.SideBuy
+	if !long {
+		side = matching.SideSell
+	}
+
+	var product, orderID, exchangeOrderID string
+	if t.ProductType != nil {
+		product = productKey(string(*t.ProductType))
+	}
+	if t.OrderID != nil {
+		orderID = *t.OrderID
+	}
+	if t.ExchangeOrderID != nil {
+		exchangeOrderID = *t.ExchangeOrderID
+	}
+
+	return matching.Lot{
+		Fill: matching.Fill{
+			OrderID:         orderID,
+			ExchangeOrderID: exchangeOrderID,
+			Symbol:          t.Symbol,
+			Product:         product,
+			Side:            side,
+			Quantity:        t.Quantity,
+			Price:           t.EntryPrice,
+			Time:            t.EntryDate,
+		},
+		Long:      long,
+		Remaining: t.Quantity,
+		Cost:      t.EntryPrice,
+		Ref:       t.ID,
+	}
+}
+
+// outcomeFor maps realized P&L to an outcome summary
+func outcomeFor(pnl float64) data.OutcomeSummary {
+	switch {
+	case pnl > 0:
+		return data.OutcomeSummaryProfitable
+	case pnl < 0:
+		return data.OutcomeSummaryLoss
+	default:
+		return data.OutcomeSummaryBreakeven
+	}
+}
+
+// productKey is the journal product a broker product is stored as, or "" when there is none
+func productKey(product string) string {
+	if product == "" {
+		return ""
+	}
+	return string(convertProductType(product))
+}
+
+// parseExchangeTime parses broker timestamps; times without an offset are IST, as both
+// brokers report them
+func parseExchangeTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if parsed, err := time.ParseInLocation(layout, value, utils.IST); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised exchange time %q", value)
+}
+
+// orderTime parses the first set order timestamp, leaving the time zero with a warning when it
+// cannot be read
+func orderTime(orderID string, values ...string) time.Time {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		parsed, err := parseExchangeTime(value)
+		if err != nil {
+			utils.LogWarn("Unreadable order time", map[string]interface{}{"order_id": orderID, "error": err.Error()})
+		}
+		return parsed
+	}
+	return time.Time{}
+}
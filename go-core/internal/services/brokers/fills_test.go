@@ -0,0 +1,62 @@
+package brokers
+
+import (
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+)
+
+func TestBuildTradesAverageCost(t *testing.T) {
+	start := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+	fill := func(side matching.Side, quantity int, price float64, minute int) matching.Fill {
+		return matching.Fill{
+			Symbol: "INFY", Product: "CNC", Side: side, Quantity: quantity, Price: price,
+			Time: start.Add(time.Duration(minute) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sell        int
+		wantNew     int
+		wantSplits  int
+		wantCarried int  // quantity left on the carried trade
+		wantClosed  bool // whether the carried trade is closed in place
+	}{
+		{name: "partial exit splits the carried trade", sell: 5, wantNew: 1, wantSplits: 1, wantCarried: 5},
+		{name: "full exit closes the carried trade", sell: 15, wantNew: 2, wantCarried: 10, wantClosed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 10 carried at 100 plus 10 bought at 110 average to a cost of 105
+			product := data.ProductTypeCNC
+			carried := &data.Trade{
+				ID: "carried", Symbol: "INFY", Direction: data.TradeDirectionLong, ProductType: &product,
+				EntryDate: start.Add(-24 * time.Hour), EntryPrice: 100, Quantity: 10, TotalAmount: 1000,
+			}
+			fills := []matching.Fill{fill(matching.SideBuy, 10, 110, 1), fill(matching.SideSell, tt.sell, 120, 2)}
+
+			built := BuildTrades(fills, []*data.Trade{carried}, matching.MethodAverage, 1, data.TradingBrokerDhan)
+
+			if len(built.New) != tt.wantNew || len(built.Splits) != tt.wantSplits || len(built.Updated) != 1 {
+				t.Fatalf("built %d new, %d splits and %d updated trades, want %d, %d and 1",
+					len(built.New), len(built.Splits), len(built.Updated), tt.wantNew, tt.wantSplits)
+			}
+			if carried.Quantity != tt.wantCarried || (carried.ExitPrice != nil) != tt.wantClosed {
+				t.Errorf("carried trade has quantity %d, closed %v; want %d, %v",
+					carried.Quantity, carried.ExitPrice != nil, tt.wantCarried, tt.wantClosed)
+			}
+
+			// Every row of the position shows the same average cost basis
+			rows := append(append([]*data.Trade{carried}, built.New...), built.Splits...)
+			for _, trade := range rows {
+				if trade.EntryPrice != 105 || trade.TotalAmount != 105*float64(trade.Quantity) {
+					t.Errorf("trade %s has entry price %v and total %v for %d shares, want 105 per share",
+						trade.ID, trade.EntryPrice, trade.TotalAmount, trade.Quantity)
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 // BrokerTrade represents a trade from a third-party broker
 // This is the common format that all brokers should convert their data to
 type BrokerTrade struct {
+	TradeID         string // Exchange trade ID of this fill, when the broker reports one
 	Symbol          string
 	Quantity        int
 	Price           float64
@@ -15,6 +16,9 @@ type BrokerTrade struct {
 	OrderID         string
 	ProductType     string // "CNC" | "MIS" | "NRML" | "INTRADAY" | "OTC"
 	ExchangeTime    string // ISO format timestamp
+	Exchange        string // exchange or segment as the broker names it, e.g. "NSE_EQ" or "NFO"
+	SecurityID      string // broker's instrument identifier: Dhan security ID or Kite instrument_token
+	ISIN            string // when the broker reports it
 }
 
 // BrokerService defines the interface that all broker services must implement
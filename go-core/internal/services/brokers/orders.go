@@ -0,0 +1,100 @@
+package brokers
+
+import (
+	"strings"
+	"time"
+)
+
+// OrderStatus is a broker order status normalized across brokers
+type OrderStatus string
+
+const (
+	OrderStatusPending         OrderStatus = "pending" // in transit or awaiting validation
+	OrderStatusOpen            OrderStatus = "open"
+	OrderStatusTriggerPending  OrderStatus = "trigger_pending" // stop order waiting for its trigger price
+	OrderStatusModified        OrderStatus = "modified"
+	OrderStatusPartiallyFilled OrderStatus = "partially_filled"
+	OrderStatusFilled          OrderStatus = "filled"
+	OrderStatusCancelled       OrderStatus = "cancelled"
+	OrderStatusRejected        OrderStatus = "rejected"
+	OrderStatusExpired         OrderStatus = "expired"
+)
+
+// Order is an order from the broker's order book in its latest state
+type Order struct {
+	OrderID         string       `json:"order_id"`
+	ExchangeOrderID string       `json:"exchange_order_id,omitempty"`
+	ParentOrderID   string       `json:"parent_order_id,omitempty"` // bracket and cover order legs
+	Symbol          string       `json:"symbol"`
+	Exchange        string       `json:"exchange"`
+	SecurityID      string       `json:"security_id,omitempty"` // broker's instrument identifier
+	ProductType     string       `json:"product_type"`
+	OrderType       string       `json:"order_type"` // MARKET, LIMIT, SL, SL-M
+	Side            string       `json:"side"`       // buy | sell
+	Quantity        int          `json:"quantity"`
+	FilledQuantity  int          `json:"filled_quantity"`
+	Price           float64      `json:"price"`
+	TriggerPrice    float64      `json:"trigger_price"`
+	AveragePrice    float64      `json:"average_price"`
+	Status          OrderStatus  `json:"status"`
+	BrokerStatus    string       `json:"broker_status"` // status as the broker reported it
+	StatusMessage   string       `json:"status_message,omitempty"`
+	PlacedAt        time.Time    `json:"placed_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	Events          []OrderEvent `json:"events"` // oldest first; at least the latest state
+}
+
+// OrderEvent is one state of an order: placement, modification or status change
+type OrderEvent struct {
+	Status         OrderStatus `json:"status"`
+	BrokerStatus   string      `json:"broker_status"`
+	Quantity       int         `json:"quantity"`
+	FilledQuantity int         `json:"filled_quantity"`
+	Price          float64     `json:"price"`
+	TriggerPrice   float64     `json:"trigger_price"`
+	Message        string      `json:"message,omitempty"`
+	Time           time.Time   `json:"time"`
+}
+
+// NormalizeOrderStatus maps Dhan and Kite order statuses to OrderStatus
+func NormalizeOrderStatus(brokerStatus string) OrderStatus {
+	status := strings.ToUpper(strings.TrimSpace(brokerStatus))
+	status = strings.NewReplacer("_", " ", "-", " ").Replace(status)
+
+	switch {
+	case status == "TRADED" || status == "COMPLETE":
+		return OrderStatusFilled
+	case status == "PART TRADED":
+		return OrderStatusPartiallyFilled
+	case status == "CANCELLED" || status == "CANCELED":
+		return OrderStatusCancelled
+	case status == "REJECTED":
+		return OrderStatusRejected
+	case status == "EXPIRED" || status == "LAPSED":
+		return OrderStatusExpired
+	case status == "TRIGGER PENDING":
+		return OrderStatusTriggerPending
+	case status == "MODIFIED":
+		return OrderStatusModified
+	case status == "OPEN":
+		return OrderStatusOpen
+	default:
+		// TRANSIT, PENDING, PUT ORDER REQ RECEIVED, VALIDATION PENDING, OPEN PENDING,
+		// MODIFY PENDING, CANCEL PENDING and similar in-flight states
+		return OrderStatusPending
+	}
+}
+
+// latestOrderEvent describes an order's current state as a single event
+func latestOrderEvent(order Order) OrderEvent {
+	return OrderEvent{
+		Status:         order.Status,
+		BrokerStatus:   order.BrokerStatus,
+		Quantity:       order.Quantity,
+		FilledQuantity: order.FilledQuantity,
+		Price:          order.Price,
+		TriggerPrice:   order.TriggerPrice,
+		Message:        order.StatusMessage,
+		Time:           order.UpdatedAt,
+	}
+}
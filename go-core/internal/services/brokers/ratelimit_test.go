@@ -0,0 +1,71 @@
+package brokers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstThenRate(t *testing.T) {
+	limiter := newRateLimiter(50, 3) // one token every 20ms
+	ctx := context.Background()
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("Wait %d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Millisecond {
+		t.Fatalf("burst of 3 took %s, want no wait", elapsed)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("Wait after burst: %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 35*time.Millisecond {
+		t.Fatalf("two requests past the burst took %s, want about 40ms", elapsed)
+	}
+}
+
+func TestRateLimiterRefillIsCappedAtBurst(t *testing.T) {
+	limiter := newRateLimiter(1000, 2)
+	limiter.last = time.Now().Add(-time.Hour)
+
+	ctx := context.Background()
+	limiter.Wait(ctx)
+	if limiter.tokens > 1 {
+		t.Fatalf("bucket holds %.1f tokens after one request, want at most burst-1", limiter.tokens)
+	}
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "disabled limiter never waits", rate: 0, timeout: time.Second},
+		{name: "deadline before the next token", rate: 1, timeout: 20 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		limiter := newRateLimiter(tt.rate, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+		limiter.Wait(ctx) // drains the single token
+		err := limiter.Wait(ctx)
+		cancel()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Wait = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newRateLimiter(0, 1).Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("disabled limiter ignored a cancelled context: %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package brokers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// ClientConfig configures how a broker's HTTP API is called
+type ClientConfig struct {
+	APIURL     string        // REST API base URL
+	AuthURL    string        // login and consent base URL
+	Timeout    time.Duration // per attempt
+	MaxRetries int           // retries after the first attempt
+	MinBackoff time.Duration // wait before the first retry, doubled on each one
+	MaxBackoff time.Duration // longest wait between attempts
+	RateLimit  float64       // requests per second across all users; zero disables limiting
+	Burst      int           // requests allowed at once before the rate limit applies
+}
+
+// DefaultClientConfig returns a broker's production URLs and published rate limits
+func DefaultClientConfig(broker data.TradingBroker) ClientConfig {
+	config := ClientConfig{
+		Timeout:    30 * time.Second,
+		MaxRetries: 3,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+
+	switch broker {
+	case data.TradingBrokerDhan:
+		config.APIURL = "https://api.dhan.co/v2"
+		config.AuthURL = "https://auth.dhan.co"
+		config.RateLimit = 20 // non-trading APIs
+		config.Burst = 20
+	case data.TradingBrokerZerodha:
+		config.APIURL = "https://api.kite.trade"
+		config.AuthURL = "https://kite.zerodha.com"
+		config.RateLimit = 10
+		config.Burst = 10
+	}
+	return config
+}
+
+// LoadClientConfig returns a broker's default config with overrides from the environment
+//
+// Base URLs come from DHAN_PROD_API (or DHAN_PROD_API_ENDPOINT) and DHAN_AUTH_URL for Dhan,
+// and KITE_API_URL and KITE_AUTH_URL for Zerodha. DHAN_RATE_LIMIT and KITE_RATE_LIMIT set
+// requests per second, with DHAN_RATE_BURST and KITE_RATE_BURST. BROKER_HTTP_TIMEOUT (a
+// duration such as 30s) and BROKER_MAX_RETRIES apply to every broker.
+func LoadClientConfig(broker data.TradingBroker) ClientConfig {
+	config := DefaultClientConfig(broker)
+
+	var prefix string
+	switch broker {
+	case data.TradingBrokerDhan:
+		prefix = "DHAN"
+		config.APIURL = envString(config.APIURL, "DHAN_PROD_API", "DHAN_PROD_API_ENDPOINT")
+		config.AuthURL = envString(config.AuthURL, "DHAN_AUTH_URL")
+	case data.TradingBrokerZerodha:
+		prefix = "KITE"
+		config.APIURL = envString(config.APIURL, "KITE_API_URL")
+		config.AuthURL = envString(config.AuthURL, "KITE_AUTH_URL")
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	config.AuthURL = strings.TrimRight(config.AuthURL, "/")
+
+	if value := os.Getenv(prefix + "_RATE_LIMIT"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 {
+			config.RateLimit = rate
+		}
+	}
+	if value := os.Getenv(prefix + "_RATE_BURST"); value != "" {
+		if burst, err := strconv.Atoi(value); err == nil && burst > 0 {
+			config.Burst = burst
+		}
+	}
+	if value := os.Getenv("BROKER_HTTP_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			config.Timeout = timeout
+		}
+	}
+	if value := os.Getenv("BROKER_MAX_RETRIES"); value != "" {
+		if retries, err := strconv.Atoi(value); err == nil && retries >= 0 {
+			config.MaxRetries = retries
+		}
+	}
+
+	return config
+}
+
+// envString returns the first non-empty environment variable of names, or fallback
+func envString(fallback string, names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+// StatusError is returned when a broker answers with a non-2xx status after any retries
+type StatusError struct {
+	Broker     data.TradingBroker
+	StatusCode int
+	Body       string
+}
+
+// Error keeps the "<broker> API returned status <code>" form token errors are recognized by
+func (e *StatusError) Error() string {
+	body := e.Body
+	if body == "" {
+		body = "no error message provided"
+	}
+	return fmt.Sprintf("%s API returned status %d: %s", e.Broker, e.StatusCode, body)
+}
+
+// Transport is the HTTP client every call to a broker goes through
+// It shares one token bucket between all users of the broker, retries throttled and failed
+// requests with jittered exponential backoff, and logs each attempt with credentials redacted.
+type Transport struct {
+	broker  data.TradingBroker
+	config  ClientConfig
+	client  *http.Client
+	limiter *rateLimiter
+}
+
+// NewTransport creates a transport for a broker
+func NewTransport(broker data.TradingBroker, config ClientConfig) *Transport {
+	return &Transport{
+		broker:  broker,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		limiter: newRateLimiter(config.RateLimit, config.Burst),
+	}
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = make(map[data.TradingBroker]*Transport)
+)
+
+// transportFor returns the shared transport of a broker, configured from the environment on first use
+func transportFor(broker data.TradingBroker) *Transport {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	transport, exists := transports[broker]
+	if !exists {
+		transport = NewTransport(broker, LoadClientConfig(broker))
+		transports[broker] = transport
+	}
+	return transport
+}
+
+// Configure replaces the shared transport of a broker, for example to point it at a sandbox
+// Services created afterwards use the new config.
+func Configure(broker data.TradingBroker, config ClientConfig) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	transports[broker] = NewTransport(broker, config)
+}
+
+// Config returns the config the transport was created with
+func (t *Transport) Config() ClientConfig {
+	return t.config
+}
+
+// Do sends a request to the broker and returns the response body of a 2xx answer
+// Every attempt waits for the rate limiter. Safe methods are retried on network errors, 429
+// and 5xx; other methods only on 429, when the broker did not process the request. A
+// Retry-After header is honored. Non-2xx answers are returned as *StatusError.
+func (t *Transport) Do(ctx context.Context, method, endpoint string, header http.Header, body []byte) ([]byte, error) {
+	idempotent := method == http.MethodGet || method == http.MethodHead
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		respBody, status, retryAfter, err := t.attempt(ctx, method, endpoint, header, body, attempt)
+		if err == nil && status >= 200 && status < 300 {
+			return respBody, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		retryable := false
+		if err != nil {
+			lastErr = fmt.Errorf("failed to make request to %s API: %w", t.broker, err)
+			retryable = idempotent
+		} else {
+			lastErr = &StatusError{Broker: t.broker, StatusCode: status, Body: string(respBody)}
+			retryable = status == http.StatusTooManyRequests || (idempotent && status >= 500)
+		}
+		if !retryable || attempt >= t.config.MaxRetries {
+			return nil, lastErr
+		}
+
+		wait := t.backoff(attempt)
+		if retryAfter > wait {
+			wait = min(retryAfter, time.Minute)
+		}
+		utils.LogWarn("Retrying broker API request", map[string]interface{}{
+			"trading_broker": t.broker,
+			"method":         method,
+			"url":            utils.RedactSecrets(endpoint),
+			"attempt":        attempt + 1,
+			"wait_ms":        wait.Milliseconds(),
+			"error":          lastErr.Error(),
+		})
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends the request once, returning the body, status and any Retry-After delay
+func (t *Transport) attempt(
+	ctx context.Context,
+	method, endpoint string,
+	header http.Header,
+	body []byte,
+	attempt int,
+) ([]byte, int, time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	started := time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		utils.LogError(err, "Broker API request failed", map[string]interface{}{
+			"trading_broker": t.broker,
+			"method":         method,
+			"url":            utils.RedactSecrets(endpoint),
+			"attempt":        attempt + 1,
+			"duration_ms":    time.Since(started).Milliseconds(),
+		})
+		return nil, 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	utils.LogInfo("Broker API request", map[string]interface{}{
+		"trading_broker": t.broker,
+		"method":         method,
+		"url":            utils.RedactSecrets(endpoint),
+		"status":         resp.StatusCode,
+		"attempt":        attempt + 1,
+		"duration_ms":    time.Since(started).Milliseconds(),
+		"response_bytes": len(respBody),
+	})
+	utils.LogDebug("Broker API response", map[string]interface{}{
+		"trading_broker": t.broker,
+		"url":            utils.RedactSecrets(endpoint),
+		"body_preview":   utils.RedactSecrets(string(respBody[:min(500, len(respBody))])),
+	})
+
+	return respBody, resp.StatusCode, retryAfter(resp.Header.Get("Retry-After")), nil
+}
+
+// backoff returns the wait before retry attempt+1: exponential from MinBackoff up to
+// MaxBackoff, with the upper half jittered so clients throttled together spread out
+func (t *Transport) backoff(attempt int) time.Duration {
+	wait := t.config.MinBackoff << attempt
+	if wait <= 0 || wait > t.config.MaxBackoff {
+		wait = t.config.MaxBackoff
+	}
+	if wait <= 1 {
+		return wait
+	}
+	half := wait / 2
+	return half + rand.N(wait-half)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// isStatus reports whether err is a broker answer with one of the given statuses
+func isStatus(err error, statuses ...int) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	for _, status := range statuses {
+		if statusErr.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
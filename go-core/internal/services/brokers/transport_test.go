@@ -0,0 +1,183 @@
+package brokers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/testutil"
+)
+
+// testTransport returns a transport with short backoffs and no rate limit, logging only errors
+func testTransport(retries int) *Transport {
+	testutil.QuietLogs()
+	return NewTransport(data.TradingBrokerDhan, ClientConfig{
+		Timeout:    time.Second,
+		MaxRetries: retries,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	})
+}
+
+// scriptedServer answers each request with the next status, repeating the last one
+func scriptedServer(t *testing.T, statuses []int, header http.Header) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		status := statuses[min(n, len(statuses)-1)]
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(http.StatusText(status)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestTransportRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		wantCalls  int32
+		wantStatus int // zero for success
+	}{
+		{name: "success on the first attempt", method: http.MethodGet, statuses: []int{200}, wantCalls: 1},
+		{name: "GET retries server errors", method: http.MethodGet, statuses: []int{502, 503, 200}, wantCalls: 3},
+		{name: "GET gives up after MaxRetries", method: http.MethodGet, statuses: []int{500}, wantCalls: 3, wantStatus: 500},
+		{name: "POST retries throttling", method: http.MethodPost, statuses: []int{429, 200}, wantCalls: 2},
+		{name: "POST never retries server errors", method: http.MethodPost, statuses: []int{500, 200}, wantCalls: 1, wantStatus: 500},
+		{name: "client errors are not retried", method: http.MethodGet, statuses: []int{401, 200}, wantCalls: 1, wantStatus: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := scriptedServer(t, tt.statuses, nil)
+
+			body, err := testTransport(2).Do(context.Background(), tt.method, server.URL, nil, []byte("{}"))
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", got, tt.wantCalls)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil || string(body) != "OK" {
+					t.Errorf("Do = %q, %v; want OK", body, err)
+				}
+				return
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+				t.Fatalf("Do error = %v, want status %d", err, tt.wantStatus)
+			}
+			if !isStatus(err, 400, tt.wantStatus) || isStatus(err, 200) {
+				t.Errorf("isStatus does not match %d", tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTransportHonorsRetryAfter(t *testing.T) {
+	server, calls := scriptedServer(t, []int{429, 200}, http.Header{"Retry-After": {"1"}})
+
+	started := time.Now()
+	if _, err := testTransport(1).Do(context.Background(), http.MethodGet, server.URL, nil, nil); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After", elapsed)
+	}
+	if atomic.LoadInt32(calls) != 2 {
+		t.Errorf("server called %d times, want 2", atomic.LoadInt32(calls))
+	}
+}
+
+func TestTransportRetriesNetworkErrorsOnlyWhenIdempotent(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		_, err := testTransport(2).Do(context.Background(), method, url, nil, nil)
+		var statusErr *StatusError
+		if err == nil || errors.As(err, &statusErr) {
+			t.Errorf("%s to a closed server returned %v, want a network error", method, err)
+		}
+	}
+}
+
+func TestTransportStopsWhenContextIsCancelled(t *testing.T) {
+	server, _ := scriptedServer(t, []int{503}, http.Header{"Retry-After": {"30"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := testTransport(3).Do(ctx, http.MethodGet, server.URL, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Do = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Do waited %s after the context ended", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{value: "", min: 0, max: 0},
+		{value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{value: "0", min: 0, max: 0},
+		{value: "-5", min: 0, max: 0},
+		{value: "soon", min: 0, max: 0},
+		{value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("retryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := NewTransport(data.TradingBrokerZerodha, ClientConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 0, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{attempt: 4, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 70, min: 500 * time.Millisecond, max: time.Second}, // the shift overflows
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := transport.backoff(tt.attempt); got < tt.min || got >= tt.max {
+				t.Fatalf("backoff(%d) = %s, want in [%s, %s)", tt.attempt, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	t.Setenv("KITE_API_URL", "http://localhost:9000/")
+	t.Setenv("KITE_RATE_LIMIT", "2.5")
+	t.Setenv("KITE_RATE_BURST", "0") // ignored
+	t.Setenv("BROKER_HTTP_TIMEOUT", "5s")
+	t.Setenv("BROKER_MAX_RETRIES", "nope") // ignored
+
+	config := LoadClientConfig(data.TradingBrokerZerodha)
+	want := DefaultClientConfig(data.TradingBrokerZerodha)
+	want.APIURL = "http://localhost:9000"
+	want.RateLimit = 2.5
+	want.Timeout = 5 * time.Second
+	if config != want {
+		t.Fatalf("LoadClientConfig = %+v, want %+v", config, want)
+	}
+}
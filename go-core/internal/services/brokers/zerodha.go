@@ -1,22 +1,28 @@
 package brokers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"go-core/internal/data"
+	"go-core/internal/services/matching"
 	"go-core/internal/utils"
 )
 
 // ZerodhaService implements BrokerService for Zerodha broker
-type ZerodhaService struct{}
+type ZerodhaService struct {
+	http *Transport
+}
 
 // NewZerodhaService creates a new Zerodha broker service
 func NewZerodhaService() *ZerodhaService {
-	return &ZerodhaService{}
+	return &ZerodhaService{http: transportFor(data.TradingBrokerZerodha)}
 }
 
 // GetBrokerName returns the broker name
@@ -58,6 +64,7 @@ func (z *ZerodhaService) ParseTrades(rawData []byte) ([]BrokerTrade, error) {
 	brokerTrades := make([]BrokerTrade, 0, len(response.Data))
 	for _, trade := range response.Data {
 		brokerTrade := BrokerTrade{
+			TradeID:         trade.TradeID,
 			Symbol:          trade.Tradingsymbol,
 			Quantity:        trade.Quantity,
 			Price:           trade.AveragePrice,
@@ -66,6 +73,8 @@ func (z *ZerodhaService) ParseTrades(rawData []byte) ([]BrokerTrade, error) {
 			OrderID:         trade.OrderID,
 			ProductType:     trade.Product,
 			ExchangeTime:    trade.FillTimestamp,
+			Exchange:        trade.Exchange,
+			SecurityID:      instrumentToken(trade.InstrumentToken),
 		}
 		brokerTrades = append(brokerTrades, brokerTrade)
 	}
@@ -82,45 +91,17 @@ func (z *ZerodhaService) ConvertToTrade(brokerTrade BrokerTrade, userID int) (*d
 // Zerodha API only allows fetching trades for the current day
 // apiKey is the Zerodha API key
 // accessToken is the Zerodha access token
-func (z *ZerodhaService) FetchTrades(apiKey, accessToken string) ([]BrokerTrade, error) {
+func (z *ZerodhaService) FetchTrades(ctx context.Context, apiKey, accessToken string) ([]BrokerTrade, error) {
 	// Build the API URL
-	url := "https://api.kite.trade/trades"
-
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("X-Kite-Version", "3")
-	req.Header.Set("Authorization", fmt.Sprintf("token %s:%s", apiKey, accessToken))
-
-	// Make HTTP request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	endpoint := z.http.Config().APIURL + "/trades"
 
 	utils.LogInfo("Fetching trades from Zerodha API", map[string]interface{}{
-		"url": url,
+		"url": endpoint,
 	})
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to Zerodha API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("zerodha API returned status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := z.http.Do(ctx, http.MethodGet, endpoint, kiteHeaders(apiKey, accessToken), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	// Parse JSON response using existing ParseTrades method
@@ -137,30 +118,99 @@ func (z *ZerodhaService) FetchTrades(apiKey, accessToken string) ([]BrokerTrade,
 }
 
 // FetchAndConvertTrades fetches today's trades from Zerodha API and converts them to internal Trade model
-// This is a convenience method that combines fetching and conversion
+// This is a convenience method that combines fetching and FIFO round-trip matching
 // apiKey is the Zerodha API key
 // accessToken is the Zerodha access token
 // userID is the user ID to associate the trades with
-func (z *ZerodhaService) FetchAndConvertTrades(apiKey, accessToken string, userID int) ([]*data.Trade, error) {
+func (z *ZerodhaService) FetchAndConvertTrades(ctx context.Context, apiKey, accessToken string, userID int) ([]*data.Trade, error) {
 	// Fetch trades from API
-	brokerTrades, err := z.FetchTrades(apiKey, accessToken)
+	brokerTrades, err := z.FetchTrades(ctx, apiKey, accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch trades: %w", err)
 	}
 
-	// Convert to internal Trade model
-	trades := make([]*data.Trade, 0, len(brokerTrades))
-	for _, brokerTrade := range brokerTrades {
-		trade, err := z.ConvertToTrade(brokerTrade, userID)
-		if err != nil {
-			utils.LogError(err, "Failed to convert broker trade", map[string]interface{}{
-				"symbol":   brokerTrade.Symbol,
-				"order_id": brokerTrade.OrderID,
-			})
-			continue // Skip this trade but continue with others
-		}
-		trades = append(trades, trade)
+	return BuildTrades(fillsFromBrokerTrades(brokerTrades), nil, matching.MethodFIFO, userID, data.TradingBrokerZerodha).New, nil
+}
+
+// ZerodhaSessionResponse represents the data returned by the Kite session token API
+type ZerodhaSessionResponse struct {
+	UserID        string `json:"user_id"`
+	UserName      string `json:"user_name"`
+	UserShortname string `json:"user_shortname"`
+	Email         string `json:"email"`
+	Broker        string `json:"broker"`
+	AccessToken   string `json:"access_token"`
+	PublicToken   string `json:"public_token"`
+	LoginTime     string `json:"login_time"`
+}
+
+// LoginURL builds the Kite Connect login URL for an API key
+// redirectParams are sent back to the app's redirect URL along with the request_token
+func (z *ZerodhaService) LoginURL(apiKey string, redirectParams url.Values) string {
+	query := url.Values{}
+	query.Set("v", "3")
+	query.Set("api_key", apiKey)
+	if len(redirectParams) > 0 {
+		query.Set("redirect_params", redirectParams.Encode())
+	}
+	return z.http.Config().AuthURL + "/connect/login?" + query.Encode()
+}
+
+// GenerateSession exchanges a request_token from the login redirect for an access token
+// apiKey is the Kite Connect API key
+// requestToken is the request_token Kite appended to the redirect URL
+// apiSecret is the Kite Connect API secret, used only to sign the checksum
+func (z *ZerodhaService) GenerateSession(ctx context.Context, apiKey, requestToken, apiSecret string) (*ZerodhaSessionResponse, error) {
+	// Kite verifies the request with SHA-256(api_key + request_token + api_secret)
+	sum := sha256.Sum256([]byte(apiKey + requestToken + apiSecret))
+
+	form := url.Values{}
+	form.Set("api_key", apiKey)
+	form.Set("request_token", requestToken)
+	form.Set("checksum", hex.EncodeToString(sum[:]))
+
+	endpoint := z.http.Config().APIURL + "/session/token"
+
+	// Set headers
+	header := http.Header{}
+	header.Set("X-Kite-Version", "3")
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	utils.LogInfo("Generating Zerodha session", map[string]interface{}{
+		"url": endpoint,
+	})
+
+	bodyBytes, err := z.http.Do(ctx, http.MethodPost, endpoint, header, []byte(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var response struct {
+		Status string                 `json:"status"`
+		Data   ZerodhaSessionResponse `json:"data"`
+	}
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse Zerodha API response: %w", err)
+	}
+	if response.Status != "success" || response.Data.AccessToken == "" {
+		return nil, fmt.Errorf("zerodha API returned non-success status: %s", response.Status)
 	}
 
-	return trades, nil
+	utils.LogInfo("Successfully generated Zerodha session", map[string]interface{}{
+		"zerodha_user_id": response.Data.UserID,
+	})
+
+	return &response.Data, nil
+}
+
+// ZerodhaSessionExpiry returns when a Kite session created at loginTime expires
+// Kite invalidates every access token at 6 AM IST the next morning, irrespective of when it was created.
+func ZerodhaSessionExpiry(loginTime time.Time) time.Time {
+	local := loginTime.In(utils.IST)
+	expiry := time.Date(local.Year(), local.Month(), local.Day(), 6, 0, 0, 0, utils.IST)
+	if !local.Before(expiry) {
+		expiry = expiry.AddDate(0, 0, 1)
+	}
+	return expiry
 }
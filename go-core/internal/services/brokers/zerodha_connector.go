@@ -0,0 +1,334 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+)
+
+// Capabilities reports what the Zerodha connector supports
+// Kite Connect only returns the current day's trades and its tokens cannot be renewed.
+func (z *ZerodhaService) Capabilities() Capabilities {
+	return Capabilities{
+		Broker:       data.TradingBrokerZerodha,
+		AuthFlow:     AuthFlowRequestToken,
+		TokenRefresh: false,
+		TradeHistory: false,
+		Positions:    true,
+		Holdings:     true,
+		Funds:        true,
+		Orders:       true,
+		OrderHistory: true,
+	}
+}
+
+// BeginAuth returns the Kite Connect login URL for the user's API key
+func (z *ZerodhaService) BeginAuth(ctx context.Context, config *data.BrokerConfig) (*AuthStart, error) {
+	if config.APIKey == nil || *config.APIKey == "" {
+		return nil, fmt.Errorf("API key not configured")
+	}
+
+	return &AuthStart{LoginURL: z.LoginURL(*config.APIKey, nil)}, nil
+}
+
+// CompleteAuth exchanges the request_token Kite redirected back with for a session
+func (z *ZerodhaService) CompleteAuth(ctx context.Context, config *data.BrokerConfig, params map[string]string) error {
+	requestToken := params["request_token"]
+	if requestToken == "" {
+		return fmt.Errorf("request_token is required")
+	}
+	if config.APIKey == nil || config.APISecret == nil {
+		return fmt.Errorf("API key and secret not configured")
+	}
+
+	response, err := z.GenerateSession(ctx, *config.APIKey, requestToken, *config.APISecret)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiryTime := ZerodhaSessionExpiry(now)
+	config.AccessToken = response.AccessToken
+	config.ZerodhaUserID = &response.UserID
+	config.ZerodhaUserName = &response.UserName
+	config.ExpiryTime = &expiryTime
+	config.ConfiguredAt = now
+	return nil
+}
+
+// RefreshToken is not available: Kite sessions end daily and need a fresh login
+func (z *ZerodhaService) RefreshToken(ctx context.Context, config *data.BrokerConfig) error {
+	return fmt.Errorf("kite token refresh: %w", ErrNotSupported)
+}
+
+// FetchFills fetches today's executions from Kite and keeps those inside the date range
+func (z *ZerodhaService) FetchFills(ctx context.Context, config *data.BrokerConfig, from, to time.Time) ([]matching.Fill, error) {
+	if config.APIKey == nil {
+		return nil, fmt.Errorf("API key not configured")
+	}
+
+	brokerTrades, err := z.FetchTrades(ctx, *config.APIKey, config.AccessToken)
+	if err != nil {
+		return nil, zerodhaError(fmt.Errorf("failed to fetch trades: %w", err))
+	}
+
+	end := to.AddDate(0, 0, 1)
+	fills := make([]matching.Fill, 0, len(brokerTrades))
+	for _, fill := range fillsFromBrokerTrades(brokerTrades) {
+		if fill.Time.Before(from) || !fill.Time.Before(end) {
+			continue
+		}
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// kitePosition is a row of Kite's /portfolio/positions response
+type kitePosition struct {
+	Tradingsymbol   string  `json:"tradingsymbol"`
+	InstrumentToken int     `json:"instrument_token"`
+	Exchange        string  `json:"exchange"`
+	Product         string  `json:"product"`
+	Quantity        int     `json:"quantity"`
+	AveragePrice    float64 `json:"average_price"`
+	LastPrice       float64 `json:"last_price"`
+	PnL             float64 `json:"pnl"`
+	M2M             float64 `json:"m2m"`
+}
+
+// FetchPositions fetches open net positions from Kite
+func (z *ZerodhaService) FetchPositions(ctx context.Context, config *data.BrokerConfig) ([]Position, error) {
+	var response struct {
+		Net []kitePosition `json:"net"`
+	}
+	if err := z.get(ctx, config, "/portfolio/positions", &response); err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, 0, len(response.Net))
+	for _, row := range response.Net {
+		if row.Quantity == 0 {
+			continue // closed during the day
+		}
+		positions = append(positions, Position{
+			Symbol:       row.Tradingsymbol,
+			Exchange:     row.Exchange,
+			SecurityID:   instrumentToken(row.InstrumentToken),
+			ProductType:  row.Product,
+			Quantity:     row.Quantity,
+			AveragePrice: row.AveragePrice,
+			LastPrice:    row.LastPrice,
+			DayPnL:       row.M2M,
+			PnL:          row.PnL,
+		})
+	}
+	return positions, nil
+}
+
+// kiteHolding is a row of Kite's /portfolio/holdings response
+type kiteHolding struct {
+	Tradingsymbol   string  `json:"tradingsymbol"`
+	InstrumentToken int     `json:"instrument_token"`
+	Exchange        string  `json:"exchange"`
+	ISIN            string  `json:"isin"`
+	Quantity        int     `json:"quantity"`
+	T1Quantity      int     `json:"t1_quantity"`
+	AveragePrice    float64 `json:"average_price"`
+	LastPrice       float64 `json:"last_price"`
+	PnL             float64 `json:"pnl"`
+	DayChange       float64 `json:"day_change"`
+}
+
+// FetchHoldings fetches demat holdings from Kite, including T1 shares awaiting delivery
+func (z *ZerodhaService) FetchHoldings(ctx context.Context, config *data.BrokerConfig) ([]Holding, error) {
+	var rows []kiteHolding
+	if err := z.get(ctx, config, "/portfolio/holdings", &rows); err != nil {
+		return nil, err
+	}
+
+	holdings := make([]Holding, 0, len(rows))
+	for _, row := range rows {
+		quantity := row.Quantity + row.T1Quantity
+		holdings = append(holdings, Holding{
+			Symbol:       row.Tradingsymbol,
+			Exchange:     row.Exchange,
+			SecurityID:   instrumentToken(row.InstrumentToken),
+			ISIN:         row.ISIN,
+			Quantity:     quantity,
+			AveragePrice: row.AveragePrice,
+			LastPrice:    row.LastPrice,
+			DayPnL:       row.DayChange * float64(quantity),
+			PnL:          row.PnL,
+		})
+	}
+	return holdings, nil
+}
+
+// FetchFunds fetches the equity segment balance from Kite
+func (z *ZerodhaService) FetchFunds(ctx context.Context, config *data.BrokerConfig) (*Funds, error) {
+	var response struct {
+		Equity struct {
+			Net       float64 `json:"net"`
+			Available struct {
+				Collateral  float64 `json:"collateral"`
+				LiveBalance float64 `json:"live_balance"`
+			} `json:"available"`
+			Utilised struct {
+				Debits float64 `json:"debits"`
+			} `json:"utilised"`
+		} `json:"equity"`
+	}
+	if err := z.get(ctx, config, "/user/margins", &response); err != nil {
+		return nil, err
+	}
+
+	return &Funds{
+		Available:    response.Equity.Net,
+		Utilised:     response.Equity.Utilised.Debits,
+		Collateral:   response.Equity.Available.Collateral,
+		Withdrawable: response.Equity.Available.LiveBalance,
+	}, nil
+}
+
+// kiteOrder is a row of Kite's /orders and /orders/{order_id} responses
+type kiteOrder struct {
+	OrderID                 string  `json:"order_id"`
+	ExchangeOrderID         string  `json:"exchange_order_id"`
+	ParentOrderID           string  `json:"parent_order_id"`
+	Status                  string  `json:"status"`
+	StatusMessage           string  `json:"status_message"`
+	OrderTimestamp          string  `json:"order_timestamp"`
+	ExchangeUpdateTimestamp string  `json:"exchange_update_timestamp"`
+	Exchange                string  `json:"exchange"`
+	Tradingsymbol           string  `json:"tradingsymbol"`
+	InstrumentToken         int     `json:"instrument_token"`
+	OrderType               string  `json:"order_type"`
+	TransactionType         string  `json:"transaction_type"`
+	Product                 string  `json:"product"`
+	Quantity                int     `json:"quantity"`
+	FilledQuantity          int     `json:"filled_quantity"`
+	Price                   float64 `json:"price"`
+	TriggerPrice            float64 `json:"trigger_price"`
+	AveragePrice            float64 `json:"average_price"`
+}
+
+// updatedAt is when Kite last changed the order
+func (o kiteOrder) updatedAt() time.Time {
+	return orderTime(o.OrderID, o.ExchangeUpdateTimestamp, o.OrderTimestamp)
+}
+
+// FetchOrders fetches the day's order book from Kite with each order's full history
+// Kite's order history lists every state an order went through, so modifications are not lost between syncs.
+func (z *ZerodhaService) FetchOrders(ctx context.Context, config *data.BrokerConfig) ([]Order, error) {
+	var rows []kiteOrder
+	if err := z.get(ctx, config, "/orders", &rows); err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(rows))
+	for _, row := range rows {
+		order := Order{
+			OrderID:         row.OrderID,
+			ExchangeOrderID: row.ExchangeOrderID,
+			ParentOrderID:   row.ParentOrderID,
+			Symbol:          row.Tradingsymbol,
+			Exchange:        row.Exchange,
+			SecurityID:      instrumentToken(row.InstrumentToken),
+			ProductType:     row.Product,
+			OrderType:       row.OrderType,
+			Side:            strings.ToLower(row.TransactionType),
+			Quantity:        row.Quantity,
+			FilledQuantity:  row.FilledQuantity,
+			Price:           row.Price,
+			TriggerPrice:    row.TriggerPrice,
+			AveragePrice:    row.AveragePrice,
+			Status:          NormalizeOrderStatus(row.Status),
+			BrokerStatus:    row.Status,
+			StatusMessage:   row.StatusMessage,
+			PlacedAt:        orderTime(row.OrderID, row.OrderTimestamp),
+			UpdatedAt:       row.updatedAt(),
+		}
+
+		var history []kiteOrder
+		if err := z.get(ctx, config, "/orders/"+url.PathEscape(row.OrderID), &history); err != nil {
+			return nil, fmt.Errorf("failed to fetch history of order %s: %w", row.OrderID, err)
+		}
+		for _, state := range history {
+			order.Events = append(order.Events, OrderEvent{
+				Status:         NormalizeOrderStatus(state.Status),
+				BrokerStatus:   state.Status,
+				Quantity:       state.Quantity,
+				FilledQuantity: state.FilledQuantity,
+				Price:          state.Price,
+				TriggerPrice:   state.TriggerPrice,
+				Message:        state.StatusMessage,
+				Time:           state.updatedAt(),
+			})
+		}
+		if len(order.Events) == 0 {
+			order.Events = []OrderEvent{latestOrderEvent(order)}
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// get calls a Kite Connect endpoint and decodes the data field of the response into out
+func (z *ZerodhaService) get(ctx context.Context, config *data.BrokerConfig, path string, out interface{}) error {
+	if config.APIKey == nil {
+		return fmt.Errorf("API key not configured")
+	}
+
+	bodyBytes, err := z.http.Do(ctx, http.MethodGet, z.http.Config().APIURL+path, kiteHeaders(*config.APIKey, config.AccessToken), nil)
+	if err != nil {
+		return zerodhaError(err)
+	}
+
+	var envelope struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(bodyBytes, &envelope); err != nil {
+		return fmt.Errorf("failed to parse Zerodha API response: %w", err)
+	}
+	if envelope.Status != "success" {
+		return fmt.Errorf("zerodha API returned non-success status: %s", envelope.Status)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("failed to parse Zerodha API response: %w", err)
+	}
+	return nil
+}
+
+// kiteHeaders returns the headers of a Kite Connect call made with a user's access token
+func kiteHeaders(apiKey, accessToken string) http.Header {
+	header := http.Header{}
+	header.Set("X-Kite-Version", "3")
+	header.Set("Authorization", fmt.Sprintf("token %s:%s", apiKey, accessToken))
+	return header
+}
+
+// zerodhaError marks errors caused by a rejected access token with ErrInvalidToken
+// Kite answers 403 with a TokenException once the session has expired or been revoked
+func zerodhaError(err error) error {
+	if isStatus(err, http.StatusForbidden) || strings.Contains(err.Error(), "TokenException") {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return err
+}
+
+// instrumentToken formats Kite's numeric instrument_token as a security ID, empty when absent
+func instrumentToken(token int) string {
+	if token == 0 {
+		return ""
+	}
+	return strconv.Itoa(token)
+}
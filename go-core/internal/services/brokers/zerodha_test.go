@@ -0,0 +1,75 @@
+package brokers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+func TestGenerateSessionChecksum(t *testing.T) {
+	testutil.QuietLogs()
+
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/session/token" {
+			t.Errorf("request %s %s, want POST /session/token", r.Method, r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		form = r.PostForm
+		w.Write([]byte(`{"status":"success","data":{"user_id":"AB1234","access_token":"session-token"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	z := &ZerodhaService{http: NewTransport(data.TradingBrokerZerodha, ClientConfig{APIURL: server.URL, Timeout: time.Second})}
+	session, err := z.GenerateSession(context.Background(), "kite_api_key", "request_token", "kite_api_secret")
+	if err != nil {
+		t.Fatalf("GenerateSession: %v", err)
+	}
+	if session.AccessToken != "session-token" || session.UserID != "AB1234" {
+		t.Errorf("session = %+v", session)
+	}
+
+	// SHA-256 of "kite_api_key" + "request_token" + "kite_api_secret"; the secret itself is never sent
+	const checksum = "44cf3934d6008170eacce534a9ed702f02d6e35ac96c78fc097677bf782943c3"
+	if got := form.Get("checksum"); got != checksum {
+		t.Errorf("checksum = %q, want %q", got, checksum)
+	}
+	if form.Get("api_key") != "kite_api_key" || form.Get("request_token") != "request_token" || form.Has("api_secret") {
+		t.Errorf("form = %v, want api_key, request_token and checksum only", form)
+	}
+}
+
+func TestZerodhaSessionExpiry(t *testing.T) {
+	at := func(day, hour, minute, second int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, second, 0, utils.IST)
+	}
+	tests := []struct {
+		name      string
+		loginTime time.Time
+		want      time.Time
+	}{
+		{name: "just before 6 AM expires the same morning", loginTime: at(5, 5, 59, 59), want: at(5, 6, 0, 0)},
+		{name: "at 6 AM expires the next morning", loginTime: at(5, 6, 0, 0), want: at(6, 6, 0, 0)},
+		{name: "just after 6 AM expires the next morning", loginTime: at(5, 6, 0, 1), want: at(6, 6, 0, 0)},
+		{name: "late evening expires the next morning", loginTime: at(5, 23, 30, 0), want: at(6, 6, 0, 0)},
+		{name: "UTC login before 6 AM IST", loginTime: time.Date(2024, 3, 5, 0, 29, 0, 0, time.UTC), want: at(5, 6, 0, 0)},
+		{name: "UTC login after 6 AM IST", loginTime: time.Date(2024, 3, 5, 0, 31, 0, 0, time.UTC), want: at(6, 6, 0, 0)},
+		{name: "month end", loginTime: at(31, 9, 15, 0), want: time.Date(2024, 4, 1, 6, 0, 0, 0, utils.IST)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ZerodhaSessionExpiry(tt.loginTime); !got.Equal(tt.want) {
+				t.Errorf("ZerodhaSessionExpiry(%s) = %s, want %s", tt.loginTime, got.In(utils.IST), tt.want)
+			}
+		})
+	}
+}
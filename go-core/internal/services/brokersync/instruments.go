@@ -0,0 +1,32 @@
+package brokersync
+
+import (
+	"go-core/internal/data"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/instruments"
+	"go-core/internal/services/matching"
+)
+
+// normalizeFills replaces fill symbols with canonical trading symbols from the instrument master
+// Fills of instruments that are not in the master keep the broker's symbol.
+func normalizeFills(resolver *instruments.Resolver, broker data.TradingBroker, fills []matching.Fill) {
+	for i := range fills {
+		fills[i].Symbol = resolver.Symbol(broker, instruments.Ref{
+			Exchange:   fills[i].Exchange,
+			SecurityID: fills[i].SecurityID,
+			ISIN:       fills[i].ISIN,
+			Symbol:     fills[i].Symbol,
+		})
+	}
+}
+
+// normalizeOrders replaces order symbols with canonical trading symbols from the instrument master
+func normalizeOrders(resolver *instruments.Resolver, broker data.TradingBroker, orders []brokers.Order) {
+	for i := range orders {
+		orders[i].Symbol = resolver.Symbol(broker, instruments.Ref{
+			Exchange:   orders[i].Exchange,
+			SecurityID: orders[i].SecurityID,
+			Symbol:     orders[i].Symbol,
+		})
+	}
+}
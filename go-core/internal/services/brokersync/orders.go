@@ -0,0 +1,397 @@
+package brokersync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/instruments"
+	"go-core/internal/utils"
+)
+
+// ErrTradeNotFound is returned when a trade does not exist for the user
+var ErrTradeNotFound = errors.New("trade not found")
+
+// OrderSyncResult reports what an order book sync stored
+type OrderSyncResult struct {
+	Fetched int `json:"total_fetched"`
+	Created int `json:"created_count"`
+	Updated int `json:"updated_count"`
+	Events  int `json:"events_count"` // new status transitions and modifications
+}
+
+// OrderRole is how an order relates to a journal trade
+type OrderRole string
+
+const (
+	OrderRoleEntry   OrderRole = "entry"   // the order that opened the trade
+	OrderRoleExit    OrderRole = "exit"    // the order whose fill closed the trade
+	OrderRoleRelated OrderRole = "related" // another order on the symbol while the trade was open, such as a stop loss
+)
+
+// TimelineOrder is an order in a trade's timeline with its fills
+type TimelineOrder struct {
+	*data.BrokerOrder
+	Role          OrderRole          `json:"role"`
+	Modifications int                `json:"modifications"` // price, trigger or quantity changes
+	Fills         []*data.BrokerFill `json:"fills"`
+}
+
+// TimelineEntry is one event in a trade's order timeline
+type TimelineEntry struct {
+	Time           time.Time `json:"time"`
+	OrderID        string    `json:"order_id"`
+	Role           OrderRole `json:"role"`
+	Kind           string    `json:"kind"` // placed | modified | status | fill
+	Status         string    `json:"status,omitempty"`
+	Side           string    `json:"side"`
+	Quantity       int       `json:"quantity"`
+	FilledQuantity int       `json:"filled_quantity,omitempty"`
+	Price          float64   `json:"price"`
+	TriggerPrice   float64   `json:"trigger_price,omitempty"`
+	Message        *string   `json:"message,omitempty"`
+}
+
+// Timeline is the order history behind a journal trade
+type Timeline struct {
+	TradeID       string          `json:"trade_id"`
+	Symbol        string          `json:"symbol"`
+	Broker        string          `json:"trading_broker"`
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	Orders        []TimelineOrder `json:"orders"`
+	Entries       []TimelineEntry `json:"timeline"`
+	Modifications int             `json:"modifications"`
+	Cancelled     int             `json:"cancelled_count"`
+	Rejected      int             `json:"rejected_count"`
+}
+
+// SyncOrders fetches the broker's order book and records new orders and state changes
+func (s *Service) SyncOrders(ctx context.Context, userID int, broker data.TradingBroker) (*OrderSyncResult, error) {
+	connector, err := s.connector(broker)
+	if err != nil {
+		return nil, err
+	}
+	_, config, err := s.LoadConfig(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+	return s.syncOrders(ctx, userID, connector, config)
+}
+
+// syncOrders fetches the order book and stores it in one transaction
+func (s *Service) syncOrders(ctx context.Context, userID int, connector brokers.Connector, config *data.BrokerConfig) (*OrderSyncResult, error) {
+	broker := connector.GetBrokerName()
+	if !connector.Capabilities().Orders {
+		return nil, fmt.Errorf("order book: %w", brokers.ErrNotSupported)
+	}
+
+	orders, err := connector.FetchOrders(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch orders: %w", err)
+	}
+	normalizeOrders(instruments.NewResolver(s.db), broker, orders)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repos.NewBrokerOrderRepository(s.db).WithTx(tx)
+	result := &OrderSyncResult{Fetched: len(orders)}
+	now := time.Now()
+	for _, order := range orders {
+		if order.OrderID == "" {
+			continue
+		}
+
+		stored, err := repo.GetOrderByBrokerID(userID, broker, order.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		row := &data.BrokerOrder{
+			ID:              utils.GenerateID(),
+			UserID:          userID,
+			TradingBroker:   broker,
+			OrderID:         order.OrderID,
+			ExchangeOrderID: utils.OptionalString(order.ExchangeOrderID),
+			ParentOrderID:   utils.OptionalString(order.ParentOrderID),
+			Symbol:          order.Symbol,
+			Exchange:        utils.OptionalString(order.Exchange),
+			ProductType:     utils.OptionalString(order.ProductType),
+			OrderType:       utils.OptionalString(order.OrderType),
+			Side:            order.Side,
+			Quantity:        order.Quantity,
+			FilledQuantity:  order.FilledQuantity,
+			Price:           order.Price,
+			TriggerPrice:    order.TriggerPrice,
+			AveragePrice:    order.AveragePrice,
+			Status:          string(order.Status),
+			BrokerStatus:    order.BrokerStatus,
+			StatusMessage:   utils.OptionalString(order.StatusMessage),
+			PlacedAt:        order.PlacedAt,
+			LastUpdatedAt:   order.UpdatedAt,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if stored == nil {
+			if err := repo.CreateOrder(row); err != nil {
+				return nil, err
+			}
+			result.Created++
+		} else {
+			row.ID = stored.ID
+			row.CreatedAt = stored.CreatedAt
+			if orderChanged(stored, row) {
+				if err := repo.UpdateOrder(row); err != nil {
+					return nil, err
+				}
+				result.Updated++
+			}
+		}
+
+		for _, event := range order.Events {
+			created, err := repo.CreateEvent(&data.BrokerOrderEvent{
+				ID:             utils.GenerateID(),
+				BrokerOrderID:  row.ID,
+				UserID:         userID,
+				Status:         string(event.Status),
+				BrokerStatus:   event.BrokerStatus,
+				Quantity:       event.Quantity,
+				FilledQuantity: event.FilledQuantity,
+				Price:          event.Price,
+				TriggerPrice:   event.TriggerPrice,
+				Message:        utils.OptionalString(event.Message),
+				EventTime:      event.Time,
+				CreatedAt:      now,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if created {
+				result.Events++
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListOrders returns a user's recorded orders with their events
+func (s *Service) ListOrders(userID int, filter repos.BrokerOrderFilter) ([]*data.BrokerOrder, error) {
+	repo := repos.NewBrokerOrderRepository(s.db)
+	orders, err := repo.GetOrders(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.LoadEvents(userID, orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = make([]*data.BrokerOrder, 0)
+	}
+	return orders, nil
+}
+
+// TradeTimeline returns the orders behind a broker-imported trade as a single timeline
+// It holds the entry order, the order whose fill closed the trade, and every other order on the
+// symbol placed between the start of the entry day and the end of the exit day (or now while open),
+// which is where stop-loss modifications and cancelled exits show up.
+func (s *Service) TradeTimeline(userID int, tradeID string) (*Timeline, error) {
+	trade, err := repos.NewTradeRepository(s.db).GetTradeByID(tradeID, userID)
+	if err != nil {
+		return nil, ErrTradeNotFound
+	}
+	if trade.TradingBroker == nil {
+		return nil, fmt.Errorf("trade was not imported from a broker")
+	}
+	broker := *trade.TradingBroker
+
+	from := trade.EntryDate.Truncate(24 * time.Hour)
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if trade.ExitDate != nil {
+		to = trade.ExitDate.Truncate(24*time.Hour).AddDate(0, 0, 1)
+	}
+
+	orderRepo := repos.NewBrokerOrderRepository(s.db)
+	fillRepo := repos.NewBrokerFillRepository(s.db)
+
+	// The exit order is the one whose fill happened at the exit time on the closing side
+	var entryOrderID, exitOrderID string
+	if trade.OrderID != nil {
+		entryOrderID = *trade.OrderID
+	}
+	if trade.ExitDate != nil {
+		closingSide := "sell"
+		if trade.Direction == data.TradeDirectionShort {
+			closingSide = "buy"
+		}
+		exitFills, err := fillRepo.GetFillsInRange(userID, broker, *trade.ExitDate, trade.ExitDate.Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		for _, fill := range exitFills {
+			if fill.Side == closingSide && fill.OrderID != nil && equalSymbol(fill.Symbol, trade.Symbol) {
+				exitOrderID = *fill.OrderID
+				break
+			}
+		}
+	}
+
+	related, err := orderRepo.GetOrders(userID, repos.BrokerOrderFilter{
+		TradingBroker: &broker,
+		Symbol:        &trade.Symbol,
+		From:          &from,
+		To:            &to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var linkedIDs []string
+	for _, orderID := range []string{entryOrderID, exitOrderID} {
+		if orderID != "" {
+			linkedIDs = append(linkedIDs, orderID)
+		}
+	}
+	var linked []*data.BrokerOrder
+	if len(linkedIDs) > 0 {
+		linked, err = orderRepo.GetOrders(userID, repos.BrokerOrderFilter{TradingBroker: &broker, OrderIDs: linkedIDs})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Merge linked and related orders, keeping each order once
+	var orders []*data.BrokerOrder
+	seen := make(map[string]bool)
+	for _, order := range append(linked, related...) {
+		if seen[order.OrderID] {
+			continue
+		}
+		seen[order.OrderID] = true
+		orders = append(orders, order)
+	}
+	if err := orderRepo.LoadEvents(userID, orders); err != nil {
+		return nil, err
+	}
+
+	orderIDs := make([]string, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+	fills, err := fillRepo.GetFillsByOrderIDs(userID, broker, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	fillsByOrder := make(map[string][]*data.BrokerFill)
+	for _, fill := range fills {
+		if fill.OrderID != nil {
+			fillsByOrder[*fill.OrderID] = append(fillsByOrder[*fill.OrderID], fill)
+		}
+	}
+
+	timeline := &Timeline{
+		TradeID: trade.ID,
+		Symbol:  trade.Symbol,
+		Broker:  string(broker),
+		From:    from,
+		To:      to,
+		Orders:  make([]TimelineOrder, 0, len(orders)),
+		Entries: make([]TimelineEntry, 0),
+	}
+	for _, order := range orders {
+		role := OrderRoleRelated
+		switch order.OrderID {
+		case entryOrderID:
+			role = OrderRoleEntry
+		case exitOrderID:
+			role = OrderRoleExit
+		}
+
+		entry := TimelineOrder{BrokerOrder: order, Role: role, Fills: fillsByOrder[order.OrderID]}
+		if entry.Fills == nil {
+			entry.Fills = make([]*data.BrokerFill, 0)
+		}
+
+		var previous *data.BrokerOrderEvent
+		for _, event := range order.Events {
+			kind := "status"
+			switch {
+			case previous == nil:
+				kind = "placed"
+			case event.Price != previous.Price || event.TriggerPrice != previous.TriggerPrice || event.Quantity != previous.Quantity:
+				kind = "modified"
+				entry.Modifications++
+			case event.Status == previous.Status && event.FilledQuantity == previous.FilledQuantity:
+				previous = event
+				continue // same state re-reported by the broker
+			}
+			timeline.Entries = append(timeline.Entries, TimelineEntry{
+				Time:           event.EventTime,
+				OrderID:        order.OrderID,
+				Role:           role,
+				Kind:           kind,
+				Status:         event.Status,
+				Side:           order.Side,
+				Quantity:       event.Quantity,
+				FilledQuantity: event.FilledQuantity,
+				Price:          event.Price,
+				TriggerPrice:   event.TriggerPrice,
+				Message:        event.Message,
+			})
+			previous = event
+		}
+		for _, fill := range entry.Fills {
+			timeline.Entries = append(timeline.Entries, TimelineEntry{
+				Time:     fill.FillTime,
+				OrderID:  order.OrderID,
+				Role:     role,
+				Kind:     "fill",
+				Side:     fill.Side,
+				Quantity: fill.Quantity,
+				Price:    fill.Price,
+			})
+		}
+
+		timeline.Modifications += entry.Modifications
+		switch brokers.OrderStatus(order.Status) {
+		case brokers.OrderStatusCancelled:
+			timeline.Cancelled++
+		case brokers.OrderStatusRejected:
+			timeline.Rejected++
+		}
+		timeline.Orders = append(timeline.Orders, entry)
+	}
+	sort.SliceStable(timeline.Entries, func(i, j int) bool {
+		return timeline.Entries[i].Time.Before(timeline.Entries[j].Time)
+	})
+
+	return timeline, nil
+}
+
+// orderChanged reports whether the broker's latest state differs from the stored order
+func orderChanged(stored, latest *data.BrokerOrder) bool {
+	return stored.BrokerStatus != latest.BrokerStatus ||
+		stored.FilledQuantity != latest.FilledQuantity ||
+		stored.Quantity != latest.Quantity ||
+		stored.Price != latest.Price ||
+		stored.TriggerPrice != latest.TriggerPrice ||
+		stored.AveragePrice != latest.AveragePrice ||
+		!stored.LastUpdatedAt.Equal(latest.LastUpdatedAt)
+}
+
+// equalSymbol compares broker symbols case-insensitively
+func equalSymbol(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
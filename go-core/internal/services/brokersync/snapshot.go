@@ -0,0 +1,259 @@
+package brokersync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/instruments"
+	"go-core/internal/utils"
+)
+
+// DiscrepancyKind names how the broker and the journal disagree about a symbol
+type DiscrepancyKind string
+
+const (
+	// DiscrepancyNotJournaled is held at the broker with no open journal trade
+	DiscrepancyNotJournaled DiscrepancyKind = "not_journaled"
+	// DiscrepancyNotAtBroker is open in the journal but not held at the broker
+	DiscrepancyNotAtBroker DiscrepancyKind = "not_at_broker"
+	// DiscrepancyQuantity is held on both sides with different net quantities
+	DiscrepancyQuantity DiscrepancyKind = "quantity_mismatch"
+)
+
+// Discrepancy is a symbol whose net quantity at the broker differs from the open journal trades
+// Quantities are signed: positive is long, negative is short.
+type Discrepancy struct {
+	Kind            DiscrepancyKind `json:"kind"`
+	Symbol          string          `json:"symbol"`
+	BrokerQuantity  int             `json:"broker_quantity"`
+	JournalQuantity int             `json:"journal_quantity"`
+	Difference      int             `json:"difference"` // broker minus journal
+	TradeIDs        []string        `json:"trade_ids,omitempty"`
+}
+
+// OpenPosition is a snapshot row presented as an open trade
+type OpenPosition struct {
+	*data.BrokerPosition
+	Direction data.TradeDirection `json:"direction"`
+	Journaled bool                `json:"journaled"` // an open journal trade holds the same symbol and quantity
+}
+
+// Portfolio is the latest broker snapshot compared against the journal
+type Portfolio struct {
+	Broker        data.TradingBroker `json:"trading_broker"`
+	SyncedAt      *time.Time         `json:"synced_at"`
+	Positions     []OpenPosition     `json:"positions"`
+	Holdings      []OpenPosition     `json:"holdings"`
+	Discrepancies []Discrepancy      `json:"discrepancies"`
+}
+
+// SnapshotResult reports what a snapshot captured
+type SnapshotResult struct {
+	Positions int       `json:"positions_count"`
+	Holdings  int       `json:"holdings_count"`
+	SyncedAt  time.Time `json:"synced_at"`
+}
+
+// SyncSnapshot replaces the stored positions and holdings snapshot with the broker's current one
+func (s *Service) SyncSnapshot(ctx context.Context, userID int, broker data.TradingBroker) (*SnapshotResult, error) {
+	connector, err := s.connector(broker)
+	if err != nil {
+		return nil, err
+	}
+	_, config, err := s.LoadConfig(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+	return s.syncSnapshot(ctx, userID, connector, config)
+}
+
+// syncSnapshot fetches positions and holdings and stores them in one transaction
+func (s *Service) syncSnapshot(ctx context.Context, userID int, connector brokers.Connector, config *data.BrokerConfig) (*SnapshotResult, error) {
+	capabilities := connector.Capabilities()
+	syncedAt := time.Now().UTC()
+	resolver := instruments.NewResolver(s.db)
+
+	var rows []*data.BrokerPosition
+	if capabilities.Positions {
+		positions, err := connector.FetchPositions(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch positions: %w", err)
+		}
+		for _, position := range positions {
+			symbol := resolver.Symbol(capabilities.Broker, instruments.Ref{
+				Exchange: position.Exchange, SecurityID: position.SecurityID, Symbol: position.Symbol,
+			})
+			rows = append(rows, &data.BrokerPosition{
+				ID:            utils.GenerateID(),
+				UserID:        userID,
+				TradingBroker: capabilities.Broker,
+				Kind:          data.BrokerPositionKindPosition,
+				Symbol:        symbol,
+				Exchange:      utils.OptionalString(position.Exchange),
+				ProductType:   utils.OptionalString(position.ProductType),
+				Quantity:      position.Quantity,
+				AveragePrice:  position.AveragePrice,
+				LastPrice:     position.LastPrice,
+				DayPnL:        position.DayPnL,
+				PnL:           position.PnL,
+				SyncedAt:      syncedAt,
+			})
+		}
+	}
+	if capabilities.Holdings {
+		holdings, err := connector.FetchHoldings(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch holdings: %w", err)
+		}
+		for _, holding := range holdings {
+			if holding.Quantity == 0 {
+				continue
+			}
+			symbol := resolver.Symbol(capabilities.Broker, instruments.Ref{
+				Exchange: holding.Exchange, SecurityID: holding.SecurityID, ISIN: holding.ISIN, Symbol: holding.Symbol,
+			})
+			rows = append(rows, &data.BrokerPosition{
+				ID:            utils.GenerateID(),
+				UserID:        userID,
+				TradingBroker: capabilities.Broker,
+				Kind:          data.BrokerPositionKindHolding,
+				Symbol:        symbol,
+				Exchange:      utils.OptionalString(holding.Exchange),
+				ISIN:          utils.OptionalString(holding.ISIN),
+				Quantity:      holding.Quantity,
+				AveragePrice:  holding.AveragePrice,
+				LastPrice:     holding.LastPrice,
+				DayPnL:        holding.DayPnL,
+				PnL:           holding.PnL,
+				SyncedAt:      syncedAt,
+			})
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repos.NewBrokerPositionRepository(s.db).WithTx(tx)
+	if err := repo.DeleteSnapshot(userID, capabilities.Broker); err != nil {
+		return nil, err
+	}
+	result := &SnapshotResult{SyncedAt: syncedAt}
+	for _, row := range rows {
+		if err := repo.CreatePosition(row); err != nil {
+			return nil, err
+		}
+		if row.Kind == data.BrokerPositionKindHolding {
+			result.Holdings++
+		} else {
+			result.Positions++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetPortfolio returns the stored snapshot for a broker with discrepancies against open journal trades
+// Symbols are compared case-insensitively and quantities are netted per symbol across positions and holdings.
+func (s *Service) GetPortfolio(userID int, broker data.TradingBroker) (*Portfolio, error) {
+	rows, err := repos.NewBrokerPositionRepository(s.db).GetSnapshot(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+	openTrades, err := repos.NewTradeRepository(s.db).GetOpenTradesByBroker(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+
+	type netQuantity struct {
+		symbol   string
+		broker   int
+		journal  int
+		tradeIDs []string
+	}
+	bySymbol := make(map[string]*netQuantity)
+	net := func(symbol string) *netQuantity {
+		key := strings.ToUpper(strings.TrimSpace(symbol))
+		if bySymbol[key] == nil {
+			bySymbol[key] = &netQuantity{symbol: symbol}
+		}
+		return bySymbol[key]
+	}
+
+	for _, row := range rows {
+		net(row.Symbol).broker += row.Quantity
+	}
+	for _, trade := range openTrades {
+		entry := net(trade.Symbol)
+		if trade.Direction == data.TradeDirectionShort {
+			entry.journal -= trade.Quantity
+		} else {
+			entry.journal += trade.Quantity
+		}
+		entry.tradeIDs = append(entry.tradeIDs, trade.ID)
+	}
+
+	portfolio := &Portfolio{
+		Broker:        broker,
+		Positions:     make([]OpenPosition, 0),
+		Holdings:      make([]OpenPosition, 0),
+		Discrepancies: make([]Discrepancy, 0),
+	}
+	for _, row := range rows {
+		if portfolio.SyncedAt == nil {
+			syncedAt := row.SyncedAt
+			portfolio.SyncedAt = &syncedAt
+		}
+		entry := net(row.Symbol)
+		open := OpenPosition{
+			BrokerPosition: row,
+			Direction:      data.TradeDirectionLong,
+			Journaled:      entry.broker == entry.journal,
+		}
+		if row.Quantity < 0 {
+			open.Direction = data.TradeDirectionShort
+		}
+		if row.Kind == data.BrokerPositionKindHolding {
+			portfolio.Holdings = append(portfolio.Holdings, open)
+		} else {
+			portfolio.Positions = append(portfolio.Positions, open)
+		}
+	}
+
+	for _, entry := range bySymbol {
+		if entry.broker == entry.journal {
+			continue
+		}
+		kind := DiscrepancyQuantity
+		switch {
+		case entry.journal == 0:
+			kind = DiscrepancyNotJournaled
+		case entry.broker == 0:
+			kind = DiscrepancyNotAtBroker
+		}
+		portfolio.Discrepancies = append(portfolio.Discrepancies, Discrepancy{
+			Kind:            kind,
+			Symbol:          entry.symbol,
+			BrokerQuantity:  entry.broker,
+			JournalQuantity: entry.journal,
+			Difference:      entry.broker - entry.journal,
+			TradeIDs:        entry.tradeIDs,
+		})
+	}
+	sort.Slice(portfolio.Discrepancies, func(i, j int) bool {
+		return portfolio.Discrepancies[i].Symbol < portfolio.Discrepancies[j].Symbol
+	})
+
+	return portfolio, nil
+}
@@ -0,0 +1,134 @@
+package brokersync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/utils"
+)
+
+func TestGetPortfolioDiscrepancies(t *testing.T) {
+	// row and trade build snapshot rows and open journal trades; negative quantities are shorts
+	type row struct {
+		kind     data.BrokerPositionKind
+		symbol   string
+		quantity int
+	}
+	type trade struct {
+		symbol   string
+		quantity int
+	}
+	position, holding := data.BrokerPositionKindPosition, data.BrokerPositionKindHolding
+
+	tests := []struct {
+		name          string
+		rows          []row
+		trades        []trade
+		want          []Discrepancy
+		wantJournaled bool // whether every snapshot row is reported as journaled
+	}{
+		{
+			name:          "positions and holdings net per symbol",
+			rows:          []row{{position, "INFY", 5}, {holding, "INFY", 10}},
+			trades:        []trade{{"INFY", 15}},
+			wantJournaled: true,
+		},
+		{
+			name:          "short position matches a short trade",
+			rows:          []row{{position, "SBIN", -20}},
+			trades:        []trade{{"SBIN", -20}},
+			wantJournaled: true,
+		},
+		{
+			name:          "symbols compare case-insensitively",
+			rows:          []row{{holding, "tcs", 5}},
+			trades:        []trade{{"TCS", 5}},
+			wantJournaled: true,
+		},
+		{
+			name: "held at the broker without a journal trade",
+			rows: []row{{holding, "HDFCBANK", 7}},
+			want: []Discrepancy{{Kind: DiscrepancyNotJournaled, Symbol: "HDFCBANK", BrokerQuantity: 7, Difference: 7}},
+		},
+		{
+			name:          "open in the journal but not at the broker",
+			trades:        []trade{{"WIPRO", 3}},
+			want:          []Discrepancy{{Kind: DiscrepancyNotAtBroker, Symbol: "WIPRO", JournalQuantity: 3, Difference: -3}},
+			wantJournaled: true,
+		},
+		{
+			name:   "different net quantities",
+			rows:   []row{{holding, "INFY", 10}},
+			trades: []trade{{"INFY", 4}},
+			want:   []Discrepancy{{Kind: DiscrepancyQuantity, Symbol: "INFY", BrokerQuantity: 10, JournalQuantity: 4, Difference: 6}},
+		},
+		{
+			name:   "short at the broker against a long trade",
+			rows:   []row{{position, "SBIN", -5}},
+			trades: []trade{{"SBIN", 5}},
+			want:   []Discrepancy{{Kind: DiscrepancyQuantity, Symbol: "SBIN", BrokerQuantity: -5, JournalQuantity: 5, Difference: -10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := data.TradingBrokerDhan
+			service, userID := newService(t, &fakeConnector{capabilities: brokers.Capabilities{Broker: broker}})
+			now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+			positions := repos.NewBrokerPositionRepository(service.db)
+			for _, r := range tt.rows {
+				if err := positions.CreatePosition(&data.BrokerPosition{
+					ID: utils.GenerateID(), UserID: userID, TradingBroker: broker, Kind: r.kind,
+					Symbol: r.symbol, Quantity: r.quantity, SyncedAt: now,
+				}); err != nil {
+					t.Fatalf("create position: %v", err)
+				}
+			}
+			trades := repos.NewTradeRepository(service.db)
+			for _, tr := range tt.trades {
+				direction, quantity := data.TradeDirectionLong, tr.quantity
+				if quantity < 0 {
+					direction, quantity = data.TradeDirectionShort, -quantity
+				}
+				if err := trades.CreateTrade(&data.Trade{
+					ID: utils.GenerateID(), UserID: userID, Symbol: tr.symbol, MarketType: data.MarketTypeIndian,
+					EntryDate: now, EntryPrice: 100, Quantity: quantity, TotalAmount: 100 * float64(quantity),
+					Direction: direction, OutcomeSummary: data.OutcomeSummaryBreakeven, TradingBroker: &broker,
+					CreatedAt: now, UpdatedAt: now,
+				}); err != nil {
+					t.Fatalf("create trade: %v", err)
+				}
+			}
+
+			portfolio, err := service.GetPortfolio(userID, broker)
+			if err != nil {
+				t.Fatalf("get portfolio: %v", err)
+			}
+
+			got := make([]Discrepancy, 0, len(portfolio.Discrepancies))
+			for _, d := range portfolio.Discrepancies {
+				d.TradeIDs = nil
+				got = append(got, d)
+			}
+			want := append([]Discrepancy{}, tt.want...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("discrepancies = %+v, want %+v", got, want)
+			}
+			if len(portfolio.Positions)+len(portfolio.Holdings) != len(tt.rows) {
+				t.Errorf("portfolio has %d positions and %d holdings, want %d rows", len(portfolio.Positions), len(portfolio.Holdings), len(tt.rows))
+			}
+			for _, open := range append(portfolio.Positions, portfolio.Holdings...) {
+				if open.Journaled != tt.wantJournaled {
+					t.Errorf("%s journaled = %v, want %v", open.Symbol, open.Journaled, tt.wantJournaled)
+				}
+				if wantShort := open.Quantity < 0; (open.Direction == data.TradeDirectionShort) != wantShort {
+					t.Errorf("%s quantity %d reported as %s", open.Symbol, open.Quantity, open.Direction)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package brokersync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/instruments"
+	"go-core/internal/services/ledger"
+	"go-core/internal/services/matching"
+	"go-core/internal/services/tokens"
+	"go-core/internal/utils"
+)
+
+var (
+	// ErrUserNotFound is returned when the user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotConfigured is returned when the user has no access token for the broker
+	ErrNotConfigured = errors.New("broker not configured or access token missing")
+	// ErrTokenExpired is returned when the stored access token is past its expiry
+	ErrTokenExpired = errors.New("broker access token has expired")
+)
+
+// historyStart is where a first sync begins for brokers with trade history
+var historyStart = time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Service syncs broker fills into the journal through a broker connector
+type Service struct {
+	db        *sql.DB
+	keyring   *secrets.Keyring
+	connector func(data.TradingBroker) (brokers.Connector, error)
+}
+
+// NewService creates a broker sync service
+// keyring decrypts the broker credentials the sync signs in with.
+func NewService(db *sql.DB, keyring *secrets.Keyring) *Service {
+	return &Service{db: db, keyring: keyring, connector: brokers.GetConnector}
+}
+
+// SyncStage is a step of a sync, reported to SyncOptions.Progress as it starts
+type SyncStage string
+
+const (
+	SyncStageFetching  SyncStage = "fetching_fills"
+	SyncStageImporting SyncStage = "importing_fills"
+	SyncStageOrders    SyncStage = "syncing_orders"
+	SyncStageSnapshot  SyncStage = "syncing_snapshot"
+)
+
+// SyncOptions selects the user, broker and matching method of a sync
+type SyncOptions struct {
+	UserID   int
+	Broker   data.TradingBroker
+	Method   matching.Method
+	Progress func(stage SyncStage) // optional
+}
+
+// report passes a stage to the progress callback, if there is one
+func (opts SyncOptions) report(stage SyncStage) {
+	if opts.Progress != nil {
+		opts.Progress(stage)
+	}
+}
+
+// SyncResult reports what a sync fetched and imported
+type SyncResult struct {
+	Broker  data.TradingBroker `json:"trading_broker"`
+	From    string             `json:"from_date"`
+	To      string             `json:"to_date"`
+	Method  matching.Method    `json:"method"`
+	Fetched int                `json:"total_fetched"`
+	ledger.ImportResult
+	Snapshot *SnapshotResult  `json:"snapshot,omitempty"`
+	Orders   *OrderSyncResult `json:"orders,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// Sync fetches fills since the latest synced trade and imports them into the journal,
+// then records the day's order book and refreshes the positions and holdings snapshot
+// The window starts on the latest trade's day rather than the day after: the fill ledger
+// drops executions that were already imported, so later fills from that day are not lost.
+// A failed order book or snapshot does not fail the sync; it is reported as a warning.
+func (s *Service) Sync(ctx context.Context, opts SyncOptions) (*SyncResult, error) {
+	connector, err := s.connector(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	user, config, err := s.LoadConfig(opts.UserID, opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	from := historyStart
+	if !connector.Capabilities().TradeHistory {
+		from = to.Truncate(24 * time.Hour)
+	} else {
+		latest, err := repos.NewTradeRepository(s.db).GetLatestTradeDateByBroker(opts.UserID, opts.Broker)
+		if err != nil {
+			return nil, err
+		}
+		if latest != nil {
+			from = latest.Truncate(24 * time.Hour)
+		}
+	}
+
+	utils.LogInfo("Starting broker trade sync", map[string]interface{}{
+		"user_id":        opts.UserID,
+		"trading_broker": opts.Broker,
+		"from_date":      brokers.FormatDateForAPI(from),
+		"to_date":        brokers.FormatDateForAPI(to),
+		"method":         opts.Method,
+	})
+
+	opts.report(SyncStageFetching)
+	fills, err := s.fetchFills(ctx, user, connector, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.report(SyncStageImporting)
+	imported, err := ledger.NewService(s.db).Import(opts.UserID, opts.Broker, fills, opts.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{
+		Broker:       opts.Broker,
+		From:         brokers.FormatDateForAPI(from),
+		To:           brokers.FormatDateForAPI(to),
+		Method:       opts.Method,
+		Fetched:      len(fills),
+		ImportResult: *imported,
+	}
+
+	if connector.Capabilities().Orders {
+		opts.report(SyncStageOrders)
+		orders, err := s.syncOrders(ctx, opts.UserID, connector, config)
+		if err != nil {
+			utils.LogError(err, "Failed to sync broker order book", map[string]interface{}{
+				"user_id":        opts.UserID,
+				"trading_broker": opts.Broker,
+			})
+			result.Warnings = append(result.Warnings, "order book not updated: "+err.Error())
+		}
+		result.Orders = orders
+	}
+
+	opts.report(SyncStageSnapshot)
+	snapshot, err := s.syncSnapshot(ctx, opts.UserID, connector, config)
+	if err != nil {
+		utils.LogError(err, "Failed to sync broker positions snapshot", map[string]interface{}{
+			"user_id":        opts.UserID,
+			"trading_broker": opts.Broker,
+		})
+		result.Warnings = append(result.Warnings, "positions and holdings snapshot not updated: "+err.Error())
+	}
+	result.Snapshot = snapshot
+
+	return result, nil
+}
+
+// ReconcileOptions selects the window of a reconciliation
+type ReconcileOptions struct {
+	UserID int
+	Broker data.TradingBroker
+	From   time.Time
+	To     time.Time
+	Method matching.Method
+	Apply  bool
+}
+
+// Reconcile fetches a date window from the broker and diffs it against the fill ledger
+// A broker without trade history only returns today's fills, so a window starting before
+// today is rejected: every fill recorded on the earlier days would look missing, and applying
+// would delete them.
+func (s *Service) Reconcile(ctx context.Context, opts ReconcileOptions) (*ledger.Report, error) {
+	connector, err := s.connector(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if today := time.Now().UTC().Truncate(24 * time.Hour); !connector.Capabilities().TradeHistory && opts.From.Before(today) {
+		return nil, fmt.Errorf("%w: only today's trades can be fetched, so only %s can be reconciled",
+			brokers.ErrNotSupported, brokers.FormatDateForAPI(today))
+	}
+	user, config, err := s.LoadConfig(opts.UserID, opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	fills, err := s.fetchFills(ctx, user, connector, config, opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledger.NewService(s.db).Reconcile(ledger.ReconcileOptions{
+		UserID: opts.UserID,
+		Broker: opts.Broker,
+		Fills:  fills,
+		From:   opts.From,
+		To:     opts.To,
+		Method: opts.Method,
+		Apply:  opts.Apply,
+	})
+}
+
+// LoadConfig returns the user and their broker config, checking the access token is usable
+func (s *Service) LoadConfig(userID int, broker data.TradingBroker) (*data.User, *data.BrokerConfig, error) {
+	user, err := repos.NewUserRepository(s.db, s.keyring).GetUserByID(strconv.Itoa(userID))
+	if err != nil {
+		return nil, nil, ErrUserNotFound
+	}
+
+	config, exists := user.ConfiguredBrokers[string(broker)]
+	if !exists || config.AccessToken == "" {
+		return nil, nil, ErrNotConfigured
+	}
+	if config.ExpiryTime != nil && config.ExpiryTime.Before(time.Now()) {
+		utils.LogError(nil, "Broker access token expired", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": broker,
+			"expiry_time":    config.ExpiryTime,
+		})
+		return nil, nil, ErrTokenExpired
+	}
+
+	return user, &config, nil
+}
+
+// fetchFills fetches fills and normalizes their symbols with the instrument master
+func (s *Service) fetchFills(
+	ctx context.Context,
+	user *data.User,
+	connector brokers.Connector,
+	config *data.BrokerConfig,
+	from, to time.Time,
+) ([]matching.Fill, error) {
+	fills, err := s.fetchBrokerFills(ctx, user, connector, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+	normalizeFills(instruments.NewResolver(s.db), connector.GetBrokerName(), fills)
+	return fills, nil
+}
+
+// fetchBrokerFills fetches fills, renewing the access token once if the broker rejects it and supports renewal
+// A rejected token that cannot be renewed is marked revoked so its health shows it needs a new login.
+func (s *Service) fetchBrokerFills(
+	ctx context.Context,
+	user *data.User,
+	connector brokers.Connector,
+	config *data.BrokerConfig,
+	from, to time.Time,
+) ([]matching.Fill, error) {
+	fills, err := connector.FetchFills(ctx, config, from, to)
+	if err == nil || !errors.Is(err, brokers.ErrInvalidToken) {
+		return fills, err
+	}
+
+	broker := connector.GetBrokerName()
+	if !connector.Capabilities().TokenRefresh {
+		if markErr := tokens.MarkRevoked(s.db, s.keyring, user.ID, broker, config); markErr != nil {
+			utils.LogError(markErr, "Failed to mark broker token revoked", map[string]interface{}{
+				"user_id":        user.ID,
+				"trading_broker": broker,
+			})
+		}
+		return nil, err
+	}
+
+	utils.LogInfo("Token invalid, attempting auto-renewal", map[string]interface{}{
+		"user_id":        user.ID,
+		"trading_broker": broker,
+	})
+	if renewErr := tokens.Renew(ctx, s.db, s.keyring, user.ID, connector, config); renewErr != nil {
+		return nil, err
+	}
+
+	return connector.FetchFills(ctx, config, from, to)
+}
@@ -0,0 +1,111 @@
+package brokersync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/ledger"
+	"go-core/internal/services/matching"
+	"go-core/internal/testutil"
+)
+
+// fakeConnector is a broker that serves fixed fills; calling anything else panics
+type fakeConnector struct {
+	brokers.Connector
+	capabilities brokers.Capabilities
+	fills        []matching.Fill
+	fetches      int
+}
+
+func (c *fakeConnector) GetBrokerName() data.TradingBroker { return c.capabilities.Broker }
+
+func (c *fakeConnector) Capabilities() brokers.Capabilities { return c.capabilities }
+
+func (c *fakeConnector) FetchFills(ctx context.Context, config *data.BrokerConfig, from, to time.Time) ([]matching.Fill, error) {
+	c.fetches++
+	return append([]matching.Fill(nil), c.fills...), nil
+}
+
+// newService opens a fresh database with a user signed in to the connector's broker and
+// returns a sync service that uses the connector
+func newService(t *testing.T, connector *fakeConnector) (*Service, int) {
+	t.Helper()
+	db := testutil.NewDB(t)
+
+	keyring, err := secrets.NewKeyring(make([]byte, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("create keyring: %v", err)
+	}
+	userRepo := repos.NewUserRepository(db.GetConnection(), keyring)
+	user := &data.User{Name: "trader", Email: "trader@example.com", CreatedAt: time.Now().UTC()}
+	if err := userRepo.CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	config := data.BrokerConfig{AccessToken: "token", ConfiguredAt: time.Now().UTC()}
+	if err := userRepo.UpdateUserBrokerConfig(user.ID, string(connector.capabilities.Broker), config); err != nil {
+		t.Fatalf("configure broker: %v", err)
+	}
+
+	service := NewService(db.GetConnection(), keyring)
+	service.connector = func(data.TradingBroker) (brokers.Connector, error) { return connector, nil }
+	return service, user.ID
+}
+
+func fill(tradeID string, side matching.Side, at time.Time) matching.Fill {
+	return matching.Fill{
+		TradeID: tradeID, OrderID: "O" + tradeID, Symbol: "INFY", Product: "CNC", Side: side,
+		Quantity: 10, Price: 1500, Time: at,
+	}
+}
+
+func TestReconcileWithoutTradeHistory(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	earlier := today.AddDate(0, 0, -3)
+
+	// Like Zerodha, the broker only returns today's fills
+	kite := &fakeConnector{
+		capabilities: brokers.Capabilities{Broker: data.TradingBrokerZerodha},
+		fills:        []matching.Fill{fill("T3", matching.SideSell, today.Add(time.Minute))},
+	}
+	service, userID := newService(t, kite)
+	recorded := []matching.Fill{
+		fill("T1", matching.SideBuy, earlier.Add(4*time.Hour)),
+		fill("T2", matching.SideSell, earlier.Add(5*time.Hour)),
+		fill("T3", matching.SideSell, today.Add(time.Minute)),
+	}
+	if _, err := ledger.NewService(service.db).Import(userID, data.TradingBrokerZerodha, recorded, matching.MethodFIFO); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	stored := func() int {
+		t.Helper()
+		fills, err := repos.NewBrokerFillRepository(service.db).GetFillsInRange(userID, data.TradingBrokerZerodha, earlier, today.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatalf("get fills: %v", err)
+		}
+		return len(fills)
+	}
+
+	opts := ReconcileOptions{UserID: userID, Broker: data.TradingBrokerZerodha, From: earlier, To: today, Method: matching.MethodFIFO, Apply: true}
+	if _, err := service.Reconcile(context.Background(), opts); !errors.Is(err, brokers.ErrNotSupported) {
+		t.Fatalf("reconciling from three days ago: error %v, want ErrNotSupported", err)
+	}
+	if kite.fetches != 0 || stored() != 3 {
+		t.Fatalf("rejected reconciliation fetched %d times and left %d of 3 fills", kite.fetches, stored())
+	}
+
+	// Today can still be reconciled, and the earlier days are outside its window
+	opts.From = today
+	report, err := service.Reconcile(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Reconcile today: %v", err)
+	}
+	if report.Unchanged != 1 || len(report.Missing) != 0 || stored() != 3 {
+		t.Fatalf("today's report %+v left %d of 3 fills, want T3 unchanged and nothing missing", report, stored())
+	}
+}
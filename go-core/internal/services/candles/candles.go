@@ -0,0 +1,138 @@
+// Package candles stores OHLCV price history: it ingests bars from CSV files, aligns them to
+// their timeframe and resamples them into every longer timeframe, so algorithms and backtests
+// can read bars of any supported timeframe from one store.
+package candles
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// Service maintains the candle store
+type Service struct {
+	db *sql.DB
+}
+
+// NewService creates a candle service
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// ImportResult summarizes a candle CSV import
+type ImportResult struct {
+	Timeframe data.Timeframe `json:"timeframe"`
+	Symbols   []string       `json:"symbols"`
+	Imported  int            `json:"imported_count"`   // bars stored at the file's timeframe
+	Resampled int            `json:"resampled_count"`  // longer-timeframe bars rebuilt from them
+	Skipped   int            `json:"skipped_count"`    // rows that did not parse or were inconsistent
+	Errors    []string       `json:"errors,omitempty"` // why the first skipped rows were skipped
+	From      *time.Time     `json:"from,omitempty"`   // first imported bar
+	To        *time.Time     `json:"to,omitempty"`     // last imported bar
+}
+
+// Import stores the bars of a CSV file at timeframe and rebuilds the longer timeframes they cover
+// symbol names the bars when the file has no symbol column. Bars replace stored bars with the
+// same timestamp, and rebuilt bars replace resampled or imported bars of the longer timeframes.
+func (s *Service) Import(r io.Reader, symbol string, timeframe data.Timeframe) (*ImportResult, error) {
+	if _, ok := Duration(timeframe); !ok {
+		return nil, fmt.Errorf("invalid timeframe %q", timeframe)
+	}
+
+	parsed, err := parse(r, symbol, timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{
+		Timeframe: timeframe,
+		Symbols:   []string{},
+		Skipped:   parsed.skipped,
+		Errors:    parsed.errors,
+	}
+	if len(parsed.candles) == 0 {
+		return result, nil
+	}
+
+	bySymbol := make(map[string][]*data.Candle)
+	for _, candle := range parsed.candles {
+		bySymbol[candle.Symbol] = append(bySymbol[candle.Symbol], candle)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repos.NewCandleRepository(s.db).WithTx(tx)
+	for _, candle := range parsed.candles {
+		if err := repo.UpsertCandle(candle); err != nil {
+			return nil, err
+		}
+	}
+	result.Imported = len(parsed.candles)
+
+	for symbol, bars := range bySymbol {
+		result.Symbols = append(result.Symbols, symbol)
+
+		sort.Slice(bars, func(i, j int) bool { return bars[i].Timestamp.Before(bars[j].Timestamp) })
+		first, last := bars[0].Timestamp, bars[len(bars)-1].Timestamp
+		if result.From == nil || first.Before(*result.From) {
+			result.From = &first
+		}
+		if result.To == nil || last.After(*result.To) {
+			result.To = &last
+		}
+
+		for _, higher := range higherTimeframes(timeframe) {
+			rebuilt, err := rebuild(repo, symbol, timeframe, higher, first, last)
+			if err != nil {
+				return nil, err
+			}
+			result.Resampled += rebuilt
+		}
+	}
+	sort.Strings(result.Symbols)
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit candle import: %w", err)
+	}
+
+	utils.LogInfo("Candles imported", map[string]interface{}{
+		"timeframe": timeframe,
+		"symbols":   result.Symbols,
+		"imported":  result.Imported,
+		"resampled": result.Resampled,
+		"skipped":   result.Skipped,
+	})
+
+	return result, nil
+}
+
+// rebuild resamples the target bars covering [first, last] from the stored base bars
+// Whole target bars are rebuilt, so bars imported earlier in the same bucket are included.
+func rebuild(repo *repos.CandleRepository, symbol string, base, target data.Timeframe, first, last time.Time) (int, error) {
+	duration, _ := Duration(target)
+	from := BucketStart(first, target)
+	to := BucketStart(last, target).Add(duration)
+
+	bars, err := repo.GetCandles(symbol, base, from, to, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	resampled := Resample(bars, target)
+	for _, candle := range resampled {
+		if err := repo.UpsertCandle(candle); err != nil {
+			return 0, err
+		}
+	}
+	return len(resampled), nil
+}
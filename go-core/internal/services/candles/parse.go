@@ -0,0 +1,203 @@
+package candles
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// ErrUnknownFormat is returned for CSV files without recognizable OHLC columns
+var ErrUnknownFormat = errors.New("unrecognized candle CSV: expected a header with date or timestamp, open, high, low and close columns")
+
+// maxRowErrors bounds how many skipped rows are described in an import result
+const maxRowErrors = 10
+
+// columnAliases maps the header names data vendors use to the canonical column names
+// Headers are compared lower-cased with spaces, underscores and AmiBroker's <> removed.
+var columnAliases = map[string]string{
+	"symbol": "symbol", "ticker": "symbol", "tradingsymbol": "symbol", "scrip": "symbol",
+	"timestamp": "timestamp", "datetime": "timestamp",
+	"date": "date", "day": "date",
+	"time": "time",
+	"open": "open", "o": "open",
+	"high": "high", "h": "high",
+	"low": "low", "l": "low",
+	"close": "close", "c": "close", "ltp": "close",
+	"volume": "volume", "vol": "volume", "v": "volume",
+}
+
+// dateLayouts are the date formats accepted in date and timestamp columns
+var dateLayouts = []string{"2006-01-02", "02-01-2006", "02-Jan-2006", "20060102", "2006/01/02"}
+
+// timeLayouts are the time of day formats accepted after a date
+var timeLayouts = []string{"15:04:05", "15:04", "150405", "1504"}
+
+// parsed is the outcome of reading a candle CSV
+type parsed struct {
+	candles []*data.Candle
+	skipped int
+	errors  []string
+}
+
+// parse reads OHLCV bars from a CSV with a header row
+// Bars without a symbol column get symbol; timestamps are aligned to the start of their
+// timeframe bar. Rows that do not parse or whose prices are inconsistent are skipped.
+func parse(r io.Reader, symbol string, timeframe data.Timeframe) (*parsed, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrUnknownFormat
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.NewReplacer("<", "", ">", "", " ", "", "_", "").Replace(name)
+		if canonical, ok := columnAliases[name]; ok {
+			if _, seen := columns[canonical]; !seen {
+				columns[canonical] = i
+			}
+		}
+	}
+	for _, required := range []string{"open", "high", "low", "close"} {
+		if _, ok := columns[required]; !ok {
+			return nil, ErrUnknownFormat
+		}
+	}
+	_, hasTimestamp := columns["timestamp"]
+	_, hasDate := columns["date"]
+	if !hasTimestamp && !hasDate {
+		return nil, ErrUnknownFormat
+	}
+	if _, ok := columns["symbol"]; !ok && symbol == "" {
+		return nil, fmt.Errorf("the CSV has no symbol column, so a symbol is required")
+	}
+
+	result := &parsed{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV line %d: %w", line, err)
+		}
+
+		candle, err := parseRow(record, columns, symbol, timeframe)
+		if err != nil {
+			result.skipped++
+			if len(result.errors) < maxRowErrors {
+				result.errors = append(result.errors, fmt.Sprintf("line %d: %s", line, err))
+			}
+			continue
+		}
+		result.candles = append(result.candles, candle)
+	}
+
+	return result, nil
+}
+
+// parseRow reads one bar
+func parseRow(record []string, columns map[string]int, symbol string, timeframe data.Timeframe) (*data.Candle, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	if column := field("symbol"); column != "" {
+		symbol = column
+	}
+	if symbol == "" {
+		return nil, fmt.Errorf("missing symbol")
+	}
+
+	value := field("timestamp")
+	if value == "" {
+		value = strings.TrimSpace(field("date") + " " + field("time"))
+	}
+	timestamp, err := parseTimestamp(value)
+	if err != nil {
+		return nil, err
+	}
+
+	candle := &data.Candle{
+		Symbol:    strings.ToUpper(symbol),
+		Timeframe: timeframe,
+		Timestamp: BucketStart(timestamp, timeframe),
+	}
+	for _, price := range []struct {
+		name   string
+		target *float64
+	}{
+		{"open", &candle.Open}, {"high", &candle.High}, {"low", &candle.Low}, {"close", &candle.Close},
+	} {
+		*price.target, err = strconv.ParseFloat(field(price.name), 64)
+		if err != nil || *price.target <= 0 {
+			return nil, fmt.Errorf("invalid %s price %q", price.name, field(price.name))
+		}
+	}
+	if volume := field("volume"); volume != "" {
+		v, err := strconv.ParseFloat(volume, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid volume %q", volume)
+		}
+		candle.Volume = int64(v)
+	}
+
+	if candle.High < max(candle.Open, candle.Close, candle.Low) || candle.Low > min(candle.Open, candle.Close) {
+		return nil, fmt.Errorf("high %v and low %v do not contain open %v and close %v",
+			candle.High, candle.Low, candle.Open, candle.Close)
+	}
+	return candle, nil
+}
+
+// parseTimestamp reads RFC 3339 timestamps, Unix seconds or milliseconds, or a date with an
+// optional time of day in IST
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing timestamp")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil && epoch > 1e9 {
+		if epoch > 1e11 {
+			return time.UnixMilli(epoch), nil
+		}
+		return time.Unix(epoch, 0), nil
+	}
+
+	date, clock, _ := strings.Cut(strings.Replace(value, "T", " ", 1), " ")
+	clock = strings.TrimSpace(clock)
+	for _, dateLayout := range dateLayouts {
+		if clock == "" {
+			if t, err := time.ParseInLocation(dateLayout, date, utils.IST); err == nil {
+				return t, nil
+			}
+			continue
+		}
+		for _, timeLayout := range timeLayouts {
+			if t, err := time.ParseInLocation(dateLayout+" "+timeLayout, date+" "+clock, utils.IST); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
@@ -0,0 +1,130 @@
+package candles
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// Timeframes lists the supported timeframes, shortest first
+var Timeframes = []data.Timeframe{
+	data.Timeframe1m, data.Timeframe5m, data.Timeframe15m, data.Timeframe30m,
+	data.Timeframe1h, data.Timeframe4h, data.Timeframe1d, data.Timeframe1w,
+}
+
+// Duration returns the length of a timeframe's bars
+func Duration(timeframe data.Timeframe) (time.Duration, bool) {
+	switch timeframe {
+	case data.Timeframe1m:
+		return time.Minute, true
+	case data.Timeframe5m:
+		return 5 * time.Minute, true
+	case data.Timeframe15m:
+		return 15 * time.Minute, true
+	case data.Timeframe30m:
+		return 30 * time.Minute, true
+	case data.Timeframe1h:
+		return time.Hour, true
+	case data.Timeframe4h:
+		return 4 * time.Hour, true
+	case data.Timeframe1d:
+		return 24 * time.Hour, true
+	case data.Timeframe1w:
+		return 7 * 24 * time.Hour, true
+	default:
+		return 0, false
+	}
+}
+
+// ParseTimeframe validates a timeframe such as 5m or 1d
+func ParseTimeframe(value string) (data.Timeframe, error) {
+	timeframe := data.Timeframe(value)
+	if _, ok := Duration(timeframe); !ok {
+		return "", fmt.Errorf("invalid timeframe %q (expected one of 1m, 5m, 15m, 30m, 1h, 4h, 1d, 1w)", value)
+	}
+	return timeframe, nil
+}
+
+// higherTimeframes returns the timeframes that can be resampled from base
+func higherTimeframes(base data.Timeframe) []data.Timeframe {
+	baseDuration, _ := Duration(base)
+	var higher []data.Timeframe
+	for _, timeframe := range Timeframes {
+		if duration, _ := Duration(timeframe); duration > baseDuration {
+			higher = append(higher, timeframe)
+		}
+	}
+	return higher
+}
+
+// sessionOpen is the offset from midnight IST that intraday bars are aligned to, so hourly
+// bars run 09:15-10:15 like the exchanges' rather than 09:00-10:00. CANDLES_SESSION_OPEN
+// overrides the default 09:15.
+func sessionOpen() time.Duration {
+	open := 9*time.Hour + 15*time.Minute
+	if value := os.Getenv("CANDLES_SESSION_OPEN"); value != "" {
+		if t, err := time.Parse("15:04", value); err == nil {
+			open = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+	}
+	return open
+}
+
+// BucketStart returns the start of the timeframe bar containing t, in UTC
+// Daily bars start at midnight IST and weekly bars on Monday. Intraday bars are counted from the
+// session open, and from midnight before it.
+func BucketStart(t time.Time, timeframe data.Timeframe) time.Time {
+	local := t.In(utils.IST)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, utils.IST)
+
+	switch timeframe {
+	case data.Timeframe1d:
+		return midnight.UTC()
+	case data.Timeframe1w:
+		daysSinceMonday := (int(midnight.Weekday()) + 6) % 7
+		return midnight.AddDate(0, 0, -daysSinceMonday).UTC()
+	}
+
+	duration, ok := Duration(timeframe)
+	if !ok {
+		return t.UTC()
+	}
+	anchor := midnight.Add(sessionOpen())
+	if local.Before(anchor) {
+		anchor = midnight
+	}
+	return anchor.Add(local.Sub(anchor) / duration * duration).UTC()
+}
+
+// Resample aggregates one symbol's bars, oldest first, into bars of a longer timeframe
+// Each output bar opens at its first input bar's open, closes at its last one's close and
+// spans their highs, lows and total volume. Bars of the last bucket may be incomplete.
+func Resample(bars []*data.Candle, timeframe data.Timeframe) []*data.Candle {
+	var resampled []*data.Candle
+	var current *data.Candle
+	for _, bar := range bars {
+		start := BucketStart(bar.Timestamp, timeframe)
+		if current == nil || !current.Timestamp.Equal(start) {
+			current = &data.Candle{
+				Symbol:    bar.Symbol,
+				Timeframe: timeframe,
+				Timestamp: start,
+				Open:      bar.Open,
+				High:      bar.High,
+				Low:       bar.Low,
+				Close:     bar.Close,
+				Volume:    bar.Volume,
+			}
+			resampled = append(resampled, current)
+			continue
+		}
+		current.High = max(current.High, bar.High)
+		current.Low = min(current.Low, bar.Low)
+		current.Close = bar.Close
+		current.Volume += bar.Volume
+	}
+	return resampled
+}
@@ -0,0 +1,109 @@
+package candles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// ist returns a time in March 2024 in IST; 4 March 2024 is a Monday
+func ist(day, hour, minute int) time.Time {
+	return time.Date(2024, time.March, day, hour, minute, 0, 0, utils.IST)
+}
+
+func TestBucketStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		at          time.Time
+		timeframe   data.Timeframe
+		sessionOpen string
+		want        time.Time
+	}{
+		{name: "15m on a boundary", at: ist(4, 9, 30), timeframe: data.Timeframe15m, want: ist(4, 9, 30)},
+		{name: "15m inside a bar", at: ist(4, 9, 29), timeframe: data.Timeframe15m, want: ist(4, 9, 15)},
+		{name: "1h counts from the session open", at: ist(4, 10, 20), timeframe: data.Timeframe1h, want: ist(4, 10, 15)},
+		{name: "4h counts from the session open", at: ist(4, 14, 0), timeframe: data.Timeframe4h, want: ist(4, 13, 15)},
+		{name: "pre-open bars count from midnight", at: ist(4, 9, 0), timeframe: data.Timeframe1h, want: ist(4, 9, 0)},
+		{name: "session open override", at: ist(4, 10, 20), timeframe: data.Timeframe1h, sessionOpen: "09:00", want: ist(4, 10, 0)},
+		{name: "daily bars start at midnight IST", at: time.Date(2024, time.March, 4, 19, 0, 0, 0, time.UTC), timeframe: data.Timeframe1d, want: ist(5, 0, 0)},
+		{name: "weekly bars start on Monday", at: ist(10, 12, 0), timeframe: data.Timeframe1w, want: ist(4, 0, 0)},
+		{name: "a Monday starts its own week", at: ist(4, 0, 0), timeframe: data.Timeframe1w, want: ist(4, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANDLES_SESSION_OPEN", tt.sessionOpen)
+			got := BucketStart(tt.at, tt.timeframe)
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("BucketStart(%s, %s) = %s, want %s in UTC", tt.at, tt.timeframe, got, tt.want.UTC())
+			}
+		})
+	}
+}
+
+func TestResample(t *testing.T) {
+	bar := func(at time.Time, open, high, low, close float64, volume int64) *data.Candle {
+		return &data.Candle{Symbol: "NIFTY", Timeframe: data.Timeframe5m, Timestamp: at.UTC(), Open: open, High: high, Low: low, Close: close, Volume: volume}
+	}
+	bars := []*data.Candle{
+		bar(ist(4, 9, 15), 100, 102, 99, 101, 10),
+		bar(ist(4, 9, 20), 101, 105, 100, 104, 20),
+		bar(ist(4, 9, 25), 104, 104, 98, 99, 30),
+		bar(ist(4, 9, 30), 99, 100, 97, 98, 5),
+		bar(ist(4, 9, 35), 98, 103, 98, 102, 15),
+		// The 09:45 bucket is missing entirely
+		bar(ist(4, 10, 5), 110, 111, 109, 110, 1),
+	}
+
+	want := []*data.Candle{
+		{Symbol: "NIFTY", Timeframe: data.Timeframe15m, Timestamp: ist(4, 9, 15).UTC(), Open: 100, High: 105, Low: 98, Close: 99, Volume: 60},
+		{Symbol: "NIFTY", Timeframe: data.Timeframe15m, Timestamp: ist(4, 9, 30).UTC(), Open: 99, High: 103, Low: 97, Close: 102, Volume: 20},
+		{Symbol: "NIFTY", Timeframe: data.Timeframe15m, Timestamp: ist(4, 10, 0).UTC(), Open: 110, High: 111, Low: 109, Close: 110, Volume: 1},
+	}
+	got := Resample(bars, data.Timeframe15m)
+	if !reflect.DeepEqual(got, want) {
+		for i := range got {
+			t.Logf("got %+v", *got[i])
+		}
+		t.Fatalf("Resample to 15m does not match")
+	}
+
+	daily := Resample(bars, data.Timeframe1d)
+	if len(daily) != 1 || daily[0].Open != 100 || daily[0].Close != 110 || daily[0].High != 111 || daily[0].Low != 97 || daily[0].Volume != 81 {
+		t.Fatalf("Resample to 1d = %+v", daily)
+	}
+	if Resample(nil, data.Timeframe1h) != nil {
+		t.Fatalf("Resample of no bars returned bars")
+	}
+}
+
+func TestParseTimeframe(t *testing.T) {
+	for _, timeframe := range Timeframes {
+		if got, err := ParseTimeframe(string(timeframe)); err != nil || got != timeframe {
+			t.Errorf("ParseTimeframe(%q) = %q, %v", timeframe, got, err)
+		}
+	}
+	for _, value := range []string{"", "2m", "1D", "1 h"} {
+		if _, err := ParseTimeframe(value); err == nil {
+			t.Errorf("ParseTimeframe(%q) accepted", value)
+		}
+	}
+}
+
+func TestHigherTimeframes(t *testing.T) {
+	tests := []struct {
+		base data.Timeframe
+		want []data.Timeframe
+	}{
+		{data.Timeframe30m, []data.Timeframe{data.Timeframe1h, data.Timeframe4h, data.Timeframe1d, data.Timeframe1w}},
+		{data.Timeframe1d, []data.Timeframe{data.Timeframe1w}},
+		{data.Timeframe1w, nil},
+	}
+	for _, tt := range tests {
+		if got := higherTimeframes(tt.base); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("higherTimeframes(%s) = %v, want %v", tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package candles
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// calendarSearchDays bounds how far LastClose and NextClose look for a trading day
+const calendarSearchDays = 60
+
+// sessionClose is the offset from midnight IST the session ends at, and the last intraday bar
+// of the day with it. CANDLES_SESSION_CLOSE overrides the default 15:30.
+func sessionClose() time.Duration {
+	end := 15*time.Hour + 30*time.Minute
+	if value := os.Getenv("CANDLES_SESSION_CLOSE"); value != "" {
+		if t, err := time.Parse("15:04", value); err == nil {
+			end = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+	}
+	return end
+}
+
+// holidays returns the exchange holidays in CANDLES_HOLIDAYS, a comma separated list of
+// YYYY-MM-DD dates; weekends are never trading days
+func holidays() map[string]bool {
+	days := make(map[string]bool)
+	for _, value := range strings.Split(os.Getenv("CANDLES_HOLIDAYS"), ",") {
+		value = strings.TrimSpace(value)
+		if _, err := time.Parse("2006-01-02", value); err == nil {
+			days[value] = true
+		}
+	}
+	return days
+}
+
+// IsTradingDay reports whether the exchange trades on t's date in IST
+func IsTradingDay(t time.Time) bool {
+	return isTradingDay(t.In(utils.IST), holidays())
+}
+
+func isTradingDay(local time.Time, holidays map[string]bool) bool {
+	weekday := local.Weekday()
+	return weekday != time.Saturday && weekday != time.Sunday && !holidays[local.Format("2006-01-02")]
+}
+
+// LastClose returns when the latest bar of timeframe to close at or before t closed, in UTC
+// Intraday bars close every timeframe from the session open and the day's last one at the
+// session close; daily bars close at the session close and weekly bars at the close of the
+// week's last trading day. It returns false if no bar closed in the last 60 days.
+func LastClose(timeframe data.Timeframe, t time.Time) (time.Time, bool) {
+	holidays := holidays()
+	local := t.In(utils.IST)
+	for offset := 0; offset <= calendarSearchDays; offset++ {
+		closes := dayCloses(local.AddDate(0, 0, -offset), timeframe, holidays)
+		for i := len(closes) - 1; i >= 0; i-- {
+			if !closes[i].After(t) {
+				return closes[i].UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// NextClose returns when the first bar of timeframe to close after t closes, in UTC
+// It returns false if no bar closes in the next 60 days.
+func NextClose(timeframe data.Timeframe, t time.Time) (time.Time, bool) {
+	holidays := holidays()
+	local := t.In(utils.IST)
+	for offset := 0; offset <= calendarSearchDays; offset++ {
+		for _, at := range dayCloses(local.AddDate(0, 0, offset), timeframe, holidays) {
+			if at.After(t) {
+				return at.UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// dayCloses returns the closes of timeframe's bars on day's date in IST, earliest first
+func dayCloses(day time.Time, timeframe data.Timeframe, holidays map[string]bool) []time.Time {
+	if !isTradingDay(day, holidays) {
+		return nil
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, utils.IST)
+	end := midnight.Add(sessionClose())
+
+	switch timeframe {
+	case data.Timeframe1d:
+		return []time.Time{end}
+	case data.Timeframe1w:
+		for next := midnight.AddDate(0, 0, 1); next.Weekday() != time.Monday; next = next.AddDate(0, 0, 1) {
+			if isTradingDay(next, holidays) {
+				return nil
+			}
+		}
+		return []time.Time{end}
+	}
+
+	duration, ok := Duration(timeframe)
+	if !ok {
+		return nil
+	}
+	var closes []time.Time
+	for start := midnight.Add(sessionOpen()); start.Before(end); start = start.Add(duration) {
+		closes = append(closes, minTime(start.Add(duration), end))
+	}
+	return closes
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
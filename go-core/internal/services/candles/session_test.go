@@ -0,0 +1,97 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+)
+
+func TestIsTradingDay(t *testing.T) {
+	t.Setenv("CANDLES_HOLIDAYS", "2024-03-08, not-a-date")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{name: "monday", at: ist(4, 12, 0), want: true},
+		{name: "saturday", at: ist(9, 12, 0)},
+		{name: "sunday", at: ist(10, 12, 0)},
+		{name: "holiday", at: ist(8, 12, 0)},
+		{name: "the date is taken in IST", at: time.Date(2024, time.March, 10, 20, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		if got := IsTradingDay(tt.at); got != tt.want {
+			t.Errorf("%s: IsTradingDay(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestLastAndNextClose(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeframe data.Timeframe
+		at        time.Time
+		holidays  string
+		wantLast  time.Time
+		wantNext  time.Time
+	}{
+		{
+			name: "15m mid-bar", timeframe: data.Timeframe15m, at: ist(4, 9, 40),
+			wantLast: ist(4, 9, 30), wantNext: ist(4, 9, 45),
+		},
+		{
+			name: "a close at t counts as last, not next", timeframe: data.Timeframe5m, at: ist(4, 9, 20),
+			wantLast: ist(4, 9, 20), wantNext: ist(4, 9, 25),
+		},
+		{
+			name: "before the open the last close is the previous session", timeframe: data.Timeframe5m, at: ist(4, 9, 0),
+			wantLast: ist(1, 15, 30), wantNext: ist(4, 9, 20),
+		},
+		{
+			name: "the day's last hourly bar is cut at the session close", timeframe: data.Timeframe1h, at: ist(4, 15, 20),
+			wantLast: ist(4, 15, 15), wantNext: ist(4, 15, 30),
+		},
+		{
+			name: "daily bars skip the weekend", timeframe: data.Timeframe1d, at: ist(8, 16, 0),
+			wantLast: ist(8, 15, 30), wantNext: ist(11, 15, 30),
+		},
+		{
+			name: "daily bars skip holidays", timeframe: data.Timeframe1d, at: ist(8, 16, 0), holidays: "2024-03-11",
+			wantLast: ist(8, 15, 30), wantNext: ist(12, 15, 30),
+		},
+		{
+			name: "weekly bars close on Friday", timeframe: data.Timeframe1w, at: ist(6, 12, 0),
+			wantLast: ist(1, 15, 30), wantNext: ist(8, 15, 30),
+		},
+		{
+			name: "a Friday holiday moves the weekly close to Thursday", timeframe: data.Timeframe1w, at: ist(6, 12, 0), holidays: "2024-03-08",
+			wantLast: ist(1, 15, 30), wantNext: ist(7, 15, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANDLES_HOLIDAYS", tt.holidays)
+
+			last, ok := LastClose(tt.timeframe, tt.at)
+			if !ok || !last.Equal(tt.wantLast) {
+				t.Errorf("LastClose(%s, %s) = %s, %v; want %s", tt.timeframe, tt.at, last, ok, tt.wantLast)
+			}
+			next, ok := NextClose(tt.timeframe, tt.at)
+			if !ok || !next.Equal(tt.wantNext) {
+				t.Errorf("NextClose(%s, %s) = %s, %v; want %s", tt.timeframe, tt.at, next, ok, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestSessionCloseOverride(t *testing.T) {
+	t.Setenv("CANDLES_HOLIDAYS", "")
+	t.Setenv("CANDLES_SESSION_CLOSE", "23:30") // e.g. a commodity session
+
+	next, ok := NextClose(data.Timeframe1d, ist(4, 16, 0))
+	if !ok || !next.Equal(ist(4, 23, 30)) {
+		t.Fatalf("NextClose with a 23:30 close = %s, %v", next, ok)
+	}
+}
@@ -0,0 +1,258 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// Format represents a supported export file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+	FormatXLSX Format = "xlsx"
+)
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// ParseFormat validates a format name
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", value)
+	}
+}
+
+// Entity represents a journal entity that can be exported
+type Entity string
+
+const (
+	EntityTrades     Entity = "trades"
+	EntityStrategies Entity = "strategies"
+	EntityRules      Entity = "rules"
+	EntityMistakes   Entity = "mistakes"
+	EntityAlgorithms Entity = "algorithms"
+)
+
+// AllEntities lists every exportable entity in export order
+var AllEntities = []Entity{EntityTrades, EntityStrategies, EntityRules, EntityMistakes, EntityAlgorithms}
+
+// ParseEntities parses a comma separated entity list
+// An empty value selects every entity
+func ParseEntities(value string) ([]Entity, error) {
+	if strings.TrimSpace(value) == "" {
+		return AllEntities, nil
+	}
+
+	seen := make(map[Entity]bool)
+	var entities []Entity
+	for _, part := range strings.Split(value, ",") {
+		entity := Entity(strings.ToLower(strings.TrimSpace(part)))
+		switch entity {
+		case EntityTrades, EntityStrategies, EntityRules, EntityMistakes, EntityAlgorithms:
+		default:
+			return nil, fmt.Errorf("unsupported export entity: %s", part)
+		}
+		if !seen[entity] {
+			seen[entity] = true
+			entities = append(entities, entity)
+		}
+	}
+
+	return entities, nil
+}
+
+// Options controls what an export contains
+type Options struct {
+	UserID      int
+	Format      Format
+	Entities    []Entity
+	TradeFilter repos.TradeFilter
+}
+
+// Validate checks that the options describe a valid export
+func (o Options) Validate() error {
+	if len(o.Entities) == 0 {
+		return fmt.Errorf("at least one entity must be exported")
+	}
+	if o.Format == FormatCSV && len(o.Entities) != 1 {
+		return fmt.Errorf("csv export supports exactly one entity per file")
+	}
+	return nil
+}
+
+// FileName returns a suggested download file name for the export
+func (o Options) FileName(now time.Time) string {
+	name := fmt.Sprintf("100xtrader-export-%d-%s", o.UserID, now.Format("20060102"))
+	if o.Format == FormatCSV {
+		name += "-" + string(o.Entities[0])
+	}
+	return name + "." + string(o.Format)
+}
+
+// Exporter streams journal data out of the database
+type Exporter struct {
+	db *sql.DB
+}
+
+// NewExporter creates a new exporter
+func NewExporter(db *sql.DB) *Exporter {
+	return &Exporter{db: db}
+}
+
+// Export writes the selected entities of a user to w in the requested format
+func (e *Exporter) Export(w io.Writer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	tables := make([]table, 0, len(opts.Entities))
+	for _, entity := range opts.Entities {
+		tables = append(tables, e.tableFor(entity, opts))
+	}
+
+	utils.LogInfo("Exporting journal", map[string]interface{}{
+		"user_id":  opts.UserID,
+		"format":   opts.Format,
+		"entities": opts.Entities,
+	})
+
+	switch opts.Format {
+	case FormatCSV:
+		return writeCSV(w, tables[0])
+	case FormatXLSX:
+		return writeXLSX(w, tables)
+	default:
+		return writeJSON(w, opts.UserID, tables)
+	}
+}
+
+// writeCSV writes a single table as CSV with a header row
+func writeCSV(w io.Writer, t table) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(t.columns); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+
+	err := t.each(func(row []interface{}, _ interface{}) error {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatValue(value)
+			if text, ok := value.(string); ok {
+				record[i] = csvText(text)
+			}
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.name, err)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON streams every table as an array inside a single JSON document
+func writeJSON(w io.Writer, userID int, tables []table) error {
+	header, err := json.Marshal(map[string]interface{}{
+		"user_id":     userID,
+		"exported_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Drop the closing brace so table arrays can be appended to the object
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		if _, err := fmt.Fprintf(w, ",%q:[", t.name); err != nil {
+			return err
+		}
+
+		first := true
+		err := t.each(func(_ []interface{}, record interface{}) error {
+			encoded, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err = w.Write(encoded)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", t.name, err)
+		}
+
+		if _, err := w.Write([]byte("]")); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return err
+}
+
+// csvText keeps user text such as notes and tags from being read as a formula when the CSV is
+// opened in a spreadsheet: text starting with =, +, -, @, a tab or a carriage return is
+// prefixed with a single quote
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// formatValue renders a cell value as text for CSV output
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
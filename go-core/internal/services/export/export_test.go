@@ -0,0 +1,201 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedTable is a table whose rows are given up front
+func fixedTable(name string, columns []string, rows ...[]interface{}) table {
+	return table{
+		name:    name,
+		columns: columns,
+		each: func(emit func([]interface{}, interface{}) error) error {
+			for _, row := range rows {
+				if err := emit(row, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestParseEntities(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Entity
+		wantErr bool
+	}{
+		{value: "", want: AllEntities},
+		{value: "  ", want: AllEntities},
+		{value: "trades", want: []Entity{EntityTrades}},
+		{value: "Rules, trades,rules", want: []Entity{EntityRules, EntityTrades}},
+		{value: "trades,orders", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEntities(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEntities(%q) error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseEntities(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestOptionsValidateAndFileName(t *testing.T) {
+	now := time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		opts     Options
+		wantErr  bool
+		wantName string
+	}{
+		{opts: Options{UserID: 7, Format: FormatCSV, Entities: []Entity{EntityTrades}}, wantName: "100xtrader-export-7-20240309-trades.csv"},
+		{opts: Options{UserID: 7, Format: FormatXLSX, Entities: AllEntities}, wantName: "100xtrader-export-7-20240309.xlsx"},
+		{opts: Options{UserID: 7, Format: FormatCSV, Entities: []Entity{EntityTrades, EntityRules}}, wantErr: true},
+		{opts: Options{UserID: 7, Format: FormatJSON}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := tt.opts.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error %v, want error %v", tt.opts, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			if got := tt.opts.FileName(now); got != tt.wantName {
+				t.Errorf("FileName(%+v) = %q, want %q", tt.opts, got, tt.wantName)
+			}
+		}
+	}
+}
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"", ""},
+		{"breakout", "breakout"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+91 phone", "'+91 phone"},
+		{"-5 loss", "'-5 loss"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tindented", "'\tindented"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.text); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	at := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+	tbl := fixedTable("trades", []string{"symbol", "quantity", "price", "open", "entry_date", "notes", "exit_price"},
+		[]interface{}{"INFY", 10, 1500.5, true, at, "=cmd|' /C calc'!A0", nil},
+		[]interface{}{"TCS", -3, 0.0, false, at, "plain, with comma", 3900.0},
+	)
+
+	var out bytes.Buffer
+	if err := writeCSV(&out, tbl); err != nil {
+		t.Fatalf("writeCSV: %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+
+	want := [][]string{
+		{"symbol", "quantity", "price", "open", "entry_date", "notes", "exit_price"},
+		{"INFY", "10", "1500.5", "true", "2024-01-02T09:15:00Z", "'=cmd|' /C calc'!A0", ""},
+		{"TCS", "-3", "0", "false", "2024-01-02T09:15:00Z", "plain, with comma", "3900"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("csv records\n got %q\nwant %q", records, want)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	at := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+	tables := []table{
+		fixedTable("trades", []string{"symbol", "quantity", "price", "open", "entry_date", "notes"},
+			[]interface{}{"INFY", 10, 1500.5, true, at, "=1+1 <b>&"},
+			[]interface{}{"TCS", 3, nil, false, at, nil},
+		),
+		fixedTable("rules", []string{"name"}),
+	}
+
+	var out bytes.Buffer
+	if err := writeXLSX(&out, tables); err != nil {
+		t.Fatalf("writeXLSX: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		contents, _ := io.ReadAll(r)
+		r.Close()
+		parts[file.Name] = string(contents)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook has no %s", name)
+		}
+	}
+	if workbook := parts["xl/workbook.xml"]; !strings.Contains(workbook, `<sheet name="trades" sheetId="1" r:id="rId1"/>`) ||
+		!strings.Contains(workbook, `<sheet name="rules" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("workbook does not list both sheets: %s", workbook)
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, cell := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">symbol</t></is></c>`,
+		`<c r="B2"><v>10</v></c>`,
+		`<c r="C2"><v>1500.5</v></c>`,
+		`<c r="D2" t="b"><v>1</v></c>`,
+		`<c r="E2" t="inlineStr"><is><t xml:space="preserve">2024-01-02 09:15:00</t></is></c>`,
+		// Formula-like text stays an escaped inline string, never a formula cell
+		`<c r="F2" t="inlineStr"><is><t xml:space="preserve">=1+1 &lt;b&gt;&amp;</t></is></c>`,
+		`<c r="D3" t="b"><v>0</v></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("sheet1 has no cell %s", cell)
+		}
+	}
+	if strings.Contains(sheet, `r="C3"`) || strings.Contains(sheet, `r="F3"`) {
+		t.Errorf("empty values were written as cells: %s", sheet)
+	}
+	if strings.Contains(sheet, "<f>") {
+		t.Errorf("sheet contains a formula: %s", sheet)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {27, "AB"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := columnName(tt.index); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
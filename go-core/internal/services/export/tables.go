@@ -0,0 +1,205 @@
+package export
+
+import (
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+)
+
+// table describes one exported entity: its columns and a row source
+// each calls emit with the flat row for tabular formats and the record for JSON
+type table struct {
+	name    string
+	columns []string
+	each    func(emit func(row []interface{}, record interface{}) error) error
+}
+
+// tradeRecord is the JSON shape of an exported trade
+type tradeRecord struct {
+	*data.Trade
+	PnL *float64 `json:"pnl"`
+}
+
+var tradeColumns = []string{
+	"id", "symbol", "market_type", "direction", "entry_date", "entry_price", "quantity",
+	"total_amount", "exit_price", "exit_date", "pnl", "outcome_summary", "stop_loss", "target", "strategy",
+	"trade_analysis", "rules_followed", "screenshots",
+	"entry_confidence", "satisfaction_rating", "emotional_state", "mistakes_made", "lessons_learned",
+	"trading_broker", "trader_broker_id", "exchange_order_id", "order_id", "product_type", "transaction_type",
+	"created_at", "updated_at",
+}
+
+var strategyColumns = []string{"id", "name", "description", "created_at", "updated_at"}
+
+var ruleColumns = []string{"id", "name", "description", "category", "created_at", "updated_at"}
+
+var mistakeColumns = []string{"id", "name", "category", "created_at", "updated_at"}
+
+var algorithmColumns = []string{
+	"id", "name", "description", "status", "symbol", "timeframe", "execution_mode", "broker",
+	"enabled", "last_run_at", "last_signal", "total_trades", "win_rate", "total_pnl", "version",
+	"tags", "code", "created_at", "updated_at",
+}
+
+// tableFor builds the table for an entity
+func (e *Exporter) tableFor(entity Entity, opts Options) table {
+	switch entity {
+	case EntityStrategies:
+		return table{
+			name:    string(entity),
+			columns: strategyColumns,
+			each: func(emit func([]interface{}, interface{}) error) error {
+				strategies, err := repos.NewStrategyRepository(e.db).GetAllStrategiesByUser(opts.UserID)
+				if err != nil {
+					return err
+				}
+				for _, s := range strategies {
+					row := []interface{}{s.ID, s.Name, s.Description, s.CreatedAt, s.UpdatedAt}
+					if err := emit(row, s); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+	case EntityRules:
+		return table{
+			name:    string(entity),
+			columns: ruleColumns,
+			each: func(emit func([]interface{}, interface{}) error) error {
+				rules, err := repos.NewRuleRepository(e.db).GetAllRulesByUser(opts.UserID)
+				if err != nil {
+					return err
+				}
+				for _, r := range rules {
+					row := []interface{}{r.ID, r.Name, r.Description, string(r.Category), r.CreatedAt, r.UpdatedAt}
+					if err := emit(row, r); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+	case EntityMistakes:
+		return table{
+			name:    string(entity),
+			columns: mistakeColumns,
+			each: func(emit func([]interface{}, interface{}) error) error {
+				mistakes, err := repos.NewMistakeRepository(e.db).GetAllMistakesByUser(opts.UserID)
+				if err != nil {
+					return err
+				}
+				for _, m := range mistakes {
+					row := []interface{}{m.ID, m.Name, string(m.Category), m.CreatedAt, m.UpdatedAt}
+					if err := emit(row, m); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+	case EntityAlgorithms:
+		return table{
+			name:    string(entity),
+			columns: algorithmColumns,
+			each: func(emit func([]interface{}, interface{}) error) error {
+				algorithms, err := repos.NewAlgorithmRepository(e.db).GetAllAlgorithmsByUser(opts.UserID)
+				if err != nil {
+					return err
+				}
+				for _, a := range algorithms {
+					if err := emit(algorithmRow(a), a); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+	default:
+		return table{
+			name:    string(EntityTrades),
+			columns: tradeColumns,
+			each: func(emit func([]interface{}, interface{}) error) error {
+				repo := repos.NewTradeRepository(e.db)
+				return repo.ForEachTrade(opts.UserID, opts.TradeFilter, func(t *data.Trade) error {
+					return emit(tradeRow(t), tradeRecord{Trade: t, PnL: t.RealizedPnL()})
+				})
+			},
+		}
+	}
+}
+
+// tradeRow flattens a trade, including psychology and computed P&L, into export columns
+func tradeRow(t *data.Trade) []interface{} {
+	var entryConfidence, satisfactionRating, emotionalState, mistakesMade, lessonsLearned interface{}
+	if t.Psychology != nil {
+		entryConfidence = t.Psychology.EntryConfidence
+		satisfactionRating = t.Psychology.SatisfactionRating
+		emotionalState = t.Psychology.EmotionalState
+		mistakesMade = strings.Join(t.Psychology.MistakesMade, "; ")
+		lessonsLearned = stringOrNil(t.Psychology.LessonsLearned)
+	}
+
+	var tradingBroker, productType interface{}
+	if t.TradingBroker != nil {
+		tradingBroker = string(*t.TradingBroker)
+	}
+	if t.ProductType != nil {
+		productType = string(*t.ProductType)
+	}
+
+	return []interface{}{
+		t.ID, t.Symbol, string(t.MarketType), string(t.Direction), t.EntryDate, t.EntryPrice, t.Quantity,
+		t.TotalAmount, floatOrNil(t.ExitPrice), timeOrNil(t.ExitDate), floatOrNil(t.RealizedPnL()), string(t.OutcomeSummary),
+		floatOrNil(t.StopLoss), floatOrNil(t.Target), t.Strategy,
+		stringOrNil(t.TradeAnalysis), strings.Join(t.RulesFollowed, "; "), strings.Join(t.Screenshots, "; "),
+		entryConfidence, satisfactionRating, emotionalState, mistakesMade, lessonsLearned,
+		tradingBroker, stringOrNil(t.TraderBrokerID), stringOrNil(t.ExchangeOrderID), stringOrNil(t.OrderID),
+		productType, stringOrNil(t.TransactionType),
+		t.CreatedAt, t.UpdatedAt,
+	}
+}
+
+// algorithmRow flattens an algorithm into export columns
+func algorithmRow(a *data.Algorithm) []interface{} {
+	var broker, lastRunAt interface{}
+	if a.Broker != nil {
+		broker = string(*a.Broker)
+	}
+	if a.LastRunAt != nil {
+		lastRunAt = *a.LastRunAt
+	}
+
+	return []interface{}{
+		a.ID, a.Name, stringOrNil(a.Description), string(a.Status), a.Symbol, string(a.Timeframe),
+		string(a.ExecutionMode), broker, a.Enabled, lastRunAt, stringOrNil(a.LastSignal),
+		a.TotalTrades, a.WinRate, a.TotalPnL, a.Version, strings.Join(a.Tags, "; "), a.Code,
+		a.CreatedAt, a.UpdatedAt,
+	}
+}
+
+// floatOrNil dereferences an optional float so empty values stay empty cells
+func floatOrNil(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// timeOrNil dereferences an optional time so empty values stay empty cells
+func timeOrNil(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// stringOrNil dereferences an optional string so empty values stay empty cells
+func stringOrNil(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
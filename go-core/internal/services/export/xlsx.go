@@ -0,0 +1,163 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// writeXLSX writes each table as a worksheet of a minimal Office Open XML workbook
+// Rows are streamed straight into the zip so large journals are never held in memory
+func writeXLSX(w io.Writer, tables []table) error {
+	archive := zip.NewWriter(w)
+
+	for i, t := range tables {
+		entry, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeSheet(entry, t); err != nil {
+			return fmt.Errorf("failed to write %s sheet: %w", t.name, err)
+		}
+	}
+
+	parts := map[string]string{
+		"[Content_Types].xml":        contentTypesXML(len(tables)),
+		"_rels/.rels":                rootRelsXML,
+		"xl/workbook.xml":            workbookXML(tables),
+		"xl/_rels/workbook.xml.rels": workbookRelsXML(len(tables)),
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, parts[name]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeSheet writes a worksheet with a header row followed by the table rows
+func writeSheet(w io.Writer, t table) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		header[i] = column
+	}
+	writeRow(buf, 1, header)
+
+	rowNumber := 1
+	err := t.each(func(row []interface{}, _ interface{}) error {
+		rowNumber++
+		writeRow(buf, rowNumber, row)
+		if buf.Buffered() > 64*1024 {
+			return buf.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(`</sheetData></worksheet>`)
+	return buf.Flush()
+}
+
+// writeRow writes a single row; numbers become numeric cells and everything else inline strings
+func writeRow(buf *bufio.Writer, rowNumber int, values []interface{}) {
+	fmt.Fprintf(buf, `<row r="%d">`, rowNumber)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(rowNumber)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(buf, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(buf, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			bit := 0
+			if v {
+				bit = 1
+			}
+			fmt.Fprintf(buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, bit)
+		case time.Time:
+			writeInlineString(buf, ref, v.Format("2006-01-02 15:04:05"))
+		default:
+			writeInlineString(buf, ref, formatValue(v))
+		}
+	}
+	buf.WriteString(`</row>`)
+}
+
+// writeInlineString writes an escaped inline string cell
+// Inline strings are never evaluated, so text starting with = stays text in a spreadsheet.
+func writeInlineString(buf *bufio.Writer, ref, text string) {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+	fmt.Fprintf(buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escaped.String())
+}
+
+// columnName converts a zero-based column index to a spreadsheet column name (0 -> A, 26 -> AA)
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// contentTypesXML declares the package parts of the workbook
+func contentTypesXML(sheets int) string {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+// workbookXML lists the worksheets by name
+func workbookXML(tables []table) string {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, t := range tables {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, t.name, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+// workbookRelsXML links the workbook to its worksheets
+func workbookRelsXML(sheets int) string {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
@@ -0,0 +1,385 @@
+package indicators
+
+import (
+	"math"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// calculator computes one indicator a candle at a time
+type calculator interface {
+	// next takes the next candle and returns one value per output, NaN while there is not
+	// enough history
+	next(candle *data.Candle) []float64
+}
+
+var nan = math.NaN()
+
+// price reads a source of a candle
+func price(candle *data.Candle, source string) float64 {
+	switch source {
+	case "open":
+		return candle.Open
+	case "high":
+		return candle.High
+	case "low":
+		return candle.Low
+	case "hl2":
+		return (candle.High + candle.Low) / 2
+	case "hlc3":
+		return (candle.High + candle.Low + candle.Close) / 3
+	case "ohlc4":
+		return (candle.Open + candle.High + candle.Low + candle.Close) / 4
+	case "volume":
+		return float64(candle.Volume)
+	default:
+		return candle.Close
+	}
+}
+
+// window holds the last n values with their sum
+type window struct {
+	values []float64
+	next   int
+	full   bool
+	sum    float64
+}
+
+func newWindow(n int) *window {
+	return &window{values: make([]float64, n)}
+}
+
+func (w *window) push(value float64) {
+	w.sum += value - w.values[w.next]
+	w.values[w.next] = value
+	w.next++
+	if w.next == len(w.values) {
+		w.next, w.full = 0, true
+	}
+	if w.next == 0 {
+		// Recompute the sum once per lap so rounding errors do not accumulate
+		w.sum = 0
+		for _, v := range w.values {
+			w.sum += v
+		}
+	}
+}
+
+func (w *window) mean() float64 {
+	if !w.full {
+		return nan
+	}
+	return w.sum / float64(len(w.values))
+}
+
+// smoother is an exponential moving average seeded with the simple average of its first
+// period values; alpha 2/(period+1) is the usual EMA and 1/period is Wilder's smoothing
+type smoother struct {
+	period int
+	alpha  float64
+	count  int
+	value  float64
+}
+
+func newEMA(period int) *smoother {
+	return &smoother{period: period, alpha: 2 / float64(period+1)}
+}
+
+func newWilder(period int) *smoother {
+	return &smoother{period: period, alpha: 1 / float64(period)}
+}
+
+func (s *smoother) push(value float64) float64 {
+	s.count++
+	switch {
+	case s.count < s.period:
+		s.value += value
+		return nan
+	case s.count == s.period:
+		s.value = (s.value + value) / float64(s.period)
+	default:
+		s.value += s.alpha * (value - s.value)
+	}
+	return s.value
+}
+
+// trueRange is the range of a bar including any gap from the previous close
+type trueRange struct {
+	previous *data.Candle
+}
+
+func (t *trueRange) push(candle *data.Candle) float64 {
+	tr := candle.High - candle.Low
+	if t.previous != nil {
+		tr = math.Max(tr, math.Max(math.Abs(candle.High-t.previous.Close), math.Abs(candle.Low-t.previous.Close)))
+	}
+	t.previous = candle
+	return tr
+}
+
+type sma struct {
+	source string
+	window *window
+}
+
+func newSMA(s Spec) *sma {
+	return &sma{source: s.Source, window: newWindow(s.Period)}
+}
+
+func (i *sma) next(candle *data.Candle) []float64 {
+	i.window.push(price(candle, i.source))
+	return []float64{i.window.mean()}
+}
+
+type ema struct {
+	source string
+	ema    *smoother
+}
+
+func newEMAIndicator(s Spec) *ema {
+	return &ema{source: s.Source, ema: newEMA(s.Period)}
+}
+
+func (i *ema) next(candle *data.Candle) []float64 {
+	return []float64{i.ema.push(price(candle, i.source))}
+}
+
+// rsi is Wilder's relative strength index
+type rsi struct {
+	source     string
+	previous   float64
+	started    bool
+	gain, loss *smoother
+}
+
+func newRSI(s Spec) *rsi {
+	return &rsi{source: s.Source, gain: newWilder(s.Period), loss: newWilder(s.Period)}
+}
+
+func (i *rsi) next(candle *data.Candle) []float64 {
+	value := price(candle, i.source)
+	if !i.started {
+		i.previous, i.started = value, true
+		return []float64{nan}
+	}
+	change := value - i.previous
+	i.previous = value
+	gain := i.gain.push(math.Max(change, 0))
+	loss := i.loss.push(math.Max(-change, 0))
+	switch {
+	case math.IsNaN(gain):
+		return []float64{nan}
+	case loss == 0 && gain == 0:
+		return []float64{50}
+	case loss == 0:
+		return []float64{100}
+	}
+	return []float64{100 - 100/(1+gain/loss)}
+}
+
+type macd struct {
+	source           string
+	fast, slow, line *smoother
+}
+
+func newMACD(s Spec) *macd {
+	return &macd{source: s.Source, fast: newEMA(s.Fast), slow: newEMA(s.Slow), line: newEMA(s.Signal)}
+}
+
+func (i *macd) next(candle *data.Candle) []float64 {
+	value := price(candle, i.source)
+	fast, slow := i.fast.push(value), i.slow.push(value)
+	if math.IsNaN(slow) {
+		return []float64{nan, nan, nan}
+	}
+	line := fast - slow
+	signal := i.line.push(line)
+	return []float64{line, signal, line - signal}
+}
+
+// bollinger bands are the simple average plus and minus a multiple of the population
+// standard deviation
+type bollinger struct {
+	source string
+	stdDev float64
+	window *window
+}
+
+func newBollinger(s Spec) *bollinger {
+	return &bollinger{source: s.Source, stdDev: s.StdDev, window: newWindow(s.Period)}
+}
+
+func (i *bollinger) next(candle *data.Candle) []float64 {
+	i.window.push(price(candle, i.source))
+	mean := i.window.mean()
+	if math.IsNaN(mean) {
+		return []float64{nan, nan, nan}
+	}
+	variance := 0.0
+	for _, v := range i.window.values {
+		variance += (v - mean) * (v - mean)
+	}
+	width := i.stdDev * math.Sqrt(variance/float64(len(i.window.values)))
+	return []float64{mean + width, mean, mean - width}
+}
+
+// atr is Wilder's average true range
+type atr struct {
+	tr      trueRange
+	average *smoother
+}
+
+func newATR(period int) *atr {
+	return &atr{average: newWilder(period)}
+}
+
+func (i *atr) next(candle *data.Candle) []float64 {
+	return []float64{i.average.push(i.tr.push(candle))}
+}
+
+// vwap is the volume weighted average of the typical price since the session opened; it
+// restarts with each trading day in IST
+type vwap struct {
+	day           string
+	value, volume float64
+}
+
+func (i *vwap) next(candle *data.Candle) []float64 {
+	if day := candle.Timestamp.In(utils.IST).Format("2006-01-02"); day != i.day {
+		i.day, i.value, i.volume = day, 0, 0
+	}
+	i.value += price(candle, "hlc3") * float64(candle.Volume)
+	i.volume += float64(candle.Volume)
+	if i.volume == 0 {
+		return []float64{nan}
+	}
+	return []float64{i.value / i.volume}
+}
+
+// superTrend trails the price by a multiple of the ATR and flips when the close crosses it
+// direction is 1 in an uptrend, when value is the support below, and -1 in a downtrend.
+type superTrend struct {
+	multiplier   float64
+	atr          *atr
+	upper, lower float64
+	direction    float64
+	previous     *data.Candle
+}
+
+func newSuperTrend(s Spec) *superTrend {
+	return &superTrend{multiplier: s.Multiplier, atr: newATR(s.Period)}
+}
+
+func (i *superTrend) next(candle *data.Candle) []float64 {
+	previous := i.previous
+	i.previous = candle
+	atr := i.atr.next(candle)[0]
+	if math.IsNaN(atr) {
+		return []float64{nan, nan}
+	}
+
+	middle := (candle.High + candle.Low) / 2
+	upper, lower := middle+i.multiplier*atr, middle-i.multiplier*atr
+	if i.direction == 0 {
+		i.upper, i.lower, i.direction = upper, lower, 1
+		if candle.Close < middle {
+			i.direction = -1
+		}
+	} else {
+		// Bands only tighten while the previous close stays inside them
+		if upper < i.upper || previous.Close > i.upper {
+			i.upper = upper
+		}
+		if lower > i.lower || previous.Close < i.lower {
+			i.lower = lower
+		}
+		switch {
+		case i.direction > 0 && candle.Close < i.lower:
+			i.direction = -1
+		case i.direction < 0 && candle.Close > i.upper:
+			i.direction = 1
+		}
+	}
+
+	if i.direction > 0 {
+		return []float64{i.lower, 1}
+	}
+	return []float64{i.upper, -1}
+}
+
+// stochastic is the close's place in the high-low range of the last period bars (%K) and
+// its simple average (%D)
+type stochastic struct {
+	highs, lows []float64
+	count       int
+	d           *window
+}
+
+func newStochastic(s Spec) *stochastic {
+	return &stochastic{highs: make([]float64, s.Period), lows: make([]float64, s.Period), d: newWindow(s.Signal)}
+}
+
+func (i *stochastic) next(candle *data.Candle) []float64 {
+	slot := i.count % len(i.highs)
+	i.highs[slot], i.lows[slot] = candle.High, candle.Low
+	i.count++
+	if i.count < len(i.highs) {
+		return []float64{nan, nan}
+	}
+
+	highest, lowest := i.highs[0], i.lows[0]
+	for j := range i.highs {
+		highest, lowest = math.Max(highest, i.highs[j]), math.Min(lowest, i.lows[j])
+	}
+	k := 50.0
+	if highest > lowest {
+		k = 100 * (candle.Close - lowest) / (highest - lowest)
+	}
+	i.d.push(k)
+	return []float64{k, i.d.mean()}
+}
+
+// adx is Wilder's average directional index with the directional indicators it is built from
+type adx struct {
+	tr               trueRange
+	previous         *data.Candle
+	trs, plus, minus *smoother
+	average          *smoother
+}
+
+func newADX(period int) *adx {
+	return &adx{trs: newWilder(period), plus: newWilder(period), minus: newWilder(period), average: newWilder(period)}
+}
+
+func (i *adx) next(candle *data.Candle) []float64 {
+	previous := i.previous
+	i.previous = candle
+	tr := i.tr.push(candle)
+	if previous == nil {
+		return []float64{nan, nan, nan}
+	}
+
+	up, down := candle.High-previous.High, previous.Low-candle.Low
+	plusDM, minusDM := 0.0, 0.0
+	if up > down && up > 0 {
+		plusDM = up
+	}
+	if down > up && down > 0 {
+		minusDM = down
+	}
+	trs, plus, minus := i.trs.push(tr), i.plus.push(plusDM), i.minus.push(minusDM)
+	if math.IsNaN(trs) {
+		return []float64{nan, nan, nan}
+	}
+
+	plusDI, minusDI := 0.0, 0.0
+	if trs > 0 {
+		plusDI, minusDI = 100*plus/trs, 100*minus/trs
+	}
+	dx := 0.0
+	if plusDI+minusDI > 0 {
+		dx = 100 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+	}
+	return []float64{i.average.push(dx), plusDI, minusDI}
+}
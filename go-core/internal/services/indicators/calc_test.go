@@ -0,0 +1,244 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+var (
+	// StockCharts' moving average worksheet
+	emaCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29, 22.15, 22.39, 22.38, 22.61, 23.36,
+		24.05, 23.75, 23.83, 23.95, 23.63, 23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+	// StockCharts' RSI worksheet
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28,
+		46.00, 46.03, 46.41, 46.22, 45.64, 46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+)
+
+// bar is a one-minute candle from 9:15 IST on 4 March 2024
+func bar(minute int, high, low, close float64) *data.Candle {
+	start := time.Date(2024, time.March, 4, 9, 15, 0, 0, utils.IST)
+	return &data.Candle{Symbol: "INFY", Timestamp: start.Add(time.Duration(minute) * time.Minute), Open: close, High: high, Low: low, Close: close, Volume: 100}
+}
+
+func closing(closes ...float64) []*data.Candle {
+	candles := make([]*data.Candle, len(closes))
+	for i, c := range closes {
+		candles[i] = bar(i, c, c, c)
+	}
+	return candles
+}
+
+// run computes the compact spec over candles and returns its outputs at every bar
+func run(t *testing.T, compact string, candles []*data.Candle) [][]float64 {
+	t.Helper()
+	spec, err := ParseSpec(compact)
+	if err != nil {
+		t.Fatalf("ParseSpec(%q): %v", compact, err)
+	}
+	return Compute([]Spec{spec}, candles).values[0]
+}
+
+// near reports whether got is want to within tolerance, with NaN matching NaN
+func near(got, want, tolerance float64) bool {
+	if math.IsNaN(want) {
+		return math.IsNaN(got)
+	}
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestPublishedSeries(t *testing.T) {
+	tests := []struct {
+		spec      string
+		closes    []float64
+		want      []float64 // from the last bars; every bar before them has no value
+		tolerance float64
+	}{
+		{spec: "sma:10", closes: emaCloses, want: []float64{22.22, 22.21, 22.23, 22.26, 22.30, 22.42, 22.61, 22.77, 22.91, 23.08, 23.21, 23.38, 23.52, 23.65, 23.71, 23.68, 23.61, 23.51, 23.43, 23.28, 23.13}, tolerance: 0.005},
+		{spec: "ema:10", closes: emaCloses, want: []float64{22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34, 23.43, 23.51, 23.54, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92}, tolerance: 0.01},
+		// The worksheet rounds its running averages, so its RSI drifts from the exact values by
+		// up to 0.07
+		{spec: "rsi:14", closes: rsiCloses, want: []float64{70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38, 54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77}, tolerance: 0.1},
+	}
+	for _, tt := range tests {
+		values := run(t, tt.spec, closing(tt.closes...))
+		first := len(tt.closes) - len(tt.want)
+		for i, v := range values {
+			want := nan
+			if i >= first {
+				want = tt.want[i-first]
+			}
+			if !near(v[0], want, tt.tolerance) {
+				t.Errorf("%s at bar %d = %.4f, want %.2f", tt.spec, i, v[0], want)
+			}
+		}
+	}
+}
+
+func TestSmootherSeeding(t *testing.T) {
+	// Both are seeded with the simple average of their first three values, 2, and then move
+	// half (EMA) or a third (Wilder) of the way to each new value
+	tests := []struct {
+		name     string
+		smoother *smoother
+		want     []float64
+	}{
+		{name: "ema", smoother: newEMA(3), want: []float64{nan, nan, 2, 4, 2}},
+		{name: "wilder", smoother: newWilder(3), want: []float64{nan, nan, 2, 10.0 / 3, 20.0 / 9}},
+	}
+	for _, tt := range tests {
+		for i, value := range []float64{1, 2, 3, 6, 0} {
+			if got := tt.smoother.push(value); !near(got, tt.want[i], 1e-9) {
+				t.Errorf("%s: push #%d = %v, want %v", tt.name, i+1, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRSIWithoutLosses(t *testing.T) {
+	tests := []struct {
+		closes []float64
+		want   float64
+	}{
+		{closes: []float64{10, 11, 12, 13}, want: 100},
+		{closes: []float64{10, 10, 10, 10}, want: 50},
+		{closes: []float64{13, 12, 11, 10}, want: 0},
+	}
+	for _, tt := range tests {
+		values := run(t, "rsi:3", closing(tt.closes...))
+		if !math.IsNaN(values[2][0]) || values[3][0] != tt.want {
+			t.Errorf("rsi:3 over %v = %v, want %v from the fourth bar", tt.closes, values, tt.want)
+		}
+	}
+}
+
+func TestATRIncludesGaps(t *testing.T) {
+	candles := []*data.Candle{
+		bar(0, 11, 9, 10),
+		bar(1, 14, 12, 13), // gaps up: the true range runs from the previous close, 4
+		bar(2, 13, 12, 12), // 1
+		bar(3, 13, 10, 11), // 3
+	}
+	// Seeded with (2 + 4) / 2, then Wilder smoothing: 3 + (1 - 3) / 2 and 2 + (3 - 2) / 2
+	want := []float64{nan, 3, 2, 2.5}
+	for i, v := range run(t, "atr:2", candles) {
+		if !near(v[0], want[i], 1e-9) {
+			t.Errorf("atr:2 at bar %d = %v, want %v", i, v[0], want[i])
+		}
+	}
+}
+
+func TestSuperTrendRatchet(t *testing.T) {
+	// With a period of 1 the ATR is the bar's true range, so the bands are the bar's midpoint
+	// plus and minus its true range
+	candles := []*data.Candle{
+		bar(0, 11, 9, 10),    // bands 12 and 8; the close is not below the midpoint, so up
+		bar(1, 12, 10, 11),   // the lower band rises to 9
+		bar(2, 11, 9, 10),    // the pullback's lower band of 8 would loosen it, so it stays at 9
+		bar(3, 9, 7, 7.5),    // closes below 9: down, under the upper band, now 11
+		bar(4, 9, 7, 8),      // the upper band tightens to 10
+		bar(5, 10, 8, 9),     // the bounce's upper band of 11 would loosen it, so it stays at 10
+		bar(6, 12, 10, 11.5), // closes above 10: up, over the lower band, now 8
+	}
+	want := [][]float64{{8, 1}, {9, 1}, {9, 1}, {11, -1}, {10, -1}, {10, -1}, {8, 1}}
+
+	values := run(t, "supertrend:1:1", candles)
+	for i := range want {
+		if !near(values[i][0], want[i][0], 1e-9) || values[i][1] != want[i][1] {
+			t.Errorf("supertrend at bar %d = %v, want %v", i, values[i], want[i])
+		}
+	}
+
+	values = run(t, "supertrend:3:1", candles)
+	if !math.IsNaN(values[1][0]) || !math.IsNaN(values[1][1]) || math.IsNaN(values[2][0]) {
+		t.Errorf("supertrend:3 = %v, want values from the third bar", values)
+	}
+}
+
+func TestADX(t *testing.T) {
+	candles := []*data.Candle{
+		bar(0, 10, 8, 9),
+		bar(1, 11, 9, 10.5),    // +DM 1, TR 2
+		bar(2, 12, 10, 11.5),   // +DM 1, TR 2
+		bar(3, 11.5, 9, 9.5),   // -DM 1, TR 2.5
+		bar(4, 13, 10, 12.5),   // +DM 1.5, TR 3.5
+		bar(5, 12.5, 11, 11.5), // an inside bar: no directional movement, TR 1.5
+	}
+	// Smoothed over two bars the directional indicators are 100 × +DM / TR and 100 × -DM / TR,
+	// DX is 100 × |+DI - -DI| / (+DI + -DI), and ADX averages DX the same way
+	want := [][]float64{
+		{nan, nan, nan},
+		{nan, nan, nan},
+		{nan, 50, 0},                 // DX 100
+		{50, 200.0 / 9, 200.0 / 9},   // DX 0; ADX is seeded with (100 + 0) / 2
+		{55, 800.0 / 23, 200.0 / 23}, // DX 60
+		{57.5, 160.0 / 7, 40.0 / 7},  // DX 60
+	}
+	values := run(t, "adx:2", candles)
+	for i := range want {
+		for j, output := range []string{"adx", "+DI", "-DI"} {
+			if !near(values[i][j], want[i][j], 1e-9) {
+				t.Errorf("%s at bar %d = %v, want %v", output, i, values[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	// The population standard deviation of these eight closes is 2 around a mean of 5
+	values := run(t, "bollinger:8:1.5", closing(2, 4, 4, 4, 5, 5, 7, 9))
+	if got := values[7]; got[0] != 8 || got[1] != 5 || got[2] != 2 {
+		t.Fatalf("bollinger = %v, want 8, 5 and 2", got)
+	}
+	if !math.IsNaN(values[6][1]) {
+		t.Fatalf("bollinger before the window is full = %v", values[6])
+	}
+}
+
+func TestStochastic(t *testing.T) {
+	candles := []*data.Candle{
+		bar(0, 12, 8, 10),
+		bar(1, 14, 10, 13),
+		bar(2, 15, 11, 14), // range 8 to 15: %K 6/7
+		bar(3, 16, 12, 12), // range 10 to 16: %K 2/6
+		bar(4, 13, 13, 13), // range 11 to 16: %K 2/5
+	}
+	want := [][]float64{{nan, nan}, {nan, nan}, {600.0 / 7, nan}, {100.0 / 3, (600.0/7 + 100.0/3) / 2}, {40, (100.0/3 + 40) / 2}}
+	values := run(t, "stochastic:3:2", candles)
+	for i := range want {
+		if !near(values[i][0], want[i][0], 1e-9) || !near(values[i][1], want[i][1], 1e-9) {
+			t.Errorf("stochastic at bar %d = %v, want %v", i, values[i], want[i])
+		}
+	}
+}
+
+func TestVWAPRestartsEachSession(t *testing.T) {
+	candles := []*data.Candle{bar(0, 12, 8, 10), bar(1, 13, 11, 12), bar(1440, 21, 19, 20)}
+	candles[1].Volume = 300
+	// (10 × 100 + 12 × 300) / 400, then the next day starts over
+	want := []float64{10, 11.5, 20}
+	for i, v := range run(t, "vwap", candles) {
+		if v[0] != want[i] {
+			t.Errorf("vwap at bar %d = %v, want %v", i, v[0], want[i])
+		}
+	}
+}
+
+func TestPrice(t *testing.T) {
+	candle := &data.Candle{Open: 10, High: 14, Low: 8, Close: 12, Volume: 500}
+	for source, want := range map[string]float64{
+		"open": 10, "high": 14, "low": 8, "close": 12, "": 12, "hl2": 11, "hlc3": 34.0 / 3, "ohlc4": 11, "volume": 500,
+	} {
+		if got := price(candle, source); got != want {
+			t.Errorf("price(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Package indicators computes technical indicators one candle at a time. Algorithms declare the
+// indicators they read in their config, and the runtime hands each run the values at its latest
+// bar in context['indicators'], computed in a single pass over the series.
+package indicators
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigKey is the key of an algorithm's config that declares its indicators
+const ConfigKey = "indicators"
+
+const (
+	maxPeriod  = 1000
+	maxHistory = 500
+)
+
+// Spec declares one indicator: its type, parameters and the key algorithms read it under
+// Parameters a type does not take must be left out; unset ones take their defaults.
+type Spec struct {
+	Type       string  `json:"type"`
+	Key        string  `json:"key,omitempty"`        // defaults to the type and parameters, e.g. sma_20
+	Source     string  `json:"source,omitempty"`     // price the indicator reads: close (default), open, high, low, hl2, hlc3, ohlc4 or volume
+	Period     int     `json:"period,omitempty"`     // bars in the window, or the %K bars of stochastic
+	Fast       int     `json:"fast,omitempty"`       // MACD fast EMA
+	Slow       int     `json:"slow,omitempty"`       // MACD slow EMA
+	Signal     int     `json:"signal,omitempty"`     // MACD signal EMA, or the %D bars of stochastic
+	StdDev     float64 `json:"stddev,omitempty"`     // Bollinger band width in standard deviations
+	Multiplier float64 `json:"multiplier,omitempty"` // SuperTrend band width in ATRs
+	History    int     `json:"history,omitempty"`    // values to hand algorithms, oldest first; default 1, the latest only
+}
+
+// kind describes an indicator type
+type kind struct {
+	params  []string // in the order of the compact form, e.g. macd:12:26:9
+	source  bool     // reads Spec.Source
+	outputs []string
+	// defaults fills unset parameters
+	defaults func(s *Spec)
+	// warmup is how many bars the indicator needs before its values settle
+	warmup func(s Spec) int
+	build  func(s Spec) calculator
+}
+
+var kinds = map[string]kind{
+	"sma": {
+		params: []string{"period"}, source: true, outputs: []string{"value"},
+		defaults: func(s *Spec) { s.Period = withDefault(s.Period, 20) },
+		warmup:   func(s Spec) int { return s.Period },
+		build:    func(s Spec) calculator { return newSMA(s) },
+	},
+	"ema": {
+		params: []string{"period"}, source: true, outputs: []string{"value"},
+		defaults: func(s *Spec) { s.Period = withDefault(s.Period, 20) },
+		warmup:   func(s Spec) int { return 4 * s.Period },
+		build:    func(s Spec) calculator { return newEMAIndicator(s) },
+	},
+	"rsi": {
+		params: []string{"period"}, source: true, outputs: []string{"value"},
+		defaults: func(s *Spec) { s.Period = withDefault(s.Period, 14) },
+		warmup:   func(s Spec) int { return 10 * s.Period },
+		build:    func(s Spec) calculator { return newRSI(s) },
+	},
+	"macd": {
+		params: []string{"fast", "slow", "signal"}, source: true, outputs: []string{"value", "signal", "histogram"},
+		defaults: func(s *Spec) {
+			s.Fast, s.Slow, s.Signal = withDefault(s.Fast, 12), withDefault(s.Slow, 26), withDefault(s.Signal, 9)
+		},
+		warmup: func(s Spec) int { return 4*s.Slow + s.Signal },
+		build:  func(s Spec) calculator { return newMACD(s) },
+	},
+	"bollinger": {
+		params: []string{"period", "stddev"}, source: true, outputs: []string{"upper", "middle", "lower"},
+		defaults: func(s *Spec) {
+			s.Period = withDefault(s.Period, 20)
+			if s.StdDev == 0 {
+				s.StdDev = 2
+			}
+		},
+		warmup: func(s Spec) int { return s.Period },
+		build:  func(s Spec) calculator { return newBollinger(s) },
+	},
+	"atr": {
+		params: []string{"period"}, outputs: []string{"value"},
+		defaults: func(s *Spec) { s.Period = withDefault(s.Period, 14) },
+		warmup:   func(s Spec) int { return 10 * s.Period },
+		build:    func(s Spec) calculator { return newATR(s.Period) },
+	},
+	"vwap": {
+		outputs:  []string{"value"},
+		defaults: func(s *Spec) {},
+		warmup:   func(s Spec) int { return 400 }, // a session of one-minute bars; VWAP restarts every day
+		build:    func(s Spec) calculator { return &vwap{} },
+	},
+	"supertrend": {
+		params: []string{"period", "multiplier"}, outputs: []string{"value", "direction"},
+		defaults: func(s *Spec) {
+			s.Period = withDefault(s.Period, 10)
+			if s.Multiplier == 0 {
+				s.Multiplier = 3
+			}
+		},
+		warmup: func(s Spec) int { return 10 * s.Period },
+		build:  func(s Spec) calculator { return newSuperTrend(s) },
+	},
+	"stochastic": {
+		params: []string{"period", "signal"}, outputs: []string{"k", "d"},
+		defaults: func(s *Spec) { s.Period, s.Signal = withDefault(s.Period, 14), withDefault(s.Signal, 3) },
+		warmup:   func(s Spec) int { return s.Period + s.Signal },
+		build:    func(s Spec) calculator { return newStochastic(s) },
+	},
+	"adx": {
+		params: []string{"period"}, outputs: []string{"value", "plus_di", "minus_di"},
+		defaults: func(s *Spec) { s.Period = withDefault(s.Period, 14) },
+		warmup:   func(s Spec) int { return 10 * s.Period },
+		build:    func(s Spec) calculator { return newADX(s.Period) },
+	},
+}
+
+var sources = map[string]bool{"close": true, "open": true, "high": true, "low": true, "hl2": true, "hlc3": true, "ohlc4": true, "volume": true}
+
+func withDefault(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// Types lists the indicator types, alphabetically
+func Types() []string {
+	types := make([]string, 0, len(kinds))
+	for name := range kinds {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Outputs are the values an indicator produces; algorithms get a number for a single output
+// and a dict keyed by output otherwise
+func (s Spec) Outputs() []string {
+	return kinds[s.Type].outputs
+}
+
+// Warmup is how many bars before the first one of interest an indicator needs to settle
+func (s Spec) Warmup() int {
+	return kinds[s.Type].warmup(s)
+}
+
+// normalize checks a spec and fills in its defaults and key
+func (s *Spec) normalize() error {
+	s.Type = strings.ToLower(strings.TrimSpace(s.Type))
+	k, ok := kinds[s.Type]
+	if !ok {
+		return fmt.Errorf("unknown indicator type %q; expected one of %s", s.Type, strings.Join(Types(), ", "))
+	}
+
+	takes := map[string]bool{}
+	for _, param := range k.params {
+		takes[param] = true
+	}
+	for _, param := range []struct {
+		name string
+		set  bool
+	}{
+		{"period", s.Period != 0}, {"fast", s.Fast != 0}, {"slow", s.Slow != 0}, {"signal", s.Signal != 0},
+		{"stddev", s.StdDev != 0}, {"multiplier", s.Multiplier != 0},
+	} {
+		if param.set && !takes[param.name] {
+			return fmt.Errorf("%s does not take %s", s.Type, param.name)
+		}
+	}
+	if s.Source != "" && !k.source {
+		return fmt.Errorf("%s does not take source", s.Type)
+	}
+
+	k.defaults(s)
+	for _, param := range k.params {
+		if param == "stddev" || param == "multiplier" {
+			continue
+		}
+		if value, _ := strconv.Atoi(s.param(param)); value < 1 || value > maxPeriod {
+			return fmt.Errorf("%s %s must be from 1 to %d, got %d", s.Type, param, maxPeriod, value)
+		}
+	}
+	if s.Type == "macd" && s.Fast >= s.Slow {
+		return fmt.Errorf("macd fast %d must be shorter than slow %d", s.Fast, s.Slow)
+	}
+	if s.StdDev < 0 || s.Multiplier < 0 {
+		return fmt.Errorf("%s band width must be positive", s.Type)
+	}
+
+	if k.source {
+		s.Source = strings.ToLower(strings.TrimSpace(s.Source))
+		if s.Source == "" {
+			s.Source = "close"
+		}
+		if !sources[s.Source] {
+			return fmt.Errorf("unknown source %q; expected close, open, high, low, hl2, hlc3, ohlc4 or volume", s.Source)
+		}
+	}
+	if s.History == 0 {
+		s.History = 1
+	}
+	if s.History < 1 || s.History > maxHistory {
+		return fmt.Errorf("%s history must be from 1 to %d, got %d", s.Type, maxHistory, s.History)
+	}
+
+	if s.Key == "" {
+		parts := []string{s.Type}
+		for _, param := range k.params {
+			parts = append(parts, s.param(param))
+		}
+		if k.source && s.Source != "close" {
+			parts = append(parts, s.Source)
+		}
+		s.Key = strings.Join(parts, "_")
+	}
+	return nil
+}
+
+// param formats a parameter for a default key
+func (s Spec) param(name string) string {
+	switch name {
+	case "period":
+		return strconv.Itoa(s.Period)
+	case "fast":
+		return strconv.Itoa(s.Fast)
+	case "slow":
+		return strconv.Itoa(s.Slow)
+	case "signal":
+		return strconv.Itoa(s.Signal)
+	case "stddev":
+		return strconv.FormatFloat(s.StdDev, 'g', -1, 64)
+	default:
+		return strconv.FormatFloat(s.Multiplier, 'g', -1, 64)
+	}
+}
+
+// ParseSpec reads the compact form of a spec: the type followed by its parameters in order,
+// separated by colons, such as sma:20, macd:12:26:9 or bollinger:20:2.5; omitted parameters
+// take their defaults
+func ParseSpec(value string) (Spec, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	spec := Spec{Type: strings.ToLower(parts[0])}
+	k, ok := kinds[spec.Type]
+	if !ok {
+		return Spec{}, fmt.Errorf("unknown indicator type %q; expected one of %s", parts[0], strings.Join(Types(), ", "))
+	}
+	if len(parts)-1 > len(k.params) {
+		return Spec{}, fmt.Errorf("%s takes at most %d parameters (%s), got %q", spec.Type, len(k.params), strings.Join(k.params, ", "), value)
+	}
+	for i, part := range parts[1:] {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return Spec{}, fmt.Errorf("%s %s must be a number, got %q", spec.Type, k.params[i], part)
+		}
+		if number <= 0 {
+			return Spec{}, fmt.Errorf("%s %s must be positive, got %q", spec.Type, k.params[i], part)
+		}
+		switch k.params[i] {
+		case "stddev":
+			spec.StdDev = number
+		case "multiplier":
+			spec.Multiplier = number
+		default:
+			if number != float64(int(number)) {
+				return Spec{}, fmt.Errorf("%s %s must be a whole number, got %q", spec.Type, k.params[i], part)
+			}
+			switch k.params[i] {
+			case "period":
+				spec.Period = int(number)
+			case "fast":
+				spec.Fast = int(number)
+			case "slow":
+				spec.Slow = int(number)
+			default:
+				spec.Signal = int(number)
+			}
+		}
+	}
+	if err := spec.normalize(); err != nil {
+		return Spec{}, err
+	}
+	return spec, nil
+}
+
+// ParseSpecs reads the indicators an algorithm's config declares under ConfigKey: a list of
+// specs, each an object or a compact string such as "rsi:14". A config without the key
+// declares none. Keys must be unique.
+func ParseSpecs(config map[string]interface{}) ([]Spec, error) {
+	declared, ok := config[ConfigKey]
+	if !ok || declared == nil {
+		return nil, nil
+	}
+	list, ok := declared.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of indicators", ConfigKey)
+	}
+
+	specs := make([]Spec, 0, len(list))
+	keys := map[string]bool{}
+	for i, item := range list {
+		var spec Spec
+		switch item := item.(type) {
+		case string:
+			parsed, err := ParseSpec(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", ConfigKey, i, err)
+			}
+			spec = parsed
+		case map[string]interface{}:
+			encoded, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", ConfigKey, i, err)
+			}
+			decoder := json.NewDecoder(bytes.NewReader(encoded))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&spec); err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", ConfigKey, i, err)
+			}
+			if err := spec.normalize(); err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", ConfigKey, i, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s[%d] must be an object or a string such as \"sma:20\"", ConfigKey, i)
+		}
+		if keys[spec.Key] {
+			return nil, fmt.Errorf("%s[%d]: key %q is used by another indicator", ConfigKey, i, spec.Key)
+		}
+		keys[spec.Key] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
@@ -0,0 +1,110 @@
+package indicators
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Spec
+		err   string
+	}{
+		{value: "sma:20", want: Spec{Type: "sma", Key: "sma_20", Source: "close", Period: 20, History: 1}},
+		{value: " RSI ", want: Spec{Type: "rsi", Key: "rsi_14", Source: "close", Period: 14, History: 1}},
+		{value: "macd", want: Spec{Type: "macd", Key: "macd_12_26_9", Source: "close", Fast: 12, Slow: 26, Signal: 9, History: 1}},
+		{value: "macd:5", want: Spec{Type: "macd", Key: "macd_5_26_9", Source: "close", Fast: 5, Slow: 26, Signal: 9, History: 1}},
+		{value: "bollinger:20:2.5", want: Spec{Type: "bollinger", Key: "bollinger_20_2.5", Source: "close", Period: 20, StdDev: 2.5, History: 1}},
+		{value: "supertrend", want: Spec{Type: "supertrend", Key: "supertrend_10_3", Period: 10, Multiplier: 3, History: 1}},
+		{value: "vwap", want: Spec{Type: "vwap", Key: "vwap", History: 1}},
+		{value: "ichimoku", err: `unknown indicator type "ichimoku"; expected one of adx, atr, bollinger, ema, macd, rsi, sma, stochastic, supertrend, vwap`},
+		{value: "sma:20:5", err: `sma takes at most 1 parameters (period), got "sma:20:5"`},
+		{value: "sma:x", err: `sma period must be a number, got "x"`},
+		{value: "sma:0", err: `sma period must be positive, got "0"`},
+		{value: "ema:2.5", err: `ema period must be a whole number, got "2.5"`},
+		{value: "rsi:1001", err: "rsi period must be from 1 to 1000, got 1001"},
+		{value: "macd:26:12", err: "macd fast 26 must be shorter than slow 12"},
+		{value: "vwap:5", err: `vwap takes at most 0 parameters (), got "vwap:5"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseSpec(tt.value)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseSpec(%q) error = %v, want %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSpec(%q) = %+v, %v; want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSpecs(t *testing.T) {
+	specs, err := ParseSpecs(map[string]interface{}{ConfigKey: []interface{}{
+		"sma:5",
+		map[string]interface{}{"type": "RSI", "period": 3.0, "key": "fast_rsi", "history": 2.0},
+		map[string]interface{}{"type": "ema", "source": "HL2"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, spec := range specs {
+		keys = append(keys, spec.Key)
+	}
+	if want := []string{"sma_5", "fast_rsi", "ema_20_hl2"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys %v, want %v", keys, want)
+	}
+	if specs[1].Type != "rsi" || specs[1].History != 2 || specs[2].Source != "hl2" {
+		t.Fatalf("specs %+v", specs)
+	}
+
+	if specs, err := ParseSpecs(map[string]interface{}{"symbol": "INFY"}); specs != nil || err != nil {
+		t.Fatalf("config without indicators = %v, %v; want none", specs, err)
+	}
+
+	for _, tt := range []struct {
+		declared interface{}
+		err      string
+	}{
+		{declared: "sma:5", err: "indicators must be a list of indicators"},
+		{declared: []interface{}{"sma:x"}, err: `indicators[0]: sma period must be a number, got "x"`},
+		{declared: []interface{}{map[string]interface{}{"type": "sma", "length": 5}}, err: `indicators[0]: json: unknown field "length"`},
+		{declared: []interface{}{map[string]interface{}{"type": "vwap", "period": 5}}, err: "indicators[0]: vwap does not take period"},
+		{declared: []interface{}{map[string]interface{}{"type": "atr", "source": "open"}}, err: "indicators[0]: atr does not take source"},
+		{declared: []interface{}{map[string]interface{}{"type": "sma", "source": "median"}}, err: `indicators[0]: unknown source "median"`},
+		{declared: []interface{}{map[string]interface{}{"type": "sma", "history": 501}}, err: "indicators[0]: sma history must be from 1 to 500, got 501"},
+		{declared: []interface{}{"sma:5", "sma:5"}, err: `indicators[1]: key "sma_5" is used by another indicator`},
+		{declared: []interface{}{5}, err: `indicators[0] must be an object or a string such as "sma:20"`},
+	} {
+		_, err := ParseSpecs(map[string]interface{}{ConfigKey: tt.declared})
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("ParseSpecs(%v) error = %v, want %q", tt.declared, err, tt.err)
+		}
+	}
+}
+
+func TestSeriesAt(t *testing.T) {
+	sma, _ := ParseSpec("sma:2")
+	lines, _ := ParseSpec("macd:1:2:1")
+	history := sma
+	history.Key, history.History = "recent", 3
+	series := Compute([]Spec{sma, lines, history}, closing(10, 12, 16))
+
+	if got := series.At(0); got["sma_2"] != nil || !reflect.DeepEqual(got["recent"], []interface{}{nil}) {
+		t.Fatalf("at the first bar %v, want no average yet", got)
+	}
+	got := series.At(2)
+	if got["sma_2"] != 14.0 || !reflect.DeepEqual(got["recent"], []interface{}{nil, 11.0, 14.0}) {
+		t.Fatalf("at the last bar %v", got)
+	}
+	// The fast EMA over one bar is the close, 16, and the slow one over two is seeded at 11
+	// and then moves two thirds of the way to 16; a one-bar signal line equals the MACD line
+	macd, ok := got["macd_1_2_1"].(map[string]interface{})
+	if !ok || !near(macd["value"].(float64), 5.0/3, 1e-9) || !near(macd["signal"].(float64), 5.0/3, 1e-9) || macd["histogram"] != 0.0 {
+		t.Fatalf("macd %v, want value and signal 1.67 with no histogram", got["macd_1_2_1"])
+	}
+}
@@ -0,0 +1,73 @@
+package indicators
+
+import (
+	"math"
+
+	"go-core/internal/data"
+)
+
+// Series holds the values of a set of indicators at every bar of a candle series
+type Series struct {
+	specs  []Spec
+	values [][][]float64 // by spec, bar and output
+}
+
+// Compute runs specs over candles, oldest first, in one pass
+func Compute(specs []Spec, candles []*data.Candle) *Series {
+	series := &Series{specs: specs, values: make([][][]float64, len(specs))}
+	for i, spec := range specs {
+		calc := kinds[spec.Type].build(spec)
+		values := make([][]float64, len(candles))
+		for bar, candle := range candles {
+			values[bar] = calc.next(candle)
+		}
+		series.values[i] = values
+	}
+	return series
+}
+
+// Specs are the indicators of the series
+func (s *Series) Specs() []Spec {
+	return s.specs
+}
+
+// Value is one indicator at bar: a number for a single output and a map keyed by output
+// otherwise, with nil for values not yet available
+func (s *Series) Value(spec, bar int) interface{} {
+	outputs := s.specs[spec].Outputs()
+	values := s.values[spec][bar]
+	if len(outputs) == 1 {
+		return number(values[0])
+	}
+	value := make(map[string]interface{}, len(outputs))
+	for i, output := range outputs {
+		value[output] = number(values[i])
+	}
+	return value
+}
+
+// At is what algorithms see at bar in context['indicators']: each indicator's Value under its
+// key, or, for an indicator with a History above 1, a list of its values up to bar, oldest first
+func (s *Series) At(bar int) map[string]interface{} {
+	at := make(map[string]interface{}, len(s.specs))
+	for i, spec := range s.specs {
+		if spec.History <= 1 {
+			at[spec.Key] = s.Value(i, bar)
+			continue
+		}
+		history := make([]interface{}, 0, spec.History)
+		for b := max(0, bar+1-spec.History); b <= bar; b++ {
+			history = append(history, s.Value(i, b))
+		}
+		at[spec.Key] = history
+	}
+	return at
+}
+
+// number turns a missing value into nil
+func number(value float64) interface{} {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return value
+}
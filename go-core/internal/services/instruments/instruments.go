@@ -0,0 +1,136 @@
+// Package instruments loads the brokers' instrument dumps into a shared instrument master and
+// resolves broker instrument identifiers to one trading symbol, so the same instrument is
+// journaled under the same symbol whichever broker it was traded through.
+package instruments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// Default dump URLs; INSTRUMENTS_DHAN_URL and INSTRUMENTS_ZERODHA_URL override them
+const (
+	DefaultDhanDumpURL    = "https://images.dhan.co/api-data/api-scrip-master.csv"
+	DefaultZerodhaDumpURL = "https://api.kite.trade/instruments"
+)
+
+// downloadTimeout bounds a dump download; Kite's dump is tens of megabytes
+const downloadTimeout = 2 * time.Minute
+
+// DumpURL returns where a broker's instrument dump is downloaded from
+func DumpURL(broker data.TradingBroker) string {
+	switch broker {
+	case data.TradingBrokerDhan:
+		if url := os.Getenv("INSTRUMENTS_DHAN_URL"); url != "" {
+			return url
+		}
+		return DefaultDhanDumpURL
+	case data.TradingBrokerZerodha:
+		if url := os.Getenv("INSTRUMENTS_ZERODHA_URL"); url != "" {
+			return url
+		}
+		return DefaultZerodhaDumpURL
+	default:
+		return ""
+	}
+}
+
+// Service maintains the instrument master
+type Service struct {
+	db *sql.DB
+}
+
+// NewService creates an instrument service
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// ImportResult summarizes an instrument dump import
+type ImportResult struct {
+	Broker   data.TradingBroker `json:"trading_broker"`
+	Imported int                `json:"imported_count"` // instruments now loaded from the broker's dump
+	Skipped  int                `json:"skipped_count"`  // rows for unsupported exchanges or instrument kinds
+	Replaced int64              `json:"replaced_count"` // instruments from the previous dump that were removed
+}
+
+// Import replaces a broker's instruments with those in its dump
+// The dump is parsed in full before anything is written, and the replacement happens in one
+// transaction, so a bad file leaves the previous instruments in place.
+func (s *Service) Import(broker data.TradingBroker, r io.Reader) (*ImportResult, error) {
+	parsed, skipped, err := Parse(broker, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: no usable instruments", ErrUnknownFormat)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repos.NewInstrumentRepository(s.db).WithTx(tx)
+	replaced, err := repo.DeleteBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, instrument := range parsed {
+		instrument.ID = utils.GenerateID()
+		instrument.UpdatedAt = now
+		if err := repo.CreateInstrument(instrument); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit instrument import: %w", err)
+	}
+
+	result := &ImportResult{Broker: broker, Imported: len(parsed), Skipped: skipped, Replaced: replaced}
+	utils.LogInfo("Instrument dump imported", map[string]interface{}{
+		"trading_broker": broker,
+		"imported_count": result.Imported,
+		"skipped_count":  result.Skipped,
+		"replaced_count": result.Replaced,
+	})
+	return result, nil
+}
+
+// Download fetches a broker's instrument dump from DumpURL and imports it
+func (s *Service) Download(ctx context.Context, broker data.TradingBroker) (*ImportResult, error) {
+	dumpURL := DumpURL(broker)
+	if dumpURL == "" {
+		return nil, fmt.Errorf("unsupported broker: %s", broker)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dumpURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download instrument dump: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download instrument dump: %s returned status %d", dumpURL, resp.StatusCode)
+	}
+	return s.Import(broker, resp.Body)
+}
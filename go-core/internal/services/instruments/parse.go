@@ -0,0 +1,268 @@
+package instruments
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// ErrUnknownFormat is returned when a dump's header matches neither broker's instrument CSV
+var ErrUnknownFormat = errors.New("unrecognized instrument dump")
+
+// ParseExchange maps an exchange or segment as a broker names it to an exchange and segment
+// Dhan names exchange segments (NSE_EQ, NSE_FNO, MCX_COMM, IDX_I); Kite names exchanges
+// (NSE, NFO, CDS, MCX). ok is false for names neither broker uses.
+func ParseExchange(raw string) (exchange string, segment data.InstrumentSegment, ok bool) {
+	switch strings.ToUpper(strings.TrimSpace(raw)) {
+	case "NSE", "NSE_EQ":
+		return "NSE", data.InstrumentSegmentEquity, true
+	case "BSE", "BSE_EQ":
+		return "BSE", data.InstrumentSegmentEquity, true
+	case "NFO", "NSE_FNO":
+		return "NSE", data.InstrumentSegmentDerivative, true
+	case "BFO", "BSE_FNO":
+		return "BSE", data.InstrumentSegmentDerivative, true
+	case "CDS", "NSE_CURRENCY":
+		return "NSE", data.InstrumentSegmentCurrency, true
+	case "BCD", "BSE_CURRENCY":
+		return "BSE", data.InstrumentSegmentCurrency, true
+	case "MCX", "MCX_COMM":
+		return "MCX", data.InstrumentSegmentCommodity, true
+	case "IDX_I":
+		return "", data.InstrumentSegmentIndex, true
+	default:
+		return "", "", false
+	}
+}
+
+// columns finds values in CSV records by header name, trying aliases in order
+type columns map[string]int
+
+// newColumns indexes a header row; names are matched case-insensitively
+func newColumns(header []string) columns {
+	index := make(columns, len(header))
+	for i, name := range header {
+		name = strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		index[name] = i
+	}
+	return index
+}
+
+// has reports whether any of the names is a column
+func (c columns) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := c[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the trimmed value of the first of the names that is a column
+func (c columns) get(record []string, names ...string) string {
+	for _, name := range names {
+		if i, ok := c[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// Parse reads a broker's instrument dump
+// Kite's dump is the CSV from GET /instruments; Dhan's is the compact or detailed scrip master.
+// Rows for exchanges or instrument kinds the journal does not trade are skipped and counted.
+func Parse(broker data.TradingBroker, r io.Reader) ([]*data.Instrument, int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read instrument dump header: %w", err)
+	}
+	cols := newColumns(header)
+
+	var parseRow func(columns, []string) *data.Instrument
+	switch broker {
+	case data.TradingBrokerZerodha:
+		if !cols.has("INSTRUMENT_TOKEN") {
+			return nil, 0, fmt.Errorf("%w: expected Kite's instrument_token column", ErrUnknownFormat)
+		}
+		parseRow = parseKiteRow
+	case data.TradingBrokerDhan:
+		if !cols.has("SEM_SMST_SECURITY_ID", "SECURITY_ID") {
+			return nil, 0, fmt.Errorf("%w: expected Dhan's SEM_SMST_SECURITY_ID or SECURITY_ID column", ErrUnknownFormat)
+		}
+		parseRow = parseDhanRow
+	default:
+		return nil, 0, fmt.Errorf("unsupported broker: %s", broker)
+	}
+
+	var parsed []*data.Instrument
+	skipped := 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read instrument dump line %d: %w", line, err)
+		}
+		instrument := parseRow(cols, record)
+		if instrument == nil {
+			skipped++
+			continue
+		}
+		instrument.TradingBroker = broker
+		parsed = append(parsed, instrument)
+	}
+
+	return parsed, skipped, nil
+}
+
+// parseKiteRow maps a row of Kite's instrument dump, or returns nil when it cannot be used
+// Kite has no ISINs; for derivatives its name column holds the underlying.
+func parseKiteRow(cols columns, record []string) *data.Instrument {
+	token := cols.get(record, "INSTRUMENT_TOKEN")
+	symbol := cols.get(record, "TRADINGSYMBOL")
+	exchange, segment, ok := ParseExchange(cols.get(record, "EXCHANGE"))
+	if token == "" || symbol == "" || !ok {
+		return nil
+	}
+
+	instrument := &data.Instrument{
+		BrokerToken:    token,
+		Exchange:       exchange,
+		Segment:        segment,
+		TradingSymbol:  strings.ToUpper(symbol),
+		Name:           utils.OptionalString(cols.get(record, "NAME")),
+		InstrumentType: strings.ToUpper(cols.get(record, "INSTRUMENT_TYPE")),
+		LotSize:        lotSize(cols.get(record, "LOT_SIZE")),
+		TickSize:       number(cols.get(record, "TICK_SIZE")),
+		Expiry:         expiry(cols.get(record, "EXPIRY")),
+		Strike:         strike(cols.get(record, "STRIKE")),
+	}
+	if strings.EqualFold(cols.get(record, "SEGMENT"), "INDICES") {
+		instrument.Segment = data.InstrumentSegmentIndex
+		instrument.InstrumentType = "INDEX"
+	}
+	if instrument.Segment != data.InstrumentSegmentEquity && instrument.Segment != data.InstrumentSegmentIndex {
+		instrument.Underlying = utils.OptionalString(strings.ToUpper(cols.get(record, "NAME")))
+	}
+	if instrument.InstrumentType == "" {
+		instrument.InstrumentType = "EQ"
+	}
+	return instrument
+}
+
+// parseDhanRow maps a row of Dhan's compact or detailed scrip master, or returns nil when it cannot be used
+// Dhan reports tick sizes in paise.
+func parseDhanRow(cols columns, record []string) *data.Instrument {
+	token := cols.get(record, "SEM_SMST_SECURITY_ID", "SECURITY_ID")
+	exchange := strings.ToUpper(cols.get(record, "SEM_EXM_EXCH_ID", "EXCH_ID"))
+	symbol := cols.get(record, "SEM_TRADING_SYMBOL", "UNDERLYING_SYMBOL", "SYMBOL_NAME")
+	kind := strings.ToUpper(cols.get(record, "SEM_INSTRUMENT_NAME", "INSTRUMENT"))
+	if token == "" || symbol == "" || (exchange != "NSE" && exchange != "BSE" && exchange != "MCX") {
+		return nil
+	}
+
+	var segment data.InstrumentSegment
+	switch strings.ToUpper(cols.get(record, "SEM_SEGMENT", "SEGMENT")) {
+	case "E":
+		segment = data.InstrumentSegmentEquity
+	case "I":
+		segment = data.InstrumentSegmentIndex
+	case "D":
+		segment = data.InstrumentSegmentDerivative
+	case "C":
+		segment = data.InstrumentSegmentCurrency
+	case "M":
+		segment = data.InstrumentSegmentCommodity
+	default:
+		return nil
+	}
+
+	instrumentType := "EQ"
+	switch {
+	case kind == "INDEX":
+		segment, instrumentType = data.InstrumentSegmentIndex, "INDEX"
+	case strings.HasPrefix(kind, "FUT"):
+		instrumentType = "FUT"
+	case strings.HasPrefix(kind, "OPT"):
+		instrumentType = strings.ToUpper(cols.get(record, "SEM_OPTION_TYPE", "OPTION_TYPE"))
+		if instrumentType != "CE" && instrumentType != "PE" {
+			return nil
+		}
+	}
+
+	instrument := &data.Instrument{
+		BrokerToken:    token,
+		Exchange:       exchange,
+		Segment:        segment,
+		TradingSymbol:  strings.ToUpper(symbol),
+		Name:           utils.OptionalString(cols.get(record, "SM_SYMBOL_NAME", "DISPLAY_NAME", "SEM_CUSTOM_SYMBOL")),
+		ISIN:           utils.OptionalString(strings.ToUpper(cols.get(record, "ISIN"))),
+		InstrumentType: instrumentType,
+		LotSize:        lotSize(cols.get(record, "SEM_LOT_UNITS", "LOT_SIZE")),
+		TickSize:       number(cols.get(record, "SEM_TICK_SIZE", "TICK_SIZE")) / 100,
+		Expiry:         expiry(cols.get(record, "SEM_EXPIRY_DATE", "SM_EXPIRY_DATE")),
+		Strike:         strike(cols.get(record, "SEM_STRIKE_PRICE", "STRIKE_PRICE")),
+	}
+	if instrumentType != "EQ" && instrumentType != "INDEX" {
+		// Derivative symbols read like NIFTY-Jan2024-21000-CE; the detailed master names the underlying
+		underlying := cols.get(record, "UNDERLYING_SYMBOL")
+		if underlying == "" {
+			underlying, _, _ = strings.Cut(symbol, "-")
+		}
+		instrument.Underlying = utils.OptionalString(strings.ToUpper(underlying))
+	}
+	return instrument
+}
+
+// number parses a decimal, treating anything unparsable as zero
+func number(value string) float64 {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0
+	}
+	return parsed
+}
+
+// lotSize parses a lot size, which is at least one
+func lotSize(value string) int {
+	size := int(math.Round(number(value)))
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// strike parses a strike price; dumps use zero or a negative placeholder for instruments without one
+func strike(value string) *float64 {
+	parsed := number(value)
+	if parsed <= 0 {
+		return nil
+	}
+	return &parsed
+}
+
+// expiry parses an expiry date as the UTC day, or nil when there is none
+func expiry(value string) *time.Time {
+	if len(value) >= len("2006-01-02") {
+		value = value[:len("2006-01-02")]
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil || day.Year() < 2000 {
+		return nil
+	}
+	return &day
+}
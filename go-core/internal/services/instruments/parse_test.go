@@ -0,0 +1,170 @@
+package instruments
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-core/internal/data"
+)
+
+// parsed is the part of an Instrument the tests compare
+type parsed struct {
+	Token, Exchange, Symbol, Type, Underlying, ISIN string
+	Segment                                         data.InstrumentSegment
+	LotSize                                         int
+	TickSize, Strike                                float64
+	Expiry                                          string
+}
+
+func summarize(instruments []*data.Instrument) []parsed {
+	summaries := make([]parsed, 0, len(instruments))
+	for _, i := range instruments {
+		s := parsed{
+			Token: i.BrokerToken, Exchange: i.Exchange, Symbol: i.TradingSymbol, Type: i.InstrumentType,
+			Segment: i.Segment, LotSize: i.LotSize, TickSize: i.TickSize,
+		}
+		if i.Underlying != nil {
+			s.Underlying = *i.Underlying
+		}
+		if i.ISIN != nil {
+			s.ISIN = *i.ISIN
+		}
+		if i.Strike != nil {
+			s.Strike = *i.Strike
+		}
+		if i.Expiry != nil {
+			s.Expiry = i.Expiry.Format("2006-01-02")
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		broker      data.TradingBroker
+		dump        string
+		want        []parsed
+		wantSkipped int
+	}{
+		{
+			name:   "kite dump with a byte order mark, upper-case headers and an unknown column",
+			broker: data.TradingBrokerZerodha,
+			dump: "\ufeffINSTRUMENT_TOKEN,tradingsymbol,Name,expiry,strike,tick_size,lot_size,instrument_type,segment,exchange,freeze_qty\n" +
+				"341249,hdfcbank,HDFC BANK,,0,0.05,1,EQ,NSE,nse,0\n" +
+				"256265,NIFTY 50,NIFTY 50,,0,0,0,EQ,INDICES,NSE,0\n" +
+				"13368322,NIFTY30JAN25000CE,NIFTY,2030-01-31,25000,0.05,50,CE,NFO-OPT,NFO,1800\n" +
+				"500112,SBIN,STATE BANK,,0,0.05,1,EQ,NCDEX,NCDEX,0\n",
+			want: []parsed{
+				{Token: "341249", Exchange: "NSE", Symbol: "HDFCBANK", Type: "EQ", Segment: data.InstrumentSegmentEquity, LotSize: 1, TickSize: 0.05},
+				{Token: "256265", Symbol: "NIFTY 50", Type: "INDEX", Exchange: "NSE", Segment: data.InstrumentSegmentIndex, LotSize: 1},
+				{
+					Token: "13368322", Exchange: "NSE", Symbol: "NIFTY30JAN25000CE", Type: "CE", Underlying: "NIFTY",
+					Segment: data.InstrumentSegmentDerivative, LotSize: 50, TickSize: 0.05, Strike: 25000, Expiry: "2030-01-31",
+				},
+			},
+			wantSkipped: 1,
+		},
+		{
+			name:   "dhan compact scrip master",
+			broker: data.TradingBrokerDhan,
+			dump: "SEM_EXM_EXCH_ID,SEM_SEGMENT,SEM_SMST_SECURITY_ID,SEM_INSTRUMENT_NAME,SEM_TRADING_SYMBOL,SEM_LOT_UNITS,SEM_EXPIRY_DATE,SEM_STRIKE_PRICE,SEM_OPTION_TYPE,SEM_TICK_SIZE\n" +
+				"NSE,E,1333,EQUITY,hdfcbank,1.0,,-0.01,XX,5.0000\n" +
+				"NSE,D,35002,OPTIDX,NIFTY-Jan2030-25000-CE,50.0,2030-01-31 14:30:00,25000.00000,CE,5.0000\n" +
+				"NSE,D,35003,OPTIDX,NIFTY-Jan2030-25000-XX,50.0,2030-01-31 14:30:00,25000.00000,XX,5.0000\n" +
+				"NCDEX,M,9001,FUTCOM,GUARSEED-Jan2030-FUT,5.0,2030-01-20 17:00:00,-0.01,XX,100.0000\n",
+			want: []parsed{
+				{Token: "1333", Exchange: "NSE", Symbol: "HDFCBANK", Type: "EQ", Segment: data.InstrumentSegmentEquity, LotSize: 1, TickSize: 0.05},
+				{
+					Token: "35002", Exchange: "NSE", Symbol: "NIFTY-JAN2030-25000-CE", Type: "CE", Underlying: "NIFTY",
+					Segment: data.InstrumentSegmentDerivative, LotSize: 50, TickSize: 0.05, Strike: 25000, Expiry: "2030-01-31",
+				},
+			},
+			wantSkipped: 2,
+		},
+		{
+			name:   "dhan detailed scrip master",
+			broker: data.TradingBrokerDhan,
+			dump: "EXCH_ID,SEGMENT,SECURITY_ID,ISIN,INSTRUMENT,UNDERLYING_SYMBOL,DISPLAY_NAME,LOT_SIZE,TICK_SIZE,SM_EXPIRY_DATE,STRIKE_PRICE,OPTION_TYPE\n" +
+				"bse,E,500180,ine040a01034,EQUITY,HDFCBANK,HDFC Bank,1,5,,,\n" +
+				"NSE,I,13,,INDEX,NIFTY,Nifty 50,1,0,,,\n",
+			want: []parsed{
+				{Token: "500180", Exchange: "BSE", Symbol: "HDFCBANK", ISIN: "INE040A01034", Type: "EQ", Segment: data.InstrumentSegmentEquity, LotSize: 1, TickSize: 0.05},
+				{Token: "13", Exchange: "NSE", Symbol: "NIFTY", Type: "INDEX", Segment: data.InstrumentSegmentIndex, LotSize: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instruments, skipped, err := Parse(tt.broker, strings.NewReader(tt.dump))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := summarize(instruments); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsed\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped %d rows, want %d", skipped, tt.wantSkipped)
+			}
+			for _, instrument := range instruments {
+				if instrument.TradingBroker != tt.broker {
+					t.Errorf("%s loaded for %s, want %s", instrument.TradingSymbol, instrument.TradingBroker, tt.broker)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherFormats(t *testing.T) {
+	kite := "instrument_token,tradingsymbol,exchange\n341249,HDFCBANK,NSE\n"
+	dhan := "SEM_EXM_EXCH_ID,SEM_SEGMENT,SEM_SMST_SECURITY_ID\nNSE,E,1333\n"
+
+	tests := []struct {
+		name        string
+		broker      data.TradingBroker
+		dump        string
+		wantUnknown bool
+	}{
+		{"kite dump as dhan", data.TradingBrokerDhan, kite, true},
+		{"dhan dump as kite", data.TradingBrokerZerodha, dhan, true},
+		{"empty dump", data.TradingBrokerDhan, "", false},
+		{"unsupported broker", data.TradingBroker("upstox"), kite, false},
+	}
+	for _, tt := range tests {
+		_, _, err := Parse(tt.broker, strings.NewReader(tt.dump))
+		if err == nil {
+			t.Errorf("%s: parsed without error", tt.name)
+			continue
+		}
+		if errors.Is(err, ErrUnknownFormat) != tt.wantUnknown {
+			t.Errorf("%s: error %v, want ErrUnknownFormat %v", tt.name, err, tt.wantUnknown)
+		}
+	}
+}
+
+func TestParseExchange(t *testing.T) {
+	tests := []struct {
+		raw          string
+		wantExchange string
+		wantSegment  data.InstrumentSegment
+		wantOK       bool
+	}{
+		{"NSE_EQ", "NSE", data.InstrumentSegmentEquity, true},
+		{" nfo ", "NSE", data.InstrumentSegmentDerivative, true},
+		{"BSE_FNO", "BSE", data.InstrumentSegmentDerivative, true},
+		{"CDS", "NSE", data.InstrumentSegmentCurrency, true},
+		{"MCX_COMM", "MCX", data.InstrumentSegmentCommodity, true},
+		{"IDX_I", "", data.InstrumentSegmentIndex, true},
+		{"NCDEX", "", "", false},
+	}
+	for _, tt := range tests {
+		exchange, segment, ok := ParseExchange(tt.raw)
+		if exchange != tt.wantExchange || segment != tt.wantSegment || ok != tt.wantOK {
+			t.Errorf("ParseExchange(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.raw, exchange, segment, ok, tt.wantExchange, tt.wantSegment, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package instruments
+
+import (
+	"database/sql"
+	"strings"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/utils"
+)
+
+// Ref identifies an instrument the way a broker reports it on a trade, order or position
+type Ref struct {
+	Exchange   string // exchange or segment as the broker names it
+	SecurityID string // Dhan security ID or Kite instrument_token
+	ISIN       string
+	Symbol     string // the broker's own symbol, if any
+}
+
+// Resolver maps broker instrument references to canonical trading symbols
+// A resolver caches its lookups, so create one per sync rather than sharing it.
+type Resolver struct {
+	repo  *repos.InstrumentRepository
+	cache map[string]*data.Instrument
+}
+
+// NewResolver creates a resolver backed by the instrument master
+func NewResolver(db *sql.DB) *Resolver {
+	return &Resolver{repo: repos.NewInstrumentRepository(db), cache: make(map[string]*data.Instrument)}
+}
+
+// Symbol returns the canonical trading symbol of an instrument
+// It falls back to the broker's symbol, or failing that the security ID, when the instrument
+// is not in the master, so syncing works the same as before until a dump is imported.
+func (r *Resolver) Symbol(broker data.TradingBroker, ref Ref) string {
+	if instrument := r.Resolve(broker, ref); instrument != nil {
+		return instrument.TradingSymbol
+	}
+	if ref.Symbol != "" {
+		return ref.Symbol
+	}
+	return ref.SecurityID
+}
+
+// Resolve returns the canonical instrument of a reference, or nil when it is not in the master
+// The instrument is found by the broker's security ID, then by ISIN, then by symbol. Its canonical
+// listing is the preferred listing of the same ISIN for equities and of the same contract for
+// derivatives, preferring Kite's exchange symbols and NSE over BSE.
+func (r *Resolver) Resolve(broker data.TradingBroker, ref Ref) *data.Instrument {
+	key := strings.Join([]string{string(broker), ref.Exchange, ref.SecurityID, ref.ISIN, ref.Symbol}, "|")
+	if instrument, ok := r.cache[key]; ok {
+		return instrument
+	}
+
+	instrument := r.canonical(r.find(broker, ref))
+	r.cache[key] = instrument
+	return instrument
+}
+
+// find looks up the instrument a reference names
+func (r *Resolver) find(broker data.TradingBroker, ref Ref) *data.Instrument {
+	if ref.SecurityID != "" {
+		if instrument := r.lookup(r.repo.GetByBrokerToken(broker, ref.SecurityID)); instrument != nil {
+			return instrument
+		}
+	}
+	if ref.ISIN != "" {
+		if instrument := r.lookup(r.repo.GetByISIN(ref.ISIN)); instrument != nil {
+			return instrument
+		}
+	}
+	if ref.Symbol != "" && ref.Symbol != ref.SecurityID {
+		exchange, _, _ := ParseExchange(ref.Exchange)
+		return r.lookup(r.repo.GetBySymbol(exchange, ref.Symbol))
+	}
+	return nil
+}
+
+// canonical returns the preferred listing of an instrument, or the instrument itself
+func (r *Resolver) canonical(instrument *data.Instrument) *data.Instrument {
+	if instrument == nil {
+		return nil
+	}
+
+	var preferred *data.Instrument
+	switch {
+	case instrument.Segment == data.InstrumentSegmentEquity && instrument.ISIN != nil:
+		preferred = r.lookup(r.repo.GetByISIN(*instrument.ISIN))
+	case instrument.Underlying != nil && instrument.Expiry != nil:
+		preferred = r.lookup(r.repo.GetContract(instrument))
+	}
+	if preferred == nil {
+		return instrument
+	}
+	return preferred
+}
+
+// lookup unwraps a repository lookup, treating a failed query as not found
+// Resolution only improves symbols, so a lookup failure must not fail a sync.
+func (r *Resolver) lookup(instrument *data.Instrument, err error) *data.Instrument {
+	if err != nil {
+		utils.LogWarn("Instrument lookup failed", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	return instrument
+}
@@ -0,0 +1,89 @@
+package instruments
+
+import (
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// newResolver loads instruments into a fresh database and returns a resolver over it
+func newResolver(t *testing.T, instruments ...*data.Instrument) *Resolver {
+	t.Helper()
+	db := testutil.NewDB(t)
+	repo := repos.NewInstrumentRepository(db.GetConnection())
+	for _, instrument := range instruments {
+		instrument.ID, instrument.UpdatedAt = utils.GenerateID(), time.Now()
+		if instrument.LotSize == 0 {
+			instrument.LotSize = 1
+		}
+		if err := repo.CreateInstrument(instrument); err != nil {
+			t.Fatalf("create instrument: %v", err)
+		}
+	}
+	return NewResolver(db.GetConnection())
+}
+
+func TestResolverSymbol(t *testing.T) {
+	equity := func(broker data.TradingBroker, token, exchange, symbol, isin string) *data.Instrument {
+		return &data.Instrument{
+			TradingBroker: broker, BrokerToken: token, Exchange: exchange, Segment: data.InstrumentSegmentEquity,
+			TradingSymbol: symbol, ISIN: utils.OptionalString(isin), InstrumentType: "EQ",
+		}
+	}
+	expiry := time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC)
+	strike := 25000.0
+	option := func(broker data.TradingBroker, token, symbol string) *data.Instrument {
+		return &data.Instrument{
+			TradingBroker: broker, BrokerToken: token, Exchange: "NSE", Segment: data.InstrumentSegmentDerivative,
+			TradingSymbol: symbol, InstrumentType: "CE", Underlying: utils.OptionalString("NIFTY"),
+			Expiry: &expiry, Strike: &strike, LotSize: 50,
+		}
+	}
+
+	resolver := newResolver(t,
+		// One company listed on both exchanges, under a different symbol on BSE
+		equity(data.TradingBrokerDhan, "1333", "NSE", "HDFCBANK", "INE040A01034"),
+		equity(data.TradingBrokerDhan, "500180", "BSE", "HDFCBANK-BE", "INE040A01034"),
+		// Two companies sharing a trading symbol on different exchanges
+		equity(data.TradingBrokerDhan, "2001", "NSE", "ACME", "INE000A01001"),
+		equity(data.TradingBrokerDhan, "532001", "BSE", "ACME", "INE000B01002"),
+		// One option contract in both brokers' dumps
+		option(data.TradingBrokerDhan, "35002", "NIFTY-JAN2030-25000-CE"),
+		option(data.TradingBrokerZerodha, "13368322", "NIFTY30JAN25000CE"),
+	)
+
+	tests := []struct {
+		name   string
+		broker data.TradingBroker
+		ref    Ref
+		want   string
+	}{
+		{"security ID", data.TradingBrokerDhan, Ref{SecurityID: "1333"}, "HDFCBANK"},
+		{"BSE security ID resolves to the NSE listing", data.TradingBrokerDhan, Ref{SecurityID: "500180"}, "HDFCBANK"},
+		{"ISIN", data.TradingBrokerZerodha, Ref{ISIN: "ine040a01034", Symbol: "HDFC"}, "HDFCBANK"},
+		{"derivative resolves to Kite's contract symbol", data.TradingBrokerDhan, Ref{SecurityID: "35002"}, "NIFTY30JAN25000CE"},
+		{"lower-case symbol", data.TradingBrokerDhan, Ref{Symbol: "hdfcbank"}, "HDFCBANK"},
+		{"shared symbol without an exchange prefers NSE", data.TradingBrokerDhan, Ref{Symbol: "ACME"}, "ACME"},
+		{"shared symbol on BSE stays on BSE", data.TradingBrokerDhan, Ref{Exchange: "BSE_EQ", Symbol: "acme"}, "ACME"},
+		{"unknown security ID falls back to the broker's symbol", data.TradingBrokerDhan, Ref{SecurityID: "999", Symbol: "NEWCO"}, "NEWCO"},
+		{"unknown security ID without a symbol", data.TradingBrokerDhan, Ref{SecurityID: "999"}, "999"},
+		{"security ID of another broker's dump", data.TradingBrokerZerodha, Ref{SecurityID: "1333"}, "1333"},
+	}
+	for _, tt := range tests {
+		if got := resolver.Symbol(tt.broker, tt.ref); got != tt.want {
+			t.Errorf("%s: Symbol(%s, %+v) = %q, want %q", tt.name, tt.broker, tt.ref, got, tt.want)
+		}
+	}
+
+	// The shared symbol resolves to the listing on the exchange asked for
+	for exchange, wantISIN := range map[string]string{"NSE_EQ": "INE000A01001", "BSE_EQ": "INE000B01002"} {
+		instrument := resolver.Resolve(data.TradingBrokerDhan, Ref{Exchange: exchange, Symbol: "ACME"})
+		if instrument == nil || instrument.ISIN == nil || *instrument.ISIN != wantISIN {
+			t.Errorf("ACME on %s resolved to %+v, want ISIN %s", exchange, instrument, wantISIN)
+		}
+	}
+}
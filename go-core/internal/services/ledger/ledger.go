@@ -0,0 +1,184 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokers"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+// Service records broker fills in the fill ledger and books new fills into the journal
+// Fills are deduplicated by exchange trade ID, so several fills of one order are all kept.
+type Service struct {
+	db *sql.DB
+}
+
+// NewService creates a ledger service
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// ImportResult summarizes the journal and ledger changes of an import
+type ImportResult struct {
+	Saved      int `json:"saved_count"`      // journal trades created
+	Updated    int `json:"updated_count"`    // carried open trades closed or reduced
+	Skipped    int `json:"skipped_count"`    // fills already imported
+	Recorded   int `json:"recorded_count"`   // fills added to the ledger
+	Backfilled int `json:"backfilled_count"` // fills of orders journaled before the ledger existed; recorded but not booked again
+}
+
+// Import books fills that are not yet in the ledger into the journal and records them
+// Everything happens in one transaction so a failed import leaves no partial journal changes.
+func (s *Service) Import(userID int, broker data.TradingBroker, fills []matching.Fill, method matching.Method) (*ImportResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{}
+	if err := s.importFills(tx, userID, broker, fills, method, result); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	utils.LogInfo("Broker fills imported", map[string]interface{}{
+		"user_id":          userID,
+		"trading_broker":   broker,
+		"saved_count":      result.Saved,
+		"updated_count":    result.Updated,
+		"skipped_count":    result.Skipped,
+		"recorded_count":   result.Recorded,
+		"backfilled_count": result.Backfilled,
+	})
+	return result, nil
+}
+
+// importFills classifies fills against the ledger and journal, then books and records them inside tx
+func (s *Service) importFills(
+	tx *sql.Tx,
+	userID int,
+	broker data.TradingBroker,
+	fills []matching.Fill,
+	method matching.Method,
+	result *ImportResult,
+) error {
+	fillRepo := repos.NewBrokerFillRepository(s.db).WithTx(tx)
+	tradeRepo := repos.NewTradeRepository(s.db).WithTx(tx)
+
+	var book, record []matching.Fill
+	for _, fill := range fills {
+		if fill.TradeID == "" {
+			// Without an exchange trade ID the fill cannot be tracked; fall back to order-level dedup
+			exists, err := tradeRepo.TradeExistsByBrokerID(userID, broker, fill.ExchangeOrderID, fill.OrderID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				result.Skipped++
+				continue
+			}
+			book = append(book, fill)
+			continue
+		}
+
+		exists, err := fillRepo.FillExists(userID, broker, fill.TradeID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			result.Skipped++
+			continue
+		}
+
+		legacy, err := journaledBeforeLedger(fillRepo, tradeRepo, userID, broker, fill)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			result.Backfilled++
+		} else {
+			book = append(book, fill)
+		}
+		record = append(record, fill)
+	}
+
+	if len(book) > 0 {
+		open, err := tradeRepo.GetOpenTradesByBroker(userID, broker)
+		if err != nil {
+			return err
+		}
+		built := brokers.BuildTrades(book, open, method, userID, broker)
+		for _, trade := range append(built.New, built.Splits...) {
+			if err := tradeRepo.CreateTrade(trade); err != nil {
+				return err
+			}
+			result.Saved++
+		}
+		for _, trade := range built.Updated {
+			if err := tradeRepo.UpdateTrade(trade); err != nil {
+				return err
+			}
+			result.Updated++
+		}
+	}
+
+	now := time.Now()
+	for _, fill := range record {
+		if err := fillRepo.CreateFill(brokerFill(fill, userID, broker, now)); err != nil {
+			return err
+		}
+		result.Recorded++
+	}
+
+	return nil
+}
+
+// journaledBeforeLedger reports whether the fill's order is already in the journal but has no
+// recorded fills, i.e. it was imported before the ledger existed and must not be booked twice
+func journaledBeforeLedger(
+	fillRepo *repos.BrokerFillRepository,
+	tradeRepo *repos.TradeRepository,
+	userID int,
+	broker data.TradingBroker,
+	fill matching.Fill,
+) (bool, error) {
+	if fill.OrderID == "" && fill.ExchangeOrderID == "" {
+		return false, nil
+	}
+	if fill.OrderID != "" {
+		hasFills, err := fillRepo.OrderHasFills(userID, broker, fill.OrderID)
+		if err != nil || hasFills {
+			return false, err
+		}
+	}
+	return tradeRepo.TradeExistsByBrokerID(userID, broker, fill.ExchangeOrderID, fill.OrderID)
+}
+
+// brokerFill converts a matching fill into a ledger row
+func brokerFill(fill matching.Fill, userID int, broker data.TradingBroker, now time.Time) *data.BrokerFill {
+	return &data.BrokerFill{
+		ID:              utils.GenerateID(),
+		UserID:          userID,
+		TradingBroker:   broker,
+		TradeID:         fill.TradeID,
+		OrderID:         utils.OptionalString(fill.OrderID),
+		ExchangeOrderID: utils.OptionalString(fill.ExchangeOrderID),
+		Symbol:          fill.Symbol,
+		ProductType:     utils.OptionalString(fill.Product),
+		Side:            string(fill.Side),
+		Quantity:        fill.Quantity,
+		Price:           fill.Price,
+		FillTime:        fill.Time,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
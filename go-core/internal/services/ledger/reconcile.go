@@ -0,0 +1,284 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+// ChangeKind classifies a difference between the broker and the ledger
+type ChangeKind string
+
+const (
+	// ChangeAdded is a fill the broker reports that the ledger does not have
+	ChangeAdded ChangeKind = "added"
+	// ChangeChanged is a fill whose details differ between the broker and the ledger
+	ChangeChanged ChangeKind = "changed"
+	// ChangeMissing is a recorded fill the broker no longer reports
+	ChangeMissing ChangeKind = "missing"
+)
+
+// Change is one reconciliation difference, keyed by exchange trade ID
+type Change struct {
+	Kind    ChangeKind       `json:"kind"`
+	TradeID string           `json:"trade_id"`
+	Broker  *data.BrokerFill `json:"broker,omitempty"` // the broker's version
+	Stored  *data.BrokerFill `json:"stored,omitempty"` // the ledger's version
+	Fields  []string         `json:"fields,omitempty"` // differing fields of a changed fill
+	// AffectedTrades are journal trades the same order opened or closed; they are not rewritten on apply
+	AffectedTrades []string `json:"affected_trades,omitempty"`
+}
+
+// ReconcileOptions selects the window and fills to reconcile
+type ReconcileOptions struct {
+	UserID int
+	Broker data.TradingBroker
+	Fills  []matching.Fill // the broker's fills for the window
+	From   time.Time       // first day of the window
+	To     time.Time       // last day of the window, inclusive
+	Method matching.Method // lot matching for added fills
+	Apply  bool
+}
+
+// Report is the outcome of a reconciliation
+type Report struct {
+	Broker    data.TradingBroker `json:"trading_broker"`
+	From      string             `json:"from_date"`
+	To        string             `json:"to_date"`
+	Method    matching.Method    `json:"method"`
+	Applied   bool               `json:"applied"`
+	Fetched   int                `json:"total_fetched"`
+	Unchanged int                `json:"unchanged_count"`
+	Untracked int                `json:"untracked_count"` // broker fills without an exchange trade ID
+	Added     []Change           `json:"added"`
+	Changed   []Change           `json:"changed"`
+	Missing   []Change           `json:"missing"`
+	Import    *ImportResult      `json:"import,omitempty"` // journal changes from added fills, when applied
+	Warnings  []string           `json:"warnings"`
+}
+
+// Reconcile diffs the broker's fills for a date window against the ledger by exchange trade ID
+// With Apply set, changed fills are updated, missing fills removed and added fills booked into
+// the journal in one transaction. Journal trades built from changed or missing fills keep the
+// user's annotations and are only listed for review.
+func (s *Service) Reconcile(opts ReconcileOptions) (*Report, error) {
+	report := &Report{
+		Broker:   opts.Broker,
+		From:     opts.From.Format("2006-01-02"),
+		To:       opts.To.Format("2006-01-02"),
+		Method:   opts.Method,
+		Applied:  opts.Apply,
+		Fetched:  len(opts.Fills),
+		Added:    []Change{},
+		Changed:  []Change{},
+		Missing:  []Change{},
+		Warnings: []string{},
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	fillRepo := repos.NewBrokerFillRepository(s.db).WithTx(tx)
+	tradeRepo := repos.NewTradeRepository(s.db).WithTx(tx)
+
+	stored, err := fillRepo.GetFillsInRange(opts.UserID, opts.Broker, opts.From, opts.To.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	storedByID := make(map[string]*data.BrokerFill, len(stored))
+	for _, fill := range stored {
+		storedByID[fill.TradeID] = fill
+	}
+
+	now := time.Now()
+	var added []matching.Fill
+	seen := make(map[string]bool, len(opts.Fills))
+	for _, fill := range opts.Fills {
+		if fill.TradeID == "" {
+			report.Untracked++
+			continue
+		}
+		if seen[fill.TradeID] {
+			continue
+		}
+		seen[fill.TradeID] = true
+
+		current := brokerFill(fill, opts.UserID, opts.Broker, now)
+		current.ID = "" // not stored yet
+		existing, ok := storedByID[fill.TradeID]
+		if !ok {
+			// The fill may be recorded outside the window, e.g. after a broker changed its date
+			exists, err := fillRepo.FillExists(opts.UserID, opts.Broker, fill.TradeID)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("fill %s is recorded outside the window; reconcile a wider window to compare it", fill.TradeID))
+				continue
+			}
+			report.Added = append(report.Added, Change{Kind: ChangeAdded, TradeID: fill.TradeID, Broker: current})
+			added = append(added, fill)
+			continue
+		}
+
+		fields := diffFields(existing, current)
+		if len(fields) == 0 {
+			report.Unchanged++
+			continue
+		}
+		change := Change{Kind: ChangeChanged, TradeID: fill.TradeID, Broker: current, Stored: existing, Fields: fields}
+		if change.AffectedTrades, err = affectedTrades(fillRepo, tradeRepo, opts.UserID, opts.Broker, existing); err != nil {
+			return nil, err
+		}
+		report.Changed = append(report.Changed, change)
+	}
+
+	for _, fill := range stored {
+		if seen[fill.TradeID] {
+			continue
+		}
+		change := Change{Kind: ChangeMissing, TradeID: fill.TradeID, Stored: fill}
+		if change.AffectedTrades, err = affectedTrades(fillRepo, tradeRepo, opts.UserID, opts.Broker, fill); err != nil {
+			return nil, err
+		}
+		report.Missing = append(report.Missing, change)
+	}
+
+	if report.Untracked > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d broker fill(s) have no exchange trade ID and cannot be reconciled", report.Untracked))
+	}
+	if review := len(report.Changed) + len(report.Missing); review > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d fill(s) changed or disappeared at the broker; review the affected journal trades", review))
+	}
+
+	if !opts.Apply {
+		return report, nil
+	}
+
+	for _, change := range report.Changed {
+		updated := *change.Broker
+		updated.ID = change.Stored.ID
+		updated.CreatedAt = change.Stored.CreatedAt
+		if err := fillRepo.UpdateFill(&updated); err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range report.Missing {
+		if err := fillRepo.DeleteFill(change.Stored.ID, opts.UserID); err != nil {
+			return nil, err
+		}
+	}
+	report.Import = &ImportResult{}
+	if err := s.importFills(tx, opts.UserID, opts.Broker, added, opts.Method, report.Import); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit reconciliation: %w", err)
+	}
+
+	utils.LogInfo("Broker fills reconciled", map[string]interface{}{
+		"user_id":        opts.UserID,
+		"trading_broker": opts.Broker,
+		"from_date":      report.From,
+		"to_date":        report.To,
+		"added":          len(report.Added),
+		"changed":        len(report.Changed),
+		"missing":        len(report.Missing),
+	})
+	return report, nil
+}
+
+// diffFields lists the fields that differ between a recorded fill and the broker's version
+func diffFields(stored, current *data.BrokerFill) []string {
+	var fields []string
+	if !strings.EqualFold(stored.Symbol, current.Symbol) {
+		fields = append(fields, "symbol")
+	}
+	if stored.Side != current.Side {
+		fields = append(fields, "side")
+	}
+	if stored.Quantity != current.Quantity {
+		fields = append(fields, "quantity")
+	}
+	if math.Abs(stored.Price-current.Price) > 1e-9 {
+		fields = append(fields, "price")
+	}
+	if !stored.FillTime.Equal(current.FillTime) {
+		fields = append(fields, "fill_time")
+	}
+	if utils.StringValue(stored.ProductType) != utils.StringValue(current.ProductType) {
+		fields = append(fields, "product_type")
+	}
+	if utils.StringValue(stored.OrderID) != utils.StringValue(current.OrderID) {
+		fields = append(fields, "order_id")
+	}
+	return fields
+}
+
+// affectedTrades returns the IDs of journal trades the fill's order opened or closed
+// Trades only record their entry order, so as in the trade timeline a trade's exit order is the
+// one with a fill on the closing side at the trade's exit time; that also catches the later part
+// of a carried position closed by another order.
+func affectedTrades(fillRepo *repos.BrokerFillRepository, tradeRepo *repos.TradeRepository, userID int, broker data.TradingBroker, fill *data.BrokerFill) ([]string, error) {
+	orderFills := []*data.BrokerFill{fill}
+	if fill.OrderID != nil {
+		fills, err := fillRepo.GetFillsByOrderIDs(userID, broker, []string{*fill.OrderID})
+		if err != nil {
+			return nil, err
+		}
+		orderFills = append(orderFills, fills...)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(trade *data.Trade) {
+		if !seen[trade.ID] {
+			seen[trade.ID] = true
+			ids = append(ids, trade.ID)
+		}
+	}
+
+	if fill.OrderID != nil {
+		filter := repos.TradeFilter{TradingBroker: &broker, OrderID: fill.OrderID}
+		if err := tradeRepo.ForEachTrade(userID, filter, func(trade *data.Trade) error {
+			add(trade)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	symbol := fill.Symbol
+	filter := repos.TradeFilter{TradingBroker: &broker, Symbol: &symbol}
+	err := tradeRepo.ForEachTrade(userID, filter, func(trade *data.Trade) error {
+		if trade.ExitDate == nil || closingSide(trade.Direction) != fill.Side {
+			return nil
+		}
+		for _, f := range orderFills {
+			if !trade.ExitDate.Before(f.FillTime) && trade.ExitDate.Before(f.FillTime.Add(time.Second)) {
+				add(trade)
+				break
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// closingSide is the fill side that closes a trade in the given direction
+func closingSide(direction data.TradeDirection) string {
+	if direction == data.TradeDirectionShort {
+		return "buy"
+	}
+	return "sell"
+}
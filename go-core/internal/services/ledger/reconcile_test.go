@@ -0,0 +1,257 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/matching"
+	"go-core/internal/testutil"
+)
+
+var day = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+func fill(tradeID, orderID, symbol string, side matching.Side, quantity int, price float64, minute int) matching.Fill {
+	return matching.Fill{
+		TradeID: tradeID, OrderID: orderID, Symbol: symbol, Product: "CNC", Side: side,
+		Quantity: quantity, Price: price, Time: day.Add(4*time.Hour + time.Duration(minute)*time.Minute),
+	}
+}
+
+// newLedger opens a fresh database with one user whose ledger holds three imported fills
+func newLedger(t *testing.T) (*Service, *data.DB, int) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+
+	user := &data.User{Name: "trader", Email: "trader@example.com", CreatedAt: time.Now().UTC()}
+	if err := repos.NewUserRepository(db.GetConnection(), nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	service := NewService(db.GetConnection())
+	result, err := service.Import(user.ID, data.TradingBrokerZerodha, []matching.Fill{
+		fill("T1", "O1", "INFY", matching.SideBuy, 10, 100, 0),
+		fill("T2", "O2", "INFY", matching.SideSell, 5, 110, 30),
+		fill("T3", "O3", "TCS", matching.SideBuy, 3, 3900, 60),
+	}, matching.MethodFIFO)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Recorded != 3 {
+		t.Fatalf("import recorded %d fills, want 3", result.Recorded)
+	}
+	return service, db, user.ID
+}
+
+// brokerFills is the broker's view of the day: T1 unchanged, T2 repriced, T3 gone, T4 new and
+// one fill without an exchange trade ID
+func brokerFills() []matching.Fill {
+	return []matching.Fill{
+		fill("T1", "O1", "INFY", matching.SideBuy, 10, 100, 0),
+		fill("T2", "O2", "INFY", matching.SideSell, 5, 111, 30),
+		fill("T4", "O4", "INFY", matching.SideSell, 5, 120, 90),
+		fill("", "O5", "SBIN", matching.SideBuy, 1, 700, 95),
+		fill("T1", "O1", "INFY", matching.SideBuy, 10, 100, 0),
+	}
+}
+
+func tradeIDs(changes []Change) []string {
+	ids := []string{}
+	for _, change := range changes {
+		ids = append(ids, change.TradeID)
+	}
+	return ids
+}
+
+func storedFills(t *testing.T, db *data.DB, userID int) map[string]*data.BrokerFill {
+	t.Helper()
+	fills, err := repos.NewBrokerFillRepository(db.GetConnection()).GetFillsInRange(userID, data.TradingBrokerZerodha, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("list fills: %v", err)
+	}
+	byID := make(map[string]*data.BrokerFill, len(fills))
+	for _, f := range fills {
+		byID[f.TradeID] = f
+	}
+	return byID
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name      string
+		apply     bool
+		wantFills map[string]float64 // stored trade ID -> price after reconciling
+	}{
+		{name: "dry run leaves the ledger alone", wantFills: map[string]float64{"T1": 100, "T2": 110, "T3": 3900}},
+		{name: "apply updates, removes and records fills", apply: true, wantFills: map[string]float64{"T1": 100, "T2": 111, "T4": 120}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db, userID := newLedger(t)
+
+			report, err := service.Reconcile(ReconcileOptions{
+				UserID: userID, Broker: data.TradingBrokerZerodha, Fills: brokerFills(),
+				From: day, To: day, Method: matching.MethodFIFO, Apply: tt.apply,
+			})
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			if report.Fetched != 5 || report.Unchanged != 1 || report.Untracked != 1 {
+				t.Errorf("fetched %d, unchanged %d, untracked %d; want 5, 1, 1", report.Fetched, report.Unchanged, report.Untracked)
+			}
+			for _, kind := range []struct {
+				name    string
+				changes []Change
+				want    []string
+			}{
+				{"added", report.Added, []string{"T4"}},
+				{"changed", report.Changed, []string{"T2"}},
+				{"missing", report.Missing, []string{"T3"}},
+			} {
+				if got := tradeIDs(kind.changes); !reflect.DeepEqual(got, kind.want) {
+					t.Errorf("%s = %v, want %v", kind.name, got, kind.want)
+				}
+			}
+			if len(report.Changed) == 1 {
+				changed := report.Changed[0]
+				if !reflect.DeepEqual(changed.Fields, []string{"price"}) {
+					t.Errorf("changed fields = %v, want [price]", changed.Fields)
+				}
+				if len(changed.AffectedTrades) != 1 {
+					t.Errorf("repriced exit fill affects trades %v, want the closed INFY trade", changed.AffectedTrades)
+				}
+			}
+			if len(report.Missing) == 1 && len(report.Missing[0].AffectedTrades) != 1 {
+				t.Errorf("missing fill affects trades %v, want the TCS trade", report.Missing[0].AffectedTrades)
+			}
+			if len(report.Warnings) != 2 {
+				t.Errorf("warnings = %q, want untracked and review warnings", report.Warnings)
+			}
+
+			stored := storedFills(t, db, userID)
+			got := make(map[string]float64, len(stored))
+			for id, f := range stored {
+				got[id] = f.Price
+			}
+			if !reflect.DeepEqual(got, tt.wantFills) {
+				t.Errorf("stored fills = %v, want %v", got, tt.wantFills)
+			}
+			if tt.apply && (report.Import == nil || report.Import.Recorded != 1 || report.Import.Updated != 1) {
+				t.Errorf("import = %+v, want the added fill recorded and the open INFY trade reduced", report.Import)
+			}
+		})
+	}
+}
+
+func TestReconcileWarnsAboutFillsOutsideTheWindow(t *testing.T) {
+	service, _, userID := newLedger(t)
+
+	// The broker moved T3 to the next day; the ledger still has it on day
+	moved := fill("T3", "O3", "TCS", matching.SideBuy, 3, 3900, 60)
+	moved.Time = moved.Time.AddDate(0, 0, 1)
+	next := day.AddDate(0, 0, 1)
+
+	report, err := service.Reconcile(ReconcileOptions{
+		UserID: userID, Broker: data.TradingBrokerZerodha, Fills: []matching.Fill{moved},
+		From: next, To: next, Method: matching.MethodFIFO,
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(report.Added) != 0 || len(report.Warnings) != 1 {
+		t.Fatalf("added %v with warnings %q; want no additions and one warning", tradeIDs(report.Added), report.Warnings)
+	}
+}
+
+func TestReconcileFlagsTradesClosedByAnExitFill(t *testing.T) {
+	tests := []struct {
+		name   string
+		fills  []matching.Fill
+		change func(*Report) []Change
+	}{
+		{
+			name: "amended exit fill",
+			fills: []matching.Fill{
+				fill("T1", "O1", "INFY", matching.SideBuy, 10, 100, 0),
+				fill("T2", "O2", "INFY", matching.SideSell, 5, 111, 30),
+				fill("T3", "O3", "TCS", matching.SideBuy, 3, 3900, 60),
+			},
+			change: func(report *Report) []Change { return report.Changed },
+		},
+		{
+			name: "removed exit fill",
+			fills: []matching.Fill{
+				fill("T1", "O1", "INFY", matching.SideBuy, 10, 100, 0),
+				fill("T3", "O3", "TCS", matching.SideBuy, 3, 3900, 60),
+			},
+			change: func(report *Report) []Change { return report.Missing },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db, userID := newLedger(t)
+
+			// Selling 5 of the 10 bought split the O1 position into a trade closed by O2 and an open one
+			var closed []string
+			symbol := "INFY"
+			if err := repos.NewTradeRepository(db.GetConnection()).ForEachTrade(userID, repos.TradeFilter{Symbol: &symbol}, func(trade *data.Trade) error {
+				if trade.ExitDate != nil {
+					closed = append(closed, trade.ID)
+				}
+				return nil
+			}); err != nil {
+				t.Fatalf("list trades: %v", err)
+			}
+			if len(closed) != 1 {
+				t.Fatalf("closed INFY trades = %v, want one", closed)
+			}
+
+			report, err := service.Reconcile(ReconcileOptions{
+				UserID: userID, Broker: data.TradingBrokerZerodha, Fills: tt.fills,
+				From: day, To: day, Method: matching.MethodFIFO,
+			})
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			changes := tt.change(report)
+			if got := tradeIDs(changes); !reflect.DeepEqual(got, []string{"T2"}) {
+				t.Fatalf("changes = %v, want [T2]", got)
+			}
+			if !reflect.DeepEqual(changes[0].AffectedTrades, closed) {
+				t.Errorf("affected trades = %v, want the trade O2 closed %v", changes[0].AffectedTrades, closed)
+			}
+		})
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	at := day.Add(5 * time.Hour)
+	mis, cnc, order := "MIS", "CNC", "O1"
+	base := data.BrokerFill{Symbol: "INFY", Side: "buy", Quantity: 10, Price: 100, FillTime: at, ProductType: &cnc, OrderID: &order}
+
+	tests := []struct {
+		name   string
+		modify func(*data.BrokerFill)
+		want   []string
+	}{
+		{name: "identical", modify: func(*data.BrokerFill) {}},
+		{name: "symbol case is ignored", modify: func(f *data.BrokerFill) { f.Symbol = "infy" }},
+		{name: "price", modify: func(f *data.BrokerFill) { f.Price = 100.05 }, want: []string{"price"}},
+		{name: "quantity and side", modify: func(f *data.BrokerFill) { f.Quantity, f.Side = 5, "sell" }, want: []string{"side", "quantity"}},
+		{name: "fill time", modify: func(f *data.BrokerFill) { f.FillTime = at.Add(time.Second) }, want: []string{"fill_time"}},
+		{name: "product", modify: func(f *data.BrokerFill) { f.ProductType = &mis }, want: []string{"product_type"}},
+		{name: "order dropped", modify: func(f *data.BrokerFill) { f.OrderID = nil }, want: []string{"order_id"}},
+	}
+	for _, tt := range tests {
+		current := base
+		tt.modify(&current)
+		if got := diffFields(&base, &current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffFields = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package matching
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Method selects which open lots a closing fill consumes and at what cost
+type Method string
+
+const (
+	// MethodFIFO closes the oldest open lots first
+	MethodFIFO Method = "fifo"
+	// MethodLIFO closes the newest open lots first
+	MethodLIFO Method = "lifo"
+	// MethodAverage closes lots oldest first but at the position's weighted average cost
+	MethodAverage Method = "average"
+)
+
+// ParseMethod validates a matching method name; empty means FIFO
+func ParseMethod(value string) (Method, error) {
+	switch method := Method(strings.ToLower(strings.TrimSpace(value))); method {
+	case "":
+		return MethodFIFO, nil
+	case MethodFIFO, MethodLIFO, MethodAverage:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unsupported matching method %q (use fifo, lifo or average)", value)
+	}
+}
+
+// Side is the direction of a fill
+type Side string
+
+const (
+	SideBuy  Side = "buy"
+	SideSell Side = "sell"
+)
+
+// Fill is a single execution reported by a broker or importer
+type Fill struct {
+	TradeID         string // exchange trade ID, when the source provides one
+	OrderID         string
+	ExchangeOrderID string
+	Symbol          string
+	Product         string // positions are kept per symbol and product, e.g. CNC and MIS never net off
+	Side            Side
+	Quantity        int
+	Price           float64
+	Time            time.Time
+
+	// Instrument identifiers from the broker, used to normalize Symbol before matching;
+	// the engine itself ignores them
+	Exchange   string
+	SecurityID string
+	ISIN       string
+}
+
+// Lot is an open position slice created by an opening fill
+type Lot struct {
+	Fill      Fill
+	Long      bool
+	Remaining int
+	// Cost is the per-unit cost basis; it equals the fill price except under MethodAverage
+	Cost float64
+	// Ref identifies seeded lots (e.g. an open journal trade) so callers can reconcile them
+	Ref string
+}
+
+// Match pairs part of an open lot with a closing fill
+type Match struct {
+	Open     Lot
+	Close    Fill
+	Quantity int
+	PnL      float64
+}
+
+// Result is the outcome of matching a set of fills
+type Result struct {
+	Matches []Match
+	Open    []Lot
+}
+
+// Engine nets fills into positions and records realized matches
+// Positions carry across days, so overnight and multi-day holdings close against their original lots.
+type Engine struct {
+	method    Method
+	positions map[string][]*Lot
+	order     []string
+	matches   []Match
+}
+
+// NewEngine creates an engine using the given method
+func NewEngine(method Method) *Engine {
+	return &Engine{method: method, positions: make(map[string][]*Lot)}
+}
+
+// Seed adds an already-open lot, e.g. a position carried forward from an earlier sync
+func (e *Engine) Seed(lot Lot) {
+	if lot.Remaining <= 0 {
+		return
+	}
+	if lot.Cost == 0 {
+		lot.Cost = lot.Fill.Price
+	}
+	key := positionKey(lot.Fill)
+	e.open(key, &lot)
+}
+
+// Add applies one fill; fills must be added in time order (see Run)
+// A fill larger than the opposing position closes it and opens the remainder the other way.
+func (e *Engine) Add(fill Fill) {
+	if fill.Quantity <= 0 {
+		return
+	}
+	key := positionKey(fill)
+	long := fill.Side == SideBuy
+	remaining := fill.Quantity
+
+	for remaining > 0 {
+		lots := e.positions[key]
+		if len(lots) == 0 || lots[0].Long == long {
+			break
+		}
+
+		index := 0
+		if e.method == MethodLIFO {
+			index = len(lots) - 1
+		}
+		lot := lots[index]
+
+		quantity := min(remaining, lot.Remaining)
+		pnl := (fill.Price - lot.Cost) * float64(quantity)
+		if !lot.Long {
+			pnl = -pnl
+		}
+
+		matched := *lot
+		matched.Remaining = quantity
+		e.matches = append(e.matches, Match{Open: matched, Close: fill, Quantity: quantity, PnL: pnl})
+
+		lot.Remaining -= quantity
+		remaining -= quantity
+		if lot.Remaining == 0 {
+			e.positions[key] = append(lots[:index:index], lots[index+1:]...)
+		}
+	}
+
+	if remaining > 0 {
+		e.open(key, &Lot{Fill: fill, Long: long, Remaining: remaining, Cost: fill.Price})
+	}
+}
+
+// open appends a lot to its position, re-averaging costs under MethodAverage
+func (e *Engine) open(key string, lot *Lot) {
+	if _, seen := e.positions[key]; !seen {
+		e.order = append(e.order, key)
+	}
+	lots := append(e.positions[key], lot)
+	e.positions[key] = lots
+
+	if e.method == MethodAverage && len(lots) > 1 {
+		var quantity int
+		var cost float64
+		for _, l := range lots {
+			quantity += l.Remaining
+			cost += l.Cost * float64(l.Remaining)
+		}
+		average := cost / float64(quantity)
+		for _, l := range lots {
+			l.Cost = average
+		}
+	}
+}
+
+// Result returns the matches so far and the lots still open, in first-seen position order
+func (e *Engine) Result() Result {
+	result := Result{Matches: e.matches}
+	for _, key := range e.order {
+		for _, lot := range e.positions[key] {
+			result.Open = append(result.Open, *lot)
+		}
+	}
+	return result
+}
+
+// Run sorts fills chronologically and matches them, starting from any seeded lots
+// Fills with the same timestamp keep their input order.
+func Run(fills []Fill, method Method, seeds ...Lot) Result {
+	sorted := make([]Fill, len(fills))
+	copy(sorted, fills)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	engine := NewEngine(method)
+	for _, seed := range seeds {
+		engine.Seed(seed)
+	}
+	for _, fill := range sorted {
+		engine.Add(fill)
+	}
+	return engine.Result()
+}
+
+// positionKey groups fills that net against each other
+func positionKey(fill Fill) string {
+	return strings.ToUpper(strings.TrimSpace(fill.Symbol)) + "|" + strings.ToUpper(fill.Product)
+}
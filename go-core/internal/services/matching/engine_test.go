@@ -0,0 +1,174 @@
+package matching
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+
+// fill builds a CNC fill the given number of minutes after start
+func fill(symbol string, side Side, quantity int, price float64, minute int) Fill {
+	return Fill{Symbol: symbol, Product: "CNC", Side: side, Quantity: quantity, Price: price, Time: start.Add(time.Duration(minute) * time.Minute)}
+}
+
+// matched is the part of a Match the tests compare
+type matched struct {
+	OpenPrice float64
+	Quantity  int
+	PnL       float64
+}
+
+// open is the part of a Lot the tests compare
+type open struct {
+	Symbol    string
+	Long      bool
+	Remaining int
+	Cost      float64
+}
+
+func summarize(result Result) ([]matched, []open) {
+	var matches []matched
+	for _, m := range result.Matches {
+		matches = append(matches, matched{m.Open.Fill.Price, m.Quantity, m.PnL})
+	}
+	var lots []open
+	for _, lot := range result.Open {
+		lots = append(lots, open{lot.Fill.Symbol, lot.Long, lot.Remaining, lot.Cost})
+	}
+	return matches, lots
+}
+
+func TestRun(t *testing.T) {
+	scaleIn := []Fill{
+		fill("INFY", SideBuy, 10, 100, 0),
+		fill("INFY", SideBuy, 10, 110, 1),
+		fill("INFY", SideSell, 15, 120, 2),
+	}
+
+	tests := []struct {
+		name        string
+		method      Method
+		fills       []Fill
+		seeds       []Lot
+		wantMatches []matched
+		wantOpen    []open
+	}{
+		{
+			name:        "fifo closes the oldest lot first",
+			method:      MethodFIFO,
+			fills:       scaleIn,
+			wantMatches: []matched{{100, 10, 200}, {110, 5, 50}},
+			wantOpen:    []open{{"INFY", true, 5, 110}},
+		},
+		{
+			name:        "lifo closes the newest lot first",
+			method:      MethodLIFO,
+			fills:       scaleIn,
+			wantMatches: []matched{{110, 10, 100}, {100, 5, 100}},
+			wantOpen:    []open{{"INFY", true, 5, 100}},
+		},
+		{
+			name:        "average closes at the weighted average cost",
+			method:      MethodAverage,
+			fills:       scaleIn,
+			wantMatches: []matched{{100, 10, 150}, {110, 5, 75}},
+			wantOpen:    []open{{"INFY", true, 5, 105}},
+		},
+		{
+			name:   "partial exits leave the rest open",
+			method: MethodFIFO,
+			fills: []Fill{
+				fill("TCS", SideBuy, 10, 3900, 0),
+				fill("TCS", SideSell, 4, 3950, 1),
+				fill("TCS", SideSell, 3, 3850, 2),
+			},
+			wantMatches: []matched{{3900, 4, 200}, {3900, 3, -150}},
+			wantOpen:    []open{{"TCS", true, 3, 3900}},
+		},
+		{
+			name:   "an oversized fill flips the position and the short closes in profit",
+			method: MethodFIFO,
+			fills: []Fill{
+				fill("SBIN", SideBuy, 5, 100, 0),
+				fill("SBIN", SideSell, 8, 90, 1),
+				fill("SBIN", SideBuy, 3, 80, 2),
+			},
+			wantMatches: []matched{{100, 5, -50}, {90, 3, 30}},
+		},
+		{
+			name:   "fills are sorted by time before matching",
+			method: MethodFIFO,
+			fills: []Fill{
+				fill("INFY", SideSell, 10, 120, 5),
+				fill("INFY", SideBuy, 10, 100, 0),
+			},
+			wantMatches: []matched{{100, 10, 200}},
+		},
+		{
+			name:   "symbols are normalized and products never net off",
+			method: MethodFIFO,
+			fills: []Fill{
+				fill("infy ", SideBuy, 10, 100, 0),
+				{Symbol: "INFY", Product: "MIS", Side: SideSell, Quantity: 10, Price: 101, Time: start.Add(time.Minute)},
+				fill("INFY", SideSell, 4, 105, 2),
+			},
+			wantMatches: []matched{{100, 4, 20}},
+			wantOpen:    []open{{"infy ", true, 6, 100}, {"INFY", false, 10, 101}},
+		},
+		{
+			name:   "seeded lots close first and default their cost to the fill price",
+			method: MethodFIFO,
+			seeds: []Lot{
+				{Fill: fill("INFY", SideBuy, 5, 90, -60), Long: true, Remaining: 5, Ref: "journal"},
+				{Fill: fill("INFY", SideBuy, 5, 95, -30), Long: true, Remaining: 0},
+			},
+			fills:       []Fill{fill("INFY", SideSell, 5, 100, 0), fill("INFY", SideBuy, 0, 100, 1)},
+			wantMatches: []matched{{90, 5, 50}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, lots := summarize(Run(tt.fills, tt.method, tt.seeds...))
+			if !reflect.DeepEqual(matches, tt.wantMatches) {
+				t.Errorf("matches = %+v, want %+v", matches, tt.wantMatches)
+			}
+			if !reflect.DeepEqual(lots, tt.wantOpen) {
+				t.Errorf("open lots = %+v, want %+v", lots, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestRunKeepsSeedRefs(t *testing.T) {
+	seed := Lot{Fill: fill("INFY", SideBuy, 5, 90, -60), Long: true, Remaining: 5, Ref: "trade-1"}
+	result := Run([]Fill{fill("INFY", SideSell, 2, 100, 0)}, MethodFIFO, seed)
+
+	if len(result.Matches) != 1 || result.Matches[0].Open.Ref != "trade-1" {
+		t.Fatalf("match does not reference the seeded lot: %+v", result.Matches)
+	}
+	if len(result.Open) != 1 || result.Open[0].Ref != "trade-1" || result.Open[0].Remaining != 3 {
+		t.Fatalf("open lots = %+v, want trade-1 with 3 remaining", result.Open)
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Method
+		wantErr bool
+	}{
+		{value: "", want: MethodFIFO},
+		{value: "fifo", want: MethodFIFO},
+		{value: " LIFO ", want: MethodLIFO},
+		{value: "Average", want: MethodAverage},
+		{value: "hifo", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMethod(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMethod(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package papertrade
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/tradesim"
+	"go-core/internal/utils"
+)
+
+// journal brings the algorithm's journal trades in line with its paper account
+// Each round trip closed closes the journal trade of its symbol with the quantity it closed;
+// each open position then has a journal trade, opened for it if the position is new or was
+// partly closed, and updated if it was added to or its stop loss or target moved. Journal
+// trades the user deleted or closed by hand are left alone.
+func journal(repo *repos.TradeRepository, algo *data.Algorithm, paper *data.PaperAccount, account *tradesim.Account, closed []data.SimulatedTrade, now time.Time) error {
+	open := make(map[string]*data.Trade)
+	filter := repos.TradeFilter{AlgorithmID: &algo.ID, OpenOnly: true}
+	err := repo.ForEachTrade(algo.UserID, filter, func(trade *data.Trade) error {
+		open[trade.ID] = trade
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, trip := range closed {
+		paper.TotalTrades++
+		if trip.PnL > 0 {
+			paper.WinningTrades++
+		}
+
+		trade := open[paper.OpenTrades[trip.Symbol]]
+		delete(paper.OpenTrades, trip.Symbol)
+		if trade == nil {
+			continue
+		}
+		delete(open, trade.ID)
+		exitPrice, exitDate := trip.ExitPrice, trip.ExitTime
+		trade.Quantity = trip.Quantity
+		trade.EntryPrice = trip.EntryPrice
+		trade.TotalAmount = trip.EntryPrice * float64(trip.Quantity)
+		trade.ExitPrice = &exitPrice
+		trade.ExitDate = &exitDate
+		trade.OutcomeSummary = outcome(trip.PnL)
+		trade.UpdatedAt = now
+		if err := repo.UpdateTrade(trade); err != nil {
+			return err
+		}
+	}
+
+	symbols := make([]string, 0, len(account.Positions))
+	for symbol := range account.Positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		position := account.Positions[symbol]
+		trade := open[paper.OpenTrades[symbol]]
+		if trade == nil {
+			trade = newTrade(algo, symbol, position, now)
+			if err := repo.CreateTrade(trade); err != nil {
+				return err
+			}
+			paper.OpenTrades[symbol] = trade.ID
+			continue
+		}
+		if matches(trade, position) {
+			continue
+		}
+		trade.Quantity = abs(position.Quantity)
+		trade.EntryPrice = position.AveragePrice
+		trade.TotalAmount = position.AveragePrice * float64(trade.Quantity)
+		trade.StopLoss = position.StopLoss
+		trade.Target = position.Target
+		trade.UpdatedAt = now
+		if err := repo.UpdateTrade(trade); err != nil {
+			return err
+		}
+	}
+
+	for symbol := range paper.OpenTrades {
+		if account.Positions[symbol] == nil {
+			delete(paper.OpenTrades, symbol)
+		}
+	}
+	return nil
+}
+
+// newTrade creates the journal trade of an open position
+func newTrade(algo *data.Algorithm, symbol string, position *tradesim.Position, now time.Time) *data.Trade {
+	direction, transactionType := data.TradeDirectionLong, "buy"
+	if position.Quantity < 0 {
+		direction, transactionType = data.TradeDirectionShort, "sell"
+	}
+	quantity := abs(position.Quantity)
+	algorithmID := algo.ID
+
+	return &data.Trade{
+		ID:              utils.GenerateID(),
+		UserID:          algo.UserID,
+		Symbol:          symbol,
+		MarketType:      data.MarketTypeIndian,
+		EntryDate:       position.EntryTime,
+		EntryPrice:      position.AveragePrice,
+		Quantity:        quantity,
+		TotalAmount:     position.AveragePrice * float64(quantity),
+		Direction:       direction,
+		StopLoss:        position.StopLoss,
+		Target:          position.Target,
+		Strategy:        algo.Name,
+		OutcomeSummary:  data.OutcomeSummaryBreakeven,
+		RulesFollowed:   []string{},
+		Screenshots:     []string{},
+		TransactionType: &transactionType,
+		AlgorithmID:     &algorithmID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// matches reports whether a journal trade already describes position
+func matches(trade *data.Trade, position *tradesim.Position) bool {
+	return trade.Quantity == abs(position.Quantity) && trade.EntryPrice == position.AveragePrice &&
+		equal(trade.StopLoss, position.StopLoss) && equal(trade.Target, position.Target)
+}
+
+// outcome classifies a round trip's P&L after charges
+func outcome(pnl float64) data.OutcomeSummary {
+	switch {
+	case pnl > 0:
+		return data.OutcomeSummaryProfitable
+	case pnl < 0:
+		return data.OutcomeSummaryLoss
+	}
+	return data.OutcomeSummaryBreakeven
+}
+
+func equal(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// round rounds to the paisa
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,41 @@
+package papertrade
+
+import (
+	"context"
+	"sync"
+)
+
+// accounts serializes the changes to each paper account within the process
+// Advances from the API and the scheduler, and reconfigurations, would otherwise read the
+// same last bar, replay the same bars and journal their trades twice.
+var accounts = struct {
+	mu   sync.Mutex
+	held map[string]chan struct{} // closed when the algorithm's account is released
+}{held: make(map[string]chan struct{})}
+
+// lockAccount waits until no other advance or reconfiguration of the algorithm's paper account
+// is in progress, or ctx is done, and returns the function that releases the account
+func lockAccount(ctx context.Context, algorithmID string) (func(), error) {
+	for {
+		accounts.mu.Lock()
+		released, busy := accounts.held[algorithmID]
+		if !busy {
+			done := make(chan struct{})
+			accounts.held[algorithmID] = done
+			accounts.mu.Unlock()
+			return func() {
+				accounts.mu.Lock()
+				delete(accounts.held, algorithmID)
+				accounts.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		accounts.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// Package papertrade trades algorithms in paper trading mode: each has a simulated account
+// that acts on its signals as new bars reach the candle store, fills orders the way backtests
+// do, and journals the positions it opens and closes as trades tagged with the algorithm's ID.
+package papertrade
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/services/tradesim"
+	"go-core/internal/utils"
+)
+
+// defaultMaxBars caps the bars one advance processes unless PAPER_MAX_BARS says otherwise
+const defaultMaxBars = 1000
+
+// ExitReset is the exit reason of positions closed because their account was reset
+const ExitReset = "reset"
+
+var (
+	// ErrInvalidSettings wraps settings a paper account cannot trade with
+	ErrInvalidSettings = errors.New("invalid paper trading settings")
+	// ErrNotPaperTrading is returned when advancing an algorithm in another execution mode
+	ErrNotPaperTrading = errors.New("algorithm is not in paper trading mode")
+)
+
+// Service runs algorithms against their paper accounts
+type Service struct {
+	db      *sql.DB
+	limits  algoruntime.Limits
+	maxBars int
+}
+
+// NewService creates a paper trading service
+// PAPER_MAX_BARS caps the bars one advance processes, default 1000; later bars wait for the
+// next advance.
+func NewService(db *sql.DB) *Service {
+	service := &Service{db: db, limits: algoruntime.DefaultLimits(), maxBars: defaultMaxBars}
+	if value := os.Getenv("PAPER_MAX_BARS"); value != "" {
+		if maxBars, err := strconv.Atoi(value); err == nil && maxBars > 0 {
+			service.maxBars = maxBars
+		}
+	}
+	return service
+}
+
+// Summary is a paper account as the API shows it
+type Summary struct {
+	AlgorithmID   string                        `json:"algorithm_id"`
+	Settings      data.SimulationSettings       `json:"settings"`
+	InitialCash   float64                       `json:"initial_cash"`
+	Cash          float64                       `json:"cash"`
+	Equity        float64                       `json:"equity"`
+	RealizedPnL   float64                       `json:"realized_pnl"` // after charges
+	UnrealizedPnL float64                       `json:"unrealized_pnl"`
+	Charges       float64                       `json:"charges"`
+	Positions     map[string]*tradesim.Position `json:"positions"`
+	Orders        []*tradesim.Order             `json:"orders"`
+	OpenTrades    map[string]string             `json:"open_trades"` // journal trade ID of each open position, by symbol
+	TotalTrades   int                           `json:"total_trades"`
+	WinningTrades int                           `json:"winning_trades"`
+	WinRate       float64                       `json:"win_rate"`
+	LastBarAt     *time.Time                    `json:"last_bar_at,omitempty"`
+	CreatedAt     time.Time                     `json:"created_at"`
+	UpdatedAt     time.Time                     `json:"updated_at"`
+}
+
+// Advance is the outcome of advancing an algorithm over new bars
+type Advance struct {
+	Bars    int                   `json:"bars"` // bars processed
+	Fills   []tradesim.Fill       `json:"fills"`
+	Trades  []data.SimulatedTrade `json:"trades"` // round trips closed
+	Signal  *algoruntime.Signal   `json:"signal,omitempty"`
+	Error   *string               `json:"error,omitempty"` // the code failed on the last bar processed
+	Account *Summary              `json:"account"`
+}
+
+// Get returns an algorithm's paper account, or nil if it has none yet
+func (s *Service) Get(algo *data.Algorithm) (*Summary, error) {
+	paper, err := repos.NewPaperAccountRepository(s.db).GetAccount(algo.ID, algo.UserID)
+	if err != nil || paper == nil {
+		return nil, err
+	}
+	account, err := load(paper)
+	if err != nil {
+		return nil, err
+	}
+	return summarize(paper, account), nil
+}
+
+// Configure gives an algorithm a new paper account with settings, replacing any it has
+// Positions of the old account are closed at their last prices and journaled, and the
+// algorithm's trade count, win rate and P&L start again from zero. An advance of the algorithm
+// in progress finishes first.
+func (s *Service) Configure(algo *data.Algorithm, settings data.SimulationSettings) (*Summary, error) {
+	if err := tradesim.Validate(&settings); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+
+	unlock, err := lockAccount(context.Background(), algo.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	paperRepo := repos.NewPaperAccountRepository(s.db).WithTx(tx)
+	old, err := paperRepo.GetAccount(algo.ID, algo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil {
+		account, err := load(old)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		_, closed := account.CloseAll(ExitReset, now)
+		if err := journal(repos.NewTradeRepository(s.db).WithTx(tx), algo, old, account, closed, now); err != nil {
+			return nil, err
+		}
+	}
+
+	paper, account, err := newAccount(algo, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := paperRepo.SaveAccount(paper); err != nil {
+		return nil, err
+	}
+	if err := repos.NewAlgorithmRepository(s.db).WithTx(tx).RecordPerformance(algo.ID, algo.UserID, 0, 0, 0); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	algo.TotalTrades, algo.WinRate, algo.TotalPnL = 0, 0, 0
+
+	utils.LogInfo("Paper account configured", map[string]interface{}{
+		"algorithm_id":    algo.ID,
+		"initial_capital": settings.InitialCapital,
+	})
+
+	return summarize(paper, account), nil
+}
+
+// Advance runs an algorithm in paper trading mode over the bars stored since it last ran
+// The first advance only trades the latest stored bar. Each bar fills or triggers what is
+// pending on the account, runs the code with the bars before it, up to the settings' lookback,
+// and acts on the signal; the account, the journal, the run log and the algorithm's state, last
+// signal and performance are saved bar by bar. An algorithm without a paper account gets one with the
+// default settings.
+// Code that does not compile returns an *algoruntime.Error without processing anything. Code
+// that fails on a bar stops the advance after that bar, whose orders still fill but whose
+// signal is lost; the error is reported on the result.
+// Advances and reconfigurations of an algorithm run one at a time. The algorithm is reloaded
+// once it is its advance's turn, so an advance that waited continues from the bars and state
+// the one before it left.
+func (s *Service) Advance(ctx context.Context, algo *data.Algorithm) (*Advance, error) {
+	unlock, err := lockAccount(ctx, algo.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	current, err := repos.NewAlgorithmRepository(s.db).GetAlgorithmByID(algo.ID, algo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	*algo = *current
+	if algo.ExecutionMode != data.ExecutionModePaperTrading {
+		return nil, ErrNotPaperTrading
+	}
+
+	program, err := algoruntime.Compile(algo.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	paper, err := repos.NewPaperAccountRepository(s.db).GetAccount(algo.ID, algo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var account *tradesim.Account
+	if paper == nil {
+		paper, account, err = newAccount(algo, data.SimulationSettings{})
+		if err == nil {
+			err = repos.NewPaperAccountRepository(s.db).SaveAccount(paper)
+		}
+	} else {
+		account, err = load(paper)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candles, warmup, err := s.load(algo, paper)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Advance{Fills: []tradesim.Fill{}, Trades: []data.SimulatedTrade{}}
+	bars := algoruntime.NewBars(candles)
+	for i := warmup; i < len(candles); i++ {
+		bar := candles[i]
+		fills, trades := account.Step(bar)
+
+		input := bars.Input(max(0, i+1-paper.Settings.Lookback), i+1)
+		input.Symbol = algo.Symbol
+		input.Portfolio = account.Portfolio()
+		run, runErr := program.Run(ctx, input, algo.State, algo.Config, s.limits)
+		record := algoruntime.NewRun(algo, data.AlgorithmRunSourcePaper, input, algo.State, run, runErr)
+		if runErr != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var codeErr *algoruntime.Error
+			if !errors.As(runErr, &codeErr) {
+				return nil, runErr
+			}
+			message := fmt.Sprintf("bar %s: %s", bar.Timestamp.Format(time.RFC3339), codeErr.Error())
+			result.Error = &message
+			run = nil
+		} else {
+			acted, closed := account.Act(run.Signal, bar, paper.Settings)
+			fills = append(fills, acted...)
+			trades = append(trades, closed...)
+			result.Signal = run.Signal
+		}
+
+		paper.LastBarAt = &bar.Timestamp
+		if err := s.commit(algo, paper, account, trades, run, record); err != nil {
+			return nil, err
+		}
+		algoruntime.Publish(record)
+		result.Fills = append(result.Fills, fills...)
+		result.Trades = append(result.Trades, trades...)
+		result.Bars++
+		if result.Error != nil {
+			break
+		}
+	}
+	result.Account = summarize(paper, account)
+
+	if result.Bars > 0 {
+		utils.LogInfo("Paper trading advanced", map[string]interface{}{
+			"algorithm_id": algo.ID,
+			"bars":         result.Bars,
+			"fills":        len(result.Fills),
+			"trades":       len(result.Trades),
+			"failed":       result.Error != nil,
+		})
+	}
+
+	return result, nil
+}
+
+// load reads the bars to process and the warmup bars before them
+// It returns the bars oldest first and the index of the first bar to process.
+func (s *Service) load(algo *data.Algorithm, paper *data.PaperAccount) ([]*data.Candle, int, error) {
+	repo := repos.NewCandleRepository(s.db)
+	lookback := paper.Settings.Lookback
+
+	if paper.LastBarAt == nil {
+		candles, err := repo.GetLatestCandles(algo.Symbol, algo.Timeframe, time.Time{}, lookback)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load candles: %w", err)
+		}
+		return candles, max(0, len(candles)-1), nil
+	}
+
+	candles, err := repo.GetCandles(algo.Symbol, algo.Timeframe, paper.LastBarAt.Add(time.Nanosecond), time.Time{}, s.maxBars)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load candles: %w", err)
+	}
+	if len(candles) == 0 {
+		return nil, 0, nil
+	}
+	warmup, err := repo.GetLatestCandles(algo.Symbol, algo.Timeframe, candles[0].Timestamp, lookback-1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load candles: %w", err)
+	}
+	return append(warmup, candles...), len(warmup), nil
+}
+
+// commit saves one processed bar: the account, the journal, the run's record, signal and state,
+// and the algorithm's performance
+func (s *Service) commit(algo *data.Algorithm, paper *data.PaperAccount, account *tradesim.Account, trades []data.SimulatedTrade, run *algoruntime.Result, record *data.AlgorithmRun) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if err := journal(repos.NewTradeRepository(s.db).WithTx(tx), algo, paper, account, trades, now); err != nil {
+		return err
+	}
+
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %w", err)
+	}
+	paper.Account = accountJSON
+	paper.UpdatedAt = now
+	if err := repos.NewPaperAccountRepository(s.db).WithTx(tx).SaveAccount(paper); err != nil {
+		return err
+	}
+
+	if err := repos.NewAlgorithmRunRepository(s.db).WithTx(tx).CreateRun(record); err != nil {
+		return err
+	}
+	algoRepo := repos.NewAlgorithmRepository(s.db).WithTx(tx)
+	if run != nil {
+		if err := algoRepo.RecordRun(algo.ID, algo.UserID, now, run.Signal.Signal, run.State); err != nil {
+			return err
+		}
+	}
+	winRate := winRate(paper)
+	pnl := round(account.RealizedPnL)
+	if err := algoRepo.RecordPerformance(algo.ID, algo.UserID, paper.TotalTrades, winRate, pnl); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if run != nil {
+		algo.LastRunAt = &now
+		algo.LastSignal = &run.Signal.Signal
+		algo.State = run.State
+	}
+	algo.TotalTrades, algo.WinRate, algo.TotalPnL = paper.TotalTrades, winRate, pnl
+	return nil
+}
+
+// newAccount creates a paper account holding only the settings' initial capital
+func newAccount(algo *data.Algorithm, settings data.SimulationSettings) (*data.PaperAccount, *tradesim.Account, error) {
+	if err := tradesim.Validate(&settings); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSettings, err)
+	}
+	account := tradesim.NewAccount(settings.InitialCapital, tradesim.CostsOf(settings))
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal account: %w", err)
+	}
+
+	now := time.Now().UTC()
+	paper := &data.PaperAccount{
+		AlgorithmID: algo.ID,
+		UserID:      algo.UserID,
+		Settings:    settings,
+		Account:     accountJSON,
+		OpenTrades:  map[string]string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return paper, account, nil
+}
+
+// load restores the simulated account of a paper account
+func load(paper *data.PaperAccount) (*tradesim.Account, error) {
+	var account tradesim.Account
+	if err := json.Unmarshal(paper.Account, &account); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account: %w", err)
+	}
+	if account.Positions == nil {
+		account.Positions = make(map[string]*tradesim.Position)
+	}
+	if account.Orders == nil {
+		account.Orders = []*tradesim.Order{}
+	}
+	if paper.OpenTrades == nil {
+		paper.OpenTrades = map[string]string{}
+	}
+	account.Costs = tradesim.CostsOf(paper.Settings)
+	return &account, nil
+}
+
+// summarize describes a paper account and its simulated account
+func summarize(paper *data.PaperAccount, account *tradesim.Account) *Summary {
+	var unrealized float64
+	for _, position := range account.Positions {
+		unrealized += float64(position.Quantity)*(position.LastPrice-position.AveragePrice) - position.EntryCharges
+	}
+	return &Summary{
+		AlgorithmID:   paper.AlgorithmID,
+		Settings:      paper.Settings,
+		InitialCash:   account.InitialCash,
+		Cash:          round(account.Cash),
+		Equity:        round(account.Equity()),
+		RealizedPnL:   round(account.RealizedPnL),
+		UnrealizedPnL: round(unrealized),
+		Charges:       round(account.Charges),
+		Positions:     account.Positions,
+		Orders:        account.Orders,
+		OpenTrades:    paper.OpenTrades,
+		TotalTrades:   paper.TotalTrades,
+		WinningTrades: paper.WinningTrades,
+		WinRate:       winRate(paper),
+		LastBarAt:     paper.LastBarAt,
+		CreatedAt:     paper.CreatedAt,
+		UpdatedAt:     paper.UpdatedAt,
+	}
+}
+
+// winRate is the share of a paper account's round trips that made money, 0 to 1
+func winRate(paper *data.PaperAccount) float64 {
+	if paper.TotalTrades == 0 {
+		return 0
+	}
+	return float64(paper.WinningTrades) / float64(paper.TotalTrades)
+}
@@ -0,0 +1,223 @@
+package papertrade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/algoruntime"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+// failing buys 10 shares on its second bar and fails on its fourth
+const failing = `def algorithm(data, context):
+    state = context['state']
+    state['bar'] = state.get('bar', 0) + 1
+    if state['bar'] == 4:
+        fail('boom')
+    if state['bar'] == 2:
+        return {'signal': 'BUY', 'quantity': 10}
+    return {'signal': 'HOLD'}
+`
+
+type fixture struct {
+	service *Service
+	db      *data.DB
+	algo    *data.Algorithm
+}
+
+// newFixture opens a fresh database with an algorithm of a user in mode
+func newFixture(t *testing.T, code string, mode data.ExecutionMode) *fixture {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	conn := db.GetConnection()
+
+	user := &data.User{Name: "trader", Email: "trader@example.com", CreatedAt: time.Now().UTC()}
+	if err := repos.NewUserRepository(conn, nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	now := time.Now().UTC()
+	algo := &data.Algorithm{
+		ID: utils.GenerateID(), UserID: user.ID, Name: "Failing", Code: code, Status: data.AlgorithmStatusDraft,
+		Symbol: "INFY", Timeframe: data.Timeframe1m, ExecutionMode: mode,
+		State: map[string]interface{}{}, Version: 1, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repos.NewAlgorithmRepository(conn).CreateAlgorithm(algo); err != nil {
+		t.Fatalf("create algorithm: %v", err)
+	}
+	return &fixture{service: NewService(conn), db: db, algo: algo}
+}
+
+// store saves one-minute INFY bars from 9:15 IST on 7 January 2030 closing at 100, 101, ...,
+// each opening half a rupee below its close
+func (f *fixture) store(t *testing.T, from, to int) {
+	t.Helper()
+	start := time.Date(2030, 1, 7, 3, 45, 0, 0, time.UTC)
+	for i := from; i < to; i++ {
+		price := 100 + float64(i)
+		candle := &data.Candle{
+			Symbol: "INFY", Timeframe: data.Timeframe1m, Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open: price - 0.5, High: price + 1, Low: price - 1, Close: price, Volume: 1000,
+		}
+		if err := repos.NewCandleRepository(f.db.GetConnection()).UpsertCandle(candle); err != nil {
+			t.Fatalf("store candle: %v", err)
+		}
+	}
+}
+
+func (f *fixture) account(t *testing.T) *data.PaperAccount {
+	t.Helper()
+	paper, err := repos.NewPaperAccountRepository(f.db.GetConnection()).GetAccount(f.algo.ID, f.algo.UserID)
+	if err != nil {
+		t.Fatalf("get paper account: %v", err)
+	}
+	return paper
+}
+
+func TestAdvanceStopsAfterTheFailingBar(t *testing.T) {
+	f := newFixture(t, failing, data.ExecutionModePaperTrading)
+	f.store(t, 0, 1)
+	if first, err := f.service.Advance(context.Background(), f.algo); err != nil || first.Bars != 1 {
+		t.Fatalf("first advance %+v, %v; want the latest bar", first, err)
+	}
+
+	// Bars two to four: the second buys at the third's open, 101.5, and the fourth fails
+	f.store(t, 1, 6)
+	result, err := f.service.Advance(context.Background(), f.algo)
+	if err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if want := "bar 2030-01-07T03:48:00Z: runtime error at line 5: fail: boom"; result.Bars != 3 || result.Error == nil || *result.Error != want {
+		t.Fatalf("advance over %d bars: %v, want %q on the third", result.Bars, result.Error, want)
+	}
+	if len(result.Fills) != 1 || result.Fills[0].Price != 101.5 || result.Account.Positions["INFY"] == nil {
+		t.Fatalf("fills %+v, want the buy at 101.5 still open", result.Fills)
+	}
+
+	// The failing bar is processed, so the next advance starts after it, and its state is lost
+	if paper := f.account(t); paper.LastBarAt == nil || !paper.LastBarAt.Equal(time.Date(2030, 1, 7, 3, 48, 0, 0, time.UTC)) {
+		t.Fatalf("last bar %v, want the failing bar", paper.LastBarAt)
+	}
+	if f.algo.State["bar"] != int64(3) {
+		t.Fatalf("state %v, want the third bar's", f.algo.State)
+	}
+}
+
+func TestAdvanceRejectsWithoutTrading(t *testing.T) {
+	live := newFixture(t, failing, data.ExecutionModeLiveTrading)
+	live.store(t, 0, 3)
+	if _, err := live.service.Advance(context.Background(), live.algo); !errors.Is(err, ErrNotPaperTrading) {
+		t.Errorf("live algorithm: error %v, want ErrNotPaperTrading", err)
+	}
+	if live.account(t) != nil {
+		t.Errorf("live algorithm was given a paper account")
+	}
+
+	bad := newFixture(t, "def algorithm(data):\n    return {}\n", data.ExecutionModePaperTrading)
+	bad.store(t, 0, 3)
+	var codeErr *algoruntime.Error
+	if _, err := bad.service.Advance(context.Background(), bad.algo); !errors.As(err, &codeErr) || codeErr.Kind != algoruntime.ErrorKindSyntax {
+		t.Errorf("bad code: error %v, want a syntax error", err)
+	}
+	if bad.account(t) != nil {
+		t.Errorf("bad code was given a paper account")
+	}
+}
+
+func TestConfigureRejectsInvalidSettings(t *testing.T) {
+	f := newFixture(t, failing, data.ExecutionModePaperTrading)
+	for _, settings := range []data.SimulationSettings{{Fill: "midpoint"}, {InitialCapital: -1}, {Charges: data.Charges{Model: "tiered"}}} {
+		if _, err := f.service.Configure(f.algo, settings); !errors.Is(err, ErrInvalidSettings) {
+			t.Errorf("Configure(%+v): error %v, want ErrInvalidSettings", settings, err)
+		}
+	}
+	if f.account(t) != nil {
+		t.Errorf("invalid settings created a paper account")
+	}
+}
+
+// swinging buys 10 shares on every fourth bar from the second and sells them two bars later
+const swinging = `def algorithm(data, context):
+    state = context['state']
+    state['bar'] = state.get('bar', 0) + 1
+    if state['bar'] % 4 == 2:
+        return {'signal': 'BUY', 'quantity': 10}
+    if state['bar'] % 4 == 0:
+        return {'signal': 'SELL', 'quantity': 10}
+    return {'signal': 'HOLD'}
+`
+
+// journaled counts the trades the algorithm's paper account journaled
+func (f *fixture) journaled(t *testing.T) int {
+	t.Helper()
+	count := 0
+	filter := repos.TradeFilter{AlgorithmID: &f.algo.ID}
+	err := repos.NewTradeRepository(f.db.GetConnection()).ForEachTrade(f.algo.UserID, filter, func(*data.Trade) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list trades: %v", err)
+	}
+	return count
+}
+
+func TestConcurrentAdvancesProcessEachBarOnce(t *testing.T) {
+	// One advance over the bars is the reference
+	want := newFixture(t, swinging, data.ExecutionModePaperTrading)
+	want.store(t, 0, 1)
+	if _, err := want.service.Advance(context.Background(), want.algo); err != nil {
+		t.Fatalf("first advance: %v", err)
+	}
+	want.store(t, 1, 41)
+	if _, err := want.service.Advance(context.Background(), want.algo); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	f := newFixture(t, swinging, data.ExecutionModePaperTrading)
+	f.store(t, 0, 1)
+	if _, err := f.service.Advance(context.Background(), f.algo); err != nil {
+		t.Fatalf("first advance: %v", err)
+	}
+	f.store(t, 1, 41)
+
+	// Like the API and the scheduler, each advance loads the algorithm itself
+	var wg sync.WaitGroup
+	results := make([]*Advance, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		algo, err := repos.NewAlgorithmRepository(f.db.GetConnection()).GetAlgorithmByID(f.algo.ID, f.algo.UserID)
+		if err != nil {
+			t.Fatalf("get algorithm: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = NewService(f.db.GetConnection()).Advance(context.Background(), algo)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("advance %d: %v", i, err)
+		}
+	}
+	if bars := results[0].Bars + results[1].Bars; bars != 40 {
+		t.Fatalf("advances processed %d and %d bars, want 40 between them", results[0].Bars, results[1].Bars)
+	}
+	got, reference := f.account(t), want.account(t)
+	if got.TotalTrades != reference.TotalTrades || f.journaled(t) != want.journaled(t) || !got.LastBarAt.Equal(*reference.LastBarAt) {
+		t.Fatalf("%d round trips and %d journal trades to %v, want %d and %d to %v",
+			got.TotalTrades, f.journaled(t), got.LastBarAt, reference.TotalTrades, want.journaled(t), reference.LastBarAt)
+	}
+	if algo, _ := repos.NewAlgorithmRepository(f.db.GetConnection()).GetAlgorithmByID(f.algo.ID, f.algo.UserID); algo.State["bar"] != float64(41) {
+		t.Fatalf("state %v, want 41 bars run", algo.State)
+	}
+}
@@ -0,0 +1,249 @@
+package syncjobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/brokersync"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+var (
+	// ErrRunNotFound is returned when a sync run does not exist or belongs to another user
+	ErrRunNotFound = errors.New("broker sync run not found")
+	// ErrScheduleNotFound is returned when the user has no schedule for the broker
+	ErrScheduleNotFound = errors.New("broker sync schedule not found")
+	// ErrInvalidSchedule is returned when a schedule's time of day or weekdays are invalid
+	ErrInvalidSchedule = errors.New("invalid broker sync schedule")
+)
+
+// pollInterval is how often the runner checks for due schedules and stray queued runs
+const pollInterval = time.Minute
+
+// Runner executes broker syncs in the background and queues them on each user's schedule
+// Runs are queued in the database and executed one at a time, oldest first, so a queue
+// survives a restart and long first syncs never hold a request open. SQLite allows a
+// single writer, so one worker is as fast as several.
+type Runner struct {
+	db      *sql.DB
+	keyring *secrets.Keyring
+	wake    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+// NewRunner creates a background sync runner; call Start to begin executing runs
+func NewRunner(db *sql.DB, keyring *secrets.Keyring) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		db:      db,
+		keyring: keyring,
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start fails runs interrupted by a previous shutdown and starts the worker
+func (r *Runner) Start() {
+	interrupted, err := repos.NewBrokerSyncRepository(r.db).FailInterruptedRuns("interrupted by a server restart", time.Now())
+	if err != nil {
+		utils.LogError(err, "Failed to fail interrupted broker sync runs")
+	} else if interrupted > 0 {
+		utils.LogInfo("Marked interrupted broker sync runs as failed", map[string]interface{}{
+			"count": interrupted,
+		})
+	}
+
+	r.done.Add(1)
+	go r.loop()
+	r.notify()
+}
+
+// Stop cancels the current run's broker calls and waits for the worker to stop
+// The interrupted run is recorded as failed; runs still queued are picked up on the next start.
+func (r *Runner) Stop() {
+	r.cancel()
+	r.done.Wait()
+}
+
+// notify wakes the worker without blocking
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop queues due scheduled runs and drains the queue until stopped
+func (r *Runner) loop() {
+	defer r.done.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.queueDueSchedules()
+		r.drain()
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain executes queued runs until none are left or the runner is stopped
+func (r *Runner) drain() {
+	repo := repos.NewBrokerSyncRepository(r.db)
+	for {
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		run, err := repo.ClaimNextRun(time.Now())
+		if err != nil {
+			utils.LogError(err, "Failed to claim broker sync run")
+			return
+		}
+		if run == nil {
+			return
+		}
+		r.execute(run)
+	}
+}
+
+// execute runs one claimed sync and records its outcome
+func (r *Runner) execute(run *data.BrokerSyncRun) {
+	repo := repos.NewBrokerSyncRepository(r.db)
+	utils.LogInfo("Starting background broker sync", map[string]interface{}{
+		"run_id":         run.ID,
+		"user_id":        run.UserID,
+		"trading_broker": run.TradingBroker,
+		"trigger":        run.Trigger,
+	})
+
+	result, err := brokersync.NewService(r.db, r.keyring).Sync(r.ctx, brokersync.SyncOptions{
+		UserID: run.UserID,
+		Broker: run.TradingBroker,
+		Method: matching.Method(run.Method),
+		Progress: func(stage brokersync.SyncStage) {
+			if err := repo.UpdateRunStage(run.ID, string(stage)); err != nil {
+				utils.LogError(err, "Failed to record broker sync progress", map[string]interface{}{
+					"run_id": run.ID,
+				})
+			}
+		},
+	})
+
+	finishedAt := time.Now()
+	duration := finishedAt.Sub(*run.StartedAt).Milliseconds()
+	run.FinishedAt = &finishedAt
+	run.DurationMs = &duration
+	run.Stage = nil
+	if err != nil {
+		message := err.Error()
+		if r.ctx.Err() != nil {
+			message = "interrupted by a server shutdown"
+		}
+		run.Status = data.BrokerSyncStatusFailed
+		run.Error = &message
+		utils.LogError(err, "Background broker sync failed", map[string]interface{}{
+			"run_id":         run.ID,
+			"user_id":        run.UserID,
+			"trading_broker": run.TradingBroker,
+		})
+	} else {
+		run.Status = data.BrokerSyncStatusSucceeded
+		run.Fetched = result.Fetched
+		run.Saved = result.Saved
+		run.Updated = result.Updated
+		run.Skipped = result.Skipped
+		run.Warnings = result.Warnings
+		utils.LogInfo("Background broker sync completed", map[string]interface{}{
+			"run_id":      run.ID,
+			"saved":       result.Saved,
+			"updated":     result.Updated,
+			"skipped":     result.Skipped,
+			"duration_ms": duration,
+		})
+	}
+
+	if err := repo.UpdateRun(run); err != nil {
+		utils.LogError(err, "Failed to record broker sync run outcome", map[string]interface{}{
+			"run_id": run.ID,
+		})
+	}
+}
+
+// Enqueue queues a background sync of a broker for a user
+// If a sync of that broker is already queued or running for the user, it is returned
+// instead with queued set to false.
+func (r *Runner) Enqueue(
+	userID int,
+	broker data.TradingBroker,
+	method matching.Method,
+	trigger data.BrokerSyncTrigger,
+) (run *data.BrokerSyncRun, queued bool, err error) {
+	if _, _, err := brokersync.NewService(r.db, r.keyring).LoadConfig(userID, broker); err != nil {
+		return nil, false, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	repo := repos.NewBrokerSyncRepository(r.db).WithTx(tx)
+	active, err := repo.GetActiveRun(userID, broker)
+	if err != nil {
+		return nil, false, err
+	}
+	if active != nil {
+		return active, false, nil
+	}
+
+	run = &data.BrokerSyncRun{
+		ID:            utils.GenerateID(),
+		UserID:        userID,
+		TradingBroker: broker,
+		Trigger:       trigger,
+		Method:        string(method),
+		Status:        data.BrokerSyncStatusQueued,
+		QueuedAt:      time.Now(),
+	}
+	if err := repo.CreateRun(run); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	r.notify()
+	return run, true, nil
+}
+
+// GetRun returns one of a user's sync runs with its current progress
+func (r *Runner) GetRun(userID int, runID string) (*data.BrokerSyncRun, error) {
+	run, err := repos.NewBrokerSyncRepository(r.db).GetRunByID(userID, runID)
+	if err != nil {
+		return nil, ErrRunNotFound
+	}
+	return run, nil
+}
+
+// ListRuns returns a user's sync history, newest first
+func (r *Runner) ListRuns(userID int, filter repos.BrokerSyncRunFilter) ([]*data.BrokerSyncRun, error) {
+	return repos.NewBrokerSyncRepository(r.db).GetRuns(userID, filter)
+}
@@ -0,0 +1,195 @@
+package syncjobs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/brokersync"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+// DefaultWeekdays are the NSE trading days, Monday to Friday
+var DefaultWeekdays = []int{1, 2, 3, 4, 5}
+
+// ScheduleOptions describes when a broker is synced in the background
+type ScheduleOptions struct {
+	RunAt    string // HH:MM in IST
+	Weekdays []int  // Sunday = 0; empty means DefaultWeekdays
+	Method   matching.Method
+	Enabled  bool
+}
+
+// SaveSchedule creates or replaces a user's schedule for a broker and computes its next run
+func (r *Runner) SaveSchedule(userID int, broker data.TradingBroker, opts ScheduleOptions) (*data.BrokerSyncSchedule, error) {
+	if _, err := time.Parse("15:04", opts.RunAt); err != nil {
+		return nil, fmt.Errorf("%w: run_at must be a time of day in HH:MM format (IST)", ErrInvalidSchedule)
+	}
+	weekdays, err := normalizeWeekdays(opts.Weekdays)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repos.NewUserRepository(r.db, r.keyring).GetUserByID(strconv.Itoa(userID)); err != nil {
+		return nil, brokersync.ErrUserNotFound
+	}
+
+	repo := repos.NewBrokerSyncRepository(r.db)
+	now := time.Now()
+	schedule, err := repo.GetSchedule(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		schedule = &data.BrokerSyncSchedule{
+			ID:            utils.GenerateID(),
+			UserID:        userID,
+			TradingBroker: broker,
+			CreatedAt:     now,
+		}
+	}
+	schedule.RunAt = opts.RunAt
+	schedule.Weekdays = weekdays
+	schedule.Method = string(opts.Method)
+	schedule.Enabled = opts.Enabled
+	schedule.UpdatedAt = now
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		next := nextRun(schedule, now)
+		schedule.NextRunAt = &next
+	}
+
+	if err := repo.SaveSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("Broker sync schedule saved", map[string]interface{}{
+		"user_id":        userID,
+		"trading_broker": broker,
+		"run_at":         schedule.RunAt,
+		"enabled":        schedule.Enabled,
+	})
+
+	return schedule, nil
+}
+
+// GetSchedule returns a user's schedule for a broker
+func (r *Runner) GetSchedule(userID int, broker data.TradingBroker) (*data.BrokerSyncSchedule, error) {
+	schedule, err := repos.NewBrokerSyncRepository(r.db).GetSchedule(userID, broker)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule stops background syncs of a broker for a user
+func (r *Runner) DeleteSchedule(userID int, broker data.TradingBroker) error {
+	if err := repos.NewBrokerSyncRepository(r.db).DeleteSchedule(userID, broker); err != nil {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// queueDueSchedules queues a run for every schedule that is due and moves it to its next slot
+// A schedule that cannot queue, for example because the access token expired, records a
+// failed run so the problem shows up in the user's sync history.
+func (r *Runner) queueDueSchedules() {
+	repo := repos.NewBrokerSyncRepository(r.db)
+	now := time.Now()
+	schedules, err := repo.GetDueSchedules(now)
+	if err != nil {
+		utils.LogError(err, "Failed to get due broker sync schedules")
+		return
+	}
+
+	for _, schedule := range schedules {
+		_, _, err := r.Enqueue(schedule.UserID, schedule.TradingBroker, matching.Method(schedule.Method), data.BrokerSyncTriggerScheduled)
+		if err != nil {
+			utils.LogError(err, "Failed to queue scheduled broker sync", map[string]interface{}{
+				"user_id":        schedule.UserID,
+				"trading_broker": schedule.TradingBroker,
+			})
+			r.recordFailedRun(schedule, err)
+		}
+
+		next := nextRun(schedule, now)
+		if err := repo.MarkScheduleRun(schedule.ID, now, &next); err != nil {
+			utils.LogError(err, "Failed to advance broker sync schedule", map[string]interface{}{
+				"schedule_id": schedule.ID,
+			})
+		}
+	}
+}
+
+// recordFailedRun records a scheduled run that failed before it could be queued
+func (r *Runner) recordFailedRun(schedule *data.BrokerSyncSchedule, cause error) {
+	now := time.Now()
+	message := cause.Error()
+	var duration int64
+	run := &data.BrokerSyncRun{
+		ID:            utils.GenerateID(),
+		UserID:        schedule.UserID,
+		TradingBroker: schedule.TradingBroker,
+		Trigger:       data.BrokerSyncTriggerScheduled,
+		Method:        schedule.Method,
+		Status:        data.BrokerSyncStatusFailed,
+		Error:         &message,
+		QueuedAt:      now,
+		StartedAt:     &now,
+		FinishedAt:    &now,
+		DurationMs:    &duration,
+	}
+	if err := repos.NewBrokerSyncRepository(r.db).CreateRun(run); err != nil {
+		utils.LogError(err, "Failed to record failed scheduled broker sync", map[string]interface{}{
+			"schedule_id": schedule.ID,
+		})
+	}
+}
+
+// nextRun returns the first scheduled slot in IST strictly after the given time
+func nextRun(schedule *data.BrokerSyncSchedule, after time.Time) time.Time {
+	clock, _ := time.Parse("15:04", schedule.RunAt)
+	days := make(map[time.Weekday]bool, len(schedule.Weekdays))
+	for _, day := range schedule.Weekdays {
+		days[time.Weekday(day)] = true
+	}
+
+	local := after.In(utils.IST)
+	for offset := 0; offset <= 7; offset++ {
+		day := local.AddDate(0, 0, offset)
+		slot := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, utils.IST)
+		if days[slot.Weekday()] && slot.After(after) {
+			return slot.UTC()
+		}
+	}
+
+	// Unreachable with at least one weekday; normalizeWeekdays guarantees one
+	return local.AddDate(0, 0, 7).UTC()
+}
+
+// normalizeWeekdays validates, de-duplicates and sorts weekdays, defaulting to Monday to Friday
+func normalizeWeekdays(weekdays []int) ([]int, error) {
+	if len(weekdays) == 0 {
+		return append([]int(nil), DefaultWeekdays...), nil
+	}
+
+	seen := make(map[int]bool, len(weekdays))
+	var normalized []int
+	for _, day := range weekdays {
+		if day < 0 || day > 6 {
+			return nil, fmt.Errorf("%w: weekdays must be between 0 (Sunday) and 6 (Saturday), got %d", ErrInvalidSchedule, day)
+		}
+		if !seen[day] {
+			seen[day] = true
+			normalized = append(normalized, day)
+		}
+	}
+	sort.Ints(normalized)
+	return normalized, nil
+}
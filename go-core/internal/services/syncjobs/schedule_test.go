@@ -0,0 +1,80 @@
+package syncjobs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+func TestNextRun(t *testing.T) {
+	// 4 March 2024 is a Monday
+	ist := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, utils.IST)
+	}
+
+	tests := []struct {
+		name     string
+		runAt    string
+		weekdays []int
+		after    time.Time
+		want     time.Time
+	}{
+		{name: "later the same day", runAt: "16:00", weekdays: DefaultWeekdays, after: ist(4, 10, 0), want: ist(4, 16, 0)},
+		{name: "a slot equal to now moves to the next day", runAt: "16:00", weekdays: DefaultWeekdays, after: ist(4, 16, 0), want: ist(5, 16, 0)},
+		{name: "friday evening skips the weekend", runAt: "16:00", weekdays: DefaultWeekdays, after: ist(8, 17, 0), want: ist(11, 16, 0)},
+		{
+			name: "the day is taken in IST, not UTC", runAt: "16:00", weekdays: DefaultWeekdays,
+			after: time.Date(2024, time.March, 4, 20, 0, 0, 0, time.UTC), want: ist(5, 16, 0),
+		},
+		{name: "just after midnight IST", runAt: "00:05", weekdays: DefaultWeekdays, after: ist(4, 23, 0), want: ist(5, 0, 5)},
+		{name: "a single weekday waits a full week", runAt: "09:00", weekdays: []int{0}, after: ist(10, 18, 0), want: ist(17, 9, 0)},
+		{name: "weekend only", runAt: "09:00", weekdays: []int{0, 6}, after: ist(6, 12, 0), want: ist(9, 9, 0)},
+	}
+	for _, tt := range tests {
+		schedule := &data.BrokerSyncSchedule{RunAt: tt.runAt, Weekdays: tt.weekdays}
+		got := nextRun(schedule, tt.after)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: nextRun = %s, want %s", tt.name, got.In(utils.IST), tt.want)
+		}
+		if got.Location() != time.UTC {
+			t.Errorf("%s: nextRun returned %s, want UTC", tt.name, got.Location())
+		}
+	}
+}
+
+func TestNormalizeWeekdays(t *testing.T) {
+	tests := []struct {
+		weekdays []int
+		want     []int
+		wantErr  bool
+	}{
+		{weekdays: nil, want: DefaultWeekdays},
+		{weekdays: []int{5, 1, 3, 1}, want: []int{1, 3, 5}},
+		{weekdays: []int{0, 6}, want: []int{0, 6}},
+		{weekdays: []int{7}, wantErr: true},
+		{weekdays: []int{1, -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeWeekdays(tt.weekdays)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSchedule) {
+				t.Errorf("normalizeWeekdays(%v) error %v, want ErrInvalidSchedule", tt.weekdays, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeWeekdays(%v) = %v, %v; want %v", tt.weekdays, got, err, tt.want)
+		}
+	}
+
+	// The default must be a copy so a caller cannot change it
+	got, _ := normalizeWeekdays(nil)
+	got[0] = 0
+	if DefaultWeekdays[0] != 1 {
+		t.Fatalf("normalizeWeekdays returned DefaultWeekdays itself")
+	}
+}
@@ -0,0 +1,71 @@
+package tax
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+)
+
+// Head is the income head a trade is reported under
+type Head string
+
+const (
+	// HeadCapitalGains covers delivery equity, split into short and long term
+	HeadCapitalGains Head = "capital_gains"
+	// HeadSpeculative covers intraday equity (section 43(5))
+	HeadSpeculative Head = "speculative"
+	// HeadBusiness covers futures, options and commodity derivatives (non-speculative business income)
+	HeadBusiness Head = "business"
+)
+
+// derivativeSymbol matches broker trading symbols for futures and options,
+// e.g. NIFTY24APRFUT, BANKNIFTY24APR48000CE, "NIFTY 25 APR 22000 CALL"
+var derivativeSymbol = regexp.MustCompile(`(?i)(FUT|\d(CE|PE)|\bCALL|\bPUT)$`)
+
+// classify decides the income head for a trade; ok is false for trades outside Indian tax scope
+func classify(t *data.Trade) (head Head, reason string, ok bool) {
+	switch t.MarketType {
+	case data.MarketTypeIndian:
+	case data.MarketTypeCommodities:
+		return HeadBusiness, "", true
+	default:
+		return "", "market type " + string(t.MarketType) + " is not covered by this report", false
+	}
+
+	if isDerivative(t) {
+		return HeadBusiness, "", true
+	}
+
+	if t.ProductType != nil {
+		switch *t.ProductType {
+		case data.ProductTypeMIS, data.ProductTypeIntraday:
+			return HeadSpeculative, "", true
+		case data.ProductTypeCNC:
+			return HeadCapitalGains, "", true
+		}
+	}
+
+	// Manual trades carry no product type: a round trip within one trading day is intraday
+	if t.ExitDate != nil && sameDay(t.EntryDate, *t.ExitDate) {
+		return HeadSpeculative, "", true
+	}
+	return HeadCapitalGains, "", true
+}
+
+// isDerivative reports whether a trade is in futures or options
+func isDerivative(t *data.Trade) bool {
+	if t.ProductType != nil && *t.ProductType == data.ProductTypeNRML {
+		return true
+	}
+	return derivativeSymbol.MatchString(strings.TrimSpace(t.Symbol))
+}
+
+// sameDay compares calendar days in IST
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.In(utils.IST).Date()
+	by, bm, bd := b.In(utils.IST).Date()
+	return ay == by && am == bm && ad == bd
+}
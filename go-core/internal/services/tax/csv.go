@@ -0,0 +1,96 @@
+package tax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go-core/internal/utils"
+)
+
+// ParseSchedule validates a CSV schedule name
+func ParseSchedule(value string) (Head, error) {
+	switch head := Head(strings.ToLower(strings.TrimSpace(value))); head {
+	case HeadCapitalGains, HeadSpeculative, HeadBusiness:
+		return head, nil
+	default:
+		return "", fmt.Errorf("unsupported schedule %q (use capital_gains, speculative or business)", value)
+	}
+}
+
+var scheduleColumns = []string{
+	"symbol", "term", "direction", "quantity", "open_date", "close_date", "holding_days",
+	"buy_price", "sell_price", "fmv_31_jan_2018", "sale_value", "cost_of_acquisition", "gain",
+}
+
+// WriteCSV writes one schedule of the report as CSV, ending with a total row
+func WriteCSV(w io.Writer, report *Report, schedule Head) error {
+	var entries []Entry
+	var totals Totals
+	switch schedule {
+	case HeadCapitalGains:
+		entries = report.CapitalGains.Entries
+		totals = combine(report.CapitalGains.ShortTerm, report.CapitalGains.LongTerm)
+	case HeadSpeculative:
+		entries, totals = report.Speculative.Entries, report.Speculative.Totals
+	case HeadBusiness:
+		entries, totals = report.Business.Entries, report.Business.Totals
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(scheduleColumns); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmv := ""
+		if e.FMV31Jan2018 != nil {
+			fmv = money(*e.FMV31Jan2018)
+		}
+		record := []string{
+			e.Symbol, string(e.Term), e.Direction, strconv.Itoa(e.Quantity),
+			e.OpenDate.In(utils.IST).Format("2006-01-02"), e.CloseDate.In(utils.IST).Format("2006-01-02"), strconv.Itoa(e.HoldingDays),
+			money(e.BuyPrice), money(e.SellPrice), fmv,
+			money(e.SaleValue), money(e.CostOfAcquisition), money(e.Gain),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	total := make([]string, len(scheduleColumns))
+	total[0] = "TOTAL"
+	total[len(total)-3] = money(totals.SaleValue)
+	total[len(total)-2] = money(totals.CostOfAcquisition)
+	total[len(total)-1] = money(totals.Gain)
+	if err := writer.Write(total); err != nil {
+		return err
+	}
+	if schedule != HeadCapitalGains {
+		turnover := make([]string, len(scheduleColumns))
+		turnover[0] = "TURNOVER"
+		turnover[len(turnover)-1] = money(totals.Turnover)
+		if err := writer.Write(turnover); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// combine adds short and long term totals for the capital gains total row
+func combine(a, b Totals) Totals {
+	return Totals{
+		Count:             a.Count + b.Count,
+		SaleValue:         roundPaise(a.SaleValue + b.SaleValue),
+		CostOfAcquisition: roundPaise(a.CostOfAcquisition + b.CostOfAcquisition),
+		Gain:              roundPaise(a.Gain + b.Gain),
+		Turnover:          roundPaise(a.Turnover + b.Turnover),
+	}
+}
+
+func money(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
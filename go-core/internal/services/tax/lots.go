@@ -0,0 +1,60 @@
+package tax
+
+import (
+	"sort"
+
+	"go-core/internal/data"
+	"go-core/internal/services/matching"
+)
+
+// tradeFills splits a journal trade into its opening and (if closed) closing fills
+// The income head is used as the product so each head is matched as its own position.
+// missingExitDate is true when the trade is closed but has no exit date, in which case the entry date is used
+func tradeFills(t *data.Trade, head Head) (fills []matching.Fill, missingExitDate bool) {
+	openSide, closeSide := matching.SideBuy, matching.SideSell
+	if t.Direction == data.TradeDirectionShort {
+		openSide, closeSide = closeSide, openSide
+	}
+	fills = append(fills, matching.Fill{
+		Symbol: t.Symbol, Product: string(head), Side: openSide,
+		Quantity: t.Quantity, Price: t.EntryPrice, Time: t.EntryDate,
+	})
+
+	if t.ExitPrice == nil {
+		return fills, false
+	}
+	closeDate := t.EntryDate
+	if t.ExitDate != nil {
+		closeDate = *t.ExitDate
+	} else {
+		missingExitDate = true
+	}
+	fills = append(fills, matching.Fill{
+		Symbol: t.Symbol, Product: string(head), Side: closeSide,
+		Quantity: t.Quantity, Price: *t.ExitPrice, Time: closeDate,
+	})
+	return fills, missingExitDate
+}
+
+// matchFIFO pairs fills of one instrument first-in-first-out, as required for
+// demat holdings, regardless of how the journal grouped them into trades
+// opening reports whether each fill opened its journal trade, so same-instant round trips can match.
+func matchFIFO(fills []matching.Fill, opening []bool) []matching.Match {
+	index := make([]int, len(fills))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		a, b := index[i], index[j]
+		if !fills[a].Time.Equal(fills[b].Time) {
+			return fills[a].Time.Before(fills[b].Time)
+		}
+		return opening[a] && !opening[b]
+	})
+
+	ordered := make([]matching.Fill, len(fills))
+	for i, at := range index {
+		ordered[i] = fills[at]
+	}
+	return matching.Run(ordered, matching.MethodFIFO).Matches
+}
@@ -0,0 +1,287 @@
+package tax
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/matching"
+	"go-core/internal/utils"
+)
+
+// grandfatheringCutoff is 1 Feb 2018; equity acquired before it is grandfathered under section 112A
+var grandfatheringCutoff = time.Date(2018, time.February, 1, 0, 0, 0, 0, utils.IST)
+
+// Term is the capital gains holding period class
+type Term string
+
+const (
+	TermShort Term = "short_term"
+	TermLong  Term = "long_term"
+)
+
+// Entry is one matched lot in a schedule
+type Entry struct {
+	Symbol            string    `json:"symbol"`
+	Head              Head      `json:"head"`
+	Term              Term      `json:"term,omitempty"`
+	Direction         string    `json:"direction"`
+	Quantity          int       `json:"quantity"`
+	OpenDate          time.Time `json:"open_date"`
+	CloseDate         time.Time `json:"close_date"`
+	HoldingDays       int       `json:"holding_days"`
+	BuyPrice          float64   `json:"buy_price"`
+	SellPrice         float64   `json:"sell_price"`
+	SaleValue         float64   `json:"sale_value"`
+	CostOfAcquisition float64   `json:"cost_of_acquisition"`
+	FMV31Jan2018      *float64  `json:"fmv_31_jan_2018,omitempty"`
+	Gain              float64   `json:"gain"`
+}
+
+// Totals aggregates a group of entries
+type Totals struct {
+	Count             int     `json:"count"`
+	SaleValue         float64 `json:"sale_value"`
+	CostOfAcquisition float64 `json:"cost_of_acquisition"`
+	Gain              float64 `json:"gain"`
+	Turnover          float64 `json:"turnover"`
+}
+
+// CapitalGains is the delivery equity schedule
+type CapitalGains struct {
+	ShortTerm Totals  `json:"short_term"`
+	LongTerm  Totals  `json:"long_term"`
+	Entries   []Entry `json:"entries"`
+}
+
+// Schedule is the speculative or business income schedule
+type Schedule struct {
+	Totals
+	Entries []Entry `json:"entries"`
+}
+
+// Report is the tax report for one user and financial year
+// Figures are gross of brokerage and statutory charges, which the journal does not record
+type Report struct {
+	UserID        int          `json:"user_id"`
+	FinancialYear string       `json:"financial_year"`
+	PeriodStart   time.Time    `json:"period_start"`
+	PeriodEnd     time.Time    `json:"period_end"`
+	CapitalGains  CapitalGains `json:"capital_gains"`
+	Speculative   Schedule     `json:"speculative"`
+	Business      Schedule     `json:"business"`
+	Excluded      int          `json:"excluded_trades"`
+	Warnings      []string     `json:"warnings"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+}
+
+// Options configures report generation
+type Options struct {
+	UserID int
+	Year   FinancialYear
+	// FMV holds the 31 January 2018 fair market value per symbol for grandfathered long-term lots
+	FMV map[string]float64
+}
+
+// Generator builds tax reports from the journal
+type Generator struct {
+	db *sql.DB
+}
+
+// NewGenerator creates a new tax report generator
+func NewGenerator(db *sql.DB) *Generator {
+	return &Generator{db: db}
+}
+
+// Generate builds the report for a financial year
+// The user's whole history is replayed so FIFO lots opened in earlier years are matched correctly;
+// only lots closed inside the year are reported.
+func (g *Generator) Generate(opts Options) (*Report, error) {
+	type bucket struct {
+		head   Head
+		symbol string
+	}
+	type bucketFills struct {
+		fills   []matching.Fill
+		opening []bool
+	}
+	buckets := make(map[bucket]*bucketFills)
+	excluded := make(map[string]int)
+	missingExitDates := 0
+
+	err := repos.NewTradeRepository(g.db).ForEachTrade(opts.UserID, repos.TradeFilter{}, func(t *data.Trade) error {
+		head, reason, ok := classify(t)
+		if !ok {
+			excluded[reason]++
+			return nil
+		}
+		fills, missing := tradeFills(t, head)
+		if missing {
+			missingExitDates++
+		}
+		key := bucket{head: head, symbol: strings.ToUpper(strings.TrimSpace(t.Symbol))}
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucketFills{}
+			buckets[key] = b
+		}
+		for i, f := range fills {
+			b.fills = append(b.fills, f)
+			b.opening = append(b.opening, i == 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trades: %w", err)
+	}
+
+	report := &Report{
+		UserID:        opts.UserID,
+		FinancialYear: opts.Year.String(),
+		PeriodStart:   opts.Year.Start(),
+		PeriodEnd:     opts.Year.LastDay(),
+		CapitalGains:  CapitalGains{Entries: []Entry{}},
+		Speculative:   Schedule{Entries: []Entry{}},
+		Business:      Schedule{Entries: []Entry{}},
+		Warnings:      []string{},
+		GeneratedAt:   time.Now(),
+	}
+
+	missingFMV := make(map[string]bool)
+	for key, b := range buckets {
+		for _, closed := range matchFIFO(b.fills, b.opening) {
+			if !opts.Year.Contains(closed.Close.Time) {
+				continue
+			}
+			entry := newEntry(key.symbol, key.head, closed)
+			if key.head == HeadCapitalGains {
+				if entry.Term == TermLong && closed.Open.Fill.Time.Before(grandfatheringCutoff) {
+					if fmv, ok := opts.FMV[key.symbol]; ok {
+						entry.applyGrandfathering(fmv)
+					} else {
+						missingFMV[key.symbol] = true
+					}
+				}
+			}
+			report.add(entry)
+		}
+	}
+
+	report.sortEntries()
+	report.round()
+
+	if missingExitDates > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d closed trade(s) have no exit date; the entry date was used, so holding periods may be understated", missingExitDates))
+	}
+	for symbol := range missingFMV {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s was acquired on or before 31 Jan 2018 but no fair market value was supplied; actual cost was used", symbol))
+	}
+	for reason, count := range excluded {
+		report.Excluded += count
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d trade(s) excluded: %s", count, reason))
+	}
+	sort.Strings(report.Warnings)
+
+	return report, nil
+}
+
+// newEntry converts a matched lot into a schedule entry
+func newEntry(symbol string, head Head, closed matching.Match) Entry {
+	openDate, closeDate := closed.Open.Fill.Time, closed.Close.Time
+	entry := Entry{
+		Symbol:      symbol,
+		Head:        head,
+		Direction:   string(data.TradeDirectionLong),
+		Quantity:    closed.Quantity,
+		OpenDate:    openDate,
+		CloseDate:   closeDate,
+		HoldingDays: int(closeDate.In(utils.IST).Sub(openDate.In(utils.IST)).Hours() / 24),
+		BuyPrice:    closed.Open.Cost,
+		SellPrice:   closed.Close.Price,
+	}
+	if !closed.Open.Long {
+		entry.Direction = string(data.TradeDirectionShort)
+		entry.BuyPrice, entry.SellPrice = closed.Close.Price, closed.Open.Cost
+	}
+
+	quantity := float64(closed.Quantity)
+	entry.SaleValue = entry.SellPrice * quantity
+	entry.CostOfAcquisition = entry.BuyPrice * quantity
+	entry.Gain = entry.SaleValue - entry.CostOfAcquisition
+
+	if head == HeadCapitalGains {
+		entry.Term = TermShort
+		// Listed equity is long term when held for more than 12 months
+		if closed.Open.Long && closeDate.After(openDate.AddDate(1, 0, 0)) {
+			entry.Term = TermLong
+		}
+	}
+	return entry
+}
+
+// applyGrandfathering raises the cost to the 31 Jan 2018 FMV, capped at the sale price (section 112A)
+func (e *Entry) applyGrandfathering(fmv float64) {
+	e.FMV31Jan2018 = &fmv
+	perUnit := math.Max(e.BuyPrice, math.Min(fmv, e.SellPrice))
+	e.CostOfAcquisition = perUnit * float64(e.Quantity)
+	e.Gain = e.SaleValue - e.CostOfAcquisition
+}
+
+// add files an entry under its schedule and updates the totals
+func (r *Report) add(e Entry) {
+	switch e.Head {
+	case HeadCapitalGains:
+		r.CapitalGains.Entries = append(r.CapitalGains.Entries, e)
+		if e.Term == TermLong {
+			r.CapitalGains.LongTerm.add(e)
+		} else {
+			r.CapitalGains.ShortTerm.add(e)
+		}
+	case HeadSpeculative:
+		r.Speculative.Entries = append(r.Speculative.Entries, e)
+		r.Speculative.add(e)
+	case HeadBusiness:
+		r.Business.Entries = append(r.Business.Entries, e)
+		r.Business.add(e)
+	}
+}
+
+// add accumulates an entry; turnover is the sum of absolute profits and losses (ICAI guidance note)
+func (t *Totals) add(e Entry) {
+	t.Count++
+	t.SaleValue += e.SaleValue
+	t.CostOfAcquisition += e.CostOfAcquisition
+	t.Gain += e.Gain
+	t.Turnover += math.Abs(e.Gain)
+}
+
+// sortEntries orders each schedule by close date, then symbol
+func (r *Report) sortEntries() {
+	for _, entries := range [][]Entry{r.CapitalGains.Entries, r.Speculative.Entries, r.Business.Entries} {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if !entries[i].CloseDate.Equal(entries[j].CloseDate) {
+				return entries[i].CloseDate.Before(entries[j].CloseDate)
+			}
+			return entries[i].Symbol < entries[j].Symbol
+		})
+	}
+}
+
+// round trims floating point noise from the totals to paise
+func (r *Report) round() {
+	for _, t := range []*Totals{&r.CapitalGains.ShortTerm, &r.CapitalGains.LongTerm, &r.Speculative.Totals, &r.Business.Totals} {
+		t.SaleValue = roundPaise(t.SaleValue)
+		t.CostOfAcquisition = roundPaise(t.CostOfAcquisition)
+		t.Gain = roundPaise(t.Gain)
+		t.Turnover = roundPaise(t.Turnover)
+	}
+}
+
+func roundPaise(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,239 @@
+package tax
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/services/matching"
+	"go-core/internal/testutil"
+	"go-core/internal/utils"
+)
+
+func ist(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, utils.IST)
+}
+
+func product(p data.ProductType) *data.ProductType {
+	return &p
+}
+
+func TestClassify(t *testing.T) {
+	entry := ist(2024, time.May, 6, 9, 30)
+	sameDayExit := ist(2024, time.May, 6, 15, 0)
+	nextDayExit := ist(2024, time.May, 7, 10, 0)
+
+	tests := []struct {
+		name   string
+		trade  data.Trade
+		want   Head
+		wantOK bool
+	}{
+		{"index future by symbol", data.Trade{Symbol: "NIFTY24MAYFUT", MarketType: data.MarketTypeIndian}, HeadBusiness, true},
+		{"stock option by symbol", data.Trade{Symbol: "BANKNIFTY24MAY48000CE", MarketType: data.MarketTypeIndian}, HeadBusiness, true},
+		{"put by symbol", data.Trade{Symbol: "RELIANCE24MAY2900PE", MarketType: data.MarketTypeIndian}, HeadBusiness, true},
+		{"option by display name", data.Trade{Symbol: "NIFTY 30 MAY 22000 CALL", MarketType: data.MarketTypeIndian}, HeadBusiness, true},
+		{"NRML product", data.Trade{Symbol: "SBIN", MarketType: data.MarketTypeIndian, ProductType: product(data.ProductTypeNRML)}, HeadBusiness, true},
+		{"commodity", data.Trade{Symbol: "GOLDM", MarketType: data.MarketTypeCommodities}, HeadBusiness, true},
+		{"MIS equity", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, ProductType: product(data.ProductTypeMIS)}, HeadSpeculative, true},
+		{"intraday equity", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, ProductType: product(data.ProductTypeIntraday)}, HeadSpeculative, true},
+		{"CNC closed the same day", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, ProductType: product(data.ProductTypeCNC), EntryDate: entry, ExitDate: &sameDayExit}, HeadCapitalGains, true},
+		{"manual round trip in a day", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, EntryDate: entry, ExitDate: &sameDayExit}, HeadSpeculative, true},
+		{"manual trade held overnight", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, EntryDate: entry, ExitDate: &nextDayExit}, HeadCapitalGains, true},
+		{"open manual trade", data.Trade{Symbol: "INFY", MarketType: data.MarketTypeIndian, EntryDate: entry}, HeadCapitalGains, true},
+		{"symbol ending in PE without a strike", data.Trade{Symbol: "TYPE", MarketType: data.MarketTypeIndian}, HeadCapitalGains, true},
+		{"US equity", data.Trade{Symbol: "AAPL", MarketType: data.MarketTypeUS}, "", false},
+		{"crypto", data.Trade{Symbol: "BTCUSDT", MarketType: data.MarketTypeCrypto}, "", false},
+	}
+	for _, tt := range tests {
+		head, _, ok := classify(&tt.trade)
+		if head != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: classify = %q, %v; want %q, %v", tt.name, head, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSameDayUsesIST(t *testing.T) {
+	// 18:00 and 19:00 UTC on 5 May fall either side of midnight IST
+	a := time.Date(2024, time.May, 5, 18, 0, 0, 0, time.UTC)
+	b := time.Date(2024, time.May, 5, 19, 0, 0, 0, time.UTC)
+	if sameDay(a, b) {
+		t.Errorf("%s and %s are on different IST days", a, b)
+	}
+	if !sameDay(b, b.Add(5*time.Hour)) {
+		t.Errorf("%s and %s are on the same IST day", b, b.Add(5*time.Hour))
+	}
+}
+
+func TestParseFinancialYear(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "2024-25", want: 2024},
+		{value: "2024-2025", want: 2024},
+		{value: "fy2024-25", want: 2024},
+		{value: " 2023 ", want: 2023},
+		{value: "2099-00", want: 2099},
+		{value: "2024-26", wantErr: true},
+		{value: "2024-23", wantErr: true},
+		{value: "1999-00", wantErr: true},
+		{value: "last year", wantErr: true},
+	}
+	for _, tt := range tests {
+		fy, err := ParseFinancialYear(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFinancialYear(%q) error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fy.StartYear != tt.want {
+			t.Errorf("ParseFinancialYear(%q) = %d, want %d", tt.value, fy.StartYear, tt.want)
+		}
+	}
+	if got := (FinancialYear{StartYear: 2099}).String(); got != "2099-00" {
+		t.Errorf("String() = %q, want 2099-00", got)
+	}
+}
+
+func TestFinancialYearContains(t *testing.T) {
+	fy := FinancialYear{StartYear: 2024}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{ist(2024, time.April, 1, 0, 0), true},
+		{ist(2024, time.March, 31, 23, 59), false},
+		{ist(2025, time.March, 31, 23, 59), true},
+		{ist(2025, time.April, 1, 0, 0), false},
+		// 31 March 19:00 UTC is already 1 April in India
+		{time.Date(2025, time.March, 31, 19, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, time.March, 31, 19, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		if got := fy.Contains(tt.at); got != tt.want {
+			t.Errorf("FY %s contains %s = %v, want %v", fy, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestApplyGrandfathering(t *testing.T) {
+	tests := []struct {
+		name          string
+		buy, sell     float64
+		fmv           float64
+		wantCostPrice float64
+	}{
+		{"FMV between cost and sale raises the cost to FMV", 100, 300, 250, 250},
+		{"FMV above the sale price is capped at the sale price", 100, 200, 250, 200},
+		{"FMV below cost keeps the actual cost", 150, 300, 120, 150},
+		{"a loss keeps the actual cost", 200, 150, 180, 200},
+	}
+	for _, tt := range tests {
+		entry := Entry{Quantity: 10, BuyPrice: tt.buy, SellPrice: tt.sell, SaleValue: tt.sell * 10, CostOfAcquisition: tt.buy * 10}
+		entry.applyGrandfathering(tt.fmv)
+		if entry.CostOfAcquisition != tt.wantCostPrice*10 || entry.Gain != (tt.sell-tt.wantCostPrice)*10 {
+			t.Errorf("%s: cost %v, gain %v; want cost %v", tt.name, entry.CostOfAcquisition, entry.Gain, tt.wantCostPrice*10)
+		}
+		if entry.FMV31Jan2018 == nil || *entry.FMV31Jan2018 != tt.fmv {
+			t.Errorf("%s: FMV not recorded", tt.name)
+		}
+	}
+}
+
+func TestNewEntryTerm(t *testing.T) {
+	bought := ist(2023, time.June, 15, 10, 0)
+	tests := []struct {
+		name     string
+		closedAt time.Time
+		want     Term
+	}{
+		{"held exactly twelve months", ist(2024, time.June, 15, 10, 0), TermShort},
+		{"held more than twelve months", ist(2024, time.June, 16, 10, 0), TermLong},
+		{"held a week", ist(2023, time.June, 22, 10, 0), TermShort},
+	}
+	for _, tt := range tests {
+		fills := []matching.Fill{
+			{Symbol: "INFY", Side: matching.SideBuy, Quantity: 5, Price: 1400, Time: bought},
+			{Symbol: "INFY", Side: matching.SideSell, Quantity: 5, Price: 1600, Time: tt.closedAt},
+		}
+		matches := matchFIFO(fills, []bool{true, false})
+		if len(matches) != 1 {
+			t.Fatalf("%s: %d matches, want 1", tt.name, len(matches))
+		}
+		entry := newEntry("INFY", HeadCapitalGains, matches[0])
+		if entry.Term != tt.want || entry.Gain != 1000 {
+			t.Errorf("%s: term %q, gain %v; want %q and 1000", tt.name, entry.Term, entry.Gain, tt.want)
+		}
+	}
+}
+
+func TestGenerateBucketsByFinancialYear(t *testing.T) {
+	db := testutil.NewDB(t)
+	conn := db.GetConnection()
+	user := &data.User{Name: "tax", Email: "tax@example.com", CreatedAt: time.Now().UTC()}
+	if err := repos.NewUserRepository(conn, nil).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	closed := func(symbol string, p data.ProductType, quantity int, entryPrice, exitPrice float64, entry, exit time.Time) *data.Trade {
+		return &data.Trade{
+			Symbol: symbol, MarketType: data.MarketTypeIndian, ProductType: &p, Direction: data.TradeDirectionLong, OutcomeSummary: data.OutcomeSummaryBreakeven,
+			Quantity: quantity, EntryPrice: entryPrice, ExitPrice: &exitPrice, EntryDate: entry, ExitDate: &exit,
+		}
+	}
+	trades := []*data.Trade{
+		// Grandfathered: bought before 1 Feb 2018, sold in FY 2024-25
+		closed("HDFCBANK", data.ProductTypeCNC, 10, 900, 1600, ist(2017, time.March, 1, 10, 0), ist(2024, time.July, 1, 10, 0)),
+		// Short term delivery sold on the last day of FY 2024-25
+		closed("INFY", data.ProductTypeCNC, 4, 1500, 1450, ist(2024, time.December, 2, 10, 0), ist(2025, time.March, 31, 15, 0)),
+		// Sold on the first day of FY 2025-26: not in the report
+		closed("TCS", data.ProductTypeCNC, 2, 3500, 4000, ist(2024, time.May, 2, 10, 0), ist(2025, time.April, 1, 10, 0)),
+		// Intraday
+		closed("SBIN", data.ProductTypeMIS, 100, 800, 805, ist(2024, time.August, 5, 9, 20), ist(2024, time.August, 5, 15, 10)),
+		// F&O losses and profits both count towards turnover
+		closed("NIFTY24AUGFUT", data.ProductTypeNRML, 50, 24000, 23900, ist(2024, time.August, 6, 9, 20), ist(2024, time.August, 6, 14, 0)),
+		closed("NIFTY24AUG24000CE", data.ProductTypeNRML, 50, 100, 130, ist(2024, time.August, 7, 9, 20), ist(2024, time.August, 8, 14, 0)),
+	}
+	now := time.Now().UTC()
+	for _, trade := range trades {
+		trade.ID, trade.UserID, trade.CreatedAt, trade.UpdatedAt = utils.GenerateID(), user.ID, now, now
+		trade.TotalAmount = trade.EntryPrice * float64(trade.Quantity)
+		if err := repos.NewTradeRepository(conn).CreateTrade(trade); err != nil {
+			t.Fatalf("create trade: %v", err)
+		}
+	}
+
+	report, err := NewGenerator(conn).Generate(Options{
+		UserID: user.ID,
+		Year:   FinancialYear{StartYear: 2024},
+		FMV:    map[string]float64{"HDFCBANK": 950},
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		totals Totals
+		want   Totals
+	}{
+		{"long term capital gains", report.CapitalGains.LongTerm, Totals{Count: 1, SaleValue: 16000, CostOfAcquisition: 9500, Gain: 6500, Turnover: 6500}},
+		{"short term capital gains", report.CapitalGains.ShortTerm, Totals{Count: 1, SaleValue: 5800, CostOfAcquisition: 6000, Gain: -200, Turnover: 200}},
+		{"speculative", report.Speculative.Totals, Totals{Count: 1, SaleValue: 80500, CostOfAcquisition: 80000, Gain: 500, Turnover: 500}},
+		{"business", report.Business.Totals, Totals{Count: 2, SaleValue: 1201500, CostOfAcquisition: 1205000, Gain: -3500, Turnover: 6500}},
+	}
+	for _, tt := range tests {
+		if tt.totals != tt.want {
+			t.Errorf("%s totals %+v, want %+v", tt.name, tt.totals, tt.want)
+		}
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+	if math.Abs(report.CapitalGains.Entries[0].CostOfAcquisition-9500) > 1e-9 || report.CapitalGains.Entries[0].FMV31Jan2018 == nil {
+		t.Errorf("grandfathered entry %+v", report.CapitalGains.Entries[0])
+	}
+}
@@ -0,0 +1,66 @@
+package tax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-core/internal/utils"
+)
+
+// FinancialYear is an Indian financial year running 1 April to 31 March
+type FinancialYear struct {
+	StartYear int
+}
+
+// ParseFinancialYear accepts "2024-25", "2024-2025", "FY2024-25" or just the starting year "2024"
+func ParseFinancialYear(value string) (FinancialYear, error) {
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "FY")
+	start, end, hasEnd := strings.Cut(value, "-")
+
+	startYear, err := strconv.Atoi(start)
+	if err != nil || startYear < 2000 || startYear > 2100 {
+		return FinancialYear{}, fmt.Errorf("invalid financial year %q (expected e.g. 2024-25)", value)
+	}
+
+	if hasEnd {
+		endYear, err := strconv.Atoi(end)
+		if err != nil {
+			return FinancialYear{}, fmt.Errorf("invalid financial year %q (expected e.g. 2024-25)", value)
+		}
+		if len(end) == 2 {
+			endYear += (startYear + 1) / 100 * 100
+		}
+		if endYear != startYear+1 {
+			return FinancialYear{}, fmt.Errorf("financial year %q must span consecutive years", value)
+		}
+	}
+
+	return FinancialYear{StartYear: startYear}, nil
+}
+
+// String formats the year the way ITR forms do, e.g. 2024-25
+func (fy FinancialYear) String() string {
+	return fmt.Sprintf("%d-%02d", fy.StartYear, (fy.StartYear+1)%100)
+}
+
+// Start is 1 April 00:00 IST
+func (fy FinancialYear) Start() time.Time {
+	return time.Date(fy.StartYear, time.April, 1, 0, 0, 0, 0, utils.IST)
+}
+
+// End is the first instant after 31 March, i.e. the exclusive upper bound
+func (fy FinancialYear) End() time.Time {
+	return time.Date(fy.StartYear+1, time.April, 1, 0, 0, 0, 0, utils.IST)
+}
+
+// LastDay is 31 March of the closing year
+func (fy FinancialYear) LastDay() time.Time {
+	return time.Date(fy.StartYear+1, time.March, 31, 0, 0, 0, 0, utils.IST)
+}
+
+// Contains reports whether t falls inside the financial year
+func (fy FinancialYear) Contains(t time.Time) bool {
+	return !t.Before(fy.Start()) && t.Before(fy.End())
+}
@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/brokers"
+)
+
+// ExpiringWithin is how close to expiry a token is reported as expiring and renewed in the background
+const ExpiringWithin = 2 * time.Hour
+
+// State is the health of a user's broker credentials
+type State string
+
+const (
+	StateNotConfigured State = "not_configured"
+	StateValid         State = "valid"
+	StateExpiring      State = "expiring"
+	StateExpired       State = "expired"
+	StateRevoked       State = "revoked"
+)
+
+// Health describes a user's broker credentials and what, if anything, they need
+type Health struct {
+	Broker          data.TradingBroker `json:"trading_broker"`
+	State           State              `json:"state"`
+	Message         string             `json:"message"`
+	HasCredentials  bool               `json:"has_credentials"` // API key and secret saved for login
+	AutoRefresh     bool               `json:"auto_refresh"`    // renewed in the background before expiry
+	ConfiguredAt    *time.Time         `json:"configured_at,omitempty"`
+	ExpiryTime      *time.Time         `json:"expiry_time,omitempty"`
+	ExpiresIn       *int64             `json:"expires_in_seconds,omitempty"`
+	RevokedAt       *time.Time         `json:"revoked_at,omitempty"`
+	RefreshFailedAt *time.Time         `json:"refresh_failed_at,omitempty"`
+	RefreshError    *string            `json:"refresh_error,omitempty"`
+}
+
+// Check reports the health of a broker config at the given time; config may be nil
+// Revocations and renewal failures only count against the token they were recorded for:
+// a token configured later, by any login or renewal, supersedes them.
+func Check(broker data.TradingBroker, config *data.BrokerConfig, now time.Time) Health {
+	health := Health{Broker: broker}
+	if connector, err := brokers.GetConnector(broker); err == nil {
+		health.AutoRefresh = connector.Capabilities().TokenRefresh
+	}
+	if config == nil {
+		health.State = StateNotConfigured
+		health.Message = "Broker is not configured"
+		return health
+	}
+
+	health.HasCredentials = config.APIKey != nil && config.APISecret != nil
+	if config.AccessToken == "" {
+		health.State = StateNotConfigured
+		health.Message = "No access token. Log in to the broker to connect it."
+		return health
+	}
+
+	configuredAt := config.ConfiguredAt
+	health.ConfiguredAt = &configuredAt
+	health.ExpiryTime = config.ExpiryTime
+	if config.RefreshFailedAt != nil && !config.RefreshFailedAt.Before(configuredAt) {
+		health.RefreshFailedAt = config.RefreshFailedAt
+		health.RefreshError = config.RefreshError
+	}
+
+	switch {
+	case config.RevokedAt != nil && !config.RevokedAt.Before(configuredAt):
+		health.State = StateRevoked
+		health.RevokedAt = config.RevokedAt
+		health.Message = "The broker rejected the access token. Log in to the broker again."
+	case config.ExpiryTime != nil && !config.ExpiryTime.After(now):
+		health.State = StateExpired
+		health.Message = "The access token has expired. Log in to the broker again."
+	case config.ExpiryTime != nil && config.ExpiryTime.Sub(now) <= ExpiringWithin:
+		health.State = StateExpiring
+		if health.AutoRefresh {
+			health.Message = "The access token expires soon and will be renewed automatically."
+		} else {
+			health.Message = "The access token expires soon. Log in to the broker again after it expires."
+		}
+	default:
+		health.State = StateValid
+		health.Message = "The access token is valid."
+	}
+
+	if config.ExpiryTime != nil && (health.State == StateValid || health.State == StateExpiring) {
+		expiresIn := int64(config.ExpiryTime.Sub(now).Seconds())
+		health.ExpiresIn = &expiresIn
+	}
+
+	return health
+}
+
+// CheckUser reports the health of a user's credentials for a broker
+func CheckUser(user *data.User, broker data.TradingBroker, now time.Time) Health {
+	config, exists := user.ConfiguredBrokers[string(broker)]
+	if !exists {
+		return Check(broker, nil, now)
+	}
+	return Check(broker, &config, now)
+}
@@ -0,0 +1,113 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) *time.Time {
+		when := now.Add(offset)
+		return &when
+	}
+	configured := now.Add(-20 * time.Hour)
+
+	tests := []struct {
+		name            string
+		broker          data.TradingBroker
+		config          *data.BrokerConfig
+		want            State
+		wantAutoRefresh bool
+		wantExpiresIn   *int64
+	}{
+		{
+			name:            "no config",
+			broker:          data.TradingBrokerDhan,
+			want:            StateNotConfigured,
+			wantAutoRefresh: true,
+		},
+		{
+			name:            "no access token",
+			broker:          data.TradingBrokerDhan,
+			config:          &data.BrokerConfig{ConfiguredAt: configured},
+			want:            StateNotConfigured,
+			wantAutoRefresh: true,
+		},
+		{
+			name:            "valid",
+			broker:          data.TradingBrokerDhan,
+			config:          &data.BrokerConfig{AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(3 * time.Hour)},
+			want:            StateValid,
+			wantAutoRefresh: true,
+			wantExpiresIn:   seconds(3 * time.Hour),
+		},
+		{
+			name:            "valid without a known expiry",
+			broker:          data.TradingBrokerDhan,
+			config:          &data.BrokerConfig{AccessToken: "token", ConfiguredAt: configured},
+			want:            StateValid,
+			wantAutoRefresh: true,
+		},
+		{
+			name:            "expiring within two hours",
+			broker:          data.TradingBrokerDhan,
+			config:          &data.BrokerConfig{AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(ExpiringWithin)},
+			want:            StateExpiring,
+			wantAutoRefresh: true,
+			wantExpiresIn:   seconds(ExpiringWithin),
+		},
+		{
+			name:          "expiring on a broker without token refresh",
+			broker:        data.TradingBrokerZerodha,
+			config:        &data.BrokerConfig{AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(time.Hour)},
+			want:          StateExpiring,
+			wantExpiresIn: seconds(time.Hour),
+		},
+		{
+			name:            "expired",
+			broker:          data.TradingBrokerDhan,
+			config:          &data.BrokerConfig{AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(0)},
+			want:            StateExpired,
+			wantAutoRefresh: true,
+		},
+		{
+			name:   "revoked",
+			broker: data.TradingBrokerDhan,
+			config: &data.BrokerConfig{
+				AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(3 * time.Hour), RevokedAt: at(-time.Hour),
+			},
+			want:            StateRevoked,
+			wantAutoRefresh: true,
+		},
+		{
+			name:   "revocation of an earlier token",
+			broker: data.TradingBrokerDhan,
+			config: &data.BrokerConfig{
+				AccessToken: "token", ConfiguredAt: configured, ExpiryTime: at(3 * time.Hour), RevokedAt: at(-24 * time.Hour),
+			},
+			want:            StateValid,
+			wantAutoRefresh: true,
+			wantExpiresIn:   seconds(3 * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := Check(tt.broker, tt.config, now)
+			if health.State != tt.want || health.AutoRefresh != tt.wantAutoRefresh {
+				t.Errorf("Check() = %s with auto refresh %v, want %s with %v", health.State, health.AutoRefresh, tt.want, tt.wantAutoRefresh)
+			}
+			if (health.ExpiresIn == nil) != (tt.wantExpiresIn == nil) ||
+				(health.ExpiresIn != nil && *health.ExpiresIn != *tt.wantExpiresIn) {
+				t.Errorf("ExpiresIn = %v, want %v", health.ExpiresIn, tt.wantExpiresIn)
+			}
+		})
+	}
+}
+
+func seconds(d time.Duration) *int64 {
+	s := int64(d.Seconds())
+	return &s
+}
@@ -0,0 +1,185 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/brokers"
+	"go-core/internal/utils"
+)
+
+// checkInterval is how often the manager looks for tokens to renew
+const checkInterval = 15 * time.Minute
+
+// Renew renews a user's access token through the connector and saves the outcome
+// A renewed token is saved as is. A token the broker rejects is marked revoked; any other
+// failure is recorded as a refresh error. In both cases the original error is returned.
+func Renew(ctx context.Context, db *sql.DB, keyring *secrets.Keyring, userID int, connector brokers.Connector, config *data.BrokerConfig) error {
+	broker := connector.GetBrokerName()
+	userRepo := repos.NewUserRepository(db, keyring)
+
+	renewErr := connector.RefreshToken(ctx, config)
+	if ctx.Err() != nil {
+		return renewErr // cancelled, not a failure of the token
+	}
+	if renewErr == nil {
+		if err := userRepo.UpdateUserBrokerToken(userID, string(broker), *config); err != nil {
+			return fmt.Errorf("failed to save renewed token: %w", err)
+		}
+		utils.LogInfo("Broker access token renewed", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": broker,
+			"expiry_time":    config.ExpiryTime,
+		})
+		return nil
+	}
+
+	now := time.Now()
+	message := renewErr.Error()
+	revoked := errors.Is(renewErr, brokers.ErrInvalidToken)
+	config.RefreshFailedAt = &now
+	config.RefreshError = &message
+	if revoked {
+		config.RevokedAt = &now
+	}
+	utils.LogError(renewErr, "Failed to renew broker access token", map[string]interface{}{
+		"user_id":        userID,
+		"trading_broker": broker,
+		"revoked":        revoked,
+	})
+	if err := userRepo.UpdateUserBrokerToken(userID, string(broker), *config); err != nil {
+		utils.LogError(err, "Failed to save broker token refresh failure", map[string]interface{}{
+			"user_id":        userID,
+			"trading_broker": broker,
+		})
+	}
+
+	return renewErr
+}
+
+// MarkRevoked records that the broker rejected a user's current access token
+func MarkRevoked(db *sql.DB, keyring *secrets.Keyring, userID int, broker data.TradingBroker, config *data.BrokerConfig) error {
+	now := time.Now()
+	config.RevokedAt = &now
+	if err := repos.NewUserRepository(db, keyring).UpdateUserBrokerToken(userID, string(broker), *config); err != nil {
+		return fmt.Errorf("failed to save revoked token: %w", err)
+	}
+
+	utils.LogInfo("Broker access token marked revoked", map[string]interface{}{
+		"user_id":        userID,
+		"trading_broker": broker,
+	})
+	return nil
+}
+
+// Manager renews access tokens in the background before they expire
+// Every checkInterval it renews tokens within ExpiringWithin of expiry for brokers that
+// support renewal. Expired and revoked tokens cannot be renewed and need a new login.
+type Manager struct {
+	db        *sql.DB
+	keyring   *secrets.Keyring
+	connector func(data.TradingBroker) (brokers.Connector, error)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      sync.WaitGroup
+}
+
+// NewManager creates a token manager; call Start to begin renewing tokens
+func NewManager(db *sql.DB, keyring *secrets.Keyring) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		db:        db,
+		keyring:   keyring,
+		connector: brokers.GetConnector,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start starts renewing tokens in the background, with a first pass straight away
+func (m *Manager) Start() {
+	m.done.Add(1)
+	go m.loop()
+}
+
+// Stop abandons any renewal in flight and waits for the manager to stop
+func (m *Manager) Stop() {
+	m.cancel()
+	m.done.Wait()
+}
+
+// loop renews due tokens every checkInterval until stopped
+func (m *Manager) loop() {
+	defer m.done.Done()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		m.renewDue()
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewDue renews every expiring token of a broker that supports renewal
+// Users are loaded one at a time, so a user whose credentials cannot be read, such as after a
+// master key was removed too early, is skipped without holding up everyone else's renewals.
+func (m *Manager) renewDue() {
+	userRepo := repos.NewUserRepository(m.db, m.keyring)
+	ids, err := userRepo.GetUserIDs()
+	if err != nil {
+		utils.LogError(err, "Failed to list users for token renewal")
+		return
+	}
+
+	renewed, failed := 0, 0
+	for _, id := range ids {
+		user, err := userRepo.GetUserByID(strconv.Itoa(id))
+		if err != nil {
+			utils.LogError(err, "Skipping user in token renewal", map[string]interface{}{
+				"user_id": id,
+			})
+			failed++
+			continue
+		}
+
+		for name, config := range user.ConfiguredBrokers {
+			broker := data.TradingBroker(name)
+			connector, err := m.connector(broker)
+			if err != nil || !connector.Capabilities().TokenRefresh {
+				continue
+			}
+			if health := Check(broker, &config, time.Now()); health.State != StateExpiring {
+				continue
+			}
+			if m.ctx.Err() != nil {
+				return
+			}
+			if err := Renew(m.ctx, m.db, m.keyring, user.ID, connector, &config); err != nil {
+				failed++
+			} else {
+				renewed++
+			}
+		}
+	}
+
+	if renewed > 0 || failed > 0 {
+		utils.LogInfo("Background token renewal completed", map[string]interface{}{
+			"renewed": renewed,
+			"failed":  failed,
+		})
+	}
+}
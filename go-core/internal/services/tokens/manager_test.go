@@ -0,0 +1,104 @@
+package tokens
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/data/repos"
+	"go-core/internal/secrets"
+	"go-core/internal/services/brokers"
+	"go-core/internal/testutil"
+)
+
+// fakeConnector renews tokens by appending "-renewed"; calling anything else panics
+type fakeConnector struct {
+	brokers.Connector
+	broker       data.TradingBroker
+	tokenRefresh bool
+	renewed      []string // access tokens passed to RefreshToken
+}
+
+func (c *fakeConnector) GetBrokerName() data.TradingBroker { return c.broker }
+
+func (c *fakeConnector) Capabilities() brokers.Capabilities {
+	return brokers.Capabilities{Broker: c.broker, TokenRefresh: c.tokenRefresh}
+}
+
+func (c *fakeConnector) RefreshToken(ctx context.Context, config *data.BrokerConfig) error {
+	c.renewed = append(c.renewed, config.AccessToken)
+	expiry := time.Now().Add(24 * time.Hour)
+	config.AccessToken += "-renewed"
+	config.ExpiryTime = &expiry
+	config.ConfiguredAt = time.Now()
+	return nil
+}
+
+func TestRenewDue(t *testing.T) {
+	db := testutil.NewDB(t)
+	keyring, err := secrets.NewKeyring(make([]byte, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("create keyring: %v", err)
+	}
+	userRepo := repos.NewUserRepository(db.GetConnection(), keyring)
+
+	now := time.Now()
+	at := func(offset time.Duration) *time.Time {
+		when := now.Add(offset)
+		return &when
+	}
+	// Each user holds one token named after its state
+	users := []struct {
+		broker data.TradingBroker
+		config data.BrokerConfig
+	}{
+		{data.TradingBrokerDhan, data.BrokerConfig{AccessToken: "expiring", ExpiryTime: at(time.Hour)}},
+		{data.TradingBrokerDhan, data.BrokerConfig{AccessToken: "valid", ExpiryTime: at(10 * time.Hour)}},
+		{data.TradingBrokerDhan, data.BrokerConfig{AccessToken: "expired", ExpiryTime: at(-time.Hour)}},
+		{data.TradingBrokerDhan, data.BrokerConfig{AccessToken: "revoked", ExpiryTime: at(time.Hour), RevokedAt: at(0)}},
+		{data.TradingBrokerZerodha, data.BrokerConfig{AccessToken: "no-refresh", ExpiryTime: at(time.Hour)}},
+	}
+	ids := make(map[string]int, len(users))
+	for i, u := range users {
+		user := &data.User{Name: u.config.AccessToken, Email: strconv.Itoa(i) + "@example.com", CreatedAt: now}
+		if err := userRepo.CreateUser(user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		u.config.ConfiguredAt = now.Add(-time.Hour)
+		if err := userRepo.UpdateUserBrokerConfig(user.ID, string(u.broker), u.config); err != nil {
+			t.Fatalf("configure broker: %v", err)
+		}
+		ids[u.config.AccessToken] = user.ID
+	}
+
+	connectors := map[data.TradingBroker]*fakeConnector{
+		data.TradingBrokerDhan:    {broker: data.TradingBrokerDhan, tokenRefresh: true},
+		data.TradingBrokerZerodha: {broker: data.TradingBrokerZerodha},
+	}
+	manager := NewManager(db.GetConnection(), keyring)
+	manager.connector = func(broker data.TradingBroker) (brokers.Connector, error) {
+		return connectors[broker], nil
+	}
+	manager.renewDue()
+
+	if renewed := connectors[data.TradingBrokerDhan].renewed; len(renewed) != 1 || renewed[0] != "expiring" {
+		t.Errorf("renewed %v, want only the expiring token", renewed)
+	}
+	if renewed := connectors[data.TradingBrokerZerodha].renewed; len(renewed) != 0 {
+		t.Errorf("renewed %v on a broker without token refresh", renewed)
+	}
+
+	user, err := userRepo.GetUserByID(strconv.Itoa(ids["expiring"]))
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	config := user.ConfiguredBrokers[string(data.TradingBrokerDhan)]
+	if config.AccessToken != "expiring-renewed" {
+		t.Errorf("saved access token %q, want the renewed token", config.AccessToken)
+	}
+	if health := Check(data.TradingBrokerDhan, &config, time.Now()); health.State != StateValid {
+		t.Errorf("renewed token is %s, want %s", health.State, StateValid)
+	}
+}
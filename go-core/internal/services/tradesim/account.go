@@ -0,0 +1,358 @@
+// Package tradesim simulates a trading account for algorithms: it turns signals into orders,
+// fills them against candles with slippage and charges, and tracks cash, positions and the
+// round trips they close. Backtests and paper trading share it, so both fill orders alike.
+package tradesim
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"go-core/internal/data"
+	"go-core/internal/services/algoruntime"
+)
+
+// Order sides
+const (
+	Buy  = algoruntime.SignalBuy
+	Sell = algoruntime.SignalSell
+)
+
+// Exit reasons of simulated round trips besides the reason of the closing signal
+const (
+	ExitStopLoss = "stop_loss"
+	ExitTarget   = "target"
+	ExitEnd      = "end_of_data"
+)
+
+// Order is a simulated order waiting for a bar to fill it
+type Order struct {
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"` // BUY or SELL
+	Quantity int       `json:"quantity"`
+	Limit    *float64  `json:"limit,omitempty"`     // nil for a market order
+	StopLoss *float64  `json:"stop_loss,omitempty"` // for the position the order opens
+	Target   *float64  `json:"target,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	PlacedAt time.Time `json:"placed_at"`
+}
+
+// Position is an open simulated position
+type Position struct {
+	Quantity     int       `json:"quantity"` // negative when short
+	AveragePrice float64   `json:"average_price"`
+	EntryTime    time.Time `json:"entry_time"`
+	EntryCharges float64   `json:"entry_charges"` // charges of the open quantity, booked when it closes
+	StopLoss     *float64  `json:"stop_loss,omitempty"`
+	Target       *float64  `json:"target,omitempty"`
+	LastPrice    float64   `json:"last_price"`
+}
+
+// Fill is one simulated execution
+type Fill struct {
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Quantity int       `json:"quantity"`
+	Price    float64   `json:"price"` // after slippage
+	Charges  float64   `json:"charges"`
+	Time     time.Time `json:"time"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Account is a simulated trading account
+// Its exported fields are its whole state, so it can be persisted as JSON between bars;
+// Costs are configuration and must be set again after loading.
+type Account struct {
+	InitialCash float64              `json:"initial_cash"`
+	Cash        float64              `json:"cash"`
+	Positions   map[string]*Position `json:"positions"` // keyed by symbol
+	Orders      []*Order             `json:"orders"`    // pending, oldest first
+	RealizedPnL float64              `json:"realized_pnl"`
+	Charges     float64              `json:"charges"` // paid so far
+
+	Costs Costs `json:"-"`
+}
+
+// NewAccount creates an account holding only cash
+func NewAccount(cash float64, costs Costs) *Account {
+	return &Account{
+		InitialCash: cash,
+		Cash:        cash,
+		Positions:   make(map[string]*Position),
+		Orders:      []*Order{},
+		Costs:       costs,
+	}
+}
+
+// Equity is cash plus open positions at their last prices
+func (a *Account) Equity() float64 {
+	equity := a.Cash
+	for _, position := range a.Positions {
+		equity += float64(position.Quantity) * position.LastPrice
+	}
+	return equity
+}
+
+// Portfolio is the account as algorithm code sees it in context['portfolio']
+func (a *Account) Portfolio() algoruntime.Portfolio {
+	positions := make(map[string]algoruntime.Position, len(a.Positions))
+	for symbol, position := range a.Positions {
+		positions[symbol] = algoruntime.Position{
+			Quantity:     position.Quantity,
+			AveragePrice: position.AveragePrice,
+			LastPrice:    position.LastPrice,
+			PnL:          float64(position.Quantity) * (position.LastPrice - position.AveragePrice),
+		}
+	}
+	equity := a.Equity()
+	return algoruntime.Portfolio{
+		Cash:       a.Cash,
+		Positions:  positions,
+		TotalValue: equity,
+		PnL:        equity - a.InitialCash,
+	}
+}
+
+// Place queues an order for the following bars, replacing pending orders of the same symbol
+func (a *Account) Place(order *Order) {
+	a.Cancel(order.Symbol)
+	a.Orders = append(a.Orders, order)
+}
+
+// Cancel drops the pending orders of symbol
+func (a *Account) Cancel(symbol string) {
+	pending := a.Orders[:0]
+	for _, order := range a.Orders {
+		if order.Symbol != symbol {
+			pending = append(pending, order)
+		}
+	}
+	a.Orders = pending
+}
+
+// Step moves the account through one bar of bar.Symbol: pending orders of the symbol fill
+// if the bar reaches them, then the position exits if the bar reaches its stop loss or target,
+// and the position is marked to the bar's close. When a bar reaches both the stop loss and
+// the target, the stop loss is assumed to have been hit first.
+func (a *Account) Step(bar *data.Candle) ([]Fill, []data.SimulatedTrade) {
+	var fills []Fill
+	var trades []data.SimulatedTrade
+
+	pending := a.Orders[:0]
+	for _, order := range a.Orders {
+		if order.Symbol != bar.Symbol {
+			pending = append(pending, order)
+			continue
+		}
+		price, ok := matchPrice(order, bar)
+		if !ok {
+			pending = append(pending, order)
+			continue
+		}
+		fill, closed := a.execute(order, price, order.Limit == nil, bar.Timestamp)
+		fills = append(fills, fill)
+		trades = append(trades, closed...)
+	}
+	a.Orders = pending
+
+	if position := a.Positions[bar.Symbol]; position != nil {
+		if price, reason, ok := exitPrice(position, bar); ok {
+			exit := &Order{Symbol: bar.Symbol, Side: Buy, Quantity: -position.Quantity, Reason: reason}
+			if position.Quantity > 0 {
+				exit.Side, exit.Quantity = Sell, position.Quantity
+			}
+			fill, closed := a.execute(exit, price, reason == ExitStopLoss, bar.Timestamp)
+			fills = append(fills, fill)
+			trades = append(trades, closed...)
+		}
+	}
+
+	a.Mark(bar.Symbol, bar.Close)
+	return fills, trades
+}
+
+// Mark sets the last price of symbol's position
+func (a *Account) Mark(symbol string, price float64) {
+	if position := a.Positions[symbol]; position != nil {
+		position.LastPrice = price
+	}
+}
+
+// Execute fills order now at price, as a market order at a bar's close
+func (a *Account) Execute(order *Order, price float64, at time.Time) (Fill, []data.SimulatedTrade) {
+	return a.execute(order, price, true, at)
+}
+
+// CloseAll exits every open position at its last price and cancels pending orders
+func (a *Account) CloseAll(reason string, at time.Time) ([]Fill, []data.SimulatedTrade) {
+	symbols := make([]string, 0, len(a.Positions))
+	for symbol := range a.Positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var fills []Fill
+	var trades []data.SimulatedTrade
+	for _, symbol := range symbols {
+		position := a.Positions[symbol]
+		exit := &Order{Symbol: symbol, Side: Buy, Quantity: -position.Quantity, Reason: reason}
+		if position.Quantity > 0 {
+			exit.Side, exit.Quantity = Sell, position.Quantity
+		}
+		fill, closed := a.execute(exit, position.LastPrice, false, at)
+		fills = append(fills, fill)
+		trades = append(trades, closed...)
+	}
+	a.Orders = []*Order{}
+	return fills, trades
+}
+
+// execute fills order at price, slipped if it is a market fill, closing any opposite position
+// first and opening or adding to a position with the rest
+func (a *Account) execute(order *Order, price float64, market bool, at time.Time) (Fill, []data.SimulatedTrade) {
+	if market {
+		price = a.Costs.slip(order.Side, price)
+	}
+	charges := a.Costs.charges(order.Side, order.Quantity, price)
+	fill := Fill{
+		Symbol:   order.Symbol,
+		Side:     order.Side,
+		Quantity: order.Quantity,
+		Price:    price,
+		Charges:  charges,
+		Time:     at,
+		Reason:   order.Reason,
+	}
+
+	value := float64(order.Quantity) * price
+	if order.Side == Buy {
+		a.Cash -= value + charges
+	} else {
+		a.Cash += value - charges
+	}
+	a.Charges += charges
+
+	signed := order.Quantity
+	if order.Side == Sell {
+		signed = -signed
+	}
+
+	var trades []data.SimulatedTrade
+	remaining := order.Quantity
+	position := a.Positions[order.Symbol]
+	if position != nil && (position.Quantity > 0) != (signed > 0) {
+		open := abs(position.Quantity)
+		closing := min(remaining, open)
+		entryCharges := position.EntryCharges * float64(closing) / float64(open)
+		exitCharges := charges * float64(closing) / float64(order.Quantity)
+
+		direction, sign := data.TradeDirectionLong, 1.0
+		if position.Quantity < 0 {
+			direction, sign = data.TradeDirectionShort, -1.0
+		}
+		pnl := sign*(price-position.AveragePrice)*float64(closing) - entryCharges - exitCharges
+		trades = append(trades, data.SimulatedTrade{
+			Symbol:     order.Symbol,
+			Direction:  direction,
+			Quantity:   closing,
+			EntryTime:  position.EntryTime,
+			EntryPrice: position.AveragePrice,
+			ExitTime:   at,
+			ExitPrice:  price,
+			Charges:    round(entryCharges + exitCharges),
+			PnL:        round(pnl),
+			ReturnPct:  round(pnl / (position.AveragePrice * float64(closing)) * 100),
+			ExitReason: order.Reason,
+		})
+		a.RealizedPnL += pnl
+
+		position.EntryCharges -= entryCharges
+		if position.Quantity > 0 {
+			position.Quantity -= closing
+		} else {
+			position.Quantity += closing
+		}
+		if position.Quantity == 0 {
+			delete(a.Positions, order.Symbol)
+			position = nil
+		}
+		remaining -= closing
+	}
+
+	if remaining > 0 {
+		entryCharges := charges * float64(remaining) / float64(order.Quantity)
+		added := remaining
+		if order.Side == Sell {
+			added = -remaining
+		}
+		if position == nil {
+			position = &Position{EntryTime: at}
+			a.Positions[order.Symbol] = position
+		}
+		held := float64(abs(position.Quantity))
+		position.AveragePrice = (position.AveragePrice*held + price*float64(remaining)) / (held + float64(remaining))
+		position.Quantity += added
+		position.EntryCharges += entryCharges
+		if order.StopLoss != nil {
+			position.StopLoss = order.StopLoss
+		}
+		if order.Target != nil {
+			position.Target = order.Target
+		}
+	}
+	if position != nil {
+		position.LastPrice = price
+	}
+
+	return fill, trades
+}
+
+// matchPrice returns the price bar fills order at: a market order fills at the open and a
+// limit order at its limit, or at the open if the bar opens through it
+func matchPrice(order *Order, bar *data.Candle) (float64, bool) {
+	if order.Limit == nil {
+		return bar.Open, true
+	}
+	limit := *order.Limit
+	if order.Side == Buy && bar.Low <= limit {
+		return math.Min(bar.Open, limit), true
+	}
+	if order.Side == Sell && bar.High >= limit {
+		return math.Max(bar.Open, limit), true
+	}
+	return 0, false
+}
+
+// exitPrice returns the price bar reaches position's stop loss or target at, if it does
+func exitPrice(position *Position, bar *data.Candle) (float64, string, bool) {
+	long := position.Quantity > 0
+	if stop := position.StopLoss; stop != nil {
+		if long && bar.Low <= *stop {
+			return math.Min(bar.Open, *stop), ExitStopLoss, true
+		}
+		if !long && bar.High >= *stop {
+			return math.Max(bar.Open, *stop), ExitStopLoss, true
+		}
+	}
+	if target := position.Target; target != nil {
+		if long && bar.High >= *target {
+			return math.Max(bar.Open, *target), ExitTarget, true
+		}
+		if !long && bar.Low <= *target {
+			return math.Min(bar.Open, *target), ExitTarget, true
+		}
+	}
+	return 0, "", false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// round rounds to the paisa
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
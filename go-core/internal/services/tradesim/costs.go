@@ -0,0 +1,64 @@
+package tradesim
+
+import (
+	"math"
+
+	"go-core/internal/data"
+)
+
+// Costs are what simulated fills pay beyond the quoted price
+type Costs struct {
+	SlippageBps float64      // adverse slippage of market fills, in basis points
+	Charges     data.Charges // brokerage and statutory charges
+}
+
+// Approximate NSE equity rates, as fractions of turnover
+const (
+	intradayBrokerageRate = 0.0003    // 0.03%, capped at intradayBrokerageCap per order
+	intradayBrokerageCap  = 20.0      // rupees
+	intradaySTTRate       = 0.00025   // on the sell side
+	deliverySTTRate       = 0.001     // on both sides
+	exchangeRate          = 0.0000297 // NSE transaction charge
+	sebiRate              = 0.000001  // ₹10 per crore
+	intradayStampRate     = 0.00003   // on the buy side
+	deliveryStampRate     = 0.00015   // on the buy side
+	gstRate               = 0.18      // on brokerage and exchange and SEBI charges
+)
+
+// slip moves a market fill's price against the order by the slippage
+func (c Costs) slip(side string, price float64) float64 {
+	if side == Buy {
+		return price * (1 + c.SlippageBps/10000)
+	}
+	return price * (1 - c.SlippageBps/10000)
+}
+
+// charges returns the charges of a fill of quantity at price, rounded to the paisa
+func (c Costs) charges(side string, quantity int, price float64) float64 {
+	turnover := float64(quantity) * price
+
+	var total float64
+	switch c.Charges.Model {
+	case data.ChargeModelFlat:
+		total = c.Charges.PerOrder
+	case data.ChargeModelPercent:
+		total = turnover * c.Charges.Percent / 100
+	case data.ChargeModelEquityIntraday:
+		brokerage := math.Min(turnover*intradayBrokerageRate, intradayBrokerageCap)
+		fees := turnover * (exchangeRate + sebiRate)
+		total = brokerage + fees + (brokerage+fees)*gstRate
+		if side == Sell {
+			total += turnover * intradaySTTRate
+		} else {
+			total += turnover * intradayStampRate
+		}
+	case data.ChargeModelEquityDelivery:
+		fees := turnover * (exchangeRate + sebiRate)
+		total = fees + fees*gstRate + turnover*deliverySTTRate
+		if side == Buy {
+			total += turnover * deliveryStampRate
+		}
+	}
+
+	return math.Round(total*100) / 100
+}
@@ -0,0 +1,61 @@
+package tradesim
+
+import (
+	"math"
+	"testing"
+
+	"go-core/internal/data"
+)
+
+func TestCharges(t *testing.T) {
+	// Worked by hand from the published NSE rates; 100 shares at ₹500 is ₹50,000 of turnover:
+	// exchange and SEBI fees 50,000 × 0.00307% = 1.535 and intraday brokerage 0.03% = 15.
+	tests := []struct {
+		name     string
+		charges  data.Charges
+		side     string
+		quantity int
+		price    float64
+		want     float64
+	}{
+		{name: "no model", charges: data.Charges{Model: data.ChargeModelNone}, side: Buy, quantity: 100, price: 500, want: 0},
+		{name: "flat", charges: data.Charges{Model: data.ChargeModelFlat, PerOrder: 20}, side: Sell, quantity: 100, price: 500, want: 20},
+		{name: "percent", charges: data.Charges{Model: data.ChargeModelPercent, Percent: 0.05}, side: Buy, quantity: 100, price: 500, want: 25},
+		// 15 + 1.535 + 18% GST on 16.535 + 0.003% stamp duty of 1.5
+		{name: "intraday buy", charges: data.Charges{Model: data.ChargeModelEquityIntraday}, side: Buy, quantity: 100, price: 500, want: 21.01},
+		// 15 + 1.535 + 18% GST on 16.535 + 0.025% STT of 12.5
+		{name: "intraday sell", charges: data.Charges{Model: data.ChargeModelEquityIntraday}, side: Sell, quantity: 100, price: 500, want: 32.01},
+		// Brokerage on ₹10 lakh is capped at ₹20: 20 + 30.7 + 18% GST on 50.7 + stamp duty of 30
+		{name: "intraday brokerage cap", charges: data.Charges{Model: data.ChargeModelEquityIntraday}, side: Buy, quantity: 1000, price: 1000, want: 89.83},
+		// 1.535 + 18% GST + 0.1% STT of 50 + 0.015% stamp duty of 7.5
+		{name: "delivery buy", charges: data.Charges{Model: data.ChargeModelEquityDelivery}, side: Buy, quantity: 100, price: 500, want: 59.31},
+		// 1.535 + 18% GST + 0.1% STT of 50
+		{name: "delivery sell", charges: data.Charges{Model: data.ChargeModelEquityDelivery}, side: Sell, quantity: 100, price: 500, want: 51.81},
+	}
+	for _, tt := range tests {
+		costs := Costs{Charges: tt.charges}
+		if got := costs.charges(tt.side, tt.quantity, tt.price); got != tt.want {
+			t.Errorf("%s: charges(%s, %d, %v) = %v, want %v", tt.name, tt.side, tt.quantity, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestSlip(t *testing.T) {
+	tests := []struct {
+		bps   float64
+		side  string
+		price float64
+		want  float64
+	}{
+		{bps: 0, side: Buy, price: 500, want: 500},
+		{bps: 10, side: Buy, price: 500, want: 500.5},
+		{bps: 10, side: Sell, price: 500, want: 499.5},
+		{bps: 2.5, side: Sell, price: 24000, want: 23994},
+	}
+	for _, tt := range tests {
+		got := Costs{SlippageBps: tt.bps}.slip(tt.side, tt.price)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("slip(%s, %v) at %v bps = %v, want %v", tt.side, tt.price, tt.bps, got, tt.want)
+		}
+	}
+}
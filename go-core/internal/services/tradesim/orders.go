@@ -0,0 +1,108 @@
+package tradesim
+
+import (
+	"math"
+
+	"go-core/internal/data"
+	"go-core/internal/services/algoruntime"
+)
+
+// Act turns a signal on bar into orders on the account
+// BUY covers a short or opens a long, and SELL exits a long or, when shorting is allowed, opens
+// a short; a signal in the direction of the open position only updates its stop loss and
+// target, as does HOLD. A signal with a price is a limit order resting until a bar reaches it;
+// other orders fill at the bar's close or the next bar's open, by the fill rule.
+// Entries are sized by the settings and cut down to what the account can afford.
+func (a *Account) Act(signal *algoruntime.Signal, bar *data.Candle, settings data.SimulationSettings) ([]Fill, []data.SimulatedTrade) {
+	position := a.Positions[bar.Symbol]
+	if signal.Signal == algoruntime.SignalHold || (position != nil && (position.Quantity > 0) == (signal.Signal == Buy)) {
+		if position != nil {
+			if signal.StopLoss != nil {
+				position.StopLoss = signal.StopLoss
+			}
+			if signal.Target != nil {
+				position.Target = signal.Target
+			}
+		}
+		return nil, nil
+	}
+
+	order := &Order{
+		Symbol:   bar.Symbol,
+		Side:     signal.Signal,
+		Limit:    signal.Price,
+		StopLoss: signal.StopLoss,
+		Target:   signal.Target,
+		Reason:   signal.Reason,
+		PlacedAt: bar.Timestamp,
+	}
+	if order.Reason == "" {
+		order.Reason = "signal"
+	}
+
+	price := bar.Close
+	if signal.Price != nil {
+		price = *signal.Price
+	}
+	if position != nil {
+		order.Quantity = abs(position.Quantity)
+	} else if signal.Signal == Buy || settings.AllowShort {
+		order.Quantity = a.size(signal, price, settings.Sizing)
+	}
+	if order.Quantity == 0 {
+		return nil, nil
+	}
+
+	marketable := order.Limit == nil ||
+		(order.Side == Buy && bar.Close <= *order.Limit) || (order.Side == Sell && bar.Close >= *order.Limit)
+	if settings.Fill == data.FillRuleClose && marketable {
+		a.Cancel(bar.Symbol)
+		fill, trades := a.execute(order, bar.Close, order.Limit == nil, bar.Timestamp)
+		a.Mark(bar.Symbol, bar.Close)
+		return []Fill{fill}, trades
+	}
+	a.Place(order)
+	return nil, nil
+}
+
+// size returns the quantity of a new position at price, limited by the account's equity
+func (a *Account) size(signal *algoruntime.Signal, price float64, sizing data.PositionSizing) int {
+	if price <= 0 {
+		return 0
+	}
+
+	var quantity int
+	switch sizing.Mode {
+	case data.SizingModeFixed:
+		quantity = sizing.Quantity
+	case data.SizingModePercentEquity:
+		quantity = int(math.Floor(a.Equity() * sizing.Percent / 100 / price))
+	default:
+		quantity = signal.Quantity
+		if quantity == 0 {
+			quantity = max(sizing.Quantity, 1)
+		}
+	}
+
+	// Leave room for slippage and charges
+	side := signal.Signal
+	for quantity > 0 {
+		fillPrice := a.Costs.slip(side, price)
+		cost := float64(quantity)*fillPrice + a.Costs.charges(side, quantity, fillPrice)
+		if cost <= a.available() {
+			break
+		}
+		affordable := int(math.Floor(a.available() / (fillPrice * 1.01)))
+		quantity = min(quantity-1, max(affordable, 0))
+	}
+	return quantity
+}
+
+// available is the cash an entry may use: equity less what open positions tie up
+func (a *Account) available() float64 {
+	available := a.Equity()
+	for _, position := range a.Positions {
+		available -= math.Abs(float64(position.Quantity) * position.LastPrice)
+	}
+	return available
+}
@@ -0,0 +1,80 @@
+package tradesim
+
+import (
+	"fmt"
+
+	"go-core/internal/data"
+)
+
+const (
+	defaultInitialCapital = 100000
+	defaultLookback       = 500
+)
+
+// Validate checks simulation settings and fills in their defaults: 100000 capital, no charges,
+// signal sizing with a fallback of one share, fills at the next bar's open and a 500-bar lookback
+func Validate(settings *data.SimulationSettings) error {
+	if settings.InitialCapital == 0 {
+		settings.InitialCapital = defaultInitialCapital
+	}
+	if settings.InitialCapital < 0 {
+		return fmt.Errorf("initial capital must be positive")
+	}
+	if settings.Lookback == 0 {
+		settings.Lookback = defaultLookback
+	}
+	if settings.Lookback < 0 {
+		return fmt.Errorf("lookback must be positive")
+	}
+	if settings.SlippageBps < 0 {
+		return fmt.Errorf("slippage must not be negative")
+	}
+
+	switch settings.Charges.Model {
+	case "":
+		settings.Charges.Model = data.ChargeModelNone
+	case data.ChargeModelNone, data.ChargeModelEquityIntraday, data.ChargeModelEquityDelivery:
+	case data.ChargeModelFlat:
+		if settings.Charges.PerOrder < 0 {
+			return fmt.Errorf("flat charges must not be negative")
+		}
+	case data.ChargeModelPercent:
+		if settings.Charges.Percent < 0 {
+			return fmt.Errorf("percent charges must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid charges model %q", settings.Charges.Model)
+	}
+
+	sizing := &settings.Sizing
+	switch sizing.Mode {
+	case "":
+		sizing.Mode = data.SizingModeSignal
+	case data.SizingModeSignal, data.SizingModeFixed, data.SizingModePercentEquity:
+	default:
+		return fmt.Errorf("invalid sizing mode %q", sizing.Mode)
+	}
+	if sizing.Quantity < 0 {
+		return fmt.Errorf("sizing quantity must not be negative")
+	}
+	if sizing.Mode == data.SizingModeFixed && sizing.Quantity == 0 {
+		return fmt.Errorf("fixed sizing needs a quantity")
+	}
+	if sizing.Mode == data.SizingModePercentEquity && (sizing.Percent <= 0 || sizing.Percent > 100) {
+		return fmt.Errorf("percent_equity sizing needs a percent between 0 and 100")
+	}
+
+	switch settings.Fill {
+	case "":
+		settings.Fill = data.FillRuleNextOpen
+	case data.FillRuleNextOpen, data.FillRuleClose:
+	default:
+		return fmt.Errorf("invalid fill rule %q", settings.Fill)
+	}
+	return nil
+}
+
+// CostsOf returns the fill costs of settings
+func CostsOf(settings data.SimulationSettings) Costs {
+	return Costs{SlippageBps: settings.SlippageBps, Charges: settings.Charges}
+}
@@ -0,0 +1,42 @@
+// Package testutil holds helpers shared by the tests of several packages: a migrated database
+// in a temporary directory and quiet logging. It is imported only from _test.go files.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"go-core/internal/data"
+	"go-core/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// migrationsDir is go-core's migrations directory, found from this file so tests need not chdir
+var migrationsDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}()
+
+// QuietLogs lowers logging to errors, unless LOG_LEVEL asks for more
+func QuietLogs() {
+	if os.Getenv("LOG_LEVEL") == "" {
+		utils.GetLogger().SetLevel(logrus.ErrorLevel)
+	}
+}
+
+// NewDB opens a migrated database in a temporary directory with logging quieted
+// It is closed after the cleanups the test registers later, so they may still use it.
+func NewDB(t testing.TB) *data.DB {
+	t.Helper()
+	QuietLogs()
+
+	db, err := data.NewDBWithMigrations(filepath.Join(t.TempDir(), "test.sqlite"), migrationsDir)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"math/rand/v2"
 	"os"
 	"strings"
 	"time"
@@ -29,6 +30,9 @@ func InitLogger() {
 
 	Logger.SetOutput(os.Stdout)
 
+	// Never write broker credentials or passwords to the logs
+	Logger.AddHook(redactHook{})
+
 	// Set log level from environment
 	levelStr := os.Getenv("LOG_LEVEL")
 	if levelStr == "" {
@@ -204,7 +208,7 @@ func randomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+		b[i] = charset[rand.IntN(len(charset))]
 	}
 	return string(b)
 }
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redacted replaces credential values in logs
+const redacted = "[REDACTED]"
+
+// sensitiveFields are log field names, normalised by normaliseFieldName, whose values are never logged
+var sensitiveFields = map[string]bool{
+	"accesstoken":   true,
+	"apikey":        true,
+	"apisecret":     true,
+	"requesttoken":  true,
+	"tokenid":       true,
+	"checksum":      true,
+	"password":      true,
+	"authorization": true,
+}
+
+// sensitivePattern matches credentials inside strings, as query parameters (request_token=...),
+// JSON members ("accessToken":"...") or headers (access-token: ...)
+var sensitivePattern = regexp.MustCompile(`(?i)((?:access[_-]?token|api[_-]?key|api[_-]?secret|request[_-]?token|token[_-]?id|checksum|password)"?\s*[=:]\s*"?)([^"&\s,}]+)`)
+
+// RedactSecrets masks credential values embedded in a string such as a URL or response body
+func RedactSecrets(s string) string {
+	return sensitivePattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// normaliseFieldName lowercases a field name and drops separators, so access_token,
+// accessToken and access-token are treated alike
+func normaliseFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// redactHook removes broker credentials and passwords from every log entry before it is written
+type redactHook struct{}
+
+// Levels applies the hook to every level
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks sensitive fields and credentials embedded in string fields and the message
+func (redactHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		if sensitiveFields[normaliseFieldName(key)] {
+			entry.Data[key] = redacted
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = RedactSecrets(v)
+		case error:
+			if message := RedactSecrets(v.Error()); message != v.Error() {
+				entry.Data[key] = errors.New(message)
+			}
+		}
+	}
+	entry.Message = RedactSecrets(entry.Message)
+	return nil
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"query parameter", "https://kite.zerodha.com/connect/login?request_token=abc123&action=login", "https://kite.zerodha.com/connect/login?request_token=[REDACTED]&action=login"},
+		{"json member", `{"accessToken":"eyJhbGciOi","dhanClientId":"1100"}`, `{"accessToken":"[REDACTED]","dhanClientId":"1100"}`},
+		{"header", "access-token: eyJhbGciOi", "access-token: [REDACTED]"},
+		{"case and separators", "API_KEY=k1, Api-Secret = s2", "API_KEY=[REDACTED], Api-Secret = [REDACTED]"},
+		{"checksum and password", "checksum=deadbeef password=hunter2", "checksum=[REDACTED] password=[REDACTED]"},
+		{"unrelated text", "symbol=INFY quantity=10", "symbol=INFY quantity=10"},
+	}
+	for _, tt := range tests {
+		if got := RedactSecrets(tt.in); got != tt.want {
+			t.Errorf("%s: RedactSecrets(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactHook(t *testing.T) {
+	entry := logrus.NewEntry(logrus.New())
+	entry.Message = "exchanging request_token=abc123"
+	entry.Data = logrus.Fields{
+		"access_token": "eyJhbGciOi",
+		"apiSecret":    "s3cr3t",
+		"Token-ID":     12345,
+		"url":          "https://api.example.com/session?api_key=k1",
+		"error":        errors.New(`status 403: {"access_token":"eyJhbGciOi"}`),
+		"symbol":       "INFY",
+	}
+
+	if err := (redactHook{}).Fire(entry); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+
+	want := map[string]string{
+		"access_token": "[REDACTED]",
+		"apiSecret":    "[REDACTED]",
+		"Token-ID":     "[REDACTED]",
+		"url":          "https://api.example.com/session?api_key=[REDACTED]",
+		"error":        `status 403: {"access_token":"[REDACTED]"}`,
+		"symbol":       "INFY",
+	}
+	for key, value := range want {
+		got := entry.Data[key]
+		if err, ok := got.(error); ok {
+			got = err.Error()
+		}
+		if got != value {
+			t.Errorf("field %s = %v, want %q", key, got, value)
+		}
+	}
+	if entry.Message != "exchanging request_token=[REDACTED]" {
+		t.Errorf("message = %q", entry.Message)
+	}
+}
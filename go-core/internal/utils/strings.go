@@ -0,0 +1,17 @@
+package utils
+
+// OptionalString returns nil for an empty string so optional columns stay NULL
+func OptionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// StringValue returns the string an optional column points to, or "" when it is NULL
+func StringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,6 @@
+package utils
+
+import "time"
+
+// IST is Indian Standard Time, the timezone Indian exchanges, brokers and financial years use
+var IST = time.FixedZone("IST", 5*60*60+30*60)
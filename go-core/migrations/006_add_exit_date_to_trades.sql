@@ -0,0 +1,5 @@
+-- Add exit date to trades
+-- Needed to compute holding periods (e.g. short vs long term capital gains); NULL for open trades
+-- and for trades recorded before this column existed
+
+ALTER TABLE trades ADD COLUMN exit_date TIMESTAMP;
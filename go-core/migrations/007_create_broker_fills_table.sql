@@ -0,0 +1,23 @@
+-- Ledger of individual broker executions, keyed by exchange trade ID
+-- Used to dedup imports per fill and to reconcile stored fills against the broker
+CREATE TABLE IF NOT EXISTS broker_fills (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    trading_broker TEXT NOT NULL,
+    trade_id TEXT NOT NULL,
+    order_id TEXT,
+    exchange_order_id TEXT,
+    symbol TEXT NOT NULL,
+    product_type TEXT,
+    side TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    price REAL NOT NULL,
+    fill_time TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, trading_broker, trade_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_fills_user_broker_time ON broker_fills(user_id, trading_broker, fill_time);
+CREATE INDEX IF NOT EXISTS idx_broker_fills_order_id ON broker_fills(user_id, trading_broker, order_id);
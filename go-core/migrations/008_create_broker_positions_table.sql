@@ -0,0 +1,21 @@
+-- Latest snapshot of open positions and demat holdings at each broker
+-- Replaced wholesale on every sync; compared against open journal trades to flag discrepancies
+CREATE TABLE IF NOT EXISTS broker_positions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    trading_broker TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('position', 'holding')),
+    symbol TEXT NOT NULL,
+    exchange TEXT,
+    product_type TEXT,
+    isin TEXT,
+    quantity INTEGER NOT NULL,
+    average_price REAL NOT NULL,
+    last_price REAL NOT NULL,
+    day_pnl REAL NOT NULL,
+    pnl REAL NOT NULL,
+    synced_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_positions_user_broker ON broker_positions(user_id, trading_broker);
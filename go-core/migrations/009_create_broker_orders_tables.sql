@@ -0,0 +1,54 @@
+-- Broker order book, including rejected, cancelled and modified orders
+-- One row per broker order in its latest state; fills link to it through order_id
+CREATE TABLE IF NOT EXISTS broker_orders (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    trading_broker TEXT NOT NULL,
+    order_id TEXT NOT NULL,
+    exchange_order_id TEXT,
+    parent_order_id TEXT,
+    symbol TEXT NOT NULL,
+    exchange TEXT,
+    product_type TEXT,
+    order_type TEXT,
+    side TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    filled_quantity INTEGER NOT NULL DEFAULT 0,
+    price REAL NOT NULL DEFAULT 0,
+    trigger_price REAL NOT NULL DEFAULT 0,
+    average_price REAL NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    broker_status TEXT NOT NULL,
+    status_message TEXT,
+    placed_at TIMESTAMP NOT NULL,
+    last_updated_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, trading_broker, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_orders_user_broker_placed ON broker_orders(user_id, trading_broker, placed_at);
+CREATE INDEX IF NOT EXISTS idx_broker_orders_symbol ON broker_orders(user_id, trading_broker, symbol);
+
+-- Status transitions and modifications of broker orders, oldest first by event_time
+-- The unique key drops states already recorded by an earlier sync
+CREATE TABLE IF NOT EXISTS broker_order_events (
+    id TEXT PRIMARY KEY,
+    broker_order_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    broker_status TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    filled_quantity INTEGER NOT NULL DEFAULT 0,
+    price REAL NOT NULL DEFAULT 0,
+    trigger_price REAL NOT NULL DEFAULT 0,
+    message TEXT,
+    event_time TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (broker_order_id) REFERENCES broker_orders(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (broker_order_id, event_time, broker_status, quantity, filled_quantity, price, trigger_price)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_order_events_order ON broker_order_events(broker_order_id, event_time);
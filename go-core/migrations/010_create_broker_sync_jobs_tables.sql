@@ -0,0 +1,44 @@
+-- Background broker syncs: one row per run, queued by a user or by their schedule
+-- Queued runs survive a restart; runs left running by a restart are marked failed on startup
+CREATE TABLE IF NOT EXISTS broker_sync_runs (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    trading_broker TEXT NOT NULL,
+    trigger TEXT NOT NULL CHECK (trigger IN ('manual', 'scheduled')),
+    method TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    stage TEXT,
+    fetched_count INTEGER NOT NULL DEFAULT 0,
+    saved_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    skipped_count INTEGER NOT NULL DEFAULT 0,
+    warnings TEXT, -- JSON array
+    error TEXT,
+    queued_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    duration_ms INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_sync_runs_user_broker ON broker_sync_runs(user_id, trading_broker, queued_at);
+CREATE INDEX IF NOT EXISTS idx_broker_sync_runs_status ON broker_sync_runs(status, queued_at);
+
+-- Per-user schedule for background syncs of one broker, in IST
+CREATE TABLE IF NOT EXISTS broker_sync_schedules (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    trading_broker TEXT NOT NULL,
+    run_at TEXT NOT NULL,   -- HH:MM
+    weekdays TEXT NOT NULL, -- comma separated, Sunday = 0
+    method TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, trading_broker)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broker_sync_schedules_next_run ON broker_sync_schedules(enabled, next_run_at);
@@ -0,0 +1,24 @@
+-- Instrument master loaded from the brokers' instrument dumps, shared by every user
+-- Each import replaces one broker's rows; broker_token is Dhan's security ID or Kite's instrument_token
+CREATE TABLE IF NOT EXISTS instruments (
+    id TEXT PRIMARY KEY,
+    trading_broker TEXT NOT NULL,
+    broker_token TEXT NOT NULL,
+    exchange TEXT NOT NULL,         -- NSE, BSE or MCX
+    segment TEXT NOT NULL CHECK (segment IN ('equity', 'index', 'derivative', 'currency', 'commodity')),
+    trading_symbol TEXT NOT NULL,
+    name TEXT,
+    isin TEXT,
+    instrument_type TEXT NOT NULL,  -- EQ, INDEX, FUT, CE or PE
+    underlying TEXT,                -- underlying symbol of derivatives
+    lot_size INTEGER NOT NULL DEFAULT 1,
+    tick_size REAL NOT NULL DEFAULT 0,
+    expiry TIMESTAMP,
+    strike REAL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (trading_broker, broker_token)
+);
+
+CREATE INDEX IF NOT EXISTS idx_instruments_isin ON instruments(isin);
+CREATE INDEX IF NOT EXISTS idx_instruments_symbol ON instruments(exchange, segment, trading_symbol);
+CREATE INDEX IF NOT EXISTS idx_instruments_contract ON instruments(exchange, underlying, expiry, instrument_type, strike);
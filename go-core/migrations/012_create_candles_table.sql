@@ -0,0 +1,13 @@
+-- OHLCV price history shared by every user, one row per symbol, timeframe and bar
+-- timestamp is the UTC start of the bar; higher timeframes are resampled from imported bars
+CREATE TABLE IF NOT EXISTS candles (
+    symbol TEXT NOT NULL,
+    timeframe TEXT NOT NULL CHECK (timeframe IN ('1m', '5m', '15m', '30m', '1h', '4h', '1d', '1w')),
+    timestamp TIMESTAMP NOT NULL,
+    open REAL NOT NULL,
+    high REAL NOT NULL,
+    low REAL NOT NULL,
+    close REAL NOT NULL,
+    volume INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (symbol, timeframe, timestamp)
+) WITHOUT ROWID;
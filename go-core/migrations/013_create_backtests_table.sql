@@ -0,0 +1,24 @@
+-- Backtests: one row per simulated run of an algorithm over stored candles
+-- The run happens in the request, so rows are written once, when it has completed or failed
+CREATE TABLE IF NOT EXISTS backtests (
+    id TEXT PRIMARY KEY,
+    algorithm_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    timeframe TEXT NOT NULL,
+    settings TEXT NOT NULL,     -- JSON: capital, costs, sizing and fill rule
+    status TEXT NOT NULL CHECK (status IN ('completed', 'failed')),
+    error TEXT,                 -- why a failed run stopped
+    bar_count INTEGER NOT NULL DEFAULT 0,
+    start_at TIMESTAMP,         -- first simulated bar
+    end_at TIMESTAMP,           -- last simulated bar
+    metrics TEXT NOT NULL,      -- JSON object
+    trades TEXT NOT NULL,       -- JSON array of round trips
+    equity_curve TEXT NOT NULL, -- JSON array, one point per bar
+    duration_ms INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (algorithm_id) REFERENCES algorithms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_backtests_algorithm ON backtests(algorithm_id, created_at);
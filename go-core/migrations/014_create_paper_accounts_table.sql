@@ -0,0 +1,20 @@
+-- Paper trading: one simulated account per algorithm, advanced bar by bar over stored candles
+-- Journal trades it opens and closes carry the algorithm's ID
+ALTER TABLE trades ADD COLUMN algorithm_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_trades_algorithm_id ON trades(algorithm_id);
+
+CREATE TABLE IF NOT EXISTS paper_accounts (
+    algorithm_id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    settings TEXT NOT NULL,                 -- JSON: capital, costs, sizing and fill rule
+    account TEXT NOT NULL,                  -- JSON: cash, positions and pending orders
+    open_trades TEXT NOT NULL DEFAULT '{}', -- JSON: journal trade ID of each open position, by symbol
+    total_trades INTEGER NOT NULL DEFAULT 0,
+    winning_trades INTEGER NOT NULL DEFAULT 0,
+    last_bar_at TIMESTAMP,                  -- the last bar processed; later bars are still to come
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (algorithm_id) REFERENCES algorithms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -0,0 +1,15 @@
+-- Scheduled algorithm runs: the last bar close each enabled live algorithm was run for
+-- A bar close is claimed before its run starts, so a restart never runs it twice; runs left
+-- running by a restart are marked failed on startup
+CREATE TABLE IF NOT EXISTS algorithm_schedules (
+    algorithm_id TEXT PRIMARY KEY,
+    bar_close TIMESTAMP NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    signal TEXT,
+    bars INTEGER NOT NULL DEFAULT 0, -- bars a paper trading run processed
+    error TEXT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    duration_ms INTEGER,
+    FOREIGN KEY (algorithm_id) REFERENCES algorithms(id) ON DELETE CASCADE
+);
@@ -0,0 +1,28 @@
+-- Audit log of algorithm evaluations: every run of an algorithm's code outside backtests, with
+-- its inputs, signal, state changes, print output and errors
+CREATE TABLE IF NOT EXISTS algorithm_runs (
+    id TEXT PRIMARY KEY,
+    algorithm_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    source TEXT NOT NULL CHECK (source IN ('evaluate', 'scheduled', 'paper')),
+    status TEXT NOT NULL CHECK (status IN ('succeeded', 'failed')),
+    symbol TEXT NOT NULL,
+    bar_at TIMESTAMP,             -- timestamp of the latest input candle
+    bars INTEGER NOT NULL DEFAULT 0,
+    signal TEXT,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    price REAL,
+    stop_loss REAL,
+    target REAL,
+    reason TEXT,
+    state_diff TEXT,              -- JSON: added, changed and removed state keys
+    logs TEXT,                    -- JSON array of print() output
+    error TEXT,
+    steps INTEGER NOT NULL DEFAULT 0,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (algorithm_id) REFERENCES algorithms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_algorithm_runs_algorithm ON algorithm_runs(algorithm_id, created_at);
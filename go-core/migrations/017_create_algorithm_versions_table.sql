@@ -0,0 +1,25 @@
+-- Algorithm versions: an immutable row per change to an algorithm's code or config
+CREATE TABLE IF NOT EXISTS algorithm_versions (
+    id TEXT PRIMARY KEY,
+    algorithm_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    code TEXT NOT NULL,
+    config TEXT NOT NULL DEFAULT '{}', -- JSON object
+    author_id INTEGER NOT NULL,        -- user who made the change
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (algorithm_id, version),
+    FOREIGN KEY (algorithm_id) REFERENCES algorithms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Existing algorithms start their history at their current version
+INSERT OR IGNORE INTO algorithm_versions (id, algorithm_id, user_id, version, code, config, author_id, message, created_at)
+SELECT id || '-v' || version, id, user_id, version, code, COALESCE(config, '{}'), user_id,
+       'Version in use when history started', datetime(updated_at)
+FROM algorithms;
+
+-- The version of the code each backtest and run used
+ALTER TABLE backtests ADD COLUMN algorithm_version INTEGER;
+ALTER TABLE algorithm_runs ADD COLUMN algorithm_version INTEGER;
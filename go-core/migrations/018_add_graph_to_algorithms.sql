@@ -0,0 +1,3 @@
+-- Visual algorithms: the canvas node graph an algorithm's code is compiled from
+ALTER TABLE algorithms ADD COLUMN graph TEXT;         -- JSON, NULL for code algorithms
+ALTER TABLE algorithm_versions ADD COLUMN graph TEXT; -- JSON, the graph of the version's code